@@ -0,0 +1,6 @@
+#!/bin/sh
+
+# 由broker的FilterServerManager调用，参数透传给mqfiltersrv：-c broker配置文件 -n namesrv地址
+BASE_DIR=$(cd "$(dirname "$0")/.." && pwd)
+
+nohup "${BASE_DIR}/bin/mqfiltersrv" "$@" >> "${BASE_DIR}/fsrv.out" 2>&1 &
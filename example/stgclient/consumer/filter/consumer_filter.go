@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"git.oschina.net/cloudzone/smartgo/stgclient/consumer"
+	"git.oschina.net/cloudzone/smartgo/stgclient/consumer/listener"
+	"git.oschina.net/cloudzone/smartgo/stgclient/process"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/message"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/heartbeat"
+)
+
+type MessageListenerImpl struct {
+}
+
+func (listenerImpl *MessageListenerImpl) ConsumeMessage(msgs []*message.MessageExt, context *consumer.ConsumeConcurrentlyContext) listener.ConsumeConcurrentlyStatus {
+	for _, msg := range msgs {
+		fmt.Println(msg.ToString(), msg.Properties)
+	}
+	return listener.CONSUME_SUCCESS
+}
+
+var (
+	def_consumerGroupId = "consumerGroupId-filter"
+	def_topic           = "cloudzone123"
+	def_namesrvAddr     = "10.112.68.189:9876"
+	def_filter          = "TAGS = 'tagA' AND amount > 100"
+)
+
+// broker需要配置filterServerNums启动Filter Server，消息在Filter Server过滤后再投递给消费者
+func main() {
+	consumerGroupId := flag.String("p", def_consumerGroupId, "the consumer group id ")
+	topic := flag.String("topic", def_topic, "the topic for use")
+	filterSource := flag.String("filter", def_filter, "the filter expression")
+	namesrvAddr := flag.String("h", def_namesrvAddr, "the namesrv ip:port")
+	flag.Parse()
+
+	defaultMQPushConsumer := process.NewDefaultMQPushConsumer(*consumerGroupId)
+	defaultMQPushConsumer.SetConsumeFromWhere(heartbeat.CONSUME_FROM_LAST_OFFSET)
+	defaultMQPushConsumer.SetMessageModel(heartbeat.CLUSTERING)
+	defaultMQPushConsumer.SetNamesrvAddr(*namesrvAddr)
+	if err := defaultMQPushConsumer.SubscribeFilterClass(*topic, "AmountFilter", *filterSource); err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	defaultMQPushConsumer.RegisterMessageListener(&MessageListenerImpl{})
+	defaultMQPushConsumer.Start()
+	select {}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"git.oschina.net/cloudzone/smartgo/stgclient/process"
+	"time"
+)
+
+func main() {
+	simpleConsumer := process.NewSimpleConsumer("mySimpleConsumerGroup")
+	simpleConsumer.SetNamesrvAddr("127.0.0.1:9876")
+	simpleConsumer.Start()
+
+	for i := 0; i < 100; i++ {
+		msgs, err := simpleConsumer.Receive("TestTopic", 16, time.Second*30)
+		if err != nil {
+			fmt.Println(err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		for _, msg := range msgs {
+			fmt.Println(string(msg.Body))
+			// 未Ack的消息在不可见时间之后进入重试队列重新被拉取
+			if err := simpleConsumer.Ack(msg); err != nil {
+				fmt.Println(err)
+			}
+		}
+		if len(msgs) == 0 {
+			time.Sleep(time.Second)
+		}
+	}
+
+	simpleConsumer.Shutdown()
+}
@@ -12,10 +12,12 @@ import (
 	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/body"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/header"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/header/filtersrv"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/quota"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/subscription"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/utils/remotingUtil"
 	"git.oschina.net/cloudzone/smartgo/stgnet/netm"
 	"git.oschina.net/cloudzone/smartgo/stgnet/protocol"
+	"git.oschina.net/cloudzone/smartgo/stgstorelog"
 	set "github.com/deckarep/golang-set"
 	strconv "strconv"
 	"strings"
@@ -50,7 +52,7 @@ func (self *AdminBrokerProcessor) ProcessRequest(ctx netm.Context, request *prot
 	case code.GET_ALL_TOPIC_CONFIG:
 		return self.getAllTopicConfig(ctx, request) // 获取所有Topic配置
 	case code.UPDATE_BROKER_CONFIG:
-		return self.updateBrokerConfig(ctx, request) // TODO: 更新Broker配置,可能存在并发问题
+		return self.updateBrokerConfig(ctx, request) // 更新Broker配置
 	case code.GET_BROKER_CONFIG:
 		return self.getBrokerConfig(ctx, request) // 获取Broker配置
 	case code.SEARCH_OFFSET_BY_TIMESTAMP:
@@ -109,6 +111,20 @@ func (self *AdminBrokerProcessor) ProcessRequest(ctx netm.Context, request *prot
 		return self.cloneGroupOffset(ctx, request)
 	case code.VIEW_BROKER_STATS_DATA:
 		return self.ViewBrokerStatsData(ctx, request) // 查看Broker统计信息
+	case code.UPDATE_STORE_MODE:
+		return self.updateStoreMode(ctx, request) // 强制指定或清除存储模式
+	case code.REBUILD_CONSUME_QUEUE:
+		return self.rebuildConsumeQueue(ctx, request) // 重建逻辑队列及索引
+	case code.CREATE_STORE_SNAPSHOT:
+		return self.createStoreSnapshot(ctx, request) // 生成存储快照
+	case code.UPDATE_AND_CREATE_QUOTA:
+		return self.updateAndCreateQuota(ctx, request) // 创建或更新限流配额
+	case code.DELETE_QUOTA:
+		return self.deleteQuota(ctx, request) // 删除限流配额
+	case code.GET_ALL_QUOTA_CONFIG:
+		return self.getAllQuotaConfig(ctx, request) // 获取所有限流配额
+	case code.GET_CONSUMER_LAG:
+		return self.getConsumerLag(ctx, request) // 获取消费延迟
 	default:
 
 	}
@@ -137,6 +153,18 @@ func (self *AdminBrokerProcessor) updateAndCreateTopic(ctx netm.Context, request
 		return response, nil
 	}
 
+	if requestHeader.RetentionHours < 0 || requestHeader.RetentionBytes < 0 {
+		format := "the topic[%s] retentionHours[%d] and retentionBytes[%d] must not be negative."
+		response.Remark = fmt.Sprintf(format, topic, requestHeader.RetentionHours, requestHeader.RetentionBytes)
+		return response, nil
+	}
+
+	if requestHeader.MessageTtlSeconds < 0 {
+		format := "the topic[%s] messageTtlSeconds[%d] must not be negative."
+		response.Remark = fmt.Sprintf(format, topic, requestHeader.MessageTtlSeconds)
+		return response, nil
+	}
+
 	readQueueNums := requestHeader.ReadQueueNums
 	writeQueueNums := requestHeader.WriteQueueNums
 	brokerPermission := requestHeader.Perm
@@ -145,6 +173,11 @@ func (self *AdminBrokerProcessor) updateAndCreateTopic(ctx netm.Context, request
 	if requestHeader.TopicSysFlag != 0 {
 		topicConfig.TopicSysFlag = requestHeader.TopicSysFlag
 	}
+	topicConfig.CleanupPolicy = requestHeader.CleanupPolicy
+	topicConfig.RetentionHours = requestHeader.RetentionHours
+	topicConfig.RetentionBytes = requestHeader.RetentionBytes
+	topicConfig.IndexedProperties = requestHeader.GetIndexedProperties()
+	topicConfig.MessageTtlSeconds = requestHeader.MessageTtlSeconds
 	self.BrokerController.TopicConfigManager.UpdateTopicConfig(topicConfig)
 	self.BrokerController.RegisterBrokerAll(false, true)
 
@@ -219,19 +252,27 @@ func (adp *AdminBrokerProcessor) updateBrokerConfig(ctx netm.Context, request *p
 	logger.Infof("updateBrokerConfig called by %s", remotingUtil.ParseChannelRemoteAddr(ctx))
 
 	content := request.Body
-	logger.Infof("BrokerConfig:%s", string(content))
-	if content != nil {
-		logger.Infof("updateBrokerConfig, new config: %s, client: %s", string(content), ctx.RemoteAddr().String())
-		adp.BrokerController.UpdateAllConfig(content)
-	} else {
+	if content == nil {
 		logger.Error("string2Properties error")
 		response.Code = code.SYSTEM_ERROR
 		response.Remark = "string2Properties error"
 		return response, nil
 	}
 
+	logger.Infof("updateBrokerConfig, new config: %s, client: %s", string(content), ctx.RemoteAddr().String())
+	result, err := adp.BrokerController.UpdateAllConfig(content)
+	if err != nil {
+		logger.Errorf("updateBrokerConfig failed: %s", err.Error())
+		response.Code = code.SYSTEM_ERROR
+		response.Remark = err.Error()
+		return response, nil
+	}
+
 	response.Code = code.SUCCESS
 	response.Remark = ""
+	if len(result.RestartRequired) > 0 {
+		response.Remark = fmt.Sprintf("restart required: %s", strings.Join(result.RestartRequired, ","))
+	}
 	return response, nil
 }
 
@@ -395,6 +436,13 @@ func (self *AdminBrokerProcessor) prepareRuntimeInfo() map[string]string {
 	runtimeInfo["msgGetTotalTodayNow"] = fmt.Sprintf("%d", self.BrokerController.brokerStats.GetMsgGetTotalTodayNow())
 
 	runtimeInfo["sendThreadPoolQueueCapacity"] = fmt.Sprintf("%d", self.BrokerController.BrokerConfig.SendThreadPoolQueueCapacity)
+	if executor := self.BrokerController.sendMessageExecutor; executor != nil {
+		runtimeInfo["sendThreadPoolQueueSize"] = fmt.Sprintf("%d", executor.QueueSize())
+	}
+	runtimeInfo["pullThreadPoolQueueCapacity"] = fmt.Sprintf("%d", self.BrokerController.BrokerConfig.PullThreadPoolQueueCapacity)
+	if executor := self.BrokerController.pullMessageExecutor; executor != nil {
+		runtimeInfo["pullThreadPoolQueueSize"] = fmt.Sprintf("%d", executor.QueueSize())
+	}
 
 	return runtimeInfo
 }
@@ -413,6 +461,14 @@ func (abp *AdminBrokerProcessor) updateAndCreateSubscriptionGroup(ctx netm.Conte
 		logger.Error(err)
 	}
 
+	if config.RetryPolicy != nil {
+		if err = config.RetryPolicy.Validate(); err != nil {
+			response.Code = code.SYSTEM_ERROR
+			response.Remark = err.Error()
+			return response, nil
+		}
+	}
+
 	if config != nil {
 		abp.BrokerController.SubscriptionGroupManager.UpdateSubscriptionGroupConfig(config)
 	}
@@ -918,6 +974,179 @@ func (abp *AdminBrokerProcessor) cleanExpiredConsumeQueue(ctx netm.Context, requ
 	return response, nil
 }
 
+// updateStoreMode 故障处理时强制指定或清除存储模式，返回变更后的存储模式
+// Since 2018/1/18
+func (abp *AdminBrokerProcessor) updateStoreMode(ctx netm.Context, request *protocol.RemotingCommand) (*protocol.RemotingCommand, error) {
+	response := protocol.CreateDefaultResponseCommand()
+	requestHeader := &header.UpdateStoreModeRequestHeader{}
+	err := request.DecodeCommandCustomHeader(requestHeader)
+	if err != nil {
+		logger.Errorf("err: %s", err.Error())
+		return response, err
+	}
+
+	mode, err := stgstorelog.ParseStoreMode(requestHeader.Mode)
+	if err != nil {
+		response.Code = code.SYSTEM_ERROR
+		response.Remark = err.Error()
+		return response, nil
+	}
+
+	logger.Warnf("update store mode %s, force: %t, from %s", mode, requestHeader.Force, remotingUtil.ParseChannelRemoteAddr(ctx))
+	abp.BrokerController.MessageStore.UpdateStoreMode(mode, requestHeader.Force)
+
+	runtimeInfo := abp.BrokerController.MessageStore.GetRuntimeInfo()
+	kvTable := &body.KVTable{Table: map[string]string{
+		stgcommon.STORE_MODE.String():          runtimeInfo[stgcommon.STORE_MODE.String()],
+		stgcommon.STORE_MODE_FORCED.String():   runtimeInfo[stgcommon.STORE_MODE_FORCED.String()],
+		stgcommon.STORE_RUNNING_FLAGS.String(): runtimeInfo[stgcommon.STORE_RUNNING_FLAGS.String()],
+	}}
+
+	response.Body = stgcommon.Encode(kvTable)
+	response.Code = code.SUCCESS
+	response.Remark = ""
+	return response, nil
+}
+
+// rebuildConsumeQueue 根据CommitLog异步重建逻辑队列及索引，重建进度通过GET_BROKER_RUNTIME_INFO查询
+// Since 2018/1/19
+func (abp *AdminBrokerProcessor) rebuildConsumeQueue(ctx netm.Context, request *protocol.RemotingCommand) (*protocol.RemotingCommand, error) {
+	response := protocol.CreateDefaultResponseCommand()
+	requestHeader := &header.RebuildConsumeQueueRequestHeader{}
+	err := request.DecodeCommandCustomHeader(requestHeader)
+	if err != nil {
+		logger.Errorf("err: %s", err.Error())
+		return response, err
+	}
+
+	logger.Warnf("rebuild consume queue, topic: %s queueId: %d rebuildIndex: %t dryRun: %t, from %s", requestHeader.Topic,
+		requestHeader.QueueId, requestHeader.RebuildIndex, requestHeader.DryRun, remotingUtil.ParseChannelRemoteAddr(ctx))
+	err = abp.BrokerController.MessageStore.RebuildConsumeQueue(requestHeader.Topic, requestHeader.QueueId,
+		requestHeader.RebuildIndex, requestHeader.DryRun)
+	if err != nil {
+		response.Code = code.SYSTEM_ERROR
+		response.Remark = err.Error()
+		return response, nil
+	}
+
+	response.Code = code.SUCCESS
+	response.Remark = ""
+	return response, nil
+}
+
+// createStoreSnapshot 持久化Topic、消费进度及订阅组配置后，在线生成存储快照，用于容灾演练时在其他节点恢复
+// Since 2018/1/22
+func (abp *AdminBrokerProcessor) createStoreSnapshot(ctx netm.Context, request *protocol.RemotingCommand) (*protocol.RemotingCommand, error) {
+	response := protocol.CreateDefaultResponseCommand()
+	requestHeader := &header.CreateStoreSnapshotRequestHeader{}
+	err := request.DecodeCommandCustomHeader(requestHeader)
+	if err != nil {
+		logger.Errorf("err: %s", err.Error())
+		return response, err
+	}
+
+	logger.Warnf("create store snapshot %s, from %s", requestHeader.SnapshotDir, remotingUtil.ParseChannelRemoteAddr(ctx))
+	brokerController := abp.BrokerController
+	brokerController.TopicConfigManager.ConfigManagerExt.Persist()
+	brokerController.ConsumerOffsetManager.configManagerExt.Persist()
+	brokerController.SubscriptionGroupManager.ConfigManagerExt.Persist()
+	brokerController.QuotaManager.ConfigManagerExt.Persist()
+
+	manifest, err := brokerController.MessageStore.CreateSnapshot(requestHeader.SnapshotDir,
+		brokerController.TopicConfigManager.ConfigFilePath(),
+		brokerController.ConsumerOffsetManager.ConfigFilePath(),
+		brokerController.SubscriptionGroupManager.ConfigFilePath(),
+		brokerController.QuotaManager.ConfigFilePath())
+	if err != nil {
+		response.Code = code.SYSTEM_ERROR
+		response.Remark = err.Error()
+		return response, nil
+	}
+
+	kvTable := &body.KVTable{Table: map[string]string{
+		"snapshotDir":     requestHeader.SnapshotDir,
+		"createTimestamp": fmt.Sprintf("%d", manifest.CreateTimestamp),
+		"minPhyOffset":    fmt.Sprintf("%d", manifest.MinPhyOffset),
+		"fencedOffset":    fmt.Sprintf("%d", manifest.FencedOffset),
+		"fileNums":        fmt.Sprintf("%d", len(manifest.Files)),
+		"totalSize":       fmt.Sprintf("%d", manifest.TotalSize()),
+	}}
+
+	response.Body = stgcommon.Encode(kvTable)
+	response.Code = code.SUCCESS
+	response.Remark = ""
+	return response, nil
+}
+
+// updateAndCreateQuota 创建或更新限流配额，请求body为QuotaConfig
+// Since 2018/1/29
+func (abp *AdminBrokerProcessor) updateAndCreateQuota(ctx netm.Context, request *protocol.RemotingCommand) (*protocol.RemotingCommand, error) {
+	response := protocol.CreateDefaultResponseCommand()
+	logger.Infof("updateAndCreateQuota called by %s", remotingUtil.ParseChannelRemoteAddr(ctx))
+
+	config := &quota.QuotaConfig{}
+	err := stgcommon.Decode(request.Body, config)
+	if err == nil {
+		err = abp.BrokerController.QuotaManager.UpdateQuotaConfig(config)
+	}
+	if err != nil {
+		response.Code = code.SYSTEM_ERROR
+		response.Remark = err.Error()
+		return response, nil
+	}
+
+	response.Code = code.SUCCESS
+	response.Remark = ""
+	return response, nil
+}
+
+// deleteQuota 删除限流配额
+// Since 2018/1/29
+func (abp *AdminBrokerProcessor) deleteQuota(ctx netm.Context, request *protocol.RemotingCommand) (*protocol.RemotingCommand, error) {
+	response := protocol.CreateDefaultResponseCommand()
+	requestHeader := &header.DeleteQuotaRequestHeader{}
+	err := request.DecodeCommandCustomHeader(requestHeader)
+	if err != nil {
+		logger.Errorf("err: %s", err.Error())
+		return response, err
+	}
+
+	logger.Infof("deleteQuota called by %s", remotingUtil.ParseChannelRemoteAddr(ctx))
+	abp.BrokerController.QuotaManager.DeleteQuotaConfig(requestHeader.Dimension, requestHeader.Name)
+
+	response.Code = code.SUCCESS
+	response.Remark = ""
+	return response, nil
+}
+
+// getAllQuotaConfig 获取所有限流配额，响应body为QuotaConfigTable
+// Since 2018/1/29
+func (abp *AdminBrokerProcessor) getAllQuotaConfig(ctx netm.Context, request *protocol.RemotingCommand) (*protocol.RemotingCommand, error) {
+	response := protocol.CreateDefaultResponseCommand()
+	response.Body = []byte(abp.BrokerController.QuotaManager.Encode(false))
+	response.Code = code.SUCCESS
+	response.Remark = ""
+	return response, nil
+}
+
+// getConsumerLag 获取ConsumerLagService最近一次计算的消费延迟
+// Since 2018/1/31
+func (abp *AdminBrokerProcessor) getConsumerLag(ctx netm.Context, request *protocol.RemotingCommand) (*protocol.RemotingCommand, error) {
+	response := protocol.CreateDefaultResponseCommand()
+
+	requestHeader := &header.GetConsumerLagRequestHeader{}
+	err := request.DecodeCommandCustomHeader(requestHeader)
+	if err != nil {
+		logger.Error(err)
+	}
+
+	lagTable := abp.BrokerController.ConsumerLagService.GetConsumerLag(requestHeader.ConsumerGroup, requestHeader.Topic)
+	response.Body = stgcommon.Encode(lagTable)
+	response.Code = code.SUCCESS
+	response.Remark = ""
+	return response, nil
+}
+
 // getConsumerRunningInfo 调用Consumer，获取Consumer内存数据结构，为监控以及定位问题
 // Author rongzhihong
 // Since 2017/9/19
@@ -1092,6 +1321,26 @@ func (abp *AdminBrokerProcessor) ViewBrokerStatsData(ctx netm.Context, request *
 
 	statsItem := abp.BrokerController.MessageStore.BrokerStatsManager.GetStatsItem(requestHeader.StatsName, requestHeader.StatsKey)
 	if nil == statsItem {
+		// 存储层统计项只保留最近一分钟的数据
+		storeStatsItem := abp.BrokerController.MessageStore.StoreStatsService.GetStatsItem(requestHeader.StatsName, requestHeader.StatsKey)
+		if storeStatsItem != nil {
+			brokerStatsData := body.NewBrokerStatsData()
+			brokerStatsData.StatsMinute = &body.BrokerStatsItem{
+				Sum:   storeStatsItem.Sum,
+				Tps:   storeStatsItem.Tps,
+				Avgpt: storeStatsItem.Avgpt,
+				P50:   storeStatsItem.P50,
+				P99:   storeStatsItem.P99,
+				P999:  storeStatsItem.P999,
+				Max:   storeStatsItem.Max,
+			}
+
+			response.Body = stgcommon.Encode(brokerStatsData)
+			response.Code = code.SUCCESS
+			response.Remark = ""
+			return response, nil
+		}
+
 		response.Code = code.SYSTEM_ERROR
 		response.Remark = fmt.Sprintf("The stats <%s> <%s> not exist", requestHeader.StatsName, requestHeader.StatsKey)
 		return response, nil
@@ -0,0 +1,262 @@
+package stgbroker
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.oschina.net/cloudzone/smartgo/stgbroker/dynconfig"
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
+	"git.oschina.net/cloudzone/smartgo/stgstorelog"
+	"git.oschina.net/cloudzone/smartgo/stgstorelog/config"
+	"github.com/BurntSushi/toml"
+)
+
+const brokerConfigWatchInterval = 5 * time.Second
+
+// NewBrokerConfigRegistry 注册broker toml中可配置的BrokerConfig、MessageStoreConfig配置项，
+// key与toml配置项名称一致，标记为热更新的配置项在运行中通过GetXxx方法读取，修改后立即生效
+// Since 2018/2/2
+func NewBrokerConfigRegistry(brokerConfig *stgcommon.BrokerConfig, storeConfig *stgstorelog.MessageStoreConfig) *dynconfig.Registry {
+	registry := dynconfig.NewRegistry(brokerConfig, storeConfig)
+
+	// 启动时确定的配置项，修改后重启生效
+	registry.Register(
+		dynconfig.StringItem("brokerClusterName", &brokerConfig.BrokerClusterName, false, dynconfig.NotBlank),
+		dynconfig.StringItem("brokerName", &brokerConfig.BrokerName, false, dynconfig.NotBlank),
+		dynconfig.Int64Item("brokerId", &brokerConfig.BrokerId, false, 0, math.MaxInt32),
+		dynconfig.IntItem("brokerPort", &brokerConfig.BrokerPort, false, 0, 65535),
+		dynconfig.StringItem("storePathRootDir", &brokerConfig.StorePathRootDir, false, dynconfig.NotBlank),
+		dynconfig.StringItem("haMasterAddress", &brokerConfig.HaMasterAddress, false, nil),
+		dynconfig.BoolItem("aclEnable", &brokerConfig.AclEnable, false),
+		dynconfig.StringItem("aclConfigPath", &brokerConfig.AclConfigPath, false, nil),
+		dynconfig.IntItem("metricsPort", &brokerConfig.MetricsPort, false, 0, 65535),
+		dynconfig.IntItem("sendMessageThreadPoolNums", &brokerConfig.SendMessageThreadPoolNums, false, 1, 1024),
+		dynconfig.IntItem("pullMessageThreadPoolNums", &brokerConfig.PullMessageThreadPoolNums, false, 1, 1024),
+		dynconfig.IntItem("sendThreadPoolQueueCapacity", &brokerConfig.SendThreadPoolQueueCapacity, false, 1, math.MaxInt32),
+		dynconfig.IntItem("pullThreadPoolQueueCapacity", &brokerConfig.PullThreadPoolQueueCapacity, false, 1, math.MaxInt32),
+		dynconfig.Int32Item("mapedFileSizeCommitLog", &storeConfig.MapedFileSizeCommitLog, false, 1024*1024, math.MaxInt32),
+		dynconfig.Int32Item("maxMessageSize", &storeConfig.MaxMessageSize, false, 1024, 64*1024*1024),
+		dynconfig.NewConfigItem("brokerRole", false, true,
+			func() string { return storeConfig.BrokerRole.ToString() },
+			func(value string) (func(), error) {
+				brokerRole, err := config.ParseBrokerRole(strings.TrimSpace(value))
+				if err != nil {
+					return nil, err
+				}
+				return func() { storeConfig.BrokerRole = brokerRole }, nil
+			}),
+		dynconfig.NewConfigItem("flushDiskType", false, true,
+			func() string { return storeConfig.FlushDiskType.FlushDiskTypeString() },
+			func(value string) (func(), error) {
+				flushDiskType, err := config.ParseFlushDiskType(strings.TrimSpace(value))
+				if err != nil {
+					return nil, err
+				}
+				return func() { storeConfig.FlushDiskType = flushDiskType }, nil
+			}),
+	)
+
+	// 热更新的配置项
+	registry.Register(
+		dynconfig.StringItem("namesrvAddr", &brokerConfig.NamesrvAddr, true, dynconfig.NotBlank),
+		dynconfig.IntItem("brokerPermission", &brokerConfig.BrokerPermission, true, 0, 7),
+		dynconfig.Int32Item("defaultTopicQueueNums", &brokerConfig.DefaultTopicQueueNums, true, 1, 1024),
+		dynconfig.BoolItem("autoCreateTopicEnable", &brokerConfig.AutoCreateTopicEnable, true),
+		dynconfig.BoolItem("autoCreateSubscriptionGroup", &brokerConfig.AutoCreateSubscriptionGroup, true),
+		dynconfig.BoolItem("rejectTransactionMessage", &brokerConfig.RejectTransactionMessage, true),
+		dynconfig.BoolItem("longPollingEnable", &brokerConfig.LongPollingEnable, true),
+		dynconfig.IntItem("shortPollingTimeMills", &brokerConfig.ShortPollingTimeMills, true, 0, 60*1000),
+		dynconfig.BoolItem("notifyConsumerIdsChangedEnable", &brokerConfig.NotifyConsumerIdsChangedEnable, true),
+		dynconfig.BoolItem("offsetCheckInSlave", &brokerConfig.OffsetCheckInSlave, true),
+		dynconfig.BoolItem("slaveReadEnable", &brokerConfig.SlaveReadEnable, true),
+		dynconfig.BoolItem("transferMsgByHeap", &brokerConfig.TransferMsgByHeap, true),
+		dynconfig.IntItem("flushConsumerOffsetInterval", &brokerConfig.FlushConsumerOffsetInterval, true, 1000, 10*60*1000),
+		dynconfig.Int64Item("waitTimeMillsInSendQueue", &brokerConfig.WaitTimeMillsInSendQueue, true, 0, 60*1000),
+		dynconfig.Int64Item("waitTimeMillsInPullQueue", &brokerConfig.WaitTimeMillsInPullQueue, true, 0, 60*1000),
+		dynconfig.Int64Item("consumerLagCalcInterval", &brokerConfig.ConsumerLagCalcInterval, true, 1000, 60*60*1000),
+		dynconfig.Int64Item("consumerLagAlertMessages", &brokerConfig.ConsumerLagAlertMessages, true, 0, math.MaxInt64),
+		dynconfig.Int64Item("consumerLagAlertSeconds", &brokerConfig.ConsumerLagAlertSeconds, true, 0, math.MaxInt64),
+		dynconfig.BoolItem("quotaEnable", &brokerConfig.QuotaEnable, true),
+		dynconfig.Int32Item("filterServerNums", &brokerConfig.FilterServerNums, true, 0, 16),
+
+		dynconfig.Int32Item("flushIntervalCommitLog", &storeConfig.FlushIntervalCommitLog, true, 1, 60*1000),
+		dynconfig.Int32Item("flushIntervalConsumeQueue", &storeConfig.FlushIntervalConsumeQueue, true, 1, 60*1000),
+		dynconfig.Int32Item("flushCommitLogLeastPages", &storeConfig.FlushCommitLogLeastPages, true, 0, 1024),
+		dynconfig.Int32Item("flushConsumeQueueLeastPages", &storeConfig.FlushConsumeQueueLeastPages, true, 0, 1024),
+		dynconfig.Int32Item("flushCommitLogThoroughInterval", &storeConfig.FlushCommitLogThoroughInterval, true, 0, 60*60*1000),
+		dynconfig.Int32Item("flushConsumeQueueThoroughInterval", &storeConfig.FlushConsumeQueueThoroughInterval, true, 0, 60*60*1000),
+		dynconfig.Int32Item("syncFlushTimeout", &storeConfig.SyncFlushTimeout, true, 1, 60*1000),
+		dynconfig.Int64Item("fileReservedTime", &storeConfig.FileReservedTime, true, 1, 24*365),
+		dynconfig.NewConfigItem("deleteWhen", true, false,
+			func() string {
+				// toml中为整数小时
+				if hour, err := strconv.Atoi(storeConfig.DeleteWhen); err == nil {
+					return strconv.Itoa(hour)
+				}
+				return storeConfig.DeleteWhen
+			},
+			func(value string) (func(), error) {
+				hour, err := strconv.Atoi(strings.TrimSpace(value))
+				if err != nil || hour < 0 || hour > 23 {
+					return nil, fmt.Errorf("deleteWhen must be an hour in [0, 23], %s", value)
+				}
+				return func() { storeConfig.DeleteWhen = fmt.Sprintf("%02d", hour) }, nil
+			}),
+		dynconfig.Int32Item("diskMaxUsedSpaceRatio", &storeConfig.DiskMaxUsedSpaceRatio, true, 10, 95),
+		dynconfig.BoolItem("cleanFileForciblyEnable", &storeConfig.CleanFileForciblyEnable, true),
+		dynconfig.Int64Item("accessMessageInMemoryMaxRatio", &storeConfig.AccessMessageInMemoryMaxRatio, true, 0, 100),
+		dynconfig.Int32Item("maxTransferBytesOnMessageInMemory", &storeConfig.MaxTransferBytesOnMessageInMemory, true, 1, math.MaxInt32),
+		dynconfig.Int32Item("maxTransferCountOnMessageInMemory", &storeConfig.MaxTransferCountOnMessageInMemory, true, 1, math.MaxInt32),
+		dynconfig.Int32Item("maxTransferBytesOnMessageInDisk", &storeConfig.MaxTransferBytesOnMessageInDisk, true, 1, math.MaxInt32),
+		dynconfig.Int32Item("maxTransferCountOnMessageInDisk", &storeConfig.MaxTransferCountOnMessageInDisk, true, 1, math.MaxInt32),
+		dynconfig.Int32Item("haSlaveFallbehindMax", &storeConfig.HaSlaveFallbehindMax, true, 0, math.MaxInt32),
+		dynconfig.Int64Item("osPageCacheBusyTimeOutMills", &storeConfig.OsPageCacheBusyTimeOutMills, true, 0, 60*1000),
+	)
+	return registry
+}
+
+// ReadBrokerConfigFile 读取broker toml中的顶层配置项，值统一转为字符串，表（如[tls]）忽略
+// Since 2018/2/2
+func ReadBrokerConfigFile(cfgPath string) (map[string]string, error) {
+	content := make(map[string]interface{})
+	if _, err := toml.DecodeFile(cfgPath, &content); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(content))
+	for key, value := range content {
+		switch v := value.(type) {
+		case string:
+			values[key] = v
+		case int64, bool, float64:
+			values[key] = fmt.Sprintf("%v", v)
+		}
+	}
+	return values, nil
+}
+
+// decodeBrokerConfigUpdate 解析UPDATE_BROKER_CONFIG请求：key -> value的配置项，
+// 兼容旧版本的完整BrokerAllConfig，此时只取已注册的配置项
+func decodeBrokerConfigUpdate(registry *dynconfig.Registry, content []byte) (map[string]string, error) {
+	properties := make(map[string]interface{})
+	if err := json.Unmarshal(content, &properties); err != nil {
+		return nil, err
+	}
+
+	_, hasBrokerConfig := properties["brokerConfig"]
+	_, hasStoreConfig := properties["messageStoreConfig"]
+	if !hasBrokerConfig && !hasStoreConfig {
+		return stringifyProperties(properties), nil
+	}
+
+	values := make(map[string]string)
+	for _, section := range []string{"brokerConfig", "messageStoreConfig"} {
+		sectionProperties, ok := properties[section].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for key, value := range stringifyProperties(sectionProperties) {
+			// BrokerRole、FlushDiskType在json中为枚举值，只能通过key -> value方式修改
+			if strings.EqualFold(key, "brokerRole") || strings.EqualFold(key, "flushDiskType") {
+				continue
+			}
+			if _, ok := registry.Item(key); ok {
+				values[key] = value
+			}
+		}
+	}
+	return values, nil
+}
+
+func stringifyProperties(properties map[string]interface{}) map[string]string {
+	values := make(map[string]string, len(properties))
+	for key, value := range properties {
+		switch v := value.(type) {
+		case string:
+			values[key] = v
+		case float64:
+			values[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			values[key] = strconv.FormatBool(v)
+		}
+	}
+	return values
+}
+
+func (self *BrokerController) updateConfig(values map[string]string) (*dynconfig.UpdateResult, error) {
+	result, err := self.ConfigRegistry.Update(values)
+	if err != nil {
+		return nil, err
+	}
+	if !result.Changed() {
+		return result, nil
+	}
+
+	logger.Infof("update broker config, applied: %v, restart required: %v", result.Applied, result.RestartRequired)
+	self.ConfigDataVersion.NextVersion()
+	self.flushAllConfig(append(result.Applied, result.RestartRequired...))
+	return result, nil
+}
+
+// onConfigApplied 热更新的配置项生效后，调整启动时按配置创建的定时任务及连接
+func (self *BrokerController) onConfigApplied(applied []string) {
+	for _, key := range applied {
+		switch key {
+		case "namesrvAddr":
+			self.BrokerOuterAPI.UpdateNameServerAddressList(strings.TrimSpace(self.BrokerConfig.GetNamesrvAddr()))
+		case "brokerPermission":
+			go self.RegisterBrokerAll(true, false)
+		case "flushConsumerOffsetInterval":
+			if self.brokerControllerTask != nil && self.brokerControllerTask.PersistConsumerOffsetTask != nil {
+				period := time.Duration(self.BrokerConfig.GetFlushConsumerOffsetInterval()) * time.Millisecond
+				self.brokerControllerTask.PersistConsumerOffsetTask.SetPeriod(period)
+			}
+		case "consumerLagCalcInterval":
+			if self.ConsumerLagService != nil {
+				self.ConsumerLagService.SetCalcInterval(time.Duration(self.BrokerConfig.GetConsumerLagCalcInterval()) * time.Millisecond)
+			}
+		}
+	}
+}
+
+// startConfigWatcher broker toml被修改后重新读取，只更新与运行中不一致的配置项
+func (self *BrokerController) startConfigWatcher() {
+	if !isRegularFile(self.ConfigFile) {
+		return
+	}
+
+	self.configWatcher = dynconfig.NewFileWatcher(self.ConfigFile, brokerConfigWatchInterval, func() {
+		values, err := ReadBrokerConfigFile(self.ConfigFile)
+		if err != nil {
+			logger.Errorf("reload broker config %s failed: %s", self.ConfigFile, err.Error())
+			return
+		}
+
+		// 未注册的配置项（如brokerIP、[tls]）只在启动时读取
+		changes := make(map[string]string)
+		for key, value := range values {
+			if _, ok := self.ConfigRegistry.Item(key); ok {
+				changes[key] = value
+			}
+		}
+		if _, err := self.updateConfig(changes); err != nil {
+			logger.Errorf("reload broker config %s failed: %s", self.ConfigFile, err.Error())
+		}
+	})
+	self.configWatcher.Start()
+	logger.Infof("watch broker config file %s", self.ConfigFile)
+}
+
+func isRegularFile(path string) bool {
+	if path == "" {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
@@ -0,0 +1,70 @@
+package stgbroker
+
+import (
+	"sync"
+	"testing"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
+	"git.oschina.net/cloudzone/smartgo/stgstorelog"
+)
+
+// TestBrokerConfigRegistry_UpdateWhileReading 热更新与运行中读取配置项并发执行，需通过 go test -race 运行
+func TestBrokerConfigRegistry_UpdateWhileReading(t *testing.T) {
+	brokerConfig := stgcommon.NewDefaultBrokerConfig()
+	storeConfig := stgstorelog.NewMessageStoreConfig()
+	registry := NewBrokerConfigRegistry(brokerConfig, storeConfig)
+
+	started, stop := make(chan struct{}), make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			if i == 1 {
+				close(started)
+			}
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			if when := storeConfig.GetDeleteWhen(); when != "04" && when != "05" {
+				t.Errorf("unexpected deleteWhen %s", when)
+			}
+			if pages := storeConfig.GetFlushCommitLogLeastPages(); pages != 4 && pages != 8 {
+				t.Errorf("unexpected flushCommitLogLeastPages %d", pages)
+			}
+			if brokerConfig.GetLongPollingEnable() && brokerConfig.GetShortPollingTimeMills() < 0 {
+				t.Errorf("unexpected shortPollingTimeMills %d", brokerConfig.GetShortPollingTimeMills())
+			}
+			if !brokerConfig.HasReadable() {
+				t.Errorf("broker should be readable, brokerPermission %d", brokerConfig.GetBrokerPermission())
+			}
+
+			brokerConfig.RLock()
+			storeConfig.RLock()
+			stgcommon.Encode(NewDefaultBrokerAllConfig(brokerConfig, storeConfig))
+			storeConfig.RUnlock()
+			brokerConfig.RUnlock()
+		}
+	}()
+
+	<-started
+	for i := 0; i < 1000; i++ {
+		values := map[string]string{"deleteWhen": "5", "flushCommitLogLeastPages": "8", "longPollingEnable": "false", "brokerPermission": "4"}
+		if i%2 == 1 {
+			values = map[string]string{"deleteWhen": "4", "flushCommitLogLeastPages": "4", "longPollingEnable": "true", "brokerPermission": "6"}
+		}
+		if _, err := registry.Update(values); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	if storeConfig.GetDeleteWhen() != "04" || storeConfig.GetFlushCommitLogLeastPages() != 4 || !brokerConfig.GetLongPollingEnable() {
+		t.Errorf("unexpected config after update, deleteWhen %s flushCommitLogLeastPages %d longPollingEnable %t",
+			storeConfig.GetDeleteWhen(), storeConfig.GetFlushCommitLogLeastPages(), brokerConfig.GetLongPollingEnable())
+	}
+}
@@ -5,11 +5,14 @@ import (
 	"fmt"
 	"git.oschina.net/cloudzone/smartgo/stgbroker/client"
 	"git.oschina.net/cloudzone/smartgo/stgbroker/client/rebalance"
+	"git.oschina.net/cloudzone/smartgo/stgbroker/dynconfig"
 	"git.oschina.net/cloudzone/smartgo/stgbroker/mqtrace"
 	"git.oschina.net/cloudzone/smartgo/stgbroker/out"
 	"git.oschina.net/cloudzone/smartgo/stgbroker/stats"
 	"git.oschina.net/cloudzone/smartgo/stgcommon"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/acl"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/metrics"
 	code "git.oschina.net/cloudzone/smartgo/stgcommon/protocol"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/static"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/utils"
@@ -17,9 +20,11 @@ import (
 	"git.oschina.net/cloudzone/smartgo/stgstorelog"
 	"git.oschina.net/cloudzone/smartgo/stgstorelog/config"
 	storeStats "git.oschina.net/cloudzone/smartgo/stgstorelog/stats"
+	"io/ioutil"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
 )
 
@@ -50,12 +55,27 @@ type BrokerController struct {
 	UpdateMasterHAServerAddrPeriodically bool
 	brokerStats                          *storeStats.BrokerStats
 	FilterServerManager                  *FilterServerManager
+	ConsumerFilterManager                *ConsumerFilterManager
 	brokerStatsManager                   *stats.BrokerStatsManager
 	StoreHost                            string
 	ConfigFile                           string
 	sendMessageHookList                  []mqtrace.SendMessageHook
 	consumeMessageHookList               []mqtrace.ConsumeMessageHook
 	brokerControllerTask                 *BrokerControllerTask
+	sendMessageExecutor                  *remoting.RequestExecutor // 发送消息请求处理协程池
+	pullMessageExecutor                  *remoting.RequestExecutor // 拉取消息请求处理协程池
+	adminBrokerExecutor                  *remoting.RequestExecutor // 管理、查询消息请求处理协程池
+	clientManageExecutor                 *remoting.RequestExecutor // 客户端管理请求处理协程池
+	brokerFastFailure                    *BrokerFastFailure
+	accessValidator                      *acl.PlainAccessValidator // ACL校验，未开启ACL时为nil
+	QuotaManager                         *QuotaManager             // 发送/拉取限流配额
+	MetricsServer                        *metrics.Server           // Prometheus /metrics接口，未配置metricsPort时为nil
+	ConsumerLagService                   *ConsumerLagService       // 定时计算消费延迟
+	PopReviveService                     *PopReviveService         // POP消费超时未Ack的消息投递到重试队列
+	TimerMessageService                  *TimerMessageService      // 按订阅组重试策略延迟投递重试消息
+	ConfigRegistry                       *dynconfig.Registry       // BrokerConfig、MessageStoreConfig配置注册表
+	configWatcher                        *dynconfig.FileWatcher    // broker toml修改后重新加载配置
+	configFileLock                       sync.Mutex                // 写broker toml
 }
 
 // NewBrokerController 初始化broker服务控制器
@@ -66,6 +86,8 @@ func NewBrokerController(brokerConfig *stgcommon.BrokerConfig, messageStoreConfi
 	controller.BrokerConfig = brokerConfig
 	controller.MessageStoreConfig = messageStoreConfig
 	controller.ConfigDataVersion = stgcommon.NewDataVersion()
+	controller.ConfigRegistry = NewBrokerConfigRegistry(brokerConfig, messageStoreConfig)
+	controller.ConfigRegistry.AddListener(controller.onConfigApplied)
 	controller.ConsumerOffsetManager = NewConsumerOffsetManager(controller)
 	controller.UpdateMasterHAServerAddrPeriodically = false
 	controller.TopicConfigManager = NewTopicConfigManager(controller)
@@ -79,14 +101,20 @@ func NewBrokerController(brokerConfig *stgcommon.BrokerConfig, messageStoreConfi
 	controller.ClientHousekeepingService = NewClientHousekeepingService(controller)
 	controller.Broker2Client = NewBroker2Clientr(controller)
 	controller.SubscriptionGroupManager = NewSubscriptionGroupManager(controller)
+	controller.QuotaManager = NewQuotaManager(controller)
 	controller.RemotingClient = remotingClient
 	controller.BrokerOuterAPI = out.NewBrokerOuterAPI(remotingClient)
 	controller.FilterServerManager = NewFilterServerManager(controller)
+	controller.ConsumerFilterManager = NewConsumerFilterManager()
 	controller.brokerControllerTask = NewBrokerControllerTask(controller)
-
-	if strings.TrimSpace(controller.BrokerConfig.NamesrvAddr) != "" {
-		controller.BrokerOuterAPI.UpdateNameServerAddressList(strings.TrimSpace(controller.BrokerConfig.NamesrvAddr))
-		logger.Infof("user specfied name server address: %s", controller.BrokerConfig.NamesrvAddr)
+	controller.brokerFastFailure = NewBrokerFastFailure(controller)
+	controller.ConsumerLagService = NewConsumerLagService(controller)
+	controller.PopReviveService = NewPopReviveService(controller)
+	controller.TimerMessageService = NewTimerMessageService(controller)
+
+	if strings.TrimSpace(controller.BrokerConfig.GetNamesrvAddr()) != "" {
+		controller.BrokerOuterAPI.UpdateNameServerAddressList(strings.TrimSpace(controller.BrokerConfig.GetNamesrvAddr()))
+		logger.Infof("user specfied name server address: %s", controller.BrokerConfig.GetNamesrvAddr())
 	}
 
 	controller.SlaveSynchronize = NewSlaveSynchronize(controller)
@@ -106,6 +134,8 @@ func (self *BrokerController) Initialize() bool {
 	result = result && self.TopicConfigManager.Load()
 	result = result && self.ConsumerOffsetManager.Load()
 	result = result && self.SubscriptionGroupManager.Load()
+	result = result && self.QuotaManager.Load()
+	result = result && self.TimerMessageService.Load()
 
 	brokerPort := static.BROKER_PORT
 	if self.BrokerConfig.BrokerPort > 0 {
@@ -118,6 +148,10 @@ func (self *BrokerController) Initialize() bool {
 
 	if self.RemotingServer == nil {
 		self.RemotingServer = remoting.NewDefalutRemotingServer(brokerIp, brokerPort)
+		if err := self.RemotingServer.SetTlsConfig(self.BrokerConfig.TlsConfig); err != nil {
+			logger.Errorf("broker remoting server tls config invalid: %s", err.Error())
+			result = false
+		}
 	}
 
 	self.MessageStoreConfig.HaListenPort = self.RemotingServer.Port() + 1 // broker监听Slave请求端口，默认为Master服务端口+1
@@ -125,9 +159,12 @@ func (self *BrokerController) Initialize() bool {
 
 	if result {
 		self.MessageStore = stgstorelog.NewDefaultMessageStore(self.MessageStoreConfig, self.brokerStatsManager)
+		self.MessageStore.TopicConfigFinder = self.TopicConfigManager
+		self.MessageStore.ConsumerFilterFinder = self.ConsumerFilterManager
 	}
 
 	result = result && self.MessageStore.Load()
+	result = result && self.initialAcl()
 	if !result {
 		fmt.Println("the broker controller initialize failed")
 		self.Shutdown()
@@ -140,12 +177,44 @@ func (self *BrokerController) Initialize() bool {
 	self.brokerControllerTask.startBrokerStatsRecordTask()     // 定时统计broker各类信息
 	self.brokerControllerTask.startPersistConsumerOffsetTask() // 定时写入ConsumerOffset文件
 	self.brokerControllerTask.startScanUnSubscribedTopicTask() // 扫描被删除的Topic，并删除该Topic对应的offset
+	self.brokerControllerTask.startCleanConsumerFilterTask()   // 清除长时间没有更新的订阅组过滤条件
 	self.updateNameServerAddr()                                // 更新namesrv地址
 	self.synchronizeMaster2Slave()                             // 定时主从同步
+	self.initialMetrics()                                      // 配置metricsPort时开启/metrics接口
 
 	return result
 }
 
+// initialMetrics 配置metricsPort时创建/metrics接口，输出broker及remoting请求耗时指标
+// Since 2018/1/30
+func (self *BrokerController) initialMetrics() {
+	if self.BrokerConfig.MetricsPort <= 0 {
+		return
+	}
+
+	addr := fmt.Sprintf(":%d", self.BrokerConfig.MetricsPort)
+	self.MetricsServer = metrics.NewServer(addr, NewBrokerMetricsCollector(self), self.RemotingServer)
+}
+
+// initialAcl 开启ACL时加载plain_acl.toml，并注册服务端校验hook
+// Since 2018/1/26
+func (self *BrokerController) initialAcl() bool {
+	if !self.BrokerConfig.AclEnable {
+		return true
+	}
+
+	validator, err := acl.NewPlainAccessValidator(self.BrokerConfig.AclConfigPath)
+	if err != nil {
+		logger.Errorf("initial acl failed: %s", err.Error())
+		return false
+	}
+
+	self.accessValidator = validator
+	self.RemotingServer.RegisterRPCHook(validator)
+	logger.Infof("acl enable, config path: %s", self.BrokerConfig.AclConfigPath)
+	return true
+}
+
 // SynchronizeMaster2Slave 定时主从同步
 // Author: tianyuliang, <tianyuliang@gome.com.cn>
 // Since: 2017/10/10
@@ -168,8 +237,8 @@ func (self *BrokerController) synchronizeMaster2Slave() {
 // Author: tianyuliang, <tianyuliang@gome.com.cn>
 // Since: 2017/10/10
 func (self *BrokerController) updateNameServerAddr() {
-	if self.BrokerConfig.NamesrvAddr != "" {
-		self.BrokerOuterAPI.UpdateNameServerAddressList(self.BrokerConfig.NamesrvAddr)
+	if self.BrokerConfig.GetNamesrvAddr() != "" {
+		self.BrokerOuterAPI.UpdateNameServerAddressList(self.BrokerConfig.GetNamesrvAddr())
 		return
 	}
 	if self.BrokerConfig.FetchNamesrvAddrByAddressServer {
@@ -229,14 +298,45 @@ func (self *BrokerController) Shutdown() {
 		logger.Info("RemotingServer shutdown successful")
 	}
 
+	if self.MetricsServer != nil {
+		self.MetricsServer.Shutdown()
+	}
+
+	if self.brokerFastFailure != nil {
+		self.brokerFastFailure.Shutdown()
+	}
+
+	if self.ConsumerLagService != nil {
+		self.ConsumerLagService.Shutdown()
+	}
+
+	if self.PopReviveService != nil {
+		self.PopReviveService.Shutdown()
+	}
+
+	if self.TimerMessageService != nil {
+		self.TimerMessageService.Shutdown()
+	}
+
+	if self.configWatcher != nil {
+		self.configWatcher.Shutdown()
+	}
+	self.shutdownExecutors()
+
+	if self.accessValidator != nil {
+		self.accessValidator.Shutdown()
+	}
+
 	if self.MessageStore != nil {
 		self.MessageStore.Shutdown()
 		logger.Info("MessageStore shutdown successful")
 	}
 
 	self.ConsumerOffsetManager.configManagerExt.Persist()
+	self.TimerMessageService.Persist()
 	self.TopicConfigManager.ConfigManagerExt.Persist()
 	self.SubscriptionGroupManager.ConfigManagerExt.Persist()
+	self.QuotaManager.ConfigManagerExt.Persist()
 
 	if self.brokerStatsManager != nil {
 		self.brokerStatsManager.Shutdown()
@@ -259,7 +359,9 @@ func (self *BrokerController) Shutdown() {
 // Since 2017/9/12
 func (self *BrokerController) Start() {
 	if self.MessageStore != nil {
-		self.MessageStore.Start()
+		if err := self.MessageStore.Start(); err != nil {
+			logger.Errorf("start message store failed: %s", err.Error())
+		}
 	}
 
 	if self.BrokerOuterAPI != nil {
@@ -291,6 +393,34 @@ func (self *BrokerController) Start() {
 		self.brokerStatsManager.Start()
 	}
 
+	if self.brokerFastFailure != nil {
+		self.brokerFastFailure.Start()
+	}
+
+	if self.ConsumerLagService != nil {
+		self.ConsumerLagService.Start()
+	}
+
+	if self.PopReviveService != nil {
+		self.PopReviveService.Start()
+	}
+
+	if self.TimerMessageService != nil {
+		self.TimerMessageService.Start()
+	}
+
+	self.startConfigWatcher()
+
+	if self.accessValidator != nil {
+		self.accessValidator.Start()
+	}
+
+	if self.MetricsServer != nil {
+		if err := self.MetricsServer.Start(); err != nil {
+			logger.Errorf("metrics server start failed, metricsPort: %d, err: %s", self.BrokerConfig.MetricsPort, err.Error())
+		}
+	}
+
 	self.RegisterBrokerAll(true, false)
 	self.brokerControllerTask.startRegisterAllBrokerTask() // 每个Broker会每隔30s向NameSrv更新自身topic信息
 	self.brokerControllerTask.startDeleteTopicTask()
@@ -314,7 +444,7 @@ func (self *BrokerController) RegisterBrokerAll(checkOrderConfig bool, oneway bo
 	//logger.Infof("register all broker star, checkOrderConfig=%t, oneWay=%t", checkOrderConfig, oneway)
 	if !self.BrokerConfig.HasWriteable() || !self.BrokerConfig.HasReadable() {
 		self.TopicConfigManager.TopicConfigSerializeWrapper.TopicConfigTable.ForeachUpdate(func(topic string, topicConfig *stgcommon.TopicConfig) {
-			topicConfig.Perm = self.BrokerConfig.BrokerPermission
+			topicConfig.Perm = self.BrokerConfig.GetBrokerPermission()
 		})
 	}
 
@@ -343,36 +473,46 @@ func (self *BrokerController) RegisterBrokerAll(checkOrderConfig bool, oneway bo
 	//logger.Info("register all broker end")
 }
 
-// UpdateAllConfig 更新所有文件
+// UpdateAllConfig 按配置注册表校验并更新配置，properties为key -> value的json（兼容完整的BrokerAllConfig），
+// 热更新的配置项立即生效，其余配置项重启后生效，变更的配置项写回broker toml
 // Author rongzhihong
 // Since 2017/9/12
-func (self *BrokerController) UpdateAllConfig(properties []byte) {
-	defer utils.RecoveredFn()
-
-	allConfig := NewBrokerAllConfig()
-	err := stgcommon.Decode(properties, allConfig)
+func (self *BrokerController) UpdateAllConfig(properties []byte) (*dynconfig.UpdateResult, error) {
+	values, err := decodeBrokerConfigUpdate(self.ConfigRegistry, properties)
 	if err != nil {
-		logger.Errorf("UpdateAllConfig[%s] err: %s", string(properties), err.Error())
-		return
+		return nil, fmt.Errorf("decode broker config failed, %s", err.Error())
 	}
-
-	self.BrokerConfig = allConfig.BrokerConfig
-	self.MessageStoreConfig = allConfig.MessageStoreConfig
-
-	self.ConfigDataVersion.NextVersion()
-	self.flushAllConfig()
+	return self.updateConfig(values)
 }
 
-// flushAllConfig 将配置信息刷入文件中
+// flushAllConfig 将变更的配置项写回broker toml，保留文件中的其余内容及注释
 // Author rongzhihong
 // Since 2017/9/12
-func (self *BrokerController) flushAllConfig() {
+func (self *BrokerController) flushAllConfig(keys []string) {
 	defer utils.RecoveredFn()
 
-	allConfig := self.EncodeAllConfig()
-	logger.Infof("all config: %T", allConfig)
-	// TODO 当前配置信息是直接初始化的，所以暂时不写到文件中
-	//stgcommon.String2File([]byte(allConfig), self.ConfigFile)
+	if !isRegularFile(self.ConfigFile) {
+		return
+	}
+
+	values := make(map[string]string, len(keys))
+	for _, key := range keys {
+		if value, ok := self.ConfigRegistry.TomlValue(key); ok {
+			values[key] = value
+		}
+	}
+
+	self.configFileLock.Lock()
+	defer self.configFileLock.Unlock()
+	content, err := ioutil.ReadFile(self.ConfigFile)
+	if err != nil {
+		logger.Errorf("flush broker config, read %s failed: %s", self.ConfigFile, err.Error())
+		return
+	}
+	if err = dynconfig.WriteFileAtomic(self.ConfigFile, []byte(dynconfig.RewriteToml(string(content), values))); err != nil {
+		logger.Errorf("flush broker config, write %s failed: %s", self.ConfigFile, err.Error())
+		return
+	}
 	logger.Infof("flush broker config, %s OK", self.ConfigFile)
 }
 
@@ -382,7 +522,13 @@ func (self *BrokerController) flushAllConfig() {
 func (self *BrokerController) EncodeAllConfig() string {
 	buf := bytes.NewBuffer([]byte{})
 	allConfig := NewDefaultBrokerAllConfig(self.BrokerConfig, self.MessageStoreConfig)
+
+	// 编码期间配置项可能被热更新
+	self.BrokerConfig.RLock()
+	self.MessageStoreConfig.RLock()
 	content := stgcommon.Encode(allConfig)
+	self.MessageStoreConfig.RUnlock()
+	self.BrokerConfig.RUnlock()
 	buf.Write(content)
 	return buf.String()
 }
@@ -394,38 +540,79 @@ func (self *BrokerController) registerProcessor() {
 	// http://blog.csdn.net/meilong_whpu/article/details/76922647
 	// http://blog.csdn.net/a417930422/article/details/50700276
 
+	// 发送、拉取、管理、客户端管理请求使用各自的协程池，避免拉取请求过多时影响发送消息
+	self.startExecutors()
+
 	// 客户端管理事件处理器 ClientManageProcessor
 	clientProcessor := NewClientManageProcessor(self)
-	self.RemotingServer.RegisterProcessor(code.HEART_BEAT, clientProcessor)                 // 心跳连接
-	self.RemotingServer.RegisterProcessor(code.UNREGISTER_CLIENT, clientProcessor)          // 注销client
-	self.RemotingServer.RegisterProcessor(code.GET_CONSUMER_LIST_BY_GROUP, clientProcessor) // 获取Consumer列表
-	self.RemotingServer.RegisterProcessor(code.QUERY_CONSUMER_OFFSET, clientProcessor)      // 查询ConsumerOffset
-	self.RemotingServer.RegisterProcessor(code.UPDATE_CONSUMER_OFFSET, clientProcessor)     // 更新ConsumerOffset
+	clientExecutor := self.clientManageExecutor
+	self.RemotingServer.RegisterProcessor(code.HEART_BEAT, clientProcessor, clientExecutor)                 // 心跳连接
+	self.RemotingServer.RegisterProcessor(code.UNREGISTER_CLIENT, clientProcessor, clientExecutor)          // 注销client
+	self.RemotingServer.RegisterProcessor(code.GET_CONSUMER_LIST_BY_GROUP, clientProcessor, clientExecutor) // 获取Consumer列表
+	self.RemotingServer.RegisterProcessor(code.QUERY_CONSUMER_OFFSET, clientProcessor, clientExecutor)      // 查询ConsumerOffset
+	self.RemotingServer.RegisterProcessor(code.UPDATE_CONSUMER_OFFSET, clientProcessor, clientExecutor)     // 更新ConsumerOffset
 
 	// 发送消息事件处理器 SendMessageProcessor
 	sendMessageProcessor := NewSendMessageProcessor(self)
-	sendMessageProcessor.RegisterSendMessageHook(self.sendMessageHookList)                   // 发送消息回调
-	self.RemotingServer.RegisterProcessor(code.SEND_MESSAGE, sendMessageProcessor)           // 未优化过发送消息
-	self.RemotingServer.RegisterProcessor(code.SEND_MESSAGE_V2, sendMessageProcessor)        // 优化过发送消息
-	self.RemotingServer.RegisterProcessor(code.CONSUMER_SEND_MSG_BACK, sendMessageProcessor) // 消费失败消息
+	sendExecutor := self.sendMessageExecutor
+	sendMessageProcessor.RegisterSendMessageHook(self.sendMessageHookList)                                 // 发送消息回调
+	self.RemotingServer.RegisterProcessor(code.SEND_MESSAGE, sendMessageProcessor, sendExecutor)           // 未优化过发送消息
+	self.RemotingServer.RegisterProcessor(code.SEND_MESSAGE_V2, sendMessageProcessor, sendExecutor)        // 优化过发送消息
+	self.RemotingServer.RegisterProcessor(code.CONSUMER_SEND_MSG_BACK, sendMessageProcessor, sendExecutor) // 消费失败消息
 
 	// 拉取消息事件处理器 PullMessageProcessor
 	pullMessageProcessor := NewPullMessageProcessor(self)
-	self.RemotingServer.RegisterProcessor(code.PULL_MESSAGE, pullMessageProcessor) // Broker拉取消息
-	pullMessageProcessor.RegisterConsumeMessageHook(self.consumeMessageHookList)   // 消费消息回调
+	self.RemotingServer.RegisterProcessor(code.PULL_MESSAGE, pullMessageProcessor, self.pullMessageExecutor) // Broker拉取消息
+	pullMessageProcessor.RegisterConsumeMessageHook(self.consumeMessageHookList)                             // 消费消息回调
+
+	// POP消费事件处理器 PopMessageProcessor
+	popMessageProcessor := NewPopMessageProcessor(self)
+	self.RemotingServer.RegisterProcessor(code.POP_MESSAGE, popMessageProcessor, self.pullMessageExecutor)           // POP方式拉取消息
+	self.RemotingServer.RegisterProcessor(code.ACK_MESSAGE, popMessageProcessor, self.pullMessageExecutor)           // 确认POP拉取的消息
+	self.RemotingServer.RegisterProcessor(code.CHANGE_INVISIBLE_TIME, popMessageProcessor, self.pullMessageExecutor) // 修改消息不可见时间
 
 	// 查询消息事件处理器 QueryMessageProcessor
 	queryProcessor := NewQueryMessageProcessor(self)
-	self.RemotingServer.RegisterProcessor(code.QUERY_MESSAGE, queryProcessor)      // Broker 查询消息
-	self.RemotingServer.RegisterProcessor(code.VIEW_MESSAGE_BY_ID, queryProcessor) // Broker 根据消息ID来查询消息
+	self.RemotingServer.RegisterProcessor(code.QUERY_MESSAGE, queryProcessor, self.adminBrokerExecutor)      // Broker 查询消息
+	self.RemotingServer.RegisterProcessor(code.VIEW_MESSAGE_BY_ID, queryProcessor, self.adminBrokerExecutor) // Broker 根据消息ID来查询消息
 
 	// 结束事务处理器 EndTransactionProcessor
 	endTransactionProcessor := NewEndTransactionProcessor(self)
-	self.RemotingServer.RegisterProcessor(code.END_TRANSACTION, endTransactionProcessor) // Broker Commit或者Rollback事务
+	self.RemotingServer.RegisterProcessor(code.END_TRANSACTION, endTransactionProcessor, sendExecutor) // Broker Commit或者Rollback事务
 
 	// 默认事件处理器 DefaultProcessor
 	adminProcessor := NewAdminBrokerProcessor(self)
-	self.RemotingServer.RegisterDefaultProcessor(adminProcessor) // 默认Admin请求
+	self.RemotingServer.RegisterDefaultProcessor(adminProcessor, self.adminBrokerExecutor) // 默认Admin请求
+}
+
+// startExecutors 创建并启动各类请求的处理协程池
+// Since 2018/1/25
+func (self *BrokerController) startExecutors() {
+	cfg := self.BrokerConfig
+	self.sendMessageExecutor = remoting.NewRequestExecutor("SendMessageExecutor",
+		cfg.SendMessageThreadPoolNums, cfg.SendThreadPoolQueueCapacity, cfg.GetWaitTimeMillsInSendQueue())
+	self.pullMessageExecutor = remoting.NewRequestExecutor("PullMessageExecutor",
+		cfg.PullMessageThreadPoolNums, cfg.PullThreadPoolQueueCapacity, cfg.GetWaitTimeMillsInPullQueue())
+	self.adminBrokerExecutor = remoting.NewRequestExecutor("AdminBrokerExecutor",
+		cfg.AdminBrokerThreadPoolNums, cfg.AdminThreadPoolQueueCapacity, 0)
+	self.clientManageExecutor = remoting.NewRequestExecutor("ClientManageExecutor",
+		cfg.ClientManageThreadPoolNums, cfg.ClientThreadPoolQueueCapacity, 0)
+
+	self.sendMessageExecutor.Start()
+	self.pullMessageExecutor.Start()
+	self.adminBrokerExecutor.Start()
+	self.clientManageExecutor.Start()
+}
+
+// shutdownExecutors 停止各类请求的处理协程池
+// Since 2018/1/25
+func (self *BrokerController) shutdownExecutors() {
+	for _, executor := range []*remoting.RequestExecutor{self.sendMessageExecutor, self.pullMessageExecutor,
+		self.adminBrokerExecutor, self.clientManageExecutor} {
+		if executor != nil {
+			executor.Shutdown()
+		}
+	}
 }
 
 // getConfigDataVersion 获得数据配置版本号
@@ -443,6 +630,12 @@ func (self *BrokerController) RegisterSendMessageHook(hook mqtrace.SendMessageHo
 	logger.Infof("register SendMessageHook Hook, %s", hook.HookName())
 }
 
+// RegisterConsumerLagAlertHook 注册消费延迟超过阈值时的告警回调
+// Since 2018/1/31
+func (self *BrokerController) RegisterConsumerLagAlertHook(hook ConsumerLagAlertHook) {
+	self.ConsumerLagService.RegisterAlertHook(hook)
+}
+
 // RegisterSendMessageHook 注册消费消息的回调
 // Author rongzhihong
 // Since 2017/9/11
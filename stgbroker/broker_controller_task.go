@@ -20,6 +20,7 @@ type BrokerControllerTask struct {
 	SlaveSynchronizeTask        *timeutil.Ticker
 	PrintMasterAndSlaveDiffTask *timeutil.Ticker
 	RegisterAllBrokerTask       *timeutil.Ticker
+	CleanConsumerFilterTask     *timeutil.Ticker
 }
 
 func NewBrokerControllerTask(controller *BrokerController) *BrokerControllerTask {
@@ -66,6 +67,10 @@ func (self *BrokerControllerTask) Shutdown() bool {
 		self.RegisterAllBrokerTask.Stop()
 		logger.Info("RegisterAllBrokerTask stop ok")
 	}
+	if self.CleanConsumerFilterTask != nil {
+		self.CleanConsumerFilterTask.Stop()
+		logger.Info("CleanConsumerFilterTask stop ok")
+	}
 	return true
 }
 
@@ -104,9 +109,10 @@ func (self *BrokerControllerTask) startBrokerStatsRecordTask() {
 // Author: tianyuliang
 // Since: 2017/10/10
 func (self *BrokerControllerTask) startPersistConsumerOffsetTask() {
-	period := time.Duration(self.BrokerController.BrokerConfig.FlushConsumerOffsetInterval) * time.Millisecond
+	period := time.Duration(self.BrokerController.BrokerConfig.GetFlushConsumerOffsetInterval()) * time.Millisecond
 	self.PersistConsumerOffsetTask = timeutil.NewTicker(false, 10*time.Second, period, func() {
 		self.BrokerController.ConsumerOffsetManager.configManagerExt.Persist()
+		self.BrokerController.TimerMessageService.Persist()
 	})
 	self.PersistConsumerOffsetTask.Start()
 	logger.Infof("PersistConsumerOffsetTask start ok")
@@ -123,6 +129,16 @@ func (self *BrokerControllerTask) startScanUnSubscribedTopicTask() {
 	logger.Infof("ScanUnSubscribedTopicTask start ok")
 }
 
+// startCleanConsumerFilterTask 清除长时间没有心跳更新的订阅组过滤条件
+// Since: 2018/1/17
+func (self *BrokerControllerTask) startCleanConsumerFilterTask() {
+	self.CleanConsumerFilterTask = timeutil.NewTicker(false, 10*time.Minute, 1*time.Hour, func() {
+		self.BrokerController.ConsumerFilterManager.CleanExpiredFilter()
+	})
+	self.CleanConsumerFilterTask.Start()
+	logger.Infof("CleanConsumerFilterTask start ok")
+}
+
 // startFetchNameServerAddrTask 更新Namesrv地址列表
 // Author: tianyuliang
 // Since: 2017/10/10
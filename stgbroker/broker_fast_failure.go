@@ -0,0 +1,72 @@
+package stgbroker
+
+import (
+	"time"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/utils/timeutil"
+)
+
+const (
+	OS_PAGECACHE_BUSY_REMARK = "[PC_SYNCHRONIZED]broker busy, start flow control for a while"
+	fastFailureInterval      = 10 // 清理排队请求的间隔（单位毫秒）
+)
+
+// BrokerFastFailure 快速失败：PageCache繁忙时拒绝发送队列中的请求，并清理在队列中等待过久的发送、拉取请求
+// 请求被拒绝后返回SYSTEM_BUSY，生产者更换broker重试
+// Since 2018/1/25
+type BrokerFastFailure struct {
+	brokerController *BrokerController
+	ticker           *timeutil.Ticker
+}
+
+// NewBrokerFastFailure 初始化
+// Since 2018/1/25
+func NewBrokerFastFailure(brokerController *BrokerController) *BrokerFastFailure {
+	fastFailure := &BrokerFastFailure{brokerController: brokerController}
+	fastFailure.ticker = timeutil.NewTicker(false, 1000*time.Millisecond, fastFailureInterval*time.Millisecond, func() {
+		fastFailure.cleanExpiredRequest()
+	})
+	return fastFailure
+}
+
+// Start 启动
+// Since 2018/1/25
+func (self *BrokerFastFailure) Start() {
+	self.ticker.Start()
+}
+
+// Shutdown 停止
+// Since 2018/1/25
+func (self *BrokerFastFailure) Shutdown() {
+	self.ticker.Stop()
+}
+
+func (self *BrokerFastFailure) cleanExpiredRequest() {
+	sendExecutor := self.brokerController.sendMessageExecutor
+	pullExecutor := self.brokerController.pullMessageExecutor
+	if sendExecutor == nil || pullExecutor == nil {
+		return
+	}
+
+	// PageCache繁忙时，发送队列中的请求继续排队只会超时，直接拒绝
+	rejectNums := 0
+	for self.brokerController.MessageStore.IsOSPageCacheBusy() && sendExecutor.RejectOldestRequest() {
+		rejectNums++
+	}
+	if rejectNums > 0 {
+		logger.Warnf("os page cache busy, reject send requests: %d", rejectNums)
+	}
+
+	cfg := self.brokerController.BrokerConfig
+	if cfg.GetWaitTimeMillsInSendQueue() > 0 {
+		if cleanNums := sendExecutor.CleanExpiredRequest(cfg.GetWaitTimeMillsInSendQueue()); cleanNums > 0 {
+			logger.Warnf("clean expired send requests: %d", cleanNums)
+		}
+	}
+	if cfg.GetWaitTimeMillsInPullQueue() > 0 {
+		if cleanNums := pullExecutor.CleanExpiredRequest(cfg.GetWaitTimeMillsInPullQueue()); cleanNums > 0 {
+			logger.Warnf("clean expired pull requests: %d", cleanNums)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package stgbroker
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"git.oschina.net/cloudzone/smartgo/stgbroker/stats"
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/metrics"
+	commonStats "git.oschina.net/cloudzone/smartgo/stgcommon/stats"
+	"git.oschina.net/cloudzone/smartgo/stgstorelog/config"
+)
+
+// BrokerMetricsCollector 抓取/metrics时输出broker指标，指标名称及标签保持稳定
+// Since 2018/1/30
+type BrokerMetricsCollector struct {
+	BrokerController *BrokerController
+}
+
+// NewBrokerMetricsCollector 创建BrokerMetricsCollector
+// Since 2018/1/30
+func NewBrokerMetricsCollector(brokerController *BrokerController) *BrokerMetricsCollector {
+	return &BrokerMetricsCollector{BrokerController: brokerController}
+}
+
+// Collect 实现metrics.Collector
+// Since 2018/1/30
+func (self *BrokerMetricsCollector) Collect(w *metrics.Writer) {
+	brokerConfig := self.BrokerController.BrokerConfig
+	w.Gauge("smartgo_broker_info", "Broker identity, value is always 1.", 1,
+		metrics.NewLabel("cluster", brokerConfig.BrokerClusterName),
+		metrics.NewLabel("broker", brokerConfig.BrokerName),
+		metrics.NewLabel("broker_id", strconv.FormatInt(brokerConfig.BrokerId, 10)))
+
+	self.collectStats(w)
+	self.collectConsumerLag(w)
+	self.collectConsumerLagSeconds(w)
+	self.collectStore(w)
+
+	if holdService := self.BrokerController.PullRequestHoldService; holdService != nil {
+		w.Gauge("smartgo_broker_long_polling_suspended_requests", "Pull requests currently suspended by long polling.",
+			float64(holdService.SuspendedCount()))
+	}
+	if reviveService := self.BrokerController.PopReviveService; reviveService != nil {
+		w.Gauge("smartgo_broker_pop_pending_checkpoints", "Pop checkpoints waiting for ack or revive.",
+			float64(reviveService.PendingCheckPoints()))
+	}
+	if timerService := self.BrokerController.TimerMessageService; timerService != nil {
+		w.Gauge("smartgo_broker_timer_pending_messages", "Retry messages waiting for their scheduled delivery time.",
+			float64(timerService.PendingMessages()))
+	}
+}
+
+// collectStats 输出BrokerStatsManager中的发送、拉取计数及最近一分钟TPS
+func (self *BrokerMetricsCollector) collectStats(w *metrics.Writer) {
+	statsManager := self.BrokerController.brokerStatsManager
+	if statsManager == nil {
+		return
+	}
+
+	statsManager.ForeachStatsItem(stats.TOPIC_PUT_NUMS, func(topic string, item *commonStats.StatsItem) {
+		label := metrics.NewLabel("topic", topic)
+		w.Counter("smartgo_broker_topic_put_messages_total", "Messages put into the topic.", loadValue(item), label)
+		w.Gauge("smartgo_broker_topic_put_tps", "Messages put into the topic per second in the last minute.",
+			item.GetStatsDataInMinute().Tps, label)
+	})
+	statsManager.ForeachStatsItem(stats.TOPIC_PUT_SIZE, func(topic string, item *commonStats.StatsItem) {
+		w.Counter("smartgo_broker_topic_put_bytes_total", "Message bytes put into the topic.", loadValue(item),
+			metrics.NewLabel("topic", topic))
+	})
+	statsManager.ForeachStatsItem(stats.GROUP_GET_NUMS, func(statsKey string, item *commonStats.StatsItem) {
+		labels := topicGroupLabels(statsKey)
+		w.Counter("smartgo_broker_group_get_messages_total", "Messages pulled by the consumer group.", loadValue(item), labels...)
+		w.Gauge("smartgo_broker_group_get_tps", "Messages pulled by the consumer group per second in the last minute.",
+			item.GetStatsDataInMinute().Tps, labels...)
+	})
+	statsManager.ForeachStatsItem(stats.GROUP_GET_SIZE, func(statsKey string, item *commonStats.StatsItem) {
+		w.Counter("smartgo_broker_group_get_bytes_total", "Message bytes pulled by the consumer group.", loadValue(item),
+			topicGroupLabels(statsKey)...)
+	})
+	statsManager.ForeachStatsItem(stats.SNDBCK_PUT_NUMS, func(statsKey string, item *commonStats.StatsItem) {
+		w.Counter("smartgo_broker_group_send_back_messages_total", "Messages sent back for retry by the consumer group.",
+			loadValue(item), topicGroupLabels(statsKey)...)
+	})
+	statsManager.ForeachStatsItem(stats.GROUP_GET_EXPIRED, func(statsKey string, item *commonStats.StatsItem) {
+		w.Counter("smartgo_broker_group_get_expired_messages_total", "Expired messages skipped when pulling.",
+			loadValue(item), topicGroupLabels(statsKey)...)
+	})
+	statsManager.ForeachStatsItem(stats.BROKER_PUT_NUMS, func(statsKey string, item *commonStats.StatsItem) {
+		w.Counter("smartgo_broker_put_messages_total", "Messages put into the broker.", loadValue(item))
+	})
+	statsManager.ForeachStatsItem(stats.BROKER_GET_NUMS, func(statsKey string, item *commonStats.StatsItem) {
+		w.Counter("smartgo_broker_get_messages_total", "Messages pulled from the broker.", loadValue(item))
+	})
+}
+
+// collectConsumerLag 按消费组、队列输出消费进度落后的消息数
+func (self *BrokerMetricsCollector) collectConsumerLag(w *metrics.Writer) {
+	messageStore := self.BrokerController.MessageStore
+	if messageStore == nil {
+		return
+	}
+
+	self.BrokerController.ConsumerOffsetManager.Offsets.Foreach(func(key string, offsetTable map[int]int64) {
+		index := strings.LastIndex(key, TOPIC_GROUP_SEPARATOR)
+		if index < 0 {
+			return
+		}
+		topic, group := key[:index], key[index+1:]
+
+		for queueId, consumerOffset := range offsetTable {
+			lag := messageStore.GetMaxOffsetInQueue(topic, int32(queueId)) - consumerOffset
+			if lag < 0 {
+				lag = 0
+			}
+			w.Gauge("smartgo_broker_consumer_lag_messages", "Messages between the queue max offset and the committed consumer offset.",
+				float64(lag),
+				metrics.NewLabel("group", group),
+				metrics.NewLabel("topic", topic),
+				metrics.NewLabel("queue_id", strconv.Itoa(queueId)))
+		}
+	})
+}
+
+// collectConsumerLagSeconds 按ConsumerLagService最近一次的计算结果输出消费延迟秒数
+func (self *BrokerMetricsCollector) collectConsumerLagSeconds(w *metrics.Writer) {
+	lagService := self.BrokerController.ConsumerLagService
+	if lagService == nil {
+		return
+	}
+
+	for _, lag := range lagService.GetConsumerLag("", "").LagList {
+		w.Gauge("smartgo_broker_consumer_lag_seconds", "Seconds since the store time of the next unconsumed message.",
+			lag.LagSeconds(),
+			metrics.NewLabel("group", lag.ConsumerGroup),
+			metrics.NewLabel("topic", lag.Topic),
+			metrics.NewLabel("queue_id", strconv.Itoa(lag.QueueId)))
+	}
+}
+
+// collectStore 输出磁盘使用率、CommitLog偏移量、各Topic写入耗时分布及主从复制落后字节数
+func (self *BrokerMetricsCollector) collectStore(w *metrics.Writer) {
+	messageStore := self.BrokerController.MessageStore
+	if messageStore == nil {
+		return
+	}
+
+	storeConfig := self.BrokerController.MessageStoreConfig
+	diskPaths := map[string]string{
+		"commitlog":    storeConfig.StorePathCommitLog,
+		"consumequeue": config.GetStorePathConsumeQueue(storeConfig.StorePathRootDir),
+	}
+	for _, store := range []string{"commitlog", "consumequeue"} {
+		if ratio := stgcommon.GetDiskPartitionSpaceUsedPercent(diskPaths[store]); ratio >= 0 {
+			w.Gauge("smartgo_broker_disk_used_ratio", "Used ratio of the disk partition holding the store files.", ratio,
+				metrics.NewLabel("store", store))
+		}
+	}
+
+	w.Gauge("smartgo_broker_commitlog_max_offset", "CommitLog max physical offset.", float64(messageStore.GetMaxPhyOffset()))
+	messageStore.StoreStatsService.ForeachPutLatency(func(topic string, snapshot *metrics.HistogramSnapshot) {
+		w.Histogram("smartgo_store_put_latency_seconds", "Store put message latency in seconds by topic.", snapshot,
+			metrics.NewLabel("topic", topic))
+	})
+	if storeConfig.BrokerRole != config.SLAVE {
+		w.Gauge("smartgo_broker_ha_slave_fall_behind_bytes", "Bytes the slave falls behind the master.",
+			float64(messageStore.SlaveFallBehindMuch()))
+	}
+}
+
+// topicGroupLabels 拆分统计key "topic@group"
+func topicGroupLabels(statsKey string) []metrics.Label {
+	topic, group := statsKey, ""
+	if index := strings.LastIndex(statsKey, "@"); index >= 0 {
+		topic, group = statsKey[:index], statsKey[index+1:]
+	}
+	return []metrics.Label{metrics.NewLabel("topic", topic), metrics.NewLabel("group", group)}
+}
+
+func loadValue(item *commonStats.StatsItem) float64 {
+	return float64(atomic.LoadInt64(&item.ValueCounter))
+}
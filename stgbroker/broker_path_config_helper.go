@@ -29,3 +29,15 @@ func GetConsumerOffsetPath(rootDir string) string {
 func GetSubscriptionGroupPath(rootDir string) string {
 	return rootDir + separator + configDir + separator + "subscriptionGroup.json"
 }
+
+// GetTimerCheckPointPath 获取timerCheckPoint.json路径
+// Since 2018/2/2
+func GetTimerCheckPointPath(rootDir string) string {
+	return rootDir + separator + configDir + separator + "timerCheckPoint.json"
+}
+
+// GetQuotaConfigPath 获取quota.json路径
+// Since 2018/1/29
+func GetQuotaConfigPath(rootDir string) string {
+	return rootDir + separator + configDir + separator + "quota.json"
+}
@@ -3,6 +3,7 @@ package stgbroker
 import (
 	"fmt"
 	"git.oschina.net/cloudzone/smartgo/stgcommon"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/acl"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/static"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/utils"
@@ -60,6 +61,10 @@ func CreateBrokerController(smartgoBrokerFilePath ...string) *BrokerController {
 
 	// 初始化brokerConfig，并校验broker启动的所必需的SmartGoHome、Namesrv配置
 	brokerConfig := stgcommon.NewCustomBrokerConfig(cfg)
+	if brokerConfig.AclEnable && brokerConfig.AclConfigPath == "" {
+		// 默认读取与broker配置文件同目录的plain_acl.toml
+		brokerConfig.AclConfigPath = filepath.Join(filepath.Dir(cfgPath), acl.PLAIN_ACL_FILE_NAME)
+	}
 	logger.Infof("broker.StorePathRootDir = %s", brokerConfig.StorePathRootDir)
 	logger.Infof("store.StorePathRootDir = %s", brokerConfig.StorePathRootDir)
 
@@ -78,6 +83,13 @@ func CreateBrokerController(smartgoBrokerFilePath ...string) *BrokerController {
 	// 初始化brokerConfig、messageStoreConfig
 	messageStoreConfig := stgstorelog.NewMessageStoreConfig()
 	messageStoreConfig.BrokerRole = brorkerRole
+
+	// toml中的其余配置项（刷盘间隔、各类阈值等）按配置注册表校验后覆盖默认值
+	if values, err := ReadBrokerConfigFile(cfgPath); err == nil {
+		for _, err := range NewBrokerConfigRegistry(brokerConfig, messageStoreConfig).Load(values) {
+			logger.Warnf("broker config ignored: %s", err.Error())
+		}
+	}
 	if !checkMessageStoreConfigAttr(messageStoreConfig, brokerConfig) {
 		logger.Flush()
 		os.Exit(0)
@@ -91,8 +103,13 @@ func CreateBrokerController(smartgoBrokerFilePath ...string) *BrokerController {
 
 	// 构建BrokerController结构体
 	remotingClient := remoting.NewDefalutRemotingClient()
+	if err := remotingClient.SetTlsConfig(brokerConfig.TlsConfig); err != nil {
+		logger.Errorf("broker tls config invalid: %s", err.Error())
+		logger.Flush()
+		os.Exit(0)
+	}
 	controller := NewBrokerController(brokerConfig, messageStoreConfig, remotingClient)
-	controller.ConfigFile = brokerConfig.StorePathRootDir
+	controller.ConfigFile = cfgPath
 
 	logger.Info("create broker controller successful")
 	return controller
@@ -206,6 +223,7 @@ func setMessageStoreConfig(messageStoreConfig *stgstorelog.MessageStoreConfig, b
 		messageStoreConfig.HaMasterAddress = brokerConfig.HaMasterAddress // HA功能配置此项
 
 	}
+	messageStoreConfig.TlsConfig = brokerConfig.TlsConfig // HA连接与remoting使用相同的TLS配置
 
 	// 如果是slave，修改默认值（修改命中消息在内存的最大比例40为30【40-10】）
 	if messageStoreConfig.BrokerRole == config.SLAVE {
@@ -76,6 +76,7 @@ func (cmp *ClientManageProcessor) heartBeat(ctx netm.Context, request *protocol.
 
 		changed := cmp.BrokerController.ConsumerManager.RegisterConsumer(consumerData.GroupName, channelInfo,
 			consumerData.ConsumeType, consumerData.MessageModel, consumerData.ConsumeFromWhere, consumerData.SubscriptionDataSet)
+		cmp.BrokerController.ConsumerFilterManager.Register(consumerData.GroupName, consumerData.SubscriptionDataSet)
 		if changed {
 			logger.Infof("registerConsumer info changed: RemoteAddr:%s, consumerData:%v", ctx.RemoteAddr().String(), consumerData.ToString())
 		}
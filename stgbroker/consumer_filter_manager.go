@@ -0,0 +1,131 @@
+package stgbroker
+
+import (
+	"sync"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/heartbeat"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/utils/timeutil"
+	"git.oschina.net/cloudzone/smartgo/stgstorelog"
+	set "github.com/deckarep/golang-set"
+)
+
+const (
+	consumerFilterExpiredTime = 1000 * 60 * 60 * 24 // 订阅组过滤条件超过该时间未更新则删除（单位毫秒）
+)
+
+// ConsumerFilterManager 维护订阅组的过滤条件，存储层据此构建消费队列扩展单元的过滤位图
+// Since 2018/1/17
+type ConsumerFilterManager struct {
+	filterTable map[string]map[string]*consumerFilterWrapper // key:topic, value:(key:group)
+	mu          *sync.RWMutex
+}
+
+// consumerFilterWrapper 过滤条件及最近一次心跳更新时间
+// Since 2018/1/17
+type consumerFilterWrapper struct {
+	filterData     *stgstorelog.ConsumerFilterData
+	lastUpdateTime int64
+}
+
+// NewConsumerFilterManager 初始化ConsumerFilterManager
+// Since 2018/1/17
+func NewConsumerFilterManager() *ConsumerFilterManager {
+	return &ConsumerFilterManager{
+		filterTable: make(map[string]map[string]*consumerFilterWrapper),
+		mu:          new(sync.RWMutex),
+	}
+}
+
+// Register 根据心跳中的订阅关系更新订阅组过滤条件，过滤条件变化时重新记录生效时间
+// Since 2018/1/17
+func (self *ConsumerFilterManager) Register(group string, subList []heartbeat.SubscriptionDataPlus) {
+	now := timeutil.CurrentTimeMillis()
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	for _, sub := range subList {
+		groupTable, ok := self.filterTable[sub.Topic]
+		if !ok {
+			groupTable = make(map[string]*consumerFilterWrapper)
+			self.filterTable[sub.Topic] = groupTable
+		}
+
+		wrapper, ok := groupTable[group]
+		if ok && wrapper.filterData.SubString == sub.SubString && wrapper.filterData.ClassFilterMode == sub.ClassFilterMode {
+			wrapper.lastUpdateTime = now
+			continue
+		}
+
+		tagsSet := set.NewSet()
+		for _, tag := range sub.TagsSet {
+			tagsSet.Add(tag)
+		}
+
+		groupTable[group] = &consumerFilterWrapper{
+			filterData: &stgstorelog.ConsumerFilterData{
+				ConsumerGroup:   group,
+				Topic:           sub.Topic,
+				SubString:       sub.SubString,
+				TagsSet:         tagsSet,
+				ClassFilterMode: sub.ClassFilterMode,
+				BornTime:        now,
+			},
+			lastUpdateTime: now,
+		}
+		logger.Infof("consumer filter changed, group: %s topic: %s subString: %s", group, sub.Topic, sub.SubString)
+	}
+}
+
+// FindConsumerFilters 查询订阅Topic的全部订阅组过滤条件
+// Since 2018/1/17
+func (self *ConsumerFilterManager) FindConsumerFilters(topic string) []*stgstorelog.ConsumerFilterData {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	groupTable, ok := self.filterTable[topic]
+	if !ok {
+		return nil
+	}
+
+	filters := make([]*stgstorelog.ConsumerFilterData, 0, len(groupTable))
+	for _, wrapper := range groupTable {
+		filters = append(filters, wrapper.filterData)
+	}
+	return filters
+}
+
+// FindConsumerFilter 查询订阅组在Topic上的过滤条件
+// Since 2018/1/17
+func (self *ConsumerFilterManager) FindConsumerFilter(group, topic string) *stgstorelog.ConsumerFilterData {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	if wrapper, ok := self.filterTable[topic][group]; ok {
+		return wrapper.filterData
+	}
+	return nil
+}
+
+// CleanExpiredFilter 删除长时间没有心跳更新的过滤条件
+// Since 2018/1/17
+func (self *ConsumerFilterManager) CleanExpiredFilter() {
+	expiredTime := timeutil.CurrentTimeMillis() - consumerFilterExpiredTime
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	for topic, groupTable := range self.filterTable {
+		for group, wrapper := range groupTable {
+			if wrapper.lastUpdateTime < expiredTime {
+				delete(groupTable, group)
+				logger.Infof("remove expired consumer filter, group: %s topic: %s", group, topic)
+			}
+		}
+
+		if len(groupTable) == 0 {
+			delete(self.filterTable, topic)
+		}
+	}
+}
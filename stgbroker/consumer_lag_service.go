@@ -0,0 +1,226 @@
+package stgbroker
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/body"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/utils/timeutil"
+)
+
+const defaultConsumerLagCalcInterval = 30 * time.Second
+
+// ConsumerLagAlertHook 消费延迟超过阈值时的告警回调
+// Since 2018/1/31
+type ConsumerLagAlertHook interface {
+	HookName() string
+	DoAlert(lag *body.ConsumerLag)
+}
+
+// ConsumerLagService 定时按消费组、topic、队列计算消费延迟的消息数及时间，超过阈值时调用告警回调
+// 时间延迟为当前时间与下一条未消费消息存储时间的差值，即消费组落后的秒数
+// Since 2018/1/31
+type ConsumerLagService struct {
+	brokerController *BrokerController
+	ticker           *timeutil.Ticker
+	lagTable         *body.ConsumerLagTable // 最近一次计算结果
+	alertHookList    []ConsumerLagAlertHook
+	lock             sync.RWMutex
+}
+
+// NewConsumerLagService 初始化
+// Since 2018/1/31
+func NewConsumerLagService(brokerController *BrokerController) *ConsumerLagService {
+	service := &ConsumerLagService{
+		brokerController: brokerController,
+		lagTable:         body.NewConsumerLagTable(),
+	}
+
+	period := time.Duration(brokerController.BrokerConfig.GetConsumerLagCalcInterval()) * time.Millisecond
+	if period <= 0 {
+		period = defaultConsumerLagCalcInterval
+	}
+	service.ticker = timeutil.NewTicker(false, 10*time.Second, period, func() {
+		service.ComputeLag()
+	})
+	return service
+}
+
+// Start 启动
+// Since 2018/1/31
+func (self *ConsumerLagService) Start() {
+	self.ticker.Start()
+	logger.Info("ConsumerLagService start successful")
+}
+
+// Shutdown 停止
+// Since 2018/1/31
+func (self *ConsumerLagService) Shutdown() {
+	self.ticker.Stop()
+	logger.Info("ConsumerLagService shutdown successful")
+}
+
+// SetCalcInterval 修改计算间隔，下一次计算后生效
+// Since 2018/2/2
+func (self *ConsumerLagService) SetCalcInterval(interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultConsumerLagCalcInterval
+	}
+	self.ticker.SetPeriod(interval)
+}
+
+// RegisterAlertHook 注册告警回调
+// Since 2018/1/31
+func (self *ConsumerLagService) RegisterAlertHook(hook ConsumerLagAlertHook) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.alertHookList = append(self.alertHookList, hook)
+	logger.Infof("register ConsumerLagAlertHook, %s", hook.HookName())
+}
+
+// GetConsumerLag 查询最近一次计算的消费延迟，consumerGroup、topic为空时不过滤，尚未计算过时立即计算
+// Since 2018/1/31
+func (self *ConsumerLagService) GetConsumerLag(consumerGroup, topic string) *body.ConsumerLagTable {
+	self.lock.RLock()
+	lagTable := self.lagTable
+	self.lock.RUnlock()
+
+	if lagTable.ComputeTimestamp == 0 {
+		lagTable = self.ComputeLag()
+	}
+
+	result := body.NewConsumerLagTable()
+	result.ComputeTimestamp = lagTable.ComputeTimestamp
+	for _, lag := range lagTable.LagList {
+		if consumerGroup != "" && lag.ConsumerGroup != consumerGroup {
+			continue
+		}
+		if topic != "" && lag.Topic != topic {
+			continue
+		}
+		result.LagList = append(result.LagList, lag)
+	}
+	return result
+}
+
+// ComputeLag 按ConsumerOffsetManager中的消费进度计算全部消费组的消费延迟
+// Since 2018/1/31
+func (self *ConsumerLagService) ComputeLag() *body.ConsumerLagTable {
+	now := timeutil.CurrentTimeMillis()
+	lagTable := body.NewConsumerLagTable()
+	lagTable.ComputeTimestamp = now
+
+	// 先复制消费进度，避免查询存储时持有offset表的锁
+	offsets := make(map[string]map[int]int64)
+	self.brokerController.ConsumerOffsetManager.Offsets.Foreach(func(key string, offsetTable map[int]int64) {
+		queueOffsets := make(map[int]int64, len(offsetTable))
+		for queueId, offset := range offsetTable {
+			queueOffsets[queueId] = offset
+		}
+		offsets[key] = queueOffsets
+	})
+
+	messageStore := self.brokerController.MessageStore
+	brokerName := self.brokerController.BrokerConfig.BrokerName
+	for key, offsetTable := range offsets {
+		index := strings.LastIndex(key, TOPIC_GROUP_SEPARATOR)
+		if index < 0 {
+			continue
+		}
+		topic, group := key[:index], key[index+1:]
+		for queueId, consumerOffset := range offsetTable {
+			lag := computeQueueLag(messageStore, brokerName, group, topic, queueId, consumerOffset, now)
+			lagTable.LagList = append(lagTable.LagList, lag)
+		}
+	}
+
+	self.lock.Lock()
+	self.lagTable = lagTable
+	hookList := self.alertHookList
+	self.lock.Unlock()
+
+	self.alert(lagTable, hookList)
+	return lagTable
+}
+
+// queueOffsetStore 计算消费延迟用到的存储查询
+type queueOffsetStore interface {
+	GetMaxOffsetInQueue(topic string, queueId int32) int64
+	GetMinOffsetInQueue(topic string, queueId int32) int64
+	GetMessageStoreTimeStamp(topic string, queueId int32, offset int64) int64
+}
+
+// computeQueueLag 计算单个队列的消费延迟，消费进度超过队列最大offset时没有延迟
+func computeQueueLag(messageStore queueOffsetStore, brokerName, group, topic string, queueId int,
+	consumerOffset, now int64) *body.ConsumerLag {
+	brokerOffset := messageStore.GetMaxOffsetInQueue(topic, int32(queueId))
+	if brokerOffset < 0 {
+		brokerOffset = 0
+	}
+	if consumerOffset < 0 {
+		consumerOffset = 0
+	}
+
+	lag := &body.ConsumerLag{
+		ConsumerGroup:  group,
+		Topic:          topic,
+		BrokerName:     brokerName,
+		QueueId:        queueId,
+		BrokerOffset:   brokerOffset,
+		ConsumerOffset: consumerOffset,
+	}
+	if brokerOffset <= consumerOffset {
+		return lag
+	}
+	lag.LagMessages = brokerOffset - consumerOffset
+
+	// 下一条未消费消息的存储时间，消费进度之前的消息已被清除时从队列最小offset开始
+	nextOffset := consumerOffset
+	if minOffset := messageStore.GetMinOffsetInQueue(topic, int32(queueId)); nextOffset < minOffset {
+		nextOffset = minOffset
+	}
+	if storeTimestamp := messageStore.GetMessageStoreTimeStamp(topic, int32(queueId), nextOffset); storeTimestamp > 0 {
+		lag.NextMessageStoreTimestamp = storeTimestamp
+		if now > storeTimestamp {
+			lag.LagMillis = now - storeTimestamp
+		}
+	}
+	return lag
+}
+
+// alert 消息数或时间延迟超过阈值时告警，阈值为0表示不告警
+func (self *ConsumerLagService) alert(lagTable *body.ConsumerLagTable, hookList []ConsumerLagAlertHook) {
+	cfg := self.brokerController.BrokerConfig
+	for _, lag := range lagTable.LagList {
+		if !exceedLagThreshold(lag, cfg.GetConsumerLagAlertMessages(), cfg.GetConsumerLagAlertSeconds()) {
+			continue
+		}
+
+		logger.Warnf("consumer lag exceed threshold. group: %s, topic: %s, queueId: %d, lagMessages: %d, lagSeconds: %.3f",
+			lag.ConsumerGroup, lag.Topic, lag.QueueId, lag.LagMessages, lag.LagSeconds())
+		for _, hook := range hookList {
+			doAlert(hook, lag)
+		}
+	}
+}
+
+func exceedLagThreshold(lag *body.ConsumerLag, alertMessages, alertSeconds int64) bool {
+	if alertMessages > 0 && lag.LagMessages >= alertMessages {
+		return true
+	}
+	return alertSeconds > 0 && lag.LagMillis >= alertSeconds*1000
+}
+
+// doAlert 单个回调异常时不影响其他回调
+func doAlert(hook ConsumerLagAlertHook, lag *body.ConsumerLag) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Errorf("ConsumerLagAlertHook %s err: %v", hook.HookName(), err)
+		}
+	}()
+
+	hook.DoAlert(lag)
+}
@@ -0,0 +1,135 @@
+package stgbroker
+
+import (
+	"testing"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/body"
+)
+
+// lagTestStore 队列中消息的存储时间为 baseTimestamp + offset*1000
+type lagTestStore struct {
+	maxOffset     int64
+	minOffset     int64
+	baseTimestamp int64
+}
+
+func (self *lagTestStore) GetMaxOffsetInQueue(topic string, queueId int32) int64 {
+	return self.maxOffset
+}
+
+func (self *lagTestStore) GetMinOffsetInQueue(topic string, queueId int32) int64 {
+	return self.minOffset
+}
+
+func (self *lagTestStore) GetMessageStoreTimeStamp(topic string, queueId int32, offset int64) int64 {
+	if offset < self.minOffset || offset >= self.maxOffset {
+		return -1
+	}
+	return self.baseTimestamp + offset*1000
+}
+
+func TestComputeQueueLag(t *testing.T) {
+	store := &lagTestStore{maxOffset: 100, minOffset: 20, baseTimestamp: 1000000}
+	now := store.baseTimestamp + 100*1000
+
+	cases := []struct {
+		name           string
+		consumerOffset int64
+		lagMessages    int64
+		nextTimestamp  int64
+	}{
+		{"normal", 60, 40, store.baseTimestamp + 60*1000},
+		{"below min offset", 5, 95, store.baseTimestamp + 20*1000},
+		{"negative offset", -1, 100, store.baseTimestamp + 20*1000},
+		{"caught up", 100, 0, 0},
+		{"beyond max offset", 120, 0, 0},
+	}
+
+	for _, c := range cases {
+		lag := computeQueueLag(store, "broker-a", "group", "topic", 1, c.consumerOffset, now)
+		if lag.LagMessages != c.lagMessages || lag.NextMessageStoreTimestamp != c.nextTimestamp {
+			t.Errorf("%s: expect lagMessages %d nextTimestamp %d, actual %#v", c.name, c.lagMessages, c.nextTimestamp, lag)
+			continue
+		}
+		if c.nextTimestamp > 0 && lag.LagMillis != now-c.nextTimestamp {
+			t.Errorf("%s: expect lagMillis %d, actual %d", c.name, now-c.nextTimestamp, lag.LagMillis)
+		}
+		if lag.BrokerName != "broker-a" || lag.QueueId != 1 || lag.BrokerOffset != 100 {
+			t.Errorf("%s: unexpected lag identity %#v", c.name, lag)
+		}
+	}
+
+	// 队列不存在时最大offset为-1，没有延迟
+	lag := computeQueueLag(&lagTestStore{maxOffset: -1, minOffset: -1}, "broker-a", "group", "topic", 0, 10, now)
+	if lag.BrokerOffset != 0 || lag.LagMessages != 0 || lag.LagMillis != 0 {
+		t.Errorf("queue not exist should have no lag, actual %#v", lag)
+	}
+}
+
+func TestExceedLagThreshold(t *testing.T) {
+	lag := &body.ConsumerLag{LagMessages: 100, LagMillis: 30000}
+
+	cases := []struct {
+		alertMessages int64
+		alertSeconds  int64
+		exceed        bool
+	}{
+		{0, 0, false},
+		{100, 0, true},
+		{101, 0, false},
+		{0, 30, true},
+		{0, 31, false},
+		{101, 30, true},
+		{101, 31, false},
+	}
+
+	for _, c := range cases {
+		if exceedLagThreshold(lag, c.alertMessages, c.alertSeconds) != c.exceed {
+			t.Errorf("alertMessages %d alertSeconds %d: expect exceed %t", c.alertMessages, c.alertSeconds, c.exceed)
+		}
+	}
+}
+
+type lagTestAlertHook struct {
+	alerted []*body.ConsumerLag
+	panic   bool
+}
+
+func (self *lagTestAlertHook) HookName() string {
+	return "lagTestAlertHook"
+}
+
+func (self *lagTestAlertHook) DoAlert(lag *body.ConsumerLag) {
+	if self.panic {
+		panic("alert failed")
+	}
+	self.alerted = append(self.alerted, lag)
+}
+
+func TestConsumerLagService_Alert(t *testing.T) {
+	cfg := &stgcommon.BrokerConfig{ConsumerLagAlertMessages: 50}
+	service := &ConsumerLagService{brokerController: &BrokerController{BrokerConfig: cfg}}
+
+	lagTable := body.NewConsumerLagTable()
+	lagTable.LagList = []*body.ConsumerLag{
+		{ConsumerGroup: "groupA", LagMessages: 10},
+		{ConsumerGroup: "groupB", LagMessages: 50},
+		{ConsumerGroup: "groupC", LagMessages: 80},
+	}
+
+	// 前一个回调异常时，后面的回调仍然被调用
+	hook := new(lagTestAlertHook)
+	service.alert(lagTable, []ConsumerLagAlertHook{&lagTestAlertHook{panic: true}, hook})
+	if len(hook.alerted) != 2 || hook.alerted[0].ConsumerGroup != "groupB" || hook.alerted[1].ConsumerGroup != "groupC" {
+		t.Errorf("expect groupB and groupC alerted, actual %d", len(hook.alerted))
+	}
+
+	// 阈值为0时不告警
+	cfg.ConsumerLagAlertMessages = 0
+	hook = new(lagTestAlertHook)
+	service.alert(lagTable, []ConsumerLagAlertHook{hook})
+	if len(hook.alerted) != 0 {
+		t.Errorf("expect no alert when threshold is 0, actual %d", len(hook.alerted))
+	}
+}
@@ -24,7 +24,7 @@ func NewDefaultConsumerIdsChangeListener(brokerController *BrokerController) *De
 // Author gaoyanlei
 // Since 2017/8/9
 func (listener *DefaultConsumerIdsChangeListener) ConsumerIdsChanged(group string, channels []netm.Context) {
-	if channels != nil && listener.BrokerController.BrokerConfig.NotifyConsumerIdsChangedEnable {
+	if channels != nil && listener.BrokerController.BrokerConfig.GetNotifyConsumerIdsChangedEnable() {
 		for _, conn := range channels {
 			listener.BrokerController.Broker2Client.notifyConsumerIdsChanged(conn, group)
 		}
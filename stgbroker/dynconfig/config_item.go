@@ -0,0 +1,135 @@
+package dynconfig
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ConfigItem 配置注册表中的一个配置项，Key与broker toml文件中的配置项名称一致（不区分大小写）
+// HotReload为false的配置项修改后只写入toml文件，重启后生效
+// Since 2018/2/2
+type ConfigItem struct {
+	Key       string
+	HotReload bool
+	quoted    bool                               // toml中是否为字符串
+	get       func() string                      // 当前值
+	parse     func(value string) (func(), error) // 解析并校验，返回赋值函数
+}
+
+// NewConfigItem 创建自定义类型的配置项，parse只做解析、校验，赋值在返回的函数中完成
+// Since 2018/2/2
+func NewConfigItem(key string, hotReload, quoted bool, get func() string, parse func(value string) (func(), error)) *ConfigItem {
+	return &ConfigItem{Key: key, HotReload: hotReload, quoted: quoted, get: get, parse: parse}
+}
+
+// IntItem int类型配置项，取值范围[min, max]
+// Since 2018/2/2
+func IntItem(key string, p *int, hotReload bool, min, max int64) *ConfigItem {
+	return NewConfigItem(key, hotReload, false,
+		func() string { return strconv.Itoa(*p) },
+		func(value string) (func(), error) {
+			v, err := parseRange(key, value, min, max)
+			if err != nil {
+				return nil, err
+			}
+			return func() { *p = int(v) }, nil
+		})
+}
+
+// Int32Item int32类型配置项，取值范围[min, max]
+// Since 2018/2/2
+func Int32Item(key string, p *int32, hotReload bool, min, max int64) *ConfigItem {
+	return NewConfigItem(key, hotReload, false,
+		func() string { return strconv.FormatInt(int64(*p), 10) },
+		func(value string) (func(), error) {
+			v, err := parseRange(key, value, min, max)
+			if err != nil {
+				return nil, err
+			}
+			return func() { *p = int32(v) }, nil
+		})
+}
+
+// Int64Item int64类型配置项，取值范围[min, max]
+// Since 2018/2/2
+func Int64Item(key string, p *int64, hotReload bool, min, max int64) *ConfigItem {
+	return NewConfigItem(key, hotReload, false,
+		func() string { return strconv.FormatInt(*p, 10) },
+		func(value string) (func(), error) {
+			v, err := parseRange(key, value, min, max)
+			if err != nil {
+				return nil, err
+			}
+			return func() { *p = v }, nil
+		})
+}
+
+// BoolItem bool类型配置项
+// Since 2018/2/2
+func BoolItem(key string, p *bool, hotReload bool) *ConfigItem {
+	return NewConfigItem(key, hotReload, false,
+		func() string { return strconv.FormatBool(*p) },
+		func(value string) (func(), error) {
+			v, err := strconv.ParseBool(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("%s must be true or false, %s", key, value)
+			}
+			return func() { *p = v }, nil
+		})
+}
+
+// StringItem string类型配置项，check为空时不校验
+// Since 2018/2/2
+func StringItem(key string, p *string, hotReload bool, check func(value string) error) *ConfigItem {
+	return NewConfigItem(key, hotReload, true,
+		func() string { return *p },
+		func(value string) (func(), error) {
+			value = strings.TrimSpace(value)
+			if check != nil {
+				if err := check(value); err != nil {
+					return nil, fmt.Errorf("%s invalid, %s", key, err.Error())
+				}
+			}
+			return func() { *p = value }, nil
+		})
+}
+
+// NotBlank 校验字符串非空
+// Since 2018/2/2
+func NotBlank(value string) error {
+	if value == "" {
+		return fmt.Errorf("value is blank")
+	}
+	return nil
+}
+
+// Value 当前值
+// Since 2018/2/2
+func (self *ConfigItem) Value() string {
+	return self.get()
+}
+
+// TomlValue 当前值在toml文件中的写法
+// Since 2018/2/2
+func (self *ConfigItem) TomlValue() string {
+	return self.format(self.get())
+}
+
+func (self *ConfigItem) format(value string) string {
+	if self.quoted {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+func parseRange(key, value string, min, max int64) (int64, error) {
+	v, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer, %s", key, value)
+	}
+	if v < min || v > max {
+		return 0, fmt.Errorf("%s must be in [%d, %d], %d", key, min, max, v)
+	}
+	return v, nil
+}
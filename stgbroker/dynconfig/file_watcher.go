@@ -0,0 +1,70 @@
+package dynconfig
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// FileWatcher 定时检查文件的修改时间及大小，发生变化时回调onChange
+// Since 2018/2/2
+type FileWatcher struct {
+	path     string
+	interval time.Duration
+	onChange func()
+	modTime  time.Time
+	size     int64
+	stopChan chan struct{}
+	once     sync.Once
+}
+
+// NewFileWatcher 初始化
+// Since 2018/2/2
+func NewFileWatcher(path string, interval time.Duration, onChange func()) *FileWatcher {
+	return &FileWatcher{
+		path:     path,
+		interval: interval,
+		onChange: onChange,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start 以当前文件状态为基准开始检查
+// Since 2018/2/2
+func (self *FileWatcher) Start() {
+	self.changed()
+	go func() {
+		ticker := time.NewTicker(self.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if self.changed() {
+					self.onChange()
+				}
+			case <-self.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Shutdown 停止检查
+// Since 2018/2/2
+func (self *FileWatcher) Shutdown() {
+	self.once.Do(func() { close(self.stopChan) })
+}
+
+// changed 文件状态是否变化，文件不存在时不认为变化
+func (self *FileWatcher) changed() bool {
+	info, err := os.Stat(self.path)
+	if err != nil {
+		return false
+	}
+	if info.ModTime().Equal(self.modTime) && info.Size() == self.size {
+		return false
+	}
+	self.modTime = info.ModTime()
+	self.size = info.Size()
+	return true
+}
@@ -0,0 +1,218 @@
+package dynconfig
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// UpdateResult 一次配置更新的结果
+// Since 2018/2/2
+type UpdateResult struct {
+	Applied         []string // 已在运行中生效的配置项
+	RestartRequired []string // 已记录但需要重启才生效的配置项
+}
+
+// Changed 是否有配置项发生变化
+// Since 2018/2/2
+func (self *UpdateResult) Changed() bool {
+	return len(self.Applied) > 0 || len(self.RestartRequired) > 0
+}
+
+// Registry 类型化的配置注册表：统一校验配置值，一次更新中的所有配置项全部校验通过后才一起赋值，
+// 赋值完成后通知监听者，由监听者调整已启动的定时任务等运行中的服务
+// Since 2018/2/2
+type Registry struct {
+	items     map[string]*ConfigItem // 小写key -> 配置项
+	keys      []string               // 注册顺序
+	pending   map[string]string      // 小写key -> 需要重启才生效的新值
+	listeners []func(applied []string)
+	lockers   []sync.Locker // 赋值时持有的配置对象写锁，运行中通过读锁读取配置项
+	lock      sync.Mutex
+}
+
+// NewRegistry 初始化，lockers为配置项所属配置对象的写锁，赋值期间全部持有
+// Since 2018/2/2
+func NewRegistry(lockers ...sync.Locker) *Registry {
+	return &Registry{items: make(map[string]*ConfigItem), pending: make(map[string]string), lockers: lockers}
+}
+
+// Register 注册配置项，key重复时覆盖
+// Since 2018/2/2
+func (self *Registry) Register(items ...*ConfigItem) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	for _, item := range items {
+		lowerKey := strings.ToLower(item.Key)
+		if _, ok := self.items[lowerKey]; !ok {
+			self.keys = append(self.keys, item.Key)
+		}
+		self.items[lowerKey] = item
+	}
+}
+
+// AddListener 注册配置生效后的回调，applied为本次生效的配置项
+// Since 2018/2/2
+func (self *Registry) AddListener(listener func(applied []string)) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.listeners = append(self.listeners, listener)
+}
+
+// Item 查找配置项，不区分大小写
+// Since 2018/2/2
+func (self *Registry) Item(key string) (*ConfigItem, bool) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	item, ok := self.items[strings.ToLower(key)]
+	return item, ok
+}
+
+// TomlValue 配置项在toml文件中的写法，需要重启才生效的配置项取新值
+// Since 2018/2/2
+func (self *Registry) TomlValue(key string) (string, bool) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	item, ok := self.items[strings.ToLower(key)]
+	if !ok {
+		return "", false
+	}
+	if value, ok := self.pending[strings.ToLower(key)]; ok {
+		return item.format(value), true
+	}
+	return item.TomlValue(), true
+}
+
+// Values 所有配置项运行中的值
+// Since 2018/2/2
+func (self *Registry) Values() map[string]string {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	values := make(map[string]string, len(self.items))
+	for _, key := range self.keys {
+		values[key] = self.items[strings.ToLower(key)].Value()
+	}
+	return values
+}
+
+// Load 启动时按配置文件的值初始化，不区分是否可热更新，未注册的配置项忽略，返回校验失败的配置项
+// Since 2018/2/2
+func (self *Registry) Load(values map[string]string) []error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	var errs []error
+	var appliers []func()
+	for key, value := range values {
+		item, ok := self.items[strings.ToLower(key)]
+		if !ok {
+			continue
+		}
+		apply, err := item.parse(value)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		appliers = append(appliers, apply)
+	}
+	self.applyAll(appliers)
+	return errs
+}
+
+// Update 更新配置：任一配置项未注册或校验失败时全部不生效；值未变化的配置项忽略；
+// 可热更新的配置项立即赋值并通知监听者，其余配置项只在结果中标记为需要重启
+// Since 2018/2/2
+func (self *Registry) Update(values map[string]string) (*UpdateResult, error) {
+	result, applied, err := self.update(values)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(applied) > 0 {
+		self.lock.Lock()
+		listeners := self.listeners
+		self.lock.Unlock()
+		for _, listener := range listeners {
+			listener(applied)
+		}
+	}
+	return result, nil
+}
+
+func (self *Registry) update(values map[string]string) (*UpdateResult, []string, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	result := new(UpdateResult)
+	var appliers []func()
+	for _, key := range sortedKeys(values) {
+		item, ok := self.items[strings.ToLower(key)]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown config key %s", key)
+		}
+
+		apply, err := item.parse(values[key])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		lowerKey, value := strings.ToLower(key), strings.TrimSpace(values[key])
+		current, ok := self.pending[lowerKey]
+		if !ok {
+			current = item.Value()
+		}
+		if current == value {
+			continue
+		}
+
+		if item.HotReload {
+			appliers = append(appliers, apply)
+			result.Applied = append(result.Applied, item.Key)
+			continue
+		}
+		if value == item.Value() {
+			delete(self.pending, lowerKey)
+		} else {
+			self.pending[lowerKey] = value
+		}
+		result.RestartRequired = append(result.RestartRequired, item.Key)
+	}
+
+	self.applyAll(appliers)
+	return result, result.Applied, nil
+}
+
+// applyAll 持有所有配置对象的写锁赋值，读取方不会读到一次更新中的部分配置项
+func (self *Registry) applyAll(appliers []func()) {
+	if len(appliers) == 0 {
+		return
+	}
+
+	for _, locker := range self.lockers {
+		locker.Lock()
+	}
+	defer func() {
+		for i := len(self.lockers) - 1; i >= 0; i-- {
+			self.lockers[i].Unlock()
+		}
+	}()
+
+	for _, apply := range appliers {
+		apply()
+	}
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,78 @@
+package dynconfig
+
+import (
+	"testing"
+)
+
+type testConfig struct {
+	FlushInterval int32
+	DeleteWhen    string
+	LongPolling   bool
+	BrokerName    string
+}
+
+func newTestRegistry(cfg *testConfig) *Registry {
+	registry := NewRegistry()
+	registry.Register(
+		Int32Item("flushInterval", &cfg.FlushInterval, true, 1, 10000),
+		StringItem("deleteWhen", &cfg.DeleteWhen, true, NotBlank),
+		BoolItem("longPolling", &cfg.LongPolling, true),
+		StringItem("brokerName", &cfg.BrokerName, false, NotBlank),
+	)
+	return registry
+}
+
+func TestRegistryUpdate(t *testing.T) {
+	cfg := &testConfig{FlushInterval: 500, DeleteWhen: "04", LongPolling: true, BrokerName: "broker-a"}
+	registry := newTestRegistry(cfg)
+
+	var notified []string
+	registry.AddListener(func(applied []string) { notified = applied })
+
+	result, err := registry.Update(map[string]string{"FlushInterval": "1000", "longPolling": "true", "brokerName": "broker-b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.FlushInterval != 1000 || cfg.BrokerName != "broker-a" {
+		t.Fatalf("flushInterval %d, brokerName %s", cfg.FlushInterval, cfg.BrokerName)
+	}
+	if len(result.Applied) != 1 || len(result.RestartRequired) != 1 || len(notified) != 1 {
+		t.Fatalf("applied %v, restartRequired %v, notified %v", result.Applied, result.RestartRequired, notified)
+	}
+	if value, _ := registry.TomlValue("brokerName"); value != `"broker-b"` {
+		t.Fatalf("brokerName toml value %s", value)
+	}
+}
+
+func TestRegistryUpdateAtomic(t *testing.T) {
+	cfg := &testConfig{FlushInterval: 500, DeleteWhen: "04"}
+	registry := newTestRegistry(cfg)
+
+	invalids := []map[string]string{
+		{"flushInterval": "1000", "deleteWhen": ""},
+		{"flushInterval": "1000", "unknownKey": "1"},
+		{"flushInterval": "0"},
+		{"longPolling": "yes"},
+	}
+	for _, values := range invalids {
+		if _, err := registry.Update(values); err == nil {
+			t.Fatalf("update %v should fail", values)
+		}
+	}
+	if cfg.FlushInterval != 500 || cfg.DeleteWhen != "04" {
+		t.Fatalf("config changed by invalid update, %v", cfg)
+	}
+}
+
+func TestRegistryLoad(t *testing.T) {
+	cfg := &testConfig{FlushInterval: 500}
+	registry := newTestRegistry(cfg)
+
+	errs := registry.Load(map[string]string{"flushInterval": "200", "brokerName": "broker-c", "deleteWhen": "", "other": "1"})
+	if len(errs) != 1 {
+		t.Fatalf("load errors %v, expect 1", errs)
+	}
+	if cfg.FlushInterval != 200 || cfg.BrokerName != "broker-c" {
+		t.Fatalf("flushInterval %d, brokerName %s", cfg.FlushInterval, cfg.BrokerName)
+	}
+}
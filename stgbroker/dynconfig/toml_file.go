@@ -0,0 +1,152 @@
+package dynconfig
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RewriteToml 将values（key -> toml写法的值）写入toml内容，只处理第一个表（[xxx]）之前的顶层配置项：
+// 已有的配置项原地替换并保留行尾注释，只存在被注释的同名配置项时替换该行，都不存在时追加在第一个表之前
+// Since 2018/2/2
+func RewriteToml(content string, values map[string]string) string {
+	lines := strings.Split(content, "\n")
+	tableIndex := len(lines)
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "[") {
+			tableIndex = i
+			break
+		}
+	}
+
+	written := make(map[string]bool, len(values))
+	// 优先替换未被注释的配置项，其次替换被注释的同名配置项
+	for _, commented := range []bool{false, true} {
+		for i := 0; i < tableIndex; i++ {
+			key, isCommented, ok := parseTomlKey(lines[i])
+			if !ok || isCommented != commented {
+				continue
+			}
+			for valueKey, value := range values {
+				if !written[valueKey] && strings.EqualFold(key, valueKey) {
+					lines[i] = replaceTomlValue(lines[i], value)
+					written[valueKey] = true
+					break
+				}
+			}
+		}
+	}
+
+	var appends []string
+	for _, key := range sortedKeys(values) {
+		if !written[key] {
+			appends = append(appends, key+"="+values[key])
+		}
+	}
+	if len(appends) == 0 {
+		return strings.Join(lines, "\n")
+	}
+
+	// 追加在第一个表之前的最后一个非空行之后
+	insertIndex := tableIndex
+	for insertIndex > 0 && strings.TrimSpace(lines[insertIndex-1]) == "" {
+		insertIndex--
+	}
+	result := make([]string, 0, len(lines)+len(appends))
+	result = append(result, lines[:insertIndex]...)
+	result = append(result, appends...)
+	result = append(result, lines[insertIndex:]...)
+	return strings.Join(result, "\n")
+}
+
+// WriteFileAtomic 先写临时文件再重命名，避免写入过程中被读取到不完整的内容
+// Since 2018/2/2
+func WriteFileAtomic(path string, content []byte) error {
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmpFile.Name()
+	if _, err = tmpFile.Write(content); err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, perm)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+	}
+	return err
+}
+
+// parseTomlKey 解析“key=value”或“#key=value”形式的行
+func parseTomlKey(line string) (key string, commented bool, ok bool) {
+	text := strings.TrimSpace(line)
+	if strings.HasPrefix(text, "#") {
+		commented = true
+		text = strings.TrimSpace(strings.TrimLeft(text, "#"))
+	}
+
+	index := strings.Index(text, "=")
+	if index <= 0 {
+		return "", false, false
+	}
+	key = strings.TrimSpace(text[:index])
+	if key == "" || strings.ContainsAny(key, " \t\"'[") {
+		return "", false, false
+	}
+	return key, commented, true
+}
+
+// replaceTomlValue 替换行中的值，去掉行首的注释符，保留key的写法、缩进及行尾注释
+func replaceTomlValue(line, value string) string {
+	indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+	text := strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "#"))
+
+	index := strings.Index(text, "=")
+	prefix := text[:index+1]
+	rest := text[index+1:]
+	spaces := rest[:len(rest)-len(strings.TrimLeft(rest, " \t"))]
+	rest = rest[len(spaces):]
+
+	comment := ""
+	if end := tomlValueEnd(rest); end < len(rest) {
+		comment = strings.TrimRight(rest[end:], " \t")
+		if comment != "" {
+			comment = " " + strings.TrimLeft(comment, " \t")
+		}
+	}
+	return indent + prefix + spaces + value + comment
+}
+
+// tomlValueEnd 值的结束位置：字符串到闭合引号，其余到注释符或空白
+func tomlValueEnd(rest string) int {
+	if strings.HasPrefix(rest, "\"") {
+		for i := 1; i < len(rest); i++ {
+			if rest[i] == '\\' {
+				i++
+				continue
+			}
+			if rest[i] == '"' {
+				return i + 1
+			}
+		}
+		return len(rest)
+	}
+	if end := strings.IndexAny(rest, " \t#"); end >= 0 {
+		return end
+	}
+	return len(rest)
+}
@@ -0,0 +1,37 @@
+package dynconfig
+
+import (
+	"testing"
+)
+
+func TestRewriteToml(t *testing.T) {
+	content := `# broker config
+brokerName="broker-a"
+fileReservedTime = 48 # hours
+#metricsPort=10915
+
+[tls]
+mode="enforcing"
+`
+	values := map[string]string{
+		"brokerName":             `"broker-b"`,
+		"FileReservedTime":       "72",
+		"metricsPort":            "10916",
+		"flushIntervalCommitLog": "500",
+		"mode":                   `"disabled"`,
+	}
+
+	expect := `# broker config
+brokerName="broker-b"
+fileReservedTime = 72 # hours
+metricsPort=10916
+flushIntervalCommitLog=500
+mode="disabled"
+
+[tls]
+mode="enforcing"
+`
+	if result := RewriteToml(content, values); result != expect {
+		t.Fatalf("rewrite toml:\n%s\nexpect:\n%s", result, expect)
+	}
+}
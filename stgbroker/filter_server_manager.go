@@ -65,7 +65,7 @@ func (fsm *FilterServerManager) Shutdown() {
 // Author rongzhihong
 // Since 2017/9/8
 func (fsm *FilterServerManager) createFilterServer() {
-	more := fsm.brokerController.BrokerConfig.FilterServerNums - fsm.filterServerTable.Size()
+	more := fsm.brokerController.BrokerConfig.GetFilterServerNums() - fsm.filterServerTable.Size()
 	cmd := fsm.buildStartCommand()
 
 	var index int32 = 0
@@ -84,8 +84,8 @@ func (fsm *FilterServerManager) buildStartCommand() string {
 		config = fmt.Sprintf("-c %s", fsm.brokerController.ConfigFile)
 	}
 
-	if len(fsm.brokerController.BrokerConfig.NamesrvAddr) > 0 {
-		config += fmt.Sprintf(" -n %s", fsm.brokerController.BrokerConfig.NamesrvAddr)
+	if len(fsm.brokerController.BrokerConfig.GetNamesrvAddr()) > 0 {
+		config += fmt.Sprintf(" -n %s", fsm.brokerController.BrokerConfig.GetNamesrvAddr())
 	}
 
 	if stgcommon.IsWindowsOS() {
@@ -1,6 +1,7 @@
 package filtersrv
 
 import (
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/utils"
 	"os/exec"
@@ -18,7 +19,13 @@ type FilterServerUtil struct {
 func CallShell(shellString string) {
 	defer utils.RecoveredFn()
 
-	process := exec.Command(shellString)
+	// shellString为完整的命令行，需要交给shell解析参数
+	var process *exec.Cmd
+	if stgcommon.IsWindowsOS() {
+		process = exec.Command("cmd", "/C", shellString)
+	} else {
+		process = exec.Command("sh", "-c", shellString)
+	}
 	err := process.Start()
 	if err != nil {
 		logger.Errorf("callShell: readLine IOException,%s %s", shellString, err.Error())
@@ -50,3 +50,12 @@ func (req *ManyPullRequest) CloneListAndClear() []*PullRequest {
 	}
 	return nil
 }
+
+// Size 挂起的请求数量
+// Since 2018/1/30
+func (req *ManyPullRequest) Size() int {
+	req.RLock()
+	defer req.RUnlock()
+
+	return len(req.pullRequestList)
+}
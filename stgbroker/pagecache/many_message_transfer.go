@@ -2,6 +2,8 @@ package pagecache
 
 import (
 	"bytes"
+	"net"
+
 	"git.oschina.net/cloudzone/smartgo/stgnet/protocol"
 	"git.oschina.net/cloudzone/smartgo/stgstorelog"
 )
@@ -21,11 +23,10 @@ func NewManyMessageTransfer(remotingCommand *protocol.RemotingCommand, getMessag
 	mmt := new(ManyMessageTransfer)
 	mmt.remotingCommand = remotingCommand
 	mmt.getMessageResult = getMessageResult
-	mmt.EncodeBody()
 	return mmt
 }
 
-// EncodeBody 将MessageBufferList存入Body中
+// EncodeBody 将MessageBufferList拷贝到Body中，仅在通过堆内存发送时使用
 // Author rongzhihong
 // Since 2017/9/17
 func (mmt *ManyMessageTransfer) EncodeBody() {
@@ -42,9 +43,31 @@ func (mmt *ManyMessageTransfer) EncodeBody() {
 	mmt.remotingCommand.Body = bodyBuffer.Bytes()
 }
 
-// Bytes  实现Serirable接口
+// Bytes  实现Serirable接口，拷贝全部消息后整体编码
 // Author rongzhihong
 // Since 2017/9/17
 func (mmt *ManyMessageTransfer) Bytes() []byte {
+	mmt.EncodeBody()
 	return mmt.remotingCommand.Bytes()
 }
+
+// Buffers 实现BuffersSerializable接口，报文头部之后直接引用mmap中的消息，不做拷贝；
+// 写入完成前不能释放getMessageResult
+// Since 2018/1/24
+func (mmt *ManyMessageTransfer) Buffers() net.Buffers {
+	if mmt.getMessageResult == nil {
+		return net.Buffers{mmt.remotingCommand.EncodeHeaderWithBodyLength(0)}
+	}
+
+	bodyLength := 0
+	buffers := make(net.Buffers, 1, mmt.getMessageResult.MessageBufferList.Len()+1)
+	for e := mmt.getMessageResult.MessageBufferList.Front(); e != nil; e = e.Next() {
+		if mapedBufferResult, ok := e.Value.(*stgstorelog.MappedByteBuffer); ok {
+			buffers = append(buffers, mapedBufferResult.Bytes())
+			bodyLength += len(mapedBufferResult.Bytes())
+		}
+	}
+	buffers[0] = mmt.remotingCommand.EncodeHeaderWithBodyLength(bodyLength)
+
+	return buffers
+}
@@ -1,6 +1,8 @@
 package pagecache
 
 import (
+	"net"
+
 	"git.oschina.net/cloudzone/smartgo/stgnet/protocol"
 	"git.oschina.net/cloudzone/smartgo/stgstorelog"
 )
@@ -40,3 +42,13 @@ func (mmt *OneMessageTransfer) EncodeBody() {
 func (mmt *OneMessageTransfer) Bytes() []byte {
 	return mmt.remotingCommand.Bytes()
 }
+
+// Buffers 实现BuffersSerializable接口，Body直接引用mmap中的消息，避免与头部拼接时拷贝
+// Since 2018/1/24
+func (mmt *OneMessageTransfer) Buffers() net.Buffers {
+	header := mmt.remotingCommand.EncodeHeader()
+	if len(mmt.remotingCommand.Body) == 0 {
+		return net.Buffers{header}
+	}
+	return net.Buffers{header, mmt.remotingCommand.Body}
+}
@@ -4,6 +4,7 @@ import (
 	"git.oschina.net/cloudzone/smartgo/stgnet/protocol"
 	"git.oschina.net/cloudzone/smartgo/stgstorelog"
 	"bytes"
+	"net"
 )
 
 // OneMessageTransfer  消息转移
@@ -21,7 +22,6 @@ func NewQueryMessageTransfer(response *protocol.RemotingCommand, queryMessageRes
 	omt := new(QueryMessageTransfer)
 	omt.remotingCommand = response
 	omt.queryMessageResult = queryMessageResult
-	omt.EncodeBody()
 	return omt
 }
 
@@ -44,5 +44,25 @@ func (omt *QueryMessageTransfer) EncodeBody() {
 // Author rongzhihong
 // Since 2017/9/17
 func (omt *QueryMessageTransfer) Bytes() []byte {
+	omt.EncodeBody()
 	return omt.remotingCommand.Bytes()
 }
+
+// Buffers 实现BuffersSerializable接口，报文头部之后直接引用mmap中的消息，不做拷贝；
+// 写入完成前不能释放queryMessageResult
+// Since 2018/1/24
+func (omt *QueryMessageTransfer) Buffers() net.Buffers {
+	if omt.queryMessageResult == nil {
+		return net.Buffers{omt.remotingCommand.EncodeHeaderWithBodyLength(0)}
+	}
+
+	bodyLength := 0
+	buffers := make(net.Buffers, 1, len(omt.queryMessageResult.MessageBufferList)+1)
+	for _, mappedByteBuffer := range omt.queryMessageResult.MessageBufferList {
+		buffers = append(buffers, mappedByteBuffer.Bytes())
+		bodyLength += len(mappedByteBuffer.Bytes())
+	}
+	buffers[0] = omt.remotingCommand.EncodeHeaderWithBodyLength(bodyLength)
+
+	return buffers
+}
@@ -0,0 +1,67 @@
+package pop
+
+import (
+	"fmt"
+)
+
+const (
+	CK_RECORD  = "CK"  // POP拉取消息时写入的CheckPoint记录
+	ACK_RECORD = "ACK" // 消息被Ack时写入的记录
+)
+
+// CheckPoint 一次POP拉取在一个队列上的消息，PopTime+InvisibleTime之前未Ack的消息进入重试队列
+// Since 2018/2/1
+type CheckPoint struct {
+	ConsumerGroup string  `json:"consumerGroup"`
+	Topic         string  `json:"topic"` // 消息实际所在的topic，可能是重试topic
+	QueueId       int32   `json:"queueId"`
+	QueueOffsets  []int64 `json:"queueOffsets"`
+	PopTime       int64   `json:"popTime"`
+	InvisibleTime int64   `json:"invisibleTime"`
+}
+
+// ReviveTime 不可见时间截止的时间点
+// Since 2018/2/1
+func (ck *CheckPoint) ReviveTime() int64 {
+	return ck.PopTime + ck.InvisibleTime
+}
+
+func (ck *CheckPoint) String() string {
+	return fmt.Sprintf("CheckPoint [consumerGroup=%s, topic=%s, queueId=%d, queueOffsets=%v, popTime=%d, invisibleTime=%d]",
+		ck.ConsumerGroup, ck.Topic, ck.QueueId, ck.QueueOffsets, ck.PopTime, ck.InvisibleTime)
+}
+
+// AckRecord 一条消息的Ack记录，按PopTime对应到CheckPoint
+// Since 2018/2/1
+type AckRecord struct {
+	ConsumerGroup string `json:"consumerGroup"`
+	Topic         string `json:"topic"`
+	QueueId       int32  `json:"queueId"`
+	Offset        int64  `json:"offset"`
+	PopTime       int64  `json:"popTime"`
+}
+
+// ReviveRecord 写入POP_REVIVE_TOPIC的消息体，Type为CK_RECORD或ACK_RECORD
+// Since 2018/2/1
+type ReviveRecord struct {
+	Type       string      `json:"type"`
+	CheckPoint *CheckPoint `json:"checkPoint,omitempty"`
+	Ack        *AckRecord  `json:"ack,omitempty"`
+}
+
+// NewCheckPointRecord 初始化CheckPoint记录
+// Since 2018/2/1
+func NewCheckPointRecord(ck *CheckPoint) *ReviveRecord {
+	return &ReviveRecord{Type: CK_RECORD, CheckPoint: ck}
+}
+
+// NewAckRecord 初始化Ack记录
+// Since 2018/2/1
+func NewAckRecord(ack *AckRecord) *ReviveRecord {
+	return &ReviveRecord{Type: ACK_RECORD, Ack: ack}
+}
+
+// ackKey 同一队列的同一offset在同一PopTime只会出现在一个CheckPoint中
+func ackKey(consumerGroup, topic string, queueId int32, offset, popTime int64) string {
+	return fmt.Sprintf("%s@%s@%d@%d@%d", consumerGroup, topic, queueId, offset, popTime)
+}
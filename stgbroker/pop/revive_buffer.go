@@ -0,0 +1,126 @@
+package pop
+
+import (
+	"sort"
+	"sync"
+)
+
+// ReviveTask 不可见时间已到的CheckPoint，QueueOffsets只包含未Ack的消息
+// Since 2018/2/1
+type ReviveTask struct {
+	CheckPoint   *CheckPoint
+	ReviveOffset int64 // CheckPoint记录在POP_REVIVE_TOPIC中的offset
+}
+
+type reviveEntry struct {
+	ck           *CheckPoint
+	reviveOffset int64
+	unacked      map[int64]bool
+}
+
+// ReviveBuffer 按POP_REVIVE_TOPIC的读取顺序缓存未完成的CheckPoint，并用Ack记录抵消
+// Since 2018/2/1
+type ReviveBuffer struct {
+	entries  map[int64]*reviveEntry  // reviveOffset -> CheckPoint
+	ackIndex map[string]*reviveEntry // ackKey -> CheckPoint
+	lock     sync.Mutex
+}
+
+// NewReviveBuffer 初始化
+// Since 2018/2/1
+func NewReviveBuffer() *ReviveBuffer {
+	return &ReviveBuffer{
+		entries:  make(map[int64]*reviveEntry),
+		ackIndex: make(map[string]*reviveEntry),
+	}
+}
+
+// AddCheckPoint 缓存CheckPoint，reviveOffset重复时忽略
+// Since 2018/2/1
+func (self *ReviveBuffer) AddCheckPoint(ck *CheckPoint, reviveOffset int64) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if _, ok := self.entries[reviveOffset]; ok || len(ck.QueueOffsets) == 0 {
+		return
+	}
+
+	entry := &reviveEntry{ck: ck, reviveOffset: reviveOffset, unacked: make(map[int64]bool, len(ck.QueueOffsets))}
+	for _, offset := range ck.QueueOffsets {
+		entry.unacked[offset] = true
+		self.ackIndex[ackKey(ck.ConsumerGroup, ck.Topic, ck.QueueId, offset, ck.PopTime)] = entry
+	}
+	self.entries[reviveOffset] = entry
+}
+
+// Ack 抵消CheckPoint中的一条消息，全部Ack后移除CheckPoint，找不到对应CheckPoint时返回false
+// Since 2018/2/1
+func (self *ReviveBuffer) Ack(ack *AckRecord) bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	key := ackKey(ack.ConsumerGroup, ack.Topic, ack.QueueId, ack.Offset, ack.PopTime)
+	entry, ok := self.ackIndex[key]
+	if !ok {
+		return false
+	}
+
+	delete(self.ackIndex, key)
+	delete(entry.unacked, ack.Offset)
+	if len(entry.unacked) == 0 {
+		delete(self.entries, entry.reviveOffset)
+	}
+	return true
+}
+
+// PollExpired 取出不可见时间已到的CheckPoint，按reviveOffset从小到大排列
+// Since 2018/2/1
+func (self *ReviveBuffer) PollExpired(now int64) []*ReviveTask {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	var tasks []*ReviveTask
+	for reviveOffset, entry := range self.entries {
+		if entry.ck.ReviveTime() > now {
+			continue
+		}
+
+		ck := *entry.ck
+		ck.QueueOffsets = make([]int64, 0, len(entry.unacked))
+		for _, offset := range entry.ck.QueueOffsets {
+			if entry.unacked[offset] {
+				ck.QueueOffsets = append(ck.QueueOffsets, offset)
+				delete(self.ackIndex, ackKey(ck.ConsumerGroup, ck.Topic, ck.QueueId, offset, ck.PopTime))
+			}
+		}
+		delete(self.entries, reviveOffset)
+		tasks = append(tasks, &ReviveTask{CheckPoint: &ck, ReviveOffset: reviveOffset})
+	}
+
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ReviveOffset < tasks[j].ReviveOffset })
+	return tasks
+}
+
+// CommitOffset POP_REVIVE_TOPIC可以提交的消费进度，即未完成CheckPoint中最小的reviveOffset，没有时为readOffset
+// Since 2018/2/1
+func (self *ReviveBuffer) CommitOffset(readOffset int64) int64 {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	commitOffset := readOffset
+	for reviveOffset := range self.entries {
+		if reviveOffset < commitOffset {
+			commitOffset = reviveOffset
+		}
+	}
+	return commitOffset
+}
+
+// Size 未完成的CheckPoint数量
+// Since 2018/2/1
+func (self *ReviveBuffer) Size() int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	return len(self.entries)
+}
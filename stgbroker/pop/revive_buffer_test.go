@@ -0,0 +1,89 @@
+package pop
+
+import (
+	"testing"
+)
+
+func newCheckPoint(popTime int64, offsets ...int64) *CheckPoint {
+	return &CheckPoint{
+		ConsumerGroup: "group",
+		Topic:         "topic",
+		QueueId:       1,
+		QueueOffsets:  offsets,
+		PopTime:       popTime,
+		InvisibleTime: 1000,
+	}
+}
+
+func newAck(offset, popTime int64) *AckRecord {
+	return &AckRecord{ConsumerGroup: "group", Topic: "topic", QueueId: 1, Offset: offset, PopTime: popTime}
+}
+
+func TestReviveBufferAck(t *testing.T) {
+	buffer := NewReviveBuffer()
+	buffer.AddCheckPoint(newCheckPoint(100, 10, 11, 12), 0)
+
+	if !buffer.Ack(newAck(11, 100)) {
+		t.Fatal("ack offset 11 failed")
+	}
+	if buffer.Ack(newAck(11, 100)) {
+		t.Fatal("ack offset 11 twice should fail")
+	}
+	if buffer.Ack(newAck(10, 200)) {
+		t.Fatal("ack with other popTime should fail")
+	}
+
+	tasks := buffer.PollExpired(1100)
+	if len(tasks) != 1 {
+		t.Fatalf("expired tasks %d, expect 1", len(tasks))
+	}
+	offsets := tasks[0].CheckPoint.QueueOffsets
+	if len(offsets) != 2 || offsets[0] != 10 || offsets[1] != 12 {
+		t.Fatalf("unacked offsets %v, expect [10 12]", offsets)
+	}
+	if buffer.Size() != 0 {
+		t.Fatalf("buffer size %d, expect 0", buffer.Size())
+	}
+}
+
+func TestReviveBufferAllAcked(t *testing.T) {
+	buffer := NewReviveBuffer()
+	buffer.AddCheckPoint(newCheckPoint(100, 10, 11), 5)
+	buffer.Ack(newAck(10, 100))
+	buffer.Ack(newAck(11, 100))
+
+	if buffer.Size() != 0 {
+		t.Fatalf("buffer size %d, expect 0", buffer.Size())
+	}
+	if tasks := buffer.PollExpired(2000); len(tasks) != 0 {
+		t.Fatalf("expired tasks %d, expect 0", len(tasks))
+	}
+	if offset := buffer.CommitOffset(8); offset != 8 {
+		t.Fatalf("commit offset %d, expect 8", offset)
+	}
+}
+
+func TestReviveBufferPollExpired(t *testing.T) {
+	buffer := NewReviveBuffer()
+	buffer.AddCheckPoint(newCheckPoint(300, 1), 3)
+	buffer.AddCheckPoint(newCheckPoint(100, 2), 1)
+	buffer.AddCheckPoint(newCheckPoint(5000, 3), 2)
+
+	if offset := buffer.CommitOffset(10); offset != 1 {
+		t.Fatalf("commit offset %d, expect 1", offset)
+	}
+
+	tasks := buffer.PollExpired(1500)
+	if len(tasks) != 2 || tasks[0].ReviveOffset != 1 || tasks[1].ReviveOffset != 3 {
+		t.Fatalf("unexpected expired tasks %v", tasks)
+	}
+	if offset := buffer.CommitOffset(10); offset != 2 {
+		t.Fatalf("commit offset %d, expect 2", offset)
+	}
+
+	// 重新加入的CheckPoint在下一轮继续投递
+	buffer.AddCheckPoint(tasks[0].CheckPoint, tasks[0].ReviveOffset)
+	if offset := buffer.CommitOffset(10); offset != 1 {
+		t.Fatalf("commit offset %d, expect 1", offset)
+	}
+}
@@ -0,0 +1,378 @@
+package stgbroker
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"git.oschina.net/cloudzone/smartgo/stgbroker/pop"
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/constant"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/message"
+	code "git.oschina.net/cloudzone/smartgo/stgcommon/protocol"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/header"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/utils/timeutil"
+	"git.oschina.net/cloudzone/smartgo/stgnet/netm"
+	"git.oschina.net/cloudzone/smartgo/stgnet/protocol"
+	"git.oschina.net/cloudzone/smartgo/stgstorelog"
+	"git.oschina.net/cloudzone/smartgo/stgstorelog/config"
+)
+
+const (
+	defaultPopInvisibleTime = 60000 // 默认消息不可见时间（毫秒）
+	maxPopMsgNums           = 32    // 单次POP最多拉取的消息数
+	popRetryTopicRatio      = 5     // 每5次POP优先读取一次重试队列，避免重试消息饥饿
+)
+
+// PopMessageProcessor POP消费请求处理：客户端不持有队列，broker按订阅组维护拉取进度，
+// 拉取的消息在不可见时间内不会被再次拉取，不可见时间内未Ack的消息由PopReviveService投递到重试队列
+// 同一订阅组的POP进度与Push/Pull共用ConsumerOffsetManager，因此一个订阅组不能同时使用两种方式消费
+// Since 2018/2/1
+type PopMessageProcessor struct {
+	BrokerController *BrokerController
+	queueLockTable   map[string]*sync.Mutex // group@topic@queueId -> 锁，同一队列的POP串行执行
+	lock             sync.Mutex
+	queueIndex       uint32 // 轮询选择起始队列
+}
+
+// NewPopMessageProcessor 初始化PopMessageProcessor
+// Since 2018/2/1
+func NewPopMessageProcessor(brokerController *BrokerController) *PopMessageProcessor {
+	return &PopMessageProcessor{
+		BrokerController: brokerController,
+		queueLockTable:   make(map[string]*sync.Mutex),
+	}
+}
+
+func (self *PopMessageProcessor) ProcessRequest(ctx netm.Context, request *protocol.RemotingCommand) (*protocol.RemotingCommand, error) {
+	switch request.Code {
+	case code.POP_MESSAGE:
+		return self.popMessage(ctx, request), nil
+	case code.ACK_MESSAGE:
+		return self.ackMessage(request), nil
+	case code.CHANGE_INVISIBLE_TIME:
+		return self.changeInvisibleTime(request), nil
+	}
+	return nil, nil
+}
+
+// popMessage 依次从各队列拉取消息，每个队列写入一条CheckPoint记录后提交拉取进度
+func (self *PopMessageProcessor) popMessage(ctx netm.Context, request *protocol.RemotingCommand) *protocol.RemotingCommand {
+	responseHeader := &header.PopMessageResponseHeader{}
+	response := protocol.CreateDefaultResponseCommand(responseHeader)
+	response.Opaque = request.Opaque
+
+	requestHeader := &header.PopMessageRequestHeader{}
+	if err := request.DecodeCommandCustomHeader(requestHeader); err != nil {
+		logger.Errorf("Pop Message: Decode Request Throw Error:%s", err.Error())
+		response.Code = code.SYSTEM_ERROR
+		response.Remark = "decode pop message request header failed"
+		return response
+	}
+
+	if !self.BrokerController.BrokerConfig.HasReadable() {
+		response.Code = code.NO_PERMISSION
+		response.Remark = "the broker[" + self.BrokerController.BrokerConfig.BrokerIP1 + "] pulling message is forbidden"
+		return response
+	}
+	if !self.checkConsumerGroup(response, requestHeader.ConsumerGroup) {
+		return response
+	}
+
+	topicConfig := self.BrokerController.TopicConfigManager.SelectTopicConfig(requestHeader.Topic)
+	if topicConfig == nil {
+		response.Code = code.TOPIC_NOT_EXIST
+		response.Remark = "topic[" + requestHeader.Topic + "] not exist, apply first please!"
+		return response
+	}
+	if !constant.IsReadable(topicConfig.Perm) {
+		response.Code = code.NO_PERMISSION
+		response.Remark = "the topic[" + requestHeader.Topic + "] pulling message is forbidden"
+		return response
+	}
+	if requestHeader.QueueId >= topicConfig.ReadQueueNums {
+		response.Code = code.SYSTEM_ERROR
+		response.Remark = fmt.Sprintf("queueId[%d] is illagal, topic: %s, readQueueNums: %d",
+			requestHeader.QueueId, requestHeader.Topic, topicConfig.ReadQueueNums)
+		return response
+	}
+
+	retryAfter := self.BrokerController.QuotaManager.CheckPull(ctx, requestHeader.Topic, requestHeader.ConsumerGroup)
+	if retryAfter > 0 {
+		return rateLimitedResponse(response, retryAfter, "pop message from topic["+requestHeader.Topic+"] exceeds quota")
+	}
+
+	maxMsgNums := requestHeader.MaxMsgNums
+	if maxMsgNums <= 0 || maxMsgNums > maxPopMsgNums {
+		maxMsgNums = maxPopMsgNums
+	}
+	invisibleTime := requestHeader.InvisibleTime
+	if invisibleTime <= 0 {
+		invisibleTime = defaultPopInvisibleTime
+	}
+
+	popTime := timeutil.CurrentTimeMillis()
+	topics := []string{requestHeader.Topic, stgcommon.GetRetryTopic(requestHeader.ConsumerGroup)}
+	if popTime%popRetryTopicRatio == 0 {
+		topics[0], topics[1] = topics[1], topics[0]
+	}
+
+	bodyBuffer := new(bytes.Buffer)
+	msgNums := 0
+	for _, topic := range topics {
+		if msgNums >= maxMsgNums {
+			break
+		}
+		queueId := int32(-1)
+		if topic == requestHeader.Topic {
+			queueId = requestHeader.QueueId
+		}
+		msgNums += self.popTopic(requestHeader.ConsumerGroup, topic, queueId, maxMsgNums-msgNums, popTime, invisibleTime, bodyBuffer)
+	}
+
+	if msgNums == 0 {
+		response.Code = code.PULL_NOT_FOUND
+		response.Remark = "no new message"
+		return response
+	}
+
+	bodySize := bodyBuffer.Len()
+	self.BrokerController.QuotaManager.ConsumePull(ctx, requestHeader.Topic, requestHeader.ConsumerGroup, msgNums, bodySize)
+	self.BrokerController.brokerStatsManager.IncGroupGetNums(requestHeader.ConsumerGroup, requestHeader.Topic, msgNums)
+	self.BrokerController.brokerStatsManager.IncGroupGetSize(requestHeader.ConsumerGroup, requestHeader.Topic, bodySize)
+	self.BrokerController.brokerStatsManager.IncBrokerGetNums(msgNums)
+
+	responseHeader.PopTime = popTime
+	responseHeader.InvisibleTime = invisibleTime
+	response.Code = code.SUCCESS
+	response.Body = bodyBuffer.Bytes()
+	return response
+}
+
+// popTopic queueId小于0时从轮询选择的队列开始依次拉取，返回拉取到的消息数
+func (self *PopMessageProcessor) popTopic(group, topic string, queueId int32, maxMsgNums int, popTime, invisibleTime int64, bodyBuffer *bytes.Buffer) int {
+	if queueId >= 0 {
+		return self.popQueue(group, topic, queueId, maxMsgNums, popTime, invisibleTime, bodyBuffer)
+	}
+
+	topicConfig := self.BrokerController.TopicConfigManager.SelectTopicConfig(topic)
+	if topicConfig == nil || topicConfig.ReadQueueNums <= 0 || !constant.IsReadable(topicConfig.Perm) {
+		return 0
+	}
+
+	msgNums := 0
+	startIndex := atomic.AddUint32(&self.queueIndex, 1)
+	for i := int32(0); i < topicConfig.ReadQueueNums && msgNums < maxMsgNums; i++ {
+		queueId := int32((startIndex + uint32(i)) % uint32(topicConfig.ReadQueueNums))
+		msgNums += self.popQueue(group, topic, queueId, maxMsgNums-msgNums, popTime, invisibleTime, bodyBuffer)
+	}
+	return msgNums
+}
+
+// popQueue 从订阅组的拉取进度开始读取消息，写入CheckPoint成功后才提交拉取进度
+func (self *PopMessageProcessor) popQueue(group, topic string, queueId int32, maxMsgNums int, popTime, invisibleTime int64, bodyBuffer *bytes.Buffer) int {
+	queueLock := self.queueLock(fmt.Sprintf("%s@%s@%d", group, topic, queueId))
+	queueLock.Lock()
+	defer queueLock.Unlock()
+
+	messageStore := self.BrokerController.MessageStore
+	consumerOffsetManager := self.BrokerController.ConsumerOffsetManager
+
+	// 首次POP从队列最小offset开始
+	offset := consumerOffsetManager.QueryOffset(group, topic, int(queueId))
+	if offset < 0 {
+		offset = messageStore.GetMinOffsetInQueue(topic, queueId)
+		if offset < 0 {
+			offset = 0
+		}
+	}
+
+	getMessageResult := messageStore.GetMessage(group, topic, queueId, offset, int32(maxMsgNums), nil)
+	if getMessageResult == nil {
+		return 0
+	}
+	defer getMessageResult.Release()
+
+	switch getMessageResult.Status {
+	case stgstorelog.FOUND:
+	case stgstorelog.NO_MATCHED_MESSAGE, stgstorelog.OFFSET_TOO_SMALL, stgstorelog.OFFSET_OVERFLOW_BADLY:
+		// 过滤掉的消息直接跳过，越界的进度修正到NextBeginOffset
+		if getMessageResult.NextBeginOffset != offset {
+			consumerOffsetManager.CommitOffset(group, topic, int(queueId), getMessageResult.NextBeginOffset)
+		}
+		return 0
+	default:
+		return 0
+	}
+
+	ck := &pop.CheckPoint{
+		ConsumerGroup: group,
+		Topic:         topic,
+		QueueId:       queueId,
+		QueueOffsets:  make([]int64, 0, getMessageResult.GetMessageCount()),
+		PopTime:       popTime,
+		InvisibleTime: invisibleTime,
+	}
+	buffers := make([][]byte, 0, getMessageResult.GetMessageCount())
+	for e := getMessageResult.MessageMapedList.Front(); e != nil; e = e.Next() {
+		bufferResult, ok := e.Value.(*stgstorelog.SelectMapedBufferResult)
+		if !ok {
+			continue
+		}
+		buf := bufferResult.MappedByteBuffer.Bytes()
+		msgExt, err := message.DecodeMessageExt(buf, false, false)
+		if err != nil {
+			logger.Errorf("pop message decode failed, topic: %s, queueId: %d, err: %s", topic, queueId, err.Error())
+			return 0
+		}
+		ck.QueueOffsets = append(ck.QueueOffsets, msgExt.QueueOffset)
+		buffers = append(buffers, buf)
+	}
+	if len(buffers) == 0 {
+		return 0
+	}
+
+	if !self.BrokerController.PopReviveService.AppendCheckPoint(ck) {
+		return 0
+	}
+	consumerOffsetManager.CommitOffset(group, topic, int(queueId), getMessageResult.NextBeginOffset)
+
+	for _, buf := range buffers {
+		bodyBuffer.Write(buf)
+	}
+	return len(buffers)
+}
+
+// ackMessage 写入Ack记录，抵消对应的CheckPoint
+func (self *PopMessageProcessor) ackMessage(request *protocol.RemotingCommand) *protocol.RemotingCommand {
+	response := protocol.CreateDefaultResponseCommand(nil)
+	response.Opaque = request.Opaque
+
+	requestHeader := &header.AckMessageRequestHeader{}
+	if err := request.DecodeCommandCustomHeader(requestHeader); err != nil {
+		logger.Errorf("Ack Message: Decode Request Throw Error:%s", err.Error())
+		response.Code = code.SYSTEM_ERROR
+		response.Remark = "decode ack message request header failed"
+		return response
+	}
+
+	if !self.checkConsumerGroup(response, requestHeader.ConsumerGroup) {
+		return response
+	}
+
+	ack := &pop.AckRecord{
+		ConsumerGroup: requestHeader.ConsumerGroup,
+		Topic:         requestHeader.Topic,
+		QueueId:       requestHeader.QueueId,
+		Offset:        requestHeader.Offset,
+		PopTime:       requestHeader.PopTime,
+	}
+	if !self.BrokerController.PopReviveService.AppendAck(ack) {
+		response.Code = code.SYSTEM_ERROR
+		response.Remark = "append ack record failed"
+		return response
+	}
+
+	response.Code = code.SUCCESS
+	response.Remark = ""
+	return response
+}
+
+// changeInvisibleTime 以新的PopTime写入只包含该消息的CheckPoint，再Ack原来的CheckPoint
+func (self *PopMessageProcessor) changeInvisibleTime(request *protocol.RemotingCommand) *protocol.RemotingCommand {
+	responseHeader := &header.ChangeInvisibleTimeResponseHeader{}
+	response := protocol.CreateDefaultResponseCommand(responseHeader)
+	response.Opaque = request.Opaque
+
+	requestHeader := &header.ChangeInvisibleTimeRequestHeader{}
+	if err := request.DecodeCommandCustomHeader(requestHeader); err != nil {
+		logger.Errorf("Change Invisible Time: Decode Request Throw Error:%s", err.Error())
+		response.Code = code.SYSTEM_ERROR
+		response.Remark = "decode change invisible time request header failed"
+		return response
+	}
+
+	if !self.checkConsumerGroup(response, requestHeader.ConsumerGroup) {
+		return response
+	}
+	if requestHeader.InvisibleTime <= 0 {
+		response.Code = code.SYSTEM_ERROR
+		response.Remark = fmt.Sprintf("invalid invisibleTime %d", requestHeader.InvisibleTime)
+		return response
+	}
+
+	// 新的PopTime必须与原来的不同，否则Ack时无法区分两个CheckPoint
+	popTime := timeutil.CurrentTimeMillis()
+	if popTime <= requestHeader.PopTime {
+		popTime = requestHeader.PopTime + 1
+	}
+
+	ck := &pop.CheckPoint{
+		ConsumerGroup: requestHeader.ConsumerGroup,
+		Topic:         requestHeader.Topic,
+		QueueId:       requestHeader.QueueId,
+		QueueOffsets:  []int64{requestHeader.Offset},
+		PopTime:       popTime,
+		InvisibleTime: requestHeader.InvisibleTime,
+	}
+	if !self.BrokerController.PopReviveService.AppendCheckPoint(ck) {
+		response.Code = code.SYSTEM_ERROR
+		response.Remark = "append check point record failed"
+		return response
+	}
+
+	ack := &pop.AckRecord{
+		ConsumerGroup: requestHeader.ConsumerGroup,
+		Topic:         requestHeader.Topic,
+		QueueId:       requestHeader.QueueId,
+		Offset:        requestHeader.Offset,
+		PopTime:       requestHeader.PopTime,
+	}
+	if !self.BrokerController.PopReviveService.AppendAck(ack) {
+		response.Code = code.SYSTEM_ERROR
+		response.Remark = "append ack record failed"
+		return response
+	}
+
+	responseHeader.PopTime = popTime
+	responseHeader.InvisibleTime = requestHeader.InvisibleTime
+	response.Code = code.SUCCESS
+	response.Remark = ""
+	return response
+}
+
+// checkConsumerGroup POP进度及CheckPoint只在Master上维护，订阅组需存在且允许消费
+func (self *PopMessageProcessor) checkConsumerGroup(response *protocol.RemotingCommand, consumerGroup string) bool {
+	if self.BrokerController.MessageStoreConfig.BrokerRole == config.SLAVE {
+		response.Code = code.NO_PERMISSION
+		response.Remark = "the broker[" + self.BrokerController.BrokerConfig.BrokerIP1 + "] is slave, pop consumption is only supported by master"
+		return false
+	}
+
+	subscriptionGroupConfig := self.BrokerController.SubscriptionGroupManager.FindSubscriptionGroupConfig(consumerGroup)
+	if subscriptionGroupConfig == nil {
+		response.Code = code.SUBSCRIPTION_GROUP_NOT_EXIST
+		response.Remark = "subscription group not exist, " + consumerGroup
+		return false
+	}
+	if !subscriptionGroupConfig.ConsumeEnable {
+		response.Code = code.NO_PERMISSION
+		response.Remark = "subscription group no permission, " + consumerGroup
+		return false
+	}
+	return true
+}
+
+func (self *PopMessageProcessor) queueLock(key string) *sync.Mutex {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	queueLock, ok := self.queueLockTable[key]
+	if !ok {
+		queueLock = new(sync.Mutex)
+		self.queueLockTable[key] = queueLock
+	}
+	return queueLock
+}
@@ -0,0 +1,232 @@
+package stgbroker
+
+import (
+	"time"
+
+	"git.oschina.net/cloudzone/smartgo/stgbroker/pop"
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/constant"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/message"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/utils/timeutil"
+	"git.oschina.net/cloudzone/smartgo/stgstorelog"
+	"git.oschina.net/cloudzone/smartgo/stgstorelog/config"
+	"github.com/pquerna/ffjson/ffjson"
+)
+
+const (
+	popReviveInterval     = time.Second
+	popReviveBatchNums    = 32
+	popReviveMaxReadBatch = 100 // 每轮最多读取的批次，避免积压过多时长时间占用
+)
+
+// PopReviveService POP消费的CheckPoint、Ack记录以消息形式存储在POP_REVIVE_TOPIC中，
+// 定时按顺序读取并相互抵消，不可见时间已到仍未Ack的消息投递到订阅组的重试队列，超过最大重试次数时投递到死信队列
+// 读取进度按未完成CheckPoint中最小的offset提交，重启后从该位置重新读取，已投递的消息可能会重复投递
+// 未读到队列末尾时，只投递不可见时间早于最近读取记录存储时间的CheckPoint，保证Ack记录已被读取
+// Since 2018/2/1
+type PopReviveService struct {
+	brokerController *BrokerController
+	buffer           *pop.ReviveBuffer
+	reader           *systemTopicReader
+	ticker           *timeutil.Ticker
+}
+
+// NewPopReviveService 初始化
+// Since 2018/2/1
+func NewPopReviveService(brokerController *BrokerController) *PopReviveService {
+	service := &PopReviveService{
+		brokerController: brokerController,
+		buffer:           pop.NewReviveBuffer(),
+		reader: newSystemTopicReader(brokerController, stgcommon.POP_REVIVE_GROUP, stgcommon.POP_REVIVE_TOPIC,
+			popReviveBatchNums, popReviveMaxReadBatch, true),
+	}
+	service.ticker = timeutil.NewTicker(false, popReviveInterval, popReviveInterval, func() {
+		service.revive()
+	})
+	return service
+}
+
+// Start 启动
+// Since 2018/2/1
+func (self *PopReviveService) Start() {
+	self.ticker.Start()
+	logger.Info("PopReviveService start successful")
+}
+
+// Shutdown 停止
+// Since 2018/2/1
+func (self *PopReviveService) Shutdown() {
+	self.ticker.Stop()
+	logger.Info("PopReviveService shutdown successful")
+}
+
+// AppendCheckPoint 写入CheckPoint记录
+// Since 2018/2/1
+func (self *PopReviveService) AppendCheckPoint(ck *pop.CheckPoint) bool {
+	return self.appendRecord(pop.NewCheckPointRecord(ck), ck.ConsumerGroup)
+}
+
+// AppendAck 写入Ack记录
+// Since 2018/2/1
+func (self *PopReviveService) AppendAck(ack *pop.AckRecord) bool {
+	return self.appendRecord(pop.NewAckRecord(ack), ack.ConsumerGroup)
+}
+
+func (self *PopReviveService) appendRecord(record *pop.ReviveRecord, consumerGroup string) bool {
+	body, err := ffjson.Marshal(record)
+	if err != nil {
+		logger.Errorf("encode pop revive record failed: %s", err.Error())
+		return false
+	}
+
+	msgInner := new(stgstorelog.MessageExtBrokerInner)
+	msgInner.Topic = stgcommon.POP_REVIVE_TOPIC
+	msgInner.SetTags(record.Type)
+	msgInner.SetKeys(consumerGroup)
+	msgInner.Body = body
+	msgInner.PropertiesString = message.MessageProperties2String(msgInner.Properties)
+	msgInner.TagsCode = stgstorelog.TagsString2tagsCode(stgcommon.SINGLE_TAG, msgInner.GetTags())
+	msgInner.QueueId = 0
+	msgInner.BornTimestamp = timeutil.CurrentTimeMillis()
+	msgInner.BornHost = self.brokerController.GetBrokerAddr()
+	msgInner.StoreHost = msgInner.BornHost
+
+	putMessageResult := self.brokerController.MessageStore.PutMessage(msgInner)
+	if putMessageResult == nil || putMessageResult.PutMessageStatus != stgstorelog.PUTMESSAGE_PUT_OK {
+		logger.Errorf("put pop revive record failed, type: %s, group: %s", record.Type, consumerGroup)
+		return false
+	}
+	return true
+}
+
+// revive 读取新的记录，投递不可见时间已到的消息，并提交读取进度
+func (self *PopReviveService) revive() {
+	// 只有Master处理POP请求
+	if self.brokerController.MessageStoreConfig.BrokerRole == config.SLAVE {
+		return
+	}
+
+	// 之后的Ack记录尚未读取时，按已读取记录的存储时间判断不可见时间是否已到，避免把已Ack的消息重新投递
+	now := timeutil.CurrentTimeMillis()
+	if caughtUp := self.reader.read(self.applyRecord); !caughtUp && self.reader.storeTimestamp < now {
+		now = self.reader.storeTimestamp
+	}
+
+	for _, task := range self.buffer.PollExpired(now) {
+		if !self.reviveCheckPoint(task.CheckPoint) {
+			// 下一轮重新投递
+			self.buffer.AddCheckPoint(task.CheckPoint, task.ReviveOffset)
+		}
+	}
+
+	self.reader.commit(self.buffer.CommitOffset)
+}
+
+func (self *PopReviveService) applyRecord(msgExt *message.MessageExt) {
+	record := new(pop.ReviveRecord)
+	if err := ffjson.Unmarshal(msgExt.Body, record); err != nil {
+		logger.Errorf("decode pop revive record failed, offset: %d, err: %s", msgExt.QueueOffset, err.Error())
+		return
+	}
+
+	switch record.Type {
+	case pop.CK_RECORD:
+		if record.CheckPoint != nil {
+			self.buffer.AddCheckPoint(record.CheckPoint, msgExt.QueueOffset)
+		}
+	case pop.ACK_RECORD:
+		if record.Ack != nil {
+			self.buffer.Ack(record.Ack)
+		}
+	}
+}
+
+// reviveCheckPoint 将未Ack的消息投递到重试队列或死信队列，返回false时需要重新投递
+func (self *PopReviveService) reviveCheckPoint(ck *pop.CheckPoint) bool {
+	subscriptionGroupConfig := self.brokerController.SubscriptionGroupManager.FindSubscriptionGroupConfig(ck.ConsumerGroup)
+	if subscriptionGroupConfig == nil {
+		logger.Warnf("pop revive dropped, subscription group not exist. %s", ck.String())
+		return true
+	}
+
+	messageStore := self.brokerController.MessageStore
+	for i, offset := range ck.QueueOffsets {
+		var msgExt *message.MessageExt
+		if phyOffset := messageStore.GetCommitLogOffsetInQueue(ck.Topic, ck.QueueId, offset); phyOffset >= 0 {
+			msgExt = messageStore.LookMessageByOffset(phyOffset)
+		}
+		if msgExt == nil {
+			logger.Warnf("pop revive look message failed, message may be deleted. topic: %s, queueId: %d, offset: %d",
+				ck.Topic, ck.QueueId, offset)
+			continue
+		}
+
+		if !self.reviveMessage(ck.ConsumerGroup, subscriptionGroupConfig.RetryQueueNums, subscriptionGroupConfig.RetryMaxTimes, msgExt) {
+			// 只保留未投递成功的消息
+			ck.QueueOffsets = ck.QueueOffsets[i:]
+			return false
+		}
+	}
+	return true
+}
+
+// reviveMessage 参照ConsumerSendMsgBack构造重试消息，不可见时间即为退避时间，因此不再设置延迟级别
+func (self *PopReviveService) reviveMessage(consumerGroup string, retryQueueNums, retryMaxTimes int32, msgExt *message.MessageExt) bool {
+	if retryQueueNums <= 0 {
+		return true
+	}
+
+	newTopic := stgcommon.GetRetryTopic(consumerGroup)
+	queueNums, perm := retryQueueNums, constant.PERM_WRITE|constant.PERM_READ
+	if msgExt.ReconsumeTimes >= retryMaxTimes {
+		newTopic = stgcommon.GetDLQTopic(consumerGroup)
+		queueNums, perm = DLQ_NUMS_PER_GROUP, constant.PERM_WRITE
+	}
+
+	topicConfig, err := self.brokerController.TopicConfigManager.CreateTopicInSendMessageBackMethod(newTopic, queueNums, perm, 0)
+	if topicConfig == nil || err != nil {
+		logger.Errorf("pop revive create topic %s failed", newTopic)
+		return false
+	}
+
+	if msgExt.GetProperty(message.PROPERTY_RETRY_TOPIC) == "" {
+		message.PutProperty(&msgExt.Message, message.PROPERTY_RETRY_TOPIC, msgExt.Topic)
+	}
+	message.ClearProperty(&msgExt.Message, message.PROPERTY_DELAY_TIME_LEVEL)
+
+	msgInner := new(stgstorelog.MessageExtBrokerInner)
+	msgInner.Topic = newTopic
+	msgInner.Body = msgExt.Body
+	msgInner.Flag = msgExt.Flag
+	message.SetPropertiesMap(&msgInner.Message, msgExt.Properties)
+	msgInner.PropertiesString = message.MessageProperties2String(msgExt.Properties)
+	msgInner.TagsCode = stgstorelog.TagsString2tagsCode(stgcommon.SINGLE_TAG, msgExt.GetTags())
+	msgInner.QueueId = int32(msgExt.QueueOffset % int64(queueNums))
+	msgInner.SysFlag = msgExt.SysFlag
+	msgInner.BornTimestamp = msgExt.BornTimestamp
+	msgInner.BornHost = msgExt.BornHost
+	msgInner.StoreHost = self.brokerController.GetStoreHost()
+	msgInner.ReconsumeTimes = msgExt.ReconsumeTimes + 1
+
+	originMsgId := message.GetOriginMessageId(msgExt.Message)
+	if originMsgId == "" {
+		originMsgId = msgExt.MsgId
+	}
+	message.SetOriginMessageId(&msgInner.Message, originMsgId)
+
+	putMessageResult := self.brokerController.MessageStore.PutMessage(msgInner)
+	if putMessageResult == nil || putMessageResult.PutMessageStatus != stgstorelog.PUTMESSAGE_PUT_OK {
+		logger.Errorf("pop revive put message to %s failed, msgId: %s", newTopic, msgExt.MsgId)
+		return false
+	}
+
+	self.brokerController.brokerStatsManager.IncSendBackNums(consumerGroup, msgExt.GetProperty(message.PROPERTY_RETRY_TOPIC))
+	return true
+}
+
+// PendingCheckPoints 未完成的CheckPoint数量
+// Since 2018/2/1
+func (self *PopReviveService) PendingCheckPoints() int {
+	return self.buffer.Size()
+}
@@ -50,7 +50,7 @@ func (pull *PullMessageProcessor) ProcessRequest(ctx netm.Context, request *prot
 // Author rongzhihong
 // Since 2017/9/5
 func (pull *PullMessageProcessor) ExecuteRequestWhenWakeup(ctx netm.Context, request *protocol.RemotingCommand) {
-	go func() {
+	run := func() {
 		//logger.Info("....唤醒HoldPullRequest: ExtFields:%v, Opaque:%d", request.ExtFields, request.Opaque)
 		response, err := pull.processRequest(request, ctx, false)
 		if err != nil {
@@ -72,7 +72,17 @@ func (pull *PullMessageProcessor) ExecuteRequestWhenWakeup(ctx netm.Context, req
 			format := "pullMessageHold response to %s failed. error:%s. ### request:%s, ### response:%s"
 			logger.Errorf(format, ctx.RemoteAddr().String(), err.Error(), request.ToString(), response.ToString())
 		}
-	}()
+	}
+
+	// 唤醒的请求同样提交到拉取消息协程池，协程池繁忙时丢弃，由客户端超时后重新拉取
+	executor := pull.BrokerController.pullMessageExecutor
+	if executor == nil {
+		go run()
+		return
+	}
+	if !executor.Execute(run) {
+		logger.Warnf("ExecuteRequestWhenWakeup rejected, pull message executor busy, size of queue: %d", executor.QueueSize())
+	}
 }
 
 func (pull *PullMessageProcessor) processRequest(request *protocol.RemotingCommand, ctx netm.Context, brokerAllowSuspend bool) (*protocol.RemotingCommand, error) {
@@ -186,6 +196,12 @@ func (pull *PullMessageProcessor) processRequest(request *protocol.RemotingComma
 		}
 	}
 
+	// 超过topic、消费组、客户端IP的拉取配额时拒绝，拉取到消息后再按消息数量和大小扣减配额
+	retryAfter := pull.BrokerController.QuotaManager.CheckPull(ctx, requestHeader.Topic, requestHeader.ConsumerGroup)
+	if retryAfter > 0 {
+		return rateLimitedResponse(response, retryAfter, "pull message from topic["+requestHeader.Topic+"] exceeds quota"), nil
+	}
+
 	getMessageResult := pull.BrokerController.MessageStore.GetMessage(requestHeader.ConsumerGroup, requestHeader.Topic,
 		requestHeader.QueueId, requestHeader.QueueOffset, int32(requestHeader.MaxMsgNums), subscriptionData)
 	if nil != getMessageResult {
@@ -194,8 +210,10 @@ func (pull *PullMessageProcessor) processRequest(request *protocol.RemotingComma
 		responseHeader.MinOffset = getMessageResult.MinOffset
 		responseHeader.MaxOffset = getMessageResult.MaxOffset
 
-		// 消费较慢，重定向到另外一台机器
-		if getMessageResult.SuggestPullingFromSlave {
+		if !pull.BrokerController.BrokerConfig.GetSlaveReadEnable() {
+			responseHeader.SuggestWhichBrokerId = stgcommon.MASTER_ID
+		} else if getMessageResult.SuggestPullingFromSlave {
+			// 消费较慢，重定向到另外一台机器
 			responseHeader.SuggestWhichBrokerId = subscriptionGroupConfig.WhichBrokerWhenConsumeSlowly
 		} else {
 			// 消费正常，按照订阅组配置重定向
@@ -246,6 +264,8 @@ func (pull *PullMessageProcessor) processRequest(request *protocol.RemotingComma
 			response.Code = code.PULL_RETRY_IMMEDIATELY
 		case stgstorelog.OFFSET_FOUND_NULL:
 			response.Code = code.PULL_NOT_FOUND
+		case stgstorelog.CONSUME_QUEUE_REBUILDING:
+			response.Code = code.PULL_NOT_FOUND
 		case stgstorelog.OFFSET_OVERFLOW_BADLY:
 			response.Code = code.PULL_OFFSET_MOVED
 			logger.Infof("the request offset: %d over flow badly, broker max offset: %d, consumer: %s", requestHeader.QueueOffset, getMessageResult.MaxOffset, ctx.LocalAddr().String())
@@ -259,13 +279,21 @@ func (pull *PullMessageProcessor) processRequest(request *protocol.RemotingComma
 
 		switch response.Code {
 		case code.SUCCESS:
+			pull.BrokerController.QuotaManager.ConsumePull(ctx, requestHeader.Topic, requestHeader.ConsumerGroup,
+				getMessageResult.GetMessageCount(), getMessageResult.BufferTotalSize)
+
 			// 统计
 			pull.BrokerController.brokerStatsManager.IncGroupGetNums(requestHeader.ConsumerGroup, requestHeader.Topic, getMessageResult.GetMessageCount())
 			pull.BrokerController.brokerStatsManager.IncGroupGetSize(requestHeader.ConsumerGroup, requestHeader.Topic, getMessageResult.BufferTotalSize)
 			pull.BrokerController.brokerStatsManager.IncBrokerGetNums(getMessageResult.GetMessageCount())
 
+			// 默认通过writev直接发送mmap中的消息，写入完成后才能释放
 			manyMessageTransfer := pagecache.NewManyMessageTransfer(response, getMessageResult)
-			_, err = ctx.WriteSerialObject(manyMessageTransfer)
+			if pull.BrokerController.BrokerConfig.GetTransferMsgByHeap() {
+				_, err = ctx.Write(manyMessageTransfer.Bytes())
+			} else {
+				_, err = ctx.WriteSerialObject(manyMessageTransfer)
+			}
 			if err != nil {
 				logger.Errorf("transfer many message by pagecache failed, RemoteAddr:%s, Error:%s",
 					ctx.RemoteAddr().String(), err.Error())
@@ -277,8 +305,8 @@ func (pull *PullMessageProcessor) processRequest(request *protocol.RemotingComma
 			if brokerAllowSuspend && hasSuspendFlag {
 				//logger.Infof("进入hold pull: ExtFields=%#v, Opaque=%d", request.ExtFields, request.Opaque)
 				pollingTimeMills := suspendTimeoutMillisLong
-				if !pull.BrokerController.BrokerConfig.LongPollingEnable {
-					pollingTimeMills = pull.BrokerController.BrokerConfig.ShortPollingTimeMills
+				if !pull.BrokerController.BrokerConfig.GetLongPollingEnable() {
+					pollingTimeMills = pull.BrokerController.BrokerConfig.GetShortPollingTimeMills()
 				}
 
 				suspendTimestamp := pull.BrokerController.MessageStore.Now()
@@ -289,7 +317,7 @@ func (pull *PullMessageProcessor) processRequest(request *protocol.RemotingComma
 		case code.PULL_RETRY_IMMEDIATELY:
 		case code.PULL_OFFSET_MOVED:
 			if pull.BrokerController.MessageStoreConfig.BrokerRole != config.SLAVE ||
-				pull.BrokerController.BrokerConfig.OffsetCheckInSlave {
+				pull.BrokerController.BrokerConfig.GetOffsetCheckInSlave() {
 
 				mq := message.MessageQueue{
 					Topic:      requestHeader.Topic,
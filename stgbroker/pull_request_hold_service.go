@@ -92,6 +92,19 @@ func (serv *PullRequestHoldService) checkHoldRequest() {
 	}
 }
 
+// SuspendedCount 当前挂起的长轮询拉取请求数量
+// Since 2018/1/30
+func (serv *PullRequestHoldService) SuspendedCount() int {
+	count := 0
+	for iter := serv.pullRequestTable.Iterator(); iter.HasNext(); {
+		_, value, _ := iter.Next()
+		if mpr, ok := value.(*longpolling.ManyPullRequest); ok {
+			count += mpr.Size()
+		}
+	}
+	return count
+}
+
 // notifyMessageArriving  消息到来通知
 // Author rongzhihong
 // Since 2017/9/5
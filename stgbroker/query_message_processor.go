@@ -8,6 +8,7 @@ import (
 	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/header"
 	"git.oschina.net/cloudzone/smartgo/stgnet/netm"
 	"git.oschina.net/cloudzone/smartgo/stgnet/protocol"
+	"git.oschina.net/cloudzone/smartgo/stgstorelog"
 )
 
 // QueryMessageProcessor 查询消息请求处理
@@ -48,14 +49,28 @@ func (qmp *QueryMessageProcessor) QueryMessage(ctx netm.Context, request *protoc
 	response := protocol.CreateDefaultResponseCommand(responseHeader)
 
 	requestHeader := &header.QueryMessageRequestHeader{}
-	err := response.DecodeCommandCustomHeader(requestHeader)
+	err := request.DecodeCommandCustomHeader(requestHeader)
 	if err != nil {
 		logger.Error(err)
 	}
 
 	response.Opaque = request.Opaque
-	queryMessageResult := qmp.BrokerController.MessageStore.QueryMessage(requestHeader.Topic, requestHeader.Key,
-		requestHeader.MaxNum, requestHeader.BeginTimestamp, requestHeader.EndTimestamp)
+
+	var queryMessageResult *stgstorelog.QueryMessageResult
+	if requestHeader.PropertyName != "" {
+		topicConfig := qmp.BrokerController.TopicConfigManager.SelectTopicConfig(requestHeader.Topic)
+		if !topicConfig.IsIndexedProperty(requestHeader.PropertyName) {
+			response.Code = code.SYSTEM_ERROR
+			response.Remark = fmt.Sprintf("the property %s of topic %s is not indexed", requestHeader.PropertyName, requestHeader.Topic)
+			return response, nil
+		}
+
+		queryMessageResult = qmp.BrokerController.MessageStore.QueryMessageByProperty(requestHeader.Topic, requestHeader.PropertyName,
+			requestHeader.Key, requestHeader.MaxNum, requestHeader.BeginTimestamp, requestHeader.EndTimestamp)
+	} else {
+		queryMessageResult = qmp.BrokerController.MessageStore.QueryMessage(requestHeader.Topic, requestHeader.Key,
+			requestHeader.MaxNum, requestHeader.BeginTimestamp, requestHeader.EndTimestamp)
+	}
 
 	if queryMessageResult != nil {
 		responseHeader.IndexLastUpdatePhyoffset = queryMessageResult.IndexLastUpdatePhyoffset
@@ -70,7 +85,7 @@ func (qmp *QueryMessageProcessor) QueryMessage(ctx netm.Context, request *protoc
 			if err != nil {
 				logger.Errorf("transfer query message by pagecache failed, %s", err.Error())
 			}
-			// TODO queryMessageTransfer.Release()
+			queryMessageResult.Release()
 			return nil, nil
 		}
 	}
@@ -0,0 +1,142 @@
+package stgbroker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
+	code "git.oschina.net/cloudzone/smartgo/stgcommon/protocol"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/header"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/quota"
+	"git.oschina.net/cloudzone/smartgo/stgnet/netm"
+	"git.oschina.net/cloudzone/smartgo/stgnet/protocol"
+	"github.com/pquerna/ffjson/ffjson"
+)
+
+// QuotaManager 管理topic、生产组、消费组、客户端IP的发送/拉取限流配额
+// Since 2018/1/29
+type QuotaManager struct {
+	BrokerController *BrokerController
+	QuotaConfigTable *quota.QuotaConfigTable
+	ConfigManagerExt *ConfigManagerExt
+	limiter          *quota.Limiter
+}
+
+// NewQuotaManager 创建QuotaManager
+// Since 2018/1/29
+func NewQuotaManager(brokerController *BrokerController) *QuotaManager {
+	quotaManager := new(QuotaManager)
+	quotaManager.BrokerController = brokerController
+	quotaManager.QuotaConfigTable = quota.NewQuotaConfigTable()
+	quotaManager.ConfigManagerExt = NewConfigManagerExt(quotaManager)
+	quotaManager.limiter = quota.NewLimiter(quotaManager.QuotaConfigTable)
+	return quotaManager
+}
+
+func (self *QuotaManager) Load() bool {
+	return self.ConfigManagerExt.Load()
+}
+
+func (self *QuotaManager) Encode(prettyFormat bool) string {
+	if buf, err := ffjson.Marshal(self.QuotaConfigTable); err == nil {
+		return string(buf)
+	}
+	return ""
+}
+
+func (self *QuotaManager) Decode(buf []byte) {
+	if buf == nil || len(buf) == 0 {
+		return
+	}
+	if err := json.Unmarshal(buf, self.QuotaConfigTable); err != nil {
+		logger.Errorf("QuotaManager.Decode() err: %s, buf = %s", err.Error(), string(buf))
+	}
+}
+
+func (self *QuotaManager) ConfigFilePath() string {
+	homeDir := stgcommon.GetUserHomeDir()
+	if self.BrokerController.BrokerConfig.StorePathRootDir != "" {
+		homeDir = self.BrokerController.BrokerConfig.StorePathRootDir
+	}
+	return GetQuotaConfigPath(homeDir)
+}
+
+// UpdateQuotaConfig 创建或更新配额，新配额立即生效
+// Since 2018/1/29
+func (self *QuotaManager) UpdateQuotaConfig(config *quota.QuotaConfig) error {
+	if err := config.CheckFields(); err != nil {
+		return err
+	}
+
+	old := self.QuotaConfigTable.Put(config)
+	if old != nil {
+		logger.Infof("update quota config, old: %s, new: %s", old.ToString(), config.ToString())
+	} else {
+		logger.Infof("create new quota config: %s", config.ToString())
+	}
+
+	self.QuotaConfigTable.DataVersion.NextVersion()
+	self.ConfigManagerExt.Persist()
+	return nil
+}
+
+// DeleteQuotaConfig 删除配额
+// Since 2018/1/29
+func (self *QuotaManager) DeleteQuotaConfig(dimension, name string) {
+	old := self.QuotaConfigTable.Remove(dimension, name)
+	if old == nil {
+		logger.Warnf("delete quota config failed, quota config not exist. dimension: %s, name: %s", dimension, name)
+		return
+	}
+
+	logger.Infof("delete quota config OK, quota config: %s", old.ToString())
+	self.QuotaConfigTable.DataVersion.NextVersion()
+	self.ConfigManagerExt.Persist()
+}
+
+// TryAcquireSend 校验发送配额，超过配额时返回建议的重试等待时间
+// Since 2018/1/29
+func (self *QuotaManager) TryAcquireSend(ctx netm.Context, topic, producerGroup string, bodySize int) time.Duration {
+	if !self.BrokerController.BrokerConfig.GetQuotaEnable() {
+		return 0
+	}
+	return self.limiter.TryAcquireSend(topic, producerGroup, parseClientIp(ctx), 1, int64(bodySize))
+}
+
+// CheckPull 校验拉取配额，超过配额时返回建议的重试等待时间
+// Since 2018/1/29
+func (self *QuotaManager) CheckPull(ctx netm.Context, topic, consumerGroup string) time.Duration {
+	if !self.BrokerController.BrokerConfig.GetQuotaEnable() {
+		return 0
+	}
+	return self.limiter.CheckPull(topic, consumerGroup, parseClientIp(ctx))
+}
+
+// ConsumePull 按拉取到的消息扣减拉取配额
+// Since 2018/1/29
+func (self *QuotaManager) ConsumePull(ctx netm.Context, topic, consumerGroup string, msgNums, bodySize int) {
+	if !self.BrokerController.BrokerConfig.GetQuotaEnable() {
+		return
+	}
+	self.limiter.ConsumePull(topic, consumerGroup, parseClientIp(ctx), int64(msgNums), int64(bodySize))
+}
+
+func parseClientIp(ctx netm.Context) string {
+	addr := ctx.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// rateLimitedResponse 超过配额时的响应，RateLimitedResponseHeader中为建议的重试等待时间
+func rateLimitedResponse(response *protocol.RemotingCommand, retryAfter time.Duration, remark string) *protocol.RemotingCommand {
+	retryAfterMillis := int64(retryAfter / time.Millisecond)
+	response.Code = code.RATE_LIMITED
+	response.Remark = fmt.Sprintf("%s, retry after %dms", remark, retryAfterMillis)
+	response.CustomHeader = header.NewRateLimitedResponseHeader(retryAfterMillis)
+	return response
+}
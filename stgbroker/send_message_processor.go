@@ -40,6 +40,11 @@ func (smp *SendMessageProcessor) ProcessRequest(ctx netm.Context, request *proto
 		return smp.ConsumerSendMsgBack(ctx, request), nil
 	}
 
+	// PageCache繁忙时快速失败，生产者收到SYSTEM_BUSY后更换broker重试
+	if smp.BrokerController.MessageStore.IsOSPageCacheBusy() {
+		return protocol.CreateResponseCommand(code.SYSTEM_BUSY, OS_PAGECACHE_BUSY_REMARK), nil
+	}
+
 	requestHeader := smp.abstractSendMessageProcessor.parseRequestHeader(request)
 	if requestHeader == nil {
 		return nil, nil
@@ -149,10 +154,20 @@ func (smp *SendMessageProcessor) ConsumerSendMsgBack(conn netm.Context,
 	if "" == retryTopic {
 		message.PutProperty(&msgExt.Message, message.PROPERTY_RETRY_TOPIC, msgExt.Topic)
 	}
+
+	// 过期消息不再进入重试队列和死信队列，未过期的消息带上过期时间点，重试时依然按原始Topic的存活时间过期
+	if smp.isMessageExpired(msgExt) {
+		logger.Infof("consumer send msg back, message expired and dropped, group: %s offset: %d", requestHeader.Group, requestHeader.Offset)
+		smp.BrokerController.brokerStatsManager.IncGroupGetExpired(requestHeader.Group, msgExt.GetProperty(message.PROPERTY_RETRY_TOPIC), 1)
+		response.Code = code.SUCCESS
+		response.Remark = ""
+		return response
+	}
 	msgExt.SetWaitStoreMsgOK(false)
 
 	// 客户端自动决定定时级别
 	delayLevel := requestHeader.DelayLevel
+	var deliverTime int64
 
 	// 死信消息处理
 	if msgExt.ReconsumeTimes >= subscriptionGroupConfig.RetryMaxTimes || delayLevel < 0 {
@@ -172,6 +187,19 @@ func (smp *SendMessageProcessor) ConsumerSendMsgBack(conn netm.Context,
 			response.Remark = fmt.Sprintf("topic[%s] not exist", newTopic)
 			return response
 		}
+	} else if retryPolicy := subscriptionGroupConfig.RetryPolicy; retryPolicy != nil {
+		// 订阅组配置了重试策略时忽略延迟级别，由TimerMessageService到期后投递到重试队列
+		reconsumeTimes := msgExt.ReconsumeTimes + 1
+		deliverTime = stgcommon.GetCurrentTimeMillis() + retryPolicy.NextBackoffMillis(reconsumeTimes)
+		message.ClearProperty(&msgExt.Message, message.PROPERTY_DELAY_TIME_LEVEL)
+
+		// 告知消费者本次重试仍失败时的等待时间，达到最大重试次数后不再重试
+		if reconsumeTimes < subscriptionGroupConfig.RetryMaxTimes {
+			nextBackoff := retryPolicy.NextBackoffMillis(reconsumeTimes + 1)
+			message.PutProperty(&msgExt.Message, message.PROPERTY_NEXT_RETRY_BACKOFF_MS, fmt.Sprintf("%d", nextBackoff))
+		} else {
+			message.ClearProperty(&msgExt.Message, message.PROPERTY_NEXT_RETRY_BACKOFF_MS)
+		}
 	} else {
 		if 0 == delayLevel {
 			delayLevel = 3 + msgExt.ReconsumeTimes
@@ -203,7 +231,12 @@ func (smp *SendMessageProcessor) ConsumerSendMsgBack(conn netm.Context,
 	}
 	message.SetOriginMessageId(&msgInner.Message, originMsgId)
 
-	putMessageResult := smp.BrokerController.MessageStore.PutMessage(msgInner)
+	var putMessageResult *stgstorelog.PutMessageResult
+	if deliverTime > 0 {
+		putMessageResult = smp.BrokerController.TimerMessageService.ScheduleMessage(msgInner, deliverTime)
+	} else {
+		putMessageResult = smp.BrokerController.MessageStore.PutMessage(msgInner)
+	}
 	if putMessageResult != nil {
 		switch putMessageResult.PutMessageStatus {
 		case stgstorelog.PUTMESSAGE_PUT_OK:
@@ -283,7 +316,7 @@ func (smp *SendMessageProcessor) SendMessage(ctx netm.Context, request *protocol
 		msgInner.ReconsumeTimes = requestHeader.ReconsumeTimes
 	}
 
-	if smp.BrokerController.BrokerConfig.RejectTransactionMessage {
+	if smp.BrokerController.BrokerConfig.GetRejectTransactionMessage() {
 		traFlag := msgInner.GetProperty(message.PROPERTY_TRANSACTION_PREPARED)
 		if len(traFlag) > 0 {
 			response.Code = code.NO_PERMISSION
@@ -292,6 +325,12 @@ func (smp *SendMessageProcessor) SendMessage(ctx netm.Context, request *protocol
 		}
 	}
 
+	// 超过topic、生产组、客户端IP的发送配额时拒绝，客户端等待retryAfterMillis后重试
+	retryAfter := smp.BrokerController.QuotaManager.TryAcquireSend(ctx, requestHeader.Topic, requestHeader.ProducerGroup, len(body))
+	if retryAfter > 0 {
+		return rateLimitedResponse(response, retryAfter, "send message to topic["+requestHeader.Topic+"] exceeds quota")
+	}
+
 	putMessageResult := smp.BrokerController.MessageStore.PutMessage(msgInner)
 	if putMessageResult != nil {
 		sendOK := false
@@ -318,6 +357,9 @@ func (smp *SendMessageProcessor) SendMessage(ctx netm.Context, request *protocol
 		case stgstorelog.SERVICE_NOT_AVAILABLE:
 			response.Code = code.SERVICE_NOT_AVAILABLE
 			response.Remark = "service not available now, maybe disk full, " + smp.diskUtil() + ", maybe your broker machine memory too small."
+		case stgstorelog.OS_PAGECACHE_BUSY:
+			response.Code = code.SYSTEM_BUSY
+			response.Remark = OS_PAGECACHE_BUSY_REMARK
 		case stgstorelog.PUTMESSAGE_UNKNOWN_ERROR:
 			response.Code = code.SYSTEM_ERROR
 			response.Remark = "UNKNOWN_ERROR"
@@ -337,7 +379,7 @@ func (smp *SendMessageProcessor) SendMessage(ctx netm.Context, request *protocol
 			responseHeader.QueueOffset = putMessageResult.AppendMessageResult.LogicsOffset
 
 			DoResponse(ctx, request, response)
-			if smp.BrokerController.BrokerConfig.LongPollingEnable {
+			if smp.BrokerController.BrokerConfig.GetLongPollingEnable() {
 				smp.BrokerController.PullRequestHoldService.notifyMessageArriving(
 					requestHeader.Topic, queueIdInt, putMessageResult.AppendMessageResult.LogicsOffset+1)
 			}
@@ -398,6 +440,24 @@ func (smp *SendMessageProcessor) ExecuteConsumeMessageHookAfter(context *mqtrace
 	}
 }
 
+// isMessageExpired 消息是否已过期；消息未设置过期时间点时按原始Topic的默认存活时间计算，并写入消息属性
+// Since 2018/1/24
+func (smp *SendMessageProcessor) isMessageExpired(msgExt *message.MessageExt) bool {
+	expireAt := msgExt.GetExpireAt()
+	if expireAt <= 0 {
+		originTopic := msgExt.GetProperty(message.PROPERTY_RETRY_TOPIC)
+		topicConfig := smp.BrokerController.TopicConfigManager.SelectTopicConfig(originTopic)
+		if topicConfig == nil || topicConfig.MessageTtlSeconds <= 0 {
+			return false
+		}
+
+		expireAt = msgExt.StoreTimestamp + topicConfig.MessageTtlSeconds*1000
+		msgExt.SetExpireAt(expireAt)
+	}
+
+	return expireAt <= stgcommon.GetCurrentTimeMillis()
+}
+
 // diskUtil 磁盘使用情况
 // Author rongzhihong
 // Since 2017/9/16
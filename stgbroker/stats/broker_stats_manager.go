@@ -9,14 +9,15 @@ import (
 )
 
 const (
-	TOPIC_PUT_NUMS  = "TOPIC_PUT_NUMS"
-	TOPIC_PUT_SIZE  = "TOPIC_PUT_SIZE"
-	GROUP_GET_NUMS  = "GROUP_GET_NUMS"
-	GROUP_GET_SIZE  = "GROUP_GET_SIZE"
-	SNDBCK_PUT_NUMS = "SNDBCK_PUT_NUMS"
-	BROKER_PUT_NUMS = "BROKER_PUT_NUMS"
-	BROKER_GET_NUMS = "BROKER_GET_NUMS"
-	GROUP_GET_FALL  = "GROUP_GET_FALL"
+	TOPIC_PUT_NUMS    = "TOPIC_PUT_NUMS"
+	TOPIC_PUT_SIZE    = "TOPIC_PUT_SIZE"
+	GROUP_GET_NUMS    = "GROUP_GET_NUMS"
+	GROUP_GET_SIZE    = "GROUP_GET_SIZE"
+	SNDBCK_PUT_NUMS   = "SNDBCK_PUT_NUMS"
+	BROKER_PUT_NUMS   = "BROKER_PUT_NUMS"
+	BROKER_GET_NUMS   = "BROKER_GET_NUMS"
+	GROUP_GET_FALL    = "GROUP_GET_FALL"
+	GROUP_GET_EXPIRED = "GROUP_GET_EXPIRED" // 拉取时跳过的过期消息个数
 )
 
 // BrokerStatsManager broker统计
@@ -44,6 +45,7 @@ func NewBrokerStatsManager(clusterName string) *BrokerStatsManager {
 	bs.statsTable[SNDBCK_PUT_NUMS] = stats.NewStatsItemSet(SNDBCK_PUT_NUMS)
 	bs.statsTable[BROKER_PUT_NUMS] = stats.NewStatsItemSet(BROKER_PUT_NUMS)
 	bs.statsTable[BROKER_GET_NUMS] = stats.NewStatsItemSet(BROKER_GET_NUMS)
+	bs.statsTable[GROUP_GET_EXPIRED] = stats.NewStatsItemSet(GROUP_GET_EXPIRED)
 
 	return bs
 }
@@ -88,6 +90,14 @@ func (bsm *BrokerStatsManager) GetStatsItem(statsName, statsKey string) *stats.S
 	return nil
 }
 
+// ForeachStatsItem  遍历statsName维度下的全部统计单元
+// Since 2018/1/30
+func (bsm *BrokerStatsManager) ForeachStatsItem(statsName string, fn func(statsKey string, statsItem *stats.StatsItem)) {
+	if statItemSet, ok := bsm.statsTable[statsName]; ok && statItemSet != nil {
+		statItemSet.Foreach(fn)
+	}
+}
+
 // IncTopicPutNums  Topic Put次数加1
 // Author rongzhihong
 // Since 2017/9/17
@@ -116,6 +126,12 @@ func (bsm *BrokerStatsManager) IncGroupGetSize(group, topic string, incValue int
 	bsm.statsTable[GROUP_GET_SIZE].AddValue(topic+"@"+group, int64(incValue), 1)
 }
 
+// IncGroupGetExpired  Topic@Group 拉取时跳过的过期消息个数加incValue
+// Since 2018/1/24
+func (bsm *BrokerStatsManager) IncGroupGetExpired(group, topic string, incValue int) {
+	bsm.statsTable[GROUP_GET_EXPIRED].AddValue(topic+"@"+group, int64(incValue), 1)
+}
+
 // incBrokerPutNums  broker Put消息次数加1
 // Author rongzhihong
 // Since 2017/9/17
@@ -57,7 +57,7 @@ func (subscriptionGroupManager *SubscriptionGroupManager) init() {
 // Since 2017/8/17
 func (self *SubscriptionGroupManager) FindSubscriptionGroupConfig(group string) *subscription.SubscriptionGroupConfig {
 	subscriptionGroupConfig := self.SubscriptionGroupTable.Get(group)
-	if subscriptionGroupConfig != nil || !self.BrokerController.BrokerConfig.AutoCreateSubscriptionGroup {
+	if subscriptionGroupConfig != nil || !self.BrokerController.BrokerConfig.GetAutoCreateSubscriptionGroup() {
 		return subscriptionGroupConfig
 	}
 
@@ -0,0 +1,89 @@
+package stgbroker
+
+import (
+	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/message"
+	"git.oschina.net/cloudzone/smartgo/stgstorelog"
+)
+
+// systemTopicReader 按offset顺序读取broker内部topic(POP_REVIVE_TOPIC、TIMER_TOPIC)队列0中的记录，
+// 首次读取时从group提交的消费进度开始，提交的进度由调用方按未完成记录中最小的offset计算
+// readOffset、storeTimestamp只在调用方的ticker协程中访问
+// Since 2018/2/2
+type systemTopicReader struct {
+	brokerController *BrokerController
+	group            string
+	topic            string
+	batchNums        int32 // 每批读取的记录数
+	maxReadBatch     int   // 每轮最多读取的批次，避免积压过多时长时间占用
+	readBody         bool
+	readOffset       int64
+	storeTimestamp   int64 // 最近读取记录的存储时间
+}
+
+func newSystemTopicReader(brokerController *BrokerController, group, topic string, batchNums int32, maxReadBatch int,
+	readBody bool) *systemTopicReader {
+	return &systemTopicReader{
+		brokerController: brokerController,
+		group:            group,
+		topic:            topic,
+		batchNums:        batchNums,
+		maxReadBatch:     maxReadBatch,
+		readBody:         readBody,
+		readOffset:       -1,
+	}
+}
+
+// read 从readOffset开始读取新的记录并逐条调用apply，返回是否已读到队列末尾
+func (self *systemTopicReader) read(apply func(msgExt *message.MessageExt)) bool {
+	messageStore := self.brokerController.MessageStore
+	if self.readOffset < 0 {
+		self.readOffset = self.brokerController.ConsumerOffsetManager.QueryOffset(self.group, self.topic, 0)
+		if minOffset := messageStore.GetMinOffsetInQueue(self.topic, 0); self.readOffset < minOffset {
+			self.readOffset = minOffset
+		}
+		if self.readOffset < 0 {
+			self.readOffset = 0
+		}
+	}
+
+	for i := 0; i < self.maxReadBatch; i++ {
+		result := messageStore.GetMessage(self.group, self.topic, 0, self.readOffset, self.batchNums, nil)
+		if result == nil {
+			break
+		}
+
+		if result.Status != stgstorelog.FOUND {
+			// 读取位置已被清除或越界时修正
+			if result.Status == stgstorelog.OFFSET_TOO_SMALL || result.Status == stgstorelog.OFFSET_OVERFLOW_BADLY {
+				logger.Warnf("%s offset %d moved to %d, status: %s", self.topic, self.readOffset, result.NextBeginOffset, result.Status.String())
+				self.readOffset = result.NextBeginOffset
+			}
+			result.Release()
+			break
+		}
+
+		for e := result.MessageMapedList.Front(); e != nil; e = e.Next() {
+			bufferResult, ok := e.Value.(*stgstorelog.SelectMapedBufferResult)
+			if !ok {
+				continue
+			}
+			msgExt, err := message.DecodeMessageExt(bufferResult.MappedByteBuffer.Bytes(), self.readBody, false)
+			if err != nil {
+				logger.Errorf("decode %s message failed: %s", self.topic, err.Error())
+				continue
+			}
+			self.storeTimestamp = msgExt.StoreTimestamp
+			apply(msgExt)
+		}
+		self.readOffset = result.NextBeginOffset
+		result.Release()
+	}
+
+	return self.readOffset >= messageStore.GetMaxOffsetInQueue(self.topic, 0)
+}
+
+// commit 提交读取进度，commitOffset根据readOffset返回未完成记录中最小的offset
+func (self *systemTopicReader) commit(commitOffset func(readOffset int64) int64) {
+	self.brokerController.ConsumerOffsetManager.CommitOffset(self.group, self.topic, 0, commitOffset(self.readOffset))
+}
@@ -12,7 +12,9 @@ import (
 	"git.oschina.net/cloudzone/smartgo/stgcommon/subscription"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/utils/timeutil"
 	"git.oschina.net/cloudzone/smartgo/stgnet/protocol"
+	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -33,7 +35,7 @@ func TestUpdateAndCreateTopic(t *testing.T) {
 	}
 
 	topicConfigNew := conntroller.TopicConfigManager.TopicConfigSerializeWrapper.TopicConfigTable.Get(newTopic)
-	if (topicConfigOld == nil && topicConfigNew != nil) || (*topicConfigOld == *topicConfigNew) {
+	if (topicConfigOld == nil && topicConfigNew != nil) || reflect.DeepEqual(topicConfigOld, topicConfigNew) {
 		logger.Errorf("UpdateAndCreateTopic Failure!")
 		t.Fail()
 		return
@@ -114,10 +116,14 @@ func TestUpdateBrokerConfig(t *testing.T) {
 	request := protocol.CreateRequestCommand(code.UPDATE_BROKER_CONFIG)
 	request.Body = stgcommon.Encode(allConfig)
 
-	_, err := adminProcessor.ProcessRequest(ctx, request)
+	response, err := adminProcessor.ProcessRequest(ctx, request)
 	if err != nil {
 		t.Error(err)
 	}
+	if response.Code != code.SUCCESS {
+		t.Errorf("更新broker配置失败, code: %d, remark: %s", response.Code, response.Remark)
+		return
+	}
 
 	t.Logf(" brokerName old:%s, new:%s; accessMessageInMemoryMaxRatio old:%d, new:%d", brokerName, bc.BrokerConfig.BrokerName, accessMessageInMemoryMaxRatio, bc.MessageStoreConfig.AccessMessageInMemoryMaxRatio)
 
@@ -127,9 +133,9 @@ func TestUpdateBrokerConfig(t *testing.T) {
 		return
 	}
 
-	if bc.BrokerConfig.BrokerName == brokerName { // 40 == 50
-		t.Fail()
-		t.Errorf("更新BrokerConfig.BrokerName失败, old: %d, new:%d", brokerName, bc.BrokerConfig.BrokerName)
+	// brokerName需要重启broker后生效
+	if bc.BrokerConfig.BrokerName != brokerName || !strings.Contains(response.Remark, "brokerName") {
+		t.Errorf("BrokerConfig.BrokerName不应立即生效, old: %s, new:%s, remark: %s", brokerName, bc.BrokerConfig.BrokerName, response.Remark)
 	}
 }
 
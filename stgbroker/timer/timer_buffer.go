@@ -0,0 +1,173 @@
+package timer
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+)
+
+// TimerTask 到期待投递的定时消息
+// Since 2018/2/2
+type TimerTask struct {
+	QueueOffset     int64 // 在TIMER_TOPIC中的offset
+	CommitLogOffset int64 // 用于查询消息内容
+	DeliverTime     int64 // 投递时间点（毫秒）
+}
+
+// deliverHeap 按投递时间排序的小顶堆
+type deliverHeap []*TimerTask
+
+func (h deliverHeap) Len() int            { return len(h) }
+func (h deliverHeap) Less(i, j int) bool  { return h[i].DeliverTime < h[j].DeliverTime }
+func (h deliverHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *deliverHeap) Push(x interface{}) { *h = append(*h, x.(*TimerTask)) }
+func (h *deliverHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	task := old[n-1]
+	*h = old[:n-1]
+	return task
+}
+
+// offsetHeap 未投递offset的小顶堆，已投递的offset延迟删除
+type offsetHeap []int64
+
+func (h offsetHeap) Len() int            { return len(h) }
+func (h offsetHeap) Less(i, j int) bool  { return h[i] < h[j] }
+func (h offsetHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *offsetHeap) Push(x interface{}) { *h = append(*h, x.(int64)) }
+func (h *offsetHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	offset := old[n-1]
+	*h = old[:n-1]
+	return offset
+}
+
+// DeliveredWatermark 已投递位置：queueOffset小于DeliveredOffset且投递时间不晚于DeliveredTime的定时消息均已投递
+// 与读取进度一起持久化，重启后从提交的进度重新读取时跳过这些消息，避免重复投递整个退避窗口内的消息
+// Since 2018/2/2
+type DeliveredWatermark struct {
+	DeliveredTime   int64 `json:"deliveredTime"`
+	DeliveredOffset int64 `json:"deliveredOffset"`
+}
+
+// TimerBuffer 按TIMER_TOPIC的读取顺序缓存未到期的定时消息，只保存offset及投递时间，消息内容到期后再查询
+// Since 2018/2/2
+type TimerBuffer struct {
+	deliverQueue deliverHeap
+	offsetQueue  offsetHeap
+	pending      map[int64]bool // queueOffset -> 未投递
+	watermark    DeliveredWatermark
+	lock         sync.Mutex
+}
+
+// NewTimerBuffer 初始化
+// Since 2018/2/2
+func NewTimerBuffer() *TimerBuffer {
+	return &TimerBuffer{
+		deliverQueue: make(deliverHeap, 0),
+		offsetQueue:  make(offsetHeap, 0),
+		pending:      make(map[int64]bool),
+	}
+}
+
+// Add 缓存定时消息，queueOffset重复时忽略
+// Since 2018/2/2
+func (self *TimerBuffer) Add(task *TimerTask) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.pending[task.QueueOffset] {
+		return
+	}
+	self.pending[task.QueueOffset] = true
+	heap.Push(&self.deliverQueue, task)
+	heap.Push(&self.offsetQueue, task.QueueOffset)
+}
+
+// PollDue 取出投递时间已到的定时消息，按queueOffset从小到大排列
+// Since 2018/2/2
+func (self *TimerBuffer) PollDue(now int64) []*TimerTask {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	var tasks []*TimerTask
+	for self.deliverQueue.Len() > 0 && self.deliverQueue[0].DeliverTime <= now {
+		task := heap.Pop(&self.deliverQueue).(*TimerTask)
+		delete(self.pending, task.QueueOffset)
+		tasks = append(tasks, task)
+	}
+
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].QueueOffset < tasks[j].QueueOffset })
+	return tasks
+}
+
+// CommitOffset TIMER_TOPIC可以提交的消费进度，即未投递消息中最小的queueOffset，没有时为readOffset
+// Since 2018/2/2
+func (self *TimerBuffer) CommitOffset(readOffset int64) int64 {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	for self.offsetQueue.Len() > 0 && !self.pending[self.offsetQueue[0]] {
+		heap.Pop(&self.offsetQueue)
+	}
+	if self.offsetQueue.Len() > 0 && self.offsetQueue[0] < readOffset {
+		return self.offsetQueue[0]
+	}
+	return readOffset
+}
+
+// MarkDelivered 读取到readOffset且投递时间不晚于now的消息均已投递时推进已投递位置，返回是否推进
+// 调用方需保证readOffset之前的消息都已读取
+// Since 2018/2/2
+func (self *TimerBuffer) MarkDelivered(readOffset, now int64) bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.deliverQueue.Len() > 0 && self.deliverQueue[0].DeliverTime <= now {
+		return false
+	}
+	if readOffset < self.watermark.DeliveredOffset || now < self.watermark.DeliveredTime {
+		return false
+	}
+
+	self.watermark = DeliveredWatermark{DeliveredTime: now, DeliveredOffset: readOffset}
+	return true
+}
+
+// IsDelivered 重新读取的消息是否已投递
+// Since 2018/2/2
+func (self *TimerBuffer) IsDelivered(queueOffset, deliverTime int64) bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	return queueOffset < self.watermark.DeliveredOffset && deliverTime <= self.watermark.DeliveredTime
+}
+
+// Watermark 已投递位置，用于持久化
+// Since 2018/2/2
+func (self *TimerBuffer) Watermark() DeliveredWatermark {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	return self.watermark
+}
+
+// SetWatermark 启动时恢复持久化的已投递位置
+// Since 2018/2/2
+func (self *TimerBuffer) SetWatermark(watermark DeliveredWatermark) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.watermark = watermark
+}
+
+// Size 未投递的定时消息数量
+// Since 2018/2/2
+func (self *TimerBuffer) Size() int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	return len(self.pending)
+}
@@ -0,0 +1,86 @@
+package timer
+
+import (
+	"testing"
+)
+
+func TestTimerBufferPollDue(t *testing.T) {
+	buffer := NewTimerBuffer()
+	buffer.Add(&TimerTask{QueueOffset: 0, DeliverTime: 3000})
+	buffer.Add(&TimerTask{QueueOffset: 1, DeliverTime: 1000})
+	buffer.Add(&TimerTask{QueueOffset: 2, DeliverTime: 2000})
+	buffer.Add(&TimerTask{QueueOffset: 2, DeliverTime: 2000})
+
+	if size := buffer.Size(); size != 3 {
+		t.Fatalf("size %d, expect 3", size)
+	}
+
+	tasks := buffer.PollDue(2000)
+	if len(tasks) != 2 || tasks[0].QueueOffset != 1 || tasks[1].QueueOffset != 2 {
+		t.Fatalf("due tasks %v, expect offsets [1 2]", tasks)
+	}
+	if tasks = buffer.PollDue(2999); len(tasks) != 0 {
+		t.Fatalf("due tasks %d, expect 0", len(tasks))
+	}
+}
+
+func TestTimerBufferCommitOffset(t *testing.T) {
+	buffer := NewTimerBuffer()
+	buffer.Add(&TimerTask{QueueOffset: 5, DeliverTime: 1000})
+	buffer.Add(&TimerTask{QueueOffset: 6, DeliverTime: 3000})
+	buffer.Add(&TimerTask{QueueOffset: 7, DeliverTime: 2000})
+
+	if offset := buffer.CommitOffset(8); offset != 5 {
+		t.Fatalf("commit offset %d, expect 5", offset)
+	}
+
+	buffer.PollDue(2000)
+	if offset := buffer.CommitOffset(8); offset != 6 {
+		t.Fatalf("commit offset %d, expect 6", offset)
+	}
+
+	// 投递失败后重新缓存
+	buffer.Add(&TimerTask{QueueOffset: 5, DeliverTime: 1000})
+	if offset := buffer.CommitOffset(8); offset != 5 {
+		t.Fatalf("commit offset %d, expect 5", offset)
+	}
+
+	buffer.PollDue(3000)
+	if offset := buffer.CommitOffset(8); offset != 8 {
+		t.Fatalf("commit offset %d, expect 8", offset)
+	}
+}
+
+func TestTimerBufferDeliveredWatermark(t *testing.T) {
+	buffer := NewTimerBuffer()
+	buffer.Add(&TimerTask{QueueOffset: 0, DeliverTime: 1000})
+	buffer.Add(&TimerTask{QueueOffset: 1, DeliverTime: 5000})
+
+	// 还有到期未投递的消息时不推进
+	if buffer.MarkDelivered(2, 2000) {
+		t.Fatal("watermark should not move with due task pending")
+	}
+
+	buffer.PollDue(2000)
+	if !buffer.MarkDelivered(2, 2000) {
+		t.Fatal("watermark should move after due tasks delivered")
+	}
+
+	// 重启后重新读取，只跳过已投递位置之前且已到期的消息
+	restarted := NewTimerBuffer()
+	restarted.SetWatermark(buffer.Watermark())
+	cases := []struct {
+		queueOffset int64
+		deliverTime int64
+		delivered   bool
+	}{
+		{0, 1000, true},
+		{1, 5000, false},
+		{2, 1500, false}, // 已投递位置之后写入的消息
+	}
+	for _, c := range cases {
+		if restarted.IsDelivered(c.queueOffset, c.deliverTime) != c.delivered {
+			t.Errorf("offset %d deliverTime %d: expect delivered %t", c.queueOffset, c.deliverTime, c.delivered)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package stgbroker
+
+import (
+	"strconv"
+	"time"
+
+	"git.oschina.net/cloudzone/smartgo/stgbroker/timer"
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/message"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/utils/timeutil"
+	"git.oschina.net/cloudzone/smartgo/stgstorelog"
+	"git.oschina.net/cloudzone/smartgo/stgstorelog/config"
+	"github.com/pquerna/ffjson/ffjson"
+)
+
+const (
+	timerDeliverInterval = 200 * time.Millisecond
+	timerReadBatchNums   = 32
+	timerMaxReadBatch    = 100 // 每轮最多读取的批次，避免积压过多时长时间占用
+)
+
+// TimerMessageService 定时消息以完整消息的形式存储在TIMER_TOPIC中，投递时间、真实topic及queueId记录在消息属性里，
+// 按顺序读取后只在内存中保存offset及投递时间，到期时查询消息内容投递到真实topic
+// 读取进度按未投递消息中最小的offset提交，重启后从该位置重新读取，
+// 已投递位置(timerCheckPoint.json)与读取进度一起持久化，重新读取时跳过已投递的消息
+// Since 2018/2/2
+type TimerMessageService struct {
+	brokerController *BrokerController
+	buffer           *timer.TimerBuffer
+	reader           *systemTopicReader
+	ticker           *timeutil.Ticker
+	configManagerExt *ConfigManagerExt
+}
+
+// NewTimerMessageService 初始化
+// Since 2018/2/2
+func NewTimerMessageService(brokerController *BrokerController) *TimerMessageService {
+	service := &TimerMessageService{
+		brokerController: brokerController,
+		buffer:           timer.NewTimerBuffer(),
+		reader: newSystemTopicReader(brokerController, stgcommon.TIMER_GROUP, stgcommon.TIMER_TOPIC,
+			timerReadBatchNums, timerMaxReadBatch, false),
+	}
+	service.ticker = timeutil.NewTicker(false, timerDeliverInterval, timerDeliverInterval, func() {
+		service.deliver()
+	})
+	service.configManagerExt = NewConfigManagerExt(service)
+	return service
+}
+
+// Load 加载已投递位置
+// Since 2018/2/2
+func (self *TimerMessageService) Load() bool {
+	return self.configManagerExt.Load()
+}
+
+// Persist 持久化已投递位置，与消费进度一起定时写入
+// Since 2018/2/2
+func (self *TimerMessageService) Persist() {
+	self.configManagerExt.Persist()
+}
+
+func (self *TimerMessageService) Encode(prettyFormat bool) string {
+	if buf, err := ffjson.Marshal(self.buffer.Watermark()); err == nil {
+		return string(buf)
+	}
+	return ""
+}
+
+func (self *TimerMessageService) Decode(buf []byte) {
+	if len(buf) == 0 {
+		return
+	}
+
+	watermark := timer.DeliveredWatermark{}
+	if err := ffjson.Unmarshal(buf, &watermark); err != nil {
+		logger.Errorf("TimerMessageService.Decode() err: %s, buf = %s", err.Error(), string(buf))
+		return
+	}
+	self.buffer.SetWatermark(watermark)
+}
+
+func (self *TimerMessageService) ConfigFilePath() string {
+	homeDir := stgcommon.GetUserHomeDir()
+	if self.brokerController.BrokerConfig.StorePathRootDir != "" {
+		homeDir = self.brokerController.BrokerConfig.StorePathRootDir
+	}
+	return GetTimerCheckPointPath(homeDir)
+}
+
+// Start 启动
+// Since 2018/2/2
+func (self *TimerMessageService) Start() {
+	self.ticker.Start()
+	logger.Info("TimerMessageService start successful")
+}
+
+// Shutdown 停止
+// Since 2018/2/2
+func (self *TimerMessageService) Shutdown() {
+	self.ticker.Stop()
+	logger.Info("TimerMessageService shutdown successful")
+}
+
+// ScheduleMessage 将消息写入TIMER_TOPIC，deliverTime到期后投递到msgInner原来的topic及queueId
+// Since 2018/2/2
+func (self *TimerMessageService) ScheduleMessage(msgInner *stgstorelog.MessageExtBrokerInner, deliverTime int64) *stgstorelog.PutMessageResult {
+	message.PutProperty(&msgInner.Message, message.PROPERTY_REAL_TOPIC, msgInner.Topic)
+	message.PutProperty(&msgInner.Message, message.PROPERTY_REAL_QUEUE_ID, strconv.Itoa(int(msgInner.QueueId)))
+	message.PutProperty(&msgInner.Message, message.PROPERTY_TIMER_DELIVER_MS, strconv.FormatInt(deliverTime, 10))
+	msgInner.PropertiesString = message.MessageProperties2String(msgInner.Properties)
+	msgInner.Topic = stgcommon.TIMER_TOPIC
+	msgInner.QueueId = 0
+
+	return self.brokerController.MessageStore.PutMessage(msgInner)
+}
+
+// deliver 读取新的定时消息，投递已到期的消息，并提交读取进度
+func (self *TimerMessageService) deliver() {
+	// Slave不投递，切换为Master后从提交的进度继续
+	if self.brokerController.MessageStoreConfig.BrokerRole == config.SLAVE {
+		return
+	}
+
+	caughtUp := self.reader.read(self.addTask)
+
+	now := timeutil.CurrentTimeMillis()
+	for _, task := range self.buffer.PollDue(now) {
+		if !self.deliverMessage(task) {
+			// 下一轮重新投递
+			self.buffer.Add(task)
+		}
+	}
+
+	// 读到队列末尾且到期的消息全部投递成功时，推进已投递位置
+	if caughtUp {
+		self.buffer.MarkDelivered(self.reader.readOffset, now)
+	}
+	self.reader.commit(self.buffer.CommitOffset)
+}
+
+func (self *TimerMessageService) addTask(msgExt *message.MessageExt) {
+	deliverTime, err := strconv.ParseInt(msgExt.GetProperty(message.PROPERTY_TIMER_DELIVER_MS), 10, 64)
+	if err != nil {
+		// 属性缺失时立即投递
+		deliverTime = 0
+	}
+	if self.buffer.IsDelivered(msgExt.QueueOffset, deliverTime) {
+		return
+	}
+	self.buffer.Add(&timer.TimerTask{QueueOffset: msgExt.QueueOffset, CommitLogOffset: msgExt.CommitLogOffset, DeliverTime: deliverTime})
+}
+
+// deliverMessage 将到期的消息投递到真实topic，返回false时需要重新投递
+func (self *TimerMessageService) deliverMessage(task *timer.TimerTask) bool {
+	msgExt := self.brokerController.MessageStore.LookMessageByOffset(task.CommitLogOffset)
+	if msgExt == nil {
+		logger.Warnf("timer look message failed, message may be deleted. offset: %d", task.QueueOffset)
+		return true
+	}
+
+	realTopic := msgExt.GetProperty(message.PROPERTY_REAL_TOPIC)
+	realQueueId, err := strconv.Atoi(msgExt.GetProperty(message.PROPERTY_REAL_QUEUE_ID))
+	if realTopic == "" || err != nil {
+		logger.Warnf("timer message dropped, real topic or queueId missing. msgId: %s", msgExt.MsgId)
+		return true
+	}
+	message.ClearProperty(&msgExt.Message, message.PROPERTY_REAL_TOPIC)
+	message.ClearProperty(&msgExt.Message, message.PROPERTY_REAL_QUEUE_ID)
+	message.ClearProperty(&msgExt.Message, message.PROPERTY_TIMER_DELIVER_MS)
+
+	msgInner := new(stgstorelog.MessageExtBrokerInner)
+	msgInner.Topic = realTopic
+	msgInner.Body = msgExt.Body
+	msgInner.Flag = msgExt.Flag
+	message.SetPropertiesMap(&msgInner.Message, msgExt.Properties)
+	msgInner.PropertiesString = message.MessageProperties2String(msgExt.Properties)
+	msgInner.TagsCode = stgstorelog.TagsString2tagsCode(stgcommon.SINGLE_TAG, msgExt.GetTags())
+	msgInner.QueueId = int32(realQueueId)
+	msgInner.SysFlag = msgExt.SysFlag
+	msgInner.BornTimestamp = msgExt.BornTimestamp
+	msgInner.BornHost = msgExt.BornHost
+	msgInner.StoreHost = self.brokerController.GetStoreHost()
+	msgInner.ReconsumeTimes = msgExt.ReconsumeTimes
+
+	putMessageResult := self.brokerController.MessageStore.PutMessage(msgInner)
+	if putMessageResult == nil || putMessageResult.PutMessageStatus != stgstorelog.PUTMESSAGE_PUT_OK {
+		logger.Errorf("timer put message to %s failed, msgId: %s", realTopic, msgExt.MsgId)
+		return false
+	}
+	return true
+}
+
+// PendingMessages 未到期的定时消息数量
+// Since 2018/2/2
+func (self *TimerMessageService) PendingMessages() int {
+	return self.buffer.Size()
+}
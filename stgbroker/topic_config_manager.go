@@ -51,14 +51,14 @@ func (self *TopicConfigManager) init() {
 
 	// DEFAULT_TOPIC
 	{
-		autoCreateTopicEnable := self.BrokerController.BrokerConfig.AutoCreateTopicEnable
+		autoCreateTopicEnable := self.BrokerController.BrokerConfig.GetAutoCreateTopicEnable()
 		logger.Infof("self.BrokerController.BrokerConfig.AutoCreateTopicEnable=%t", autoCreateTopicEnable)
 		if autoCreateTopicEnable {
 			topicName := stgcommon.DEFAULT_TOPIC
 			topicConfig := stgcommon.NewTopicConfig(topicName)
 			self.SystemTopicList.Add(topicConfig)
-			topicConfig.ReadQueueNums = self.BrokerController.BrokerConfig.DefaultTopicQueueNums
-			topicConfig.WriteQueueNums = self.BrokerController.BrokerConfig.DefaultTopicQueueNums
+			topicConfig.ReadQueueNums = self.BrokerController.BrokerConfig.GetDefaultTopicQueueNums()
+			topicConfig.WriteQueueNums = self.BrokerController.BrokerConfig.GetDefaultTopicQueueNums()
 			topicConfig.Perm = constant.PERM_INHERIT | constant.PERM_READ | constant.PERM_WRITE
 			//logger.Infof("topicConfigManager init: %s", topicConfig.ToString())
 			self.TopicConfigSerializeWrapper.TopicConfigTable.Put(topicConfig.TopicName, topicConfig)
@@ -116,6 +116,26 @@ func (self *TopicConfigManager) init() {
 		//logger.Infof("topicConfigManager init: %s", topicConfig.ToString())
 		self.TopicConfigSerializeWrapper.TopicConfigTable.Put(topicConfig.TopicName, topicConfig)
 	}
+
+	// POP_REVIVE_TOPIC
+	{
+		topicName := stgcommon.POP_REVIVE_TOPIC
+		topicConfig := stgcommon.NewTopicConfig(topicName)
+		self.SystemTopicList.Add(topicConfig)
+		topicConfig.ReadQueueNums = 1
+		topicConfig.WriteQueueNums = 1
+		self.TopicConfigSerializeWrapper.TopicConfigTable.Put(topicConfig.TopicName, topicConfig)
+	}
+
+	// TIMER_TOPIC
+	{
+		topicName := stgcommon.TIMER_TOPIC
+		topicConfig := stgcommon.NewTopicConfig(topicName)
+		self.SystemTopicList.Add(topicConfig)
+		topicConfig.ReadQueueNums = 1
+		topicConfig.WriteQueueNums = 1
+		self.TopicConfigSerializeWrapper.TopicConfigTable.Put(topicConfig.TopicName, topicConfig)
+	}
 }
 
 func (tcm *TopicConfigManager) isSystemTopic(topic string) bool {
@@ -158,7 +178,7 @@ func (tcm *TopicConfigManager) CreateTopicInSendMessageMethod(topic, defaultTopi
 
 	// 是否新创建topic
 	createNew := false
-	autoCreateTopicEnable := tcm.BrokerController.BrokerConfig.AutoCreateTopicEnable
+	autoCreateTopicEnable := tcm.BrokerController.BrokerConfig.GetAutoCreateTopicEnable()
 
 	// 如果通过topic获取不到topic或者服务器不允许自动创建 则直接返回
 	if tc == nil && !autoCreateTopicEnable {
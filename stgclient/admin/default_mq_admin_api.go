@@ -102,7 +102,7 @@ func (impl *DefaultMQAdminExtImpl) start() error {
 		}
 
 		// 初始化MQClientInstance
-		impl.mqClientInstance = process.GetInstance().GetAndCreateMQClientInstance(impl.clientConfig)
+		impl.mqClientInstance = process.GetInstance().GetAndCreateMQClientInstance(impl.clientConfig, impl.rpcHook)
 
 		// 注册admin管理控制器
 		registerOK := impl.registerAdminExt(adminExtGroup, impl)
@@ -11,8 +11,10 @@ import (
 	namesrvUtils "git.oschina.net/cloudzone/smartgo/stgcommon/namesrv"
 	code "git.oschina.net/cloudzone/smartgo/stgcommon/protocol"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/body"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/header"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/heartbeat"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/route"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/quota"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/subscription"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/utils"
 	set "github.com/deckarep/golang-set"
@@ -25,7 +27,13 @@ const (
 
 // 更新Broker配置
 func (impl *DefaultMQAdminExtImpl) UpdateBrokerConfig(brokerAddr string, properties map[string]interface{}) error {
-	// TODO
+	restartRequired, err := impl.mqClientInstance.MQClientAPIImpl.UpdateBrokerConfig(brokerAddr, properties, timeoutMillis)
+	if err != nil {
+		return err
+	}
+	if len(restartRequired) > 0 {
+		logger.Warnf("broker %s config %v take effect after restart", brokerAddr, restartRequired)
+	}
 	return nil
 }
 
@@ -671,6 +679,72 @@ func (impl *DefaultMQAdminExtImpl) ViewBrokerStatsData(brokerAddr, statsName, st
 	return impl.mqClientInstance.MQClientAPIImpl.ViewBrokerStatsData(brokerAddr, statsName, statsKey, timeoutMillis)
 }
 
+// 故障处理时强制指定或清除Broker存储模式
+func (impl *DefaultMQAdminExtImpl) UpdateStoreMode(brokerAddr, mode string, force bool) (*body.KVTable, error) {
+	kvTable, err := impl.mqClientInstance.MQClientAPIImpl.UpdateStoreMode(brokerAddr, mode, force, timeoutMillis)
+	if err != nil {
+		logger.Errorf("update store mode on target broker[%s] err: %s", brokerAddr, err.Error())
+		return nil, err
+	}
+	logger.Infof("update store mode on target broker[%s], mode: %s force: %t", brokerAddr, mode, force)
+	return kvTable, nil
+}
+
+// 触发Broker根据CommitLog重建逻辑队列及索引
+func (impl *DefaultMQAdminExtImpl) RebuildConsumeQueue(brokerAddr, topic string, queueId int32, rebuildIndex, dryRun bool) error {
+	err := impl.mqClientInstance.MQClientAPIImpl.RebuildConsumeQueue(brokerAddr, topic, queueId, rebuildIndex, dryRun, timeoutMillis)
+	if err != nil {
+		logger.Errorf("rebuild consume queue on target broker[%s] err: %s", brokerAddr, err.Error())
+		return err
+	}
+	logger.Infof("rebuild consume queue on target broker[%s], topic: %s queueId: %d rebuildIndex: %t dryRun: %t",
+		brokerAddr, topic, queueId, rebuildIndex, dryRun)
+	return nil
+}
+
+// 在线生成Broker存储快照，快照需复制全部存储文件并计算校验值，timeoutMillis需按存储大小设置
+func (impl *DefaultMQAdminExtImpl) CreateStoreSnapshot(brokerAddr, snapshotDir string, timeoutMillis int64) (*body.KVTable, error) {
+	kvTable, err := impl.mqClientInstance.MQClientAPIImpl.CreateStoreSnapshot(brokerAddr, snapshotDir, timeoutMillis)
+	if err != nil {
+		logger.Errorf("create store snapshot on target broker[%s] err: %s", brokerAddr, err.Error())
+		return nil, err
+	}
+	logger.Infof("create store snapshot on target broker[%s], snapshotDir: %s", brokerAddr, snapshotDir)
+	return kvTable, nil
+}
+
+// 创建或更新Broker限流配额
+func (impl *DefaultMQAdminExtImpl) UpdateAndCreateQuota(brokerAddr string, config *quota.QuotaConfig) error {
+	err := impl.mqClientInstance.MQClientAPIImpl.UpdateAndCreateQuota(brokerAddr, config, timeoutMillis)
+	if err != nil {
+		logger.Errorf("update quota on target broker[%s] err: %s", brokerAddr, err.Error())
+		return err
+	}
+	logger.Infof("update quota on target broker[%s], %s", brokerAddr, config.ToString())
+	return nil
+}
+
+// 删除Broker限流配额
+func (impl *DefaultMQAdminExtImpl) DeleteQuota(brokerAddr, dimension, name string) error {
+	err := impl.mqClientInstance.MQClientAPIImpl.DeleteQuota(brokerAddr, dimension, name, timeoutMillis)
+	if err != nil {
+		logger.Errorf("delete quota on target broker[%s] err: %s", brokerAddr, err.Error())
+		return err
+	}
+	logger.Infof("delete quota on target broker[%s], dimension: %s name: %s", brokerAddr, dimension, name)
+	return nil
+}
+
+// 查询Broker所有限流配额
+func (impl *DefaultMQAdminExtImpl) GetAllQuotaConfig(brokerAddr string) ([]*quota.QuotaConfig, error) {
+	return impl.mqClientInstance.MQClientAPIImpl.GetAllQuotaConfig(brokerAddr, timeoutMillis)
+}
+
+// 查询Broker计算的消费延迟
+func (impl *DefaultMQAdminExtImpl) GetConsumerLag(brokerAddr, consumerGroup, topic string) (*body.ConsumerLagTable, error) {
+	return impl.mqClientInstance.MQClientAPIImpl.GetConsumerLag(brokerAddr, consumerGroup, topic, timeoutMillis)
+}
+
 // 创建Topic
 // key 消息队列已存在的topic
 // newTopic 需新建的topic
@@ -700,13 +774,50 @@ func (impl *DefaultMQAdminExtImpl) ViewMessage(msgId string) (*message.MessageEx
 }
 
 // 搜索消息
-// topic  topic名称
-// key    消息key关键字[业务系统基于此字段唯一标识消息]
-// maxNum 最大搜索条数
-// begin  开始查询消息的时间戳
-// end    结束查询消息的时间戳
-func (impl *DefaultMQAdminExtImpl) QueryMessage(topic, key string, maxNum int, begin, end int64) (*admin.QueryResult, error) {
-	return nil, nil
+// topic        topic名称
+// propertyName 消息属性名称[需在topic配置中声明为索引属性]，为空时按消息key搜索
+// key          消息key关键字[业务系统基于此字段唯一标识消息]，propertyName非空时为属性值
+// maxNum       最大搜索条数
+// begin        开始查询消息的时间戳
+// end          结束查询消息的时间戳
+func (impl *DefaultMQAdminExtImpl) QueryMessage(topic, propertyName, key string, maxNum int, begin, end int64) (*admin.QueryResult, error) {
+	topicRouteData, err := impl.ExamineTopicRouteInfo(topic)
+	if err != nil {
+		return nil, err
+	}
+	if topicRouteData == nil || topicRouteData.BrokerDatas == nil {
+		return nil, fmt.Errorf("topic[%s] route info not exist", topic)
+	}
+
+	var indexLastUpdateTimestamp int64
+	messageList := make([]*message.MessageExt, 0)
+	for _, bd := range topicRouteData.BrokerDatas {
+		brokerAddr := bd.SelectBrokerAddr()
+		if brokerAddr == "" {
+			continue
+		}
+
+		requestHeader := &header.QueryMessageRequestHeader{
+			Topic:          topic,
+			Key:            key,
+			MaxNum:         int32(maxNum),
+			BeginTimestamp: begin,
+			EndTimestamp:   end,
+			PropertyName:   propertyName,
+		}
+		big_timeoutMillis := int64(15 * 1000) // 查询索引会产生IO操作，可能会耗时较长，所以超时时间设置为15s
+		queryResult, err := impl.mqClientInstance.MQClientAPIImpl.QueryMessage(brokerAddr, requestHeader, big_timeoutMillis)
+		if err != nil {
+			return nil, err
+		}
+
+		if queryResult.IndexLastUpdateTimestamp > indexLastUpdateTimestamp {
+			indexLastUpdateTimestamp = queryResult.IndexLastUpdateTimestamp
+		}
+		messageList = append(messageList, queryResult.MessageList...)
+	}
+
+	return admin.NewQueryResult(indexLastUpdateTimestamp, messageList), nil
 }
 
 // 查询较早的存储消息
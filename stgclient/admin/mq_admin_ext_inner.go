@@ -7,6 +7,7 @@ import (
 	"git.oschina.net/cloudzone/smartgo/stgcommon/message/track"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/body"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/route"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/quota"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/subscription"
 	set "github.com/deckarep/golang-set"
 )
@@ -158,6 +159,38 @@ type MQAdminExtInner interface {
 	// 服务器统计数据输出
 	ViewBrokerStatsData(brokerAddr, statsName, statsKey string) (*body.BrokerStatsData, error)
 
+	// 故障处理时强制指定或清除Broker存储模式
+	// mode  存储模式：NORMAL、READ_ONLY、INDEX_DEGRADED、DISK_FULL
+	// force true强制进入该模式，false清除该模式
+	// return 变更后的存储模式信息
+	UpdateStoreMode(brokerAddr, mode string, force bool) (*body.KVTable, error)
+
+	// 触发Broker根据CommitLog重建逻辑队列及索引，重建进度通过FetchBrokerRuntimeStats查询
+	// topic        为空表示全部Topic
+	// queueId      小于0表示Topic的全部队列
+	// rebuildIndex 是否重建索引文件，只能在重建全部Topic时使用
+	// dryRun       只统计差异，不修改文件
+	RebuildConsumeQueue(brokerAddr, topic string, queueId int32, rebuildIndex, dryRun bool) error
+
+	// 在线生成Broker存储快照，快照生成在Broker本地，通过恢复工具校验后恢复到其他节点
+	// snapshotDir Broker本地快照目录，必须不存在或为空目录
+	// return 快照信息
+	CreateStoreSnapshot(brokerAddr, snapshotDir string, timeoutMillis int64) (*body.KVTable, error)
+
+	// 创建或更新Broker限流配额，超过配额的发送、拉取请求返回RATE_LIMITED
+	// config 限流维度(topic、producerGroup、consumerGroup、clientIp)、名称及每秒消息数、字节数
+	UpdateAndCreateQuota(brokerAddr string, config *quota.QuotaConfig) error
+
+	// 删除Broker限流配额
+	DeleteQuota(brokerAddr, dimension, name string) error
+
+	// 查询Broker所有限流配额
+	GetAllQuotaConfig(brokerAddr string) ([]*quota.QuotaConfig, error)
+
+	// 查询Broker计算的消费延迟，包括落后的消息数及下一条未消费消息的存储时间距今的毫秒数
+	// consumerGroup、topic为空时不过滤
+	GetConsumerLag(brokerAddr, consumerGroup, topic string) (*body.ConsumerLagTable, error)
+
 	// 创建指定Topic
 	CreateCustomTopic(brokerAddr string, topicConfig *stgcommon.TopicConfig) error
 
@@ -165,12 +198,13 @@ type MQAdminExtInner interface {
 	ViewMessage(msgId string) (*message.MessageExt, error)
 
 	// 搜索消息
-	// topic  topic名称
-	// key    消息key关键字[业务系统基于此字段唯一标识消息]
-	// maxNum 最大搜索条数
-	// begin  开始查询消息的时间戳
-	// end    结束查询消息的时间戳
-	QueryMessage(topic, key string, maxNum int, begin, end int64) (*admin.QueryResult, error)
+	// topic        topic名称
+	// propertyName 消息属性名称[需在topic配置中声明为索引属性]，为空时按消息key搜索
+	// key          消息key关键字[业务系统基于此字段唯一标识消息]，propertyName非空时为属性值
+	// maxNum       最大搜索条数
+	// begin        开始查询消息的时间戳
+	// end          结束查询消息的时间戳
+	QueryMessage(topic, propertyName, key string, maxNum int, begin, end int64) (*admin.QueryResult, error)
 
 	// 查询较早的存储消息
 	EarliestMsgStoreTime(mq *message.MessageQueue) (int64, error)
@@ -8,6 +8,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"git.oschina.net/cloudzone/smartgo/stgnet/netm"
 )
 
 // 发送状态枚举
@@ -21,6 +23,7 @@ type ClientConfig struct {
 	PollNameServerInterval        int
 	HeartbeatBrokerInterval       int
 	PersistConsumerOffsetInterval int
+	TlsConfig                     *netm.TlsConfig // 连接namesrv、broker使用的TLS配置，默认读取SMARTGO_TLS_*环境变量
 }
 
 func NewClientConfig(namesrvAddr string) *ClientConfig {
@@ -36,6 +39,7 @@ func NewClientConfig(namesrvAddr string) *ClientConfig {
 		PollNameServerInterval:        1000 * 30,
 		HeartbeatBrokerInterval:       1000 * 30,
 		PersistConsumerOffsetInterval: 1000 * 5,
+		TlsConfig:                     netm.NewTlsConfigFromEnv(),
 	}
 	return clientConfig
 }
@@ -81,7 +85,8 @@ func (client *ClientConfig) CloneClientConfig() *ClientConfig {
 		ClientCallbackExecutorThreads: client.ClientCallbackExecutorThreads,
 		PollNameServerInterval:        client.PollNameServerInterval,
 		HeartbeatBrokerInterval:       client.HeartbeatBrokerInterval,
-		PersistConsumerOffsetInterval: client.PersistConsumerOffsetInterval}
+		PersistConsumerOffsetInterval: client.PersistConsumerOffsetInterval,
+		TlsConfig:                     client.TlsConfig}
 }
 
 func (client *ClientConfig) ResetClientConfig(cc *ClientConfig) {
@@ -92,6 +97,7 @@ func (client *ClientConfig) ResetClientConfig(cc *ClientConfig) {
 	client.PollNameServerInterval = cc.PollNameServerInterval
 	client.HeartbeatBrokerInterval = cc.HeartbeatBrokerInterval
 	client.PersistConsumerOffsetInterval = cc.PersistConsumerOffsetInterval
+	client.TlsConfig = cc.TlsConfig
 }
 
 func hashCode(s string) int64 {
@@ -1,8 +1,10 @@
 package consumer
 
 import (
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/message"
 	"math"
+	"strconv"
 )
 
 // ConsumeConcurrentlyContext: 普通消息消费上下文
@@ -14,8 +16,26 @@ type ConsumeConcurrentlyContext struct {
 	// 消费失败延迟消费级别
 	DelayLevelWhenNextConsume int
 	AckIndex                  int
+	// 第几次投递，从1开始，批量消费时取第一条消息
+	DeliveryAttempt           int32
+	// 本次消费失败时下一次重试的时间点（毫秒），订阅组未配置重试策略或不再重试时为0
+	NextRetryTimestamp        int64
 }
 
 func NewConsumeConcurrentlyContext(mq *message.MessageQueue) *ConsumeConcurrentlyContext {
-	return &ConsumeConcurrentlyContext{mq,0,math.MaxInt32}
+	return &ConsumeConcurrentlyContext{MessageQueue: mq, DelayLevelWhenNextConsume: 0, AckIndex: math.MaxInt32, DeliveryAttempt: 1}
+}
+
+// ResetRetryInfo 根据待消费消息设置投递次数及下一次重试时间
+// Since: 2018/2/2
+func (context *ConsumeConcurrentlyContext) ResetRetryInfo(msgs []*message.MessageExt) {
+	if len(msgs) == 0 {
+		return
+	}
+
+	context.DeliveryAttempt = msgs[0].ReconsumeTimes + 1
+	context.NextRetryTimestamp = 0
+	if backoff, err := strconv.ParseInt(msgs[0].GetProperty(message.PROPERTY_NEXT_RETRY_BACKOFF_MS), 10, 64); err == nil {
+		context.NextRetryTimestamp = stgcommon.GetCurrentTimeMillis() + backoff
+	}
 }
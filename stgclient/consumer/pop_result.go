@@ -0,0 +1,53 @@
+package consumer
+
+import "git.oschina.net/cloudzone/smartgo/stgcommon/message"
+
+// PopStatus POP拉取消息状态
+// Since: 2018/2/1
+type PopStatus int
+
+const (
+	// Founded
+	POP_FOUND PopStatus = iota
+	// No new message can be pop
+	POP_NO_NEW_MSG
+	// Exceed the broker pull quota, retry later
+	POP_RATE_LIMITED
+)
+
+func (status PopStatus) String() string {
+	switch status {
+	case POP_FOUND:
+		return "POP_FOUND"
+	case POP_NO_NEW_MSG:
+		return "POP_NO_NEW_MSG"
+	case POP_RATE_LIMITED:
+		return "POP_RATE_LIMITED"
+	default:
+		return "Unknow"
+	}
+}
+
+// PopMessageExt POP拉取的消息，Ack、修改不可见时间时使用BrokerName、ReceiptTopic、QueueId、QueueOffset及PopTime
+// Since: 2018/2/1
+type PopMessageExt struct {
+	*message.MessageExt
+	BrokerName    string
+	ReceiptTopic  string // 消息实际所在的topic，从重试队列拉取时为重试topic
+	PopTime       int64
+	InvisibleTime int64 // 毫秒
+}
+
+// NextVisibleTime 未Ack时消息重新可见的时间点
+// Since: 2018/2/1
+func (msg *PopMessageExt) NextVisibleTime() int64 {
+	return msg.PopTime + msg.InvisibleTime
+}
+
+// PopResult POP拉取结果
+// Since: 2018/2/1
+type PopResult struct {
+	PopStatus        PopStatus
+	MsgFoundList     []*PopMessageExt
+	RetryAfterMillis int64 // POP_RATE_LIMITED时broker建议的重试等待时间
+}
@@ -14,6 +14,8 @@ const (
 	NO_MATCHED_MSG
 	// Illegal offset，may be too big or too small
 	OFFSET_ILLEGAL
+	// Exceed the broker pull quota, retry later
+	RATE_LIMITED
 )
 
 func (status PullStatus) String() string {
@@ -26,6 +28,8 @@ func (status PullStatus) String() string {
 		return "NO_MATCHED_MSG"
 	case OFFSET_ILLEGAL:
 		return "OFFSET_ILLEGAL"
+	case RATE_LIMITED:
+		return "RATE_LIMITED"
 	default:
 		return "Unknow"
 	}
@@ -50,6 +50,7 @@ func (consume *consumeRequest) run() {
 	//	}
 	//}
 	consume.ConsumeMessageConcurrentlyService.resetRetryTopic(consume.msgs)
+	context.ResetRetryInfo(consume.msgs)
 	status := msgListener.ConsumeMessage(consume.msgs, context)
 	// 用于客户端返回不正常处理
 	if status != listener.CONSUME_SUCCESS && status != listener.RECONSUME_LATER {
@@ -196,6 +197,7 @@ func (service *ConsumeMessageConcurrentlyService) ConsumeMessageDirectly(msg *me
 	context := consumer.NewConsumeConcurrentlyContext(mq)
 
 	service.resetRetryTopic(msgs)
+	context.ResetRetryInfo(msgs)
 
 	beginTime := stgcommon.GetCurrentTimeMillis()
 	status := int(service.messageListener.ConsumeMessage(msgs, context))
@@ -4,6 +4,7 @@ import (
 	"git.oschina.net/cloudzone/smartgo/stgclient"
 	"git.oschina.net/cloudzone/smartgo/stgcommon"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/message"
+	"git.oschina.net/cloudzone/smartgo/stgnet/remoting"
 )
 
 // 默认发送
@@ -24,7 +25,8 @@ type DefaultMQProducer struct {
 	ClientConfig                     *stgclient.ClientConfig
 }
 
-func NewDefaultMQProducer(producerGroup string) *DefaultMQProducer {
+// NewDefaultMQProducer 创建生产者，rpcHook用于请求签名等扩展
+func NewDefaultMQProducer(producerGroup string, rpcHook ...remoting.RPCHook) *DefaultMQProducer {
 	defaultMQProducer := &DefaultMQProducer{
 		ProducerGroup:                    producerGroup,
 		CreateTopicKey:                   stgcommon.DEFAULT_TOPIC,
@@ -37,6 +39,9 @@ func NewDefaultMQProducer(producerGroup string) *DefaultMQProducer {
 		UnitMode:                         false,
 		ClientConfig:                     stgclient.NewClientConfig("")}
 	defaultMQProducer.DefaultMQProducerImpl = NewDefaultMQProducerImpl(defaultMQProducer)
+	if len(rpcHook) > 0 {
+		defaultMQProducer.DefaultMQProducerImpl.rpcHook = rpcHook[0]
+	}
 	return defaultMQProducer
 }
 
@@ -9,6 +9,7 @@ import (
 	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/header"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/sync"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/sysflag"
+	"git.oschina.net/cloudzone/smartgo/stgnet/remoting"
 	set "github.com/deckarep/golang-set"
 	"strconv"
 	"strings"
@@ -24,6 +25,7 @@ type DefaultMQProducerImpl struct {
 	TopicPublishInfoTable *sync.Map
 	ServiceState          stgcommon.ServiceState
 	MQClientFactory       *MQClientInstance
+	rpcHook               remoting.RPCHook
 	// topic *TopicPublishInfo
 }
 
@@ -51,7 +53,7 @@ func (defaultMQProducerImpl *DefaultMQProducerImpl) StartFlag(startFactory bool)
 			defaultMQProducerImpl.DefaultMQProducer.ClientConfig.ChangeInstanceNameToPID()
 		}
 		// 初始化MQClientInstance
-		defaultMQProducerImpl.MQClientFactory = GetInstance().GetAndCreateMQClientInstance(defaultMQProducerImpl.DefaultMQProducer.ClientConfig)
+		defaultMQProducerImpl.MQClientFactory = GetInstance().GetAndCreateMQClientInstance(defaultMQProducerImpl.DefaultMQProducer.ClientConfig, defaultMQProducerImpl.rpcHook)
 		// 注册producer
 		defaultMQProducerImpl.MQClientFactory.RegisterProducer(defaultMQProducerImpl.DefaultMQProducer.ProducerGroup, defaultMQProducerImpl)
 		// 保存topic信息
@@ -142,6 +144,7 @@ func (defaultMQProducerImpl *DefaultMQProducerImpl) sendDefaultImpl(msg *message
 		timesTotal := 1 + defaultMQProducerImpl.DefaultMQProducer.RetryTimesWhenSendFailed
 		times := 0
 		var mq *message.MessageQueue
+		var lastErr error
 		for ; times < int(timesTotal) && (endTimestamp-beginTimestamp) < maxTimeout; times++ {
 			var lastBrokerName string
 			if mq != nil {
@@ -151,10 +154,16 @@ func (defaultMQProducerImpl *DefaultMQProducerImpl) sendDefaultImpl(msg *message
 			if tmpMQ != nil {
 				mq = tmpMQ
 				sendResult, err := defaultMQProducerImpl.sendKernelImpl(msg, mq, communicationMode, sendCallback, timeout)
+				endTimestamp = time.Now().Unix() * 1000
 				if err != nil {
+					// broker繁忙时同步发送更换broker重试
+					if _, ok := err.(*BrokerBusyError); ok && communicationMode == SYNC {
+						logger.Warnf("send message to %s failed, retry another broker: %s", mq.BrokerName, err.Error())
+						lastErr = err
+						continue
+					}
 					return nil, err
 				}
-				endTimestamp = time.Now().Unix() * 1000
 				switch communicationMode {
 				case ASYNC:
 					return nil, err
@@ -170,6 +179,9 @@ func (defaultMQProducerImpl *DefaultMQProducerImpl) sendDefaultImpl(msg *message
 				break
 			}
 		}
+		if lastErr != nil {
+			return nil, lastErr
+		}
 	}
 	return nil, errors.New("sendDefaultImpl error topicPublishInfo is nil or messageQueueList length is zero")
 }
@@ -7,6 +7,7 @@ import (
 	"git.oschina.net/cloudzone/smartgo/stgclient/consumer/store"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/message"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/heartbeat"
+	"git.oschina.net/cloudzone/smartgo/stgnet/remoting"
 	set "github.com/deckarep/golang-set"
 )
 
@@ -31,7 +32,7 @@ type DefaultMQPullConsumer struct {
 	clientConfig                     *stgclient.ClientConfig                // the client config
 }
 
-func NewDefaultMQPullConsumer(consumerGroup string) *DefaultMQPullConsumer {
+func NewDefaultMQPullConsumer(consumerGroup string, rpcHook ...remoting.RPCHook) *DefaultMQPullConsumer {
 	pullConsumer := &DefaultMQPullConsumer{clientConfig: stgclient.NewClientConfig("")}
 	pullConsumer.brokerSuspendMaxTimeMillis = 1000 * 20
 	pullConsumer.consumerTimeoutMillisWhenSuspend = 1000 * 30
@@ -41,6 +42,9 @@ func NewDefaultMQPullConsumer(consumerGroup string) *DefaultMQPullConsumer {
 	pullConsumer.registerTopics = set.NewSet()
 	pullConsumer.allocateMessageQueueStrategy = rebalance.AllocateMessageQueueAveragely{}
 	pullConsumer.defaultMQPullConsumerImpl = NewDefaultMQPullConsumerImpl(pullConsumer)
+	if len(rpcHook) > 0 {
+		pullConsumer.defaultMQPullConsumerImpl.rpcHook = rpcHook[0]
+	}
 	return pullConsumer
 }
 
@@ -64,3 +68,15 @@ func (pullConsumer *DefaultMQPullConsumer) FetchSubscribeMessageQueues(topic str
 func (pullConsumer *DefaultMQPullConsumer) Pull(mq *message.MessageQueue, subExpression string, offset int64, maxNums int) (*consumer.PullResult, error) {
 	return pullConsumer.defaultMQPullConsumerImpl.pull(mq, subExpression, offset, maxNums)
 }
+
+// PullBlockIfNotFound 拉取消息，队列中没有新消息时由broker挂起请求，直到有新消息或挂起超时
+// Since: 2018/2/5
+func (pullConsumer *DefaultMQPullConsumer) PullBlockIfNotFound(mq *message.MessageQueue, subExpression string, offset int64, maxNums int) (*consumer.PullResult, error) {
+	return pullConsumer.defaultMQPullConsumerImpl.pullBlockIfNotFound(mq, subExpression, offset, maxNums)
+}
+
+// ConnectBrokerByUser 固定从brokerId对应的broker拉取消息，需要在Start之后调用
+// Since: 2018/2/5
+func (pullConsumer *DefaultMQPullConsumer) ConnectBrokerByUser(brokerId int) {
+	pullConsumer.defaultMQPullConsumerImpl.connectBrokerByUser(brokerId)
+}
@@ -13,6 +13,7 @@ import (
 	"git.oschina.net/cloudzone/smartgo/stgclient/consumer"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/sysflag"
 	"strings"
+	"git.oschina.net/cloudzone/smartgo/stgnet/remoting"
 )
 // DefaultMQPullConsumerImpl: 拉取下线实现
 // Author: yintongqiang
@@ -26,6 +27,7 @@ type DefaultMQPullConsumerImpl struct {
 	OffsetStore            store.OffsetStore
 	RebalanceImpl          RebalanceImpl
 	consumerStartTimestamp int64
+	rpcHook                remoting.RPCHook
 }
 
 func NewDefaultMQPullConsumerImpl(defaultMQPullConsumer *DefaultMQPullConsumer) *DefaultMQPullConsumerImpl {
@@ -67,7 +69,7 @@ func (pullImpl*DefaultMQPullConsumerImpl)Start() {
 		if pullImpl.defaultMQPullConsumer.messageModel == heartbeat.CLUSTERING {
 			pullImpl.defaultMQPullConsumer.clientConfig.ChangeInstanceNameToPID()
 		}
-		pullImpl.mQClientFactory = GetInstance().GetAndCreateMQClientInstance(pullImpl.defaultMQPullConsumer.clientConfig)
+		pullImpl.mQClientFactory = GetInstance().GetAndCreateMQClientInstance(pullImpl.defaultMQPullConsumer.clientConfig, pullImpl.rpcHook)
 		var pullReImpl *RebalancePullImpl = pullImpl.RebalanceImpl.(*RebalancePullImpl)
 		pullReImpl.ConsumerGroup = pullImpl.defaultMQPullConsumer.consumerGroup
 		pullReImpl.MessageModel = pullImpl.defaultMQPullConsumer.messageModel
@@ -206,6 +208,19 @@ func (pullImpl*DefaultMQPullConsumerImpl)pull(mq *message.MessageQueue, subExpre
 	return pullImpl.pullSyncImpl(mq, subExpression, offset, maxNums, false, pullImpl.defaultMQPullConsumer.consumerPullTimeoutMillis)
 }
 
+// pullBlockIfNotFound 拉取消息，没有新消息时在broker挂起等待
+// Since: 2018/2/5
+func (pullImpl *DefaultMQPullConsumerImpl) pullBlockIfNotFound(mq *message.MessageQueue, subExpression string, offset int64, maxNums int) (*consumer.PullResult, error) {
+	return pullImpl.pullSyncImpl(mq, subExpression, offset, maxNums, true, pullImpl.defaultMQPullConsumer.consumerTimeoutMillisWhenSuspend)
+}
+
+// connectBrokerByUser 固定从brokerId对应的broker拉取消息，不再按broker建议切换
+// Since: 2018/2/5
+func (pullImpl *DefaultMQPullConsumerImpl) connectBrokerByUser(brokerId int) {
+	pullImpl.makeSureStateOK()
+	pullImpl.pullAPIWrapper.SetConnectBrokerByUser(true, brokerId)
+}
+
 // 同步拉取消息
 func (pullImpl*DefaultMQPullConsumerImpl)pullSyncImpl(mq *message.MessageQueue, subExpression string, offset int64, maxNums int, block bool, timeout int) (*consumer.PullResult,error) {
 	pullImpl.makeSureStateOK()
@@ -224,8 +239,11 @@ func (pullImpl*DefaultMQPullConsumerImpl)pullSyncImpl(mq *message.MessageQueue,
 	} else {
 		timeoutMillis = timeout
 	}
-	pullResultExt := pullImpl.pullAPIWrapper.PullKernelImpl(mq, subData.SubString, 0, offset, maxNums, sysFlag, 0,
+	pullResultExt, err := pullImpl.pullAPIWrapper.PullKernelImpl(mq, subData.SubString, 0, offset, maxNums, sysFlag, 0,
 		pullImpl.defaultMQPullConsumer.brokerSuspendMaxTimeMillis, timeoutMillis, SYNC, nil)
+	if err != nil {
+		return nil, err
+	}
 	if pullResultExt!=nil {
 		return pullImpl.pullAPIWrapper.processPullResult(mq, pullResultExt, subData).PullResult,nil
 	}
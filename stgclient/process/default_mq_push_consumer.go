@@ -6,6 +6,7 @@ import (
 	"git.oschina.net/cloudzone/smartgo/stgclient/consumer/rebalance"
 	"git.oschina.net/cloudzone/smartgo/stgclient/consumer/store"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/heartbeat"
+	"git.oschina.net/cloudzone/smartgo/stgnet/remoting"
 )
 
 // DefaultMQPushConsumer: push消费
@@ -58,7 +59,7 @@ type DefaultMQPushConsumer struct {
 }
 
 // 创建push消费结构体
-func NewDefaultMQPushConsumer(consumerGroup string) *DefaultMQPushConsumer {
+func NewDefaultMQPushConsumer(consumerGroup string, rpcHook ...remoting.RPCHook) *DefaultMQPushConsumer {
 	pushConsumer := &DefaultMQPushConsumer{clientConfig: stgclient.NewClientConfig("")}
 	pushConsumer.consumerGroup = consumerGroup
 	pushConsumer.messageModel = heartbeat.CLUSTERING
@@ -71,6 +72,9 @@ func NewDefaultMQPushConsumer(consumerGroup string) *DefaultMQPushConsumer {
 	pushConsumer.consumeConcurrentlyMaxSpan = 2000
 	pushConsumer.allocateMessageQueueStrategy = rebalance.AllocateMessageQueueAveragely{}
 	pushConsumer.defaultMQPushConsumerImpl = NewDefaultMQPushConsumerImpl(pushConsumer)
+	if len(rpcHook) > 0 {
+		pushConsumer.defaultMQPushConsumerImpl.rpcHook = rpcHook[0]
+	}
 	return pushConsumer
 }
 
@@ -94,6 +98,13 @@ func (pushConsumer *DefaultMQPushConsumer) Subscribe(topic string, subExpression
 	pushConsumer.defaultMQPushConsumerImpl.subscribe(topic, subExpression)
 }
 
+// SubscribeFilterClass 以类过滤模式订阅topic，由broker对应的Filter Server执行filterSource过滤后再投递给消费者，
+// filterSource为过滤表达式，例如：TAGS = 'TagA' AND amount > 100，语法见expression.Expression
+// Since: 2018/2/5
+func (pushConsumer *DefaultMQPushConsumer) SubscribeFilterClass(topic, filterClassName, filterSource string) error {
+	return pushConsumer.defaultMQPushConsumerImpl.subscribeFilterClass(topic, filterClassName, filterSource)
+}
+
 // 注册监听器
 func (pushConsumer *DefaultMQPushConsumer) RegisterMessageListener(messageListener listener.MessageListener) {
 	pushConsumer.messageListener = messageListener
@@ -12,10 +12,12 @@ import (
 	"git.oschina.net/cloudzone/smartgo/stgclient/consumer/store"
 	"git.oschina.net/cloudzone/smartgo/stgcommon"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/filter"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/filter/expression"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/message"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/heartbeat"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/sysflag"
+	"git.oschina.net/cloudzone/smartgo/stgnet/remoting"
 	set "github.com/deckarep/golang-set"
 )
 
@@ -41,6 +43,7 @@ type DefaultMQPushConsumerImpl struct {
 	ConsumerTimeoutMillisWhenSuspend  int
 	flowControlTimes1                 int64
 	flowControlTimes2                 int64
+	rpcHook                           remoting.RPCHook
 }
 
 func NewDefaultMQPushConsumerImpl(defaultMQPushConsumer *DefaultMQPushConsumer) *DefaultMQPushConsumerImpl {
@@ -111,12 +114,12 @@ func (impl *DefaultMQPushConsumerImpl) pullMessage(pullRequest *consumer.PullReq
 	var subExpression string
 	var classFilter bool = false
 	sd, _ := impl.rebalanceImpl.(*RebalancePushImpl).rebalanceImplExt.SubscriptionInner.Get(pullRequest.MessageQueue.Topic)
-	// todo class filter
 	if sd != nil {
 		subExpression = sd.(*heartbeat.SubscriptionData).SubString
+		classFilter = sd.(*heartbeat.SubscriptionData).ClassFilterMode
 	}
 	sysFlag := sysflag.BuildSysFlag(commitOffsetEnable, true, !strings.EqualFold(subExpression, ""), classFilter)
-	impl.pullAPIWrapper.PullKernelImpl(pullRequest.MessageQueue,
+	_, err := impl.pullAPIWrapper.PullKernelImpl(pullRequest.MessageQueue,
 		subExpression,
 		subData.(*heartbeat.SubscriptionData).SubVersion,
 		pullRequest.NextOffset,
@@ -127,6 +130,10 @@ func (impl *DefaultMQPushConsumerImpl) pullMessage(pullRequest *consumer.PullReq
 		impl.ConsumerTimeoutMillisWhenSuspend,
 		ASYNC,
 		pullCallBack)
+	if err != nil {
+		logger.Errorf("pullKernelImpl exception: %s", err.Error())
+		impl.ExecutePullRequestLater(pullRequest, impl.PullTimeDelayMillsWhenException)
+	}
 }
 
 type PullCallBackImpl struct {
@@ -172,6 +179,9 @@ func (backImpl *PullCallBackImpl) OnSuccess(pullResultExt *PullResultExt) {
 		backImpl.NextOffset = pullResult.NextBeginOffset
 		backImpl.DefaultMQPushConsumerImpl.correctTagsOffset(backImpl.PullRequest)
 		backImpl.DefaultMQPushConsumerImpl.ExecutePullRequestImmediately(backImpl.PullRequest)
+	case consumer.RATE_LIMITED:
+		logger.Warnf("pull message from %v rate limited, retry after %dms", backImpl.MessageQueue, pullResultExt.retryAfterMillis)
+		backImpl.DefaultMQPushConsumerImpl.ExecutePullRequestLater(backImpl.PullRequest, int(pullResultExt.retryAfterMillis))
 	case consumer.OFFSET_ILLEGAL:
 		backImpl.NextOffset = pullResult.NextBeginOffset
 		backImpl.ProcessQueue.Dropped = true
@@ -186,6 +196,17 @@ func (backImpl *PullCallBackImpl) OnSuccess(pullResultExt *PullResultExt) {
 
 }
 
+// OnException 拉取失败（网络异常、broker返回错误码等）时延迟重新拉取，
+// 只有连接失败、发送失败、等待响应超时才认为master不可用而改从slave拉取，broker返回的错误码说明master仍然可用
+// Since: 2018/2/5
+func (backImpl *PullCallBackImpl) OnException(err error) {
+	logger.Warnf("execute the pull request exception, %v %s", backImpl.MessageQueue, err.Error())
+	if _, ok := err.(*BrokerUnreachableError); ok {
+		backImpl.pullAPIWrapper.pullFromSlaveWhenMasterUnavailable(backImpl.MessageQueue)
+	}
+	backImpl.DefaultMQPushConsumerImpl.ExecutePullRequestLater(backImpl.PullRequest, backImpl.DefaultMQPushConsumerImpl.PullTimeDelayMillsWhenException)
+}
+
 func (pushConsumerImpl *DefaultMQPushConsumerImpl) correctTagsOffset(pullRequest *consumer.PullRequest) {
 	if pullRequest.ProcessQueue.MsgCount == 0 {
 		pushConsumerImpl.OffsetStore.UpdateOffset(pullRequest.MessageQueue, pullRequest.NextOffset, true)
@@ -202,6 +223,32 @@ func (impl *DefaultMQPushConsumerImpl) subscribe(topic string, subExpression str
 	}
 }
 
+// subscribeFilterClass 类过滤模式订阅，过滤逻辑在心跳后上传到Filter Server
+// Since: 2018/2/5
+func (impl *DefaultMQPushConsumerImpl) subscribeFilterClass(topic, filterClassName, filterSource string) error {
+	if strings.TrimSpace(filterClassName) == "" {
+		return errors.New("filter class name is blank")
+	}
+	if _, err := expression.Compile(filterSource); err != nil {
+		return err
+	}
+
+	subscriptionData := &heartbeat.SubscriptionData{
+		Topic:             topic,
+		SubString:         filterClassName,
+		TagsSet:           set.NewSet(),
+		CodeSet:           set.NewSet(),
+		ClassFilterMode:   true,
+		FilterClassSource: filterSource,
+	}
+	var pushImpl *RebalancePushImpl = impl.rebalanceImpl.(*RebalancePushImpl)
+	pushImpl.rebalanceImplExt.SubscriptionInner.Put(topic, subscriptionData)
+	if impl.mQClientFactory != nil {
+		impl.mQClientFactory.SendHeartbeatToAllBrokerWithLock()
+	}
+	return nil
+}
+
 // 注册监听器
 func (pushConsumerImpl *DefaultMQPushConsumerImpl) registerMessageListener(messageListener listener.MessageListener) {
 	pushConsumerImpl.messageListenerInner = messageListener
@@ -219,7 +266,7 @@ func (pushConsumerImpl *DefaultMQPushConsumerImpl) Start() {
 		if pushConsumerImpl.defaultMQPushConsumer.messageModel == heartbeat.CLUSTERING {
 			pushConsumerImpl.defaultMQPushConsumer.clientConfig.ChangeInstanceNameToPID()
 		}
-		pushConsumerImpl.mQClientFactory = GetInstance().GetAndCreateMQClientInstance(pushConsumerImpl.defaultMQPushConsumer.clientConfig)
+		pushConsumerImpl.mQClientFactory = GetInstance().GetAndCreateMQClientInstance(pushConsumerImpl.defaultMQPushConsumer.clientConfig, pushConsumerImpl.rpcHook)
 
 		var pushReImpl *RebalancePushImpl = pushConsumerImpl.rebalanceImpl.(*RebalancePushImpl)
 		pushReImpl.rebalanceImplExt.ConsumerGroup = pushConsumerImpl.defaultMQPushConsumer.consumerGroup
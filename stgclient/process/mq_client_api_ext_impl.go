@@ -3,6 +3,7 @@ package process
 import (
 	"fmt"
 	"git.oschina.net/cloudzone/smartgo/stgclient"
+	"git.oschina.net/cloudzone/smartgo/stgclient/consumer"
 	"git.oschina.net/cloudzone/smartgo/stgcommon"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/admin"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
@@ -10,7 +11,9 @@ import (
 	code "git.oschina.net/cloudzone/smartgo/stgcommon/protocol"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/body"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/header"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/header/filtersrv"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/header/namesrv"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/quota"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/utils"
 	"git.oschina.net/cloudzone/smartgo/stgnet/protocol"
 	set "github.com/deckarep/golang-set"
@@ -55,6 +58,48 @@ func (impl MQClientAPIImpl) ViewMessage(storeHost string, physicOffset uint64, t
 	return messageExt, nil
 }
 
+// QueryMessage 按消息Key或Topic声明的索引属性查询消息，requestHeader.PropertyName为空时按Key查询
+// Since: 2018/1/12
+func (impl MQClientAPIImpl) QueryMessage(brokerAddr string, requestHeader *header.QueryMessageRequestHeader, timeoutMills int64) (*admin.QueryResult, error) {
+	if !stgcommon.IsEmpty(impl.ProjectGroupPrefix) {
+		requestHeader.Topic = stgclient.BuildWithProjectGroup(requestHeader.Topic, impl.ProjectGroupPrefix)
+	}
+
+	request := protocol.CreateRequestCommand(code.QUERY_MESSAGE, requestHeader)
+	response, err := impl.DefalutRemotingClient.InvokeSync(brokerAddr, request, timeoutMills)
+	if err != nil {
+		return nil, err
+	}
+	if response == nil {
+		return nil, fmt.Errorf("QueryMessage response is nil")
+	}
+	if response.Code == code.QUERY_NOT_FOUND {
+		return admin.NewQueryResult(0, make([]*message.MessageExt, 0)), nil
+	}
+	if response.Code != code.SUCCESS {
+		logger.Errorf("QueryMessage failed. %s", response.ToString())
+		return nil, fmt.Errorf("%d, %s", response.Code, response.Remark)
+	}
+
+	responseHeader := &header.QueryMessageResponseHeader{}
+	err = response.DecodeCommandCustomHeader(responseHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	messageExts, err := message.DecodesMessageExt(response.Body, true)
+	if err != nil {
+		return nil, err
+	}
+	if !stgcommon.IsEmpty(impl.ProjectGroupPrefix) {
+		for _, messageExt := range messageExts {
+			messageExt.Topic = stgclient.ClearProjectGroup(messageExt.Topic, impl.ProjectGroupPrefix)
+		}
+	}
+
+	return admin.NewQueryResult(responseHeader.IndexLastUpdateTimestamp, messageExts), nil
+}
+
 // CreateCustomTopic 创建指定Topic
 // Author: tianyuliang
 // Since: 2017/11/1
@@ -622,6 +667,350 @@ func (impl *MQClientAPIImpl) ViewBrokerStatsData(brokerAddr, statsName, statsKey
 	return brokerStatsData, nil
 }
 
+// UpdateStoreMode 强制指定或清除Broker存储模式，返回变更后的存储模式信息
+// Since: 2018/1/18
+func (impl *MQClientAPIImpl) UpdateStoreMode(brokerAddr, mode string, force bool, timeoutMillis int64) (*body.KVTable, error) {
+	requestHeader := header.NewUpdateStoreModeRequestHeader(mode, force)
+	request := protocol.CreateRequestCommand(code.UPDATE_STORE_MODE, requestHeader)
+	response, err := impl.DefalutRemotingClient.InvokeSync(brokerAddr, request, timeoutMillis)
+	if err != nil {
+		return nil, err
+	}
+	if response == nil {
+		return nil, fmt.Errorf("UpdateStoreMode response is nil")
+	}
+	if response.Code != code.SUCCESS {
+		logger.Errorf("UpdateStoreMode failed. %s", response.ToString())
+		return nil, fmt.Errorf("%d, %s", response.Code, response.Remark)
+	}
+
+	kvTable := new(body.KVTable)
+	err = kvTable.CustomDecode(response.Body, kvTable)
+	return kvTable, err
+}
+
+// RebuildConsumeQueue 触发Broker根据CommitLog重建逻辑队列及索引，重建异步执行
+// Since: 2018/1/19
+func (impl *MQClientAPIImpl) RebuildConsumeQueue(brokerAddr, topic string, queueId int32, rebuildIndex, dryRun bool, timeoutMillis int64) error {
+	requestHeader := header.NewRebuildConsumeQueueRequestHeader(topic, queueId, rebuildIndex, dryRun)
+	request := protocol.CreateRequestCommand(code.REBUILD_CONSUME_QUEUE, requestHeader)
+	response, err := impl.DefalutRemotingClient.InvokeSync(brokerAddr, request, timeoutMillis)
+	if err != nil {
+		return err
+	}
+	if response == nil {
+		return fmt.Errorf("RebuildConsumeQueue response is nil")
+	}
+	if response.Code != code.SUCCESS {
+		logger.Errorf("RebuildConsumeQueue failed. %s", response.ToString())
+		return fmt.Errorf("%d, %s", response.Code, response.Remark)
+	}
+	return nil
+}
+
+// CreateStoreSnapshot 在线生成Broker存储快照，返回快照信息
+// Since: 2018/1/22
+func (impl *MQClientAPIImpl) CreateStoreSnapshot(brokerAddr, snapshotDir string, timeoutMillis int64) (*body.KVTable, error) {
+	requestHeader := header.NewCreateStoreSnapshotRequestHeader(snapshotDir)
+	request := protocol.CreateRequestCommand(code.CREATE_STORE_SNAPSHOT, requestHeader)
+	response, err := impl.DefalutRemotingClient.InvokeSync(brokerAddr, request, timeoutMillis)
+	if err != nil {
+		return nil, err
+	}
+	if response == nil {
+		return nil, fmt.Errorf("CreateStoreSnapshot response is nil")
+	}
+	if response.Code != code.SUCCESS {
+		logger.Errorf("CreateStoreSnapshot failed. %s", response.ToString())
+		return nil, fmt.Errorf("%d, %s", response.Code, response.Remark)
+	}
+
+	kvTable := new(body.KVTable)
+	err = kvTable.CustomDecode(response.Body, kvTable)
+	return kvTable, err
+}
+
+// RegisterMessageFilterClass 向Filter Server注册订阅组的过滤逻辑
+// Since: 2018/2/5
+func (impl *MQClientAPIImpl) RegisterMessageFilterClass(addr, consumerGroup, topic, className string, classCRC int32,
+	classBody []byte, timeoutMillis int64) error {
+	requestHeader := filtersrv.NewRegisterMessageFilterClassRequestHeader(consumerGroup, topic, className, classCRC)
+	request := protocol.CreateRequestCommand(code.REGISTER_MESSAGE_FILTER_CLASS, requestHeader)
+	request.Body = classBody
+	response, err := impl.DefalutRemotingClient.InvokeSync(addr, request, timeoutMillis)
+	if err != nil {
+		return err
+	}
+	if response == nil {
+		return fmt.Errorf("RegisterMessageFilterClass response is nil")
+	}
+	if response.Code != code.SUCCESS {
+		logger.Errorf("RegisterMessageFilterClass failed. %s", response.ToString())
+		return fmt.Errorf("%d, %s", response.Code, response.Remark)
+	}
+	return nil
+}
+
+// UpdateBrokerConfig 更新Broker配置，properties为配置项 -> 值，返回需要重启Broker才能生效的配置项
+// Since: 2018/2/2
+func (impl *MQClientAPIImpl) UpdateBrokerConfig(brokerAddr string, properties map[string]interface{}, timeoutMillis int64) ([]string, error) {
+	request := protocol.CreateRequestCommand(code.UPDATE_BROKER_CONFIG)
+	request.Body = stgcommon.Encode(properties)
+	response, err := impl.DefalutRemotingClient.InvokeSync(brokerAddr, request, timeoutMillis)
+	if err != nil {
+		return nil, err
+	}
+	if response == nil {
+		return nil, fmt.Errorf("UpdateBrokerConfig response is nil")
+	}
+	if response.Code != code.SUCCESS {
+		logger.Errorf("UpdateBrokerConfig failed. %s", response.ToString())
+		return nil, fmt.Errorf("%d, %s", response.Code, response.Remark)
+	}
+
+	restartRequired := []string{}
+	if remark := strings.TrimPrefix(response.Remark, "restart required: "); remark != response.Remark {
+		restartRequired = strings.Split(remark, ",")
+	}
+	return restartRequired, nil
+}
+
+// UpdateAndCreateQuota 创建或更新Broker限流配额
+// Since: 2018/1/29
+func (impl *MQClientAPIImpl) UpdateAndCreateQuota(brokerAddr string, config *quota.QuotaConfig, timeoutMillis int64) error {
+	quotaConfig := *config
+	quotaConfig.Name = impl.buildQuotaName(config.Dimension, config.Name)
+	request := protocol.CreateRequestCommand(code.UPDATE_AND_CREATE_QUOTA)
+	request.Body = stgcommon.Encode(&quotaConfig)
+	response, err := impl.DefalutRemotingClient.InvokeSync(brokerAddr, request, timeoutMillis)
+	if err != nil {
+		return err
+	}
+	if response == nil {
+		return fmt.Errorf("UpdateAndCreateQuota response is nil")
+	}
+	if response.Code != code.SUCCESS {
+		logger.Errorf("UpdateAndCreateQuota failed. %s", response.ToString())
+		return fmt.Errorf("%d, %s", response.Code, response.Remark)
+	}
+	return nil
+}
+
+// DeleteQuota 删除Broker限流配额
+// Since: 2018/1/29
+func (impl *MQClientAPIImpl) DeleteQuota(brokerAddr, dimension, name string, timeoutMillis int64) error {
+	requestHeader := header.NewDeleteQuotaRequestHeader(dimension, impl.buildQuotaName(dimension, name))
+	request := protocol.CreateRequestCommand(code.DELETE_QUOTA, requestHeader)
+	response, err := impl.DefalutRemotingClient.InvokeSync(brokerAddr, request, timeoutMillis)
+	if err != nil {
+		return err
+	}
+	if response == nil {
+		return fmt.Errorf("DeleteQuota response is nil")
+	}
+	if response.Code != code.SUCCESS {
+		logger.Errorf("DeleteQuota failed. %s", response.ToString())
+		return fmt.Errorf("%d, %s", response.Code, response.Remark)
+	}
+	return nil
+}
+
+// GetAllQuotaConfig 获取Broker所有限流配额
+// Since: 2018/1/29
+func (impl *MQClientAPIImpl) GetAllQuotaConfig(brokerAddr string, timeoutMillis int64) ([]*quota.QuotaConfig, error) {
+	request := protocol.CreateRequestCommand(code.GET_ALL_QUOTA_CONFIG)
+	response, err := impl.DefalutRemotingClient.InvokeSync(brokerAddr, request, timeoutMillis)
+	if err != nil {
+		return nil, err
+	}
+	if response == nil {
+		return nil, fmt.Errorf("GetAllQuotaConfig response is nil")
+	}
+	if response.Code != code.SUCCESS {
+		logger.Errorf("GetAllQuotaConfig failed. %s", response.ToString())
+		return nil, fmt.Errorf("%d, %s", response.Code, response.Remark)
+	}
+
+	quotaConfigTable := quota.NewQuotaConfigTable()
+	if err := stgcommon.Decode(response.Body, quotaConfigTable); err != nil {
+		return nil, err
+	}
+
+	quotaConfigs := make([]*quota.QuotaConfig, 0, quotaConfigTable.Size())
+	quotaConfigTable.Foreach(func(k string, v *quota.QuotaConfig) {
+		if v.Dimension != quota.CLIENT_IP && !stgcommon.IsEmpty(impl.ProjectGroupPrefix) {
+			v.Name = stgclient.ClearProjectGroup(v.Name, impl.ProjectGroupPrefix)
+		}
+		quotaConfigs = append(quotaConfigs, v)
+	})
+	return quotaConfigs, nil
+}
+
+// GetConsumerLag 获取Broker计算的消费延迟（消息数及秒数），consumerGroup、topic为空时返回全部
+// Since: 2018/1/31
+func (impl *MQClientAPIImpl) GetConsumerLag(brokerAddr, consumerGroup, topic string, timeoutMillis int64) (*body.ConsumerLagTable, error) {
+	consumerGroupWithProjectGroup := consumerGroup
+	if !stgcommon.IsEmpty(consumerGroup) && !stgcommon.IsEmpty(impl.ProjectGroupPrefix) {
+		consumerGroupWithProjectGroup = stgclient.BuildWithProjectGroup(consumerGroup, impl.ProjectGroupPrefix)
+	}
+	requestHeader := header.NewGetConsumerLagRequestHeader(consumerGroupWithProjectGroup, topic)
+	request := protocol.CreateRequestCommand(code.GET_CONSUMER_LAG, requestHeader)
+
+	response, err := impl.DefalutRemotingClient.InvokeSync(brokerAddr, request, timeoutMillis)
+	if err != nil {
+		return nil, err
+	}
+	if response == nil {
+		return nil, fmt.Errorf("GetConsumerLag response is nil")
+	}
+	if response.Code != code.SUCCESS {
+		logger.Errorf("GetConsumerLag failed. %s", response.ToString())
+		return nil, fmt.Errorf("%d, %s", response.Code, response.Remark)
+	}
+
+	lagTable := body.NewConsumerLagTable()
+	if err := stgcommon.Decode(response.Body, lagTable); err != nil {
+		return nil, err
+	}
+	if !stgcommon.IsEmpty(impl.ProjectGroupPrefix) {
+		for _, lag := range lagTable.LagList {
+			lag.ConsumerGroup = stgclient.ClearProjectGroup(lag.ConsumerGroup, impl.ProjectGroupPrefix)
+		}
+	}
+	return lagTable, nil
+}
+
+// PopMessage POP方式拉取消息，从重试队列拉取的消息Topic还原为原始topic，实际所在的topic保存在ReceiptTopic中
+// Since: 2018/2/1
+func (impl *MQClientAPIImpl) PopMessage(brokerName, brokerAddr string, requestHeader *header.PopMessageRequestHeader, timeoutMillis int64) (*consumer.PopResult, error) {
+	if !stgcommon.IsEmpty(impl.ProjectGroupPrefix) {
+		requestHeader.ConsumerGroup = stgclient.BuildWithProjectGroup(requestHeader.ConsumerGroup, impl.ProjectGroupPrefix)
+		requestHeader.Topic = stgclient.BuildWithProjectGroup(requestHeader.Topic, impl.ProjectGroupPrefix)
+	}
+	request := protocol.CreateRequestCommand(code.POP_MESSAGE, requestHeader)
+
+	response, err := impl.DefalutRemotingClient.InvokeSync(brokerAddr, request, timeoutMillis)
+	if err != nil {
+		return nil, err
+	}
+	if response == nil {
+		return nil, fmt.Errorf("PopMessage response is nil")
+	}
+
+	switch response.Code {
+	case code.SUCCESS:
+	case code.PULL_NOT_FOUND:
+		return &consumer.PopResult{PopStatus: consumer.POP_NO_NEW_MSG}, nil
+	case code.RATE_LIMITED:
+		rateLimitedHeader := &header.RateLimitedResponseHeader{}
+		response.DecodeCommandCustomHeader(rateLimitedHeader)
+		return &consumer.PopResult{PopStatus: consumer.POP_RATE_LIMITED, RetryAfterMillis: rateLimitedHeader.RetryAfterMillis}, nil
+	default:
+		return nil, fmt.Errorf("%d, %s", response.Code, response.Remark)
+	}
+
+	responseHeader := &header.PopMessageResponseHeader{}
+	if err := response.DecodeCommandCustomHeader(responseHeader); err != nil {
+		return nil, err
+	}
+	msgs, err := message.DecodesMessageExt(response.Body, true)
+	if err != nil {
+		return nil, err
+	}
+
+	retryTopic := stgcommon.GetRetryTopic(requestHeader.ConsumerGroup)
+	popResult := &consumer.PopResult{PopStatus: consumer.POP_FOUND, MsgFoundList: make([]*consumer.PopMessageExt, 0, len(msgs))}
+	for _, msg := range msgs {
+		receiptTopic := msg.Topic
+		if originTopic := msg.GetProperty(message.PROPERTY_RETRY_TOPIC); originTopic != "" && msg.Topic == retryTopic {
+			msg.Topic = originTopic
+		}
+		if !stgcommon.IsEmpty(impl.ProjectGroupPrefix) {
+			msg.Topic = stgclient.ClearProjectGroup(msg.Topic, impl.ProjectGroupPrefix)
+		}
+		popResult.MsgFoundList = append(popResult.MsgFoundList, &consumer.PopMessageExt{
+			MessageExt:    msg,
+			BrokerName:    brokerName,
+			ReceiptTopic:  receiptTopic,
+			PopTime:       responseHeader.PopTime,
+			InvisibleTime: responseHeader.InvisibleTime,
+		})
+	}
+	return popResult, nil
+}
+
+// AckMessage 确认POP拉取的消息已消费
+// Since: 2018/2/1
+func (impl *MQClientAPIImpl) AckMessage(brokerAddr, consumerGroup string, msg *consumer.PopMessageExt, timeoutMillis int64) error {
+	if !stgcommon.IsEmpty(impl.ProjectGroupPrefix) {
+		consumerGroup = stgclient.BuildWithProjectGroup(consumerGroup, impl.ProjectGroupPrefix)
+	}
+	requestHeader := &header.AckMessageRequestHeader{
+		ConsumerGroup: consumerGroup,
+		Topic:         msg.ReceiptTopic,
+		QueueId:       msg.QueueId,
+		Offset:        msg.QueueOffset,
+		PopTime:       msg.PopTime,
+	}
+	request := protocol.CreateRequestCommand(code.ACK_MESSAGE, requestHeader)
+
+	response, err := impl.DefalutRemotingClient.InvokeSync(brokerAddr, request, timeoutMillis)
+	if err != nil {
+		return err
+	}
+	if response == nil {
+		return fmt.Errorf("AckMessage response is nil")
+	}
+	if response.Code != code.SUCCESS {
+		return fmt.Errorf("%d, %s", response.Code, response.Remark)
+	}
+	return nil
+}
+
+// ChangeInvisibleTime 修改POP拉取的消息的不可见时间，成功后更新msg的PopTime、InvisibleTime
+// Since: 2018/2/1
+func (impl *MQClientAPIImpl) ChangeInvisibleTime(brokerAddr, consumerGroup string, msg *consumer.PopMessageExt, invisibleTime, timeoutMillis int64) error {
+	if !stgcommon.IsEmpty(impl.ProjectGroupPrefix) {
+		consumerGroup = stgclient.BuildWithProjectGroup(consumerGroup, impl.ProjectGroupPrefix)
+	}
+	requestHeader := &header.ChangeInvisibleTimeRequestHeader{
+		ConsumerGroup: consumerGroup,
+		Topic:         msg.ReceiptTopic,
+		QueueId:       msg.QueueId,
+		Offset:        msg.QueueOffset,
+		PopTime:       msg.PopTime,
+		InvisibleTime: invisibleTime,
+	}
+	request := protocol.CreateRequestCommand(code.CHANGE_INVISIBLE_TIME, requestHeader)
+
+	response, err := impl.DefalutRemotingClient.InvokeSync(brokerAddr, request, timeoutMillis)
+	if err != nil {
+		return err
+	}
+	if response == nil {
+		return fmt.Errorf("ChangeInvisibleTime response is nil")
+	}
+	if response.Code != code.SUCCESS {
+		return fmt.Errorf("%d, %s", response.Code, response.Remark)
+	}
+
+	responseHeader := &header.ChangeInvisibleTimeResponseHeader{}
+	if err := response.DecodeCommandCustomHeader(responseHeader); err != nil {
+		return err
+	}
+	msg.PopTime = responseHeader.PopTime
+	msg.InvisibleTime = responseHeader.InvisibleTime
+	return nil
+}
+
+// buildQuotaName topic、生产组、消费组配额的名称需要加上项目组前缀
+func (impl *MQClientAPIImpl) buildQuotaName(dimension, name string) string {
+	if dimension == quota.CLIENT_IP || stgcommon.IsEmpty(impl.ProjectGroupPrefix) {
+		return name
+	}
+	return stgclient.BuildWithProjectGroup(name, impl.ProjectGroupPrefix)
+}
+
 // CloneGroupOffset 克隆消费组的偏移量
 // Author: tianyuliang
 // Since: 2017/11/6
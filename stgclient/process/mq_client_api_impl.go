@@ -16,6 +16,7 @@ import (
 	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/heartbeat"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/route"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/utils"
+	"git.oschina.net/cloudzone/smartgo/stgnet/netm"
 	"git.oschina.net/cloudzone/smartgo/stgnet/protocol"
 	"git.oschina.net/cloudzone/smartgo/stgnet/remoting"
 	"strings"
@@ -30,11 +31,20 @@ type MQClientAPIImpl struct {
 	ProjectGroupPrefix      string
 }
 
-func NewMQClientAPIImpl(clientRemotingProcessor *ClientRemotingProcessor) *MQClientAPIImpl {
+func NewMQClientAPIImpl(clientRemotingProcessor *ClientRemotingProcessor, tlsConfig *netm.TlsConfig, rpcHook ...remoting.RPCHook) *MQClientAPIImpl {
+	remotingClient := remoting.NewDefalutRemotingClient()
+	if err := remotingClient.SetTlsConfig(tlsConfig); err != nil {
+		// TLS配置错误时不降级为明文连接
+		logger.Errorf("mq client set tls config error: %s", err.Error())
+		panic(err)
+	}
 	mClientAPIImpl := &MQClientAPIImpl{
-		DefalutRemotingClient:   remoting.NewDefalutRemotingClient(),
+		DefalutRemotingClient:   remotingClient,
 		ClientRemotingProcessor: clientRemotingProcessor,
 	}
+	if len(rpcHook) > 0 && rpcHook[0] != nil {
+		mClientAPIImpl.DefalutRemotingClient.RegisterRPCHook(rpcHook[0])
+	}
 	mClientAPIImpl.DefalutRemotingClient.RegisterProcessor(code.NOTIFY_CONSUMER_IDS_CHANGED, clientRemotingProcessor)
 	return mClientAPIImpl
 }
@@ -205,10 +215,50 @@ func (impl *MQClientAPIImpl) sendMessageASync(addr string, brokerName string, ms
 	})
 }
 
+// BrokerBusyError broker繁忙返回SYSTEM_BUSY，同步发送时更换broker重试
+// Since 2018/1/25
+type BrokerBusyError struct {
+	BrokerName string
+	Remark     string
+}
+
+func (e *BrokerBusyError) Error() string {
+	return fmt.Sprintf("broker %s busy, %s", e.BrokerName, e.Remark)
+}
+
+// RateLimitedError 超过broker限流配额返回RATE_LIMITED，调用方等待RetryAfterMillis后重试
+// Since 2018/1/29
+type RateLimitedError struct {
+	BrokerName       string
+	RetryAfterMillis int64
+	Remark           string
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("broker %s rate limited, retry after %dms, %s", e.BrokerName, e.RetryAfterMillis, e.Remark)
+}
+
+// BrokerUnreachableError 请求没有得到broker的响应（连接失败、发送失败、等待响应超时），区别于broker返回的错误码
+// Since 2018/2/7
+type BrokerUnreachableError struct {
+	Addr   string
+	Remark string
+}
+
+func (e *BrokerUnreachableError) Error() string {
+	return fmt.Sprintf("broker %s unreachable, %s", e.Addr, e.Remark)
+}
+
 // 处理发送消息响应
 func (impl *MQClientAPIImpl) processSendResponse(brokerName string, msg *message.Message, response *protocol.RemotingCommand) (*SendResult, error) {
 	if response != nil {
 		switch response.Code {
+		case code.SYSTEM_BUSY:
+			return nil, &BrokerBusyError{BrokerName: brokerName, Remark: response.Remark}
+		case code.RATE_LIMITED:
+			rateLimitedHeader := &header.RateLimitedResponseHeader{}
+			response.DecodeCommandCustomHeader(rateLimitedHeader)
+			return nil, &RateLimitedError{BrokerName: brokerName, RetryAfterMillis: rateLimitedHeader.RetryAfterMillis, Remark: response.Remark}
 		case code.FLUSH_DISK_TIMEOUT:
 			fallthrough
 		case code.FLUSH_SLAVE_TIMEOUT:
@@ -305,7 +355,7 @@ func (impl *MQClientAPIImpl) GetMaxOffset(addr string, topic string, queueId int
 }
 
 func (impl *MQClientAPIImpl) PullMessage(addr string, requestHeader header.PullMessageRequestHeader,
-	timeoutMillis int, communicationMode CommunicationMode, pullCallback PullCallback) *PullResultExt {
+	timeoutMillis int, communicationMode CommunicationMode, pullCallback PullCallback) (*PullResultExt, error) {
 	if !strings.EqualFold(impl.ProjectGroupPrefix, "") {
 		requestHeader.ConsumerGroup = stgclient.BuildWithProjectGroup(requestHeader.ConsumerGroup, impl.ProjectGroupPrefix)
 		requestHeader.Topic = stgclient.BuildWithProjectGroup(requestHeader.Topic, impl.ProjectGroupPrefix)
@@ -321,7 +371,7 @@ func (impl *MQClientAPIImpl) PullMessage(addr string, requestHeader header.PullM
 	default:
 
 	}
-	return nil
+	return nil, nil
 }
 
 func (impl *MQClientAPIImpl) queryConsumerOffset(addr string, requestHeader header.QueryConsumerOffsetRequestHeader, timeoutMillis int64) int64 {
@@ -345,15 +395,16 @@ func (impl *MQClientAPIImpl) queryConsumerOffset(addr string, requestHeader head
 	return -1
 }
 
-func (impl *MQClientAPIImpl) pullMessageSync(addr string, request *protocol.RemotingCommand, timeoutMillis int) *PullResultExt {
+func (impl *MQClientAPIImpl) pullMessageSync(addr string, request *protocol.RemotingCommand, timeoutMillis int) (*PullResultExt, error) {
 	response, err := impl.DefalutRemotingClient.InvokeSync(addr, request, int64(timeoutMillis))
 	if err != nil {
 		logger.Errorf("pullMessageSync error=%v", err.Error())
+		return nil, err
 	}
-	if response != nil {
-		return impl.processPullResponse(response)
+	if response == nil {
+		return nil, fmt.Errorf("pull message from %s response is nil", addr)
 	}
-	return nil
+	return impl.processPullResponse(response)
 }
 
 func (impl *MQClientAPIImpl) UpdateNameServerAddressList(addrs string) {
@@ -391,19 +442,25 @@ func (impl *MQClientAPIImpl) pullMessageAsync(addr string, request *protocol.Rem
 	invokeCallback := func(responseFuture *remoting.ResponseFuture) {
 		response := responseFuture.GetRemotingCommand()
 		if response != nil {
-			pullResultExt := impl.processPullResponse(response)
+			pullResultExt, err := impl.processPullResponse(response)
+			if err != nil {
+				pullCallback.OnException(err)
+				return
+			}
 			pullCallback.OnSuccess(pullResultExt)
 		} else {
 			if !responseFuture.IsSendRequestOK() {
-				logger.Warnf("send request not ok")
+				pullCallback.OnException(&BrokerUnreachableError{Addr: addr, Remark: "send request not ok"})
 			} else if responseFuture.IsTimeout() {
-				logger.Warnf("send request time out")
+				pullCallback.OnException(&BrokerUnreachableError{Addr: addr, Remark: "wait response timeout"})
 			} else {
-				logger.Warnf("send request fail")
+				pullCallback.OnException(fmt.Errorf("pull message from %s fail", addr))
 			}
 		}
 	}
-	impl.DefalutRemotingClient.InvokeAsync(addr, request, int64(timeoutMillis), invokeCallback)
+	if err := impl.DefalutRemotingClient.InvokeAsync(addr, request, int64(timeoutMillis), invokeCallback); err != nil {
+		pullCallback.OnException(&BrokerUnreachableError{Addr: addr, Remark: err.Error()})
+	}
 }
 
 func (impl *MQClientAPIImpl) unRegisterClient(addr, clientID, producerGroup, consumerGroup string, timeoutMillis int) {
@@ -426,7 +483,7 @@ func (impl *MQClientAPIImpl) unRegisterClient(addr, clientID, producerGroup, con
 	}
 }
 
-func (impl *MQClientAPIImpl) processPullResponse(response *protocol.RemotingCommand) *PullResultExt {
+func (impl *MQClientAPIImpl) processPullResponse(response *protocol.RemotingCommand) (*PullResultExt, error) {
 	pullStatus := consumer.NO_NEW_MSG
 	switch response.Code {
 	case code.SUCCESS:
@@ -437,11 +494,20 @@ func (impl *MQClientAPIImpl) processPullResponse(response *protocol.RemotingComm
 		pullStatus = consumer.NO_MATCHED_MSG
 	case code.PULL_OFFSET_MOVED:
 		pullStatus = consumer.OFFSET_ILLEGAL
+	case code.RATE_LIMITED:
+		// 限流响应中没有offset信息，等待broker建议的时间后重新拉取
+		rateLimitedHeader := &header.RateLimitedResponseHeader{}
+		response.DecodeCommandCustomHeader(rateLimitedHeader)
+		pullResultExt := NewPullResultExt(consumer.RATE_LIMITED, 0, 0, 0, nil, 0, nil)
+		pullResultExt.retryAfterMillis = rateLimitedHeader.RetryAfterMillis
+		return pullResultExt, nil
+	default:
+		return nil, fmt.Errorf("%d, %s", response.Code, response.Remark)
 	}
 	reponseHeader := &header.PullMessageResponseHeader{}
 	response.DecodeCommandCustomHeader(reponseHeader)
 	return NewPullResultExt(pullStatus, reponseHeader.NextBeginOffset,
-		reponseHeader.MinOffset, reponseHeader.MaxOffset, nil, reponseHeader.SuggestWhichBrokerId, response.Body)
+		reponseHeader.MinOffset, reponseHeader.MaxOffset, nil, reponseHeader.SuggestWhichBrokerId, response.Body), nil
 }
 
 // 创建topic
@@ -12,6 +12,7 @@ import (
 	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/route"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/sync"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/utils/timeutil"
+	"git.oschina.net/cloudzone/smartgo/stgnet/remoting"
 	set "github.com/deckarep/golang-set"
 	"sort"
 	"strconv"
@@ -47,7 +48,7 @@ type MQClientInstance struct {
 // NewMQClientInstance: 初始化
 // Author: yintongqiang
 // Since:  2017/8/10
-func NewMQClientInstance(clientConfig *stgclient.ClientConfig, instanceIndex int32, clientId string) *MQClientInstance {
+func NewMQClientInstance(clientConfig *stgclient.ClientConfig, instanceIndex int32, clientId string, rpcHook ...remoting.RPCHook) *MQClientInstance {
 	mqClientInstance := &MQClientInstance{
 		ClientConfig:    clientConfig,
 		InstanceIndex:   instanceIndex,
@@ -60,7 +61,7 @@ func NewMQClientInstance(clientConfig *stgclient.ClientConfig, instanceIndex int
 		TimerTask:       set.NewSet(),
 	}
 	mqClientInstance.ClientRemotingProcessor = NewClientRemotingProcessor(mqClientInstance)
-	mqClientInstance.MQClientAPIImpl = NewMQClientAPIImpl(mqClientInstance.ClientRemotingProcessor)
+	mqClientInstance.MQClientAPIImpl = NewMQClientAPIImpl(mqClientInstance.ClientRemotingProcessor, clientConfig.TlsConfig, rpcHook...)
 	if !strings.EqualFold(mqClientInstance.ClientConfig.NamesrvAddr, "") {
 		mqClientInstance.MQClientAPIImpl.UpdateNameServerAddressList(mqClientInstance.ClientConfig.NamesrvAddr)
 		logger.Infof("user specified name server address: %v", mqClientInstance.ClientConfig.NamesrvAddr)
@@ -178,11 +179,60 @@ func (mqClientInstance *MQClientInstance) RegisterConsumer(group string, consume
 func (mqClientInstance *MQClientInstance) SendHeartbeatToAllBrokerWithLock() {
 	mqClientInstance.LockHeartbeat.Lock()
 	mqClientInstance.sendHeartbeatToAllBroker()
-	//todo uploadFilterClassSource
+	mqClientInstance.uploadFilterClassSource()
 	defer mqClientInstance.LockHeartbeat.Unlock()
 
 }
 
+// uploadFilterClassSource 将push消费者类过滤模式订阅的过滤逻辑上传到topic对应的Filter Server
+// Since: 2018/2/5
+func (mqClientInstance *MQClientInstance) uploadFilterClassSource() {
+	for ite := mqClientInstance.ConsumerTable.Iterator(); ite.HasNext(); {
+		_, v, _ := ite.Next()
+		consumerInner, ok := v.(consumer.MQConsumerInner)
+		if !ok || consumerInner.ConsumeType() != heartbeat.CONSUME_PASSIVELY {
+			continue
+		}
+		for data := range consumerInner.Subscriptions().Iterator().C {
+			subscriptionData, ok := data.(*heartbeat.SubscriptionData)
+			if ok && subscriptionData.ClassFilterMode && subscriptionData.FilterClassSource != "" {
+				mqClientInstance.uploadFilterClassToAllFilterServer(consumerInner.GroupName(), subscriptionData.SubString,
+					subscriptionData.Topic, subscriptionData.FilterClassSource)
+			}
+		}
+	}
+}
+
+// uploadFilterClassToAllFilterServer 向topic路由中的所有Filter Server注册过滤逻辑
+// Since: 2018/2/5
+func (mqClientInstance *MQClientInstance) uploadFilterClassToAllFilterServer(consumerGroup, className, topic, filterClassSource string) {
+	classBody := []byte(filterClassSource)
+	classCRC, err := stgcommon.Crc32(classBody)
+	if err != nil {
+		logger.Errorf("uploadFilterClassToAllFilterServer crc32 error: %s", err.Error())
+		return
+	}
+
+	value, _ := mqClientInstance.TopicRouteTable.Get(topic)
+	topicRouteData, ok := value.(*route.TopicRouteData)
+	if !ok || topicRouteData == nil || len(topicRouteData.FilterServerTable) == 0 {
+		format := "register message class filter failed, because no filter server, ConsumerGroup: %s Topic: %s ClassName: %s"
+		logger.Warnf(format, consumerGroup, topic, className)
+		return
+	}
+
+	for _, filterServers := range topicRouteData.FilterServerTable {
+		for _, filterServerAddr := range filterServers {
+			err := mqClientInstance.MQClientAPIImpl.RegisterMessageFilterClass(filterServerAddr, consumerGroup, topic, className, classCRC, classBody, 5000)
+			if err != nil {
+				logger.Errorf("uploadFilterClassToAllFilterServer %s error: %s", filterServerAddr, err.Error())
+				continue
+			}
+			logger.Infof("register message class filter to %s OK, ConsumerGroup: %s Topic: %s ClassName: %s", filterServerAddr, consumerGroup, topic, className)
+		}
+	}
+}
+
 // 向所有boker发送心跳
 func (mqClientInstance *MQClientInstance) sendHeartbeatToAllBroker() {
 	heartbeatData := mqClientInstance.prepareHeartbeatData()
@@ -584,33 +634,36 @@ func (mqClientInstance *MQClientInstance) findBrokerAddrByTopic(topic string) st
 	return ""
 }
 
+// findBrokerAddressInAdmin 优先返回master地址，master不在路由中（例如已下线）时返回slave地址
 func (mqClientInstance *MQClientInstance) findBrokerAddressInAdmin(brokerName string) FindBrokerResult {
-	var brokerAddr string
-	var slave bool
-	var found bool
 	getBrokerMap, _ := mqClientInstance.BrokerAddrTable.Get(brokerName)
-	brokerMap := getBrokerMap.(map[int]string)
-	if len(brokerMap) > 0 {
-		for brokerId, addr := range brokerMap {
-			brokerAddr = addr
-			if !strings.EqualFold(brokerAddr, "") {
-				found = true
-				if brokerId == stgcommon.MASTER_ID {
-					slave = false
-					break
-				} else {
-					slave = true
-				}
-				break
-			}
-		}
+	brokerMap, _ := getBrokerMap.(map[int]string)
+	if brokerAddr := brokerMap[stgcommon.MASTER_ID]; !strings.EqualFold(brokerAddr, "") {
+		return FindBrokerResult{brokerAddr: brokerAddr, slave: false}
 	}
-	if found {
-		return FindBrokerResult{brokerAddr: brokerAddr, slave: slave}
+	if slaveId, ok := mqClientInstance.findSlaveBrokerId(brokerName); ok {
+		return FindBrokerResult{brokerAddr: brokerMap[slaveId], slave: true}
 	}
 	return FindBrokerResult{}
 }
 
+// findSlaveBrokerId 返回broker组中brokerId最小的slave
+// Since: 2018/2/6
+func (mqClientInstance *MQClientInstance) findSlaveBrokerId(brokerName string) (int, bool) {
+	getBrokerMap, _ := mqClientInstance.BrokerAddrTable.Get(brokerName)
+	brokerMap, _ := getBrokerMap.(map[int]string)
+	slaveId, found := 0, false
+	for brokerId, addr := range brokerMap {
+		if brokerId == stgcommon.MASTER_ID || strings.EqualFold(addr, "") {
+			continue
+		}
+		if !found || brokerId < slaveId {
+			slaveId, found = brokerId, true
+		}
+	}
+	return slaveId, found
+}
+
 func (mqClientInstance *MQClientInstance) findBrokerAddressInSubscribe(brokerName string, brokerId int, onlyThisBroker bool) FindBrokerResult {
 	var brokerAddr string
 	var slave bool
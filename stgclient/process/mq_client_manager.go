@@ -4,6 +4,7 @@ import (
 	"git.oschina.net/cloudzone/smartgo/stgclient"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
 	syncMap "git.oschina.net/cloudzone/smartgo/stgcommon/sync"
+	"git.oschina.net/cloudzone/smartgo/stgnet/remoting"
 	"sync"
 	"sync/atomic"
 )
@@ -36,12 +37,12 @@ func GetInstance() *MQClientManager {
 	return instance
 }
 
-// 从集合中查询MQClientInstance，无则创建一个
-func (mQClientManager *MQClientManager) GetAndCreateMQClientInstance(clientConfig *stgclient.ClientConfig) *MQClientInstance {
+// 从集合中查询MQClientInstance，无则创建一个，rpcHook仅在创建时生效
+func (mQClientManager *MQClientManager) GetAndCreateMQClientInstance(clientConfig *stgclient.ClientConfig, rpcHook ...remoting.RPCHook) *MQClientInstance {
 	clientId := clientConfig.BuildMQClientId()
 	instance, _ := mQClientManager.FactoryTable.Get(clientId)
 	if nil == instance {
-		instance = NewMQClientInstance(clientConfig.CloneClientConfig(), atomic.AddInt32(&mQClientManager.FactoryIndexGenerator, 1), clientId)
+		instance = NewMQClientInstance(clientConfig.CloneClientConfig(), atomic.AddInt32(&mQClientManager.FactoryIndexGenerator, 1), clientId, rpcHook...)
 		prev, _ := mQClientManager.FactoryTable.PutIfAbsent(clientId, instance)
 		if prev != nil {
 			instance = prev
@@ -1,6 +1,9 @@
 package process
 
 import (
+	"fmt"
+	"math/rand"
+
 	"git.oschina.net/cloudzone/smartgo/stgclient"
 	"git.oschina.net/cloudzone/smartgo/stgclient/consumer"
 	"git.oschina.net/cloudzone/smartgo/stgcommon"
@@ -8,18 +11,24 @@ import (
 	"git.oschina.net/cloudzone/smartgo/stgcommon/message"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/header"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/heartbeat"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/route"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/sync"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/sysflag"
 	"strconv"
 	"strings"
 )
 
+// masterUnavailableMillis 从master拉取失败后改从slave拉取的时长，与topic路由的更新间隔一致，
+// master下线后不必等到路由更新才能继续消费，超过该时长后重新尝试master
+const masterUnavailableMillis = 30000
+
 // PullAPIWrapper: pull包装类
 // Author: yintongqiang
 // Since:  2017/8/11
 
 type PullAPIWrapper struct {
 	pullFromWhichNodeTable *sync.Map // *MessageQueue, int/* brokerId */
+	masterUnavailableTable *sync.Map // brokerName, int64/* 最近一次从master拉取失败的时间 */
 	mQClientFactory        *MQClientInstance
 	consumerGroup          string
 	unitMode               bool
@@ -30,6 +39,7 @@ type PullAPIWrapper struct {
 func NewPullAPIWrapper(mQClientFactory *MQClientInstance, consumerGroup string, unitMode bool) *PullAPIWrapper {
 	return &PullAPIWrapper{
 		pullFromWhichNodeTable: sync.NewMap(),
+		masterUnavailableTable: sync.NewMap(),
 		mQClientFactory:        mQClientFactory,
 		consumerGroup:          consumerGroup,
 		unitMode:               unitMode,
@@ -46,7 +56,7 @@ func (api *PullAPIWrapper) PullKernelImpl(mq *message.MessageQueue,
 	brokerSuspendMaxTimeMillis int,
 	timeoutMillis int,
 	communicationMode CommunicationMode,
-	pullCallback PullCallback) *PullResultExt {
+	pullCallback PullCallback) (*PullResultExt, error) {
 	findBrokerResult := api.mQClientFactory.findBrokerAddressInSubscribe(mq.BrokerName, api.recalculatePullFromWhichNode(mq), false)
 	if strings.EqualFold(findBrokerResult.brokerAddr, "") {
 		api.mQClientFactory.UpdateTopicRouteInfoFromNameServerByTopic(mq.Topic)
@@ -69,23 +79,79 @@ func (api *PullAPIWrapper) PullKernelImpl(mq *message.MessageQueue,
 			Subscription:         subExpression,
 			SubVersion:           subVersion}
 		brokerAddr := findBrokerResult.brokerAddr
-		//todo filter处理
-		pullResultExt := api.mQClientFactory.MQClientAPIImpl.PullMessage(brokerAddr, requestHeader, timeoutMillis, communicationMode, pullCallback)
-		return pullResultExt
+		// 类过滤模式的订阅从broker对应的Filter Server拉取
+		if sysflag.HasClassFilterFlag(sysFlagInner) {
+			filterServerAddr, err := api.computePullFromWhichFilterServer(mq.Topic, brokerAddr)
+			if err != nil {
+				return nil, err
+			}
+			brokerAddr = filterServerAddr
+		}
+		return api.mQClientFactory.MQClientAPIImpl.PullMessage(brokerAddr, requestHeader, timeoutMillis, communicationMode, pullCallback)
+	}
+	return nil, fmt.Errorf("The broker[%s] not exist", mq.BrokerName)
+}
 
-	} else {
-		panic("The broker[" + mq.BrokerName + "] not exist")
+// computePullFromWhichFilterServer 从topic路由中随机选择broker对应的一个Filter Server
+// Since: 2018/2/5
+func (api *PullAPIWrapper) computePullFromWhichFilterServer(topic, brokerAddr string) (string, error) {
+	value, _ := api.mQClientFactory.TopicRouteTable.Get(topic)
+	if topicRouteData, ok := value.(*route.TopicRouteData); ok && topicRouteData != nil {
+		filterServers := topicRouteData.FilterServerTable[brokerAddr]
+		if len(filterServers) > 0 {
+			return filterServers[rand.Intn(len(filterServers))], nil
+		}
 	}
-	return nil
+	return "", fmt.Errorf("Find Filter Server Failed, Broker Addr: %s topic: %s", brokerAddr, topic)
+}
+
+// SetConnectBrokerByUser 固定从defaultBrokerId对应的broker拉取消息，不再根据broker的建议切换
+// Since: 2018/2/5
+func (api *PullAPIWrapper) SetConnectBrokerByUser(connectBrokerByUser bool, defaultBrokerId int) {
+	api.defaultBrokerId = defaultBrokerId
+	api.connectBrokerByUser = connectBrokerByUser
 }
 
 func (api *PullAPIWrapper) recalculatePullFromWhichNode(mq *message.MessageQueue) int {
-	//todo FiltersrvController
+	if api.connectBrokerByUser {
+		return api.defaultBrokerId
+	}
+	brokerId := stgcommon.MASTER_ID
 	suggest, _ := api.pullFromWhichNodeTable.Get(mq)
 	if suggest != nil {
-		return suggest.(int)
+		brokerId = suggest.(int)
+	}
+	if brokerId == stgcommon.MASTER_ID && api.isMasterUnavailable(mq.BrokerName) {
+		if slaveId, ok := api.mQClientFactory.findSlaveBrokerId(mq.BrokerName); ok {
+			return slaveId
+		}
+	}
+	return brokerId
+}
+
+// pullFromSlaveWhenMasterUnavailable 从master拉取失败时记录master不可用，之后一段时间内改从slave拉取
+// Since: 2018/2/6
+func (api *PullAPIWrapper) pullFromSlaveWhenMasterUnavailable(mq *message.MessageQueue) {
+	if api.connectBrokerByUser || api.recalculatePullFromWhichNode(mq) != stgcommon.MASTER_ID {
+		return
+	}
+	if findBrokerResult := api.mQClientFactory.findBrokerAddressInSubscribe(mq.BrokerName, stgcommon.MASTER_ID, true); strings.EqualFold(findBrokerResult.brokerAddr, "") {
+		return
+	}
+	if _, ok := api.mQClientFactory.findSlaveBrokerId(mq.BrokerName); !ok {
+		return
+	}
+
+	api.masterUnavailableTable.Put(mq.BrokerName, stgcommon.GetCurrentTimeMillis())
+	logger.Warnf("pull from master of broker[%s] failed, pull from slave in the next %dms", mq.BrokerName, masterUnavailableMillis)
+}
+
+func (api *PullAPIWrapper) isMasterUnavailable(brokerName string) bool {
+	timestamp, _ := api.masterUnavailableTable.Get(brokerName)
+	if timestamp == nil {
+		return false
 	}
-	return stgcommon.MASTER_ID
+	return stgcommon.GetCurrentTimeMillis()-timestamp.(int64) < masterUnavailableMillis
 }
 
 func (api *PullAPIWrapper) updatePullFromWhichNode(mq *message.MessageQueue, brokerId int) {
@@ -0,0 +1,129 @@
+package process
+
+import (
+	"errors"
+	"testing"
+
+	"git.oschina.net/cloudzone/smartgo/stgclient/consumer"
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/message"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/sync"
+)
+
+func newTestClientInstance(brokerAddrs map[string]map[int]string) *MQClientInstance {
+	brokerAddrTable := sync.NewMap()
+	for brokerName, brokerMap := range brokerAddrs {
+		brokerAddrTable.Put(brokerName, brokerMap)
+	}
+	return &MQClientInstance{BrokerAddrTable: brokerAddrTable}
+}
+
+func TestMQClientInstance_FindSlaveBrokerId(t *testing.T) {
+	mqClientInstance := newTestClientInstance(map[string]map[int]string{
+		"broker-a": {stgcommon.MASTER_ID: "10.0.0.1:10911", 2: "10.0.0.3:10911", 1: "10.0.0.2:10911"},
+		"broker-b": {stgcommon.MASTER_ID: "10.0.0.4:10911"},
+		"broker-c": {1: "", 3: "10.0.0.6:10911"},
+	})
+
+	cases := []struct {
+		brokerName string
+		slaveId    int
+		found      bool
+	}{
+		{"broker-a", 1, true},
+		{"broker-b", 0, false},
+		{"broker-c", 3, true},
+		{"broker-d", 0, false},
+	}
+	for _, c := range cases {
+		slaveId, found := mqClientInstance.findSlaveBrokerId(c.brokerName)
+		if slaveId != c.slaveId || found != c.found {
+			t.Errorf("%s: expect slave %d found %t, actual slave %d found %t", c.brokerName, c.slaveId, c.found, slaveId, found)
+		}
+	}
+}
+
+func TestPullAPIWrapper_RecalculatePullFromWhichNode(t *testing.T) {
+	mqClientInstance := newTestClientInstance(map[string]map[int]string{
+		"broker-a": {stgcommon.MASTER_ID: "10.0.0.1:10911", 1: "10.0.0.2:10911"},
+		"broker-b": {stgcommon.MASTER_ID: "10.0.0.4:10911"},
+	})
+	api := NewPullAPIWrapper(mqClientInstance, "group", false)
+	mqA := &message.MessageQueue{Topic: "topic", BrokerName: "broker-a", QueueId: 0}
+	mqB := &message.MessageQueue{Topic: "topic", BrokerName: "broker-b", QueueId: 0}
+
+	// 默认从master拉取，broker建议从slave拉取时按建议
+	if brokerId := api.recalculatePullFromWhichNode(mqA); brokerId != stgcommon.MASTER_ID {
+		t.Errorf("expect pull from master, actual %d", brokerId)
+	}
+	api.updatePullFromWhichNode(mqA, 1)
+	if brokerId := api.recalculatePullFromWhichNode(mqA); brokerId != 1 {
+		t.Errorf("expect pull from suggested slave, actual %d", brokerId)
+	}
+	api.updatePullFromWhichNode(mqA, stgcommon.MASTER_ID)
+
+	// master不可用时改从slave拉取，没有slave时仍从master拉取
+	api.pullFromSlaveWhenMasterUnavailable(mqA)
+	if brokerId := api.recalculatePullFromWhichNode(mqA); brokerId != 1 {
+		t.Errorf("expect pull from slave when master unavailable, actual %d", brokerId)
+	}
+	api.pullFromSlaveWhenMasterUnavailable(mqB)
+	if api.isMasterUnavailable("broker-b") || api.recalculatePullFromWhichNode(mqB) != stgcommon.MASTER_ID {
+		t.Errorf("broker without slave should keep pulling from master")
+	}
+
+	// 用户指定broker时不切换
+	api.SetConnectBrokerByUser(true, stgcommon.MASTER_ID)
+	if brokerId := api.recalculatePullFromWhichNode(mqA); brokerId != stgcommon.MASTER_ID {
+		t.Errorf("expect pull from user specified broker, actual %d", brokerId)
+	}
+}
+
+func TestPullAPIWrapper_IsMasterUnavailable(t *testing.T) {
+	api := NewPullAPIWrapper(newTestClientInstance(nil), "group", false)
+	now := stgcommon.GetCurrentTimeMillis()
+
+	if api.isMasterUnavailable("broker-a") {
+		t.Errorf("master should be available without failure")
+	}
+
+	api.masterUnavailableTable.Put("broker-a", now-masterUnavailableMillis+1000)
+	if !api.isMasterUnavailable("broker-a") {
+		t.Errorf("master should be unavailable within %dms", masterUnavailableMillis)
+	}
+
+	// 超过时长后重新尝试master
+	api.masterUnavailableTable.Put("broker-a", now-masterUnavailableMillis-1)
+	if api.isMasterUnavailable("broker-a") {
+		t.Errorf("master should be available after %dms", masterUnavailableMillis)
+	}
+}
+
+func TestPullCallBackImpl_OnException(t *testing.T) {
+	mqClientInstance := newTestClientInstance(map[string]map[int]string{
+		"broker-a": {stgcommon.MASTER_ID: "10.0.0.1:10911", 1: "10.0.0.2:10911"},
+	})
+	mqClientInstance.PullMessageService = NewPullMessageService(mqClientInstance)
+	api := NewPullAPIWrapper(mqClientInstance, "group", false)
+	mq := &message.MessageQueue{Topic: "topic", BrokerName: "broker-a", QueueId: 0}
+	pullCallback := &PullCallBackImpl{
+		PullRequest: &consumer.PullRequest{MessageQueue: mq},
+		DefaultMQPushConsumerImpl: &DefaultMQPushConsumerImpl{
+			mQClientFactory:                 mqClientInstance,
+			pullAPIWrapper:                  api,
+			PullTimeDelayMillsWhenException: 60 * 1000, // 测试结束前不会重新拉取
+		},
+	}
+
+	// broker返回的错误码说明master可用
+	pullCallback.OnException(&BrokerBusyError{BrokerName: "broker-a", Remark: "system busy"})
+	pullCallback.OnException(errors.New("CODE: 16 DESC: no permission"))
+	if api.isMasterUnavailable("broker-a") {
+		t.Fatalf("master should be available after broker response error")
+	}
+
+	pullCallback.OnException(&BrokerUnreachableError{Addr: "10.0.0.1:10911", Remark: "wait response timeout"})
+	if !api.isMasterUnavailable("broker-a") || api.recalculatePullFromWhichNode(mq) != 1 {
+		t.Errorf("expect pull from slave after master unreachable")
+	}
+}
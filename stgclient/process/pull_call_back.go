@@ -6,4 +6,5 @@ package process
 
 type PullCallback interface {
 	OnSuccess(pullResultExt *PullResultExt)
+	OnException(err error)
 }
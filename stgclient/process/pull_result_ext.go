@@ -9,6 +9,7 @@ type PullResultExt struct {
 	*consumer.PullResult
 	suggestWhichBrokerId int64
 	messageBinary        [] byte
+	retryAfterMillis     int64 // RATE_LIMITED时broker建议的重试等待时间
 }
 
 func NewPullResultExt(pullStatus consumer.PullStatus, nextBeginOffset int64, minOffset int64, maxOffset int64,
@@ -0,0 +1,200 @@
+package process
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"git.oschina.net/cloudzone/smartgo/stgclient"
+	"git.oschina.net/cloudzone/smartgo/stgclient/consumer"
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/constant"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/header"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/route"
+	"git.oschina.net/cloudzone/smartgo/stgnet/remoting"
+)
+
+const simpleConsumerRouteUpdateInterval = 30 * 1000 // 毫秒
+
+// SimpleConsumer POP方式消费：客户端不持有队列，同一订阅组的消费者数量不受队列数限制
+// Receive拉取的消息在不可见时间内不会被其他消费者拉取，消费成功后需要Ack，
+// 不可见时间内未Ack的消息由broker投递到重试队列后重新被拉取
+// 同一订阅组不能同时使用SimpleConsumer与Push/Pull方式消费
+// Since: 2018/2/1
+type SimpleConsumer struct {
+	consumerGroup    string
+	clientConfig     *stgclient.ClientConfig
+	mQClientFactory  *MQClientInstance
+	rpcHook          remoting.RPCHook
+	serviceState     stgcommon.ServiceState
+	popTimeoutMillis int64            // POP、Ack请求超时时间
+	brokerIndex      uint32           // 轮询选择broker
+	routeUpdateTable map[string]int64 // topic -> 上次更新路由的时间
+	routeUpdateLock  sync.Mutex
+}
+
+// NewSimpleConsumer 初始化
+// Since: 2018/2/1
+func NewSimpleConsumer(consumerGroup string, rpcHook ...remoting.RPCHook) *SimpleConsumer {
+	simpleConsumer := &SimpleConsumer{
+		consumerGroup:    consumerGroup,
+		clientConfig:     stgclient.NewClientConfig(""),
+		serviceState:     stgcommon.CREATE_JUST,
+		popTimeoutMillis: 1000 * 10,
+		routeUpdateTable: make(map[string]int64),
+	}
+	if len(rpcHook) > 0 {
+		simpleConsumer.rpcHook = rpcHook[0]
+	}
+	return simpleConsumer
+}
+
+// SetNamesrvAddr 设置namesrv地址
+// Since: 2018/2/1
+func (self *SimpleConsumer) SetNamesrvAddr(namesrvAddr string) {
+	self.clientConfig.NamesrvAddr = namesrvAddr
+}
+
+// Start 启动
+// Since: 2018/2/1
+func (self *SimpleConsumer) Start() {
+	switch self.serviceState {
+	case stgcommon.CREATE_JUST:
+		self.serviceState = stgcommon.START_FAILED
+		if err := CheckGroup(self.consumerGroup); err != nil {
+			panic(err.Error())
+		}
+		if strings.EqualFold(self.consumerGroup, stgcommon.DEFAULT_CONSUMER_GROUP) {
+			panic("consumerGroup can not equal" + stgcommon.DEFAULT_CONSUMER_GROUP + ", please specify another one.")
+		}
+		self.clientConfig.ChangeInstanceNameToPID()
+		self.mQClientFactory = GetInstance().GetAndCreateMQClientInstance(self.clientConfig, self.rpcHook)
+		self.mQClientFactory.Start()
+		logger.Infof("the simple consumer [%v] start OK", self.consumerGroup)
+		self.serviceState = stgcommon.RUNNING
+	case stgcommon.RUNNING:
+	case stgcommon.SHUTDOWN_ALREADY:
+		panic("The SimpleConsumer service state not OK, maybe started once")
+	case stgcommon.START_FAILED:
+	default:
+	}
+}
+
+// Shutdown 关闭，未Ack的消息在不可见时间之后重新被拉取
+// Since: 2018/2/1
+func (self *SimpleConsumer) Shutdown() {
+	switch self.serviceState {
+	case stgcommon.RUNNING:
+		self.mQClientFactory.Shutdown()
+		logger.Infof("the simple consumer [%v] shutdown OK", self.consumerGroup)
+		self.serviceState = stgcommon.SHUTDOWN_ALREADY
+	default:
+	}
+}
+
+// Receive 从topic所在的broker依次POP拉取最多maxNums条消息，invisibleTime为消息不可见时间，没有消息时返回空列表
+// Since: 2018/2/1
+func (self *SimpleConsumer) Receive(topic string, maxNums int, invisibleTime time.Duration) ([]*consumer.PopMessageExt, error) {
+	if err := self.makeSureStateOK(); err != nil {
+		return nil, err
+	}
+
+	brokerNames := self.readableBrokerNames(topic)
+	if len(brokerNames) == 0 {
+		return nil, fmt.Errorf("no route info of this topic: %s", topic)
+	}
+
+	startIndex := atomic.AddUint32(&self.brokerIndex, 1)
+	for i := 0; i < len(brokerNames); i++ {
+		brokerName := brokerNames[(startIndex+uint32(i))%uint32(len(brokerNames))]
+		brokerAddr := self.mQClientFactory.FindBrokerAddressInPublish(brokerName)
+		if brokerAddr == "" {
+			continue
+		}
+
+		requestHeader := header.NewPopMessageRequestHeader(self.consumerGroup, topic, -1, maxNums, int64(invisibleTime/time.Millisecond))
+		popResult, err := self.mQClientFactory.MQClientAPIImpl.PopMessage(brokerName, brokerAddr, requestHeader, self.popTimeoutMillis)
+		if err != nil {
+			logger.Warnf("pop message from broker %s failed: %s", brokerAddr, err.Error())
+			continue
+		}
+		if popResult.PopStatus == consumer.POP_FOUND && len(popResult.MsgFoundList) > 0 {
+			return popResult.MsgFoundList, nil
+		}
+	}
+	return []*consumer.PopMessageExt{}, nil
+}
+
+// Ack 确认消息已消费
+// Since: 2018/2/1
+func (self *SimpleConsumer) Ack(msg *consumer.PopMessageExt) error {
+	brokerAddr, err := self.findBrokerAddr(msg)
+	if err != nil {
+		return err
+	}
+	return self.mQClientFactory.MQClientAPIImpl.AckMessage(brokerAddr, self.consumerGroup, msg, self.popTimeoutMillis)
+}
+
+// ChangeInvisibleTime 从当前时间开始重新计算消息的不可见时间，用于延长处理时间或提前重新投递
+// Since: 2018/2/1
+func (self *SimpleConsumer) ChangeInvisibleTime(msg *consumer.PopMessageExt, invisibleTime time.Duration) error {
+	brokerAddr, err := self.findBrokerAddr(msg)
+	if err != nil {
+		return err
+	}
+	return self.mQClientFactory.MQClientAPIImpl.ChangeInvisibleTime(brokerAddr, self.consumerGroup, msg,
+		int64(invisibleTime/time.Millisecond), self.popTimeoutMillis)
+}
+
+func (self *SimpleConsumer) makeSureStateOK() error {
+	if self.serviceState != stgcommon.RUNNING {
+		return fmt.Errorf("The simple consumer service state not OK, %s", self.serviceState.String())
+	}
+	return nil
+}
+
+// findBrokerAddr POP进度及CheckPoint只在Master上维护
+func (self *SimpleConsumer) findBrokerAddr(msg *consumer.PopMessageExt) (string, error) {
+	if err := self.makeSureStateOK(); err != nil {
+		return "", err
+	}
+
+	brokerAddr := self.mQClientFactory.FindBrokerAddressInPublish(msg.BrokerName)
+	if brokerAddr == "" {
+		return "", fmt.Errorf("the broker[%s] not exist", msg.BrokerName)
+	}
+	return brokerAddr, nil
+}
+
+// readableBrokerNames SimpleConsumer不注册到MQClientInstance，需要自行定时更新topic路由
+func (self *SimpleConsumer) readableBrokerNames(topic string) []string {
+	now := stgcommon.GetCurrentTimeMillis()
+	self.routeUpdateLock.Lock()
+	lastUpdateTime := self.routeUpdateTable[topic]
+	needUpdate := now-lastUpdateTime > simpleConsumerRouteUpdateInterval
+	if needUpdate {
+		self.routeUpdateTable[topic] = now
+	}
+	self.routeUpdateLock.Unlock()
+
+	if needUpdate {
+		self.mQClientFactory.UpdateTopicRouteInfoFromNameServerByTopic(topic)
+	}
+
+	value, _ := self.mQClientFactory.TopicRouteTable.Get(topic)
+	topicRouteData, ok := value.(*route.TopicRouteData)
+	if !ok || topicRouteData == nil {
+		return nil
+	}
+
+	brokerNames := make([]string, 0, len(topicRouteData.QueueDatas))
+	for _, queueData := range topicRouteData.QueueDatas {
+		if queueData.ReadQueueNums > 0 && constant.IsReadable(queueData.Perm) {
+			brokerNames = append(brokerNames, queueData.BrokerName)
+		}
+	}
+	return brokerNames
+}
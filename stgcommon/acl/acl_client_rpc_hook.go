@@ -0,0 +1,43 @@
+package acl
+
+import (
+	"strconv"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon/utils/timeutil"
+	"git.oschina.net/cloudzone/smartgo/stgnet/netm"
+	"git.oschina.net/cloudzone/smartgo/stgnet/protocol"
+)
+
+// AclClientRPCHook 客户端签名hook，发送请求前写入AccessKey并对请求签名
+// 使用方式: process.NewDefaultMQProducer(group, acl.NewAclClientRPCHook(accessKey, secretKey))
+// Since 2018/1/26
+type AclClientRPCHook struct {
+	accessKey string
+	secretKey string
+}
+
+// NewAclClientRPCHook 初始化
+// Since 2018/1/26
+func NewAclClientRPCHook(accessKey, secretKey string) *AclClientRPCHook {
+	return &AclClientRPCHook{accessKey: accessKey, secretKey: secretKey}
+}
+
+// DoBeforeRequest 对请求签名，签名内容包含当前时间戳，服务端据此拒绝过期的签名
+// Since 2018/1/26
+func (self *AclClientRPCHook) DoBeforeRequest(ctx netm.Context, request *protocol.RemotingCommand) error {
+	if request.ExtFields == nil {
+		request.ExtFields = make(map[string]string)
+	}
+
+	// CustomHeader在编码时才写入ExtFields，签名前需要先写入
+	request.MakeCustomHeaderToNet()
+	request.ExtFields[protocol.ACL_ACCESS_KEY] = self.accessKey
+	request.ExtFields[protocol.ACL_TIMESTAMP] = strconv.FormatInt(timeutil.CurrentTimeMillis(), 10)
+	request.ExtFields[protocol.ACL_SIGNATURE] = CalSignature(request, self.secretKey)
+	return nil
+}
+
+// DoAfterResponse 无处理
+// Since 2018/1/26
+func (self *AclClientRPCHook) DoAfterResponse(ctx netm.Context, request *protocol.RemotingCommand, response *protocol.RemotingCommand) {
+}
@@ -0,0 +1,50 @@
+package acl
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"sort"
+
+	"git.oschina.net/cloudzone/smartgo/stgnet/protocol"
+)
+
+// CalSignature 使用secretKey对请求计算HmacSHA1签名
+// 签名内容为按key排序后的extFields(不包含Signature，包含Timestamp)与body
+// Since 2018/1/26
+func CalSignature(request *protocol.RemotingCommand, secretKey string) string {
+	mac := hmac.New(sha1.New, []byte(secretKey))
+	mac.Write(signContent(request))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature 校验请求签名
+// Since 2018/1/26
+func VerifySignature(request *protocol.RemotingCommand, secretKey string) bool {
+	signature := request.ExtFields[protocol.ACL_SIGNATURE]
+	if signature == "" {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(CalSignature(request, secretKey)))
+}
+
+func signContent(request *protocol.RemotingCommand) []byte {
+	keys := make([]string, 0, len(request.ExtFields))
+	for k := range request.ExtFields {
+		if k != protocol.ACL_SIGNATURE {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var content bytes.Buffer
+	for _, k := range keys {
+		content.WriteString(k)
+		content.WriteByte('=')
+		content.WriteString(request.ExtFields[k])
+		content.WriteByte('&')
+	}
+	content.Write(request.Body)
+	return content.Bytes()
+}
@@ -0,0 +1,328 @@
+package acl
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
+	code "git.oschina.net/cloudzone/smartgo/stgcommon/protocol"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/body"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/heartbeat"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/utils/timeutil"
+	"git.oschina.net/cloudzone/smartgo/stgnet/netm"
+	"git.oschina.net/cloudzone/smartgo/stgnet/protocol"
+)
+
+const (
+	aclReloadInterval        = 5         // 检查plain_acl.toml是否修改的间隔（单位秒）
+	aclSignatureExpireMillis = 60 * 1000 // 签名时间戳与broker时间相差超过该值时拒绝请求，防止请求被截获后重放
+)
+
+// adminRequestCodes 需要管理员权限的请求
+var adminRequestCodes = map[int32]bool{
+	code.UPDATE_AND_CREATE_TOPIC:             true,
+	code.DELETE_TOPIC_IN_BROKER:              true,
+	code.UPDATE_BROKER_CONFIG:                true,
+	code.GET_BROKER_CONFIG:                   true,
+	code.TRIGGER_DELETE_FILES:                true,
+	code.UPDATE_AND_CREATE_SUBSCRIPTIONGROUP: true,
+	code.DELETE_SUBSCRIPTIONGROUP:            true,
+	code.WIPE_WRITE_PERM_OF_BROKER:           true,
+	code.RESET_CONSUMER_OFFSET_IN_BROKER:     true,
+	code.INVOKE_BROKER_TO_RESET_OFFSET:       true,
+	code.CLEAN_EXPIRED_CONSUMEQUEUE:          true,
+	code.CLONE_GROUP_OFFSET:                  true,
+	code.UPDATE_STORE_MODE:                   true,
+	code.REBUILD_CONSUME_QUEUE:               true,
+	code.CREATE_STORE_SNAPSHOT:               true,
+	code.UPDATE_AND_CREATE_QUOTA:             true,
+	code.DELETE_QUOTA:                        true,
+	code.GET_ALL_TOPIC_CONFIG:                true,
+	code.GET_ALL_CONSUMER_OFFSET:             true,
+	code.GET_ALL_SUBSCRIPTIONGROUP_CONFIG:    true,
+	code.VIEW_MESSAGE_BY_ID:                  true, // 请求只有commitlog offset，无法按topic校验
+	code.END_TRANSACTION:                     true, // 请求头不包含topic，无法按topic校验
+	code.REGISTER_FILTER_SERVER:              true,
+	code.CONSUME_MESSAGE_DIRECTLY:            true,
+	code.GET_CONSUMER_RUNNING_INFO:           true,
+	code.GET_CONSUME_STATS:                   true,
+	code.QUERY_CONSUME_TIME_SPAN:             true,
+	code.QUERY_BROKER_OFFSET:                 true,
+	code.GET_ALL_DELAY_OFFSET:                true,
+	code.GET_CONSUMER_LAG:                    true,
+}
+
+// resourcePerm 请求需要的topic/订阅组权限
+type resourcePerm struct {
+	name    string
+	isGroup bool
+	perm    Perm
+}
+
+// PlainAccessValidator 服务端ACL校验hook，校验请求签名及账号对topic、订阅组的权限
+// 账号配置来自plain_acl.toml，文件修改后自动重新加载
+// Since 2018/1/26
+type PlainAccessValidator struct {
+	filePath       string
+	lock           sync.RWMutex
+	whiteAddresses []string
+	accounts       map[string]*plainAccessResource
+	lastModified   time.Time
+	ticker         *timeutil.Ticker
+}
+
+// NewPlainAccessValidator 初始化并加载plain_acl.toml
+// Since 2018/1/26
+func NewPlainAccessValidator(filePath string) (*PlainAccessValidator, error) {
+	validator := &PlainAccessValidator{filePath: filePath}
+	if err := validator.load(); err != nil {
+		return nil, err
+	}
+
+	validator.ticker = timeutil.NewTicker(false, aclReloadInterval*time.Second, aclReloadInterval*time.Second, func() {
+		validator.reloadIfModified()
+	})
+	return validator, nil
+}
+
+// Start 启动配置文件热加载
+// Since 2018/1/26
+func (self *PlainAccessValidator) Start() {
+	self.ticker.Start()
+}
+
+// Shutdown 停止配置文件热加载
+// Since 2018/1/26
+func (self *PlainAccessValidator) Shutdown() {
+	self.ticker.Stop()
+}
+
+// DoBeforeRequest 校验请求，返回error时请求被拒绝
+// Since 2018/1/26
+func (self *PlainAccessValidator) DoBeforeRequest(ctx netm.Context, request *protocol.RemotingCommand) error {
+	self.lock.RLock()
+	whiteAddresses := self.whiteAddresses
+	accounts := self.accounts
+	self.lock.RUnlock()
+
+	if isWhiteRemoteAddress(whiteAddresses, ctx.Addr()) {
+		return nil
+	}
+
+	accessKey := request.ExtFields[protocol.ACL_ACCESS_KEY]
+	if accessKey == "" {
+		return fmt.Errorf("[ACL]no accessKey in request, code: %d", request.Code)
+	}
+
+	account, ok := accounts[accessKey]
+	if !ok {
+		return fmt.Errorf("[ACL]accessKey %s not exist", accessKey)
+	}
+	if !VerifySignature(request, account.secretKey) {
+		return fmt.Errorf("[ACL]check signature failed, accessKey: %s", accessKey)
+	}
+	if err := checkTimestamp(request, timeutil.CurrentTimeMillis()); err != nil {
+		return err
+	}
+
+	return checkPerm(account, request)
+}
+
+// DoAfterResponse 无处理
+// Since 2018/1/26
+func (self *PlainAccessValidator) DoAfterResponse(ctx netm.Context, request *protocol.RemotingCommand, response *protocol.RemotingCommand) {
+}
+
+func (self *PlainAccessValidator) load() error {
+	info, err := os.Stat(self.filePath)
+	if err != nil {
+		return err
+	}
+
+	whiteAddresses, accounts, err := loadPlainAclConfig(self.filePath)
+	if err != nil {
+		return fmt.Errorf("load %s failed: %s", self.filePath, err.Error())
+	}
+
+	self.lock.Lock()
+	self.whiteAddresses = whiteAddresses
+	self.accounts = accounts
+	self.lastModified = info.ModTime()
+	self.lock.Unlock()
+
+	logger.Infof("load acl config %s, accounts: %d whiteAddresses: %v", self.filePath, len(accounts), whiteAddresses)
+	return nil
+}
+
+// reloadIfModified 配置文件修改后重新加载，加载失败时保留原配置
+func (self *PlainAccessValidator) reloadIfModified() {
+	info, err := os.Stat(self.filePath)
+	if err != nil {
+		logger.Errorf("stat acl config %s failed: %s", self.filePath, err.Error())
+		return
+	}
+
+	self.lock.RLock()
+	modified := !info.ModTime().Equal(self.lastModified)
+	self.lock.RUnlock()
+	if !modified {
+		return
+	}
+
+	if err := self.load(); err != nil {
+		logger.Errorf("reload acl config failed, keep the old config. %s", err.Error())
+	}
+}
+
+// checkTimestamp 签名时间戳与当前时间相差超过aclSignatureExpireMillis的请求视为重放，拒绝处理
+func checkTimestamp(request *protocol.RemotingCommand, now int64) error {
+	timestamp, err := strconv.ParseInt(request.ExtFields[protocol.ACL_TIMESTAMP], 10, 64)
+	if err != nil {
+		return fmt.Errorf("[ACL]invalid timestamp in request, code: %d", request.Code)
+	}
+
+	if diff := now - timestamp; diff > aclSignatureExpireMillis || diff < -aclSignatureExpireMillis {
+		return fmt.Errorf("[ACL]signature expired, timestamp: %d now: %d", timestamp, now)
+	}
+	return nil
+}
+
+// checkPerm 校验账号是否拥有请求需要的权限，管理员拥有全部权限
+func checkPerm(account *plainAccessResource, request *protocol.RemotingCommand) error {
+	if account.admin {
+		return nil
+	}
+	if adminRequestCodes[request.Code] {
+		return fmt.Errorf("[ACL]accessKey %s has no admin permission, code: %d", account.accessKey, request.Code)
+	}
+
+	resources, ok := parseRequestResources(request)
+	if !ok {
+		return fmt.Errorf("[ACL]accessKey %s has no permission, code: %d", account.accessKey, request.Code)
+	}
+	for _, resource := range resources {
+		if resource.name == "" {
+			continue
+		}
+
+		if resource.isGroup {
+			if account.groupPerm(resource.name)&resource.perm != resource.perm {
+				return fmt.Errorf("[ACL]accessKey %s has no permission on group %s", account.accessKey, resource.name)
+			}
+			continue
+		}
+
+		if account.topicPerm(resource.name)&resource.perm != resource.perm {
+			return fmt.Errorf("[ACL]accessKey %s has no permission on topic %s", account.accessKey, resource.name)
+		}
+	}
+	return nil
+}
+
+// parseRequestResources 解析请求涉及的topic、订阅组，未列出的请求返回false，非管理员一律拒绝
+// extFields的key为CustomHeader的字段名
+func parseRequestResources(request *protocol.RemotingCommand) ([]*resourcePerm, bool) {
+	fields := request.ExtFields
+	switch request.Code {
+	case code.SEND_MESSAGE:
+		return []*resourcePerm{newTopicPerm(fields["Topic"], PUB)}, true
+	case code.SEND_MESSAGE_V2:
+		return []*resourcePerm{newTopicPerm(fields["B"], PUB)}, true
+	case code.CONSUMER_SEND_MSG_BACK:
+		return []*resourcePerm{newGroupPerm(fields["Group"])}, true
+	case code.PULL_MESSAGE, code.QUERY_CONSUMER_OFFSET, code.UPDATE_CONSUMER_OFFSET,
+		code.POP_MESSAGE, code.ACK_MESSAGE, code.CHANGE_INVISIBLE_TIME:
+		return []*resourcePerm{newTopicPerm(fields["Topic"], SUB), newGroupPerm(fields["ConsumerGroup"])}, true
+	case code.GET_CONSUMER_LIST_BY_GROUP, code.UNREGISTER_CLIENT, code.GET_CONSUMER_CONNECTION_LIST:
+		return []*resourcePerm{newGroupPerm(fields["ConsumerGroup"])}, true
+	case code.QUERY_MESSAGE, code.SEARCH_OFFSET_BY_TIMESTAMP, code.GET_MAX_OFFSET, code.GET_MIN_OFFSET,
+		code.GET_EARLIEST_MSG_STORETIME, code.GET_TOPIC_STATS_INFO, code.QUERY_TOPIC_CONSUME_BY_WHO:
+		return []*resourcePerm{newTopicPerm(fields["Topic"], SUB)}, true
+	case code.LOCK_BATCH_MQ, code.UNLOCK_BATCH_MQ:
+		return parseLockBatchResources(request.Code, request.Body), true
+	case code.HEART_BEAT:
+		return parseHeartbeatResources(request.Body), true
+	}
+	return nil, false
+}
+
+// parseLockBatchResources 锁定、解锁队列需要订阅组的SUB权限
+func parseLockBatchResources(requestCode int32, content []byte) []*resourcePerm {
+	var group string
+	if requestCode == code.LOCK_BATCH_MQ {
+		requestBody := body.NewLockBatchRequestBody()
+		if err := stgcommon.Decode(content, requestBody); err == nil {
+			group = requestBody.ConsumerGroup
+		}
+	} else {
+		requestBody := body.NewUnlockBatchRequestBody()
+		if err := stgcommon.Decode(content, requestBody); err == nil {
+			group = requestBody.ConsumerGroup
+		}
+	}
+	return []*resourcePerm{newGroupPerm(group)}
+}
+
+// parseHeartbeatResources 心跳中的订阅组及订阅的topic需要SUB权限
+func parseHeartbeatResources(body []byte) []*resourcePerm {
+	if len(body) == 0 {
+		return nil
+	}
+
+	heartbeatData := new(heartbeat.HeartbeatDataPlus).Decode(body)
+	var resources []*resourcePerm
+	for _, consumerData := range heartbeatData.ConsumerDataSet {
+		resources = append(resources, newGroupPerm(consumerData.GroupName))
+		for _, subscription := range consumerData.SubscriptionDataSet {
+			resources = append(resources, newTopicPerm(subscription.Topic, SUB))
+		}
+	}
+	return resources
+}
+
+// newTopicPerm 重试、死信topic属于订阅组，按订阅组SUB权限校验
+func newTopicPerm(topic string, perm Perm) *resourcePerm {
+	if strings.HasPrefix(topic, stgcommon.RETRY_GROUP_TOPIC_PREFIX) {
+		return newGroupPerm(strings.TrimPrefix(topic, stgcommon.RETRY_GROUP_TOPIC_PREFIX))
+	}
+	if strings.HasPrefix(topic, stgcommon.DLQ_GROUP_TOPIC_PREFIX) {
+		return newGroupPerm(strings.TrimPrefix(topic, stgcommon.DLQ_GROUP_TOPIC_PREFIX))
+	}
+	return &resourcePerm{name: topic, perm: perm}
+}
+
+func newGroupPerm(group string) *resourcePerm {
+	return &resourcePerm{name: group, isGroup: true, perm: SUB}
+}
+
+// isWhiteRemoteAddress 客户端IP是否在白名单中，"*"结尾的配置按前缀匹配
+func isWhiteRemoteAddress(whiteAddresses []string, addr string) bool {
+	if len(whiteAddresses) == 0 {
+		return false
+	}
+
+	host := addr
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		host = h
+	}
+
+	for _, white := range whiteAddresses {
+		white = strings.TrimSpace(white)
+		if strings.HasSuffix(white, "*") {
+			if strings.HasPrefix(host, strings.TrimSuffix(white, "*")) {
+				return true
+			}
+			continue
+		}
+		if white == host {
+			return true
+		}
+	}
+	return false
+}
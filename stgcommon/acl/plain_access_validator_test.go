@@ -0,0 +1,193 @@
+package acl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
+	code "git.oschina.net/cloudzone/smartgo/stgcommon/protocol"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/body"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/header"
+	"git.oschina.net/cloudzone/smartgo/stgnet/netm"
+	"git.oschina.net/cloudzone/smartgo/stgnet/protocol"
+)
+
+const testPlainAcl = `
+globalWhiteRemoteAddresses=["10.122.1.*"]
+
+[[accounts]]
+accessKey="admin"
+secretKey="admin123"
+admin=true
+
+[[accounts]]
+accessKey="teamA"
+secretKey="teamA123"
+defaultTopicPerm="DENY"
+defaultGroupPerm="DENY"
+topicPerms=["topicA=PUB|SUB", "topicB=PUB"]
+groupPerms=["groupA=SUB"]
+`
+
+type testContext struct {
+	netm.Context
+	addr string
+}
+
+func (ctx *testContext) Addr() string {
+	return ctx.addr
+}
+
+func newTestValidator(t *testing.T, content string) (*PlainAccessValidator, string) {
+	dir, err := ioutil.TempDir("", "acl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filePath := filepath.Join(dir, PLAIN_ACL_FILE_NAME)
+	if err := ioutil.WriteFile(filePath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	validator, err := NewPlainAccessValidator(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return validator, filePath
+}
+
+func signedRequest(requestCode int32, customHeader protocol.CommandCustomHeader, accessKey, secretKey string) *protocol.RemotingCommand {
+	request := protocol.CreateRequestCommand(requestCode, customHeader)
+	NewAclClientRPCHook(accessKey, secretKey).DoBeforeRequest(nil, request)
+	return request
+}
+
+func lockBatchRequest(requestCode int32, group, accessKey, secretKey string) *protocol.RemotingCommand {
+	requestBody := body.NewLockBatchRequestBody()
+	requestBody.ConsumerGroup = group
+	request := protocol.CreateRequestCommand(requestCode)
+	request.Body = stgcommon.Encode(requestBody)
+	NewAclClientRPCHook(accessKey, secretKey).DoBeforeRequest(nil, request)
+	return request
+}
+
+func TestPlainAccessValidator_DoBeforeRequest(t *testing.T) {
+	validator, filePath := newTestValidator(t, testPlainAcl)
+	defer os.RemoveAll(filepath.Dir(filePath))
+	ctx := &testContext{addr: "192.168.0.1:5000"}
+
+	sendHeader := func(topic string) *header.SendMessageRequestHeader {
+		return &header.SendMessageRequestHeader{ProducerGroup: "producer", Topic: topic}
+	}
+	pullHeader := &header.PullMessageRequestHeader{ConsumerGroup: "groupA", Topic: "topicA"}
+
+	cases := []struct {
+		name    string
+		request *protocol.RemotingCommand
+		allow   bool
+	}{
+		{"pub topicA", signedRequest(code.SEND_MESSAGE, sendHeader("topicA"), "teamA", "teamA123"), true},
+		{"pub topicC", signedRequest(code.SEND_MESSAGE, sendHeader("topicC"), "teamA", "teamA123"), false},
+		{"pub retry topic", signedRequest(code.SEND_MESSAGE, sendHeader("%RETRY%groupA"), "teamA", "teamA123"), true},
+		{"pull topicA", signedRequest(code.PULL_MESSAGE, pullHeader, "teamA", "teamA123"), true},
+		{"pull topicB", signedRequest(code.PULL_MESSAGE, &header.PullMessageRequestHeader{ConsumerGroup: "groupA", Topic: "topicB"}, "teamA", "teamA123"), false},
+		{"delete topic", signedRequest(code.DELETE_TOPIC_IN_BROKER, &header.DeleteTopicRequestHeader{Topic: "topicA"}, "teamA", "teamA123"), false},
+		{"admin delete topic", signedRequest(code.DELETE_TOPIC_IN_BROKER, &header.DeleteTopicRequestHeader{Topic: "topicA"}, "admin", "admin123"), true},
+		{"wrong secretKey", signedRequest(code.SEND_MESSAGE, sendHeader("topicA"), "teamA", "wrong"), false},
+		{"unknown accessKey", signedRequest(code.SEND_MESSAGE, sendHeader("topicA"), "teamB", "teamA123"), false},
+		{"no signature", protocol.CreateRequestCommand(code.SEND_MESSAGE, sendHeader("topicA")), false},
+		{"query message topicA", signedRequest(code.QUERY_MESSAGE, &header.QueryMessageRequestHeader{Topic: "topicA"}, "teamA", "teamA123"), true},
+		{"query message topicB", signedRequest(code.QUERY_MESSAGE, &header.QueryMessageRequestHeader{Topic: "topicB"}, "teamA", "teamA123"), false},
+		{"max offset topicC", signedRequest(code.GET_MAX_OFFSET, &header.GetMaxOffsetRequestHeader{Topic: "topicC"}, "teamA", "teamA123"), false},
+		{"search offset topicA", signedRequest(code.SEARCH_OFFSET_BY_TIMESTAMP, &header.SearchOffsetRequestHeader{Topic: "topicA"}, "teamA", "teamA123"), true},
+		{"get all topic config", signedRequest(code.GET_ALL_TOPIC_CONFIG, nil, "teamA", "teamA123"), false},
+		{"get all consumer offset", signedRequest(code.GET_ALL_CONSUMER_OFFSET, nil, "teamA", "teamA123"), false},
+		{"admin get all topic config", signedRequest(code.GET_ALL_TOPIC_CONFIG, nil, "admin", "admin123"), true},
+		{"end transaction", signedRequest(code.END_TRANSACTION, &header.EndTransactionRequestHeader{ProducerGroup: "producer"}, "teamA", "teamA123"), false},
+		{"lock groupA", lockBatchRequest(code.LOCK_BATCH_MQ, "groupA", "teamA", "teamA123"), true},
+		{"lock groupB", lockBatchRequest(code.LOCK_BATCH_MQ, "groupB", "teamA", "teamA123"), false},
+		{"unlock groupB", lockBatchRequest(code.UNLOCK_BATCH_MQ, "groupB", "teamA", "teamA123"), false},
+		{"register filter server", signedRequest(code.REGISTER_FILTER_SERVER, nil, "teamA", "teamA123"), false},
+		{"get consume stats", signedRequest(code.GET_CONSUME_STATS, &header.GetConsumeStatsRequestHeader{ConsumerGroup: "groupA", Topic: "topicA"}, "teamA", "teamA123"), false},
+		{"consumer connection groupA", signedRequest(code.GET_CONSUMER_CONNECTION_LIST, &header.GetConsumerConnectionListRequestHeader{ConsumerGroup: "groupA"}, "teamA", "teamA123"), true},
+		{"consumer connection groupB", signedRequest(code.GET_CONSUMER_CONNECTION_LIST, &header.GetConsumerConnectionListRequestHeader{ConsumerGroup: "groupB"}, "teamA", "teamA123"), false},
+		{"topic stats topicB", signedRequest(code.GET_TOPIC_STATS_INFO, &header.GetTopicStatsInfoRequestHeader{Topic: "topicB"}, "teamA", "teamA123"), false},
+		{"unlisted code", signedRequest(code.GET_BROKER_RUNTIME_INFO, nil, "teamA", "teamA123"), false},
+		{"unknown code", signedRequest(9999, nil, "teamA", "teamA123"), false},
+		{"admin unlisted code", signedRequest(code.GET_BROKER_RUNTIME_INFO, nil, "admin", "admin123"), true},
+	}
+
+	for _, c := range cases {
+		if err := validator.DoBeforeRequest(ctx, c.request); (err == nil) != c.allow {
+			t.Errorf("%s: expect allow %t, err: %v", c.name, c.allow, err)
+		}
+	}
+
+	// 签名后修改请求内容，签名校验失败
+	request := signedRequest(code.SEND_MESSAGE, sendHeader("topicA"), "teamA", "teamA123")
+	request.ExtFields["Topic"] = "topicB"
+	if validator.DoBeforeRequest(ctx, request) == nil {
+		t.Error("tampered request should be rejected")
+	}
+
+	// 签名时间戳过期的请求视为重放
+	request = signedRequest(code.SEND_MESSAGE, sendHeader("topicA"), "teamA", "teamA123")
+	request.ExtFields[protocol.ACL_TIMESTAMP] = strconv.FormatInt(time.Now().Add(-2*time.Minute).UnixNano()/int64(time.Millisecond), 10)
+	request.ExtFields[protocol.ACL_SIGNATURE] = CalSignature(request, "teamA123")
+	if validator.DoBeforeRequest(ctx, request) == nil {
+		t.Error("request with stale signature should be rejected")
+	}
+	delete(request.ExtFields, protocol.ACL_TIMESTAMP)
+	request.ExtFields[protocol.ACL_SIGNATURE] = CalSignature(request, "teamA123")
+	if validator.DoBeforeRequest(ctx, request) == nil {
+		t.Error("request without timestamp should be rejected")
+	}
+
+	// 白名单内的地址不做校验
+	if err := validator.DoBeforeRequest(&testContext{addr: "10.122.1.210:5000"}, protocol.CreateRequestCommand(code.DELETE_TOPIC_IN_BROKER)); err != nil {
+		t.Errorf("white remote address should be allowed, err: %v", err)
+	}
+
+	// ACL扩展字段不影响CustomHeader解析
+	decodeHeader := new(header.PullMessageRequestHeader)
+	if err := signedRequest(code.PULL_MESSAGE, pullHeader, "teamA", "teamA123").DecodeCommandCustomHeader(decodeHeader); err != nil || decodeHeader.Topic != "topicA" {
+		t.Errorf("decode signed request header failed, err: %v", err)
+	}
+}
+
+func TestPlainAccessValidator_Reload(t *testing.T) {
+	validator, filePath := newTestValidator(t, testPlainAcl)
+	defer os.RemoveAll(filepath.Dir(filePath))
+	ctx := &testContext{addr: "192.168.0.1:5000"}
+
+	request := signedRequest(code.SEND_MESSAGE, &header.SendMessageRequestHeader{Topic: "topicC"}, "teamA", "teamA123")
+	if validator.DoBeforeRequest(ctx, request) == nil {
+		t.Fatal("pub topicC should be rejected before reload")
+	}
+
+	content := testPlainAcl + `
+[[accounts]]
+accessKey="teamC"
+secretKey="teamC123"
+defaultTopicPerm="PUB"
+`
+	ioutil.WriteFile(filePath, []byte(content), 0644)
+	os.Chtimes(filePath, time.Now(), time.Now().Add(time.Second))
+	validator.reloadIfModified()
+
+	request = signedRequest(code.SEND_MESSAGE, &header.SendMessageRequestHeader{Topic: "topicC"}, "teamC", "teamC123")
+	if err := validator.DoBeforeRequest(ctx, request); err != nil {
+		t.Errorf("pub topicC should be allowed after reload, err: %v", err)
+	}
+
+	// 配置错误时保留原配置
+	ioutil.WriteFile(filePath, []byte(content+"\n[[accounts]]\naccessKey=\"teamD\"\n"), 0644)
+	os.Chtimes(filePath, time.Now(), time.Now().Add(2*time.Second))
+	validator.reloadIfModified()
+	if err := validator.DoBeforeRequest(ctx, request); err != nil {
+		t.Errorf("invalid config should not replace the old one, err: %v", err)
+	}
+}
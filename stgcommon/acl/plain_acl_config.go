@@ -0,0 +1,160 @@
+package acl
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Perm topic/group权限，DENY表示无权限
+// Since 2018/1/26
+type Perm int
+
+const (
+	DENY Perm = 0
+	PUB  Perm = 1 << 0
+	SUB  Perm = 1 << 1
+)
+
+const (
+	PLAIN_ACL_FILE_NAME = "plain_acl.toml"
+)
+
+// PlainAclConfig plain_acl.toml配置
+// Since 2018/1/26
+type PlainAclConfig struct {
+	GlobalWhiteRemoteAddresses []string        // 不做校验的客户端IP，支持"10.122.1.*"形式，用于集群内部broker之间的请求
+	Accounts                   []*PlainAccount // 账号列表
+}
+
+// PlainAccount 账号配置
+// 权限格式为"DENY"、"PUB"、"SUB"或"PUB|SUB"，topicPerms、groupPerms的每一项格式为"名称=权限"
+// Since 2018/1/26
+type PlainAccount struct {
+	AccessKey        string
+	SecretKey        string
+	Admin            bool     // 是否允许执行创建/删除topic、订阅组，更新broker配置，重置offset等管理操作
+	DefaultTopicPerm string   // 未在topicPerms中配置的topic权限，默认DENY
+	DefaultGroupPerm string   // 未在groupPerms中配置的订阅组权限，默认DENY
+	TopicPerms       []string // 例如: ["topicA=PUB|SUB", "topicB=DENY"]
+	GroupPerms       []string // 例如: ["groupA=SUB"]
+}
+
+// plainAccessResource 解析后的账号权限
+type plainAccessResource struct {
+	accessKey        string
+	secretKey        string
+	admin            bool
+	defaultTopicPerm Perm
+	defaultGroupPerm Perm
+	topicPerms       map[string]Perm
+	groupPerms       map[string]Perm
+}
+
+// ParsePerm 解析权限字符串
+// Since 2018/1/26
+func ParsePerm(value string) (Perm, error) {
+	perm := DENY
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return perm, nil
+	}
+
+	for _, item := range strings.Split(value, "|") {
+		switch strings.ToUpper(strings.TrimSpace(item)) {
+		case "DENY":
+			return DENY, nil
+		case "PUB":
+			perm |= PUB
+		case "SUB":
+			perm |= SUB
+		default:
+			return DENY, fmt.Errorf("invalid perm: %s", value)
+		}
+	}
+	return perm, nil
+}
+
+// loadPlainAclConfig 读取并解析plain_acl.toml
+func loadPlainAclConfig(filePath string) ([]string, map[string]*plainAccessResource, error) {
+	var cfg PlainAclConfig
+	if _, err := toml.DecodeFile(filePath, &cfg); err != nil {
+		return nil, nil, err
+	}
+
+	accounts := make(map[string]*plainAccessResource)
+	for _, account := range cfg.Accounts {
+		resource, err := parsePlainAccount(account)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, ok := accounts[resource.accessKey]; ok {
+			return nil, nil, fmt.Errorf("duplicate accessKey: %s", resource.accessKey)
+		}
+		accounts[resource.accessKey] = resource
+	}
+
+	return cfg.GlobalWhiteRemoteAddresses, accounts, nil
+}
+
+func parsePlainAccount(account *PlainAccount) (*plainAccessResource, error) {
+	accessKey := strings.TrimSpace(account.AccessKey)
+	if accessKey == "" || account.SecretKey == "" {
+		return nil, fmt.Errorf("accessKey and secretKey can not be empty")
+	}
+
+	resource := &plainAccessResource{
+		accessKey: accessKey,
+		secretKey: account.SecretKey,
+		admin:     account.Admin,
+	}
+
+	var err error
+	if resource.defaultTopicPerm, err = ParsePerm(account.DefaultTopicPerm); err != nil {
+		return nil, fmt.Errorf("accessKey: %s defaultTopicPerm %s", accessKey, err.Error())
+	}
+	if resource.defaultGroupPerm, err = ParsePerm(account.DefaultGroupPerm); err != nil {
+		return nil, fmt.Errorf("accessKey: %s defaultGroupPerm %s", accessKey, err.Error())
+	}
+	if resource.topicPerms, err = parseResourcePerms(account.TopicPerms); err != nil {
+		return nil, fmt.Errorf("accessKey: %s topicPerms %s", accessKey, err.Error())
+	}
+	if resource.groupPerms, err = parseResourcePerms(account.GroupPerms); err != nil {
+		return nil, fmt.Errorf("accessKey: %s groupPerms %s", accessKey, err.Error())
+	}
+	return resource, nil
+}
+
+func parseResourcePerms(items []string) (map[string]Perm, error) {
+	perms := make(map[string]Perm, len(items))
+	for _, item := range items {
+		index := strings.LastIndex(item, "=")
+		if index <= 0 {
+			return nil, fmt.Errorf("invalid item: %s", item)
+		}
+
+		perm, err := ParsePerm(item[index+1:])
+		if err != nil {
+			return nil, err
+		}
+		perms[strings.TrimSpace(item[:index])] = perm
+	}
+	return perms, nil
+}
+
+// topicPerm 查询topic权限
+func (self *plainAccessResource) topicPerm(topic string) Perm {
+	if perm, ok := self.topicPerms[topic]; ok {
+		return perm
+	}
+	return self.defaultTopicPerm
+}
+
+// groupPerm 查询订阅组权限
+func (self *plainAccessResource) groupPerm(group string) Perm {
+	if perm, ok := self.groupPerms[group]; ok {
+		return perm
+	}
+	return self.defaultGroupPerm
+}
@@ -5,9 +5,11 @@ import (
 	"git.oschina.net/cloudzone/smartgo/stgclient"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/constant"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
+	"git.oschina.net/cloudzone/smartgo/stgnet/netm"
 	"os"
 	"runtime"
 	"strings"
+	"sync"
 )
 
 const (
@@ -46,12 +48,30 @@ type BrokerConfig struct {
 	FetchNamesrvAddrByAddressServer    bool   `json:"fetchNamesrvAddrByAddressServer"`    // 是否从地址服务器寻找NameServer地址，正式发布后，默认值为false
 	SendThreadPoolQueueCapacity        int    `json:"sendThreadPoolQueueCapacity"`        // 发送消息对应的线程池阻塞队列size
 	PullThreadPoolQueueCapacity        int    `json:"pullThreadPoolQueueCapacity"`        // 订阅消息对应的线程池阻塞队列size
+	AdminThreadPoolQueueCapacity       int    `json:"adminThreadPoolQueueCapacity"`       // 管理请求对应的线程池阻塞队列size
+	ClientThreadPoolQueueCapacity      int    `json:"clientThreadPoolQueueCapacity"`      // 客户端管理请求对应的线程池阻塞队列size
+	WaitTimeMillsInSendQueue           int64  `json:"waitTimeMillsInSendQueue"`           // 发送消息请求在队列中的最长等待时间，超时返回SYSTEM_BUSY，0表示不检查
+	WaitTimeMillsInPullQueue           int64  `json:"waitTimeMillsInPullQueue"`           // 拉取消息请求在队列中的最长等待时间，超时返回SYSTEM_BUSY，0表示不检查
 	FilterServerNums                   int32  `json:"filterServerNums"`                   // 过滤服务器数量
 	LongPollingEnable                  bool   `json:"longPollingEnable"`                  // Consumer订阅消息时，Broker是否开启长轮询
 	ShortPollingTimeMills              int    `json:"shortPollingTimeMills"`              // 如果是短轮询，服务器挂起时间
 	NotifyConsumerIdsChangedEnable     bool   `json:"notifyConsumerIdsChangedEnable"`     // notify consumerId changed 开关
 	OffsetCheckInSlave                 bool   `json:"offsetCheckInSlave"`                 // slave 是否需要纠正位点
+	SlaveReadEnable                    bool   `json:"slaveReadEnable"`                    // 消息不在内存中时是否建议consumer从slave拉取，关闭后只建议从master拉取
 	HaMasterAddress                    string `json:"haMasterAddress"`                    // 适用场景：HA功能配置(将slave角色的 ha地址，指向master角色)
+	TransferMsgByHeap                  bool   `json:"transferMsgByHeap"`                  // 拉取消息时是否先拷贝到堆内存再发送，默认通过writev直接发送mmap数据
+	AclEnable                          bool   `json:"aclEnable"`                          // 是否开启ACL权限校验
+	AclConfigPath                      string `json:"aclConfigPath"`                      // ACL账号配置文件plain_acl.toml的路径
+
+	TlsConfig *netm.TlsConfig `json:"tlsConfig"` // remoting及HA连接的TLS配置，broker配置文件未配置时使用环境变量
+
+	MetricsPort              int   `json:"metricsPort"`              // Prometheus /metrics HTTP端口，0表示不开启
+	ConsumerLagCalcInterval  int64 `json:"consumerLagCalcInterval"`  // 计算消费延迟的间隔（单位毫秒）
+	ConsumerLagAlertMessages int64 `json:"consumerLagAlertMessages"` // 消费延迟消息数超过该值时告警，0表示不告警
+	ConsumerLagAlertSeconds  int64 `json:"consumerLagAlertSeconds"`  // 消费延迟秒数超过该值时告警，0表示不告警
+	QuotaEnable              bool  `json:"quotaEnable"`              // 是否按限流配额校验发送、拉取请求
+
+	lock sync.RWMutex // 保护可热更新的配置项
 }
 
 // NewDefaultBrokerConfig 初始化默认BrokerConfig（默认AutoCreateTopicEnable=true）
@@ -82,11 +102,20 @@ func NewDefaultBrokerConfig() *BrokerConfig {
 		FetchNamesrvAddrByAddressServer:    false,
 		SendThreadPoolQueueCapacity:        100000,
 		PullThreadPoolQueueCapacity:        100000,
+		AdminThreadPoolQueueCapacity:       10000,
+		ClientThreadPoolQueueCapacity:      100000,
+		WaitTimeMillsInSendQueue:           200,
+		WaitTimeMillsInPullQueue:           5000,
 		FilterServerNums:                   0,
 		LongPollingEnable:                  true,
 		ShortPollingTimeMills:              1000,
 		NotifyConsumerIdsChangedEnable:     true,
 		OffsetCheckInSlave:                 true,
+		SlaveReadEnable:                    true,
+		TransferMsgByHeap:                  false,
+		TlsConfig:                          netm.NewTlsConfigFromEnv(),
+		ConsumerLagCalcInterval:            1000 * 30,
+		QuotaEnable:                        true,
 	}
 
 	return brokerConfig
@@ -104,6 +133,15 @@ func NewCustomBrokerConfig(cfg *SmartgoBrokerConfig) *BrokerConfig {
 	brokerConfig.StorePathRootDir = cfg.StorePathRootDir
 	brokerConfig.BrokerPort = cfg.BrokerPort
 	brokerConfig.HaMasterAddress = strings.TrimSpace(cfg.HaMasterAddress)
+	brokerConfig.AclEnable = cfg.AclEnable
+	brokerConfig.AclConfigPath = strings.TrimSpace(cfg.AclConfigPath)
+	brokerConfig.MetricsPort = cfg.MetricsPort
+	brokerConfig.ConsumerLagAlertMessages = cfg.ConsumerLagAlertMessages
+	brokerConfig.ConsumerLagAlertSeconds = cfg.ConsumerLagAlertSeconds
+	if strings.TrimSpace(cfg.Tls.Mode) != "" {
+		tlsConfig := cfg.Tls
+		brokerConfig.TlsConfig = &tlsConfig
+	}
 
 	if brokerConfig.BrokerIP1 == "" {
 		if cfg.BrokerIP == "" {
@@ -181,14 +219,14 @@ func (self *BrokerConfig) CheckBrokerConfigAttr(smartgoBrokerFilePath ...string)
 // Author: tianyuliang
 // Since: 2017/9/29
 func (self *BrokerConfig) HasReadable() bool {
-	return constant.IsReadable(self.BrokerPermission)
+	return constant.IsReadable(self.GetBrokerPermission())
 }
 
 // HasWriteable 校验Broker是否有写权限
 // Author: tianyuliang
 // Since: 2017/9/29
 func (self *BrokerConfig) HasWriteable() bool {
-	return constant.IsWriteable(self.BrokerPermission)
+	return constant.IsWriteable(self.GetBrokerPermission())
 }
 
 // GetDefaultBrokerName 获取默认broker名称
@@ -197,3 +235,143 @@ func (self *BrokerConfig) HasWriteable() bool {
 func GetDefaultBrokerName() string {
 	return defaultBrokerClusterName
 }
+
+// Lock、Unlock 热更新配置时由配置注册表持有写锁，运行中读取可热更新的配置项需通过下面的GetXxx方法
+// Since 2018/2/5
+func (self *BrokerConfig) Lock() {
+	self.lock.Lock()
+}
+
+func (self *BrokerConfig) Unlock() {
+	self.lock.Unlock()
+}
+
+// RLock、RUnlock 读取完整配置(如编码为json)时持有读锁
+// Since 2018/2/5
+func (self *BrokerConfig) RLock() {
+	self.lock.RLock()
+}
+
+func (self *BrokerConfig) RUnlock() {
+	self.lock.RUnlock()
+}
+
+func (self *BrokerConfig) GetAutoCreateSubscriptionGroup() bool {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.AutoCreateSubscriptionGroup
+}
+
+func (self *BrokerConfig) GetAutoCreateTopicEnable() bool {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.AutoCreateTopicEnable
+}
+
+func (self *BrokerConfig) GetBrokerPermission() int {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.BrokerPermission
+}
+
+func (self *BrokerConfig) GetConsumerLagAlertMessages() int64 {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.ConsumerLagAlertMessages
+}
+
+func (self *BrokerConfig) GetConsumerLagAlertSeconds() int64 {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.ConsumerLagAlertSeconds
+}
+
+func (self *BrokerConfig) GetConsumerLagCalcInterval() int64 {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.ConsumerLagCalcInterval
+}
+
+func (self *BrokerConfig) GetDefaultTopicQueueNums() int32 {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.DefaultTopicQueueNums
+}
+
+func (self *BrokerConfig) GetFilterServerNums() int32 {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.FilterServerNums
+}
+
+func (self *BrokerConfig) GetFlushConsumerOffsetInterval() int {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.FlushConsumerOffsetInterval
+}
+
+func (self *BrokerConfig) GetLongPollingEnable() bool {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.LongPollingEnable
+}
+
+func (self *BrokerConfig) GetNamesrvAddr() string {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.NamesrvAddr
+}
+
+func (self *BrokerConfig) GetNotifyConsumerIdsChangedEnable() bool {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.NotifyConsumerIdsChangedEnable
+}
+
+func (self *BrokerConfig) GetOffsetCheckInSlave() bool {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.OffsetCheckInSlave
+}
+
+func (self *BrokerConfig) GetQuotaEnable() bool {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.QuotaEnable
+}
+
+func (self *BrokerConfig) GetRejectTransactionMessage() bool {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.RejectTransactionMessage
+}
+
+func (self *BrokerConfig) GetShortPollingTimeMills() int {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.ShortPollingTimeMills
+}
+
+func (self *BrokerConfig) GetSlaveReadEnable() bool {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.SlaveReadEnable
+}
+
+func (self *BrokerConfig) GetTransferMsgByHeap() bool {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.TransferMsgByHeap
+}
+
+func (self *BrokerConfig) GetWaitTimeMillsInPullQueue() int64 {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.WaitTimeMillsInPullQueue
+}
+
+func (self *BrokerConfig) GetWaitTimeMillsInSendQueue() int64 {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.WaitTimeMillsInSendQueue
+}
@@ -0,0 +1,78 @@
+package expression
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Context 表达式求值时读取变量，变量不存在时返回false，表达式中按NULL处理
+// Since 2018/2/5
+type Context interface {
+	Get(name string) (string, bool)
+}
+
+// MapContext 以map保存变量的Context
+// Since 2018/2/5
+type MapContext map[string]string
+
+// Get 读取变量
+// Since 2018/2/5
+func (self MapContext) Get(name string) (string, bool) {
+	value, ok := self[name]
+	return value, ok
+}
+
+// Expression 编译后的过滤表达式，语法为SQL92 WHERE子句的子集：
+//
+// 逻辑运算：AND、OR、NOT（也可写作&&、||、!）及括号
+// 比较运算：=、<>、!=、>、>=、<、<=
+// 其他谓词：[NOT] IN (...)、[NOT] BETWEEN a AND b、IS [NOT] NULL、[NOT] LIKE 'a%_'、
+// [NOT] CONTAINS、[NOT] STARTSWITH、[NOT] ENDSWITH
+// 常量：单引号字符串（字符串中的单引号写作两个单引号）、整数、小数、TRUE、FALSE、NULL
+//
+// 变量的值均为字符串，与数值或布尔常量比较时按对应类型转换，无法转换或变量不存在时谓词不成立
+// Since 2018/2/5
+type Expression struct {
+	source string
+	root   node
+}
+
+// Compile 编译过滤表达式
+// Since 2018/2/5
+func Compile(source string) (*Expression, error) {
+	if strings.TrimSpace(source) == "" {
+		return nil, fmt.Errorf("filter expression is blank")
+	}
+
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isEnd() {
+		return nil, p.errorf("unexpected %s", p.peek().text)
+	}
+
+	return &Expression{source: source, root: root}, nil
+}
+
+// Evaluate 根据ctx中的变量对表达式求值
+// Since 2018/2/5
+func (self *Expression) Evaluate(ctx Context) bool {
+	return self.root.evaluate(ctx)
+}
+
+// Source 表达式原文
+// Since 2018/2/5
+func (self *Expression) Source() string {
+	return self.source
+}
+
+func (self *Expression) String() string {
+	return fmt.Sprintf("Expression {%s}", self.source)
+}
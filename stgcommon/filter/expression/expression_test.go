@@ -0,0 +1,75 @@
+package expression
+
+import (
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	ctx := MapContext{
+		"TAGS":   "TagA",
+		"KEYS":   "order_1001",
+		"region": "hangzhou",
+		"amount": "150",
+		"price":  "9.5",
+		"vip":    "true",
+		"BODY":   "{\"status\":\"PAID\"}",
+	}
+
+	cases := map[string]bool{
+		"TAGS = 'TagA'":                                     true,
+		"TAGS <> 'TagA'":                                    false,
+		"TAGS == 'TagA' && region != 'beijing'":             true,
+		"amount > 100 AND amount <= 150":                    true,
+		"amount > 100.5":                                    true,
+		"price < 10":                                        true,
+		"amount BETWEEN 100 AND 200":                        true,
+		"amount NOT BETWEEN 100 AND 200":                    false,
+		"region IN ('hangzhou', 'shanghai')":                true,
+		"region NOT IN ('hangzhou', 'shanghai')":            false,
+		"vip":                                               true,
+		"vip = TRUE":                                        true,
+		"NOT vip OR amount < 100":                           false,
+		"!(region = 'beijing')":                             true,
+		"missing IS NULL":                                   true,
+		"region IS NOT NULL":                                true,
+		"missing = 'a' OR missing <> 'a'":                   false,
+		"KEYS LIKE 'order_10%'":                             true,
+		"KEYS NOT LIKE '%99'":                               true,
+		"BODY CONTAINS '\"PAID\"'":                          true,
+		"KEYS STARTSWITH 'order' and KEYS endswith '1'":     true,
+		"region > 5":                                        false,
+		"(TAGS = 'TagB' OR TAGS = 'TagA') AND amount = 150": true,
+		"region = 'it''s'":                                  false,
+	}
+
+	for source, expect := range cases {
+		expr, err := Compile(source)
+		if err != nil {
+			t.Fatalf("compile %s: %s", source, err.Error())
+		}
+		if result := expr.Evaluate(ctx); result != expect {
+			t.Errorf("evaluate %s = %t, expect %t", source, result, expect)
+		}
+	}
+}
+
+func TestCompileError(t *testing.T) {
+	invalids := []string{
+		"",
+		"TAGS =",
+		"TAGS = 'TagA",
+		"(TAGS = 'TagA'",
+		"amount BETWEEN 1",
+		"region IN 'a'",
+		"KEYS LIKE 1",
+		"TAGS = 'TagA' region",
+		"amount # 1",
+		"region NOT = 'a'",
+	}
+
+	for _, source := range invalids {
+		if _, err := Compile(source); err == nil {
+			t.Errorf("%s should be invalid", source)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package expression
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenIdent tokenKind = iota
+	tokenKeyword
+	tokenString
+	tokenNumber
+	tokenOperator
+	tokenLeftParen
+	tokenRightParen
+	tokenComma
+	tokenEnd
+)
+
+var keywords = map[string]bool{
+	"AND":        true,
+	"OR":         true,
+	"NOT":        true,
+	"IN":         true,
+	"BETWEEN":    true,
+	"IS":         true,
+	"NULL":       true,
+	"LIKE":       true,
+	"TRUE":       true,
+	"FALSE":      true,
+	"CONTAINS":   true,
+	"STARTSWITH": true,
+	"ENDSWITH":   true,
+}
+
+// token 词法单元，关键字的text统一为大写，&&、||、!分别转换为AND、OR、NOT
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// tokenize 将表达式拆分为词法单元，最后一个为tokenEnd
+func tokenize(source string) ([]token, error) {
+	var (
+		tokens []token
+		runes  = []rune(source)
+	)
+
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLeftParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRightParen, text: ")", pos: i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", pos: i})
+			i++
+		case c == '\'':
+			text, next, err := readString(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, pos: i})
+			i = next
+		case isDigit(c) || (c == '-' && i+1 < len(runes) && isDigit(runes[i+1])) || (c == '.' && i+1 < len(runes) && isDigit(runes[i+1])):
+			start := i
+			i++
+			for i < len(runes) && (isDigit(runes[i]) || runes[i] == '.' || runes[i] == 'e' || runes[i] == 'E' ||
+				((runes[i] == '+' || runes[i] == '-') && (runes[i-1] == 'e' || runes[i-1] == 'E'))) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: string(runes[start:i]), pos: start})
+		case isIdentStart(c):
+			start := i
+			for i < len(runes) && isIdentPart(runes[i]) {
+				i++
+			}
+			text := string(runes[start:i])
+			if upper := strings.ToUpper(text); keywords[upper] {
+				tokens = append(tokens, token{kind: tokenKeyword, text: upper, pos: start})
+			} else {
+				tokens = append(tokens, token{kind: tokenIdent, text: text, pos: start})
+			}
+		default:
+			text, err := readOperator(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			switch text {
+			case "&&":
+				tokens = append(tokens, token{kind: tokenKeyword, text: "AND", pos: i})
+			case "||":
+				tokens = append(tokens, token{kind: tokenKeyword, text: "OR", pos: i})
+			case "!":
+				tokens = append(tokens, token{kind: tokenKeyword, text: "NOT", pos: i})
+			default:
+				tokens = append(tokens, token{kind: tokenOperator, text: text, pos: i})
+			}
+			i += len([]rune(text))
+		}
+	}
+
+	tokens = append(tokens, token{kind: tokenEnd, text: "end of expression", pos: len(runes)})
+	return tokens, nil
+}
+
+// readString 读取单引号字符串，两个连续的单引号表示一个单引号
+func readString(runes []rune, start int) (string, int, error) {
+	var text []rune
+	for i := start + 1; i < len(runes); i++ {
+		if runes[i] != '\'' {
+			text = append(text, runes[i])
+			continue
+		}
+		if i+1 < len(runes) && runes[i+1] == '\'' {
+			text = append(text, '\'')
+			i++
+			continue
+		}
+		return string(text), i + 1, nil
+	}
+	return "", 0, fmt.Errorf("unterminated string at position %d", start)
+}
+
+// readOperator 读取比较运算符及&&、||、!
+func readOperator(runes []rune, start int) (string, error) {
+	if start+1 < len(runes) {
+		switch two := string(runes[start : start+2]); two {
+		case "<>", "!=", ">=", "<=", "==", "&&", "||":
+			return two, nil
+		}
+	}
+
+	switch runes[start] {
+	case '=', '>', '<', '!':
+		return string(runes[start]), nil
+	}
+	return "", fmt.Errorf("unexpected character '%c' at position %d", runes[start], start)
+}
+
+func isDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c rune) bool {
+	return c == '_' || unicode.IsLetter(c)
+}
+
+// isIdentPart 变量名可以包含.，例如a.b
+func isIdentPart(c rune) bool {
+	return c == '_' || c == '.' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
@@ -0,0 +1,315 @@
+package expression
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// node 语法树节点，求值结果为布尔值
+type node interface {
+	evaluate(ctx Context) bool
+}
+
+// operand 操作数，取值为nil、bool、int64、float64或string
+type operand interface {
+	value(ctx Context) interface{}
+}
+
+type variable struct {
+	name string
+}
+
+func (self *variable) value(ctx Context) interface{} {
+	if value, ok := ctx.Get(self.name); ok {
+		return value
+	}
+	return nil
+}
+
+type constant struct {
+	val interface{}
+}
+
+func (self *constant) value(ctx Context) interface{} {
+	return self.val
+}
+
+type orNode struct {
+	left, right node
+}
+
+func (self *orNode) evaluate(ctx Context) bool {
+	return self.left.evaluate(ctx) || self.right.evaluate(ctx)
+}
+
+type andNode struct {
+	left, right node
+}
+
+func (self *andNode) evaluate(ctx Context) bool {
+	return self.left.evaluate(ctx) && self.right.evaluate(ctx)
+}
+
+type notNode struct {
+	expr node
+}
+
+func (self *notNode) evaluate(ctx Context) bool {
+	return !self.expr.evaluate(ctx)
+}
+
+// operandNode 单独的操作数作为条件时，值为TRUE或'true'才成立
+type operandNode struct {
+	operand operand
+}
+
+func (self *operandNode) evaluate(ctx Context) bool {
+	switch value := self.operand.value(ctx).(type) {
+	case bool:
+		return value
+	case string:
+		b, err := strconv.ParseBool(value)
+		return err == nil && b
+	}
+	return false
+}
+
+type compareNode struct {
+	op          string
+	left, right operand
+}
+
+func (self *compareNode) evaluate(ctx Context) bool {
+	result, ok := compare(self.left.value(ctx), self.right.value(ctx), self.op != "=" && self.op != "<>")
+	if !ok {
+		return false
+	}
+
+	switch self.op {
+	case "=":
+		return result == 0
+	case "<>":
+		return result != 0
+	case ">":
+		return result > 0
+	case ">=":
+		return result >= 0
+	case "<":
+		return result < 0
+	case "<=":
+		return result <= 0
+	}
+	return false
+}
+
+type inNode struct {
+	operand operand
+	values  []operand
+	not     bool
+}
+
+func (self *inNode) evaluate(ctx Context) bool {
+	value := self.operand.value(ctx)
+	if value == nil {
+		return false
+	}
+
+	for _, item := range self.values {
+		if result, ok := compare(value, item.value(ctx), false); ok && result == 0 {
+			return !self.not
+		}
+	}
+	return self.not
+}
+
+type betweenNode struct {
+	operand   operand
+	low, high operand
+	not       bool
+}
+
+func (self *betweenNode) evaluate(ctx Context) bool {
+	value := self.operand.value(ctx)
+	low, ok := compare(value, self.low.value(ctx), true)
+	if !ok {
+		return false
+	}
+	high, ok := compare(value, self.high.value(ctx), true)
+	if !ok {
+		return false
+	}
+	return (low >= 0 && high <= 0) != self.not
+}
+
+type nullNode struct {
+	operand operand
+	not     bool
+}
+
+func (self *nullNode) evaluate(ctx Context) bool {
+	return (self.operand.value(ctx) == nil) != self.not
+}
+
+type likeNode struct {
+	operand operand
+	pattern *regexp.Regexp
+	not     bool
+}
+
+func (self *likeNode) evaluate(ctx Context) bool {
+	value, ok := toString(self.operand.value(ctx))
+	if !ok {
+		return false
+	}
+	return self.pattern.MatchString(value) != self.not
+}
+
+// stringNode CONTAINS、STARTSWITH、ENDSWITH
+type stringNode struct {
+	op          string
+	left, right operand
+	not         bool
+}
+
+func (self *stringNode) evaluate(ctx Context) bool {
+	left, ok := toString(self.left.value(ctx))
+	if !ok {
+		return false
+	}
+	right, ok := toString(self.right.value(ctx))
+	if !ok {
+		return false
+	}
+
+	var matched bool
+	switch self.op {
+	case "CONTAINS":
+		matched = strings.Contains(left, right)
+	case "STARTSWITH":
+		matched = strings.HasPrefix(left, right)
+	case "ENDSWITH":
+		matched = strings.HasSuffix(left, right)
+	}
+	return matched != self.not
+}
+
+// compare 比较两个值，字符串与数值、布尔值比较时先转换为对应类型，ordered表示需要比较大小
+// 任一值为NULL、类型无法转换或布尔值比较大小时返回false
+func compare(left, right interface{}, ordered bool) (int, bool) {
+	if left == nil || right == nil {
+		return 0, false
+	}
+
+	left, right, ok := coerce(left, right)
+	if !ok {
+		return 0, false
+	}
+
+	switch l := left.(type) {
+	case string:
+		return strings.Compare(l, right.(string)), true
+	case int64:
+		r := right.(int64)
+		switch {
+		case l < r:
+			return -1, true
+		case l > r:
+			return 1, true
+		}
+		return 0, true
+	case float64:
+		r := right.(float64)
+		switch {
+		case l < r:
+			return -1, true
+		case l > r:
+			return 1, true
+		}
+		return 0, true
+	case bool:
+		if ordered {
+			return 0, false
+		}
+		if l == right.(bool) {
+			return 0, true
+		}
+		return 1, true
+	}
+	return 0, false
+}
+
+// coerce 将两个值转换为相同类型，int64与float64比较时都转换为float64
+func coerce(left, right interface{}) (interface{}, interface{}, bool) {
+	if l, ok := left.(string); ok {
+		if _, ok := right.(string); ok {
+			return left, right, true
+		}
+		value, ok := parseAs(l, right)
+		if !ok {
+			return nil, nil, false
+		}
+		return coerce(value, right)
+	}
+	if r, ok := right.(string); ok {
+		value, ok := parseAs(r, left)
+		if !ok {
+			return nil, nil, false
+		}
+		return coerce(left, value)
+	}
+
+	switch l := left.(type) {
+	case bool:
+		_, ok := right.(bool)
+		return left, right, ok
+	case int64:
+		switch r := right.(type) {
+		case int64:
+			return left, right, true
+		case float64:
+			return float64(l), r, true
+		}
+	case float64:
+		switch r := right.(type) {
+		case int64:
+			return l, float64(r), true
+		case float64:
+			return left, right, true
+		}
+	}
+	return nil, nil, false
+}
+
+// parseAs 按typ的类型解析字符串
+func parseAs(text string, typ interface{}) (interface{}, bool) {
+	switch typ.(type) {
+	case bool:
+		value, err := strconv.ParseBool(strings.TrimSpace(text))
+		return value, err == nil
+	case int64:
+		if value, err := strconv.ParseInt(strings.TrimSpace(text), 10, 64); err == nil {
+			return value, true
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		return value, err == nil
+	case float64:
+		value, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		return value, err == nil
+	}
+	return nil, false
+}
+
+func toString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
@@ -0,0 +1,268 @@
+package expression
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// parser 递归下降解析，优先级从低到高：OR、AND、NOT、谓词
+type parser struct {
+	tokens []token
+	index  int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.index]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.index]
+	if t.kind != tokenEnd {
+		p.index++
+	}
+	return t
+}
+
+func (p *parser) isEnd() bool {
+	return p.peek().kind == tokenEnd
+}
+
+// acceptKeyword 当前为指定关键字时跳过并返回true
+func (p *parser) acceptKeyword(keyword string) bool {
+	if t := p.peek(); t.kind == tokenKeyword && t.text == keyword {
+		p.index++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(kind tokenKind, text string) error {
+	if t := p.peek(); t.kind != kind {
+		return p.errorf("expect %s but %s", text, t.text)
+	}
+	p.index++
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("filter expression syntax error at position %d: %s", p.peek().pos, fmt.Sprintf(format, args...))
+}
+
+// parseExpression expression := and (OR and)*
+func (p *parser) parseExpression() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseAnd and := not (AND not)*
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseNot not := NOT not | predicate
+func (p *parser) parseNot() (node, error) {
+	if p.acceptKeyword("NOT") {
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{expr: expr}, nil
+	}
+	return p.parsePredicate()
+}
+
+// parsePredicate predicate := '(' expression ')' | operand [谓词]
+func (p *parser) parsePredicate() (node, error) {
+	if p.peek().kind == tokenLeftParen {
+		p.next()
+		expr, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenRightParen, ")"); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind == tokenOperator {
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		op := t.text
+		if op == "==" {
+			op = "="
+		} else if op == "!=" {
+			op = "<>"
+		}
+		return &compareNode{op: op, left: left, right: right}, nil
+	}
+
+	if p.acceptKeyword("IS") {
+		not := p.acceptKeyword("NOT")
+		if !p.acceptKeyword("NULL") {
+			return nil, p.errorf("expect NULL but %s", p.peek().text)
+		}
+		return &nullNode{operand: left, not: not}, nil
+	}
+
+	not := p.acceptKeyword("NOT")
+	t := p.peek()
+	if t.kind != tokenKeyword {
+		if not {
+			return nil, p.errorf("unexpected %s after NOT", t.text)
+		}
+		return &operandNode{operand: left}, nil
+	}
+
+	switch t.text {
+	case "IN":
+		p.next()
+		values, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		return &inNode{operand: left, values: values, not: not}, nil
+	case "BETWEEN":
+		p.next()
+		low, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if !p.acceptKeyword("AND") {
+			return nil, p.errorf("expect AND but %s", p.peek().text)
+		}
+		high, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &betweenNode{operand: left, low: low, high: high, not: not}, nil
+	case "LIKE":
+		p.next()
+		pattern := p.next()
+		if pattern.kind != tokenString {
+			return nil, p.errorf("LIKE pattern must be a string")
+		}
+		return &likeNode{operand: left, pattern: compileLike(pattern.text), not: not}, nil
+	case "CONTAINS", "STARTSWITH", "ENDSWITH":
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &stringNode{op: t.text, left: left, right: right, not: not}, nil
+	}
+
+	if not {
+		return nil, p.errorf("unexpected %s after NOT", t.text)
+	}
+	return &operandNode{operand: left}, nil
+}
+
+// parseList list := '(' operand (',' operand)* ')'
+func (p *parser) parseList() ([]operand, error) {
+	if err := p.expect(tokenLeftParen, "("); err != nil {
+		return nil, err
+	}
+
+	var values []operand
+	for {
+		value, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		if p.peek().kind != tokenComma {
+			break
+		}
+		p.next()
+	}
+
+	if err := p.expect(tokenRightParen, ")"); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// parseOperand operand := 变量 | 字符串 | 数值 | TRUE | FALSE | NULL
+func (p *parser) parseOperand() (operand, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenIdent:
+		return &variable{name: t.text}, nil
+	case tokenString:
+		return &constant{val: t.text}, nil
+	case tokenNumber:
+		value, err := parseNumber(t.text)
+		if err != nil {
+			return nil, fmt.Errorf("filter expression syntax error at position %d: invalid number %s", t.pos, t.text)
+		}
+		return &constant{val: value}, nil
+	case tokenKeyword:
+		switch t.text {
+		case "TRUE":
+			return &constant{val: true}, nil
+		case "FALSE":
+			return &constant{val: false}, nil
+		case "NULL":
+			return &constant{val: nil}, nil
+		}
+	}
+	return nil, fmt.Errorf("filter expression syntax error at position %d: unexpected %s", t.pos, t.text)
+}
+
+// parseNumber 整数解析为int64，其余解析为float64
+func parseNumber(text string) (interface{}, error) {
+	if value, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return value, nil
+	}
+	return strconv.ParseFloat(text, 64)
+}
+
+// compileLike LIKE模式转换为正则，%匹配任意个字符，_匹配一个字符
+func compileLike(pattern string) *regexp.Regexp {
+	var buf bytes.Buffer
+	buf.WriteString("(?s)^")
+	for _, c := range pattern {
+		switch c {
+		case '%':
+			buf.WriteString(".*")
+		case '_':
+			buf.WriteString(".")
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	buf.WriteString("$")
+	return regexp.MustCompile(buf.String())
+}
@@ -59,6 +59,22 @@ func (self *Message) SetDelayTimeLevel(level int) {
 	self.PutProperty(PROPERTY_DELAY_TIME_LEVEL, strconv.Itoa(level))
 }
 
+// SetExpireAt 设置消息过期时间点（毫秒时间戳）
+// Since 2018/1/24
+func (self *Message) SetExpireAt(expireAt int64) {
+	self.PutProperty(PROPERTY_EXPIRE_AT, strconv.FormatInt(expireAt, 10))
+}
+
+// GetExpireAt 获取消息过期时间点，未设置时返回0
+// Since 2018/1/24
+func (self *Message) GetExpireAt() int64 {
+	expireAt, err := strconv.ParseInt(self.GetProperty(PROPERTY_EXPIRE_AT), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return expireAt
+}
+
 func (self *Message) GetKeys() string {
 	return self.GetProperty(PROPERTY_KEYS)
 }
@@ -13,6 +13,9 @@ const (
 	// 消息延时投递时间级别，0表示不延时，大于0表示特定延时级别（具体级别在服务器端定义）
 	PROPERTY_DELAY_TIME_LEVEL = "DELAY"
 
+	// 消息过期时间点（毫秒时间戳），过期后未消费的消息不再投递，也不进入重试队列和死信队列
+	PROPERTY_EXPIRE_AT = "EXPIRE_AT"
+
 
 	// 内部使用
 	PROPERTY_RETRY_TOPIC = "RETRY_TOPIC"
@@ -28,5 +31,7 @@ const (
 	PROPERTY_CORRECTION_FLAG = "CORRECTION_FLAG"
 	PROPERTY_MQ2_FLAG = "MQ2_FLAG"
 	PROPERTY_RECONSUME_TIME = "RECONSUME_TIME"
+	PROPERTY_TIMER_DELIVER_MS = "TIMER_DELIVER_MS"
+	PROPERTY_NEXT_RETRY_BACKOFF_MS = "NEXT_RETRY_BACKOFF_MS"
 	KEY_SEPARATOR = " "
 )
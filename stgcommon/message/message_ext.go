@@ -148,22 +148,20 @@ func (msgExt *MessageExt) Encode() ([]byte, error) {
 	}
 
 	// 15 BODY
-	bodyLength = int32(len(msgExt.Body))
+	newBody = msgExt.Body
+	if len(msgExt.Body) > 0 && (msgExt.SysFlag&sysflag.CompressedFlag) == sysflag.CompressedFlag {
+		// 压缩报文，长度按压缩后的报文计算
+		newBody, e = zip(msgExt.Body)
+		if e != nil {
+			return nil, errors.Wrap(e, 0)
+		}
+	}
+	bodyLength = int32(len(newBody))
 	e = binary.Write(buf, binary.BigEndian, &bodyLength)
 	if e != nil {
 		return nil, errors.Wrap(e, 0)
 	}
 	if bodyLength > 0 {
-		if (msgExt.SysFlag & sysflag.CompressedFlag) == sysflag.CompressedFlag {
-			// 压缩报文
-			newBody, e = zip(msgExt.Body)
-			if e != nil {
-				return nil, errors.Wrap(e, 0)
-			}
-		} else {
-			newBody = msgExt.Body
-		}
-
 		_, e = buf.Write(newBody)
 		if e != nil {
 			return nil, errors.Wrap(e, 0)
@@ -0,0 +1,241 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	histogramSubBuckets   = 4                        // 每个2的幂区间等分的子区间数
+	histogramBucketNums   = histogramSubBuckets * 40 // 覆盖到2^40微秒，超出的记入最后一个区间
+	histogramMaxBucketIdx = histogramBucketNums - 1
+
+	// 输出/metrics时按2的幂微秒取区间上限，2^7~2^24微秒即128us~16.8s，与内部区间边界对齐，累计次数没有误差
+	exportMinExponent = 7
+	exportMaxExponent = 24
+)
+
+// LatencyHistogram 无锁延迟直方图，单位微秒；按2的幂划分区间，每个区间再等分为4个子区间，相对误差不超过25%
+// 计数只增不减，按分钟统计时由统计协程对累计快照做差，不需要清零
+// Since 2018/1/23
+type LatencyHistogram struct {
+	counts [histogramBucketNums]int64
+	total  int64
+	sum    int64
+	max    int64 // 调用Snapshot(true)时清零
+}
+
+// Record 记录一次耗时
+// Since 2018/1/23
+func (self *LatencyHistogram) Record(micros int64) {
+	if micros < 0 {
+		micros = 0
+	}
+
+	atomic.AddInt64(&self.counts[histogramBucketIndex(micros)], 1)
+	atomic.AddInt64(&self.total, 1)
+	atomic.AddInt64(&self.sum, micros)
+
+	for {
+		max := atomic.LoadInt64(&self.max)
+		if micros <= max || atomic.CompareAndSwapInt64(&self.max, max, micros) {
+			break
+		}
+	}
+}
+
+// Snapshot 累计快照，max为上次清零以来的最大值
+// Since 2018/1/23
+func (self *LatencyHistogram) Snapshot(resetMax bool) *HistogramSnapshot {
+	snapshot := new(HistogramSnapshot)
+	for i := range self.counts {
+		snapshot.counts[i] = atomic.LoadInt64(&self.counts[i])
+	}
+	snapshot.total = atomic.LoadInt64(&self.total)
+	snapshot.sum = atomic.LoadInt64(&self.sum)
+
+	if resetMax {
+		snapshot.max = atomic.SwapInt64(&self.max, 0)
+	} else {
+		snapshot.max = atomic.LoadInt64(&self.max)
+	}
+
+	return snapshot
+}
+
+// HistogramSnapshot 直方图快照，用于计算分位数及输出/metrics
+// Since 2018/1/23
+type HistogramSnapshot struct {
+	counts [histogramBucketNums]int64
+	total  int64
+	sum    int64
+	max    int64
+}
+
+// Sub 计算与上一次累计快照的差值，即两次快照之间的分布
+// Since 2018/1/23
+func (self *HistogramSnapshot) Sub(prev *HistogramSnapshot) *HistogramSnapshot {
+	if prev == nil {
+		return self
+	}
+
+	delta := &HistogramSnapshot{max: self.max}
+	for i := range self.counts {
+		delta.counts[i] = self.counts[i] - prev.counts[i]
+	}
+	delta.total = self.total - prev.total
+	delta.sum = self.sum - prev.sum
+	return delta
+}
+
+// Percentile 返回分位数所在区间的上界，p取值(0, 1]
+// Since 2018/1/23
+func (self *HistogramSnapshot) Percentile(p float64) int64 {
+	if self.total <= 0 {
+		return 0
+	}
+
+	threshold := int64(float64(self.total)*p + 0.5)
+	if threshold < 1 {
+		threshold = 1
+	}
+
+	var count int64
+	for i := range self.counts {
+		count += self.counts[i]
+		if count >= threshold {
+			upper := histogramBucketUpper(i)
+			if self.max > 0 && upper > self.max {
+				return self.max
+			}
+			return upper
+		}
+	}
+
+	return self.max
+}
+
+func (self *HistogramSnapshot) Total() int64 {
+	return self.total
+}
+
+func (self *HistogramSnapshot) Max() int64 {
+	return self.max
+}
+
+// Avg 平均耗时
+// Since 2018/1/23
+func (self *HistogramSnapshot) Avg() float64 {
+	if self.total <= 0 {
+		return 0
+	}
+	return float64(self.sum) / float64(self.total)
+}
+
+func (self *HistogramSnapshot) String() string {
+	return fmt.Sprintf("count: %d avg: %0.2f p50: %d p99: %d p999: %d max: %d", self.total, self.Avg(),
+		self.Percentile(0.5), self.Percentile(0.99), self.Percentile(0.999), self.max)
+}
+
+// exportBuckets 按2的幂微秒输出累计次数，upperBounds单位为秒
+// 耗时按微秒截断记录，小于2^k微秒的次数即耗时不超过2^k微秒的次数
+// Since 2018/1/30
+func (self *HistogramSnapshot) exportBuckets() (upperBounds []float64, buckets []int64) {
+	var cumulative int64
+	index := 0
+	for exp := uint(exportMinExponent); exp <= exportMaxExponent; exp++ {
+		bound := int64(1) << exp
+		for end := histogramBucketIndex(bound); index < end; index++ {
+			cumulative += self.counts[index]
+		}
+		upperBounds = append(upperBounds, float64(bound)/1e6)
+		buckets = append(buckets, cumulative)
+	}
+	return upperBounds, buckets
+}
+
+// histogramBucketIndex 小于4的值直接对应区间，其余按最高位确定2的幂区间，次高两位确定子区间
+// Since 2018/1/23
+func histogramBucketIndex(value int64) int {
+	if value < histogramSubBuckets {
+		return int(value)
+	}
+
+	exp := uint(0)
+	for v := value; v > 1; v >>= 1 {
+		exp++
+	}
+
+	sub := int((value >> (exp - 2)) & (histogramSubBuckets - 1))
+	index := histogramSubBuckets*int(exp-1) + sub
+	if index > histogramMaxBucketIdx {
+		return histogramMaxBucketIdx
+	}
+	return index
+}
+
+// histogramBucketUpper 区间包含的最大值
+// Since 2018/1/23
+func histogramBucketUpper(index int) int64 {
+	if index < histogramSubBuckets {
+		return int64(index)
+	}
+
+	exp := uint(index/histogramSubBuckets + 1)
+	sub := int64(index % histogramSubBuckets)
+	lower := (histogramSubBuckets + sub) << (exp - 2)
+	return lower + (int64(1) << (exp - 2)) - 1
+}
+
+// HistogramVec 按一个标签值区分的一组直方图，例如按请求码统计耗时
+// Since 2018/1/30
+type HistogramVec struct {
+	table map[string]*LatencyHistogram // key: 标签值
+	lock  sync.RWMutex
+}
+
+// NewHistogramVec 创建HistogramVec
+// Since 2018/1/30
+func NewHistogramVec() *HistogramVec {
+	return &HistogramVec{
+		table: make(map[string]*LatencyHistogram),
+	}
+}
+
+// WithLabel 获取标签值对应的直方图，不存在时创建
+// Since 2018/1/30
+func (self *HistogramVec) WithLabel(value string) *LatencyHistogram {
+	self.lock.RLock()
+	histogram, ok := self.table[value]
+	self.lock.RUnlock()
+	if ok {
+		return histogram
+	}
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if histogram, ok = self.table[value]; !ok {
+		histogram = new(LatencyHistogram)
+		self.table[value] = histogram
+	}
+	return histogram
+}
+
+// Foreach 按标签值升序遍历直方图，保证每次输出的顺序稳定
+// Since 2018/1/30
+func (self *HistogramVec) Foreach(fn func(value string, histogram *LatencyHistogram)) {
+	self.lock.RLock()
+	values := make([]string, 0, len(self.table))
+	for value := range self.table {
+		values = append(values, value)
+	}
+	self.lock.RUnlock()
+
+	sort.Strings(values)
+	for _, value := range values {
+		fn(value, self.WithLabel(value))
+	}
+}
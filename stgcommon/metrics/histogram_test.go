@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"testing"
+)
+
+func TestHistogramBucket(t *testing.T) {
+	for _, value := range []int64{0, 1, 3, 4, 5, 7, 8, 100, 1023, 1024, 999999} {
+		index := histogramBucketIndex(value)
+		if upper := histogramBucketUpper(index); value > upper {
+			t.Errorf("value %d out of bucket %d, upper: %d", value, index, upper)
+		}
+		if index > 0 && histogramBucketUpper(index-1) >= value {
+			t.Errorf("value %d should be in previous bucket of %d", value, index)
+		}
+	}
+}
+
+func TestHistogramExportBuckets(t *testing.T) {
+	histogram := new(LatencyHistogram)
+	for _, micros := range []int64{100, 127, 128, 1000, 20000000} {
+		histogram.Record(micros)
+	}
+
+	upperBounds, buckets := histogram.Snapshot(false).exportBuckets()
+	if len(upperBounds) != exportMaxExponent-exportMinExponent+1 || upperBounds[0] != 0.000128 {
+		t.Fatalf("unexpected upper bounds: %v", upperBounds)
+	}
+	// 2^7=128us: 100、127; 2^10=1024us: 再加上128、1000; 超过2^24us的只计入+Inf
+	if buckets[0] != 2 || buckets[3] != 4 || buckets[len(buckets)-1] != 4 {
+		t.Errorf("unexpected cumulative buckets: %v", buckets)
+	}
+}
@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"net"
+	"net/http"
+	"sync"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
+)
+
+const (
+	METRICS_PATH = "/metrics"
+	CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// Collector 抓取时输出指标
+// Since 2018/1/30
+type Collector interface {
+	Collect(w *Writer)
+}
+
+// CollectorFunc 函数形式的Collector
+// Since 2018/1/30
+type CollectorFunc func(w *Writer)
+
+func (fn CollectorFunc) Collect(w *Writer) {
+	fn(w)
+}
+
+// Server 提供HTTP /metrics接口，每次抓取时调用已注册的Collector
+// Since 2018/1/30
+type Server struct {
+	addr       string
+	collectors []Collector
+	listener   net.Listener
+	httpServer *http.Server
+	lock       sync.RWMutex
+}
+
+// NewServer 创建Server，addr为监听地址，例如":10915"
+// Since 2018/1/30
+func NewServer(addr string, collectors ...Collector) *Server {
+	return &Server{
+		addr:       addr,
+		collectors: collectors,
+	}
+}
+
+// Register 注册Collector
+// Since 2018/1/30
+func (self *Server) Register(collector Collector) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.collectors = append(self.collectors, collector)
+}
+
+// Start 监听端口并在后台处理抓取请求，监听失败时返回错误
+// Since 2018/1/30
+func (self *Server) Start() error {
+	listener, err := net.Listen("tcp", self.addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(METRICS_PATH, self)
+	self.listener = listener
+	self.httpServer = &http.Server{Handler: mux}
+
+	go func() {
+		if err := self.httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logger.Errorf("metrics server serve err: %s", err.Error())
+		}
+	}()
+
+	logger.Infof("metrics server start successful, listen: %s%s", listener.Addr().String(), METRICS_PATH)
+	return nil
+}
+
+// Addr 实际监听的地址，监听端口为0时可以获取系统分配的端口
+// Since 2018/1/30
+func (self *Server) Addr() string {
+	if self.listener == nil {
+		return self.addr
+	}
+	return self.listener.Addr().String()
+}
+
+// Shutdown 关闭Server
+// Since 2018/1/30
+func (self *Server) Shutdown() {
+	if self.httpServer != nil {
+		self.httpServer.Close()
+		logger.Info("metrics server shutdown successful")
+	}
+}
+
+// ServeHTTP 输出全部Collector的指标
+// Since 2018/1/30
+func (self *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	writer := NewWriter()
+
+	self.lock.RLock()
+	collectors := self.collectors
+	self.lock.RUnlock()
+
+	for _, collector := range collectors {
+		collect(collector, writer)
+	}
+
+	w.Header().Set("Content-Type", CONTENT_TYPE)
+	w.Write(writer.Bytes())
+}
+
+// collect 单个Collector异常时不影响其他指标输出
+func collect(collector Collector, writer *Writer) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Errorf("metrics collect err: %v", err)
+		}
+	}()
+
+	collector.Collect(writer)
+}
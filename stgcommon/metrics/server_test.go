@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestServerScrape(t *testing.T) {
+	latency := NewHistogramVec()
+	latency.WithLabel("10").Record(5000)
+	latency.WithLabel("10").Record(100000)
+	latency.WithLabel("10").Record(3000000)
+
+	server := NewServer("127.0.0.1:0", CollectorFunc(func(w *Writer) {
+		w.Counter("test_put_messages_total", "put messages", 3, NewLabel("topic", "topicA"))
+		w.Gauge("test_consumer_lag_messages", "consumer lag", 5, NewLabel("group", `g"1`), NewLabel("queue_id", "0"))
+		w.Counter("test_put_messages_total", "put messages", 7, NewLabel("topic", "topicB"))
+	}))
+	server.Register(CollectorFunc(func(w *Writer) {
+		latency.Foreach(func(value string, histogram *LatencyHistogram) {
+			w.Histogram("test_request_duration_seconds", "request latency", histogram.Snapshot(false), NewLabel("request_code", value))
+		})
+	}))
+	server.Register(CollectorFunc(func(w *Writer) {
+		panic("collector error")
+	}))
+
+	if err := server.Start(); err != nil {
+		t.Fatalf("start metrics server err: %s", err.Error())
+	}
+	defer server.Shutdown()
+
+	resp, err := http.Get("http://" + server.Addr() + METRICS_PATH)
+	if err != nil {
+		t.Fatalf("scrape err: %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expect status 200, got %d", resp.StatusCode)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != CONTENT_TYPE {
+		t.Errorf("unexpected content type: %s", contentType)
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	var buckets bytes.Buffer
+	for exp, count := uint(7), 0; exp <= 24; exp++ {
+		upperBound := float64(int64(1)<<exp) / 1e6
+		if upperBound > 0.005 {
+			count = 1
+		}
+		if upperBound > 0.1 {
+			count = 2
+		}
+		if upperBound > 3 {
+			count = 3
+		}
+		fmt.Fprintf(&buckets, "test_request_duration_seconds_bucket{request_code=\"10\",le=\"%s\"} %d\n",
+			strconv.FormatFloat(upperBound, 'g', -1, 64), count)
+	}
+	expected := `# HELP test_put_messages_total put messages
+# TYPE test_put_messages_total counter
+test_put_messages_total{topic="topicA"} 3
+test_put_messages_total{topic="topicB"} 7
+# HELP test_consumer_lag_messages consumer lag
+# TYPE test_consumer_lag_messages gauge
+test_consumer_lag_messages{group="g\"1",queue_id="0"} 5
+# HELP test_request_duration_seconds request latency
+# TYPE test_request_duration_seconds histogram
+` + buckets.String() + `test_request_duration_seconds_bucket{request_code="10",le="+Inf"} 3
+test_request_duration_seconds_sum{request_code="10"} 3.105
+test_request_duration_seconds_count{request_code="10"} 3
+`
+	if string(body) != expected {
+		t.Errorf("unexpected scrape result:\n%s", body)
+	}
+}
+
+func TestWriterEscape(t *testing.T) {
+	w := NewWriter()
+	w.Gauge("test_gauge", "line1\nline2 \\", 1.5, NewLabel("path", "a\\b\nc"))
+
+	lines := strings.Split(string(w.Bytes()), "\n")
+	if lines[0] != `# HELP test_gauge line1\nline2 \\` {
+		t.Errorf("unexpected help: %s", lines[0])
+	}
+	if lines[2] != `test_gauge{path="a\\b\nc"} 1.5` {
+		t.Errorf("unexpected sample: %s", lines[2])
+	}
+}
@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// 指标类型
+const (
+	COUNTER   = "counter"
+	GAUGE     = "gauge"
+	HISTOGRAM = "histogram"
+)
+
+// Label 指标标签
+// Since 2018/1/30
+type Label struct {
+	Name  string
+	Value string
+}
+
+// NewLabel 创建标签
+// Since 2018/1/30
+func NewLabel(name, value string) Label {
+	return Label{Name: name, Value: value}
+}
+
+// family 同名指标的集合，文本格式要求同名指标连续输出
+type family struct {
+	name       string
+	help       string
+	metricType string
+	samples    bytes.Buffer
+}
+
+// Writer 按Prometheus文本格式(version 0.0.4)输出指标，Prometheus及兼容OpenMetrics的采集器均可抓取
+// 同名指标按首次写入的顺序合并输出，采集器可以在任意顺序写入
+// Since 2018/1/30
+type Writer struct {
+	families map[string]*family
+	order    []*family
+}
+
+// NewWriter 创建Writer
+// Since 2018/1/30
+func NewWriter() *Writer {
+	return &Writer{
+		families: make(map[string]*family),
+	}
+}
+
+// Counter 写入单调递增的计数器
+// Since 2018/1/30
+func (self *Writer) Counter(name, help string, value float64, labels ...Label) {
+	self.getFamily(name, help, COUNTER).writeSample(name, labels, value)
+}
+
+// Gauge 写入瞬时值
+// Since 2018/1/30
+func (self *Writer) Gauge(name, help string, value float64, labels ...Label) {
+	self.getFamily(name, help, GAUGE).writeSample(name, labels, value)
+}
+
+// Histogram 写入耗时直方图，包括累计的_bucket、_sum、_count，单位转换为秒
+// Since 2018/1/30
+func (self *Writer) Histogram(name, help string, snapshot *HistogramSnapshot, labels ...Label) {
+	f := self.getFamily(name, help, HISTOGRAM)
+	upperBounds, buckets := snapshot.exportBuckets()
+	for i, upperBound := range upperBounds {
+		le := NewLabel("le", formatValue(upperBound))
+		f.writeSample(name+"_bucket", append(labels[:len(labels):len(labels)], le), float64(buckets[i]))
+	}
+	f.writeSample(name+"_bucket", append(labels[:len(labels):len(labels)], NewLabel("le", "+Inf")), float64(snapshot.total))
+	f.writeSample(name+"_sum", labels, float64(snapshot.sum)/1e6)
+	f.writeSample(name+"_count", labels, float64(snapshot.total))
+}
+
+// Bytes 返回文本格式的全部指标
+// Since 2018/1/30
+func (self *Writer) Bytes() []byte {
+	var buf bytes.Buffer
+	for _, f := range self.order {
+		buf.WriteString("# HELP ")
+		buf.WriteString(f.name)
+		buf.WriteByte(' ')
+		buf.WriteString(escapeHelp(f.help))
+		buf.WriteString("\n# TYPE ")
+		buf.WriteString(f.name)
+		buf.WriteByte(' ')
+		buf.WriteString(f.metricType)
+		buf.WriteByte('\n')
+		buf.Write(f.samples.Bytes())
+	}
+	return buf.Bytes()
+}
+
+func (self *Writer) getFamily(name, help, metricType string) *family {
+	if f, ok := self.families[name]; ok {
+		return f
+	}
+
+	f := &family{name: name, help: help, metricType: metricType}
+	self.families[name] = f
+	self.order = append(self.order, f)
+	return f
+}
+
+func (f *family) writeSample(name string, labels []Label, value float64) {
+	f.samples.WriteString(name)
+	if len(labels) > 0 {
+		f.samples.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				f.samples.WriteByte(',')
+			}
+			f.samples.WriteString(label.Name)
+			f.samples.WriteString("=\"")
+			f.samples.WriteString(escapeLabelValue(label.Value))
+			f.samples.WriteByte('"')
+		}
+		f.samples.WriteByte('}')
+	}
+	f.samples.WriteByte(' ')
+	f.samples.WriteString(formatValue(value))
+	f.samples.WriteByte('\n')
+}
+
+var (
+	helpReplacer       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(help string) string {
+	return helpReplacer.Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return labelValueReplacer.Replace(value)
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
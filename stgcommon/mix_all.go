@@ -26,6 +26,7 @@ const (
 	CLOUDMQ_HOME_PROPERTY           = "smartgo.home.dir"        // 默认smartgo home地址
 	NAMESRV_ADDR_ENV                = "NAMESRV_ADDR"            // namesrv地址环境变量
 	NAMESRV_PORT_ENV                = "NAMESRV_PORT"            // namesrv端口环境变量
+	NAMESRV_METRICS_PORT_ENV        = "NAMESRV_METRICS_PORT"    // namesrv /metrics HTTP端口环境变量，未配置时不开启
 	NAMESRV_ADDR_PROPERTY           = "cloudmq.namesrv.addr"    // 默认namesrv_addr地址
 	SMARTGO_DATA_PATH_ENV           = "SMARTGO_DATA_PATH"       // broker、store等模块，存取数据的目录
 	SMARTGO_REGISTRY_CONFIG_ENV     = "SMARTGO_REGISTRY_CONFIG" // registry模块的日志配置文件路径
@@ -46,6 +47,10 @@ const (
 	SELF_TEST_CONSUMER_GROUP        = "SELF_TEST_C_GROUP"
 	SELF_TEST_TOPIC                 = "SELF_TEST_TOPIC"
 	OFFSET_MOVED_EVENT              = "OFFSET_MOVED_EVENT"
+	POP_REVIVE_TOPIC                = "SYS_POP_REVIVE"     // POP消费的CheckPoint、Ack记录，broker据此将超时未Ack的消息投递到重试队列
+	POP_REVIVE_GROUP                = "CID_SYS_POP_REVIVE" // 读取POP_REVIVE_TOPIC的消费进度
+	TIMER_TOPIC                     = "SYS_TIMER_TOPIC"    // 按订阅组重试策略延迟投递的重试消息，到期后投递到REAL_TOPIC
+	TIMER_GROUP                     = "CID_SYS_TIMER"      // 读取TIMER_TOPIC的消费进度
 	DEFAULT_CHARSET                 = "UTF-8"
 	MASTER_ID                       = 0
 	RETRY_GROUP_TOPIC_PREFIX        = "%RETRY%" // 为每个ConsumerGroup建立一个默认的Topic，前缀+GroupName，用来保存处理失败需要重试的消息
@@ -265,6 +270,12 @@ func GetNamesrvPort() string {
 	return strings.TrimSpace(os.Getenv(NAMESRV_PORT_ENV))
 }
 
+// GetNamesrvMetricsPort 获取环境变量“NAMESRV_METRICS_PORT”的值
+// Since: 2018/1/30
+func GetNamesrvMetricsPort() string {
+	return strings.TrimSpace(os.Getenv(NAMESRV_METRICS_PORT_ENV))
+}
+
 // GetSmartGoHome 获取环境变量“SMARTGO_HOME”的值
 // Author: tianyuliang
 // Since: 2017/9/27
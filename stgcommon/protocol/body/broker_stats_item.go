@@ -7,4 +7,8 @@ type BrokerStatsItem struct {
 	Sum   int64   `json:"sum"`
 	Tps   float64 `json:"tps"`
 	Avgpt float64 `json:"avgpt"`
+	P50   int64   `json:"p50,omitempty"` // 耗时分位数，仅存储层耗时统计项有值
+	P99   int64   `json:"p99,omitempty"`
+	P999  int64   `json:"p999,omitempty"`
+	Max   int64   `json:"max,omitempty"`
 }
@@ -0,0 +1,47 @@
+package body
+
+import (
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
+)
+
+// ConsumerLag 消费组在一个队列上的消费延迟
+// LagMessages为队列最大offset与消费进度的差值，LagMillis为当前时间与下一条未消费消息存储时间的差值
+// Since 2018/1/31
+type ConsumerLag struct {
+	ConsumerGroup             string `json:"consumerGroup"`
+	Topic                     string `json:"topic"`
+	BrokerName                string `json:"brokerName"`
+	QueueId                   int    `json:"queueId"`
+	BrokerOffset              int64  `json:"brokerOffset"`
+	ConsumerOffset            int64  `json:"consumerOffset"`
+	LagMessages               int64  `json:"lagMessages"`
+	LagMillis                 int64  `json:"lagMillis"`
+	NextMessageStoreTimestamp int64  `json:"nextMessageStoreTimestamp"` // 下一条未消费消息的存储时间，没有延迟时为0
+}
+
+// LagSeconds 消费延迟的秒数
+// Since 2018/1/31
+func (lag *ConsumerLag) LagSeconds() float64 {
+	return float64(lag.LagMillis) / 1000
+}
+
+// GetNextMessageStoreTimestampStr 下一条未消费消息的存储时间
+// Since 2018/1/31
+func (lag *ConsumerLag) GetNextMessageStoreTimestampStr() string {
+	return stgcommon.MilliTime2String(lag.NextMessageStoreTimestamp)
+}
+
+// ConsumerLagTable broker计算的消费延迟列表
+// Since 2018/1/31
+type ConsumerLagTable struct {
+	LagList          []*ConsumerLag `json:"lagList"`
+	ComputeTimestamp int64          `json:"computeTimestamp"` // 计算时间
+}
+
+// NewConsumerLagTable 初始化
+// Since 2018/1/31
+func NewConsumerLagTable() *ConsumerLagTable {
+	return &ConsumerLagTable{
+		LagList: make([]*ConsumerLag, 0),
+	}
+}
@@ -0,0 +1,15 @@
+package header
+
+// AckMessageRequestHeader 确认POP拉取的消息请求头，Topic、QueueId为消息实际所在的队列（可能是重试队列）
+// Since 2018/2/1
+type AckMessageRequestHeader struct {
+	ConsumerGroup string `json:"consumerGroup"`
+	Topic         string `json:"topic"`
+	QueueId       int32  `json:"queueId"`
+	Offset        int64  `json:"offset"`
+	PopTime       int64  `json:"popTime"`
+}
+
+func (header *AckMessageRequestHeader) CheckFields() error {
+	return nil
+}
@@ -0,0 +1,16 @@
+package header
+
+// ChangeInvisibleTimeRequestHeader 修改POP拉取的消息的不可见时间请求头，从请求时刻开始重新计算
+// Since 2018/2/1
+type ChangeInvisibleTimeRequestHeader struct {
+	ConsumerGroup string `json:"consumerGroup"`
+	Topic         string `json:"topic"`
+	QueueId       int32  `json:"queueId"`
+	Offset        int64  `json:"offset"`
+	PopTime       int64  `json:"popTime"`
+	InvisibleTime int64  `json:"invisibleTime"`
+}
+
+func (header *ChangeInvisibleTimeRequestHeader) CheckFields() error {
+	return nil
+}
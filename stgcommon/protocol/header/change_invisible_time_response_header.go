@@ -0,0 +1,12 @@
+package header
+
+// ChangeInvisibleTimeResponseHeader 修改不可见时间响应头，之后的Ack、修改需使用新的PopTime
+// Since 2018/2/1
+type ChangeInvisibleTimeResponseHeader struct {
+	PopTime       int64 `json:"popTime"`
+	InvisibleTime int64 `json:"invisibleTime"`
+}
+
+func (header *ChangeInvisibleTimeResponseHeader) CheckFields() error {
+	return nil
+}
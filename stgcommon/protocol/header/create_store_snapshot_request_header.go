@@ -0,0 +1,19 @@
+package header
+
+// CreateStoreSnapshotRequestHeader 在线生成Broker存储快照的请求头
+// Since 2018/1/22
+type CreateStoreSnapshotRequestHeader struct {
+	SnapshotDir string `json:"snapshotDir"` // Broker本地快照目录，必须不存在或为空目录
+}
+
+func (header *CreateStoreSnapshotRequestHeader) CheckFields() error {
+	return nil
+}
+
+// NewCreateStoreSnapshotRequestHeader 初始化
+// Since 2018/1/22
+func NewCreateStoreSnapshotRequestHeader(snapshotDir string) *CreateStoreSnapshotRequestHeader {
+	return &CreateStoreSnapshotRequestHeader{
+		SnapshotDir: snapshotDir,
+	}
+}
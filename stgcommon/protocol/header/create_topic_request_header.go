@@ -2,20 +2,30 @@ package header
 
 import (
 	"git.oschina.net/cloudzone/smartgo/stgcommon"
+	"strings"
+)
+
+const (
+	IndexedPropertiesSeparator = ","
 )
 
 // CreateTopicRequestHeader: 创建topic头信息
 // Author: yintongqiang
 // Since:  2017/8/17
 type CreateTopicRequestHeader struct {
-	Topic           string // 真正的topic名称是位于topicConfig.Topic字段
-	DefaultTopic    string // 表示创建topic的key值
-	ReadQueueNums   int32
-	WriteQueueNums  int32
-	Perm            int
-	TopicFilterType stgcommon.TopicFilterType
-	TopicSysFlag    int
-	Order           bool
+	Topic             string // 真正的topic名称是位于topicConfig.Topic字段
+	DefaultTopic      string // 表示创建topic的key值
+	ReadQueueNums     int32
+	WriteQueueNums    int32
+	Perm              int
+	TopicFilterType   stgcommon.TopicFilterType
+	TopicSysFlag      int
+	Order             bool
+	CleanupPolicy     stgcommon.TopicCleanupPolicy
+	RetentionHours    int32
+	RetentionBytes    int64
+	IndexedProperties string // 需要建立索引的消息属性名称，多个用逗号隔开
+	MessageTtlSeconds int64  // 消息默认存活时间（单位秒），0表示永不过期
 }
 
 func (header *CreateTopicRequestHeader) CheckFields() error {
@@ -24,14 +34,31 @@ func (header *CreateTopicRequestHeader) CheckFields() error {
 
 func NewCreateTopicRequestHeader(topicWithProjectGroup, defaultTopic string, topicConfig *stgcommon.TopicConfig) *CreateTopicRequestHeader {
 	createTopicRequestHeader := &CreateTopicRequestHeader{
-		Topic:           topicWithProjectGroup,
-		DefaultTopic:    defaultTopic,
-		ReadQueueNums:   topicConfig.ReadQueueNums,
-		WriteQueueNums:  topicConfig.WriteQueueNums,
-		TopicFilterType: topicConfig.TopicFilterType,
-		TopicSysFlag:    topicConfig.TopicSysFlag,
-		Order:           topicConfig.Order,
-		Perm:            topicConfig.Perm,
+		Topic:             topicWithProjectGroup,
+		DefaultTopic:      defaultTopic,
+		ReadQueueNums:     topicConfig.ReadQueueNums,
+		WriteQueueNums:    topicConfig.WriteQueueNums,
+		TopicFilterType:   topicConfig.TopicFilterType,
+		TopicSysFlag:      topicConfig.TopicSysFlag,
+		Order:             topicConfig.Order,
+		Perm:              topicConfig.Perm,
+		CleanupPolicy:     topicConfig.CleanupPolicy,
+		RetentionHours:    topicConfig.RetentionHours,
+		RetentionBytes:    topicConfig.RetentionBytes,
+		IndexedProperties: strings.Join(topicConfig.IndexedProperties, IndexedPropertiesSeparator),
+		MessageTtlSeconds: topicConfig.MessageTtlSeconds,
 	}
 	return createTopicRequestHeader
 }
+
+// GetIndexedProperties 解析需要建立索引的消息属性名称
+// Since: 2018/1/12
+func (header *CreateTopicRequestHeader) GetIndexedProperties() []string {
+	properties := make([]string, 0)
+	for _, name := range strings.Split(header.IndexedProperties, IndexedPropertiesSeparator) {
+		if name = strings.TrimSpace(name); name != "" {
+			properties = append(properties, name)
+		}
+	}
+	return properties
+}
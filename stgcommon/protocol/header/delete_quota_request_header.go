@@ -0,0 +1,18 @@
+package header
+
+// DeleteQuotaRequestHeader 删除Broker限流配额的请求头
+// Since 2018/1/29
+type DeleteQuotaRequestHeader struct {
+	Dimension string `json:"dimension"` // 限流维度：topic、producerGroup、consumerGroup、clientIp
+	Name      string `json:"name"`
+}
+
+func (header *DeleteQuotaRequestHeader) CheckFields() error {
+	return nil
+}
+
+// NewDeleteQuotaRequestHeader 初始化
+// Since 2018/1/29
+func NewDeleteQuotaRequestHeader(dimension, name string) *DeleteQuotaRequestHeader {
+	return &DeleteQuotaRequestHeader{Dimension: dimension, Name: name}
+}
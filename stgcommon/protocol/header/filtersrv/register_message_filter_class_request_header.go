@@ -0,0 +1,39 @@
+package filtersrv
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RegisterMessageFilterClassRequestHeader 向Filter Server注册订阅组过滤逻辑的请求头，过滤逻辑源码放在请求body中
+// Since 2018/2/5
+type RegisterMessageFilterClassRequestHeader struct {
+	ConsumerGroup string `json:"consumerGroup"`
+	Topic         string `json:"topic"`
+	ClassName     string `json:"className"`
+	ClassCRC      int32  `json:"classCRC"`
+}
+
+func (header *RegisterMessageFilterClassRequestHeader) CheckFields() error {
+	if strings.TrimSpace(header.ConsumerGroup) == "" {
+		return fmt.Errorf("RegisterMessageFilterClassRequestHeader.ConsumerGroup is empty")
+	}
+	if strings.TrimSpace(header.Topic) == "" {
+		return fmt.Errorf("RegisterMessageFilterClassRequestHeader.Topic is empty")
+	}
+	if strings.TrimSpace(header.ClassName) == "" {
+		return fmt.Errorf("RegisterMessageFilterClassRequestHeader.ClassName is empty")
+	}
+	return nil
+}
+
+// NewRegisterMessageFilterClassRequestHeader 初始化
+// Since 2018/2/5
+func NewRegisterMessageFilterClassRequestHeader(consumerGroup, topic, className string, classCRC int32) *RegisterMessageFilterClassRequestHeader {
+	return &RegisterMessageFilterClassRequestHeader{
+		ConsumerGroup: consumerGroup,
+		Topic:         topic,
+		ClassName:     className,
+		ClassCRC:      classCRC,
+	}
+}
@@ -0,0 +1,21 @@
+package header
+
+// GetConsumerLagRequestHeader 查询broker计算的消费延迟，消费组、topic为空时不过滤
+// Since 2018/1/31
+type GetConsumerLagRequestHeader struct {
+	ConsumerGroup string `json:"consumerGroup"`
+	Topic         string `json:"topic"`
+}
+
+func (header *GetConsumerLagRequestHeader) CheckFields() error {
+	return nil
+}
+
+// NewGetConsumerLagRequestHeader 初始化
+// Since 2018/1/31
+func NewGetConsumerLagRequestHeader(consumerGroup, topic string) *GetConsumerLagRequestHeader {
+	return &GetConsumerLagRequestHeader{
+		ConsumerGroup: consumerGroup,
+		Topic:         topic,
+	}
+}
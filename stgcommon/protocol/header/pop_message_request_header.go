@@ -0,0 +1,27 @@
+package header
+
+// PopMessageRequestHeader POP方式拉取消息请求头，QueueId小于0时由broker选择队列
+// Since 2018/2/1
+type PopMessageRequestHeader struct {
+	ConsumerGroup string `json:"consumerGroup"`
+	Topic         string `json:"topic"`
+	QueueId       int32  `json:"queueId"`
+	MaxMsgNums    int    `json:"maxMsgNums"`
+	InvisibleTime int64  `json:"invisibleTime"` // 消息不可见时间（毫秒），超时未Ack的消息进入重试队列
+}
+
+func (header *PopMessageRequestHeader) CheckFields() error {
+	return nil
+}
+
+// NewPopMessageRequestHeader 初始化
+// Since 2018/2/1
+func NewPopMessageRequestHeader(consumerGroup, topic string, queueId int32, maxMsgNums int, invisibleTime int64) *PopMessageRequestHeader {
+	return &PopMessageRequestHeader{
+		ConsumerGroup: consumerGroup,
+		Topic:         topic,
+		QueueId:       queueId,
+		MaxMsgNums:    maxMsgNums,
+		InvisibleTime: invisibleTime,
+	}
+}
@@ -0,0 +1,12 @@
+package header
+
+// PopMessageResponseHeader POP方式拉取消息响应头，Ack、修改不可见时间时需带上PopTime
+// Since 2018/2/1
+type PopMessageResponseHeader struct {
+	PopTime       int64 `json:"popTime"`
+	InvisibleTime int64 `json:"invisibleTime"`
+}
+
+func (header *PopMessageResponseHeader) CheckFields() error {
+	return nil
+}
@@ -9,6 +9,7 @@ type QueryMessageRequestHeader struct {
 	MaxNum         int32  `json:"maxNum"`
 	BeginTimestamp int64  `json:"beginTimestamp"`
 	EndTimestamp   int64  `json:"endTimestamp"`
+	PropertyName   string `json:"propertyName"` // 非空时按Topic声明的索引属性查询，Key为属性值
 }
 
 func (query QueryMessageRequestHeader) CheckFields() error {
@@ -0,0 +1,17 @@
+package header
+
+// RateLimitedResponseHeader 超过限流配额时的响应头
+// Since 2018/1/29
+type RateLimitedResponseHeader struct {
+	RetryAfterMillis int64 `json:"retryAfterMillis"` // 建议的重试等待时间（单位毫秒）
+}
+
+func (header *RateLimitedResponseHeader) CheckFields() error {
+	return nil
+}
+
+// NewRateLimitedResponseHeader 初始化
+// Since 2018/1/29
+func NewRateLimitedResponseHeader(retryAfterMillis int64) *RateLimitedResponseHeader {
+	return &RateLimitedResponseHeader{RetryAfterMillis: retryAfterMillis}
+}
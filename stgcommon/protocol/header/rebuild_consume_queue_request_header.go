@@ -0,0 +1,25 @@
+package header
+
+// RebuildConsumeQueueRequestHeader 根据CommitLog重建逻辑队列及索引的请求头
+// Since 2018/1/19
+type RebuildConsumeQueueRequestHeader struct {
+	Topic        string `json:"topic"`        // 为空表示全部Topic
+	QueueId      int32  `json:"queueId"`      // 小于0表示Topic的全部队列
+	RebuildIndex bool   `json:"rebuildIndex"` // 是否重建索引文件，只能在重建全部Topic时使用
+	DryRun       bool   `json:"dryRun"`       // 只统计差异，不修改文件
+}
+
+func (header *RebuildConsumeQueueRequestHeader) CheckFields() error {
+	return nil
+}
+
+// NewRebuildConsumeQueueRequestHeader 初始化
+// Since 2018/1/19
+func NewRebuildConsumeQueueRequestHeader(topic string, queueId int32, rebuildIndex, dryRun bool) *RebuildConsumeQueueRequestHeader {
+	return &RebuildConsumeQueueRequestHeader{
+		Topic:        topic,
+		QueueId:      queueId,
+		RebuildIndex: rebuildIndex,
+		DryRun:       dryRun,
+	}
+}
@@ -0,0 +1,18 @@
+package header
+
+// UpdateStoreModeRequestHeader 强制指定或清除Broker存储模式的请求头
+// Since 2018/1/18
+type UpdateStoreModeRequestHeader struct {
+	Mode  string `json:"mode"`  // 存储模式：NORMAL、READ_ONLY、INDEX_DEGRADED、DISK_FULL
+	Force bool   `json:"force"` // true：强制进入该模式；false：清除该模式
+}
+
+func (header *UpdateStoreModeRequestHeader) CheckFields() error {
+	return nil
+}
+
+// NewUpdateStoreModeRequestHeader 初始化
+// Since 2018/1/18
+func NewUpdateStoreModeRequestHeader(mode string, force bool) *UpdateStoreModeRequestHeader {
+	return &UpdateStoreModeRequestHeader{Mode: mode, Force: force}
+}
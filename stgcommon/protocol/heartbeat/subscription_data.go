@@ -10,13 +10,14 @@ import (
 // Author: yintongqiang
 // Since:  2017/8/9
 type SubscriptionData struct {
-	SUB_ALL         string  `json:"-"`
-	ClassFilterMode bool    `json:"classFilterMode"`
-	Topic           string  `json:"topic"`
-	SubString       string  `json:"subString"`
-	TagsSet         set.Set `json:"tagsSet"`
-	CodeSet         set.Set `json:"codeSet"`
-	SubVersion      int     `json:"subVersion"`
+	SUB_ALL           string  `json:"-"`
+	ClassFilterMode   bool    `json:"classFilterMode"`
+	Topic             string  `json:"topic"`
+	SubString         string  `json:"subString"`
+	TagsSet           set.Set `json:"tagsSet"`
+	CodeSet           set.Set `json:"codeSet"`
+	SubVersion        int     `json:"subVersion"`
+	FilterClassSource string  `json:"-"` // 类过滤模式的过滤逻辑，由客户端上传到Filter Server，不随心跳发送
 }
 
 type SubscriptionDataPlus struct {
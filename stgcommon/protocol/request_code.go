@@ -86,6 +86,16 @@ const (
 	GET_HAS_UNIT_SUB_UNUNIT_TOPIC_LIST   = 313 // 获取含有单元化订阅组的非单元化 Topic 列表
 	CLONE_GROUP_OFFSET                   = 314 // 克隆某一个组的消费进度到新的组
 	VIEW_BROKER_STATS_DATA               = 315 // 查看Broker上的各种统计信息
+	UPDATE_STORE_MODE                    = 316 // 强制指定或清除Broker存储模式
+	REBUILD_CONSUME_QUEUE                = 317 // 根据CommitLog重建逻辑队列及索引
+	CREATE_STORE_SNAPSHOT                = 318 // 在线生成Broker存储快照
+	UPDATE_AND_CREATE_QUOTA              = 319 // 创建或更新Broker限流配额
+	DELETE_QUOTA                         = 320 // 删除Broker限流配额
+	GET_ALL_QUOTA_CONFIG                 = 321 // 获取Broker所有限流配额
+	GET_CONSUMER_LAG                     = 322 // 获取Broker计算的消费延迟（消息数及秒数）
+	POP_MESSAGE                          = 323 // POP方式拉取消息，消息在不可见时间内不会被再次拉取
+	ACK_MESSAGE                          = 324 // 确认POP拉取的消息已消费
+	CHANGE_INVISIBLE_TIME                = 325 // 修改POP拉取的消息的不可见时间
 )
 
 func ParseRequest(requestCode int32) string {
@@ -175,4 +185,14 @@ var requestPattern = map[int32]string{
 	313: "GET_HAS_UNIT_SUB_UNUNIT_TOPIC_LIST",
 	314: "CLONE_GROUP_OFFSET",
 	315: "VIEW_BROKER_STATS_DATA",
+	316: "UPDATE_STORE_MODE",
+	317: "REBUILD_CONSUME_QUEUE",
+	318: "CREATE_STORE_SNAPSHOT",
+	319: "UPDATE_AND_CREATE_QUOTA",
+	320: "DELETE_QUOTA",
+	321: "GET_ALL_QUOTA_CONFIG",
+	322: "GET_CONSUMER_LAG",
+	323: "POP_MESSAGE",
+	324: "ACK_MESSAGE",
+	325: "CHANGE_INVISIBLE_TIME",
 }
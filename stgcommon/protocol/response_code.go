@@ -30,6 +30,7 @@ const (
 	SUBSCRIPTION_NOT_EXIST        = 24  // Broker 订阅关系不存在
 	SUBSCRIPTION_NOT_LATEST       = 25  // Broker 订阅关系不是最新的
 	SUBSCRIPTION_GROUP_NOT_EXIST  = 26  // Broker 订阅组不存在
+	RATE_LIMITED                  = 27  // Broker 超过限流配额，RateLimitedResponseHeader中为建议的重试等待时间
 	TRANSACTION_SHOULD_COMMIT     = 200 // producer 事务应该被提交
 	TRANSACTION_SHOULD_ROLLBACK   = 201 // producer 事务应该被回滚
 	TRANSACTION_STATE_UNKNOW      = 202 // producer 事务状态未知
@@ -71,6 +72,7 @@ var responsePattern = map[int32]string{
 	24:  "SUBSCRIPTION_NOT_EXIST",
 	25:  "SUBSCRIPTION_NOT_LATEST",
 	26:  "SUBSCRIPTION_GROUP_NOT_EXIST",
+	27:  "RATE_LIMITED",
 	200: "TRANSACTION_SHOULD_COMMIT",
 	201: "TRANSACTION_SHOULD_ROLLBACK",
 	202: "TRANSACTION_STATE_UNKNOW",
@@ -0,0 +1,142 @@
+package quota
+
+import (
+	"sync"
+	"time"
+)
+
+// 限流方向，同一配额的发送、拉取使用不同的令牌桶
+const (
+	sendDirection = "send"
+	pullDirection = "pull"
+)
+
+// quotaBuckets 一个配额在一个方向上的令牌桶，未限制的项为nil
+type quotaBuckets struct {
+	config   *QuotaConfig
+	messages *TokenBucket
+	bytes    *TokenBucket
+}
+
+func newQuotaBuckets(config *QuotaConfig) *quotaBuckets {
+	buckets := &quotaBuckets{config: config}
+	if config.MessagesPerSec > 0 {
+		buckets.messages = NewTokenBucket(config.MessagesPerSec)
+	}
+	if config.BytesPerSec > 0 {
+		buckets.bytes = NewTokenBucket(config.BytesPerSec)
+	}
+	return buckets
+}
+
+// Limiter 根据QuotaConfigTable中的配额限流
+// 配额更新后（配置对象变化）重新创建令牌桶，配额删除后清理令牌桶
+// Since 2018/1/29
+type Limiter struct {
+	table   *QuotaConfigTable
+	buckets map[string]*quotaBuckets // key: 方向:dimension@name
+	lock    sync.Mutex
+}
+
+// NewLimiter 初始化Limiter
+// Since 2018/1/29
+func NewLimiter(table *QuotaConfigTable) *Limiter {
+	return &Limiter{
+		table:   table,
+		buckets: make(map[string]*quotaBuckets),
+	}
+}
+
+// TryAcquireSend 发送消息前校验topic、生产组、客户端IP配额，超过配额时返回建议的重试等待时间，未超过时扣减配额并返回0
+// Since 2018/1/29
+func (self *Limiter) TryAcquireSend(topic, producerGroup, clientIp string, msgNums, bodySize int64) time.Duration {
+	buckets := self.collect(sendDirection, map[string]string{TOPIC: topic, PRODUCER_GROUP: producerGroup, CLIENT_IP: clientIp})
+	if retryAfter := maxWait(buckets); retryAfter > 0 {
+		return retryAfter
+	}
+
+	for _, bucket := range buckets {
+		bucket.consume(msgNums, bodySize)
+	}
+	return 0
+}
+
+// CheckPull 拉取消息前校验topic、消费组、客户端IP配额，超过配额时返回建议的重试等待时间
+// 拉取前不知道消息数量和大小，拉取到消息后调用ConsumePull扣减配额
+// Since 2018/1/29
+func (self *Limiter) CheckPull(topic, consumerGroup, clientIp string) time.Duration {
+	return maxWait(self.collect(pullDirection, map[string]string{TOPIC: topic, CONSUMER_GROUP: consumerGroup, CLIENT_IP: clientIp}))
+}
+
+// ConsumePull 按拉取到的消息数量和大小扣减配额
+// Since 2018/1/29
+func (self *Limiter) ConsumePull(topic, consumerGroup, clientIp string, msgNums, bodySize int64) {
+	buckets := self.collect(pullDirection, map[string]string{TOPIC: topic, CONSUMER_GROUP: consumerGroup, CLIENT_IP: clientIp})
+	for _, bucket := range buckets {
+		bucket.consume(msgNums, bodySize)
+	}
+}
+
+// collect 查找请求涉及的配额对应的令牌桶
+func (self *Limiter) collect(direction string, resources map[string]string) []*quotaBuckets {
+	if self.table.Size() == 0 {
+		return nil
+	}
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	var result []*quotaBuckets
+	for dimension, name := range resources {
+		if name == "" {
+			continue
+		}
+
+		key := direction + ":" + BuildQuotaKey(dimension, name)
+		config := self.table.Get(dimension, name)
+		if config == nil {
+			delete(self.buckets, key)
+			continue
+		}
+
+		buckets, ok := self.buckets[key]
+		if !ok || buckets.config != config {
+			buckets = newQuotaBuckets(config)
+			self.buckets[key] = buckets
+		}
+		result = append(result, buckets)
+	}
+	return result
+}
+
+func (self *quotaBuckets) wait() time.Duration {
+	var retryAfter time.Duration
+	if self.messages != nil {
+		retryAfter = self.messages.Wait()
+	}
+	if self.bytes != nil {
+		if wait := self.bytes.Wait(); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+	return retryAfter
+}
+
+func (self *quotaBuckets) consume(msgNums, bodySize int64) {
+	if self.messages != nil {
+		self.messages.Consume(msgNums)
+	}
+	if self.bytes != nil {
+		self.bytes.Consume(bodySize)
+	}
+}
+
+func maxWait(buckets []*quotaBuckets) time.Duration {
+	var retryAfter time.Duration
+	for _, bucket := range buckets {
+		if wait := bucket.wait(); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+	return retryAfter
+}
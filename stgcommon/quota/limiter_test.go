@@ -0,0 +1,72 @@
+package quota
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	bucket := NewTokenBucket(10)
+	now := bucket.last
+
+	// 满桶时允许一次消费超过剩余令牌，之后需要等待欠下的令牌补足
+	bucket.consumeAt(now, 15)
+	if wait := bucket.waitAt(now); wait != 600*time.Millisecond+time.Millisecond {
+		t.Errorf("expect wait 601ms, got %v", wait)
+	}
+
+	now = now.Add(700 * time.Millisecond)
+	if wait := bucket.waitAt(now); wait != 0 {
+		t.Errorf("expect no wait after refill, got %v", wait)
+	}
+
+	// 令牌数不超过1秒的容量
+	now = now.Add(time.Hour)
+	bucket.consumeAt(now, 10)
+	if wait := bucket.waitAt(now); wait == 0 {
+		t.Error("bucket capacity should be one second of tokens")
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	table := NewQuotaConfigTable()
+	limiter := NewLimiter(table)
+
+	if retryAfter := limiter.TryAcquireSend("topicA", "producer", "10.0.0.1", 1, 1024); retryAfter != 0 {
+		t.Fatalf("no quota should not limit, retryAfter: %v", retryAfter)
+	}
+
+	table.Put(NewQuotaConfig(TOPIC, "topicA", 2, 0))
+	table.Put(NewQuotaConfig(CONSUMER_GROUP, "consumer", 0, 100))
+
+	for i := 0; i < 2; i++ {
+		if retryAfter := limiter.TryAcquireSend("topicA", "producer", "10.0.0.1", 1, 1024); retryAfter != 0 {
+			t.Fatalf("send %d should be allowed, retryAfter: %v", i, retryAfter)
+		}
+	}
+	if retryAfter := limiter.TryAcquireSend("topicA", "producer", "10.0.0.1", 1, 1024); retryAfter <= 0 {
+		t.Error("send exceeding topic quota should be limited")
+	}
+	if retryAfter := limiter.TryAcquireSend("topicB", "producer", "10.0.0.1", 1, 1024); retryAfter != 0 {
+		t.Errorf("other topic should not be limited, retryAfter: %v", retryAfter)
+	}
+
+	// 发送、拉取使用不同的令牌桶
+	if retryAfter := limiter.CheckPull("topicA", "consumer", "10.0.0.1"); retryAfter != 0 {
+		t.Errorf("pull should not be limited by send quota, retryAfter: %v", retryAfter)
+	}
+	limiter.ConsumePull("topicA", "consumer", "10.0.0.1", 1, 200)
+	if retryAfter := limiter.CheckPull("topicA", "consumer", "10.0.0.1"); retryAfter <= 0 {
+		t.Error("pull exceeding consumer group bytes quota should be limited")
+	}
+
+	// 更新配额后重新创建令牌桶，删除配额后不再限流
+	table.Put(NewQuotaConfig(TOPIC, "topicA", 100, 0))
+	if retryAfter := limiter.TryAcquireSend("topicA", "producer", "10.0.0.1", 1, 1024); retryAfter != 0 {
+		t.Errorf("updated quota should take effect, retryAfter: %v", retryAfter)
+	}
+	table.Remove(CONSUMER_GROUP, "consumer")
+	if retryAfter := limiter.CheckPull("topicA", "consumer", "10.0.0.1"); retryAfter != 0 {
+		t.Errorf("deleted quota should not limit, retryAfter: %v", retryAfter)
+	}
+}
@@ -0,0 +1,74 @@
+package quota
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 限流维度
+const (
+	TOPIC          = "topic"         // 按topic限流，发送、拉取分别计算
+	PRODUCER_GROUP = "producerGroup" // 按生产组限流，只限制发送
+	CONSUMER_GROUP = "consumerGroup" // 按消费组限流，只限制拉取
+	CLIENT_IP      = "clientIp"      // 按客户端IP限流，发送、拉取分别计算
+)
+
+// QuotaConfig 限流配额配置，MessagesPerSec、BytesPerSec为0时表示不限制
+// Since 2018/1/29
+type QuotaConfig struct {
+	Dimension      string `json:"dimension"`      // 限流维度：topic、producerGroup、consumerGroup、clientIp
+	Name           string `json:"name"`           // topic名称、生产组、消费组或客户端IP
+	MessagesPerSec int64  `json:"messagesPerSec"` // 每秒消息数
+	BytesPerSec    int64  `json:"bytesPerSec"`    // 每秒消息字节数
+}
+
+// NewQuotaConfig 初始化QuotaConfig
+// Since 2018/1/29
+func NewQuotaConfig(dimension, name string, messagesPerSec, bytesPerSec int64) *QuotaConfig {
+	return &QuotaConfig{
+		Dimension:      dimension,
+		Name:           name,
+		MessagesPerSec: messagesPerSec,
+		BytesPerSec:    bytesPerSec,
+	}
+}
+
+// BuildQuotaKey 配额在QuotaConfigTable中的key
+// Since 2018/1/29
+func BuildQuotaKey(dimension, name string) string {
+	return dimension + "@" + name
+}
+
+// Key 配额在QuotaConfigTable中的key
+// Since 2018/1/29
+func (self *QuotaConfig) Key() string {
+	return BuildQuotaKey(self.Dimension, self.Name)
+}
+
+// CheckFields 校验配额配置
+// Since 2018/1/29
+func (self *QuotaConfig) CheckFields() error {
+	switch self.Dimension {
+	case TOPIC, PRODUCER_GROUP, CONSUMER_GROUP, CLIENT_IP:
+	default:
+		return fmt.Errorf("invalid quota dimension: %s", self.Dimension)
+	}
+	if strings.TrimSpace(self.Name) == "" {
+		return fmt.Errorf("quota name can not be empty")
+	}
+	if self.MessagesPerSec < 0 || self.BytesPerSec < 0 {
+		return fmt.Errorf("quota messagesPerSec and bytesPerSec can not be negative")
+	}
+	return nil
+}
+
+// ToString 打印QuotaConfig结构体数据
+// Since 2018/1/29
+func (self *QuotaConfig) ToString() string {
+	if self == nil {
+		return "QuotaConfig is nil"
+	}
+
+	format := "QuotaConfig {dimension=%s, name=%s, messagesPerSec=%d, bytesPerSec=%d}"
+	return fmt.Sprintf(format, self.Dimension, self.Name, self.MessagesPerSec, self.BytesPerSec)
+}
@@ -0,0 +1,69 @@
+package quota
+
+import (
+	"sync"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
+)
+
+// QuotaConfigTable 限流配额表，持久化到quota.json
+// Since 2018/1/29
+type QuotaConfigTable struct {
+	QuotaConfigTable map[string]*QuotaConfig `json:"quotaConfigTable"` // key:dimension@name
+	DataVersion      stgcommon.DataVersion   `json:"dataVersion"`
+	sync.RWMutex     `json:"-"`
+}
+
+func NewQuotaConfigTable() *QuotaConfigTable {
+	return &QuotaConfigTable{
+		QuotaConfigTable: make(map[string]*QuotaConfig),
+		DataVersion:      *stgcommon.NewDataVersion(),
+	}
+}
+
+func (table *QuotaConfigTable) Size() int {
+	table.RLock()
+	defer table.RUnlock()
+
+	return len(table.QuotaConfigTable)
+}
+
+func (table *QuotaConfigTable) Put(config *QuotaConfig) *QuotaConfig {
+	table.Lock()
+	defer table.Unlock()
+
+	key := config.Key()
+	old := table.QuotaConfigTable[key]
+	table.QuotaConfigTable[key] = config
+	return old
+}
+
+func (table *QuotaConfigTable) Get(dimension, name string) *QuotaConfig {
+	table.RLock()
+	defer table.RUnlock()
+
+	return table.QuotaConfigTable[BuildQuotaKey(dimension, name)]
+}
+
+func (table *QuotaConfigTable) Remove(dimension, name string) *QuotaConfig {
+	table.Lock()
+	defer table.Unlock()
+
+	key := BuildQuotaKey(dimension, name)
+	v, ok := table.QuotaConfigTable[key]
+	if !ok {
+		return nil
+	}
+
+	delete(table.QuotaConfigTable, key)
+	return v
+}
+
+func (table *QuotaConfigTable) Foreach(fn func(k string, v *QuotaConfig)) {
+	table.RLock()
+	defer table.RUnlock()
+
+	for k, v := range table.QuotaConfigTable {
+		fn(k, v)
+	}
+}
@@ -0,0 +1,72 @@
+package quota
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenBucket 令牌桶，令牌按rate匀速生成，桶容量为1秒的令牌数
+// 允许一次消费超过剩余令牌（例如大消息、拉取后才知道大小），欠下的令牌用后续生成的令牌补足
+// Since 2018/1/29
+type TokenBucket struct {
+	rate   float64 // 每秒生成的令牌数
+	tokens float64 // 当前令牌数，可能为负数
+	last   time.Time
+	lock   sync.Mutex
+}
+
+// NewTokenBucket 创建令牌桶，初始为满桶
+// Since 2018/1/29
+func NewTokenBucket(rate int64) *TokenBucket {
+	return &TokenBucket{
+		rate:   float64(rate),
+		tokens: float64(rate),
+		last:   time.Now(),
+	}
+}
+
+// Wait 剩余令牌不足1个时返回需要等待的时间，否则返回0
+// Since 2018/1/29
+func (self *TokenBucket) Wait() time.Duration {
+	return self.waitAt(time.Now())
+}
+
+// Consume 消费n个令牌
+// Since 2018/1/29
+func (self *TokenBucket) Consume(n int64) {
+	self.consumeAt(time.Now(), n)
+}
+
+func (self *TokenBucket) waitAt(now time.Time) time.Duration {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.refill(now)
+	if self.tokens >= 1 {
+		return 0
+	}
+
+	// 等待令牌数恢复到1个，向上多等待1毫秒
+	return time.Duration((1-self.tokens)/self.rate*float64(time.Second)) + time.Millisecond
+}
+
+func (self *TokenBucket) consumeAt(now time.Time, n int64) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.refill(now)
+	self.tokens -= float64(n)
+}
+
+func (self *TokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(self.last)
+	if elapsed <= 0 {
+		return
+	}
+
+	self.last = now
+	self.tokens += elapsed.Seconds() * self.rate
+	if self.tokens > self.rate {
+		self.tokens = self.rate
+	}
+}
@@ -8,6 +8,23 @@ const (
 	COMMIT_LOG_DISK_RATIO
 	CONSUME_QUEUE_DISK_RATIO
 	SCHEDULE_MESSAGE_OFFSET
+	MAPED_FILE_ALLOCATE_TIMES
+	MAPED_FILE_ALLOCATE_AVG_TIME
+	MAPED_FILE_ALLOCATE_MAX_TIME
+	MAPED_FILE_ALLOCATE_WAIT_MAX_TIME
+	MAPED_FILE_ALLOCATE_FALLBACK_TIMES
+	STORE_MODE
+	STORE_MODE_FORCED
+	STORE_RUNNING_FLAGS
+	CONSUME_QUEUE_REBUILD_STATUS
+	CONSUME_QUEUE_REBUILD_TARGET
+	CONSUME_QUEUE_REBUILD_PROGRESS
+	CONSUME_QUEUE_REBUILD_DISPATCH_NUMS
+	CONSUME_QUEUE_REBUILD_CORRUPT_NUMS
+	CONSUME_QUEUE_REBUILD_DIFF_NUMS
+	CONSUME_QUEUE_REBUILD_DIFF_SAMPLES
+	CONSUME_QUEUE_REBUILD_ELAPSED_TIME
+	CONSUME_QUEUE_REBUILD_ERROR
 )
 
 func (state RunningStats) String() string {
@@ -22,6 +39,40 @@ func (state RunningStats) String() string {
 		return "consumeQueueDiskRatio"
 	case SCHEDULE_MESSAGE_OFFSET:
 		return "scheduleMessageOffset"
+	case MAPED_FILE_ALLOCATE_TIMES:
+		return "mapedFileAllocateTimes"
+	case MAPED_FILE_ALLOCATE_AVG_TIME:
+		return "mapedFileAllocateAvgTime"
+	case MAPED_FILE_ALLOCATE_MAX_TIME:
+		return "mapedFileAllocateMaxTime"
+	case MAPED_FILE_ALLOCATE_WAIT_MAX_TIME:
+		return "mapedFileAllocateWaitMaxTime"
+	case MAPED_FILE_ALLOCATE_FALLBACK_TIMES:
+		return "mapedFileAllocateFallbackTimes"
+	case STORE_MODE:
+		return "storeMode"
+	case STORE_MODE_FORCED:
+		return "storeModeForced"
+	case STORE_RUNNING_FLAGS:
+		return "storeRunningFlags"
+	case CONSUME_QUEUE_REBUILD_STATUS:
+		return "consumeQueueRebuildStatus"
+	case CONSUME_QUEUE_REBUILD_TARGET:
+		return "consumeQueueRebuildTarget"
+	case CONSUME_QUEUE_REBUILD_PROGRESS:
+		return "consumeQueueRebuildProgress"
+	case CONSUME_QUEUE_REBUILD_DISPATCH_NUMS:
+		return "consumeQueueRebuildDispatchNums"
+	case CONSUME_QUEUE_REBUILD_CORRUPT_NUMS:
+		return "consumeQueueRebuildCorruptNums"
+	case CONSUME_QUEUE_REBUILD_DIFF_NUMS:
+		return "consumeQueueRebuildDiffNums"
+	case CONSUME_QUEUE_REBUILD_DIFF_SAMPLES:
+		return "consumeQueueRebuildDiffSamples"
+	case CONSUME_QUEUE_REBUILD_ELAPSED_TIME:
+		return "consumeQueueRebuildElapsedTime"
+	case CONSUME_QUEUE_REBUILD_ERROR:
+		return "consumeQueueRebuildError"
 	default:
 		return "Unknow"
 	}
@@ -3,6 +3,8 @@ package stgcommon
 import (
 	"fmt"
 	"strings"
+
+	"git.oschina.net/cloudzone/smartgo/stgnet/netm"
 )
 
 // SmartgoBrokerConfig 启动smartgoBroker所必需的配置项
@@ -21,6 +23,16 @@ type SmartgoBrokerConfig struct {
 	AutoCreateTopicEnable bool   // 是否允许客户端自动创建Topic
 	StorePathRootDir      string // broker、store等模块的数据存储目录
 	HaMasterAddress       string // 适用场景：HA功能配置(将slave角色的 ha地址，指向master角色)
+	AclEnable             bool   // 是否开启ACL权限校验
+	AclConfigPath         string // ACL账号配置文件路径，默认与broker配置文件同目录的plain_acl.toml
+	FiltersrvAccessKey    string // 同机Filter Server访问broker使用的ACL账号，broker开启ACL时需配置管理员账号
+	FiltersrvSecretKey    string // 同机Filter Server访问broker使用的ACL密钥
+
+	Tls netm.TlsConfig // [tls]配置，未配置mode时使用环境变量
+
+	MetricsPort              int   // Prometheus /metrics HTTP端口，0表示不开启
+	ConsumerLagAlertMessages int64 // 消费延迟消息数超过该值时告警，0表示不告警
+	ConsumerLagAlertSeconds  int64 // 消费延迟秒数超过该值时告警，0表示不告警
 }
 
 // ToString 打印smartgoBroker配置项
@@ -32,9 +44,11 @@ func (self *SmartgoBrokerConfig) ToString() string {
 	}
 
 	format := "SmartgoBrokerConfig [BrokerClusterName=%s, BrokerName=%s, BrokerId=%d, BrokerPort=%d, BrokerIP=%s, DeleteWhen=%d, "
-	format += "FileReservedTime=%d, BrokerRole=%s, FlushDiskType=%s, AutoCreateTopicEnable=%t, StorePathRootDir=%s, HaMasterAddress=%s ]"
+	format += "FileReservedTime=%d, BrokerRole=%s, FlushDiskType=%s, AutoCreateTopicEnable=%t, StorePathRootDir=%s, HaMasterAddress=%s, AclEnable=%t, AclConfigPath=%s, MetricsPort=%d, "
+	format += "ConsumerLagAlertMessages=%d, ConsumerLagAlertSeconds=%d ]"
 	info := fmt.Sprintf(format, self.BrokerClusterName, self.BrokerName, self.BrokerId, self.BrokerPort, self.BrokerIP, self.DeleteWhen,
-		self.FileReservedTime, self.BrokerRole, self.FlushDiskType, self.AutoCreateTopicEnable, self.StorePathRootDir, self.HaMasterAddress)
+		self.FileReservedTime, self.BrokerRole, self.FlushDiskType, self.AutoCreateTopicEnable, self.StorePathRootDir, self.HaMasterAddress,
+		self.AclEnable, self.AclConfigPath, self.MetricsPort, self.ConsumerLagAlertMessages, self.ConsumerLagAlertSeconds)
 	return info
 }
 
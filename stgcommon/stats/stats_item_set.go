@@ -110,6 +110,17 @@ func (stats *StatsItemSet) GetStatsItem(statsKey string) *StatsItem {
 	return statsItem
 }
 
+// Foreach 遍历统计单元
+// Since 2018/1/30
+func (stats *StatsItemSet) Foreach(fn func(statsKey string, statsItem *StatsItem)) {
+	stats.RLock()
+	defer stats.RUnlock()
+
+	for statsKey, statsItem := range stats.StatsItemTable {
+		fn(statsKey, statsItem)
+	}
+}
+
 // Init 统计单元集合初始化
 // Author rongzhihong
 // Since 2017/9/19
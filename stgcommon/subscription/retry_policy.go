@@ -0,0 +1,107 @@
+package subscription
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	EXPONENTIAL_RETRY = "EXPONENTIAL" // 指数退避：initial * multiplier^(n-1)，不超过max
+	CUSTOMIZED_RETRY  = "CUSTOMIZED"  // 自定义每次重试的间隔，重试次数超过列表长度时使用最后一个间隔
+)
+
+// RetryPolicy 订阅组的消费重试策略，broker按策略计算下一次投递时间，消息到期后才投递到重试队列
+// 未配置时沿用客户端的延迟级别
+// Since 2018/2/2
+type RetryPolicy struct {
+	Type                    string  `json:"type"`
+	InitialBackoffMillis    int64   `json:"initialBackoffMillis"`
+	Multiplier              float64 `json:"multiplier"`
+	MaxBackoffMillis        int64   `json:"maxBackoffMillis"`
+	CustomizedBackoffMillis []int64 `json:"customizedBackoffMillis"`
+}
+
+// NewExponentialRetryPolicy 初始化指数退避策略
+// Since 2018/2/2
+func NewExponentialRetryPolicy(initialBackoffMillis int64, multiplier float64, maxBackoffMillis int64) *RetryPolicy {
+	return &RetryPolicy{
+		Type:                 EXPONENTIAL_RETRY,
+		InitialBackoffMillis: initialBackoffMillis,
+		Multiplier:           multiplier,
+		MaxBackoffMillis:     maxBackoffMillis,
+	}
+}
+
+// NewCustomizedRetryPolicy 初始化自定义间隔策略
+// Since 2018/2/2
+func NewCustomizedRetryPolicy(backoffMillis ...int64) *RetryPolicy {
+	return &RetryPolicy{
+		Type:                    CUSTOMIZED_RETRY,
+		CustomizedBackoffMillis: backoffMillis,
+	}
+}
+
+// Validate 校验策略参数
+// Since 2018/2/2
+func (self *RetryPolicy) Validate() error {
+	switch self.Type {
+	case EXPONENTIAL_RETRY:
+		if self.InitialBackoffMillis <= 0 {
+			return fmt.Errorf("retry policy initialBackoffMillis must be positive, %d", self.InitialBackoffMillis)
+		}
+		if self.Multiplier < 1 {
+			return fmt.Errorf("retry policy multiplier must not be less than 1, %v", self.Multiplier)
+		}
+		if self.MaxBackoffMillis < self.InitialBackoffMillis {
+			return fmt.Errorf("retry policy maxBackoffMillis %d less than initialBackoffMillis %d",
+				self.MaxBackoffMillis, self.InitialBackoffMillis)
+		}
+	case CUSTOMIZED_RETRY:
+		if len(self.CustomizedBackoffMillis) == 0 {
+			return fmt.Errorf("retry policy customizedBackoffMillis is empty")
+		}
+		for _, backoff := range self.CustomizedBackoffMillis {
+			if backoff <= 0 {
+				return fmt.Errorf("retry policy customizedBackoffMillis must be positive, %v", self.CustomizedBackoffMillis)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown retry policy type %s", self.Type)
+	}
+	return nil
+}
+
+// NextBackoffMillis 第reconsumeTimes次重试（从1开始）前的等待时间
+// Since 2018/2/2
+func (self *RetryPolicy) NextBackoffMillis(reconsumeTimes int32) int64 {
+	if reconsumeTimes < 1 {
+		reconsumeTimes = 1
+	}
+
+	switch self.Type {
+	case EXPONENTIAL_RETRY:
+		backoff := float64(self.InitialBackoffMillis) * math.Pow(self.Multiplier, float64(reconsumeTimes-1))
+		if backoff > float64(self.MaxBackoffMillis) {
+			return self.MaxBackoffMillis
+		}
+		return int64(backoff)
+	case CUSTOMIZED_RETRY:
+		if len(self.CustomizedBackoffMillis) == 0 {
+			return 0
+		}
+		index := int(reconsumeTimes) - 1
+		if index >= len(self.CustomizedBackoffMillis) {
+			index = len(self.CustomizedBackoffMillis) - 1
+		}
+		return self.CustomizedBackoffMillis[index]
+	}
+	return 0
+}
+
+func (self *RetryPolicy) String() string {
+	if self.Type == CUSTOMIZED_RETRY {
+		return fmt.Sprintf("RetryPolicy {type=%s, customizedBackoffMillis=%v}", self.Type, self.CustomizedBackoffMillis)
+	}
+	return fmt.Sprintf("RetryPolicy {type=%s, initialBackoffMillis=%d, multiplier=%v, maxBackoffMillis=%d}",
+		self.Type, self.InitialBackoffMillis, self.Multiplier, self.MaxBackoffMillis)
+}
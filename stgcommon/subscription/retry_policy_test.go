@@ -0,0 +1,49 @@
+package subscription
+
+import (
+	"testing"
+)
+
+func TestExponentialRetryPolicy(t *testing.T) {
+	policy := NewExponentialRetryPolicy(1000, 2, 5000)
+	if err := policy.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	expects := []int64{1000, 2000, 4000, 5000, 5000}
+	for i, expect := range expects {
+		if backoff := policy.NextBackoffMillis(int32(i + 1)); backoff != expect {
+			t.Fatalf("reconsumeTimes %d backoff %d, expect %d", i+1, backoff, expect)
+		}
+	}
+}
+
+func TestCustomizedRetryPolicy(t *testing.T) {
+	policy := NewCustomizedRetryPolicy(100, 3000, 60000)
+	if err := policy.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	expects := []int64{100, 3000, 60000, 60000}
+	for i, expect := range expects {
+		if backoff := policy.NextBackoffMillis(int32(i + 1)); backoff != expect {
+			t.Fatalf("reconsumeTimes %d backoff %d, expect %d", i+1, backoff, expect)
+		}
+	}
+}
+
+func TestRetryPolicyValidate(t *testing.T) {
+	invalids := []*RetryPolicy{
+		NewExponentialRetryPolicy(0, 2, 1000),
+		NewExponentialRetryPolicy(1000, 0.5, 2000),
+		NewExponentialRetryPolicy(1000, 2, 500),
+		NewCustomizedRetryPolicy(),
+		NewCustomizedRetryPolicy(1000, -1),
+		{Type: "LINEAR"},
+	}
+	for _, policy := range invalids {
+		if err := policy.Validate(); err == nil {
+			t.Fatalf("%s should be invalid", policy.String())
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package stgcommon
+
+import "fmt"
+
+// TopicCleanupPolicy Topic过期数据清理策略，默认为按时间删除
+// Since 2018/1/8
+type TopicCleanupPolicy int
+
+const (
+	CLEANUP_POLICY_DELETE  TopicCleanupPolicy = iota // 按文件保留时间删除过期消息
+	CLEANUP_POLICY_COMPACT                           // 按消息Key压缩，每个Key只保留最新一条消息
+)
+
+var patternTopicCleanupPolicy = map[string]TopicCleanupPolicy{
+	"delete":  CLEANUP_POLICY_DELETE,
+	"compact": CLEANUP_POLICY_COMPACT,
+}
+
+func (self TopicCleanupPolicy) ToString() string {
+	switch self {
+	case CLEANUP_POLICY_DELETE:
+		return "delete"
+	case CLEANUP_POLICY_COMPACT:
+		return "compact"
+	default:
+		return ""
+	}
+}
+
+// ParseTopicCleanupPolicy 解析清理策略，例如"delete"、"compact"
+// Since 2018/1/8
+func ParseTopicCleanupPolicy(desc string) (TopicCleanupPolicy, error) {
+	if policy, ok := patternTopicCleanupPolicy[desc]; ok {
+		return policy, nil
+	}
+	return -1, fmt.Errorf("ParseTopicCleanupPolicy failed. unknown match '%s' to TopicCleanupPolicy", desc)
+}
@@ -15,14 +15,19 @@ const (
 )
 
 type TopicConfig struct {
-	SEPARATOR       string
-	TopicName       string          `json:"topicName"`
-	ReadQueueNums   int32           `json:"readQueueNums"`
-	WriteQueueNums  int32           `json:"writeQueueNums"`
-	Perm            int             `json:"perm"`
-	TopicFilterType TopicFilterType `json:"topicFilterType"`
-	TopicSysFlag    int             `json:"topicSysFlag"`
-	Order           bool            `json:"order"`
+	SEPARATOR         string
+	TopicName         string             `json:"topicName"`
+	ReadQueueNums     int32              `json:"readQueueNums"`
+	WriteQueueNums    int32              `json:"writeQueueNums"`
+	Perm              int                `json:"perm"`
+	TopicFilterType   TopicFilterType    `json:"topicFilterType"`
+	TopicSysFlag      int                `json:"topicSysFlag"`
+	Order             bool               `json:"order"`
+	CleanupPolicy     TopicCleanupPolicy `json:"cleanupPolicy"`     // 过期数据清理策略
+	RetentionHours    int32              `json:"retentionHours"`    // 消息保留时间（单位小时），0表示使用broker全局配置
+	RetentionBytes    int64              `json:"retentionBytes"`    // 每个队列消息保留大小（单位字节），0表示不限制
+	IndexedProperties []string           `json:"indexedProperties"` // 需要建立索引的消息属性名称，例如orderId、traceId
+	MessageTtlSeconds int64              `json:"messageTtlSeconds"` // 消息默认存活时间（单位秒），超时未消费的消息读取时跳过，0表示永不过期
 }
 
 func NewTopicConfig(topicName string) *TopicConfig {
@@ -75,8 +80,36 @@ func (self *TopicConfig) ToString() string {
 	}
 
 	filterType := int(self.TopicFilterType)
-	format := "TopicConfig [topicName=%s, readQueueNums=%d, writeQueueNums=%d, perm=%s, topicFilterType=%d, topicSysFlag=%d, order=%t]"
-	return fmt.Sprintf(format, self.TopicName, self.ReadQueueNums, self.WriteQueueNums, self.ToPermString(), filterType, self.TopicSysFlag, self.Order)
+	format := "TopicConfig [topicName=%s, readQueueNums=%d, writeQueueNums=%d, perm=%s, topicFilterType=%d, topicSysFlag=%d, order=%t, cleanupPolicy=%s, retentionHours=%d, retentionBytes=%d, indexedProperties=%v, messageTtlSeconds=%d]"
+	return fmt.Sprintf(format, self.TopicName, self.ReadQueueNums, self.WriteQueueNums, self.ToPermString(), filterType, self.TopicSysFlag,
+		self.Order, self.CleanupPolicy.ToString(), self.RetentionHours, self.RetentionBytes, self.IndexedProperties, self.MessageTtlSeconds)
+}
+
+// HasRetention 是否配置了Topic级别的保留时间或保留大小
+// Since 2018/1/10
+func (self *TopicConfig) HasRetention() bool {
+	return self != nil && (self.RetentionHours > 0 || self.RetentionBytes > 0)
+}
+
+// IsIndexedProperty 消息属性是否需要建立索引
+// Since 2018/1/12
+func (self *TopicConfig) IsIndexedProperty(propertyName string) bool {
+	if self == nil {
+		return false
+	}
+
+	for _, name := range self.IndexedProperties {
+		if name == propertyName {
+			return true
+		}
+	}
+	return false
+}
+
+// IsCompacted 是否为压缩Topic(cleanupPolicy=compact)
+// Since 2018/1/8
+func (self *TopicConfig) IsCompacted() bool {
+	return self != nil && self.CleanupPolicy == CLEANUP_POLICY_COMPACT
 }
 
 func (self *TopicConfig) ToPermString() string {
@@ -1,6 +1,9 @@
 package timeutil
 
-import "time"
+import (
+	"sync/atomic"
+	"time"
+)
 
 type Ticker struct {
 	tm    *time.Timer
@@ -34,7 +37,7 @@ func (t *Ticker) start() {
 		t.over = make(chan interface{})
 	}
 
-	t.tm = time.NewTimer(t.d)
+	t.tm = time.NewTimer(t.period())
 	t.isRun = true
 
 	if t.delay >= 0 {
@@ -54,17 +57,26 @@ func (t *Ticker) start() {
 				return
 			}
 
-			t.tm.Reset(t.d)
+			t.tm.Reset(t.period())
 		}
 	}
 }
 
 func (t *Ticker) flush() {
 	if t.isRun {
-		t.tm.Reset(t.d)
+		t.tm.Reset(t.period())
 	}
 }
 
+// SetPeriod change the period, take effect after the next execution
+func (t *Ticker) SetPeriod(period time.Duration) {
+	atomic.StoreInt64((*int64)(&t.d), int64(period))
+}
+
+func (t *Ticker) period() time.Duration {
+	return time.Duration(atomic.LoadInt64((*int64)(&t.d)))
+}
+
 // Stop stop ticker
 func (t *Ticker) Stop() bool {
 	if t.isRun == false {
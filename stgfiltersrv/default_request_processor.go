@@ -0,0 +1,177 @@
+package stgfiltersrv
+
+import (
+	"bytes"
+	"fmt"
+
+	"git.oschina.net/cloudzone/smartgo/stgclient/consumer"
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/message"
+	code "git.oschina.net/cloudzone/smartgo/stgcommon/protocol"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/header"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/header/filtersrv"
+	"git.oschina.net/cloudzone/smartgo/stgnet/netm"
+	"git.oschina.net/cloudzone/smartgo/stgnet/protocol"
+	"git.oschina.net/cloudzone/smartgo/stgnet/remoting"
+)
+
+// rateLimitedRetryAfterMillis broker限流时建议消费者等待的时间，broker的建议值不会透传给Filter Server
+const rateLimitedRetryAfterMillis = 1000
+
+// DefaultRequestProcessor Filter Server请求处理器
+// Since 2018/2/5
+type DefaultRequestProcessor struct {
+	FiltersrvController *FiltersrvController
+}
+
+// NewDefaultRequestProcessor 初始化Filter Server请求处理器
+// Since 2018/2/5
+func NewDefaultRequestProcessor(controller *FiltersrvController) remoting.RequestProcessor {
+	return &DefaultRequestProcessor{FiltersrvController: controller}
+}
+
+// ProcessRequest 处理消费者注册过滤逻辑及拉消息请求
+// Since 2018/2/5
+func (self *DefaultRequestProcessor) ProcessRequest(ctx netm.Context, request *protocol.RemotingCommand) (*protocol.RemotingCommand, error) {
+	switch request.Code {
+	case code.REGISTER_MESSAGE_FILTER_CLASS:
+		return self.registerMessageFilterClass(ctx, request) // code=302, 消费者上传过滤逻辑
+	case code.PULL_MESSAGE:
+		return self.pullMessageForward(ctx, request) // code=11, 从broker拉消息过滤后返回
+	}
+
+	remark := fmt.Sprintf("request code %d not supported by filter server", request.Code)
+	return protocol.CreateResponseCommand(code.REQUEST_CODE_NOT_SUPPORTED, remark), nil
+}
+
+// registerMessageFilterClass 注册订阅组的过滤逻辑，过滤逻辑源码在请求body中
+// Since 2018/2/5
+func (self *DefaultRequestProcessor) registerMessageFilterClass(ctx netm.Context, request *protocol.RemotingCommand) (*protocol.RemotingCommand, error) {
+	response := protocol.CreateDefaultResponseCommand()
+
+	requestHeader := &filtersrv.RegisterMessageFilterClassRequestHeader{}
+	if err := request.DecodeCommandCustomHeader(requestHeader); err != nil {
+		response.Remark = err.Error()
+		return response, nil
+	}
+
+	err := self.FiltersrvController.FilterClassManager.RegisterFilterClass(requestHeader.ConsumerGroup, requestHeader.Topic,
+		requestHeader.ClassName, requestHeader.ClassCRC, request.Body)
+	if err != nil {
+		logger.Errorf("register filter class from %s failed: %s", ctx.RemoteAddr().String(), err.Error())
+		response.Remark = err.Error()
+		return response, nil
+	}
+
+	response.Code = code.SUCCESS
+	response.Remark = ""
+	return response, nil
+}
+
+// pullMessageForward 以消费者请求的offset从所在broker拉取消息，按订阅组的过滤逻辑过滤后返回
+// Since 2018/2/5
+func (self *DefaultRequestProcessor) pullMessageForward(ctx netm.Context, request *protocol.RemotingCommand) (*protocol.RemotingCommand, error) {
+	responseHeader := &header.PullMessageResponseHeader{}
+	response := protocol.CreateDefaultResponseCommand(responseHeader)
+
+	requestHeader := &header.PullMessageRequestHeader{}
+	if err := request.DecodeCommandCustomHeader(requestHeader); err != nil {
+		response.Remark = err.Error()
+		return response, nil
+	}
+
+	filterClass := self.FiltersrvController.FilterClassManager.FindFilterClass(requestHeader.ConsumerGroup, requestHeader.Topic)
+	if filterClass == nil {
+		response.Remark = "Find Filter class failed, not registered"
+		return response, nil
+	}
+
+	brokerName := self.FiltersrvController.BrokerName()
+	if brokerName == "" {
+		response.Remark = "filter server not registered to broker yet"
+		return response, nil
+	}
+
+	maxNums := requestHeader.MaxMsgNums
+	if maxNums <= 0 || maxNums > self.FiltersrvController.FiltersrvConfig.PullMaxNums {
+		maxNums = self.FiltersrvController.FiltersrvConfig.PullMaxNums
+	}
+	mq := &message.MessageQueue{Topic: requestHeader.Topic, BrokerName: brokerName, QueueId: int(requestHeader.QueueId)}
+	pullResult, err := self.FiltersrvController.pullBlockIfNotFound(mq, requestHeader.QueueOffset, maxNums)
+	if err != nil {
+		logger.Errorf("filter server pull %s from broker failed: %s", mq.ToString(), err.Error())
+		response.Remark = err.Error()
+		return response, nil
+	}
+
+	responseHeader.NextBeginOffset = pullResult.NextBeginOffset
+	responseHeader.MinOffset = pullResult.MinOffset
+	responseHeader.MaxOffset = pullResult.MaxOffset
+	responseHeader.SuggestWhichBrokerId = stgcommon.MASTER_ID
+
+	switch pullResult.PullStatus {
+	case consumer.FOUND:
+		body, err := filterMessages(filterClass, pullResult.MsgFoundList)
+		if err != nil {
+			logger.Errorf("filter server encode messages failed: %s", err.Error())
+			response.Remark = err.Error()
+			return response, nil
+		}
+		if len(body) == 0 {
+			// 消息都被过滤掉，消费者更新offset后立即重新拉取
+			response.Code = code.PULL_RETRY_IMMEDIATELY
+		} else {
+			response.Code = code.SUCCESS
+			response.Body = body
+		}
+	case consumer.NO_MATCHED_MSG:
+		response.Code = code.PULL_RETRY_IMMEDIATELY
+	case consumer.NO_NEW_MSG:
+		response.Code = code.PULL_NOT_FOUND
+	case consumer.OFFSET_ILLEGAL:
+		response.Code = code.PULL_OFFSET_MOVED
+	case consumer.RATE_LIMITED:
+		response.Code = code.RATE_LIMITED
+		response.Remark = fmt.Sprintf("broker %s rate limited, retry after %dms", brokerName, rateLimitedRetryAfterMillis)
+		response.CustomHeader = header.NewRateLimitedResponseHeader(rateLimitedRetryAfterMillis)
+		return response, nil
+	}
+
+	response.Remark = ""
+	return response, nil
+}
+
+// filterMessages 按过滤逻辑过滤消息，并将命中的消息重新编码为拉消息响应的body
+// Since 2018/2/5
+func filterMessages(filterClass *FilterClassInfo, msgs []*message.MessageExt) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, msg := range msgs {
+		if !filterClass.Expression.Evaluate(&messageContext{msg: msg}) {
+			continue
+		}
+		msgBytes, err := msg.Encode()
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(msgBytes)
+	}
+	return buf.Bytes(), nil
+}
+
+// messageContext 过滤表达式中的变量：TOPIC、BODY以及消息属性，例如TAGS、KEYS和用户自定义属性
+// Since 2018/2/5
+type messageContext struct {
+	msg *message.MessageExt
+}
+
+func (self *messageContext) Get(name string) (string, bool) {
+	switch name {
+	case "TOPIC":
+		return self.msg.Topic, true
+	case "BODY":
+		return string(self.msg.Body), true
+	}
+	value, ok := self.msg.Properties[name]
+	return value, ok
+}
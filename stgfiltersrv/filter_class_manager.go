@@ -0,0 +1,78 @@
+package stgfiltersrv
+
+import (
+	"fmt"
+	"sync"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/filter/expression"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
+)
+
+// FilterClassInfo 订阅组在topic上注册的过滤逻辑
+// Since 2018/2/5
+type FilterClassInfo struct {
+	ClassName  string
+	ClassCRC   int32
+	Expression *expression.Expression
+}
+
+// FilterClassManager 管理消费者上传的过滤逻辑，key为topic@consumerGroup
+// Since 2018/2/5
+type FilterClassManager struct {
+	filterClassTable map[string]*FilterClassInfo
+	lock             sync.RWMutex
+}
+
+// NewFilterClassManager 初始化FilterClassManager
+// Since 2018/2/5
+func NewFilterClassManager() *FilterClassManager {
+	return &FilterClassManager{
+		filterClassTable: make(map[string]*FilterClassInfo),
+	}
+}
+
+func buildFilterClassKey(topic, consumerGroup string) string {
+	return topic + "@" + consumerGroup
+}
+
+// RegisterFilterClass 注册过滤逻辑，消费者每次心跳都会上传，类名与CRC未变化时不重复编译
+// Since 2018/2/5
+func (self *FilterClassManager) RegisterFilterClass(consumerGroup, topic, className string, classCRC int32, classBody []byte) error {
+	key := buildFilterClassKey(topic, consumerGroup)
+
+	self.lock.RLock()
+	old, ok := self.filterClassTable[key]
+	self.lock.RUnlock()
+	if ok && old.ClassName == className && old.ClassCRC == classCRC {
+		return nil
+	}
+
+	crc, err := stgcommon.Crc32(classBody)
+	if err != nil {
+		return err
+	}
+	if crc != classCRC {
+		return fmt.Errorf("filter class %s crc %d not match %d", className, crc, classCRC)
+	}
+
+	expr, err := expression.Compile(string(classBody))
+	if err != nil {
+		return fmt.Errorf("compile filter class %s failed: %s", className, err.Error())
+	}
+
+	self.lock.Lock()
+	self.filterClassTable[key] = &FilterClassInfo{ClassName: className, ClassCRC: classCRC, Expression: expr}
+	self.lock.Unlock()
+
+	logger.Infof("register filter class OK, ConsumerGroup: %s Topic: %s ClassName: %s %s", consumerGroup, topic, className, expr.String())
+	return nil
+}
+
+// FindFilterClass 查找订阅组在topic上的过滤逻辑，未注册时返回nil
+// Since 2018/2/5
+func (self *FilterClassManager) FindFilterClass(consumerGroup, topic string) *FilterClassInfo {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.filterClassTable[buildFilterClassKey(topic, consumerGroup)]
+}
@@ -0,0 +1,49 @@
+package stgfiltersrv
+
+import (
+	"testing"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/message"
+)
+
+func TestRegisterFilterClass(t *testing.T) {
+	manager := NewFilterClassManager()
+	source := []byte("TAGS = 'TagA' AND amount > 100")
+	crc, _ := stgcommon.Crc32(source)
+
+	if err := manager.RegisterFilterClass("group", "topic", "AmountFilter", crc+1, source); err == nil {
+		t.Errorf("register filter class with wrong crc should fail")
+	}
+	if err := manager.RegisterFilterClass("group", "topic", "AmountFilter", crc, source); err != nil {
+		t.Fatalf("register filter class failed: %s", err.Error())
+	}
+	if manager.FindFilterClass("other", "topic") != nil {
+		t.Errorf("filter class registered by group should not be found by other group")
+	}
+
+	filterClass := manager.FindFilterClass("group", "topic")
+	if filterClass == nil || filterClass.ClassCRC != crc {
+		t.Fatalf("filter class not found")
+	}
+
+	msg := &message.MessageExt{}
+	msg.Topic = "topic"
+	msg.Properties = map[string]string{message.PROPERTY_TAGS: "TagA", "amount": "150"}
+	if !filterClass.Expression.Evaluate(&messageContext{msg: msg}) {
+		t.Errorf("message %v should match %s", msg.Properties, filterClass.Expression.Source())
+	}
+	msg.Properties["amount"] = "99"
+	if filterClass.Expression.Evaluate(&messageContext{msg: msg}) {
+		t.Errorf("message %v should not match %s", msg.Properties, filterClass.Expression.Source())
+	}
+
+	invalid := []byte("amount >")
+	invalidCRC, _ := stgcommon.Crc32(invalid)
+	if err := manager.RegisterFilterClass("group", "topic", "AmountFilter", invalidCRC, invalid); err == nil {
+		t.Errorf("register invalid filter class should fail")
+	}
+	if manager.FindFilterClass("group", "topic") != filterClass {
+		t.Errorf("invalid filter class should not replace the registered one")
+	}
+}
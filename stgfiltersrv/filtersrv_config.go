@@ -0,0 +1,66 @@
+package stgfiltersrv
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"git.oschina.net/cloudzone/smartgo/stgclient"
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/static"
+)
+
+// FiltersrvConfig Filter Server配置项
+// Since 2018/2/5
+type FiltersrvConfig struct {
+	NamesrvAddr                  string // namesrv地址，内部拉消息的consumer使用
+	ConnectWhichBroker           string // 所在broker的地址，Filter Server只与本机broker通信
+	FilterServerIP               string // Filter Server对外提供服务的IP
+	ListenPort                   int    // 监听端口，0表示启动时选择空闲端口
+	RegisterBrokerIntervalMillis int64  // 向broker注册的间隔，broker 30s未收到注册会剔除Filter Server
+	PullMaxNums                  int    // 每次从broker拉取的最大消息数
+	AccessKey                    string // broker开启ACL时，向broker注册及拉消息使用的账号
+	SecretKey                    string // broker开启ACL时，向broker注册及拉消息使用的密钥
+}
+
+// NewFiltersrvConfig 初始化默认配置，默认连接本机默认端口的broker
+// Since 2018/2/5
+func NewFiltersrvConfig() *FiltersrvConfig {
+	localAddress := stgclient.GetLocalAddress()
+	return &FiltersrvConfig{
+		NamesrvAddr:                  os.Getenv(stgcommon.NAMESRV_ADDR_ENV),
+		ConnectWhichBroker:           fmt.Sprintf("%s:%d", localAddress, static.BROKER_PORT),
+		FilterServerIP:               localAddress,
+		RegisterBrokerIntervalMillis: 10000,
+		PullMaxNums:                  32,
+	}
+}
+
+// ensureListenPort 未指定监听端口时选择一个空闲端口
+// Since 2018/2/5
+func (self *FiltersrvConfig) ensureListenPort() error {
+	if self.ListenPort > 0 {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	self.ListenPort = listener.Addr().(*net.TCPAddr).Port
+	return nil
+}
+
+// FilterServerAddr Filter Server对外服务地址，向broker注册后由broker上报namesrv
+// Since 2018/2/5
+func (self *FiltersrvConfig) FilterServerAddr() string {
+	return fmt.Sprintf("%s:%d", self.FilterServerIP, self.ListenPort)
+}
+
+func (self *FiltersrvConfig) ToString() string {
+	format := "FiltersrvConfig {namesrvAddr=%s, connectWhichBroker=%s, filterServerIP=%s, listenPort=%d, registerBrokerIntervalMillis=%d, pullMaxNums=%d, accessKey=%s}"
+	return fmt.Sprintf(format, self.NamesrvAddr, self.ConnectWhichBroker, self.FilterServerIP, self.ListenPort,
+		self.RegisterBrokerIntervalMillis, self.PullMaxNums, self.AccessKey)
+}
@@ -0,0 +1,165 @@
+package stgfiltersrv
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"git.oschina.net/cloudzone/smartgo/stgclient/consumer"
+	"git.oschina.net/cloudzone/smartgo/stgclient/process"
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/acl"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/message"
+	code "git.oschina.net/cloudzone/smartgo/stgcommon/protocol"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/header/filtersrv"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/utils/timeutil"
+	"git.oschina.net/cloudzone/smartgo/stgnet/protocol"
+	"git.oschina.net/cloudzone/smartgo/stgnet/remoting"
+)
+
+// FiltersrvController Filter Server控制器：定时向所在broker注册，代替消费者从broker拉消息并按上传的过滤逻辑过滤
+// Since 2018/2/5
+type FiltersrvController struct {
+	FiltersrvConfig    *FiltersrvConfig
+	RemotingServer     *remoting.DefalutRemotingServer // 接收消费者的请求
+	RemotingClient     *remoting.DefalutRemotingClient // 向broker注册
+	FilterClassManager *FilterClassManager
+	PullConsumer       *process.DefaultMQPullConsumer // 从所在broker拉消息
+	registerTask       *timeutil.Ticker
+	brokerName         string
+	brokerId           int64
+	registered         bool
+	lock               sync.RWMutex
+}
+
+// NewFiltersrvController 初始化Filter Server控制器，配置了accessKey时注册及拉消息的请求带上ACL签名
+// Since 2018/2/5
+func NewFiltersrvController(cfg *FiltersrvConfig) *FiltersrvController {
+	controller := &FiltersrvController{
+		FiltersrvConfig:    cfg,
+		RemotingServer:     remoting.NewDefalutRemotingServer("0.0.0.0", cfg.ListenPort),
+		RemotingClient:     remoting.NewDefalutRemotingClient(),
+		FilterClassManager: NewFilterClassManager(),
+	}
+	if cfg.AccessKey != "" {
+		rpcHook := acl.NewAclClientRPCHook(cfg.AccessKey, cfg.SecretKey)
+		controller.RemotingClient.RegisterRPCHook(rpcHook)
+		controller.PullConsumer = process.NewDefaultMQPullConsumer(stgcommon.FILTERSRV_CONSUMER_GROUP, rpcHook)
+	} else {
+		controller.PullConsumer = process.NewDefaultMQPullConsumer(stgcommon.FILTERSRV_CONSUMER_GROUP)
+	}
+	controller.PullConsumer.SetNamesrvAddr(cfg.NamesrvAddr)
+
+	interval := time.Duration(cfg.RegisterBrokerIntervalMillis) * time.Millisecond
+	controller.registerTask = timeutil.NewTicker(false, 3*time.Second, interval, func() {
+		controller.registerFilterServerToBroker()
+	})
+	return controller
+}
+
+// Initialize 注册请求处理器
+// Since 2018/2/5
+func (self *FiltersrvController) Initialize() bool {
+	self.RemotingServer.RegisterDefaultProcessor(NewDefaultRequestProcessor(self))
+	return true
+}
+
+// Start 启动内部consumer、定时注册任务及服务端
+// Since 2018/2/5
+func (self *FiltersrvController) Start() {
+	self.PullConsumer.Start()
+	self.RemotingClient.Start()
+	self.registerTask.Start()
+	logger.Infof("filter server controller start, %s", self.FiltersrvConfig.ToString())
+	self.RemotingServer.Start()
+}
+
+// Shutdown 关闭Filter Server
+// Since 2018/2/5
+func (self *FiltersrvController) Shutdown() {
+	if self.registerTask != nil {
+		self.registerTask.Stop()
+	}
+	if self.RemotingServer != nil {
+		self.RemotingServer.Shutdown()
+	}
+	if self.RemotingClient != nil {
+		self.RemotingClient.Shutdown()
+	}
+	if self.PullConsumer != nil {
+		self.PullConsumer.Shutdown()
+	}
+	logger.Infof("filter server %s shutdown successful", self.FiltersrvConfig.FilterServerAddr())
+}
+
+// registerShutdownHook 收到终止信号时关闭Filter Server
+// Since 2018/2/5
+func (self *FiltersrvController) registerShutdownHook(stopChan chan bool) {
+	stopSignalChan := make(chan os.Signal, 1)
+	signal.Notify(stopSignalChan, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		s := <-stopSignalChan
+		logger.Infof("receive signal code = %d", s)
+		self.Shutdown()
+		logger.Flush()
+		stopChan <- true
+	}()
+}
+
+// registerFilterServerToBroker 向所在broker注册，broker据此上报namesrv并在30s未注册时剔除
+// Since 2018/2/5
+func (self *FiltersrvController) registerFilterServerToBroker() {
+	requestHeader := &filtersrv.RegisterFilterServerRequestHeader{FilterServerAddr: self.FiltersrvConfig.FilterServerAddr()}
+	request := protocol.CreateRequestCommand(code.REGISTER_FILTER_SERVER, requestHeader)
+	response, err := self.RemotingClient.InvokeSync(self.FiltersrvConfig.ConnectWhichBroker, request, 3000)
+	if err != nil {
+		logger.Errorf("register filter server to broker %s failed: %s", self.FiltersrvConfig.ConnectWhichBroker, err.Error())
+		return
+	}
+	if response == nil || response.Code != code.SUCCESS {
+		logger.Errorf("register filter server to broker %s failed, response: %v", self.FiltersrvConfig.ConnectWhichBroker, response)
+		return
+	}
+
+	responseHeader := &filtersrv.RegisterFilterServerResponseHeader{}
+	if err := response.DecodeCommandCustomHeader(responseHeader); err != nil {
+		logger.Errorf("register filter server to broker, decode response header failed: %s", err.Error())
+		return
+	}
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.brokerName = responseHeader.BrokerName
+	if !self.registered || self.brokerId != responseHeader.BrokerId {
+		// 只从所在broker拉消息，不按broker的建议切换到其他节点
+		self.brokerId = responseHeader.BrokerId
+		self.PullConsumer.ConnectBrokerByUser(int(responseHeader.BrokerId))
+		self.registered = true
+		logger.Infof("register filter server %s to broker %s[%s %d] OK", self.FiltersrvConfig.FilterServerAddr(),
+			self.FiltersrvConfig.ConnectWhichBroker, self.brokerName, self.brokerId)
+	}
+}
+
+// BrokerName 所在broker的名称，尚未注册成功时为空
+// Since 2018/2/5
+func (self *FiltersrvController) BrokerName() string {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.brokerName
+}
+
+// pullBlockIfNotFound 从所在broker拉消息，没有新消息时在broker挂起
+// Since 2018/2/5
+func (self *FiltersrvController) pullBlockIfNotFound(mq *message.MessageQueue, offset int64, maxNums int) (pullResult *consumer.PullResult, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%v", e)
+		}
+	}()
+	return self.PullConsumer.PullBlockIfNotFound(mq, "*", offset, maxNums)
+}
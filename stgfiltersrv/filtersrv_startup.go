@@ -0,0 +1,64 @@
+package stgfiltersrv
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/static"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/utils/parseutil"
+)
+
+// Start 启动Filter Server，cfgPath为所在broker的toml配置文件，用于确定broker的地址
+// Since 2018/2/5
+func Start(stopChannel chan bool, cfgPath, namesrvAddr string, listenPort int) *FiltersrvController {
+	controller := CreateFiltersrvController(cfgPath, namesrvAddr, listenPort)
+
+	if !controller.Initialize() {
+		fmt.Println("the filter server controller initialize failed")
+		controller.Shutdown()
+		os.Exit(0)
+	}
+
+	controller.registerShutdownHook(stopChannel)
+
+	go func() {
+		// RemotingServer.Start()会阻塞，放到协程中启动
+		controller.Start()
+	}()
+	fmt.Printf("the filter server boot success, %s\n", controller.FiltersrvConfig.FilterServerAddr())
+	return controller
+}
+
+// CreateFiltersrvController 根据broker配置文件及启动参数创建Filter Server控制器
+// Since 2018/2/5
+func CreateFiltersrvController(cfgPath, namesrvAddr string, listenPort int) *FiltersrvController {
+	cfg := NewFiltersrvConfig()
+	if cfgPath != "" {
+		brokerCfg := new(stgcommon.SmartgoBrokerConfig)
+		parseutil.ParseConf(cfgPath, brokerCfg)
+		brokerIP, brokerPort := cfg.FilterServerIP, static.BROKER_PORT
+		if strings.TrimSpace(brokerCfg.BrokerIP) != "" {
+			brokerIP = strings.TrimSpace(brokerCfg.BrokerIP)
+		}
+		if brokerCfg.BrokerPort > 0 {
+			brokerPort = brokerCfg.BrokerPort
+		}
+		cfg.ConnectWhichBroker = fmt.Sprintf("%s:%d", brokerIP, brokerPort)
+		cfg.AccessKey = strings.TrimSpace(brokerCfg.FiltersrvAccessKey)
+		cfg.SecretKey = strings.TrimSpace(brokerCfg.FiltersrvSecretKey)
+	}
+	if strings.TrimSpace(namesrvAddr) != "" {
+		cfg.NamesrvAddr = strings.TrimSpace(namesrvAddr)
+	}
+	cfg.ListenPort = listenPort
+	if err := cfg.ensureListenPort(); err != nil {
+		fmt.Printf("the filter server choose listen port failed: %s\n", err.Error())
+		os.Exit(0)
+	}
+
+	logger.Infof("create filter server controller, %s", cfg.ToString())
+	return NewFiltersrvController(cfg)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon/mqversion"
+	"git.oschina.net/cloudzone/smartgo/stgfiltersrv"
+	"github.com/toolkits/file"
+)
+
+func main() {
+	c := flag.String("c", "", "the co-located broker config *.toml file")
+	n := flag.String("n", "", "namesrv address, eg: 127.0.0.1:9876")
+	p := flag.Int("p", 0, "filter server listen port, 0 means a random free port")
+	v := flag.Bool("v", false, "version")
+	h := flag.Bool("h", false, "help")
+
+	flag.Parse()
+
+	if *h {
+		flag.Usage()
+		os.Exit(0)
+	}
+	if *v {
+		fmt.Println(mqversion.GetCurrentDesc())
+		os.Exit(0)
+	}
+
+	cfgPath := strings.TrimSpace(*c)
+	if cfgPath != "" && !file.IsExist(cfgPath) {
+		fmt.Println("use -c to valid broker config path. eg: -c /home/smartgo-bin/conf/broker-a.toml")
+		os.Exit(0)
+	}
+
+	stopChannel := make(chan bool, 1) // the 'stopChannel' variable to handle controller.shutdownHook()
+	stgfiltersrv.Start(stopChannel, cfgPath, *n, *p)
+
+	for {
+		select {
+		case <-stopChannel:
+			return
+		}
+	}
+}
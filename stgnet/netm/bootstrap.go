@@ -23,6 +23,7 @@ type Bootstrap struct {
 	mu                sync.Mutex
 	running           bool
 	grRunning         bool
+	tlsContext        *TlsContext
 }
 
 // NewBootstrap 创建启动器
@@ -114,27 +115,52 @@ func (bootstrap *Bootstrap) Sync() {
 			continue
 		}
 
-		// 以客户端ip,port管理连接
-		remoteAddr := conn.RemoteAddr().String()
-		ctx := newDefaultContext(remoteAddr, conn, bootstrap)
-		bootstrap.contextTableLock.Lock()
-		bootstrap.contextTable[remoteAddr] = ctx
-		bootstrap.contextTableLock.Unlock()
-		//bootstrap.Debugf("Client connection created %s", remoteAddr)
-
-		bootstrap.startGoRoutine(func() {
-			bootstrap.handleConn(ctx)
-		})
+		// TLS握手可能阻塞，在独立协程中完成握手后再管理连接
+		if bootstrap.tlsContext.Enabled() {
+			bootstrap.startGoRoutine(func() {
+				bootstrap.acceptTlsConn(conn)
+			})
+			continue
+		}
 
-		// 通知连接创建
-		bootstrap.startGoRoutine(func() {
-			bootstrap.onContextConnect(ctx)
-		})
+		bootstrap.acceptConn(conn)
 	}
 
 	//bootstrap.Noticef("Bootstrap Exiting..")
 }
 
+// acceptTlsConn 完成TLS握手，握手失败时关闭连接
+func (bootstrap *Bootstrap) acceptTlsConn(conn net.Conn) {
+	tlsConn, err := bootstrap.tlsContext.ServerConn(conn)
+	if err != nil {
+		bootstrap.Errorf("tls handshake with %s error: %v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+
+	bootstrap.acceptConn(tlsConn)
+}
+
+// acceptConn 管理新接收的连接
+func (bootstrap *Bootstrap) acceptConn(conn net.Conn) {
+	// 以客户端ip,port管理连接
+	remoteAddr := conn.RemoteAddr().String()
+	ctx := newDefaultContext(remoteAddr, conn, bootstrap)
+	bootstrap.contextTableLock.Lock()
+	bootstrap.contextTable[remoteAddr] = ctx
+	bootstrap.contextTableLock.Unlock()
+	//bootstrap.Debugf("Client connection created %s", remoteAddr)
+
+	bootstrap.startGoRoutine(func() {
+		bootstrap.handleConn(ctx)
+	})
+
+	// 通知连接创建
+	bootstrap.startGoRoutine(func() {
+		bootstrap.onContextConnect(ctx)
+	})
+}
+
 // Connect 连接指定地址、端口(服务器地址管理连接)
 func (bootstrap *Bootstrap) Connect(host string, port int) error {
 	addr := net.JoinHostPort(host, strconv.Itoa(port))
@@ -212,7 +238,14 @@ func (bootstrap *Bootstrap) connect(sraddr, sladdr string) (Context, error) {
 		return nil, e
 	}
 
-	ctx := newDefaultContext(sraddr, conn, bootstrap)
+	// 开启TLS时完成握手
+	tlsConn, e := bootstrap.tlsContext.ClientConn(conn, sraddr)
+	if e != nil {
+		conn.Close()
+		return nil, e
+	}
+
+	ctx := newDefaultContext(sraddr, tlsConn, bootstrap)
 	return ctx, nil
 }
 
@@ -402,6 +435,12 @@ func (bootstrap *Bootstrap) SetKeepAlive(keepalive bool) *Bootstrap {
 	return bootstrap
 }
 
+// SetTlsContext 配置TLS，需要在Sync、Connect之前调用，nil表示不使用TLS
+func (bootstrap *Bootstrap) SetTlsContext(tlsContext *TlsContext) *Bootstrap {
+	bootstrap.tlsContext = tlsContext
+	return bootstrap
+}
+
 // 配置连接
 func (bootstrap *Bootstrap) setConnect(conn net.Conn) error {
 	if tcpConn, ok := conn.(*net.TCPConn); ok {
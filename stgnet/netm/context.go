@@ -67,9 +67,33 @@ func (ctx *DefaultContext) WriteSerialObject(s Serializable) (n int, e error) {
 		return
 	}
 
+	if bs, ok := s.(BuffersSerializable); ok {
+		return ctx.writeBuffers(bs.Buffers())
+	}
+
 	return ctx.Write(s.Bytes())
 }
 
+// writeBuffers TCP连接使用writev写入多段数据，写入期间持有连接的写锁，不会与其他报文交错；
+// 其他类型的连接逐段写入无法保证原子性，合并后写入
+func (ctx *DefaultContext) writeBuffers(buffers net.Buffers) (n int, e error) {
+	if _, ok := ctx.conn.(*net.TCPConn); !ok {
+		var data []byte
+		for _, b := range buffers {
+			data = append(data, b...)
+		}
+		return ctx.Write(data)
+	}
+
+	written, e := buffers.WriteTo(ctx.conn)
+	if e != nil {
+		ctx.onError(e)
+	}
+	ctx.lastOptTime = time.Now()
+
+	return int(written), e
+}
+
 // Close 关闭连接
 func (ctx *DefaultContext) Close() error {
 	if ctx.isClosed {
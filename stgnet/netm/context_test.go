@@ -0,0 +1,71 @@
+package netm
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"testing"
+)
+
+type buffersObject struct {
+	buffers net.Buffers
+}
+
+func (b *buffersObject) Bytes() []byte {
+	return bytes.Join(b.buffers, nil)
+}
+
+func (b *buffersObject) Buffers() net.Buffers {
+	return append(net.Buffers{}, b.buffers...)
+}
+
+func TestDefaultContext_WriteBuffers(t *testing.T) {
+	object := &buffersObject{buffers: net.Buffers{[]byte("header"), []byte("message1"), []byte("message2")}}
+	expect := object.Bytes()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	received := make(chan []byte)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- nil
+			return
+		}
+		data, _ := ioutil.ReadAll(conn)
+		conn.Close()
+		received <- data
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// TCP连接通过writev写入
+	ctx := newDefaultContext(conn.RemoteAddr().String(), conn, nil)
+	n, err := ctx.WriteSerialObject(object)
+	if err != nil || n != len(expect) {
+		t.Fatalf("write buffers n: %d err: %v", n, err)
+	}
+	conn.Close()
+
+	if data := <-received; !bytes.Equal(data, expect) {
+		t.Errorf("expect %q, actual %q", expect, data)
+	}
+
+	// 其他连接合并后写入
+	client, server := net.Pipe()
+	go func() {
+		ctx := newDefaultContext("pipe", client, nil)
+		ctx.WriteSerialObject(object)
+		client.Close()
+	}()
+	if data, _ := ioutil.ReadAll(server); !bytes.Equal(data, expect) {
+		t.Errorf("expect %q, actual %q", expect, data)
+	}
+}
@@ -1,5 +1,14 @@
 package netm
 
+import "net"
+
 type Serializable interface {
 	Bytes() []byte
 }
+
+// BuffersSerializable 由多段数据组成的报文，WriteSerialObject通过writev一次写入，不需要拷贝到连续内存
+// Since 2018/1/24
+type BuffersSerializable interface {
+	Serializable
+	Buffers() net.Buffers
+}
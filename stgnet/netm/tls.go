@@ -0,0 +1,253 @@
+package netm
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+)
+
+// TlsMode TLS模式
+type TlsMode int
+
+const (
+	TLS_DISABLED   TlsMode = iota // 不使用TLS
+	TLS_PERMISSIVE                // 服务端同时接受TLS连接和明文连接，客户端使用TLS连接，用于平滑升级
+	TLS_ENFORCING                 // 服务端只接受TLS连接，客户端使用TLS连接
+)
+
+// TLS配置对应的环境变量，namesrv、broker、客户端未单独配置时使用
+const (
+	TLS_MODE_ENV                 = "SMARTGO_TLS_MODE"                 // disabled、permissive、enforcing
+	TLS_CERT_FILE_ENV            = "SMARTGO_TLS_CERT_FILE"            // 本端证书
+	TLS_KEY_FILE_ENV             = "SMARTGO_TLS_KEY_FILE"             // 本端私钥
+	TLS_CA_FILE_ENV              = "SMARTGO_TLS_CA_FILE"              // 校验对端证书的CA
+	TLS_NEED_CLIENT_AUTH_ENV     = "SMARTGO_TLS_NEED_CLIENT_AUTH"     // 服务端是否要求客户端证书
+	TLS_INSECURE_SKIP_VERIFY_ENV = "SMARTGO_TLS_INSECURE_SKIP_VERIFY" // 客户端是否跳过服务端证书校验
+	TLS_SERVER_NAME_ENV          = "SMARTGO_TLS_SERVER_NAME"          // 客户端校验服务端证书使用的名称
+)
+
+const (
+	tlsHandshakeTimeout    = 10 * time.Second
+	tlsRecordTypeHandshake = 0x16 // TLS握手报文的第一个字节，明文报文以长度开头，第一个字节不会是0x16
+)
+
+// TlsConfig TLS配置
+type TlsConfig struct {
+	Mode               string // disabled、permissive、enforcing，默认disabled
+	CertFile           string // 本端证书，服务端必须配置，双向认证时客户端也需要配置
+	KeyFile            string // 本端私钥
+	CaFile             string // 校验对端证书的CA，为空时使用系统CA
+	NeedClientAuth     bool   // 服务端是否要求并校验客户端证书（双向认证）
+	InsecureSkipVerify bool   // 客户端是否跳过服务端证书校验，仅用于测试
+	ServerName         string // 客户端校验服务端证书使用的名称，为空时使用连接地址的host
+}
+
+// NewTlsConfigFromEnv 从环境变量读取TLS配置
+func NewTlsConfigFromEnv() *TlsConfig {
+	needClientAuth, _ := strconv.ParseBool(os.Getenv(TLS_NEED_CLIENT_AUTH_ENV))
+	insecureSkipVerify, _ := strconv.ParseBool(os.Getenv(TLS_INSECURE_SKIP_VERIFY_ENV))
+	return &TlsConfig{
+		Mode:               strings.TrimSpace(os.Getenv(TLS_MODE_ENV)),
+		CertFile:           strings.TrimSpace(os.Getenv(TLS_CERT_FILE_ENV)),
+		KeyFile:            strings.TrimSpace(os.Getenv(TLS_KEY_FILE_ENV)),
+		CaFile:             strings.TrimSpace(os.Getenv(TLS_CA_FILE_ENV)),
+		NeedClientAuth:     needClientAuth,
+		InsecureSkipVerify: insecureSkipVerify,
+		ServerName:         strings.TrimSpace(os.Getenv(TLS_SERVER_NAME_ENV)),
+	}
+}
+
+// ParseTlsMode 解析TLS模式，空字符串为disabled
+func ParseTlsMode(mode string) (TlsMode, error) {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", "disabled":
+		return TLS_DISABLED, nil
+	case "permissive":
+		return TLS_PERMISSIVE, nil
+	case "enforcing":
+		return TLS_ENFORCING, nil
+	}
+	return TLS_DISABLED, errors.Errorf("invalid tls mode: %s", mode)
+}
+
+// String 模式名称
+func (mode TlsMode) String() string {
+	switch mode {
+	case TLS_PERMISSIVE:
+		return "permissive"
+	case TLS_ENFORCING:
+		return "enforcing"
+	}
+	return "disabled"
+}
+
+// TlsContext 根据TlsConfig加载证书后的TLS上下文，为nil时等同于disabled
+type TlsContext struct {
+	mode         TlsMode
+	serverName   string
+	serverConfig *tls.Config // 未配置证书时为nil，不能作为服务端
+	clientConfig *tls.Config
+}
+
+// NewTlsContext 加载证书创建TLS上下文，作为客户端使用时可以不配置证书
+func NewTlsContext(cfg *TlsConfig) (*TlsContext, error) {
+	if cfg == nil {
+		return &TlsContext{mode: TLS_DISABLED}, nil
+	}
+
+	mode, err := ParseTlsMode(cfg.Mode)
+	if err != nil {
+		return nil, err
+	}
+	if mode == TLS_DISABLED {
+		return &TlsContext{mode: TLS_DISABLED}, nil
+	}
+
+	var caPool *x509.CertPool
+	if cfg.CaFile != "" {
+		ca, err := ioutil.ReadFile(cfg.CaFile)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		caPool = x509.NewCertPool()
+		if !caPool.AppendCertsFromPEM(ca) {
+			return nil, errors.Errorf("no valid certificate in ca file: %s", cfg.CaFile)
+		}
+	}
+
+	var certificates []tls.Certificate
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		certificates = append(certificates, certificate)
+	}
+
+	tlsContext := &TlsContext{
+		mode:       mode,
+		serverName: cfg.ServerName,
+		clientConfig: &tls.Config{
+			Certificates:       certificates,
+			RootCAs:            caPool,
+			InsecureSkipVerify: cfg.InsecureSkipVerify,
+		},
+	}
+
+	if len(certificates) > 0 {
+		tlsContext.serverConfig = &tls.Config{Certificates: certificates}
+		if cfg.NeedClientAuth {
+			if caPool == nil {
+				return nil, errors.Errorf("ca file is required when client auth is needed")
+			}
+			tlsContext.serverConfig.ClientAuth = tls.RequireAndVerifyClientCert
+			tlsContext.serverConfig.ClientCAs = caPool
+		}
+	}
+
+	return tlsContext, nil
+}
+
+// NewServerTlsContext 创建服务端使用的TLS上下文，开启TLS时必须配置证书
+func NewServerTlsContext(cfg *TlsConfig) (*TlsContext, error) {
+	tlsContext, err := NewTlsContext(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if tlsContext.Enabled() && tlsContext.serverConfig == nil {
+		return nil, errors.Errorf("certFile and keyFile are required in tls mode %s", tlsContext.mode)
+	}
+	return tlsContext, nil
+}
+
+// Enabled 是否开启TLS
+func (tlsContext *TlsContext) Enabled() bool {
+	return tlsContext != nil && tlsContext.mode != TLS_DISABLED
+}
+
+// Mode TLS模式
+func (tlsContext *TlsContext) Mode() TlsMode {
+	if tlsContext == nil {
+		return TLS_DISABLED
+	}
+	return tlsContext.mode
+}
+
+// ServerConn 服务端接收连接后完成TLS握手，permissive模式下根据第一个字节判断对端是否使用TLS
+func (tlsContext *TlsContext) ServerConn(conn net.Conn) (net.Conn, error) {
+	if !tlsContext.Enabled() {
+		return conn, nil
+	}
+	if tlsContext.serverConfig == nil {
+		return nil, errors.Errorf("tls server certificate not configured")
+	}
+
+	if tlsContext.mode == TLS_PERMISSIVE {
+		conn.SetReadDeadline(time.Now().Add(tlsHandshakeTimeout))
+		reader := bufio.NewReader(conn)
+		first, err := reader.Peek(1)
+		conn.SetReadDeadline(time.Time{})
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+
+		conn = &peekConn{Conn: conn, reader: reader}
+		if first[0] != tlsRecordTypeHandshake {
+			return conn, nil
+		}
+	}
+
+	tlsConn := tls.Server(conn, tlsContext.serverConfig)
+	if err := handshake(tlsConn); err != nil {
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// ClientConn 客户端建立连接后完成TLS握手
+func (tlsContext *TlsContext) ClientConn(conn net.Conn, addr string) (net.Conn, error) {
+	if !tlsContext.Enabled() {
+		return conn, nil
+	}
+
+	config := tlsContext.clientConfig.Clone()
+	config.ServerName = tlsContext.serverName
+	if config.ServerName == "" {
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			config.ServerName = host
+		}
+	}
+
+	tlsConn := tls.Client(conn, config)
+	if err := handshake(tlsConn); err != nil {
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+func handshake(tlsConn *tls.Conn) error {
+	tlsConn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	tlsConn.SetDeadline(time.Time{})
+	return nil
+}
+
+// peekConn 读取过首字节的连接，已读取的数据从reader中继续读取
+type peekConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (conn *peekConn) Read(b []byte) (int, error) {
+	return conn.reader.Read(b)
+}
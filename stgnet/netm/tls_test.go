@@ -0,0 +1,152 @@
+package netm
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert 生成自签名证书，证书同时作为CA使用
+func writeTestCert(t *testing.T, dir string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "smartgo"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return certFile, keyFile
+}
+
+// echoOnce 服务端接收一个连接并回写读到的数据
+func echoOnce(t *testing.T, server *TlsContext) (string, chan error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			result <- err
+			return
+		}
+		defer conn.Close()
+
+		conn, err = server.ServerConn(conn)
+		if err != nil {
+			result <- err
+			return
+		}
+		buf := make([]byte, 4)
+		if _, err = conn.Read(buf); err == nil {
+			_, err = conn.Write(buf)
+		}
+		result <- err
+	}()
+	return listener.Addr().String(), result
+}
+
+func dialAndEcho(client *TlsContext, addr string) error {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+
+	if conn, err = client.ClientConn(conn, addr); err != nil {
+		return err
+	}
+	if _, err = conn.Write([]byte("ping")); err != nil {
+		return err
+	}
+	_, err = conn.Read(make([]byte, 4))
+	return err
+}
+
+func TestTlsContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeTestCert(t, dir)
+
+	newContext := func(mode string, needClientAuth bool) *TlsContext {
+		tlsContext, err := NewServerTlsContext(&TlsConfig{Mode: mode, CertFile: certFile, KeyFile: keyFile, CaFile: certFile, NeedClientAuth: needClientAuth})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tlsContext
+	}
+	plain := newContext("disabled", false)
+	permissive := newContext("permissive", false)
+	enforcing := newContext("enforcing", true)
+
+	cases := []struct {
+		name   string
+		server *TlsContext
+		client *TlsContext
+		ok     bool
+	}{
+		{"permissive server, plain client", permissive, plain, true},
+		{"permissive server, tls client", permissive, permissive, true},
+		{"enforcing server, mutual auth", enforcing, enforcing, true},
+		{"enforcing server, plain client", enforcing, plain, false},
+	}
+
+	for _, c := range cases {
+		addr, result := echoOnce(t, c.server)
+		clientErr := dialAndEcho(c.client, addr)
+		serverErr := <-result
+		if (clientErr == nil && serverErr == nil) != c.ok {
+			t.Errorf("%s: expect ok %t, client err: %v, server err: %v", c.name, c.ok, clientErr, serverErr)
+		}
+	}
+
+	// 开启TLS的服务端必须配置证书，需要客户端认证时必须配置CA
+	if _, err := NewServerTlsContext(&TlsConfig{Mode: "enforcing"}); err == nil {
+		t.Error("server tls context without certificate should fail")
+	}
+	if _, err := NewTlsContext(&TlsConfig{Mode: "enforcing", CertFile: certFile, KeyFile: keyFile, NeedClientAuth: true}); err == nil {
+		t.Error("client auth without ca file should fail")
+	}
+	if _, err := ParseTlsMode("strict"); err == nil {
+		t.Error("invalid tls mode should fail")
+	}
+}
@@ -15,6 +15,13 @@ type CommandCustomHeader interface {
 	CheckFields() error
 }
 
+// ACL签名使用的扩展字段，由rpc hook写入extFields，不属于任何CustomHeader
+const (
+	ACL_ACCESS_KEY = "AccessKey"
+	ACL_SIGNATURE  = "Signature"
+	ACL_TIMESTAMP  = "Timestamp"
+)
+
 // DecodeCommandCustomHeader 将extFields转为struct
 // Author: jerrylou, <gunsluo@gmail.com>
 // Since: 2017-08-24
@@ -22,6 +29,9 @@ func decodeCommandCustomHeader(extFields map[string]string, commandCustomHeader
 	structValue := reflect.ValueOf(commandCustomHeader).Elem()
 
 	for k, v := range extFields {
+		if k == ACL_ACCESS_KEY || k == ACL_SIGNATURE || k == ACL_TIMESTAMP {
+			continue
+		}
 		err := reflectSturctSetField(structValue, firstLetterToUpper(k), v)
 		if err != nil {
 			return err
@@ -132,6 +132,12 @@ func (rc *RemotingCommand) IsResponseType() bool {
 
 // EncodeHeader 编码头部
 func (rc *RemotingCommand) EncodeHeader() []byte {
+	return rc.EncodeHeaderWithBodyLength(len(rc.Body))
+}
+
+// EncodeHeaderWithBodyLength 编码报文长度及头部，body不在RemotingCommand中时(如直接发送mmap数据)由调用方指定body长度
+// Since 2018/1/24
+func (rc *RemotingCommand) EncodeHeaderWithBodyLength(bodyLength int) []byte {
 	var (
 		length       int32 = 4
 		headerLength int32
@@ -140,10 +146,7 @@ func (rc *RemotingCommand) EncodeHeader() []byte {
 	headerData := rc.buildHeader()
 	headerLength = int32(len(headerData))
 	length += headerLength
-
-	if rc.Body != nil {
-		length += int32(len(rc.Body))
-	}
+	length += int32(bodyLength)
 
 	buf := bytes.NewBuffer([]byte{})
 	// 写入报文长度
@@ -168,6 +171,12 @@ func (rc *RemotingCommand) buildHeader() []byte {
 	return buf
 }
 
+// MakeCustomHeaderToNet 将CustomHeader写入ExtFields，签名等需要完整ExtFields的场景在发送前调用
+// Since 2018/1/26
+func (rc *RemotingCommand) MakeCustomHeaderToNet() {
+	rc.makeCustomHeaderToNet()
+}
+
 func (rc *RemotingCommand) makeCustomHeaderToNet() {
 	if rc.CustomHeader == nil {
 		return
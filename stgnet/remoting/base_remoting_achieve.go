@@ -3,10 +3,12 @@ package remoting
 import (
 	"bytes"
 	"fmt"
+	"strconv"
 	"sync"
 	"time"
 
 	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/metrics"
 	"git.oschina.net/cloudzone/smartgo/stgnet/netm"
 	"git.oschina.net/cloudzone/smartgo/stgnet/protocol"
 	"github.com/go-errors/errors"
@@ -14,6 +16,8 @@ import (
 
 const (
 	FRAME_MAX_LENGTH = 8388608
+
+	REQUEST_DURATION_METRIC = "smartgo_remoting_request_duration_seconds"
 )
 
 type BaseRemotingAchieve struct {
@@ -21,28 +25,45 @@ type BaseRemotingAchieve struct {
 	responseTableLock       sync.RWMutex
 	rpcHook                 RPCHook
 	defaultRequestProcessor RequestProcessor
+	defaultRequestExecutor  *RequestExecutor
 	processorTable          map[int32]RequestProcessor // 注册的处理器
+	executorTable           map[int32]*RequestExecutor // 处理器对应的协程池，未注册时在接收报文的协程中处理
 	processorTableLock      sync.RWMutex
 	timeoutTimer            *time.Timer
 	fragmentationActuator   PacketFragmentationAssembler
 	isRunning               bool
+
+	requestLatency *metrics.HistogramVec // 按请求码统计的处理耗时
 }
 
-// RegisterProcessor register porcessor
-func (ra *BaseRemotingAchieve) RegisterProcessor(requestCode int32, processor RequestProcessor) {
+// RegisterProcessor register porcessor，可指定处理请求的协程池，协程池繁忙时返回SYSTEM_BUSY
+func (ra *BaseRemotingAchieve) RegisterProcessor(requestCode int32, processor RequestProcessor, executor ...*RequestExecutor) {
+	// 注册业务处理器
+	ra.processorTableLock.Lock()
 	if ra.processorTable == nil {
 		ra.processorTable = make(map[int32]RequestProcessor)
 	}
-
-	// 注册业务处理器
-	ra.processorTableLock.Lock()
+	if ra.executorTable == nil {
+		ra.executorTable = make(map[int32]*RequestExecutor)
+	}
 	ra.processorTable[requestCode] = processor
+	if len(executor) > 0 && executor[0] != nil {
+		ra.executorTable[requestCode] = executor[0]
+	} else {
+		delete(ra.executorTable, requestCode)
+	}
 	ra.processorTableLock.Unlock()
 }
 
-// RegisterDefaultProcessor register default porcessor
-func (ra *BaseRemotingAchieve) RegisterDefaultProcessor(processor RequestProcessor) {
+// RegisterDefaultProcessor register default porcessor，可指定处理请求的协程池
+func (ra *BaseRemotingAchieve) RegisterDefaultProcessor(processor RequestProcessor, executor ...*RequestExecutor) {
+	ra.processorTableLock.Lock()
 	ra.defaultRequestProcessor = processor
+	ra.defaultRequestExecutor = nil
+	if len(executor) > 0 {
+		ra.defaultRequestExecutor = executor[0]
+	}
+	ra.processorTableLock.Unlock()
 }
 
 // RegisterRPCHook 注册rpc hook
@@ -113,12 +134,14 @@ func (ra *BaseRemotingAchieve) processMessageReceived(ctx netm.Context, buf *byt
 
 func (ra *BaseRemotingAchieve) processRequestCommand(ctx netm.Context, remotingCommand *protocol.RemotingCommand) {
 	// 获取业务处理器，没有注册使用默认处理器
-	ra.processorTableLock.Lock()
+	ra.processorTableLock.RLock()
 	processor, ok := ra.processorTable[remotingCommand.Code]
-	ra.processorTableLock.Unlock()
+	executor := ra.executorTable[remotingCommand.Code]
 	if !ok {
 		processor = ra.defaultRequestProcessor
+		executor = ra.defaultRequestExecutor
 	}
+	ra.processorTableLock.RUnlock()
 
 	// 没有处理器，错误处理。
 	if processor == nil {
@@ -130,13 +153,72 @@ func (ra *BaseRemotingAchieve) processRequestCommand(ctx netm.Context, remotingC
 		return
 	}
 
-	// rpc hook before
+	if executor == nil {
+		ra.invokeProcessor(ctx, remotingCommand, processor)
+		return
+	}
+
+	// 提交到协程池处理，队列已满或排队超时时进行流控
+	task := &requestTask{
+		run: func() {
+			ra.invokeProcessor(ctx, remotingCommand, processor)
+		},
+		reject: func(waitTimeMillis int64) {
+			remark := fmt.Sprintf("[PCBUSY_CLEAN_QUEUE]broker busy, start flow control for a while, period in queue: %dms, size of queue: %d",
+				waitTimeMillis, executor.QueueSize())
+			ra.rejectRequest(ctx, remotingCommand, remark)
+		},
+		createTime: time.Now(),
+	}
+	if !executor.submit(task) {
+		remark := fmt.Sprintf("[TOO_MANY_REQUESTS]system busy, start flow control for a while, executor: %s size of queue: %d",
+			executor.Name(), executor.QueueSize())
+		ra.rejectRequest(ctx, remotingCommand, remark)
+	}
+}
+
+// rejectRequest 协程池繁忙时返回SYSTEM_BUSY，客户端收到后可以更换broker重试
+func (ra *BaseRemotingAchieve) rejectRequest(ctx netm.Context, remotingCommand *protocol.RemotingCommand, remark string) {
+	logger.Warnf("reject request addr[%s] code[%d]: %s", ctx.Addr(), remotingCommand.Code, remark)
+
+	// send oneway 不需要响应
+	if remotingCommand.IsOnewayRPC() {
+		return
+	}
+
+	response := protocol.CreateResponseCommand(protocol.SYSTEM_BUSY, remark)
+	response.Opaque = remotingCommand.Opaque
+	ra.sendResponse(response, ctx)
+}
+
+// rejectByRPCHook rpc hook校验失败时返回NO_PERMISSION
+func (ra *BaseRemotingAchieve) rejectByRPCHook(ctx netm.Context, remotingCommand *protocol.RemotingCommand, err error) {
+	logger.Warnf("rpc hook reject request addr[%s] code[%d]: %s", ctx.Addr(), remotingCommand.Code, err.Error())
+
+	// send oneway 不需要响应
+	if remotingCommand.IsOnewayRPC() {
+		return
+	}
+
+	response := protocol.CreateResponseCommand(protocol.NO_PERMISSION, err.Error())
+	response.Opaque = remotingCommand.Opaque
+	ra.sendResponse(response, ctx)
+}
+
+// invokeProcessor 调用处理器并返回响应
+func (ra *BaseRemotingAchieve) invokeProcessor(ctx netm.Context, remotingCommand *protocol.RemotingCommand, processor RequestProcessor) {
+	// rpc hook before, hook校验失败时拒绝请求
 	if ra.rpcHook != nil {
-		ra.rpcHook.DoBeforeRequest(ctx, remotingCommand)
+		if err := ra.rpcHook.DoBeforeRequest(ctx, remotingCommand); err != nil {
+			ra.rejectByRPCHook(ctx, remotingCommand, err)
+			return
+		}
 	}
 
 	// 调用处理器
+	begin := time.Now()
 	response, err := processor.ProcessRequest(ctx, remotingCommand)
+	ra.observeRequestLatency(remotingCommand.Code, time.Since(begin))
 
 	// rpc hook after
 	if ra.rpcHook != nil {
@@ -168,6 +250,27 @@ func (ra *BaseRemotingAchieve) processRequestCommand(ctx netm.Context, remotingC
 	ra.sendResponse(response, ctx)
 }
 
+// observeRequestLatency 记录请求处理耗时
+func (ra *BaseRemotingAchieve) observeRequestLatency(requestCode int32, cost time.Duration) {
+	if ra.requestLatency == nil {
+		return
+	}
+	ra.requestLatency.WithLabel(strconv.Itoa(int(requestCode))).Record(int64(cost / time.Microsecond))
+}
+
+// Collect 输出按请求码统计的请求处理耗时直方图，实现metrics.Collector
+// Since 2018/1/30
+func (ra *BaseRemotingAchieve) Collect(w *metrics.Writer) {
+	if ra.requestLatency == nil {
+		return
+	}
+
+	ra.requestLatency.Foreach(func(requestCode string, histogram *metrics.LatencyHistogram) {
+		w.Histogram(REQUEST_DURATION_METRIC, "Remoting request processing latency in seconds by request code.",
+			histogram.Snapshot(false), metrics.NewLabel("request_code", requestCode))
+	})
+}
+
 func (ra *BaseRemotingAchieve) processResponseCommand(ctx netm.Context, response *protocol.RemotingCommand) {
 	// 获取响应
 	ra.responseTableLock.RLock()
@@ -261,6 +364,10 @@ func (ra *BaseRemotingAchieve) invokeAsync(ctx netm.Context, request *protocol.R
 	// 发送请求
 	err := ra.sendRequest(request, ctx)
 	if err != nil {
+		// 发送失败由调用方处理，不再等待超时回调
+		ra.responseTableLock.Lock()
+		delete(ra.responseTable, request.Opaque)
+		ra.responseTableLock.Unlock()
 		logger.Fatalf("invokeASync->sendRequest failed: %s %v", ctx.Addr(), err)
 		return err
 	}
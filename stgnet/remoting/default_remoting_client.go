@@ -27,6 +27,17 @@ func NewDefalutRemotingClient() *DefalutRemotingClient {
 	return remotingClient
 }
 
+// SetTlsConfig 配置TLS，需要在建立连接之前调用
+func (rc *DefalutRemotingClient) SetTlsConfig(cfg *netm.TlsConfig) error {
+	tlsContext, err := netm.NewTlsContext(cfg)
+	if err != nil {
+		return err
+	}
+
+	rc.bootstrap.SetTlsContext(tlsContext)
+	return nil
+}
+
 // Start start client
 func (rc *DefalutRemotingClient) Start() {
 	rc.bootstrap.RegisterHandler(func(buffer []byte, ctx netm.Context) {
@@ -90,7 +101,9 @@ func (rc *DefalutRemotingClient) InvokeSync(addr string, request *protocol.Remot
 
 	// rpc hook before
 	if rc.rpcHook != nil {
-		rc.rpcHook.DoBeforeRequest(ctx, request)
+		if err := rc.rpcHook.DoBeforeRequest(ctx, request); err != nil {
+			return nil, err
+		}
 	}
 
 	response, err := rc.invokeSync(ctx, request, timeoutMillis)
@@ -113,7 +126,9 @@ func (rc *DefalutRemotingClient) InvokeAsync(addr string, request *protocol.Remo
 
 	// rpc hook before
 	if rc.rpcHook != nil {
-		rc.rpcHook.DoBeforeRequest(ctx, request)
+		if err := rc.rpcHook.DoBeforeRequest(ctx, request); err != nil {
+			return err
+		}
 	}
 
 	return rc.invokeAsync(ctx, request, timeoutMillis, invokeCallback)
@@ -129,7 +144,9 @@ func (rc *DefalutRemotingClient) InvokeOneway(addr string, request *protocol.Rem
 
 	// rpc hook before
 	if rc.rpcHook != nil {
-		rc.rpcHook.DoBeforeRequest(ctx, request)
+		if err := rc.rpcHook.DoBeforeRequest(ctx, request); err != nil {
+			return err
+		}
 	}
 
 	return rc.invokeOneway(ctx, request, timeoutMillis)
@@ -3,6 +3,7 @@ package remoting
 import (
 	"strconv"
 
+	"git.oschina.net/cloudzone/smartgo/stgcommon/metrics"
 	"git.oschina.net/cloudzone/smartgo/stgnet/netm"
 	"git.oschina.net/cloudzone/smartgo/stgnet/protocol"
 )
@@ -23,10 +24,22 @@ func NewDefalutRemotingServer(host string, port int) *DefalutRemotingServer {
 	}
 	remotingServe.responseTable = make(map[int32]*ResponseFuture)
 	remotingServe.fragmentationActuator = NewLengthFieldFragmentationAssemblage(FRAME_MAX_LENGTH, 0, 4, 0)
+	remotingServe.requestLatency = metrics.NewHistogramVec()
 	remotingServe.bootstrap = netm.NewBootstrap()
 	return remotingServe
 }
 
+// SetTlsConfig 配置TLS，开启TLS时必须配置证书，需要在Start之前调用
+func (rs *DefalutRemotingServer) SetTlsConfig(cfg *netm.TlsConfig) error {
+	tlsContext, err := netm.NewServerTlsContext(cfg)
+	if err != nil {
+		return err
+	}
+
+	rs.bootstrap.SetTlsContext(tlsContext)
+	return nil
+}
+
 // Start start server
 func (rs *DefalutRemotingServer) Start() {
 	rs.bootstrap.RegisterHandler(func(buffer []byte, ctx netm.Context) {
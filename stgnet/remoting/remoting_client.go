@@ -10,7 +10,7 @@ type RemotingClient interface {
 	InvokeSync(addr string, request *protocol.RemotingCommand, timeoutMillis int64) (*protocol.RemotingCommand, error)
 	InvokeAsync(addr string, request *protocol.RemotingCommand, timeoutMillis int64, invokeCallback InvokeCallback) error
 	InvokeOneway(addr string, request *protocol.RemotingCommand, timeoutMillis int64) error
-	RegisterProcessor(requestCode int32, processor RequestProcessor)
+	RegisterProcessor(requestCode int32, processor RequestProcessor, executor ...*RequestExecutor)
 	RegisterRPCHook(rpcHook RPCHook)
 	GetNameServerAddressList() []string
 	UpdateNameServerAddressList(addrs []string)
@@ -10,8 +10,8 @@ type RemotingServer interface {
 	InvokeSync(ctx netm.Context, request *protocol.RemotingCommand, timeoutMillis int64) (*protocol.RemotingCommand, error)
 	InvokeAsync(ctx netm.Context, request *protocol.RemotingCommand, timeoutMillis int64, invokeCallback InvokeCallback) error
 	InvokeOneway(ctx netm.Context, request *protocol.RemotingCommand, timeoutMillis int64) error
-	RegisterProcessor(requestCode int32, processor RequestProcessor)
-	RegisterDefaultProcessor(processor RequestProcessor)
+	RegisterProcessor(requestCode int32, processor RequestProcessor, executor ...*RequestExecutor)
+	RegisterDefaultProcessor(processor RequestProcessor, executor ...*RequestExecutor)
 	RegisterRPCHook(rpcHook RPCHook)
 	RegisterContextListener(contextListener netm.ContextListener)
 	Start()
@@ -0,0 +1,218 @@
+package remoting
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
+)
+
+// RequestExecutor 请求处理协程池，固定数量的协程从有界队列中取出请求执行
+// 队列已满或请求在队列中等待超过waitTimeMillis时拒绝请求，由调用方返回SYSTEM_BUSY
+type RequestExecutor struct {
+	name           string
+	workerNums     int
+	queueCapacity  int
+	waitTimeMillis int64 // 请求在队列中的最长等待时间，0表示不检查
+	queue          *list.List
+	lock           sync.Mutex
+	cond           *sync.Cond
+	stopped        bool
+	wg             sync.WaitGroup
+	startOnce      sync.Once
+}
+
+// requestTask 排队中的请求
+type requestTask struct {
+	run        func()
+	reject     func(waitTimeMillis int64) // 排队超时或被清理时的处理
+	createTime time.Time
+}
+
+func (task *requestTask) waitTimeMillis() int64 {
+	return int64(time.Since(task.createTime) / time.Millisecond)
+}
+
+// NewRequestExecutor 创建请求处理协程池
+func NewRequestExecutor(name string, workerNums, queueCapacity int, waitTimeMillis int64) *RequestExecutor {
+	if workerNums <= 0 {
+		workerNums = 1
+	}
+	if queueCapacity <= 0 {
+		queueCapacity = 1
+	}
+
+	executor := &RequestExecutor{
+		name:           name,
+		workerNums:     workerNums,
+		queueCapacity:  queueCapacity,
+		waitTimeMillis: waitTimeMillis,
+		queue:          list.New(),
+	}
+	executor.cond = sync.NewCond(&executor.lock)
+	return executor
+}
+
+// Start 启动处理协程
+func (executor *RequestExecutor) Start() {
+	executor.startOnce.Do(func() {
+		for i := 0; i < executor.workerNums; i++ {
+			executor.wg.Add(1)
+			go executor.work()
+		}
+		logger.Infof("request executor %s start, workerNums: %d queueCapacity: %d waitTimeMillis: %d",
+			executor.name, executor.workerNums, executor.queueCapacity, executor.waitTimeMillis)
+	})
+}
+
+// Shutdown 停止处理协程，队列中未执行的请求被丢弃
+func (executor *RequestExecutor) Shutdown() {
+	executor.lock.Lock()
+	if executor.stopped {
+		executor.lock.Unlock()
+		return
+	}
+	executor.stopped = true
+	discards := executor.queue.Len()
+	executor.queue.Init()
+	executor.cond.Broadcast()
+	executor.lock.Unlock()
+
+	executor.wg.Wait()
+	logger.Infof("request executor %s shutdown, discard requests: %d", executor.name, discards)
+}
+
+// Execute 提交任务，队列已满时返回false
+func (executor *RequestExecutor) Execute(run func()) bool {
+	return executor.submit(&requestTask{run: run, createTime: time.Now()})
+}
+
+// Name 协程池名称
+func (executor *RequestExecutor) Name() string {
+	return executor.name
+}
+
+// QueueSize 排队中的请求数
+func (executor *RequestExecutor) QueueSize() int {
+	executor.lock.Lock()
+	defer executor.lock.Unlock()
+	return executor.queue.Len()
+}
+
+// QueueCapacity 队列容量
+func (executor *RequestExecutor) QueueCapacity() int {
+	return executor.queueCapacity
+}
+
+// CleanExpiredRequest 从队列头部清理等待超过maxWaitTimeMillis的请求，返回清理的请求数
+// 没有拒绝回调的任务(如长轮询唤醒)无法应答客户端，保留在队列中继续执行
+func (executor *RequestExecutor) CleanExpiredRequest(maxWaitTimeMillis int64) int {
+	var expired []*requestTask
+
+	executor.lock.Lock()
+	for element := executor.queue.Front(); element != nil; {
+		task := element.Value.(*requestTask)
+		if task.waitTimeMillis() <= maxWaitTimeMillis {
+			break
+		}
+		next := element.Next()
+		if task.reject != nil {
+			executor.queue.Remove(element)
+			expired = append(expired, task)
+		}
+		element = next
+	}
+	executor.lock.Unlock()
+
+	for _, task := range expired {
+		executor.rejectTask(task)
+	}
+	return len(expired)
+}
+
+// RejectOldestRequest 拒绝队列中等待时间最长且可拒绝的请求，没有可拒绝的请求时返回false
+func (executor *RequestExecutor) RejectOldestRequest() bool {
+	executor.lock.Lock()
+	element := executor.queue.Front()
+	for element != nil && element.Value.(*requestTask).reject == nil {
+		element = element.Next()
+	}
+	if element != nil {
+		executor.queue.Remove(element)
+	}
+	executor.lock.Unlock()
+
+	if element == nil {
+		return false
+	}
+
+	executor.rejectTask(element.Value.(*requestTask))
+	return true
+}
+
+func (executor *RequestExecutor) submit(task *requestTask) bool {
+	executor.lock.Lock()
+	defer executor.lock.Unlock()
+
+	if executor.stopped || executor.queue.Len() >= executor.queueCapacity {
+		return false
+	}
+
+	executor.queue.PushBack(task)
+	executor.cond.Signal()
+	return true
+}
+
+func (executor *RequestExecutor) take() *requestTask {
+	executor.lock.Lock()
+	defer executor.lock.Unlock()
+
+	for executor.queue.Len() == 0 && !executor.stopped {
+		executor.cond.Wait()
+	}
+	if executor.stopped {
+		return nil
+	}
+
+	return executor.queue.Remove(executor.queue.Front()).(*requestTask)
+}
+
+func (executor *RequestExecutor) work() {
+	defer executor.wg.Done()
+
+	for {
+		task := executor.take()
+		if task == nil {
+			return
+		}
+		executor.runTask(task)
+	}
+}
+
+func (executor *RequestExecutor) runTask(task *requestTask) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Errorf("request executor %s run task panic: %v", executor.name, err)
+		}
+	}()
+
+	if executor.waitTimeMillis > 0 && task.waitTimeMillis() > executor.waitTimeMillis && task.reject != nil {
+		task.reject(task.waitTimeMillis())
+		return
+	}
+
+	task.run()
+}
+
+func (executor *RequestExecutor) rejectTask(task *requestTask) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Errorf("request executor %s reject task panic: %v", executor.name, err)
+		}
+	}()
+
+	if task.reject != nil {
+		task.reject(task.waitTimeMillis())
+	}
+}
@@ -0,0 +1,122 @@
+package remoting
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRequestExecutor_RejectWhenQueueFull(t *testing.T) {
+	executor := NewRequestExecutor("test", 1, 1, 0)
+	executor.Start()
+	defer executor.Shutdown()
+
+	block := make(chan struct{})
+	started := make(chan struct{})
+	if !executor.Execute(func() { close(started); <-block }) {
+		t.Fatal("first task should be accepted")
+	}
+	<-started
+
+	if !executor.Execute(func() {}) {
+		t.Fatal("second task should be queued")
+	}
+	if executor.Execute(func() {}) {
+		t.Error("task should be rejected when queue is full")
+	}
+	close(block)
+}
+
+func TestRequestExecutor_RejectWhenWaitTooLong(t *testing.T) {
+	executor := NewRequestExecutor("test", 1, 10, 50)
+	executor.Start()
+	defer executor.Shutdown()
+
+	block := make(chan struct{})
+	executor.Execute(func() { <-block })
+
+	var ran, rejected int32
+	done := make(chan struct{})
+	executor.submit(&requestTask{
+		run:        func() { atomic.StoreInt32(&ran, 1); close(done) },
+		reject:     func(waitTimeMillis int64) { atomic.StoreInt32(&rejected, 1); close(done) },
+		createTime: time.Now(),
+	})
+
+	time.Sleep(100 * time.Millisecond)
+	close(block)
+	<-done
+
+	if atomic.LoadInt32(&ran) != 0 || atomic.LoadInt32(&rejected) != 1 {
+		t.Errorf("task waited too long should be rejected, ran: %d rejected: %d", ran, rejected)
+	}
+}
+
+func TestRequestExecutor_CleanExpiredRequest(t *testing.T) {
+	executor := NewRequestExecutor("test", 1, 10, 0)
+	executor.Start()
+	defer executor.Shutdown()
+
+	block := make(chan struct{})
+	started := make(chan struct{})
+	executor.Execute(func() { close(started); <-block })
+	<-started
+
+	var rejected int32
+	for i := 0; i < 3; i++ {
+		executor.submit(&requestTask{
+			run:        func() {},
+			reject:     func(waitTimeMillis int64) { atomic.AddInt32(&rejected, 1) },
+			createTime: time.Now().Add(-time.Second),
+		})
+	}
+	executor.Execute(func() {})
+
+	if cleaned := executor.CleanExpiredRequest(500); cleaned != 3 || atomic.LoadInt32(&rejected) != 3 {
+		t.Errorf("expect 3 expired requests cleaned, actual %d rejected %d", cleaned, rejected)
+	}
+	if executor.RejectOldestRequest() || executor.QueueSize() != 1 {
+		t.Error("request without reject callback should stay queued")
+	}
+	close(block)
+}
+
+func TestRequestExecutor_CleanExpiredRequestKeepTaskWithoutReject(t *testing.T) {
+	executor := NewRequestExecutor("test", 1, 10, 0)
+	executor.Start()
+	defer executor.Shutdown()
+
+	block := make(chan struct{})
+	started := make(chan struct{})
+	executor.Execute(func() { close(started); <-block })
+	<-started
+
+	var ran, rejected int32
+	done := make(chan struct{})
+	executor.submit(&requestTask{
+		run:        func() { atomic.StoreInt32(&ran, 1); close(done) },
+		createTime: time.Now().Add(-time.Second),
+	})
+	executor.submit(&requestTask{
+		run:        func() {},
+		reject:     func(waitTimeMillis int64) { atomic.AddInt32(&rejected, 1) },
+		createTime: time.Now().Add(-time.Second),
+	})
+
+	if cleaned := executor.CleanExpiredRequest(500); cleaned != 1 || atomic.LoadInt32(&rejected) != 1 {
+		t.Errorf("expect 1 expired request cleaned, actual %d rejected %d", cleaned, rejected)
+	}
+	if executor.QueueSize() != 1 {
+		t.Errorf("task without reject callback should stay queued, queue size %d", executor.QueueSize())
+	}
+
+	close(block)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("task without reject callback should still run")
+	}
+	if atomic.LoadInt32(&ran) != 1 {
+		t.Error("task without reject callback should run")
+	}
+}
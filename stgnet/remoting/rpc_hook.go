@@ -6,7 +6,8 @@ import (
 )
 
 // RPCHook rpc hook, use send msg
+// DoBeforeRequest返回error时：客户端不发送请求直接返回该错误，服务端拒绝请求并响应NO_PERMISSION
 type RPCHook interface {
-	DoBeforeRequest(ctx netm.Context, request *protocol.RemotingCommand)
+	DoBeforeRequest(ctx netm.Context, request *protocol.RemotingCommand) error
 	DoAfterResponse(ctx netm.Context, request *protocol.RemotingCommand, response *protocol.RemotingCommand)
 }
@@ -2,6 +2,7 @@ package registry
 
 import (
 	"git.oschina.net/cloudzone/smartgo/stgcommon"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/metrics"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/namesrv"
 	"git.oschina.net/cloudzone/smartgo/stgnet/netm"
 	"git.oschina.net/cloudzone/smartgo/stgnet/remoting"
@@ -22,6 +23,7 @@ type DefaultNamesrvController struct {
 	BrokerHousekeepingService netm.ContextListener            // 扫描不活跃broker
 	ScheduledExecutorService  *NamesrvControllerTask          // Namesrv定时器服务
 	RequestProcessor          remoting.RequestProcessor       // 默认请求处理器
+	MetricsServer             *metrics.Server                 // Prometheus /metrics接口，未配置NAMESRV_METRICS_PORT时为nil
 }
 
 // NewNamesrvController 初始化默认的NamesrvController
@@ -79,6 +81,9 @@ func (self *DefaultNamesrvController) shutdown() {
 		self.RemotingServer.Shutdown()
 		logger.Info("shutdown remotingServer successful")
 	}
+	if self.MetricsServer != nil {
+		self.MetricsServer.Shutdown()
+	}
 
 	consumingTimeTotal := stgcommon.GetCurrentTimeMillis() - begineTime
 	logger.Info("namesrv controller shutdown successful, consuming time total(ms): %d", consumingTimeTotal)
@@ -88,6 +93,11 @@ func (self *DefaultNamesrvController) shutdown() {
 // Author: tianyuliang
 // Since: 2017/9/14
 func (self *DefaultNamesrvController) startNamesrvController() error {
+	if self.MetricsServer != nil {
+		if err := self.MetricsServer.Start(); err != nil {
+			logger.Error("metrics server start failed, listen: %s, err: %s", self.MetricsServer.Addr(), err.Error())
+		}
+	}
 	self.RemotingServer.Start()
 	return nil
 }
@@ -0,0 +1,39 @@
+package registry
+
+import (
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/metrics"
+)
+
+// NamesrvMetricsCollector 抓取/metrics时输出namesrv路由信息指标
+// Since: 2018/1/30
+type NamesrvMetricsCollector struct {
+	controller *DefaultNamesrvController
+}
+
+// NewNamesrvMetricsCollector 创建NamesrvMetricsCollector
+// Since: 2018/1/30
+func NewNamesrvMetricsCollector(controller *DefaultNamesrvController) *NamesrvMetricsCollector {
+	return &NamesrvMetricsCollector{controller: controller}
+}
+
+// Collect 实现metrics.Collector
+// Since: 2018/1/30
+func (self *NamesrvMetricsCollector) Collect(w *metrics.Writer) {
+	routeInfoManager := self.controller.RouteInfoManager
+	routeInfoManager.ReadWriteLock.RLock()
+	defer routeInfoManager.ReadWriteLock.RUnlock()
+
+	w.Gauge("smartgo_namesrv_clusters", "Clusters registered in the name server.", float64(len(routeInfoManager.ClusterAddrTable)))
+	w.Gauge("smartgo_namesrv_topics", "Topics registered in the name server.", float64(len(routeInfoManager.TopicQueueTable)))
+	w.Gauge("smartgo_namesrv_live_brokers", "Brokers with a live heartbeat.", float64(len(routeInfoManager.BrokerLiveTable)))
+
+	now := stgcommon.GetCurrentTimeMillis()
+	for brokerAddr, brokerLiveInfo := range routeInfoManager.BrokerLiveTable {
+		if brokerLiveInfo == nil {
+			continue
+		}
+		w.Gauge("smartgo_namesrv_broker_heartbeat_age_seconds", "Seconds since the last broker heartbeat.",
+			float64(now-brokerLiveInfo.LastUpdateTimestamp)/1000, metrics.NewLabel("broker_addr", brokerAddr))
+	}
+}
@@ -3,8 +3,10 @@ package registry
 import (
 	"fmt"
 	"git.oschina.net/cloudzone/smartgo/stgcommon"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/metrics"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/namesrv"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/static"
+	"git.oschina.net/cloudzone/smartgo/stgnet/netm"
 	"git.oschina.net/cloudzone/smartgo/stgnet/remoting"
 	"git.oschina.net/cloudzone/smartgo/stgregistry/logger"
 	"os"
@@ -54,8 +56,19 @@ func CreateNamesrvController(registryPort int) *DefaultNamesrvController {
 		listenPort = namesrvPort
 	}
 	remotingServer := remoting.NewDefalutRemotingServer(static.REGISTRY_IP, listenPort)
+	tlsConfig := netm.NewTlsConfigFromEnv()
+	if err := remotingServer.SetTlsConfig(tlsConfig); err != nil {
+		fmt.Printf("the name server tls config invalid: %s\n", err.Error())
+		logger.Error("name server tls config invalid: %s", err.Error())
+		os.Exit(0)
+	}
 	controller := NewNamesrvController(cfg, remotingServer)
+	if metricsPort, err := strconv.Atoi(stgcommon.GetNamesrvMetricsPort()); err == nil && metricsPort > 0 {
+		addr := fmt.Sprintf(":%d", metricsPort)
+		controller.MetricsServer = metrics.NewServer(addr, NewNamesrvMetricsCollector(controller), remotingServer)
+	}
 
-	logger.Info("create name server controller success. listenPort=%d", listenPort)
+	tlsMode, _ := netm.ParseTlsMode(tlsConfig.Mode)
+	logger.Info("create name server controller success. listenPort=%d, tlsMode=%s", listenPort, tlsMode)
 	return controller
 }
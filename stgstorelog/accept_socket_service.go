@@ -54,19 +54,41 @@ func (self *AcceptSocketService) start() {
 		}
 
 		logger.Info("HAService receive new connection, ", connection.RemoteAddr().String())
-		haConnection := NewHAConnection(self.haService, connection)
-
-		go func() {
-			haConnection.start()
-		}()
+		if self.haService.tlsContext.Enabled() {
+			go self.acceptTlsConnection(connection)
+			continue
+		}
 
-		self.haService.addConnection(haConnection)
+		self.acceptConnection(connection)
 	}
 
 	self.listener.Close()
 	logger.Info("accept socket service end")
 }
 
+// acceptTlsConnection 完成TLS握手后再建立主从复制连接，握手失败时关闭连接
+// Since 2018/1/26
+func (self *AcceptSocketService) acceptTlsConnection(connection *net.TCPConn) {
+	conn, err := self.haService.tlsContext.ServerConn(connection)
+	if err != nil {
+		logger.Errorf("accept socket service tls handshake error: %s, %s", connection.RemoteAddr().String(), err.Error())
+		connection.Close()
+		return
+	}
+
+	self.acceptConnection(conn)
+}
+
+func (self *AcceptSocketService) acceptConnection(connection net.Conn) {
+	haConnection := NewHAConnection(self.haService, connection)
+
+	go func() {
+		haConnection.start()
+	}()
+
+	self.haService.addConnection(haConnection)
+}
+
 func (self *AcceptSocketService) Shutdown(interrupt bool) {
 	self.stoped = true
 }
@@ -5,10 +5,15 @@
 package stgstorelog
 
 import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
-	"github.com/fanliao/go-concurrentMap"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/utils/fileutil"
 )
 
 const (
@@ -16,136 +21,235 @@ const (
 	DEFAULT_INITIAL_CAPACITY = 11
 )
 
+// AllocateMapedFileService 后台预分配MapedFile服务，提前创建后续AllocateMapedFilePreNums个文件，
+// CommitLog滚动时直接取用已创建(可选已预热)的文件；服务异常或分配超时时由调用方同步创建
+// Since: 2018/1/15
 type AllocateMapedFileService struct {
-	requestTable *concurrent.ConcurrentMap
-	requestChan  chan *AllocateRequest
-	hasException bool
+	messageStoreConfig *MessageStoreConfig
+	requestTable       map[string]*AllocateRequest // 已提交尚未被取走的分配请求
+	requestMu          *sync.Mutex
+	requestChan        chan *AllocateRequest
+	closeChan          chan bool
+	hasException       int32 // 最近一次创建文件是否失败，只用于日志，不影响后续请求的提交
+	stop               int32
+
+	allocateTimes     int64 // 后台成功创建文件次数
+	allocateTotalTime int64 // 后台创建文件总耗时（单位毫秒）
+	allocateMaxTime   int64 // 后台创建文件最大耗时（单位毫秒）
+	waitMaxTime       int64 // 文件滚动时等待预分配文件的最大耗时（单位毫秒）
+	fallbackTimes     int64 // 回退到同步创建文件的次数
 }
 
-func NewAllocateMapedFileService() *AllocateMapedFileService {
+func NewAllocateMapedFileService(messageStoreConfig *MessageStoreConfig) *AllocateMapedFileService {
+	capacity := DEFAULT_INITIAL_CAPACITY
+	if preNums := int(messageStoreConfig.AllocateMapedFilePreNums) * 2; preNums > capacity {
+		capacity = preNums
+	}
+
 	ams := new(AllocateMapedFileService)
-	ams.requestTable = concurrent.NewConcurrentMap()
-	ams.requestChan = make(chan *AllocateRequest, DEFAULT_INITIAL_CAPACITY)
+	ams.messageStoreConfig = messageStoreConfig
+	ams.requestTable = make(map[string]*AllocateRequest)
+	ams.requestMu = new(sync.Mutex)
+	ams.requestChan = make(chan *AllocateRequest, capacity)
+	ams.closeChan = make(chan bool, 1)
 	return ams
 }
 
-func (self *AllocateMapedFileService) putRequestAndReturnMapedFile(nextFilePath string, nextNextFilePath string, filesize int64) (*MapedFile, error) {
-	nextReq := NewAllocateRequest(nextFilePath, filesize)
-	nextNextReq := NewAllocateRequest(nextNextFilePath, filesize)
+// putRequestAndReturnMapedFile 提交从createOffset开始的预分配请求，并返回createOffset对应的文件
+// Return: 分配失败或超时返回error，调用方应同步创建文件
+// Since: 2018/1/15
+func (self *AllocateMapedFileService) putRequestAndReturnMapedFile(storePath string, createOffset int64, fileSize int64) (*MapedFile, error) {
+	// 创建失败只回退当前请求，仍继续提交，文件系统恢复后预分配随之恢复
+	if atomic.LoadInt32(&self.stop) == 1 {
+		atomic.AddInt64(&self.fallbackTimes, 1)
+		return nil, fmt.Errorf("allocate maped file service is not available, it has been stopped")
+	}
 
-	oldValue, err := self.requestTable.PutIfAbsent(nextFilePath, nextReq)
-	if err != nil {
-		logger.Info("allocate maped file service put request error:", err.Error())
-		return nil, nil
+	preNums := int64(self.messageStoreConfig.AllocateMapedFilePreNums)
+	if preNums < 1 {
+		preNums = 1
 	}
 
-	if oldValue == nil {
-		self.requestChan <- nextReq
+	nextFilePath := ""
+	for i := int64(0); i < preNums; i++ {
+		filePath := storePath + string(filepath.Separator) + fileutil.Offset2FileName(createOffset+i*fileSize)
+		if i == 0 {
+			nextFilePath = filePath
+		}
+
+		if !self.submitRequest(filePath, fileSize) && i == 0 {
+			atomic.AddInt64(&self.fallbackTimes, 1)
+			return nil, fmt.Errorf("allocate maped file service submit request %s failed", filePath)
+		}
 	}
 
-	nextOldValue, err := self.requestTable.PutIfAbsent(nextNextFilePath, nextNextReq)
-	if err != nil {
-		logger.Info("allocate maped file service put request error:", err.Error())
-		return nil, nil
+	self.requestMu.Lock()
+	request, ok := self.requestTable[nextFilePath]
+	self.requestMu.Unlock()
+	if !ok {
+		atomic.AddInt64(&self.fallbackTimes, 1)
+		return nil, fmt.Errorf("find preallocate request %s failed, this never happen", nextFilePath)
 	}
 
-	if nextOldValue == nil {
-		self.requestChan <- nextNextReq
+	beginTime := stgcommon.GetCurrentTimeMillis()
+	select {
+	case <-request.syncChan:
+	case <-time.After(WaitTimeOut * time.Millisecond):
+		if request.abandon() {
+			self.removeRequest(nextFilePath)
+			atomic.AddInt64(&self.fallbackTimes, 1)
+			return nil, fmt.Errorf("create mmap timeout %s %d", request.filePath, request.fileSize)
+		}
+
+		// 文件正在创建，放弃反而会与同步创建冲突，继续等待完成
+		logger.Warnf("create mmap timeout %s %d, it is in progress, keep waiting", request.filePath, request.fileSize)
+		<-request.syncChan
 	}
+	self.updateMaxTime(&self.waitMaxTime, stgcommon.GetCurrentTimeMillis()-beginTime)
+	self.removeRequest(nextFilePath)
 
-	result, err := self.requestTable.Get(nextFilePath)
-	if err != nil {
-		logger.Info("allocate maped file service get request by file path error:", err.Error())
+	if request.err != nil {
+		atomic.AddInt64(&self.fallbackTimes, 1)
+		return nil, request.err
 	}
 
-	if result != nil {
-		request := result.(*AllocateRequest)
+	return request.mapedFile, nil
+}
 
-		select {
-		case <-request.syncChan:
-			logger.Info("sync chan complete")
-			break
-		case <-time.After(WaitTimeOut * time.Millisecond):
-			logger.Warnf("create mmap timeout %s %d", request.filePath, request.fileSize)
-		}
+// submitRequest 提交分配请求，已存在相同文件的请求时不重复提交
+// Since: 2018/1/15
+func (self *AllocateMapedFileService) submitRequest(filePath string, fileSize int64) bool {
+	self.requestMu.Lock()
+	defer self.requestMu.Unlock()
 
-		self.requestTable.Remove(nextFilePath)
+	if _, ok := self.requestTable[filePath]; ok {
+		return true
+	}
 
-		return request.mapedFile, nil
-	} else {
-		logger.Error("find preallocate mmap failed, this never happen")
+	request := NewAllocateRequest(filePath, fileSize)
+	select {
+	case self.requestChan <- request:
+		self.requestTable[filePath] = request
+		return true
+	default:
+		logger.Warnf("allocate maped file service request queue is full, drop request %s", filePath)
+		return false
 	}
+}
 
-	return nil, nil
+func (self *AllocateMapedFileService) removeRequest(filePath string) {
+	self.requestMu.Lock()
+	delete(self.requestTable, filePath)
+	self.requestMu.Unlock()
 }
 
-func (self *AllocateMapedFileService) mmapOperation() bool {
-	select {
-	case request := <-self.requestChan:
-		value, err := self.requestTable.Get(request.filePath)
-		if err != nil {
-			logger.Info("allocate maped file service mmapOperation get request error:", err.Error())
-			return true
-		}
+// mmapOperation 创建文件，按需预热
+// Since: 2018/1/15
+func (self *AllocateMapedFileService) mmapOperation(request *AllocateRequest) {
+	if !request.begin() {
+		logger.Warnf("this mmap request expired, maybe cause timeout %s %d", request.filePath, request.fileSize)
+		return
+	}
+	defer request.complete()
 
-		if value == nil {
-			logger.Warnf("this mmap request expired, maybe cause timeout %s %s", request.filePath, request.fileSize)
-			return true
-		}
+	beginTime := stgcommon.GetCurrentTimeMillis()
+	mapedFile, err := NewMapedFile(request.filePath, request.fileSize)
+	if err != nil {
+		logger.Errorf("allocate maped file service create %s error: %s", request.filePath, err.Error())
+		atomic.StoreInt32(&self.hasException, 1)
+		request.err = err
+		return
+	}
 
-		if request.mapedFile == nil {
-			beginTime := time.Now().UnixNano() / 1000000
-			mapedFile, err := NewMapedFile(request.filePath, request.fileSize)
-			if mapedFile == nil {
-				logger.Error("New Maped File")
-			}
+	if self.messageStoreConfig.WarmMapedFileEnable {
+		mapedFile.warmMappedFile()
+	}
 
-			if err != nil {
-				logger.Warn("allocate maped file service has exception, maybe by shutdown,error:", err.Error())
-				return false
-			}
+	eclipseTime := stgcommon.GetCurrentTimeMillis() - beginTime
+	atomic.AddInt64(&self.allocateTimes, 1)
+	atomic.AddInt64(&self.allocateTotalTime, eclipseTime)
+	self.updateMaxTime(&self.allocateMaxTime, eclipseTime)
+	if eclipseTime > 10 {
+		logger.Infof("create mmap %s eclipse time(ms): %d, queue size: %d", request.filePath, eclipseTime, len(self.requestChan))
+	}
 
-			eclipseTime := beginTime - time.Now().UnixNano()/1000000
-			if eclipseTime > 10 {
-				// TODO
-			}
+	if atomic.SwapInt32(&self.hasException, 0) == 1 {
+		logger.Infof("allocate maped file service recovered, create %s OK", request.filePath)
+	}
+	request.mapedFile = mapedFile
+}
 
-			request.mapedFile = mapedFile
+func (self *AllocateMapedFileService) updateMaxTime(maxTime *int64, value int64) {
+	for {
+		old := atomic.LoadInt64(maxTime)
+		if value <= old || atomic.CompareAndSwapInt64(maxTime, old, value) {
+			return
 		}
+	}
+}
 
-		request.syncChan <- true
-
-		break
+// buildRunningStats 预分配文件统计信息
+// Since: 2018/1/15
+func (self *AllocateMapedFileService) buildRunningStats(stats map[string]string) {
+	allocateTimes := atomic.LoadInt64(&self.allocateTimes)
+	var avgTime int64
+	if allocateTimes > 0 {
+		avgTime = atomic.LoadInt64(&self.allocateTotalTime) / allocateTimes
 	}
 
-	return true
+	stats[stgcommon.MAPED_FILE_ALLOCATE_TIMES.String()] = fmt.Sprintf("%d", allocateTimes)
+	stats[stgcommon.MAPED_FILE_ALLOCATE_AVG_TIME.String()] = fmt.Sprintf("%d", avgTime)
+	stats[stgcommon.MAPED_FILE_ALLOCATE_MAX_TIME.String()] = fmt.Sprintf("%d", atomic.LoadInt64(&self.allocateMaxTime))
+	stats[stgcommon.MAPED_FILE_ALLOCATE_WAIT_MAX_TIME.String()] = fmt.Sprintf("%d", atomic.LoadInt64(&self.waitMaxTime))
+	stats[stgcommon.MAPED_FILE_ALLOCATE_FALLBACK_TIMES.String()] = fmt.Sprintf("%d", atomic.LoadInt64(&self.fallbackTimes))
 }
 
 func (self *AllocateMapedFileService) Start() {
 	logger.Info("allocate maped file service started")
 	for {
-		if self.mmapOperation() {
-
+		select {
+		case request := <-self.requestChan:
+			self.mmapOperation(request)
+		case <-self.closeChan:
+			logger.Info("allocate maped file service end")
+			return
 		}
 	}
 }
 
+// Shutdown 停止服务，删除已预分配但未被使用的文件
+// Since: 2018/1/15
 func (self *AllocateMapedFileService) Shutdown() {
-	for iterator := self.requestTable.Iterator(); iterator.HasNext(); {
-		_, value, ok := iterator.Next()
-		if ok {
-			request := value.(*AllocateRequest)
-			logger.Info("delete pre allocated maped file, ", request.mapedFile.fileName)
-			success := request.mapedFile.destroy(1000)
-			if !success {
-				time.Sleep(time.Millisecond * 1)
-				for i := 0; i < 3; i++ {
-					if request.mapedFile.destroy(1000) {
-						break
-					}
+	atomic.StoreInt32(&self.stop, 1)
+	self.closeChan <- true
+
+	self.requestMu.Lock()
+	requests := make([]*AllocateRequest, 0, len(self.requestTable))
+	for _, request := range self.requestTable {
+		requests = append(requests, request)
+	}
+	self.requestTable = make(map[string]*AllocateRequest)
+	self.requestMu.Unlock()
+
+	for _, request := range requests {
+		if request.abandon() {
+			continue
+		}
+
+		<-request.syncChan
+		if request.mapedFile == nil {
+			continue
+		}
+
+		logger.Info("delete pre allocated maped file, ", request.mapedFile.fileName)
+		success := request.mapedFile.destroy(1000)
+		if !success {
+			time.Sleep(time.Millisecond * 1)
+			for i := 0; i < 3; i++ {
+				if request.mapedFile.destroy(1000) {
+					break
 				}
 			}
 		}
 	}
-
 }
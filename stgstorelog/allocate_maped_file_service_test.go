@@ -0,0 +1,94 @@
+package stgstorelog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon/utils/fileutil"
+)
+
+func TestAllocateMapedFileServicePreAllocate(t *testing.T) {
+	storePath := "./unit_test_store/AllocateMapedFileTest"
+	defer os.RemoveAll(storePath)
+
+	config := NewMessageStoreConfig()
+	config.AllocateMapedFilePreNums = 3
+	config.WarmMapedFileEnable = true
+
+	service := NewAllocateMapedFileService(config)
+	go service.Start()
+
+	fileSize := int64(1024 * 64)
+	mapedFile, err := service.putRequestAndReturnMapedFile(storePath, 0, fileSize)
+	if err != nil {
+		t.Fatalf("allocate maped file error: %s", err.Error())
+	}
+	if mapedFile == nil || mapedFile.fileFromOffset != 0 {
+		t.Fatalf("allocate maped file failed, %v", mapedFile)
+	}
+
+	// 下一个文件已被预分配
+	mapedFile, err = service.putRequestAndReturnMapedFile(storePath, fileSize, fileSize)
+	if err != nil {
+		t.Fatalf("allocate maped file error: %s", err.Error())
+	}
+	if mapedFile.fileFromOffset != fileSize {
+		t.Errorf("allocate maped file offset error, expect %d, actual %d", fileSize, mapedFile.fileFromOffset)
+	}
+
+	stats := make(map[string]string)
+	service.buildRunningStats(stats)
+	t.Logf("allocate stats: %v", stats)
+
+	service.Shutdown()
+
+	// 关闭时删除未被使用的预分配文件
+	for i := int64(2); i < 4; i++ {
+		filePath := storePath + string(filepath.Separator) + fileutil.Offset2FileName(i*fileSize)
+		if exist, _ := PathExists(filePath); exist {
+			t.Errorf("pre allocated file %s should be deleted", filePath)
+		}
+	}
+
+	if _, err := service.putRequestAndReturnMapedFile(storePath, 2*fileSize, fileSize); err == nil {
+		t.Errorf("allocate after shutdown should fail back to synchronous allocation")
+	}
+}
+
+func TestAllocateMapedFileServiceRecoverAfterException(t *testing.T) {
+	storePath := "./unit_test_store/AllocateMapedFileExceptionTest"
+	defer os.RemoveAll(storePath)
+	if err := os.MkdirAll(storePath, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	config := NewMessageStoreConfig()
+	config.AllocateMapedFilePreNums = 1
+
+	service := NewAllocateMapedFileService(config)
+	go service.Start()
+	defer service.Shutdown()
+
+	// 存储目录是普通文件，创建失败
+	badPath := storePath + string(filepath.Separator) + "file"
+	if err := ioutil.WriteFile(badPath, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fileSize := int64(1024 * 64)
+	if _, err := service.putRequestAndReturnMapedFile(badPath+string(filepath.Separator)+"commitlog", 0, fileSize); err == nil {
+		t.Fatalf("allocate under a regular file should fail")
+	}
+
+	// 一次失败后继续预分配
+	mapedFile, err := service.putRequestAndReturnMapedFile(storePath+string(filepath.Separator)+"commitlog", 0, fileSize)
+	if err != nil {
+		t.Fatalf("allocate after exception error: %s", err.Error())
+	}
+	mapedFile.destroy(1000)
+	if atomic.LoadInt32(&service.hasException) != 0 {
+		t.Errorf("hasException should be cleared after a successful allocation")
+	}
+}
@@ -1,21 +1,71 @@
 package stgstorelog
 
+import (
+	"sync"
+)
+
+const (
+	allocateRequestQueued    = iota // 等待创建
+	allocateRequestRunning          // 正在创建
+	allocateRequestDone             // 创建完成（成功或失败）
+	allocateRequestAbandoned        // 等待超时被放弃
+)
+
 type AllocateRequest struct {
 	filePath  string
 	fileSize  int64
-	syncChan  chan bool
+	syncChan  chan bool // 创建完成后关闭
 	mapedFile *MapedFile
+	err       error // 创建失败原因
+	state     int
+	stateMu   sync.Mutex
 }
 
 func NewAllocateRequest(filePath string, fileSize int64) *AllocateRequest {
 	request := new(AllocateRequest)
 	request.filePath = filePath
 	request.fileSize = fileSize
-	request.syncChan = make(chan bool, 1)
+	request.syncChan = make(chan bool)
+	request.state = allocateRequestQueued
 
 	return request
 }
 
+// begin 开始创建文件，请求已被放弃时返回false
+// Since: 2018/1/15
+func (self *AllocateRequest) begin() bool {
+	self.stateMu.Lock()
+	defer self.stateMu.Unlock()
+
+	if self.state != allocateRequestQueued {
+		return false
+	}
+	self.state = allocateRequestRunning
+	return true
+}
+
+// complete 文件创建结束，唤醒等待者
+// Since: 2018/1/15
+func (self *AllocateRequest) complete() {
+	self.stateMu.Lock()
+	self.state = allocateRequestDone
+	self.stateMu.Unlock()
+	close(self.syncChan)
+}
+
+// abandon 放弃尚未开始创建的请求，请求已开始或已完成时返回false
+// Since: 2018/1/15
+func (self *AllocateRequest) abandon() bool {
+	self.stateMu.Lock()
+	defer self.stateMu.Unlock()
+
+	if self.state != allocateRequestQueued {
+		return false
+	}
+	self.state = allocateRequestAbandoned
+	return true
+}
+
 func (self *AllocateRequest) compareTo(request *AllocateRequest) int {
 	if self.fileSize < request.fileSize {
 		return 1
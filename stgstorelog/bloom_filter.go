@@ -0,0 +1,69 @@
+package stgstorelog
+
+import (
+	"hash/fnv"
+)
+
+const (
+	bloomFilterHashNums = 3 // 每个订阅组占用的bit数
+)
+
+// BloomFilter 消费队列扩展单元中订阅组过滤位图使用的布隆过滤器，
+// 消息匹配某个订阅组的过滤条件时，将该订阅组对应的bit全部置1
+// Since 2018/1/17
+type BloomFilter struct {
+	bitLength int32 // 位图长度（单位bit）
+}
+
+func NewBloomFilter(bitLength int32) *BloomFilter {
+	if bitLength < 8 {
+		bitLength = 8
+	}
+
+	return &BloomFilter{bitLength: bitLength / 8 * 8}
+}
+
+// bitPositions 计算订阅组在位图中对应的bit位置，采用双重哈希
+// Since 2018/1/17
+func (self *BloomFilter) bitPositions(consumerGroup string) []int32 {
+	h1 := fnv.New32a()
+	h1.Write([]byte(consumerGroup))
+	hash1 := h1.Sum32()
+
+	h2 := fnv.New32()
+	h2.Write([]byte(consumerGroup))
+	hash2 := h2.Sum32() | 1
+
+	positions := make([]int32, bloomFilterHashNums)
+	for i := 0; i < bloomFilterHashNums; i++ {
+		positions[i] = int32((hash1 + uint32(i)*hash2) % uint32(self.bitLength))
+	}
+
+	return positions
+}
+
+func (self *BloomFilter) newBitMap() []byte {
+	return make([]byte, self.bitLength/8)
+}
+
+func (self *BloomFilter) setBits(bitMap []byte, positions []int32) {
+	for _, pos := range positions {
+		bitMap[pos/8] |= 1 << uint(pos%8)
+	}
+}
+
+// isHit 订阅组对应的bit是否全部为1；位图长度与当前配置不一致时无法判断，视为命中
+// Since 2018/1/17
+func (self *BloomFilter) isHit(bitMap []byte, positions []int32) bool {
+	if int32(len(bitMap)) != self.bitLength/8 {
+		return true
+	}
+
+	for _, pos := range positions {
+		if bitMap[pos/8]&(1<<uint(pos%8)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
@@ -1,6 +1,7 @@
 package stgstorelog
 
 import (
+	"math"
 	"os"
 	"strconv"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
@@ -77,10 +78,15 @@ func (self *CleanCommitLogService) deleteExpiredFiles() {
 			self.manualDeleteFileSeveralTimes--
 		}
 
-		fileReservedTime := self.defaultMessageStore.MessageStoreConfig.FileReservedTime
+		fileReservedTime := self.defaultMessageStore.MessageStoreConfig.GetFileReservedTime()
+
+		// 存在保留时间更长的Topic时，物理文件需要保留到该Topic过期
+		if maxRetentionHours := self.defaultMessageStore.getMaxTopicRetentionHours(); maxRetentionHours > fileReservedTime {
+			fileReservedTime = maxRetentionHours
+		}
 
 		// 是否立刻强制删除文件
-		cleanAtOnce := self.defaultMessageStore.MessageStoreConfig.CleanFileForciblyEnable && self.cleanImmediately
+		cleanAtOnce := self.defaultMessageStore.MessageStoreConfig.GetCleanFileForciblyEnable() && self.cleanImmediately
 		logger.Infof("begin to delete before %d hours file. timeup: %t spacefull: %t manualDeleteFileSeveralTimes: %d cleanAtOnce: %t",
 			fileReservedTime, timeup, spacefull, self.manualDeleteFileSeveralTimes, cleanAtOnce)
 
@@ -90,8 +96,14 @@ func (self *CleanCommitLogService) deleteExpiredFiles() {
 		deletePhysicFilesInterval := self.defaultMessageStore.MessageStoreConfig.DeleteCommitLogFilesInterval
 		destroyMapedFileIntervalForcibly := self.defaultMessageStore.MessageStoreConfig.DestroyMapedFileIntervalForcibly
 
+		// 压缩Topic尚未压缩的消息不能随物理文件删除
+		maxDeleteOffset := int64(-1)
+		if self.defaultMessageStore.CompactionService != nil {
+			maxDeleteOffset = self.defaultMessageStore.CompactionService.getMinUncompactedPhyOffset()
+		}
+
 		deleteCount := self.defaultMessageStore.CommitLog.deleteExpiredFile(fileReservedTime,
-			deletePhysicFilesInterval, int64(destroyMapedFileIntervalForcibly), cleanAtOnce)
+			deletePhysicFilesInterval, int64(destroyMapedFileIntervalForcibly), cleanAtOnce, maxDeleteOffset)
 
 		if deleteCount > 0 {
 			// TODO
@@ -102,7 +114,7 @@ func (self *CleanCommitLogService) deleteExpiredFiles() {
 }
 
 func (self *CleanCommitLogService) isTimeToDelete() bool {
-	when := self.defaultMessageStore.MessageStoreConfig.DeleteWhen
+	when := self.defaultMessageStore.MessageStoreConfig.GetDeleteWhen()
 	if stgcommon.IsItTimeToDo(when) {
 		logger.Info("it's time to reclaim disk space, ", when)
 		return true
@@ -114,43 +126,52 @@ func (self *CleanCommitLogService) isTimeToDelete() bool {
 func (self *CleanCommitLogService) isSpaceToDelete() bool {
 	self.cleanImmediately = false
 
+	var (
+		storePathPhysic = self.defaultMessageStore.MessageStoreConfig.StorePathCommitLog
+		physicRatio     = stgcommon.GetDiskPartitionSpaceUsedPercent(storePathPhysic)
+		storePathLogics = config.GetStorePathConsumeQueue(self.defaultMessageStore.MessageStoreConfig.StorePathRootDir)
+		logicsRatio     = stgcommon.GetDiskPartitionSpaceUsedPercent(storePathLogics)
+	)
+
+	// 物理文件与逻辑文件可能位于不同分区，按使用率较高者标记磁盘状态，避免两次检测互相覆盖
+	self.checkDiskFull(math.Max(physicRatio, logicsRatio))
+
 	// 检测物理文件磁盘空间
-	if self.checkCommitLogFileSpace() {
+	if self.checkCommitLogFileSpace(physicRatio) {
 		return true
 	}
 
 	// 检测逻辑文件磁盘空间
-	if self.checkConsumeQueueFileSpace() {
+	if self.checkConsumeQueueFileSpace(logicsRatio) {
 		return true
 	}
 
 	return false
 }
 
-func (self *CleanCommitLogService) checkCommitLogFileSpace() bool {
-	var (
-		ratio           = float64(self.defaultMessageStore.MessageStoreConfig.getDiskMaxUsedSpaceRatio()) / 100.0
-		storePathPhysic = self.defaultMessageStore.MessageStoreConfig.StorePathCommitLog
-		physicRatio     = stgcommon.GetDiskPartitionSpaceUsedPercent(storePathPhysic)
-	)
-
-	if physicRatio > self.diskSpaceWarningLevelRatio {
+// checkDiskFull 根据磁盘使用率标记磁盘满或恢复，磁盘满时存储进入DISK_FULL模式
+// Since 2018/1/18
+func (self *CleanCommitLogService) checkDiskFull(usedRatio float64) {
+	if usedRatio > self.diskSpaceWarningLevelRatio {
 		diskFull := self.defaultMessageStore.RunningFlags.getAndMakeDiskFull()
 		if diskFull {
-			logger.Errorf("physic disk maybe full soon %f, so mark disk full", physicRatio)
+			logger.Errorf("disk maybe full soon %f, so mark disk full", usedRatio)
 			// TODO System.gc()
 		}
 
 		self.cleanImmediately = true
-	} else if physicRatio > self.diskSpaceCleanForciblyRatio {
+	} else if usedRatio > self.diskSpaceCleanForciblyRatio {
 		self.cleanImmediately = true
 	} else {
 		diskOK := self.defaultMessageStore.RunningFlags.getAndMakeDiskOK()
 		if !diskOK {
-			logger.Infof("physic disk space OK %f, so mark disk ok", physicRatio)
+			logger.Infof("disk space OK %f, so mark disk ok", usedRatio)
 		}
 	}
+}
 
+func (self *CleanCommitLogService) checkCommitLogFileSpace(physicRatio float64) bool {
+	ratio := float64(self.defaultMessageStore.MessageStoreConfig.getDiskMaxUsedSpaceRatio()) / 100.0
 	if physicRatio < 0 || physicRatio > ratio {
 		logger.Info("physic disk maybe full soon, so reclaim space, ", physicRatio)
 		return true
@@ -159,30 +180,8 @@ func (self *CleanCommitLogService) checkCommitLogFileSpace() bool {
 	return false
 }
 
-func (self *CleanCommitLogService) checkConsumeQueueFileSpace() bool {
-	var (
-		ratio           = float64(self.defaultMessageStore.MessageStoreConfig.getDiskMaxUsedSpaceRatio()) / 100.0
-		storePathLogics = config.GetStorePathConsumeQueue(self.defaultMessageStore.MessageStoreConfig.StorePathRootDir)
-		logicsRatio     = stgcommon.GetDiskPartitionSpaceUsedPercent(storePathLogics)
-	)
-
-	if logicsRatio > self.diskSpaceWarningLevelRatio {
-		diskFull := self.defaultMessageStore.RunningFlags.getAndMakeDiskFull()
-		if diskFull {
-			logger.Errorf("logics disk maybe full soon %f, so mark disk full", logicsRatio)
-			// TODO System.gc()
-		}
-
-		self.cleanImmediately = true
-	} else if logicsRatio > self.diskSpaceCleanForciblyRatio {
-		self.cleanImmediately = true
-	} else {
-		diskOK := self.defaultMessageStore.RunningFlags.getAndMakeDiskOK()
-		if !diskOK {
-			logger.Infof("logics disk space OK %f, so mark disk ok", logicsRatio)
-		}
-	}
-
+func (self *CleanCommitLogService) checkConsumeQueueFileSpace(logicsRatio float64) bool {
+	ratio := float64(self.defaultMessageStore.MessageStoreConfig.getDiskMaxUsedSpaceRatio()) / 100.0
 	if logicsRatio < 0 || logicsRatio > ratio {
 		logger.Info("logics disk maybe full soon, so reclaim space, ", logicsRatio)
 		return true
@@ -34,6 +34,11 @@ func (self *CleanConsumeQueueService) deleteExpiredFiles() {
 		for _, logic := range value.consumeQueues {
 			deleteCount := logic.deleteExpiredFile(minOffset)
 
+			// Topic级别的保留时间、保留大小
+			if topicConfig := self.defaultMessageStore.getTopicConfig(logic.topic); topicConfig.HasRetention() {
+				deleteCount += logic.deleteExpiredFileByRetention(topicConfig.RetentionHours, topicConfig.RetentionBytes)
+			}
+
 			if deleteCount > 0 && deleteLogicsFilesInterval > 0 {
 				time.Sleep(time.Duration(deleteLogicsFilesInterval))
 			}
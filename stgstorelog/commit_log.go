@@ -28,6 +28,7 @@ type CommitLog struct {
 	AppendMessageCallback *DefaultAppendMessageCallback
 	TopicQueueTable       map[string]int64
 	mutex                 *sync.Mutex
+	beginTimeInLock       int64 // 本次写入获取锁的时间（单位毫秒），未持有锁时为0
 }
 
 func NewCommitLog(defaultMessageStore *DefaultMessageStore) *CommitLog {
@@ -69,16 +70,19 @@ func (self *CommitLog) putMessage(msg *MessageExtBrokerInner) *PutMessageResult
 	// TODO 事务消息处理
 	self.mutex.Lock()
 	beginLockTimestamp := time.Now().UnixNano() / 1000000
+	atomic.StoreInt64(&self.beginTimeInLock, beginLockTimestamp)
 	msg.BornTimestamp = beginLockTimestamp
 
 	mapedFile, err := self.MapedFileQueue.getLastMapedFile(int64(0))
 	if err != nil {
-		// TODO
+		self.unlockPutMessage()
+		logger.Error(err.Error())
 		return &PutMessageResult{PutMessageStatus: CREATE_MAPEDFILE_FAILED}
 	}
 
 	if mapedFile == nil {
-		// TODO
+		self.unlockPutMessage()
+		logger.Errorf("create maped file1 error, topic:%s clientAddr:%s", msg.Topic, msg.BornHost)
 		return &PutMessageResult{PutMessageStatus: CREATE_MAPEDFILE_FAILED}
 	}
 
@@ -89,11 +93,13 @@ func (self *CommitLog) putMessage(msg *MessageExtBrokerInner) *PutMessageResult
 	case END_OF_FILE:
 		mapedFile, err = self.MapedFileQueue.getLastMapedFile(int64(0))
 		if err != nil {
+			self.unlockPutMessage()
 			logger.Error(err.Error())
 			return &PutMessageResult{PutMessageStatus: CREATE_MAPEDFILE_FAILED, AppendMessageResult: result}
 		}
 
 		if mapedFile == nil {
+			self.unlockPutMessage()
 			logger.Errorf("create maped file2 error, topic:%s clientAddr:%s", msg.Topic, msg.BornHost)
 			return &PutMessageResult{PutMessageStatus: CREATE_MAPEDFILE_FAILED, AppendMessageResult: result}
 		}
@@ -101,8 +107,10 @@ func (self *CommitLog) putMessage(msg *MessageExtBrokerInner) *PutMessageResult
 		result = mapedFile.AppendMessageWithCallBack(msg, self.AppendMessageCallback)
 		break
 	case MESSAGE_SIZE_EXCEEDED:
+		self.unlockPutMessage()
 		return &PutMessageResult{PutMessageStatus: MESSAGE_ILLEGAL, AppendMessageResult: result}
 	default:
+		self.unlockPutMessage()
 		return &PutMessageResult{PutMessageStatus: PUTMESSAGE_UNKNOWN_ERROR, AppendMessageResult: result}
 	}
 
@@ -120,12 +128,12 @@ func (self *CommitLog) putMessage(msg *MessageExtBrokerInner) *PutMessageResult
 		tranStateTableOffset:      msg.QueueOffset,
 		preparedTransactionOffset: msg.PreparedTransactionOffset,
 		producerGroup:             message.PROPERTY_PRODUCER_GROUP,
+		properties:                msg.Properties,
 	}
 
 	self.DefaultMessageStore.DispatchMessageService.putRequest(dispatchRequest)
 
-	eclipseTimeInLock := time.Now().UnixNano()/1000000 - beginLockTimestamp
-	self.mutex.Unlock()
+	eclipseTimeInLock := self.unlockPutMessage()
 
 	if eclipseTimeInLock > 1000 {
 		logger.Warn("putMessage in lock eclipse time(ms) ", eclipseTimeInLock)
@@ -142,7 +150,7 @@ func (self *CommitLog) putMessage(msg *MessageExtBrokerInner) *PutMessageResult
 		if msg.isWaitStoreMsgOK() {
 			request := NewGroupCommitRequest(result.WroteOffset + result.WroteBytes)
 			self.GroupCommitService.putRequest(request)
-			flushOk := request.waitForFlush(int64(self.DefaultMessageStore.MessageStoreConfig.SyncFlushTimeout))
+			flushOk := request.waitForFlush(int64(self.DefaultMessageStore.MessageStoreConfig.GetSyncFlushTimeout()))
 			if flushOk == false {
 				logger.Errorf("do groupcommit, wait for flush failed, topic: %s tags: %s client address: %s",
 					msg.Topic, msg.GetTags(), msg.BornHost)
@@ -157,7 +165,24 @@ func (self *CommitLog) putMessage(msg *MessageExtBrokerInner) *PutMessageResult
 
 	// Synchronous write double
 	if config.SYNC_MASTER == self.DefaultMessageStore.MessageStoreConfig.BrokerRole {
-		// TODO
+		service := self.DefaultMessageStore.HAService
+		if msg.isWaitStoreMsgOK() {
+			// 同步副本数不足时不再等待
+			if service.isSlaveOK(result.WroteOffset + result.WroteBytes) {
+				if service.needAckSlaveNums() > 0 {
+					request := NewGroupCommitRequest(result.WroteOffset + result.WroteBytes)
+					service.putRequest(request)
+					flushOk := request.waitForFlush(int64(self.DefaultMessageStore.MessageStoreConfig.GetSyncFlushTimeout()))
+					if flushOk == false {
+						logger.Errorf("do sync transfer other node, wait return, but failed, topic: %s tags: %s client address: %s",
+							msg.Topic, msg.GetTags(), msg.BornHost)
+						putMessageResult.PutMessageStatus = FLUSH_SLAVE_TIMEOUT
+					}
+				}
+			} else {
+				putMessageResult.PutMessageStatus = SLAVE_NOT_AVAILABLE
+			}
+		}
 	}
 
 	return putMessageResult
@@ -245,6 +270,26 @@ func (self *CommitLog) pickupStoretimestamp(offset int64, size int32) int64 {
 	return -1
 }
 
+// unlockPutMessage 释放写入锁，返回持有锁的时间（单位毫秒）
+// Since 2018/1/25
+func (self *CommitLog) unlockPutMessage() int64 {
+	eclipseTimeInLock := time.Now().UnixNano()/1000000 - atomic.LoadInt64(&self.beginTimeInLock)
+	atomic.StoreInt64(&self.beginTimeInLock, 0)
+	self.mutex.Unlock()
+	return eclipseTimeInLock
+}
+
+// lockTimeMills 当前写入已持有锁的时间（单位毫秒），未持有锁时返回0
+// Since 2018/1/25
+func (self *CommitLog) lockTimeMills() int64 {
+	beginTimeInLock := atomic.LoadInt64(&self.beginTimeInLock)
+	if beginTimeInLock <= 0 {
+		return 0
+	}
+
+	return time.Now().UnixNano()/1000000 - beginTimeInLock
+}
+
 func (self *CommitLog) getMinOffset() int64 {
 	mapedFile := self.MapedFileQueue.getFirstMapedFileOnLock()
 	if mapedFile != nil {
@@ -320,9 +365,10 @@ func (self *CommitLog) checkMessageAndReturnSize(mappedByteBuffer *MappedByteBuf
 	}
 
 	var (
-		topic          = ""
-		keys           = ""
-		tagsCode int64 = 0
+		topic                           = ""
+		keys                            = ""
+		tagsCode      int64             = 0
+		propertiesMap map[string]string = nil
 	)
 
 	// 16 TOPIC
@@ -339,7 +385,7 @@ func (self *CommitLog) checkMessageAndReturnSize(mappedByteBuffer *MappedByteBuf
 		propertiesBytes := make([]byte, propertiesLength)
 		mappedByteBuffer.Read(propertiesBytes)
 		properties := string(propertiesBytes)
-		propertiesMap := message.String2messageProperties(properties)
+		propertiesMap = message.String2messageProperties(properties)
 		keys = propertiesMap[message.PROPERTY_KEYS]
 		tags := propertiesMap[message.PROPERTY_TAGS]
 		if len(tags) > 0 {
@@ -375,6 +421,7 @@ func (self *CommitLog) checkMessageAndReturnSize(mappedByteBuffer *MappedByteBuf
 		tranStateTableOffset:      int64(0),                  // 10
 		preparedTransactionOffset: preparedTransactionOffset, // 11
 		producerGroup:             "",                        // 12
+		properties:                propertiesMap,             // 13
 	}
 }
 
@@ -489,8 +536,8 @@ func (self *CommitLog) isMapedFileMatchedRecover(mapedFile *MapedFile) bool {
 	return false
 }
 
-func (self *CommitLog) deleteExpiredFile(expiredTime int64, deleteFilesInterval int32, intervalForcibly int64, cleanImmediately bool) int {
-	return self.MapedFileQueue.deleteExpiredFileByTime(expiredTime, int(deleteFilesInterval), intervalForcibly, cleanImmediately)
+func (self *CommitLog) deleteExpiredFile(expiredTime int64, deleteFilesInterval int32, intervalForcibly int64, cleanImmediately bool, maxDeleteOffset int64) int {
+	return self.MapedFileQueue.deleteExpiredFileByTime(expiredTime, int(deleteFilesInterval), intervalForcibly, cleanImmediately, maxDeleteOffset)
 }
 
 func (self *CommitLog) retryDeleteFirstFile(intervalForcibly int64) bool {
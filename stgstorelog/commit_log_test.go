@@ -0,0 +1,35 @@
+package stgstorelog
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDefaultMessageStore_IsOSPageCacheBusy(t *testing.T) {
+	master := buildMessageStore()
+	defer master.Destroy()
+	defer master.Shutdown()
+
+	putMessage(master, 1)
+	if master.IsOSPageCacheBusy() || master.CommitLog.lockTimeMills() != 0 {
+		t.Fatal("page cache should not be busy after put message")
+	}
+
+	// 模拟写入持有锁的时间超过OsPageCacheBusyTimeOutMills
+	beginTimeInLock := time.Now().UnixNano()/1000000 - master.MessageStoreConfig.OsPageCacheBusyTimeOutMills - 100
+	atomic.StoreInt64(&master.CommitLog.beginTimeInLock, beginTimeInLock)
+	if !master.IsOSPageCacheBusy() {
+		t.Fatal("page cache should be busy")
+	}
+
+	queueId := int32(0)
+	if result := master.PutMessage(buildMessage([]byte("busy"), &queueId)); result.PutMessageStatus != OS_PAGECACHE_BUSY {
+		t.Errorf("put message expect OS_PAGECACHE_BUSY, actual %s", result.PutMessageStatus.PutMessageString())
+	}
+
+	atomic.StoreInt64(&master.CommitLog.beginTimeInLock, 0)
+	if master.IsOSPageCacheBusy() {
+		t.Error("page cache should not be busy after unlock")
+	}
+}
@@ -0,0 +1,512 @@
+package stgstorelog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/message"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/heartbeat"
+	"git.oschina.net/cloudzone/smartgo/stgstorelog/mmap"
+)
+
+const (
+	compactionLogHeaderSize   = 8               // 文件头：已压缩到的逻辑队列offset
+	compactionItemTagsSize    = 8               // 每条记录前缀：tagsCode
+	messageQueueOffsetPostion = 20              // 消息中QUEUEOFFSET字段的位置(TOTALSIZE+MAGICCODE+BODYCRC+QUEUEID+FLAG)
+	compactionRewriteMinItems = 1024            // 文件中记录数超过该值且过半已被覆盖时才整体重写
+	compactionAppendBatchSize = 4 * 1024 * 1024 // 压缩时暂存的消息超过该大小即追加到文件，避免一次压缩占用过多内存
+)
+
+// compactedMessage 压缩日志中一条消息的索引，消息内容保存在压缩日志文件中
+// Since 2018/1/8
+type compactedMessage struct {
+	key         string // 消息的压缩Key
+	queueOffset int64  // 消息在逻辑队列中的offset
+	tagsCode    int64  // 消息过滤使用的tagsCode
+	position    int64  // 消息在压缩日志文件中的位置
+	size        int32  // 消息大小
+	data        []byte // 尚未追加到文件的消息内容，追加后置空
+}
+
+// CompactionLog 压缩Topic的单个队列压缩日志，每个Key只保留最新一条消息
+// 文件格式：compactedOffset(8) + [tagsCode(8) + 消息(CommitLog格式)]...
+// 每次压缩只追加新消息，同一Key的旧消息在加载时被覆盖，被覆盖的记录过多时才整体重写
+// 内存中只保存每个Key最新消息的索引，读取时从文件中读消息内容
+// Since 2018/1/8
+type CompactionLog struct {
+	topic           string
+	queueId         int32
+	fileName        string
+	compactedOffset int64               // 下一次从逻辑队列开始压缩的offset
+	messages        []*compactedMessage // 按queueOffset升序排列，发布后不再修改
+	fileItems       int                 // 文件中的记录数，包含已被覆盖的记录
+	rwLock          *sync.RWMutex
+}
+
+func NewCompactionLog(topic string, queueId int32, storePath string) *CompactionLog {
+	pathSeparator := GetPathSeparator()
+	return &CompactionLog{
+		topic:    topic,
+		queueId:  queueId,
+		fileName: storePath + pathSeparator + topic + pathSeparator + strconv.Itoa(int(queueId)),
+		rwLock:   new(sync.RWMutex),
+	}
+}
+
+// load 从磁盘加载压缩日志，文件不存在时视为空日志；文件损坏时返回false，不能用空日志覆盖
+// Since 2018/1/8
+func (self *CompactionLog) load() bool {
+	exist, err := PathExists(self.fileName)
+	if err != nil {
+		logger.Errorf("compaction log %s check exist error: %s", self.fileName, err.Error())
+		return false
+	}
+
+	if !exist {
+		return true
+	}
+
+	file, err := os.Open(self.fileName)
+	if err != nil {
+		logger.Errorf("compaction log %s open error: %s", self.fileName, err.Error())
+		return false
+	}
+	compactedOffset, items, validSize, ok, err := decodeCompactionLog(bufio.NewReader(file))
+	file.Close()
+	if err != nil {
+		logger.Errorf("compaction log %s read error: %s", self.fileName, err.Error())
+		return false
+	}
+	if !ok {
+		logger.Errorf("compaction log %s is corrupted at position %d, fix or remove it manually", self.fileName, validSize)
+		return false
+	}
+
+	fileInfo, err := os.Stat(self.fileName)
+	if err != nil {
+		logger.Errorf("compaction log %s stat error: %s", self.fileName, err.Error())
+		return false
+	}
+	if validSize < fileInfo.Size() {
+		// 追加记录时宕机，尾部记录不完整，文件头中的offset尚未更新，下次压缩会重新追加
+		logger.Warnf("compaction log %s truncate incomplete tail from %d to %d", self.fileName, fileInfo.Size(), validSize)
+		if err := os.Truncate(self.fileName, validSize); err != nil {
+			logger.Errorf("compaction log %s truncate error: %s", self.fileName, err.Error())
+			return false
+		}
+	}
+
+	messages := latestCompactedMessages(nil, items)
+
+	self.rwLock.Lock()
+	self.compactedOffset = compactedOffset
+	self.messages = messages
+	self.fileItems = len(items)
+	self.rwLock.Unlock()
+
+	logger.Infof("load compaction log %s-%d OK, messages: %d, compactedOffset: %d",
+		self.topic, self.queueId, len(messages), compactedOffset)
+	return true
+}
+
+// compact 将逻辑队列中[compactedOffset, maxOffset)范围的消息合并进压缩日志，
+// 新消息分批追加到文件末尾，被覆盖的记录过多时写临时文件再替换原文件
+// Since 2018/1/8
+func (self *CompactionLog) compact(consumeQueue *ConsumeQueue, commitLog *CommitLog) bool {
+	self.rwLock.RLock()
+	startOffset := self.compactedOffset
+	messages := self.messages
+	fileItems := self.fileItems
+	self.rwLock.RUnlock()
+
+	minOffset := consumeQueue.getMinOffsetInQueue()
+	maxOffset := consumeQueue.getMaxOffsetInQueue()
+	if startOffset < minOffset {
+		// 压缩开始前已被删除的消息无法找回
+		logger.Warnf("compaction log %s-%d compactedOffset %d less than minOffset %d, some messages lost",
+			self.topic, self.queueId, startOffset, minOffset)
+		startOffset = minOffset
+	}
+
+	if startOffset >= maxOffset {
+		return true
+	}
+
+	appended := make([]*compactedMessage, 0)
+	appendedSize := 0
+	flush := func(compactedOffset int64) bool {
+		// 本批扫描的消息也只需追加每个Key的最新一条
+		batch := latestCompactedMessages(nil, appended)
+		if !self.append(startOffset, compactedOffset, batch) {
+			return false
+		}
+
+		messages = latestCompactedMessages(messages, batch)
+		fileItems += len(batch)
+		appended, appendedSize = make([]*compactedMessage, 0), 0
+
+		self.rwLock.Lock()
+		self.compactedOffset = compactedOffset
+		self.messages = messages
+		self.fileItems = fileItems
+		self.rwLock.Unlock()
+		return true
+	}
+
+	offset := startOffset
+	for offset < maxOffset {
+		bufferConsumeQueue := consumeQueue.getIndexBuffer(offset)
+		if bufferConsumeQueue == nil {
+			offset = consumeQueue.rollNextFile(offset)
+			continue
+		}
+
+		i := 0
+		for ; int32(i) < bufferConsumeQueue.Size && offset+int64(i/CQStoreUnitSize) < maxOffset; i += CQStoreUnitSize {
+			offsetPy := bufferConsumeQueue.MappedByteBuffer.ReadInt64()
+			sizePy := bufferConsumeQueue.MappedByteBuffer.ReadInt32()
+			tagsCode := bufferConsumeQueue.MappedByteBuffer.ReadInt64()
+			if extUnit := consumeQueue.getExt(tagsCode); extUnit != nil {
+				tagsCode = extUnit.tagsCode
+			}
+
+			selectResult := commitLog.getMessage(offsetPy, sizePy)
+			if selectResult == nil {
+				continue
+			}
+
+			data := make([]byte, sizePy)
+			copy(data, selectResult.MappedByteBuffer.Bytes())
+			selectResult.Release()
+
+			if key := parseCompactionKey(data); key != "" {
+				appended = append(appended, &compactedMessage{
+					key:         key,
+					queueOffset: offset + int64(i/CQStoreUnitSize),
+					tagsCode:    tagsCode,
+					size:        sizePy,
+					data:        data,
+				})
+				appendedSize += len(data)
+			}
+		}
+
+		bufferConsumeQueue.Release()
+		offset += int64(i / CQStoreUnitSize)
+
+		if appendedSize >= compactionAppendBatchSize && !flush(offset) {
+			return false
+		}
+	}
+
+	if !flush(offset) {
+		return false
+	}
+
+	if fileItems > compactionRewriteMinItems && fileItems > 2*len(messages) {
+		return self.rewrite(offset, messages)
+	}
+	return true
+}
+
+// append 先追加新消息再更新文件头中的offset，宕机时最多重复追加，加载时按Key去重
+// 追加成功后记录消息在文件中的位置并释放消息内容
+// Since 2018/1/8
+func (self *CompactionLog) append(startOffset, compactedOffset int64, appended []*compactedMessage) bool {
+	if err := ensureDirOK(GetParentDirectory(self.fileName)); err != nil {
+		return false
+	}
+
+	file, err := os.OpenFile(self.fileName, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		logger.Errorf("compaction log %s open error: %s", self.fileName, err.Error())
+		return false
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		logger.Errorf("compaction log %s stat error: %s", self.fileName, err.Error())
+		return false
+	}
+
+	fileSize := fileInfo.Size()
+	if fileSize < compactionLogHeaderSize {
+		fileSize = compactionLogHeaderSize
+		if _, err := file.WriteAt(encodeCompactionLog(startOffset, nil), 0); err != nil {
+			logger.Errorf("compaction log %s write header error: %s", self.fileName, err.Error())
+			return false
+		}
+	}
+
+	if len(appended) > 0 {
+		data := encodeCompactionLog(compactedOffset, appended)[compactionLogHeaderSize:]
+		if _, err := file.WriteAt(data, fileSize); err != nil {
+			logger.Errorf("compaction log %s append error: %s", self.fileName, err.Error())
+			return false
+		}
+		if err := file.Sync(); err != nil {
+			logger.Errorf("compaction log %s sync error: %s", self.fileName, err.Error())
+			return false
+		}
+	}
+
+	if _, err := file.WriteAt(encodeCompactionLog(compactedOffset, nil), 0); err != nil {
+		logger.Errorf("compaction log %s write header error: %s", self.fileName, err.Error())
+		return false
+	}
+	if err := file.Sync(); err != nil {
+		logger.Errorf("compaction log %s sync error: %s", self.fileName, err.Error())
+		return false
+	}
+
+	position := fileSize
+	for _, msg := range appended {
+		msg.position = position + compactionItemTagsSize
+		msg.data = nil
+		position = msg.position + int64(msg.size)
+	}
+
+	return true
+}
+
+// rewrite 只保留每个Key的最新消息，从原文件逐条复制到临时文件后rename替换，保证压缩日志始终完整
+// 替换文件与更新消息位置在写锁内完成，读取消息时不会读到替换前的位置
+// Since 2018/1/8
+func (self *CompactionLog) rewrite(compactedOffset int64, messages []*compactedMessage) bool {
+	src, err := os.Open(self.fileName)
+	if err != nil {
+		logger.Errorf("compaction log %s open error: %s", self.fileName, err.Error())
+		return false
+	}
+	defer src.Close()
+
+	tmpFileName := self.fileName + ".tmp"
+	tmpFile, err := os.OpenFile(tmpFileName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		logger.Errorf("compaction log %s open error: %s", tmpFileName, err.Error())
+		return false
+	}
+	defer tmpFile.Close()
+
+	writer := bufio.NewWriter(tmpFile)
+	writer.Write(encodeCompactionLog(compactedOffset, nil))
+	rewritten := make([]*compactedMessage, 0, len(messages))
+	position := int64(compactionLogHeaderSize)
+	for _, msg := range messages {
+		data, err := msg.read(src)
+		if err != nil {
+			logger.Errorf("compaction log %s read message at %d error: %s", self.fileName, msg.position, err.Error())
+			return false
+		}
+
+		newMsg := *msg
+		newMsg.position = position + compactionItemTagsSize
+		newMsg.data = nil
+		position = newMsg.position + int64(newMsg.size)
+		rewritten = append(rewritten, &newMsg)
+
+		binary.Write(writer, binary.BigEndian, msg.tagsCode)
+		writer.Write(data)
+	}
+	if err := writer.Flush(); err != nil {
+		logger.Errorf("compaction log %s write error: %s", tmpFileName, err.Error())
+		return false
+	}
+	if err := tmpFile.Sync(); err != nil {
+		logger.Errorf("compaction log %s sync error: %s", tmpFileName, err.Error())
+		return false
+	}
+
+	self.rwLock.Lock()
+	defer self.rwLock.Unlock()
+	if err := os.Rename(tmpFileName, self.fileName); err != nil {
+		logger.Errorf("compaction log rename %s error: %s", tmpFileName, err.Error())
+		return false
+	}
+	self.messages = rewritten
+	self.fileItems = len(rewritten)
+
+	return true
+}
+
+// getMessage 从压缩日志中读取offset在[offset, maxQueueOffset)范围内的消息
+// Return: 命中的消息条数, 下一次拉取的offset
+// Since 2018/1/8
+func (self *CompactionLog) getMessage(offset, maxQueueOffset int64, maxMsgNums int32,
+	subscriptionData *heartbeat.SubscriptionData, store *DefaultMessageStore, getResult *GetMessageResult) (int, int64) {
+	self.rwLock.RLock()
+	defer self.rwLock.RUnlock()
+
+	count := 0
+	index := sort.Search(len(self.messages), func(i int) bool {
+		return self.messages[i].queueOffset >= offset
+	})
+	if index >= len(self.messages) || self.messages[index].queueOffset >= maxQueueOffset {
+		return count, maxQueueOffset
+	}
+
+	file, err := os.Open(self.fileName)
+	if err != nil {
+		logger.Errorf("compaction log %s open error: %s", self.fileName, err.Error())
+		return count, maxQueueOffset
+	}
+	defer file.Close()
+
+	for ; index < len(self.messages); index++ {
+		msg := self.messages[index]
+		if msg.queueOffset >= maxQueueOffset {
+			break
+		}
+
+		if store.isTheBatchFull(msg.size, maxMsgNums, int32(getResult.BufferTotalSize), int32(getResult.GetMessageCount()), false) {
+			return count, msg.queueOffset
+		}
+
+		if store.MessageFilter.IsMessageMatched(subscriptionData, msg.tagsCode) {
+			data, err := msg.read(file)
+			if err != nil {
+				logger.Errorf("compaction log %s read message at %d error: %s", self.fileName, msg.position, err.Error())
+				return count, msg.queueOffset
+			}
+
+			byteBuffer := NewMappedByteBuffer(mmap.MMap(data))
+			byteBuffer.WritePos = len(data)
+			getResult.addMessage(NewSelectMapedBufferResult(msg.queueOffset, byteBuffer, msg.size, nil))
+			count++
+		}
+	}
+
+	return count, maxQueueOffset
+}
+
+// read 从压缩日志文件中读取消息内容
+// Since 2018/1/8
+func (self *compactedMessage) read(file *os.File) ([]byte, error) {
+	data := make([]byte, self.size)
+	if _, err := file.ReadAt(data, self.position); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (self *CompactionLog) destroy() {
+	self.rwLock.Lock()
+	defer self.rwLock.Unlock()
+
+	self.messages = nil
+	self.compactedOffset = 0
+	self.fileItems = 0
+	if err := os.Remove(self.fileName); err != nil && !os.IsNotExist(err) {
+		logger.Errorf("compaction log %s delete error: %s", self.fileName, err.Error())
+	}
+}
+
+// parseCompactionKey 解析消息的压缩Key，即消息属性PROPERTY_KEYS，无Key的消息不参与压缩
+// Since 2018/1/8
+func parseCompactionKey(data []byte) string {
+	msgExt, err := message.DecodeMessageExt(data, false, false)
+	if err != nil {
+		logger.Warnf("compaction decode message error: %s", err.Error())
+		return ""
+	}
+
+	return msgExt.GetKeys()
+}
+
+// latestCompactedMessages 合并压缩日志中的消息与新消息，每个Key只保留queueOffset最大的一条
+// Since 2018/1/8
+func latestCompactedMessages(current, appended []*compactedMessage) []*compactedMessage {
+	latest := make(map[string]*compactedMessage, len(current)+len(appended))
+	for _, list := range [][]*compactedMessage{current, appended} {
+		for _, msg := range list {
+			if msg.key == "" {
+				continue
+			}
+			if old, ok := latest[msg.key]; !ok || old.queueOffset < msg.queueOffset {
+				latest[msg.key] = msg
+			}
+		}
+	}
+
+	messages := make([]*compactedMessage, 0, len(latest))
+	for _, msg := range latest {
+		messages = append(messages, msg)
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].queueOffset < messages[j].queueOffset
+	})
+
+	return messages
+}
+
+// encodeCompactionLog 编码文件头及尚未追加到文件的消息
+func encodeCompactionLog(compactedOffset int64, messages []*compactedMessage) []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, compactionLogHeaderSize))
+	binary.Write(buf, binary.BigEndian, compactedOffset)
+	for _, msg := range messages {
+		binary.Write(buf, binary.BigEndian, msg.tagsCode)
+		buf.Write(msg.data)
+	}
+
+	return buf.Bytes()
+}
+
+// decodeCompactionLog 逐条解析压缩日志，只保留消息的索引，尾部不完整的记录视为追加时宕机，不算损坏
+// Return: compactedOffset, 全部记录, 完整记录的结束位置, 是否完好（损坏时结束位置为损坏记录的起始位置）, 读文件错误
+// Since 2018/1/8
+func decodeCompactionLog(reader io.Reader) (int64, []*compactedMessage, int64, bool, error) {
+	header := make([]byte, compactionLogHeaderSize)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return 0, nil, 0, false, nil
+		}
+		return 0, nil, 0, false, err
+	}
+
+	compactedOffset := int64(binary.BigEndian.Uint64(header))
+	messages := make([]*compactedMessage, 0)
+
+	pos := int64(compactionLogHeaderSize)
+	prefix := make([]byte, compactionItemTagsSize+messageQueueOffsetPostion+8)
+	for {
+		if _, err := io.ReadFull(reader, prefix); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return compactedOffset, messages, pos, true, nil
+			}
+			return 0, nil, pos, false, err
+		}
+
+		msgPrefix := prefix[compactionItemTagsSize:]
+		totalSize := int(int32(binary.BigEndian.Uint32(msgPrefix[:4])))
+		magicCode := binary.BigEndian.Uint32(msgPrefix[4:8])
+		if totalSize <= messageQueueOffsetPostion+8 || magicCode != uint32(MessageMagicCode) {
+			return 0, nil, pos, false, nil
+		}
+
+		data := make([]byte, totalSize)
+		copy(data, msgPrefix)
+		if _, err := io.ReadFull(reader, data[len(msgPrefix):]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return compactedOffset, messages, pos, true, nil
+			}
+			return 0, nil, pos, false, err
+		}
+
+		messages = append(messages, &compactedMessage{
+			key:         parseCompactionKey(data),
+			queueOffset: int64(binary.BigEndian.Uint64(msgPrefix[messageQueueOffsetPostion : messageQueueOffsetPostion+8])),
+			tagsCode:    int64(binary.BigEndian.Uint64(prefix[:compactionItemTagsSize])),
+			position:    pos + compactionItemTagsSize,
+			size:        int32(totalSize),
+		})
+		pos += int64(compactionItemTagsSize + totalSize)
+	}
+}
@@ -0,0 +1,176 @@
+package stgstorelog
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/message"
+	"git.oschina.net/cloudzone/smartgo/stgstorelog/config"
+)
+
+type compactedTopicConfigFinder struct{}
+
+func (finder *compactedTopicConfigFinder) SelectTopicConfig(topic string) *stgcommon.TopicConfig {
+	topicConfig := stgcommon.NewTopicConfig(topic)
+	topicConfig.CleanupPolicy = stgcommon.CLEANUP_POLICY_COMPACT
+	return topicConfig
+}
+
+func putKeyMessage(messageStore *DefaultMessageStore, key string) {
+	queueId := int32(-1)
+	msg := buildMessage([]byte("value of "+key), &queueId)
+	msg.PutProperty(message.PROPERTY_KEYS, key)
+	msg.PropertiesString = message.MessageProperties2String(msg.Properties)
+	messageStore.PutMessage(msg)
+}
+
+func buildCompactedMessageStore(t *testing.T) *DefaultMessageStore {
+	QUEUE_TOTAL = 1
+	master := buildMessageStore()
+	master.TopicConfigFinder = &compactedTopicConfigFinder{}
+
+	// 5个Key各写4轮，每个Key最新的消息位于最后一轮
+	for round := 0; round < 4; round++ {
+		for i := 0; i < 5; i++ {
+			putKeyMessage(master, fmt.Sprintf("key-%d", i))
+		}
+	}
+	time.Sleep(time.Second)
+
+	if maxOffset := master.GetMaxOffsetInQueue("test", 0); maxOffset != 20 {
+		t.Fatalf("expect max offset 20, actual %d", maxOffset)
+	}
+	return master
+}
+
+func TestCompactionLog_KeepLatestPerKey(t *testing.T) {
+	master := buildCompactedMessageStore(t)
+	defer master.Destroy()
+	defer master.Shutdown()
+
+	master.CompactionService.run()
+	compactionLog := master.CompactionService.findCompactionLog("test", 0)
+	if compactionLog.compactedOffset != 20 || len(compactionLog.messages) != 5 {
+		t.Fatalf("expect compactedOffset 20 and 5 messages, actual %d %d", compactionLog.compactedOffset, len(compactionLog.messages))
+	}
+	for i, msg := range compactionLog.messages {
+		if msg.queueOffset != int64(15+i) || msg.key != fmt.Sprintf("key-%d", i) {
+			t.Errorf("expect latest message of key-%d at offset %d, actual %s %d", i, 15+i, msg.key, msg.queueOffset)
+		}
+		if msg.data != nil {
+			t.Errorf("message body of key-%d should not be kept in memory", i)
+		}
+	}
+
+	// 再写一轮后增量追加，重新加载时同一Key只保留最新一条
+	putKeyMessage(master, "key-0")
+	time.Sleep(time.Second)
+	master.CompactionService.run()
+	if compactionLog.fileItems != 6 {
+		t.Errorf("expect 6 items appended to file, actual %d", compactionLog.fileItems)
+	}
+
+	storePath := config.GetStorePathCompaction(master.MessageStoreConfig.StorePathRootDir)
+	reloaded := NewCompactionLog("test", 0, storePath)
+	if !reloaded.load() {
+		t.Fatal("reload compaction log failed")
+	}
+	if reloaded.compactedOffset != 21 || len(reloaded.messages) != 5 || reloaded.messages[4].queueOffset != 20 {
+		t.Fatalf("reload expect compactedOffset 21 and key-0 at offset 20, actual %d %d", reloaded.compactedOffset, len(reloaded.messages))
+	}
+}
+
+func TestCompactionLog_LoadCorrupted(t *testing.T) {
+	master := buildCompactedMessageStore(t)
+	defer master.Destroy()
+	defer master.Shutdown()
+
+	master.CompactionService.run()
+	compactionLog := master.CompactionService.findCompactionLog("test", 0)
+
+	data, err := ioutil.ReadFile(compactionLog.fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 尾部不完整的记录被截断，不算损坏
+	if err := ioutil.WriteFile(compactionLog.fileName, data[:len(data)-10], 0666); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := NewCompactionLog("test", 0, GetParentDirectory(GetParentDirectory(compactionLog.fileName)))
+	if !reloaded.load() || len(reloaded.messages) != 4 {
+		t.Fatalf("load compaction log with incomplete tail expect 4 messages, actual %d", len(reloaded.messages))
+	}
+
+	data[compactionLogHeaderSize+compactionItemTagsSize+4] ^= 0xFF
+	if err := ioutil.WriteFile(compactionLog.fileName, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if master.CompactionService.Load() {
+		t.Error("load corrupted compaction log should fail")
+	}
+}
+
+func TestDefaultMessageStore_GetMessageFromCompactionLog(t *testing.T) {
+	master := buildCompactedMessageStore(t)
+	defer master.Destroy()
+	defer master.Shutdown()
+
+	master.CompactionService.run()
+
+	// 重写后只保留每个Key的最新消息，消息内容从新文件中读取
+	compactionLog := master.CompactionService.findCompactionLog("test", 0)
+	if !compactionLog.rewrite(compactionLog.compactedOffset, compactionLog.messages) || compactionLog.fileItems != 5 {
+		t.Fatalf("rewrite compaction log failed, fileItems %d", compactionLog.fileItems)
+	}
+
+	// 模拟逻辑队列前18条已随物理文件删除，其中key-0至key-2的最新消息只能从压缩日志读取
+	consumeQueue := master.findConsumeQueue("test", 0)
+	consumeQueue.minLogicOffset = 18 * CQStoreUnitSize
+
+	result := master.GetMessage("group", "test", 0, 0, 32, nil)
+	defer result.Release()
+	if result.Status != FOUND || result.GetMessageCount() != 3 || result.NextBeginOffset != 18 {
+		t.Fatalf("expect 3 compacted messages and next offset 18, actual %d %d %d",
+			result.Status, result.GetMessageCount(), result.NextBeginOffset)
+	}
+	for i, element := 0, result.MessageMapedList.Front(); element != nil; i, element = i+1, element.Next() {
+		msgExt, err := message.DecodeMessageExt(element.Value.(*SelectMapedBufferResult).MappedByteBuffer.Bytes(), true, false)
+		if err != nil || msgExt.GetKeys() != fmt.Sprintf("key-%d", i) || msgExt.QueueOffset != int64(15+i) {
+			t.Errorf("expect compacted message of key-%d at offset %d, err: %v", i, 15+i, err)
+		}
+	}
+
+	result = master.GetMessage("group", "test", 0, 18, 32, nil)
+	defer result.Release()
+	if result.Status != FOUND || result.GetMessageCount() != 2 || result.NextBeginOffset != 20 {
+		t.Fatalf("expect 2 messages from consume queue and next offset 20, actual %d %d %d",
+			result.Status, result.GetMessageCount(), result.NextBeginOffset)
+	}
+}
+
+func TestCompactionService_GetMinUncompactedPhyOffset(t *testing.T) {
+	master := buildCompactedMessageStore(t)
+	defer master.Destroy()
+	defer master.Shutdown()
+
+	// 尚未压缩时CommitLog需从第一条消息开始保留
+	if phyOffset := master.CompactionService.getMinUncompactedPhyOffset(); phyOffset != 0 {
+		t.Fatalf("expect hold commit log from 0 before compaction, actual %d", phyOffset)
+	}
+
+	master.CompactionService.run()
+	if phyOffset := master.CompactionService.getMinUncompactedPhyOffset(); phyOffset != -1 {
+		t.Fatalf("expect no limit after compaction, actual %d", phyOffset)
+	}
+
+	maxPhyOffset := master.GetMaxPhyOffset()
+	putKeyMessage(master, "key-0")
+	time.Sleep(time.Second)
+	if phyOffset := master.CompactionService.getMinUncompactedPhyOffset(); phyOffset != maxPhyOffset {
+		t.Errorf("expect hold commit log from uncompacted message %d, actual %d", maxPhyOffset, phyOffset)
+	}
+}
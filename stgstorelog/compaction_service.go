@@ -0,0 +1,212 @@
+package stgstorelog
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/heartbeat"
+	"git.oschina.net/cloudzone/smartgo/stgstorelog/config"
+)
+
+// CompactionService 压缩Topic后台压缩服务，按CompactionInterval定期将cleanupPolicy=compact的Topic
+// 各队列消息合并进压缩日志
+// Since 2018/1/8
+type CompactionService struct {
+	defaultMessageStore *DefaultMessageStore
+	compactionLogTable  map[string]*CompactionLog
+	tableMu             *sync.RWMutex
+	compactMu           *sync.Mutex // 保证同一时刻只有一个压缩过程
+	stop                bool
+}
+
+func NewCompactionService(defaultMessageStore *DefaultMessageStore) *CompactionService {
+	return &CompactionService{
+		defaultMessageStore: defaultMessageStore,
+		compactionLogTable:  make(map[string]*CompactionLog),
+		tableMu:             new(sync.RWMutex),
+		compactMu:           new(sync.Mutex),
+	}
+}
+
+// Load 加载全部压缩日志，任一压缩日志损坏时加载失败，避免被空日志覆盖
+// Since 2018/1/8
+func (self *CompactionService) Load() bool {
+	storePath := config.GetStorePathCompaction(self.defaultMessageStore.MessageStoreConfig.StorePathRootDir)
+	topicDirs, err := ioutil.ReadDir(storePath)
+	if err != nil {
+		// 目录不存在说明还没有压缩过
+		return true
+	}
+
+	self.tableMu.Lock()
+	defer self.tableMu.Unlock()
+
+	for _, topicDir := range topicDirs {
+		if !topicDir.IsDir() {
+			continue
+		}
+
+		queueFiles, err := ioutil.ReadDir(storePath + GetPathSeparator() + topicDir.Name())
+		if err != nil {
+			logger.Errorf("compaction service read dir %s error: %s", topicDir.Name(), err.Error())
+			return false
+		}
+
+		for _, queueFile := range queueFiles {
+			if queueFile.IsDir() || strings.HasSuffix(queueFile.Name(), ".tmp") {
+				continue
+			}
+
+			queueId, err := strconv.Atoi(queueFile.Name())
+			if err != nil {
+				continue
+			}
+
+			compactionLog := NewCompactionLog(topicDir.Name(), int32(queueId), storePath)
+			if !compactionLog.load() {
+				return false
+			}
+			self.compactionLogTable[fmt.Sprintf("%s@%d", topicDir.Name(), queueId)] = compactionLog
+		}
+	}
+
+	return true
+}
+
+func (self *CompactionService) Start() {
+	logger.Info("compaction service started")
+
+	for {
+		if self.stop {
+			break
+		}
+
+		interval := self.defaultMessageStore.MessageStoreConfig.CompactionInterval
+		time.Sleep(time.Millisecond * time.Duration(interval))
+		self.run()
+	}
+}
+
+func (self *CompactionService) Shutdown() {
+	self.stop = true
+	logger.Info("compaction service end")
+}
+
+// run 压缩所有cleanupPolicy=compact的Topic
+// Since 2018/1/8
+func (self *CompactionService) run() {
+	self.compactMu.Lock()
+	defer self.compactMu.Unlock()
+
+	store := self.defaultMessageStore
+	for _, consumeQueue := range store.snapshotConsumeQueues() {
+		if !store.isCompactedTopic(consumeQueue.topic) {
+			continue
+		}
+
+		compactionLog := self.findCompactionLog(consumeQueue.topic, consumeQueue.queueId)
+		if compactionLog == nil {
+			logger.Errorf("compaction service skip %s-%d, compaction log can not be loaded", consumeQueue.topic, consumeQueue.queueId)
+			continue
+		}
+
+		if !compactionLog.compact(consumeQueue, store.CommitLog) {
+			logger.Warnf("compaction service compact %s-%d failed", consumeQueue.topic, consumeQueue.queueId)
+		}
+	}
+}
+
+// getMinUncompactedPhyOffset 压缩Topic各队列中尚未压缩的第一条消息的最小物理offset，
+// CommitLog只能删除该offset之前的文件，压缩日志损坏的队列从最小offset开始保留；没有未压缩的消息时返回-1
+// Since 2018/1/8
+func (self *CompactionService) getMinUncompactedPhyOffset() int64 {
+	store := self.defaultMessageStore
+	minPhyOffset := int64(-1)
+	for _, consumeQueue := range store.snapshotConsumeQueues() {
+		if !store.isCompactedTopic(consumeQueue.topic) {
+			continue
+		}
+
+		compactedOffset := int64(0)
+		if compactionLog := self.findCompactionLog(consumeQueue.topic, consumeQueue.queueId); compactionLog != nil {
+			compactionLog.rwLock.RLock()
+			compactedOffset = compactionLog.compactedOffset
+			compactionLog.rwLock.RUnlock()
+		}
+		if minOffset := consumeQueue.getMinOffsetInQueue(); compactedOffset < minOffset {
+			compactedOffset = minOffset
+		}
+		if compactedOffset >= consumeQueue.getMaxOffsetInQueue() {
+			continue
+		}
+
+		bufferConsumeQueue := consumeQueue.getIndexBuffer(compactedOffset)
+		if bufferConsumeQueue == nil {
+			continue
+		}
+		phyOffset := bufferConsumeQueue.MappedByteBuffer.ReadInt64()
+		bufferConsumeQueue.Release()
+
+		if minPhyOffset < 0 || phyOffset < minPhyOffset {
+			minPhyOffset = phyOffset
+		}
+	}
+
+	return minPhyOffset
+}
+
+// destroy 删除全部压缩日志
+// Since 2018/1/8
+func (self *CompactionService) destroy() {
+	self.tableMu.Lock()
+	defer self.tableMu.Unlock()
+
+	for key, compactionLog := range self.compactionLogTable {
+		compactionLog.destroy()
+		delete(self.compactionLogTable, key)
+	}
+}
+
+// getMessage 从压缩日志读取已被删除的消息，offset需小于逻辑队列最小offset
+// Since 2018/1/8
+func (self *CompactionService) getMessage(topic string, queueId int32, offset, minOffset int64, maxMsgNums int32,
+	subscriptionData *heartbeat.SubscriptionData, getResult *GetMessageResult) (int, int64) {
+	compactionLog := self.findCompactionLog(topic, queueId)
+	if compactionLog == nil {
+		return 0, minOffset
+	}
+	return compactionLog.getMessage(offset, minOffset, maxMsgNums, subscriptionData, self.defaultMessageStore, getResult)
+}
+
+// findCompactionLog 查找压缩日志，不存在时从磁盘加载，压缩日志损坏时返回nil
+// Since 2018/1/8
+func (self *CompactionService) findCompactionLog(topic string, queueId int32) *CompactionLog {
+	key := fmt.Sprintf("%s@%d", topic, queueId)
+
+	self.tableMu.RLock()
+	compactionLog, ok := self.compactionLogTable[key]
+	self.tableMu.RUnlock()
+	if ok {
+		return compactionLog
+	}
+
+	self.tableMu.Lock()
+	defer self.tableMu.Unlock()
+	if compactionLog, ok = self.compactionLogTable[key]; ok {
+		return compactionLog
+	}
+
+	storePath := config.GetStorePathCompaction(self.defaultMessageStore.MessageStoreConfig.StorePathRootDir)
+	compactionLog = NewCompactionLog(topic, queueId, storePath)
+	if !compactionLog.load() {
+		return nil
+	}
+	self.compactionLogTable[key] = compactionLog
+
+	return compactionLog
+}
@@ -9,10 +9,18 @@ func GetStorePathConsumeQueue(rootDir string) string {
 	return rootDir + filepath.FromSlash(string(os.PathSeparator)) + "consumequeue"
 }
 
+func GetStorePathConsumeQueueExt(rootDir string) string {
+	return rootDir + filepath.FromSlash(string(os.PathSeparator)) + "consumequeue_ext"
+}
+
 func GetStorePathIndex(rootDir string) string {
 	return rootDir + filepath.FromSlash(string(os.PathSeparator)) + "index"
 }
 
+func GetStorePathCompaction(rootDir string) string {
+	return rootDir + filepath.FromSlash(string(os.PathSeparator)) + "compaction"
+}
+
 func GetStoreCheckpoint(rootDir string) string {
 	return rootDir + filepath.FromSlash(string(os.PathSeparator)) + "checkpoint"
 }
@@ -8,7 +8,9 @@ import (
 	"time"
 
 	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/utils/timeutil"
 	"container/list"
+	"git.oschina.net/cloudzone/smartgo/stgstorelog/config"
 )
 
 // ConsumeQueue 消费队列实现
@@ -28,6 +30,17 @@ type ConsumeQueue struct {
 	mapedFileSize       int64                // 映射文件大小
 	maxPhysicOffset     int64                // 最后一个消息对应的物理Offset
 	minLogicOffset      int64                // 逻辑队列的最小Offset，删除物理文件时，计算出来的最小Offset
+	consumeQueueExt     *ConsumeQueueExt     // 消费队列扩展文件，未启用时为nil
+
+	// 按保留大小清理时使用：逻辑文件起始位置 -> 文件中已统计的消息大小
+	retentionBytesTable map[int64]*retentionBytesStat
+}
+
+// retentionBytesStat 单个逻辑文件中已统计的消息大小，写满的文件只统计一次，最后一个文件增量统计
+// Since: 2018/1/10
+type retentionBytesStat struct {
+	scannedOffset int64 // 已统计到的逻辑队列offset
+	totalBytes    int64 // 已统计消息的累计大小
 }
 
 func NewConsumeQueue(topic string, queueId int32, storePath string, mapedFileSize int64, defaultMessageStore *DefaultMessageStore) *ConsumeQueue {
@@ -39,6 +52,7 @@ func NewConsumeQueue(topic string, queueId int32, storePath string, mapedFileSiz
 	consumeQueue.defaultMessageStore = defaultMessageStore
 	consumeQueue.topic = topic
 	consumeQueue.queueId = queueId
+	consumeQueue.retentionBytesTable = make(map[int64]*retentionBytesStat)
 
 	pathSeparator := GetPathSeparator()
 
@@ -47,11 +61,20 @@ func NewConsumeQueue(topic string, queueId int32, storePath string, mapedFileSiz
 	consumeQueue.mapedFileQueue = NewMapedFileQueue(queueDir, mapedFileSize, nil)
 	consumeQueue.byteBufferIndex = NewMappedByteBuffer(make([]byte, CQStoreUnitSize))
 
+	storeConfig := defaultMessageStore.MessageStoreConfig
+	if storeConfig.EnableConsumeQueueExt {
+		consumeQueue.consumeQueueExt = NewConsumeQueueExt(topic, queueId,
+			config.GetStorePathConsumeQueueExt(storeConfig.StorePathRootDir), int64(storeConfig.MapedFileSizeConsumeQueueExt))
+	}
+
 	return consumeQueue
 }
 
 func (self *ConsumeQueue) load() bool {
 	result := self.mapedFileQueue.load()
+	if result && self.consumeQueueExt != nil {
+		result = self.consumeQueueExt.load()
+	}
 	resultMsg := "Failed"
 	if result {
 		resultMsg = "OK"
@@ -94,7 +117,10 @@ func (self *ConsumeQueue) correctMinOffset(phyMinOffset int64) {
 				result.MappedByteBuffer.ReadInt64()
 
 				if offsetPy >= phyMinOffset {
-					self.minLogicOffset = result.MapedFile.fileFromOffset + int64(i)
+					// Topic保留策略可能已将最小offset推进到更大的位置，不能回退
+					if minLogicOffset := result.MapedFile.fileFromOffset + int64(i); minLogicOffset > self.minLogicOffset {
+						self.minLogicOffset = minLogicOffset
+					}
 					//logger.Infof("compute logics min offset: %d, topic: %s, queueId: %d",
 					//	self.getMinOffsetInQueue(), self.topic, self.queueId)
 					break
@@ -119,6 +145,7 @@ func getMapedFileByIndex(mapedFiles *list.List, index int) *MapedFile {
 }
 
 func (self *ConsumeQueue) recover() {
+	maxExtAddr := int64(0)
 	mapedFiles := self.mapedFileQueue.mapedFiles
 	if mapedFiles.Len() > 0 {
 		index := mapedFiles.Len() - 3
@@ -157,6 +184,9 @@ func (self *ConsumeQueue) recover() {
 				if offset >= 0 && size > 0 {
 					mapedFileOffset = int64(i) + CQStoreUnitSize
 					self.maxPhysicOffset = offset
+					if isExtAddr(tagsCode) {
+						maxExtAddr = tagsCode
+					}
 				} else {
 					logger.Infof("recover current consume queue file over, %s %d %d %d ",
 						mapedFile.fileName, offset, size, tagsCode)
@@ -188,6 +218,13 @@ func (self *ConsumeQueue) recover() {
 		self.mapedFileQueue.truncateDirtyFiles(processOffset)
 
 	}
+
+	if self.consumeQueueExt != nil {
+		self.consumeQueueExt.recover()
+		if isExtAddr(maxExtAddr) {
+			self.consumeQueueExt.truncateByMaxAddress(maxExtAddr)
+		}
+	}
 }
 
 func (self *ConsumeQueue) getOffsetInQueueByTime(timestamp int64) int64 {
@@ -275,7 +312,16 @@ func (self *ConsumeQueue) getMaxOffsetInQueue() int64 {
 	return self.mapedFileQueue.getMaxOffset() / CQStoreUnitSize
 }
 
-func (self *ConsumeQueue) putMessagePostionInfoWrapper(offset, size, tagsCode, storeTimestamp, logicOffset int64) {
+func (self *ConsumeQueue) putMessagePostionInfoWrapper(offset, size, tagsCode, storeTimestamp, logicOffset int64, extUnit *CqExtUnit) {
+	// 启用扩展文件时，tagsCode槽位存放扩展单元地址，写入失败则仍存放tagsCode
+	if self.consumeQueueExt != nil && extUnit != nil && offset > self.maxPhysicOffset {
+		if address, ok := self.consumeQueueExt.put(extUnit); ok {
+			tagsCode = address
+		} else {
+			logger.Warnf("save consume queue extend failed, topic: %s queueId: %d offset: %d", self.topic, self.queueId, offset)
+		}
+	}
+
 	maxRetries := 5
 	//canWrite := self.defaultMessageStore.RunningFlags.isWriteable()
 	for i := 0; i < maxRetries; i++ {
@@ -351,7 +397,11 @@ func (self *ConsumeQueue) fillPreBlank(mapedFile *MapedFile, untilWhere int64) {
 }
 
 func (self *ConsumeQueue) commit(flushLeastPages int32) bool {
-	return self.mapedFileQueue.commit(flushLeastPages)
+	result := self.mapedFileQueue.commit(flushLeastPages)
+	if self.consumeQueueExt != nil {
+		result = self.consumeQueueExt.commit(flushLeastPages) && result
+	}
+	return result
 }
 
 func (self *ConsumeQueue) getLastOffset() int64 {
@@ -383,6 +433,12 @@ func (self *ConsumeQueue) getLastOffset() int64 {
 
 func (self *ConsumeQueue) truncateDirtyLogicFiles(phyOffet int64) {
 	logicFileSize := int(self.mapedFileSize)
+	maxExtAddr := int64(0)
+	defer func() {
+		if self.consumeQueueExt != nil && isExtAddr(maxExtAddr) {
+			self.consumeQueueExt.truncateByMaxAddress(maxExtAddr)
+		}
+	}()
 
 	for {
 		mapedFile := self.mapedFileQueue.getLastMapedFile2()
@@ -394,7 +450,7 @@ func (self *ConsumeQueue) truncateDirtyLogicFiles(phyOffet int64) {
 			for i := 0; i < logicFileSize; i += CQStoreUnitSize {
 				offset := mappedBuyteBuffer.ReadInt64()
 				size := mappedBuyteBuffer.ReadInt32()
-				mappedBuyteBuffer.ReadInt64()
+				tagsCode := mappedBuyteBuffer.ReadInt64()
 
 				if 0 == i {
 					if offset >= phyOffet {
@@ -405,6 +461,9 @@ func (self *ConsumeQueue) truncateDirtyLogicFiles(phyOffet int64) {
 						mapedFile.wrotePostion = int64(pos)
 						mapedFile.committedPosition = int64(pos)
 						self.maxPhysicOffset = offset
+						if isExtAddr(tagsCode) {
+							maxExtAddr = tagsCode
+						}
 					}
 				} else {
 					if offset >= 0 && size > 0 {
@@ -416,6 +475,9 @@ func (self *ConsumeQueue) truncateDirtyLogicFiles(phyOffet int64) {
 						mapedFile.wrotePostion = int64(pos)
 						mapedFile.committedPosition = int64(pos)
 						self.maxPhysicOffset = offset
+						if isExtAddr(tagsCode) {
+							maxExtAddr = tagsCode
+						}
 
 						if pos == logicFileSize {
 							return
@@ -435,6 +497,9 @@ func (self *ConsumeQueue) destroy() {
 	self.maxPhysicOffset = -1
 	self.minLogicOffset = 0
 	self.mapedFileQueue.destroy()
+	if self.consumeQueueExt != nil {
+		self.consumeQueueExt.destroy()
+	}
 }
 
 func (self *ConsumeQueue) resetMsgStoreItemMemory(length int32) {
@@ -449,5 +514,186 @@ func (self *ConsumeQueue) resetMsgStoreItemMemory(length int32) {
 func (self *ConsumeQueue) deleteExpiredFile(offset int64) int {
 	count := self.mapedFileQueue.deleteExpiredFileByOffset(offset, CQStoreUnitSize)
 	self.correctMinOffset(offset)
+	self.deleteExpiredExtFile()
+	return count
+}
+
+// deleteExpiredExtFile 删除逻辑队列最小offset对应扩展单元之前的扩展文件
+// Since 2018/1/17
+func (self *ConsumeQueue) deleteExpiredExtFile() {
+	if self.consumeQueueExt == nil {
+		return
+	}
+
+	result := self.getIndexBuffer(self.getMinOffsetInQueue())
+	if result == nil {
+		return
+	}
+	defer result.Release()
+
+	result.MappedByteBuffer.ReadInt64()
+	result.MappedByteBuffer.ReadInt32()
+	tagsCode := result.MappedByteBuffer.ReadInt64()
+	if count := self.consumeQueueExt.truncateByMinAddress(tagsCode); count > 0 {
+		logger.Infof("delete expired consume queue extend %s-%d files: %d", self.topic, self.queueId, count)
+	}
+}
+
+// getExt 读取tagsCode槽位地址对应的扩展单元，未启用扩展文件或地址无效时返回nil
+// Since 2018/1/17
+func (self *ConsumeQueue) getExt(tagsCode int64) *CqExtUnit {
+	if self.consumeQueueExt == nil || !isExtAddr(tagsCode) {
+		return nil
+	}
+
+	return self.consumeQueueExt.get(tagsCode)
+}
+
+// deleteExpiredFileByRetention 根据Topic保留时间、保留大小推进逻辑队列最小offset，并删除过期的逻辑文件
+// Params: retentionHours 保留时间（单位小时），0表示不限制
+// Params: retentionBytes 保留大小（单位字节），0表示不限制
+// Return: 删除文件个数
+// Since: 2018/1/10
+func (self *ConsumeQueue) deleteExpiredFileByRetention(retentionHours int32, retentionBytes int64) int {
+	minOffset := self.getMinOffsetInQueue()
+	maxOffset := self.getMaxOffsetInQueue()
+	retentionMinOffset := minOffset
+
+	if retentionHours > 0 {
+		expiredTime := timeutil.CurrentTimeMillis() - int64(retentionHours)*60*60*1000
+		if offset := self.getRetentionMinOffsetByTime(expiredTime, maxOffset); offset > retentionMinOffset {
+			retentionMinOffset = offset
+		}
+	}
+
+	if retentionBytes > 0 {
+		if offset := self.getRetentionMinOffsetByBytes(retentionBytes, maxOffset); offset > retentionMinOffset {
+			retentionMinOffset = offset
+		}
+	}
+
+	if retentionMinOffset > minOffset {
+		self.minLogicOffset = retentionMinOffset * CQStoreUnitSize
+		logger.Infof("topic %s queueId %d retention advance min offset %d -> %d, retentionHours: %d, retentionBytes: %d",
+			self.topic, self.queueId, minOffset, retentionMinOffset, retentionHours, retentionBytes)
+	}
+
+	count := self.mapedFileQueue.deleteExpiredFileByLogicOffset(self.minLogicOffset)
+	self.deleteExpiredExtFile()
 	return count
 }
+
+// getRetentionMinOffsetByTime 获取第一条存储时间不早于expiredTime的消息offset
+// Since: 2018/1/10
+func (self *ConsumeQueue) getRetentionMinOffsetByTime(expiredTime, maxOffset int64) int64 {
+	if maxOffset <= 0 {
+		return 0
+	}
+
+	// getOffsetInQueueByTime返回最接近expiredTime的offset，需要跳过仍早于过期时间的消息
+	offset := self.getOffsetInQueueByTime(expiredTime)
+	for ; offset < maxOffset; offset++ {
+		storeTime := self.getStoreTimestamp(offset)
+		if storeTime < 0 || storeTime >= expiredTime {
+			break
+		}
+	}
+
+	return offset
+}
+
+// getRetentionMinOffsetByBytes 按逻辑文件边界计算保留大小的截止offset：从最早的文件开始，
+// 删除该文件后剩余消息仍不少于retentionBytes时，该文件的消息视为过期，最后一个文件不会过期
+// Since: 2018/1/10
+func (self *ConsumeQueue) getRetentionMinOffsetByBytes(retentionBytes, maxOffset int64) int64 {
+	mapedFiles := make([]*MapedFile, 0)
+	for _, mapedFile := range self.mapedFileQueue.copyMapedFiles(0) {
+		if mapedFile != nil {
+			mapedFiles = append(mapedFiles, mapedFile)
+		}
+	}
+
+	var totalBytes int64 = 0
+	fileBytes := make([]int64, len(mapedFiles))
+	retentionBytesTable := make(map[int64]*retentionBytesStat, len(mapedFiles))
+	for i, mapedFile := range mapedFiles {
+		stat, ok := self.retentionBytesTable[mapedFile.fileFromOffset]
+		if !ok {
+			stat = &retentionBytesStat{scannedOffset: mapedFile.fileFromOffset / CQStoreUnitSize}
+		}
+
+		// 只统计上次之后新增的消息
+		fileEndOffset := (mapedFile.fileFromOffset + mapedFile.fileSize) / CQStoreUnitSize
+		if fileEndOffset > maxOffset {
+			fileEndOffset = maxOffset
+		}
+		self.foreachUnit(stat.scannedOffset, fileEndOffset, func(offset, offsetPy int64, sizePy int32) bool {
+			stat.totalBytes += int64(sizePy)
+			stat.scannedOffset = offset + 1
+			return true
+		})
+
+		retentionBytesTable[mapedFile.fileFromOffset] = stat
+		fileBytes[i] = stat.totalBytes
+		totalBytes += stat.totalBytes
+	}
+	// 已删除文件的统计随之丢弃
+	self.retentionBytesTable = retentionBytesTable
+
+	var retentionMinOffset int64 = 0
+	for i := 0; i < len(mapedFiles)-1; i++ {
+		if totalBytes-fileBytes[i] < retentionBytes {
+			break
+		}
+
+		totalBytes -= fileBytes[i]
+		retentionMinOffset = (mapedFiles[i].fileFromOffset + mapedFiles[i].fileSize) / CQStoreUnitSize
+	}
+
+	return retentionMinOffset
+}
+
+// getStoreTimestamp 获取逻辑队列offset对应消息的存储时间，找不到返回-1
+// Since: 2018/1/10
+func (self *ConsumeQueue) getStoreTimestamp(offset int64) int64 {
+	result := self.getIndexBuffer(offset)
+	if result == nil {
+		return -1
+	}
+	defer result.Release()
+
+	phyOffset := result.MappedByteBuffer.ReadInt64()
+	size := result.MappedByteBuffer.ReadInt32()
+	return self.defaultMessageStore.CommitLog.pickupStoretimestamp(phyOffset, size)
+}
+
+// foreachUnit 遍历逻辑队列[from, to)范围内的存储单元，fn返回false时停止遍历
+// Since: 2018/1/10
+func (self *ConsumeQueue) foreachUnit(from, to int64, fn func(offset, offsetPy int64, sizePy int32) bool) {
+	offset := from
+	for offset < to {
+		bufferConsumeQueue := self.getIndexBuffer(offset)
+		if bufferConsumeQueue == nil {
+			offset = self.rollNextFile(offset)
+			continue
+		}
+
+		i := 0
+		for ; int32(i) < bufferConsumeQueue.Size && offset < to; i += CQStoreUnitSize {
+			offsetPy := bufferConsumeQueue.MappedByteBuffer.ReadInt64()
+			sizePy := bufferConsumeQueue.MappedByteBuffer.ReadInt32()
+			bufferConsumeQueue.MappedByteBuffer.ReadInt64()
+
+			if !fn(offset, offsetPy, sizePy) {
+				bufferConsumeQueue.Release()
+				return
+			}
+			offset++
+		}
+
+		bufferConsumeQueue.Release()
+		if i == 0 {
+			break
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package stgstorelog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strconv"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
+)
+
+const (
+	CqExtUnitHeaderSize = 2 + 8 + 8 + 2 + 2    // size + tagsCode + msgStoreTime + bitMapSize + tagsSize
+	CqExtUnitMaxSize    = math.MaxInt16        // 扩展单元最大长度
+	CqExtMaxAddress     = math.MinInt32 - 1    // 扩展单元地址上限，tagsCode槽位中不大于该值的数据为扩展单元地址
+	cqExtAddressBase    = int64(math.MinInt64) // 扩展文件offset加上该值作为扩展单元地址
+)
+
+// CqExtUnit 消费队列扩展单元，存储完整tag、存储时间与订阅组过滤位图
+// 格式：size(2) + tagsCode(8) + msgStoreTime(8) + bitMapSize(2) + tagsSize(2) + bitMap + tags
+// Since 2018/1/17
+type CqExtUnit struct {
+	size         int16
+	tagsCode     int64
+	msgStoreTime int64
+	filterBitMap []byte
+	tags         string
+}
+
+func NewCqExtUnit(tagsCode, msgStoreTime int64, filterBitMap []byte, tags string) *CqExtUnit {
+	return &CqExtUnit{
+		tagsCode:     tagsCode,
+		msgStoreTime: msgStoreTime,
+		filterBitMap: filterBitMap,
+		tags:         tags,
+	}
+}
+
+func (self *CqExtUnit) calcUnitSize() int {
+	return CqExtUnitHeaderSize + len(self.filterBitMap) + len(self.tags)
+}
+
+func (self *CqExtUnit) encode() []byte {
+	self.size = int16(self.calcUnitSize())
+
+	buf := bytes.NewBuffer(make([]byte, 0, self.size))
+	binary.Write(buf, binary.BigEndian, self.size)
+	binary.Write(buf, binary.BigEndian, self.tagsCode)
+	binary.Write(buf, binary.BigEndian, self.msgStoreTime)
+	binary.Write(buf, binary.BigEndian, int16(len(self.filterBitMap)))
+	binary.Write(buf, binary.BigEndian, int16(len(self.tags)))
+	buf.Write(self.filterBitMap)
+	buf.WriteString(self.tags)
+	return buf.Bytes()
+}
+
+func (self *CqExtUnit) decode(data []byte) bool {
+	if len(data) < CqExtUnitHeaderSize {
+		return false
+	}
+
+	self.size = int16(binary.BigEndian.Uint16(data[0:2]))
+	self.tagsCode = int64(binary.BigEndian.Uint64(data[2:10]))
+	self.msgStoreTime = int64(binary.BigEndian.Uint64(data[10:18]))
+	bitMapSize := int(binary.BigEndian.Uint16(data[18:20]))
+	tagsSize := int(binary.BigEndian.Uint16(data[20:22]))
+	if int(self.size) != CqExtUnitHeaderSize+bitMapSize+tagsSize || len(data) < int(self.size) {
+		return false
+	}
+
+	pos := CqExtUnitHeaderSize
+	self.filterBitMap = make([]byte, bitMapSize)
+	copy(self.filterBitMap, data[pos:pos+bitMapSize])
+	pos += bitMapSize
+	self.tags = string(data[pos : pos+tagsSize])
+	return true
+}
+
+// ConsumeQueueExt 消费队列扩展文件，与ConsumeQueue一一对应，存储单元长度不固定。
+// 启用后ConsumeQueue的tagsCode槽位存放扩展单元地址（见isExtAddr）
+// Since 2018/1/17
+type ConsumeQueueExt struct {
+	mapedFileQueue *MapedFileQueue
+	topic          string
+	queueId        int32
+	storePath      string
+	mapedFileSize  int64
+}
+
+func NewConsumeQueueExt(topic string, queueId int32, storePath string, mapedFileSize int64) *ConsumeQueueExt {
+	ext := new(ConsumeQueueExt)
+	ext.topic = topic
+	ext.queueId = queueId
+	ext.storePath = storePath
+	ext.mapedFileSize = mapedFileSize
+
+	pathSeparator := GetPathSeparator()
+	queueDir := storePath + pathSeparator + topic + pathSeparator + strconv.Itoa(int(queueId))
+	ext.mapedFileQueue = NewMapedFileQueue(queueDir, mapedFileSize, nil)
+	return ext
+}
+
+// isExtAddr tagsCode槽位的值是否为扩展单元地址，tag哈希值与定时消息投递时间都不会小于int32最小值
+// Since 2018/1/17
+func isExtAddr(tagsCode int64) bool {
+	return tagsCode <= CqExtMaxAddress
+}
+
+func decorateExtAddr(offset int64) int64 {
+	return offset + cqExtAddressBase
+}
+
+func unDecorateExtAddr(address int64) int64 {
+	return address - cqExtAddressBase
+}
+
+func (self *ConsumeQueueExt) load() bool {
+	result := self.mapedFileQueue.load()
+	resultMsg := "Failed"
+	if result {
+		resultMsg = "OK"
+	}
+
+	logger.Infof("load consume queue extend %s-%d %s", self.topic, self.queueId, resultMsg)
+	return result
+}
+
+// recover 扫描最后一个文件，确定写入位置
+// Since 2018/1/17
+func (self *ConsumeQueueExt) recover() {
+	mapedFile := self.mapedFileQueue.getLastMapedFile2()
+	if mapedFile == nil {
+		return
+	}
+
+	buf := mapedFile.mappedByteBuffer.MMapBuf
+	pos := int64(0)
+	for pos+CqExtUnitHeaderSize <= self.mapedFileSize {
+		size := int64(binary.BigEndian.Uint16(buf[pos : pos+2]))
+		unit := new(CqExtUnit)
+		if size <= 0 || pos+size > self.mapedFileSize || !unit.decode(buf[pos:pos+size]) {
+			break
+		}
+		pos += size
+	}
+
+	logger.Infof("recover consume queue extend %s-%d over, last maped file %s, position %d",
+		self.topic, self.queueId, mapedFile.fileName, pos)
+	self.mapedFileQueue.truncateDirtyFiles(mapedFile.fileFromOffset + pos)
+}
+
+// put 写入扩展单元
+// Return: 扩展单元地址，写入失败返回false
+// Since 2018/1/17
+func (self *ConsumeQueueExt) put(unit *CqExtUnit) (int64, bool) {
+	size := unit.calcUnitSize()
+	if size > CqExtUnitMaxSize {
+		logger.Warnf("consume queue extend %s-%d unit size %d exceed max size, tags: %s",
+			self.topic, self.queueId, size, unit.tags)
+		return 0, false
+	}
+
+	mapedFile, err := self.mapedFileQueue.getLastMapedFile(0)
+	if err != nil || mapedFile == nil {
+		logger.Errorf("consume queue extend %s-%d get last maped file failed", self.topic, self.queueId)
+		return 0, false
+	}
+
+	// 单元不跨文件，剩余空间不足时填充0，size为0表示文件结束
+	if remain := mapedFile.fileSize - mapedFile.wrotePostion; remain < int64(size) {
+		if !mapedFile.appendMessage(make([]byte, remain)) {
+			return 0, false
+		}
+
+		if mapedFile, err = self.mapedFileQueue.getLastMapedFile(0); err != nil || mapedFile == nil {
+			logger.Errorf("consume queue extend %s-%d create next maped file failed", self.topic, self.queueId)
+			return 0, false
+		}
+	}
+
+	offset := mapedFile.fileFromOffset + mapedFile.wrotePostion
+	if !mapedFile.appendMessage(unit.encode()) {
+		return 0, false
+	}
+
+	return decorateExtAddr(offset), true
+}
+
+// get 根据地址读取扩展单元，不存在时返回nil
+// Since 2018/1/17
+func (self *ConsumeQueueExt) get(address int64) *CqExtUnit {
+	if !isExtAddr(address) {
+		return nil
+	}
+
+	offset := unDecorateExtAddr(address)
+	mapedFile := self.mapedFileQueue.findMapedFileByOffset(offset, false)
+	if mapedFile == nil {
+		return nil
+	}
+
+	pos := offset % self.mapedFileSize
+	result := mapedFile.selectMapedBufferByPosAndSize(pos, CqExtUnitHeaderSize)
+	if result == nil {
+		return nil
+	}
+	size := result.MappedByteBuffer.ReadInt16()
+	result.Release()
+
+	if size < CqExtUnitHeaderSize {
+		return nil
+	}
+
+	result = mapedFile.selectMapedBufferByPosAndSize(pos, int32(size))
+	if result == nil {
+		return nil
+	}
+	defer result.Release()
+
+	unit := new(CqExtUnit)
+	if !unit.decode(result.MappedByteBuffer.Bytes()) {
+		logger.Warnf("consume queue extend %s-%d decode unit failed, address: %d", self.topic, self.queueId, address)
+		return nil
+	}
+
+	return unit
+}
+
+// truncateByMaxAddress 删除地址之后的脏数据，address为ConsumeQueue中最后一个有效的扩展单元地址
+// Since 2018/1/17
+func (self *ConsumeQueueExt) truncateByMaxAddress(address int64) {
+	unit := self.get(address)
+	if unit == nil {
+		logger.Warnf("consume queue extend %s-%d truncate by max address %d, but unit not found",
+			self.topic, self.queueId, address)
+		return
+	}
+
+	self.mapedFileQueue.truncateDirtyFiles(unDecorateExtAddr(address) + int64(unit.size))
+}
+
+// truncateByMinAddress 删除地址之前的过期文件
+// Return: 删除文件个数
+// Since 2018/1/17
+func (self *ConsumeQueueExt) truncateByMinAddress(address int64) int {
+	if !isExtAddr(address) {
+		return 0
+	}
+
+	return self.mapedFileQueue.deleteExpiredFileByLogicOffset(unDecorateExtAddr(address))
+}
+
+func (self *ConsumeQueueExt) commit(flushLeastPages int32) bool {
+	return self.mapedFileQueue.commit(flushLeastPages)
+}
+
+func (self *ConsumeQueueExt) destroy() {
+	self.mapedFileQueue.destroy()
+}
@@ -0,0 +1,80 @@
+package stgstorelog
+
+import (
+	"os"
+	"testing"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/heartbeat"
+	set "github.com/deckarep/golang-set"
+)
+
+func TestConsumeQueueExtPutAndGet(t *testing.T) {
+	storePath := "./unit_test_store/ConsumeQueueExtTest"
+	defer os.RemoveAll(storePath)
+
+	bloomFilter := NewBloomFilter(64)
+	ext := NewConsumeQueueExt("TestTopic", 0, storePath, 256)
+
+	addresses := make([]int64, 0)
+	for i := 0; i < 20; i++ {
+		bitMap := bloomFilter.newBitMap()
+		bloomFilter.setBits(bitMap, bloomFilter.bitPositions("GroupA"))
+		address, ok := ext.put(NewCqExtUnit(int64(i), int64(1000+i), bitMap, "TagA"))
+		if !ok {
+			t.Fatalf("put consume queue extend unit %d failed", i)
+		}
+		if !isExtAddr(address) {
+			t.Fatalf("address %d is not extend address", address)
+		}
+		addresses = append(addresses, address)
+	}
+
+	// 单元不跨文件，写满后滚动到下一个文件
+	if ext.mapedFileQueue.mapedFiles.Len() < 2 {
+		t.Errorf("consume queue extend should roll to next file, files: %d", ext.mapedFileQueue.mapedFiles.Len())
+	}
+
+	for i, address := range addresses {
+		unit := ext.get(address)
+		if unit == nil {
+			t.Fatalf("get consume queue extend unit %d failed", i)
+		}
+		if unit.tagsCode != int64(i) || unit.msgStoreTime != int64(1000+i) || unit.tags != "TagA" {
+			t.Errorf("consume queue extend unit %d error: %#v", i, unit)
+		}
+		if !bloomFilter.isHit(unit.filterBitMap, bloomFilter.bitPositions("GroupA")) {
+			t.Errorf("consume queue extend unit %d bit map should hit GroupA", i)
+		}
+	}
+
+	if isExtAddr(0) || isExtAddr(-1) || isExtAddr(int64(-2147483648)) {
+		t.Errorf("tags code should not be extend address")
+	}
+
+	ext.destroy()
+}
+
+func TestIsMessageMatchedByExt(t *testing.T) {
+	filter := new(DefaultMessageFilter)
+	bloomFilter := NewBloomFilter(64)
+
+	subscriptionData := &heartbeat.SubscriptionData{SubString: "TagA", TagsSet: set.NewSet("TagA"), CodeSet: set.NewSet()}
+	filterData := &ConsumerFilterData{ConsumerGroup: "GroupA", SubString: "TagA", TagsSet: set.NewSet("TagA"), BornTime: 100}
+
+	// 位图中没有该订阅组，且过滤条件在消息存储前已生效
+	unit := NewCqExtUnit(1, 200, bloomFilter.newBitMap(), "TagA")
+	if filter.IsMessageMatchedByExt(subscriptionData, filterData, bloomFilter, unit) {
+		t.Errorf("bit map not hit, expect not matched")
+	}
+
+	// 过滤条件在消息存储之后才生效，位图不可信，按完整tag过滤
+	unit.msgStoreTime = 50
+	if !filter.IsMessageMatchedByExt(subscriptionData, filterData, bloomFilter, unit) {
+		t.Errorf("bit map untrusted and tags matched, expect matched")
+	}
+
+	unit.tags = "TagB"
+	if filter.IsMessageMatchedByExt(subscriptionData, filterData, bloomFilter, unit) {
+		t.Errorf("tags not matched, expect not matched")
+	}
+}
@@ -0,0 +1,495 @@
+package stgstorelog
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/sysflag"
+)
+
+const (
+	RebuildStatusIdle    = "IDLE"
+	RebuildStatusRunning = "RUNNING"
+	RebuildStatusDone    = "DONE"
+	RebuildStatusFailed  = "FAILED"
+
+	rebuildMaxDiffSamples = 16 // 校验模式下最多保留的差异样例数
+)
+
+// rebuildRequest 重建请求，topic为空表示全部Topic，queueId小于0表示Topic的全部队列
+type rebuildRequest struct {
+	topic        string
+	queueId      int32
+	rebuildIndex bool
+	dryRun       bool
+}
+
+func (self *rebuildRequest) isTarget(topic string, queueId int32) bool {
+	if self.topic == "" {
+		return true
+	}
+
+	return self.topic == topic && (self.queueId < 0 || self.queueId == queueId)
+}
+
+func (self *rebuildRequest) String() string {
+	topic, queueId := self.topic, fmt.Sprintf("%d", self.queueId)
+	if topic == "" {
+		topic = "*"
+	}
+	if self.queueId < 0 {
+		queueId = "*"
+	}
+
+	return fmt.Sprintf("%s:%s", topic, queueId)
+}
+
+// ConsumeQueueRebuildService 根据CommitLog重建消费队列及索引文件。
+// 重建期间只暂停目标队列：分发到目标队列的请求先缓存，拉取目标队列返回CONSUME_QUEUE_REBUILDING，
+// 重建完成后按顺序补发缓存的请求；校验模式(dryRun)不修改任何文件，只统计逻辑队列与CommitLog的差异
+// Since 2018/1/19
+type ConsumeQueueRebuildService struct {
+	defaultMessageStore *DefaultMessageStore
+	running             int32
+
+	pauseMu              sync.RWMutex // 分发消息时持有读锁，暂停、恢复队列时持有写锁
+	pausedRequest        *rebuildRequest
+	pendingMu            sync.Mutex
+	pendingRequests      []*DispatchRequest // 暂停期间缓存的逻辑队列分发请求
+	pendingIndexRequests []*DispatchRequest // 重建索引期间缓存的索引请求
+
+	statsMu      sync.RWMutex
+	status       string
+	request      *rebuildRequest
+	beginOffset  int64
+	scanOffset   int64
+	maxOffset    int64
+	dispatchNums int64
+	corruptNums  int64
+	diffNums     int64
+	diffSamples  []string
+	beginTime    int64
+	endTime      int64
+	lastError    string
+}
+
+func NewConsumeQueueRebuildService(defaultMessageStore *DefaultMessageStore) *ConsumeQueueRebuildService {
+	return &ConsumeQueueRebuildService{
+		defaultMessageStore: defaultMessageStore,
+		status:              RebuildStatusIdle,
+	}
+}
+
+// start 异步执行重建，同一时刻只允许一个重建过程
+// Since 2018/1/19
+func (self *ConsumeQueueRebuildService) start(request *rebuildRequest) error {
+	if !atomic.CompareAndSwapInt32(&self.running, 0, 1) {
+		return fmt.Errorf("consume queue rebuild is running")
+	}
+
+	self.statsMu.Lock()
+	self.status = RebuildStatusRunning
+	self.request = request
+	self.beginOffset = self.defaultMessageStore.CommitLog.getMinOffset()
+	self.scanOffset = self.beginOffset
+	self.maxOffset = self.defaultMessageStore.CommitLog.getMaxOffset()
+	self.dispatchNums = 0
+	self.corruptNums = 0
+	self.diffNums = 0
+	self.diffSamples = nil
+	self.beginTime = time.Now().UnixNano() / 1000000
+	self.endTime = 0
+	self.lastError = ""
+	self.statsMu.Unlock()
+
+	go func() {
+		defer atomic.StoreInt32(&self.running, 0)
+		self.run(request)
+	}()
+
+	return nil
+}
+
+func (self *ConsumeQueueRebuildService) run(request *rebuildRequest) {
+	logger.Warnf("consume queue rebuild start, target: %s rebuildIndex: %t dryRun: %t",
+		request, request.rebuildIndex, request.dryRun)
+
+	var err error
+	if request.dryRun {
+		err = self.verify(request)
+	} else {
+		err = self.rebuild(request)
+	}
+
+	self.statsMu.Lock()
+	self.endTime = time.Now().UnixNano() / 1000000
+	if err != nil {
+		self.status = RebuildStatusFailed
+		self.lastError = err.Error()
+	} else {
+		self.status = RebuildStatusDone
+	}
+	self.statsMu.Unlock()
+
+	logger.Warnf("consume queue rebuild end, target: %s status: %s dispatchNums: %d diffNums: %d corruptNums: %d",
+		request, self.status, self.dispatchNums, self.diffNums, self.corruptNums)
+}
+
+// rebuild 暂停目标队列，删除目标逻辑队列(及索引)文件后，从CommitLog最小offset开始重新分发，
+// 暂停后写入的消息都会被缓存，因此只扫描到暂停时的CommitLog最大offset
+// Since 2018/1/19
+func (self *ConsumeQueueRebuildService) rebuild(request *rebuildRequest) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("consume queue rebuild panic: %v", e)
+			logger.Error(err)
+		}
+	}()
+
+	store := self.defaultMessageStore
+	self.pause(request)
+	scanEndOffset := store.CommitLog.getMaxOffset()
+	scannedOffset := int64(-1)
+	defer func() {
+		self.resume(scannedOffset)
+	}()
+
+	// 索引文件由所有Topic共享，在索引构建协程中清空，保证此前入队的索引请求已处理完
+	if request.rebuildIndex {
+		store.IndexService.waitBarrier(true)
+	}
+
+	targets := self.findConsumeQueues(request)
+	for _, consumeQueue := range targets {
+		consumeQueue.destroy()
+	}
+	logger.Infof("consume queue rebuild destroy %d consume queues, target: %s", len(targets), request)
+
+	scannedOffset = self.scan(scanEndOffset, func(dispatchRequest *DispatchRequest) {
+		if request.isTarget(dispatchRequest.topic, dispatchRequest.queueId) && isConsumeQueueDispatch(dispatchRequest) {
+			store.putMessagePostionInfo(dispatchRequest)
+			atomic.AddInt64(&self.dispatchNums, 1)
+		}
+
+		if request.rebuildIndex {
+			store.IndexService.putRequest(dispatchRequest)
+		}
+	})
+
+	for _, consumeQueue := range self.findConsumeQueues(request) {
+		consumeQueue.commit(0)
+	}
+
+	if request.rebuildIndex {
+		store.IndexService.waitBarrier(false)
+	}
+	store.StoreCheckpoint.flush()
+
+	return nil
+}
+
+// verify 校验模式，比较CommitLog中的消息与逻辑队列存储单元，只统计差异，不修改文件
+// Since 2018/1/19
+func (self *ConsumeQueueRebuildService) verify(request *rebuildRequest) error {
+	var (
+		endOffset   = self.defaultMessageStore.CommitLog.getMaxOffset()
+		expectedMax = make(map[*ConsumeQueue]int64)
+	)
+
+	self.scan(endOffset, func(dispatchRequest *DispatchRequest) {
+		if !request.isTarget(dispatchRequest.topic, dispatchRequest.queueId) || !isConsumeQueueDispatch(dispatchRequest) {
+			return
+		}
+
+		atomic.AddInt64(&self.dispatchNums, 1)
+		consumeQueue := self.lookupConsumeQueue(dispatchRequest.topic, dispatchRequest.queueId)
+		if consumeQueue == nil {
+			self.addDiff("%s-%d queue not found, offset: %d", dispatchRequest.topic, dispatchRequest.queueId,
+				dispatchRequest.consumeQueueOffset)
+			return
+		}
+
+		if dispatchRequest.consumeQueueOffset > expectedMax[consumeQueue] {
+			expectedMax[consumeQueue] = dispatchRequest.consumeQueueOffset
+		}
+		self.verifyUnit(consumeQueue, dispatchRequest)
+	})
+
+	// 逻辑队列中多出的存储单元，忽略校验开始后写入的消息
+	for _, consumeQueue := range self.findConsumeQueues(request) {
+		from, ok := expectedMax[consumeQueue]
+		if ok {
+			from++
+		} else {
+			from = consumeQueue.getMinOffsetInQueue()
+		}
+
+		extra := 0
+		consumeQueue.foreachUnit(from, consumeQueue.getMaxOffsetInQueue(), func(offset, offsetPy int64, sizePy int32) bool {
+			if offsetPy >= endOffset {
+				return false
+			}
+			extra++
+			return true
+		})
+
+		if extra > 0 {
+			self.addDiff("%s-%d has %d extra units from offset %d", consumeQueue.topic, consumeQueue.queueId, extra, from)
+		}
+	}
+
+	return nil
+}
+
+func (self *ConsumeQueueRebuildService) verifyUnit(consumeQueue *ConsumeQueue, dispatchRequest *DispatchRequest) {
+	// 已过期删除的存储单元不算差异
+	if dispatchRequest.consumeQueueOffset < consumeQueue.getMinOffsetInQueue() {
+		return
+	}
+
+	result := consumeQueue.getIndexBuffer(dispatchRequest.consumeQueueOffset)
+	if result == nil {
+		self.addDiff("%s-%d offset %d missing, expect phyOffset: %d", consumeQueue.topic, consumeQueue.queueId,
+			dispatchRequest.consumeQueueOffset, dispatchRequest.commitLogOffset)
+		return
+	}
+	defer result.Release()
+
+	offsetPy := result.MappedByteBuffer.ReadInt64()
+	sizePy := result.MappedByteBuffer.ReadInt32()
+	tagsCode := result.MappedByteBuffer.ReadInt64()
+
+	if offsetPy != dispatchRequest.commitLogOffset || int64(sizePy) != dispatchRequest.msgSize ||
+		(!isExtAddr(tagsCode) && tagsCode != dispatchRequest.tagsCode) {
+		self.addDiff("%s-%d offset %d expect (%d,%d,%d) actual (%d,%d,%d)", consumeQueue.topic, consumeQueue.queueId,
+			dispatchRequest.consumeQueueOffset, dispatchRequest.commitLogOffset, dispatchRequest.msgSize,
+			dispatchRequest.tagsCode, offsetPy, sizePy, tagsCode)
+	}
+}
+
+// scan 从CommitLog最小offset开始解析消息，扫描到endOffset为止
+// Return: 已扫描到的offset
+// Since 2018/1/19
+func (self *ConsumeQueueRebuildService) scan(endOffset int64, fn func(dispatchRequest *DispatchRequest)) int64 {
+	var (
+		commitLog = self.defaultMessageStore.CommitLog
+		checkCRC  = self.defaultMessageStore.MessageStoreConfig.CheckCRCOnRecover
+		offset    = commitLog.getMinOffset()
+	)
+
+	for offset < endOffset {
+		result := commitLog.getData(offset)
+		if result == nil {
+			break
+		}
+
+		offset = result.StartOffset
+		for readSize := int32(0); readSize < result.Size && offset < endOffset; {
+			dispatchRequest := commitLog.checkMessageAndReturnSize(result.MappedByteBuffer, checkCRC, checkCRC)
+			size := dispatchRequest.msgSize
+
+			if size > 0 {
+				fn(dispatchRequest)
+				offset += size
+				readSize += int32(size)
+			} else {
+				// 文件末尾空白或消息损坏，跳到下一个文件
+				if size < 0 {
+					atomic.AddInt64(&self.corruptNums, 1)
+					logger.Warnf("consume queue rebuild found corrupted message at %d, skip to next file", offset)
+				}
+				offset = commitLog.rollNextFile(offset)
+				readSize = result.Size
+			}
+		}
+		result.Release()
+
+		self.statsMu.Lock()
+		self.scanOffset = offset
+		self.maxOffset = endOffset
+		self.statsMu.Unlock()
+	}
+
+	return offset
+}
+
+// pause 暂停目标队列，返回时正在进行的分发已完成，后续分发请求被缓存
+// Since 2018/1/19
+func (self *ConsumeQueueRebuildService) pause(request *rebuildRequest) {
+	self.pauseMu.Lock()
+	defer self.pauseMu.Unlock()
+
+	self.pausedRequest = request
+}
+
+// resume 补发暂停期间缓存的请求并恢复目标队列，补发期间持有写锁，保证补发的请求先于新请求写入；
+// 位于scannedOffset之前的请求已由扫描重新分发，直接丢弃，避免重复的索引
+// Since 2018/1/19
+func (self *ConsumeQueueRebuildService) resume(scannedOffset int64) {
+	self.pauseMu.Lock()
+	defer self.pauseMu.Unlock()
+
+	self.pendingMu.Lock()
+	pendingRequests := filterUnscannedRequests(self.pendingRequests, scannedOffset)
+	pendingIndexRequests := filterUnscannedRequests(self.pendingIndexRequests, scannedOffset)
+	self.pendingRequests, self.pendingIndexRequests = nil, nil
+	self.pendingMu.Unlock()
+
+	for _, dispatchRequest := range pendingRequests {
+		self.defaultMessageStore.putMessagePostionInfo(dispatchRequest)
+	}
+	for _, dispatchRequest := range pendingIndexRequests {
+		self.defaultMessageStore.IndexService.putRequest(dispatchRequest)
+	}
+
+	logger.Infof("consume queue rebuild resume %s, pending requests: %d pending index requests: %d",
+		self.pausedRequest, len(pendingRequests), len(pendingIndexRequests))
+	self.pausedRequest = nil
+}
+
+// isPaused 队列是否正在重建
+// Since 2018/1/19
+func (self *ConsumeQueueRebuildService) isPaused(topic string, queueId int32) bool {
+	self.pauseMu.RLock()
+	defer self.pauseMu.RUnlock()
+
+	return self.pausedRequest != nil && self.pausedRequest.isTarget(topic, queueId)
+}
+
+// putMessagePostionInfo 分发消息到逻辑队列，目标队列重建期间缓存请求
+// Since 2018/1/19
+func (self *ConsumeQueueRebuildService) putMessagePostionInfo(dispatchRequest *DispatchRequest) {
+	self.pauseMu.RLock()
+	defer self.pauseMu.RUnlock()
+
+	if self.pausedRequest != nil && self.pausedRequest.isTarget(dispatchRequest.topic, dispatchRequest.queueId) {
+		self.pendingMu.Lock()
+		self.pendingRequests = append(self.pendingRequests, dispatchRequest)
+		self.pendingMu.Unlock()
+		return
+	}
+
+	self.defaultMessageStore.putMessagePostionInfo(dispatchRequest)
+}
+
+// putIndexRequest 分发消息到索引服务，重建索引期间缓存请求
+// Since 2018/1/19
+func (self *ConsumeQueueRebuildService) putIndexRequest(dispatchRequest *DispatchRequest) {
+	self.pauseMu.RLock()
+	defer self.pauseMu.RUnlock()
+
+	if self.pausedRequest != nil && self.pausedRequest.rebuildIndex {
+		self.pendingMu.Lock()
+		self.pendingIndexRequests = append(self.pendingIndexRequests, dispatchRequest)
+		self.pendingMu.Unlock()
+		return
+	}
+
+	self.defaultMessageStore.IndexService.putRequest(dispatchRequest)
+}
+
+// findConsumeQueues 查找已存在的目标逻辑队列
+// Since 2018/1/19
+func (self *ConsumeQueueRebuildService) findConsumeQueues(request *rebuildRequest) []*ConsumeQueue {
+	store := self.defaultMessageStore
+	store.consumeQueueTableMu.RLock()
+	defer store.consumeQueueTableMu.RUnlock()
+
+	var consumeQueues []*ConsumeQueue
+	for _, consumeQueueTable := range store.consumeTopicTable {
+		consumeQueueTable.consumeQueuesMu.RLock()
+		for _, consumeQueue := range consumeQueueTable.consumeQueues {
+			if request.isTarget(consumeQueue.topic, consumeQueue.queueId) {
+				consumeQueues = append(consumeQueues, consumeQueue)
+			}
+		}
+		consumeQueueTable.consumeQueuesMu.RUnlock()
+	}
+
+	return consumeQueues
+}
+
+// lookupConsumeQueue 查找逻辑队列，不存在时不创建
+// Since 2018/1/19
+func (self *ConsumeQueueRebuildService) lookupConsumeQueue(topic string, queueId int32) *ConsumeQueue {
+	store := self.defaultMessageStore
+	store.consumeQueueTableMu.RLock()
+	consumeQueueTable, ok := store.consumeTopicTable[topic]
+	store.consumeQueueTableMu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	consumeQueueTable.consumeQueuesMu.RLock()
+	defer consumeQueueTable.consumeQueuesMu.RUnlock()
+	return consumeQueueTable.consumeQueues[queueId]
+}
+
+func (self *ConsumeQueueRebuildService) addDiff(format string, args ...interface{}) {
+	diff := fmt.Sprintf(format, args...)
+	logger.Warnf("consume queue rebuild diff: %s", diff)
+
+	self.statsMu.Lock()
+	defer self.statsMu.Unlock()
+
+	self.diffNums++
+	if len(self.diffSamples) < rebuildMaxDiffSamples {
+		self.diffSamples = append(self.diffSamples, diff)
+	}
+}
+
+// buildRunningStats 重建进度，未执行过重建时只输出状态
+// Since 2018/1/19
+func (self *ConsumeQueueRebuildService) buildRunningStats(stats map[string]string) {
+	self.statsMu.RLock()
+	defer self.statsMu.RUnlock()
+
+	stats[stgcommon.CONSUME_QUEUE_REBUILD_STATUS.String()] = self.status
+	if self.request == nil {
+		return
+	}
+
+	progress := float64(100)
+	if total := self.maxOffset - self.beginOffset; total > 0 && self.scanOffset < self.maxOffset {
+		progress = float64(self.scanOffset-self.beginOffset) * 100 / float64(total)
+	}
+
+	endTime := self.endTime
+	if endTime == 0 {
+		endTime = time.Now().UnixNano() / 1000000
+	}
+
+	stats[stgcommon.CONSUME_QUEUE_REBUILD_TARGET.String()] = fmt.Sprintf("%s,rebuildIndex=%t,dryRun=%t",
+		self.request, self.request.rebuildIndex, self.request.dryRun)
+	stats[stgcommon.CONSUME_QUEUE_REBUILD_PROGRESS.String()] = fmt.Sprintf("%.2f%%,%d,%d",
+		progress, self.scanOffset, self.maxOffset)
+	stats[stgcommon.CONSUME_QUEUE_REBUILD_DISPATCH_NUMS.String()] = fmt.Sprintf("%d", atomic.LoadInt64(&self.dispatchNums))
+	stats[stgcommon.CONSUME_QUEUE_REBUILD_CORRUPT_NUMS.String()] = fmt.Sprintf("%d", atomic.LoadInt64(&self.corruptNums))
+	stats[stgcommon.CONSUME_QUEUE_REBUILD_DIFF_NUMS.String()] = fmt.Sprintf("%d", self.diffNums)
+	stats[stgcommon.CONSUME_QUEUE_REBUILD_DIFF_SAMPLES.String()] = strings.Join(self.diffSamples, ";")
+	stats[stgcommon.CONSUME_QUEUE_REBUILD_ELAPSED_TIME.String()] = fmt.Sprintf("%d", endTime-self.beginTime)
+	stats[stgcommon.CONSUME_QUEUE_REBUILD_ERROR.String()] = self.lastError
+}
+
+// filterUnscannedRequests 过滤出物理offset不小于scannedOffset的分发请求
+func filterUnscannedRequests(requests []*DispatchRequest, scannedOffset int64) []*DispatchRequest {
+	unscanned := make([]*DispatchRequest, 0, len(requests))
+	for _, dispatchRequest := range requests {
+		if dispatchRequest.commitLogOffset >= scannedOffset {
+			unscanned = append(unscanned, dispatchRequest)
+		}
+	}
+
+	return unscanned
+}
+
+// isConsumeQueueDispatch 只有非事务消息与已提交的事务消息写入逻辑队列
+func isConsumeQueueDispatch(dispatchRequest *DispatchRequest) bool {
+	tranType := sysflag.GetTransactionValue(int(dispatchRequest.sysFlag))
+	return tranType == sysflag.TransactionNotType || tranType == sysflag.TransactionCommitType
+}
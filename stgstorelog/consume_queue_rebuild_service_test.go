@@ -0,0 +1,110 @@
+package stgstorelog
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
+)
+
+func waitConsumeQueueRebuild(t *testing.T, master *DefaultMessageStore) map[string]string {
+	for i := 0; i < 100; i++ {
+		infoMap := master.GetRuntimeInfo()
+		if infoMap[stgcommon.CONSUME_QUEUE_REBUILD_STATUS.String()] != RebuildStatusRunning {
+			return infoMap
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	t.Fatal("wait consume queue rebuild timeout")
+	return nil
+}
+
+func TestDefaultMessageStore_RebuildConsumeQueue(t *testing.T) {
+	master := buildMessageStore()
+	defer master.Destroy()
+	defer master.Shutdown()
+
+	putMessage(master, 100)
+	maxOffset := master.GetMaxOffsetInQueue("test", 0)
+
+	if err := master.RebuildConsumeQueue("test", 0, true, false); err == nil {
+		t.Error("rebuild index of one topic should be refused")
+	}
+
+	if err := master.RebuildConsumeQueue("test", 0, false, true); err != nil {
+		t.Fatal(err)
+	}
+	infoMap := waitConsumeQueueRebuild(t, master)
+	if infoMap[stgcommon.CONSUME_QUEUE_REBUILD_DIFF_NUMS.String()] != "0" {
+		t.Errorf("dry run expect no diff, actual: %s", infoMap[stgcommon.CONSUME_QUEUE_REBUILD_DIFF_SAMPLES.String()])
+	}
+
+	master.findConsumeQueue("test", 0).destroy()
+	if err := master.RebuildConsumeQueue("test", 0, false, false); err != nil {
+		t.Fatal(err)
+	}
+	infoMap = waitConsumeQueueRebuild(t, master)
+	if infoMap[stgcommon.CONSUME_QUEUE_REBUILD_STATUS.String()] != RebuildStatusDone {
+		t.Fatalf("rebuild failed: %s", infoMap[stgcommon.CONSUME_QUEUE_REBUILD_ERROR.String()])
+	}
+
+	if actual := master.GetMaxOffsetInQueue("test", 0); actual != maxOffset {
+		t.Errorf("rebuild max offset expect %d, actual %d", maxOffset, actual)
+	}
+}
+
+func TestRebuildRequestIsTarget(t *testing.T) {
+	all := &rebuildRequest{queueId: -1}
+	topic := &rebuildRequest{topic: "TopicA", queueId: -1}
+	queue := &rebuildRequest{topic: "TopicA", queueId: 1}
+
+	if !all.isTarget("TopicB", 3) || !topic.isTarget("TopicA", 3) || topic.isTarget("TopicB", 3) {
+		t.Error("topic target mismatch")
+	}
+	if !queue.isTarget("TopicA", 1) || queue.isTarget("TopicA", 2) {
+		t.Error("queue target mismatch")
+	}
+}
+
+func TestDefaultMessageStore_RebuildWithPendingRequests(t *testing.T) {
+	QUEUE_TOTAL = 1
+	master := buildMessageStore()
+	defer master.Destroy()
+	defer master.Shutdown()
+
+	putMessage(master, 100)
+
+	// 暂停期间写入的消息被缓存，同时也位于重建扫描的范围内，补发时不能重复写入
+	request := &rebuildRequest{queueId: -1, rebuildIndex: true}
+	service := master.ConsumeQueueRebuildService
+	service.pause(request)
+	for i := 0; i < 10; i++ {
+		putKeyMessage(master, fmt.Sprintf("pending-%d", i))
+	}
+	time.Sleep(time.Second)
+	if len(service.pendingRequests) != 10 {
+		t.Fatalf("expect 10 pending requests, actual %d", len(service.pendingRequests))
+	}
+
+	if err := service.rebuild(request); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+
+	if maxOffset := master.GetMaxOffsetInQueue("test", 0); maxOffset != 110 {
+		t.Errorf("expect max offset 110 after rebuild, actual %d", maxOffset)
+	}
+
+	now := time.Now().UnixNano() / 1000000
+	for i := 0; i < 10; i++ {
+		result := master.QueryMessage("test", fmt.Sprintf("pending-%d", i), 32, 0, now+1000)
+		if len(result.MessageMapedList) != 1 {
+			t.Errorf("expect message pending-%d indexed once, actual %d", i, len(result.MessageMapedList))
+		}
+		for _, selectResult := range result.MessageMapedList {
+			selectResult.Release()
+		}
+	}
+}
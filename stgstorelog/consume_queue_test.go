@@ -0,0 +1,79 @@
+package stgstorelog
+
+import (
+	"testing"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
+)
+
+type retentionTopicConfigFinder struct {
+	retentionBytes int64
+}
+
+func (finder *retentionTopicConfigFinder) SelectTopicConfig(topic string) *stgcommon.TopicConfig {
+	topicConfig := stgcommon.NewTopicConfig(topic)
+	topicConfig.RetentionBytes = finder.retentionBytes
+	return topicConfig
+}
+
+func firstMessageSize(consumeQueue *ConsumeQueue) int64 {
+	var msgSize int64 = 0
+	consumeQueue.foreachUnit(consumeQueue.getMinOffsetInQueue(), consumeQueue.getMaxOffsetInQueue(), func(offset, offsetPy int64, sizePy int32) bool {
+		msgSize = int64(sizePy)
+		return false
+	})
+	return msgSize
+}
+
+func TestConsumeQueue_DeleteExpiredFileByRetentionBytes(t *testing.T) {
+	master := buildMessageStore()
+	defer master.Destroy()
+	defer master.Shutdown()
+
+	// 每个逻辑文件52条，120条消息分布在[0, 52) [52, 104) [104, 120)三个文件中
+	putMessage(master, 120)
+	consumeQueue := master.findConsumeQueue("test", 0)
+	unitsPerFile := consumeQueue.mapedFileSize / CQStoreUnitSize
+	retentionBytes := 30 * firstMessageSize(consumeQueue)
+
+	// 删除第1个文件后剩余68条不少于30条，删除第2个文件后只剩16条，因此只有第1个文件过期
+	consumeQueue.deleteExpiredFileByRetention(0, retentionBytes)
+	if minOffset := consumeQueue.getMinOffsetInQueue(); minOffset != unitsPerFile {
+		t.Fatalf("expect min offset %d, actual %d", unitsPerFile, minOffset)
+	}
+
+	// 最后一个文件增量统计，新增20条后第2个文件也过期
+	putMessage(master, 20)
+	consumeQueue.deleteExpiredFileByRetention(0, retentionBytes)
+	if minOffset := consumeQueue.getMinOffsetInQueue(); minOffset != 2*unitsPerFile {
+		t.Fatalf("expect min offset %d, actual %d", 2*unitsPerFile, minOffset)
+	}
+	if _, ok := consumeQueue.retentionBytesTable[0]; ok {
+		t.Error("statistics of deleted file should be dropped")
+	}
+
+	lastFileStat := consumeQueue.retentionBytesTable[2*unitsPerFile*CQStoreUnitSize]
+	if lastFileStat == nil || lastFileStat.scannedOffset != 140 || lastFileStat.totalBytes != 36*retentionBytes/30 {
+		t.Errorf("last file statistics mismatch: %v", lastFileStat)
+	}
+}
+
+func TestDefaultMessageStore_ReapplyRetentionOnLoad(t *testing.T) {
+	master := buildMessageStore()
+	putMessage(master, 120)
+	consumeQueue := master.findConsumeQueue("test", 0)
+	unitsPerFile := consumeQueue.mapedFileSize / CQStoreUnitSize
+	retentionBytes := 30 * firstMessageSize(consumeQueue)
+	master.Shutdown()
+
+	reloaded := NewDefaultMessageStore(buildMessageStoreConfig(), nil)
+	reloaded.TopicConfigFinder = &retentionTopicConfigFinder{retentionBytes: retentionBytes}
+	defer reloaded.Destroy()
+	if !reloaded.Load() {
+		t.Fatal("reload message store failed")
+	}
+
+	if minOffset := reloaded.GetMinOffsetInQueue("test", 0); minOffset != unitsPerFile {
+		t.Errorf("expect retention reapplied on load, min offset %d, actual %d", unitsPerFile, minOffset)
+	}
+}
@@ -13,7 +13,9 @@ import (
 	"io/ioutil"
 	"math"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -39,37 +41,46 @@ func NewConsumeQueueTable() *ConsumeQueueTable {
 // Author zhoufei
 // Since 2017/9/6
 type DefaultMessageStore struct {
-	MessageFilter            *DefaultMessageFilter // 消息过滤
-	MessageStoreConfig       *MessageStoreConfig   // 存储配置
-	CommitLog                *CommitLog
-	consumeTopicTable        map[string]*ConsumeQueueTable
-	consumeQueueTableMu      *sync.RWMutex
-	FlushConsumeQueueService *FlushConsumeQueueService // 逻辑队列刷盘服务
-	CleanCommitLogService    *CleanCommitLogService    // 清理物理文件服务
-	CleanConsumeQueueService *CleanConsumeQueueService // 清理逻辑文件服务
-	DispatchMessageService   *DispatchMessageService   // 分发消息索引服务
-	IndexService             *IndexService             // 消息索引服务
-	AllocateMapedFileService *AllocateMapedFileService // 从物理队列解析消息重新发送到逻辑队列
-	ReputMessageService      *ReputMessageService      // 从物理队列解析消息重新发送到逻辑队列
-	HAService                *HAService                // HA服务
-	ScheduleMessageService   *ScheduleMessageService   // 定时服务
-	TransactionStateService  *TransactionStateService  // 分布式事务服务
-	TransactionCheckExecuter *TransactionCheckExecuter // 事务回查接口
-	StoreStatsService        *StoreStatsService        // 运行时数据统计
-	RunningFlags             *RunningFlags             // 运行过程标志位
-	SystemClock              *stgcommon.SystemClock    // 优化获取时间性能，精度1ms
-	ShutdownFlag             bool                      // 存储服务是否启动
-	StoreCheckpoint          *StoreCheckpoint
-	BrokerStatsManager       *stats.BrokerStatsManager
-	storeTicker              *timeutil.Ticker
-	printTimes               int64
+	MessageFilter              *DefaultMessageFilter // 消息过滤
+	MessageStoreConfig         *MessageStoreConfig   // 存储配置
+	CommitLog                  *CommitLog
+	consumeTopicTable          map[string]*ConsumeQueueTable
+	consumeQueueTableMu        *sync.RWMutex
+	FlushConsumeQueueService   *FlushConsumeQueueService   // 逻辑队列刷盘服务
+	CleanCommitLogService      *CleanCommitLogService      // 清理物理文件服务
+	CleanConsumeQueueService   *CleanConsumeQueueService   // 清理逻辑文件服务
+	DispatchMessageService     *DispatchMessageService     // 分发消息索引服务
+	IndexService               *IndexService               // 消息索引服务
+	AllocateMapedFileService   *AllocateMapedFileService   // 预分配CommitLog文件服务
+	ReputMessageService        *ReputMessageService        // 从物理队列解析消息重新发送到逻辑队列
+	HAService                  *HAService                  // HA服务
+	ScheduleMessageService     *ScheduleMessageService     // 定时服务
+	TransactionStateService    *TransactionStateService    // 分布式事务服务
+	TransactionCheckExecuter   *TransactionCheckExecuter   // 事务回查接口
+	CompactionService          *CompactionService          // 压缩Topic服务
+	ConsumeQueueRebuildService *ConsumeQueueRebuildService // 逻辑队列及索引重建服务
+	PageCacheService           *PageCacheService           // page cache预读与锁定服务
+	TopicConfigFinder          TopicConfigFinder           // Topic配置查询，由broker注入
+	ConsumerFilterFinder       ConsumerFilterFinder        // 订阅组过滤条件查询，由broker注入
+	BloomFilter                *BloomFilter                // 消费队列扩展单元过滤位图
+	StoreStatsService          *StoreStatsService          // 运行时数据统计
+	RunningFlags               *RunningFlags               // 运行过程标志位
+	SystemClock                *stgcommon.SystemClock      // 优化获取时间性能，精度1ms
+	ShutdownFlag               bool                        // 存储服务是否启动
+	StoreCheckpoint            *StoreCheckpoint
+	BrokerStatsManager         *stats.BrokerStatsManager
+	storeTicker                *timeutil.Ticker
+	printTimes                 int64
+	snapshotRunning            int32 // 是否正在生成快照
+	haServiceErr               error // 创建HA服务失败的原因，Load时拒绝启动
 }
 
 func NewDefaultMessageStore(messageStoreConfig *MessageStoreConfig, brokerStatsManager *stats.BrokerStatsManager) *DefaultMessageStore {
 	ms := &DefaultMessageStore{}
 	// TODO MessageFilter、RunningFlags
 	ms.MessageFilter = new(DefaultMessageFilter)
-	ms.RunningFlags = new(RunningFlags)
+	ms.BloomFilter = NewBloomFilter(messageStoreConfig.BitMapLengthConsumeQueueExt)
+	ms.RunningFlags = NewRunningFlags()
 	ms.SystemClock = new(stgcommon.SystemClock)
 	ms.ShutdownFlag = true
 	ms.consumeQueueTableMu = new(sync.RWMutex)
@@ -79,16 +90,24 @@ func NewDefaultMessageStore(messageStoreConfig *MessageStoreConfig, brokerStatsM
 	ms.BrokerStatsManager = brokerStatsManager
 	ms.TransactionCheckExecuter = nil
 	ms.AllocateMapedFileService = nil
+	if messageStoreConfig.AllocateMapedFilePreNums > 0 {
+		ms.AllocateMapedFileService = NewAllocateMapedFileService(messageStoreConfig)
+	}
 	ms.consumeTopicTable = make(map[string]*ConsumeQueueTable)
 	ms.CommitLog = NewCommitLog(ms)
 	ms.CleanCommitLogService = NewCleanCommitLogService(ms)
 	ms.CleanConsumeQueueService = NewCleanConsumeQueueService(ms)
 	ms.StoreStatsService = NewStoreStatsService()
 	ms.IndexService = NewIndexService(ms)
-	ms.HAService = NewHAService(ms)
+	if ms.HAService, ms.haServiceErr = NewHAService(ms); ms.haServiceErr != nil {
+		logger.Errorf("create ha service failed: %s", ms.haServiceErr.Error())
+	}
 	ms.DispatchMessageService = NewDispatchMessageService(ms.MessageStoreConfig.PutMsgIndexHightWater, ms)
 	ms.TransactionStateService = NewTransactionStateService(ms)
 	ms.FlushConsumeQueueService = NewFlushConsumeQueueService(ms)
+	ms.CompactionService = NewCompactionService(ms)
+	ms.ConsumeQueueRebuildService = NewConsumeQueueRebuildService(ms)
+	ms.PageCacheService = NewPageCacheService(ms)
 
 	switch ms.MessageStoreConfig.BrokerRole {
 	case config.SLAVE:
@@ -127,6 +146,11 @@ func NewDefaultMessageStore(messageStoreConfig *MessageStoreConfig, brokerStatsM
 }
 
 func (self *DefaultMessageStore) Load() bool {
+	if self.haServiceErr != nil {
+		logger.Errorf("load message store failed, %s", self.haServiceErr.Error())
+		return false
+	}
+
 	result := true
 
 	var lastExitOk bool
@@ -149,6 +173,11 @@ func (self *DefaultMessageStore) Load() bool {
 	// load consume queue
 	self.loadConsumeQueue()
 
+	// load 压缩日志，损坏时拒绝启动
+	if self.CompactionService != nil {
+		result = result && self.CompactionService.Load()
+	}
+
 	// TODO load 事务模块
 	self.IndexService.Load(lastExitOk)
 
@@ -273,6 +302,10 @@ func (self *DefaultMessageStore) isTempFileExist() bool {
 }
 
 func (self *DefaultMessageStore) Start() error {
+	if self.haServiceErr != nil {
+		return fmt.Errorf("start message store failed, %s", self.haServiceErr.Error())
+	}
+
 	if self.FlushConsumeQueueService != nil {
 		go self.FlushConsumeQueueService.Start()
 	}
@@ -293,6 +326,10 @@ func (self *DefaultMessageStore) Start() error {
 	// transactionStateService
 	go self.TransactionStateService.Start()
 
+	if self.CompactionService != nil {
+		go self.CompactionService.Start()
+	}
+
 	// TODO haService
 	go self.HAService.Start()
 
@@ -357,6 +394,14 @@ func (self *DefaultMessageStore) Shutdown() {
 			self.HAService.Shutdown()
 		}
 
+		if self.CompactionService != nil {
+			self.CompactionService.Shutdown()
+		}
+
+		if self.PageCacheService != nil {
+			self.PageCacheService.Shutdown()
+		}
+
 		self.StoreStatsService.Shutdown()
 		self.DispatchMessageService.Shutdown()
 		self.IndexService.Shutdown()
@@ -386,6 +431,9 @@ func (self *DefaultMessageStore) Destroy() {
 	self.destroyLogics()
 	self.CommitLog.destroy()
 	self.IndexService.destroy()
+	if self.CompactionService != nil {
+		self.CompactionService.destroy()
+	}
 	self.deleteFile(config.GetAbortFile(self.MessageStoreConfig.StorePathRootDir))
 	self.deleteFile(config.GetStoreCheckpoint(self.MessageStoreConfig.StorePathRootDir))
 }
@@ -407,7 +455,8 @@ func (self *DefaultMessageStore) PutMessage(msg *MessageExtBrokerInner) *PutMess
 	if !self.RunningFlags.isWriteable() {
 		atomic.AddInt64(&self.printTimes, 1)
 		if self.printTimes%50000 == 0 {
-			logger.Warn("message store is not writeable, so putMessage is forbidden ", self.RunningFlags.flagBits)
+			logger.Warnf("message store is not writeable, so putMessage is forbidden, mode: %s flagBits: %d",
+				self.RunningFlags.getMode(), self.RunningFlags.getFlagBits())
 		}
 
 		return &PutMessageResult{PutMessageStatus: SERVICE_NOT_AVAILABLE}
@@ -427,11 +476,17 @@ func (self *DefaultMessageStore) PutMessage(msg *MessageExtBrokerInner) *PutMess
 		return &PutMessageResult{PutMessageStatus: MESSAGE_ILLEGAL}
 	}
 
-	beginTime := time.Now().UnixNano() / 1000000
+	// PageCache繁忙时快速失败，由客户端重试其他broker
+	if self.IsOSPageCacheBusy() {
+		return &PutMessageResult{PutMessageStatus: OS_PAGECACHE_BUSY}
+	}
+
+	begin := time.Now()
 	result := self.CommitLog.putMessage(msg)
 
 	// 性能数据统计以及更新存在服务状态
-	eclipseTime := time.Now().UnixNano()/1000000 - beginTime
+	latency := time.Since(begin)
+	eclipseTime := int64(latency / time.Millisecond)
 	if eclipseTime > 1000 {
 		logger.Warn("putMessage not in lock eclipse time(ms) ", eclipseTime)
 	}
@@ -439,6 +494,7 @@ func (self *DefaultMessageStore) PutMessage(msg *MessageExtBrokerInner) *PutMess
 	self.StoreStatsService.setPutMessageEntireTimeMax(eclipseTime)
 	size := self.StoreStatsService.getSinglePutMessageTopicTimesTotal(msg.Topic)
 	self.StoreStatsService.setSinglePutMessageTopicTimesTotal(msg.Topic, atomic.AddInt64(&size, 1))
+	self.StoreStatsService.recordPutMessage(msg.Topic, msg.QueueId, latency)
 
 	if nil == result || !result.isOk() {
 		atomic.AddInt64(&self.StoreStatsService.putMessageFailedTimes, 1)
@@ -448,13 +504,93 @@ func (self *DefaultMessageStore) PutMessage(msg *MessageExtBrokerInner) *PutMess
 }
 
 func (self *DefaultMessageStore) QueryMessage(topic string, key string, maxNum int32, begin int64, end int64) *QueryMessageResult {
-	queryMessageResult := new(QueryMessageResult)
+	query := func(lastQueryMsgTime int64) *QueryOffsetResult {
+		return self.IndexService.queryOffset(topic, key, maxNum, begin, lastQueryMsgTime)
+	}
+
+	matched := func(msgExt *message.MessageExt) bool {
+		if msgExt.Topic != topic {
+			return false
+		}
+
+		for _, msgKey := range strings.Split(msgExt.GetKeys(), message.KEY_SEPARATOR) {
+			if msgKey == key {
+				return true
+			}
+		}
+		return false
+	}
+
+	return self.queryMessageByIndex(query, matched, begin, end)
+}
+
+// QueryMessageByProperty 按Topic声明的索引属性查询消息
+// Since 2018/1/12
+func (self *DefaultMessageStore) QueryMessageByProperty(topic, propertyName, value string, maxNum int32, begin, end int64) *QueryMessageResult {
+	query := func(lastQueryMsgTime int64) *QueryOffsetResult {
+		return self.IndexService.queryOffsetByProperty(topic, propertyName, value, maxNum, begin, lastQueryMsgTime)
+	}
+
+	matched := func(msgExt *message.MessageExt) bool {
+		return msgExt.Topic == topic && msgExt.Properties[propertyName] == value
+	}
+
+	return self.queryMessageByIndex(query, matched, begin, end)
+}
+
+// queryMessageByIndex 通过索引查找消息，索引只保存key的哈希值，需读取消息校验以排除哈希冲突，
+// 若冲突占满了本次查询数量，则以命中条目中最早的索引时间-1作为结束时间再查询，最多重试3次；
+// 索引时间按秒截断且查询包含结束时间，用消息的存储时间缩小范围会重复查到相同的条目
+// Since 2018/1/12
+func (self *DefaultMessageStore) queryMessageByIndex(query func(lastQueryMsgTime int64) *QueryOffsetResult,
+	matched func(msgExt *message.MessageExt) bool, begin, end int64) *QueryMessageResult {
+	queryMessageResult := NewQueryMessageResult()
+
+	if !self.RunningFlags.isIndexWriteable() {
+		logger.Warnf("message store is in %s mode, index is not built any more, query result may be incomplete",
+			self.RunningFlags.getMode())
+	}
 
 	lastQueryMsgTime := end
 	for i := 0; i < 3; i++ {
-		queryOffsetResult := self.IndexService.queryOffset(topic, key, maxNum, begin, lastQueryMsgTime)
-		if queryOffsetResult != nil {
+		queryOffsetResult := query(lastQueryMsgTime)
+		if queryOffsetResult == nil || len(queryOffsetResult.phyOffsets) == 0 {
+			break
+		}
+
+		queryMessageResult.IndexLastUpdateTimestamp = queryOffsetResult.indexLastUpdateTimestamp
+		queryMessageResult.IndexLastUpdatePhyoffset = queryOffsetResult.indexLastUpdatePhyoffset
+
+		phyOffsets := queryOffsetResult.phyOffsets
+		sort.Slice(phyOffsets, func(i, j int) bool { return phyOffsets[i] < phyOffsets[j] })
+
+		for _, offset := range phyOffsets {
+			selectResult := self.SelectOneMessageByOffset(offset)
+			if selectResult == nil {
+				continue
+			}
+
+			msgExt, err := message.DecodeMessageExt(selectResult.MappedByteBuffer.Bytes(), false, false)
+			if err != nil {
+				logger.Warnf("query message decode error, offset: %d, %s", offset, err.Error())
+				selectResult.Release()
+				continue
+			}
+
+			if matched(msgExt) {
+				queryMessageResult.AddMessage(selectResult)
+			} else {
+				selectResult.Release()
+			}
+		}
 
+		// 命中的全部是哈希冲突时，跳过已查询过的条目继续向前查找
+		if queryMessageResult.BufferTotalSize > 0 || queryOffsetResult.minIndexTimestamp <= 0 {
+			break
+		}
+		lastQueryMsgTime = queryOffsetResult.minIndexTimestamp - 1
+		if lastQueryMsgTime+1000 <= begin {
+			break
 		}
 	}
 
@@ -482,6 +618,13 @@ func (self *DefaultMessageStore) GetMessage(group string, topic string, queueId
 
 	getResult := new(GetMessageResult)
 
+	// 逻辑队列正在重建，保持消费位置不变，稍后重试
+	if self.ConsumeQueueRebuildService.isPaused(topic, queueId) {
+		getResult.Status = CONSUME_QUEUE_REBUILDING
+		getResult.NextBeginOffset = offset
+		return getResult
+	}
+
 	consumeQueue := self.findConsumeQueue(topic, queueId)
 	if consumeQueue != nil {
 		minOffset = consumeQueue.getMinOffsetInQueue()
@@ -493,6 +636,15 @@ func (self *DefaultMessageStore) GetMessage(group string, topic string, queueId
 		} else if offset < minOffset {
 			status = OFFSET_TOO_SMALL
 			nextBeginOffset = minOffset
+
+			// 压缩Topic中已被删除的消息，从压缩日志中读取
+			if self.CompactionService != nil && self.isCompactedTopic(topic) {
+				count, nextOffset := self.CompactionService.getMessage(topic, queueId, offset, minOffset, maxMsgNums, subscriptionData, getResult)
+				if count > 0 {
+					status = FOUND
+					nextBeginOffset = nextOffset
+				}
+			}
 		} else if offset == maxOffset {
 			status = OFFSET_OVERFLOW_ONE
 			nextBeginOffset = offset
@@ -510,12 +662,16 @@ func (self *DefaultMessageStore) GetMessage(group string, topic string, queueId
 				defer bufferConsumeQueue.Release()
 				status = NO_MATCHED_MESSAGE
 				nextPhyFileStartOffset := int64(LongMinValue)
+				filterData := self.getConsumerFilter(group, topic, consumeQueue)
 				MaxFilterMessageCount := 16000
 
 				var (
 					i                         = 0
 					maxPhyOffsetPulling int64 = 0
 					diskFallRecorded          = false
+					expiredCount              = 0
+					ttlMillis                 = self.getMessageTtlMillis(topic)
+					now                       = self.Now()
 				)
 
 				for ; int32(i) < bufferConsumeQueue.Size && i < MaxFilterMessageCount; i += CQStoreUnitSize {
@@ -539,6 +695,10 @@ func (self *DefaultMessageStore) GetMessage(group string, topic string, queueId
 
 					// 判断是否拉磁盘数据
 					isInDisk := self.checkInDiskByCommitOffset(offsetPy, self.CommitLog.MapedFileQueue.getMaxOffset())
+					// 消费落后需要读磁盘时，预读后续数据
+					if isInDisk && i == 0 {
+						self.PageCacheService.readAhead(consumeQueue, offset, offsetPy)
+					}
 					// 此批消息达到上限了
 					if self.isTheBatchFull(sizePy, maxMsgNums, int32(getResult.BufferTotalSize),
 						int32(getResult.GetMessageCount()), isInDisk) {
@@ -546,11 +706,16 @@ func (self *DefaultMessageStore) GetMessage(group string, topic string, queueId
 					}
 
 					// 消息过滤
-					if self.MessageFilter.IsMessageMatched(subscriptionData, tagsCode) {
+					if self.isMessageMatched(consumeQueue, subscriptionData, filterData, tagsCode) {
 						selectResult := self.CommitLog.getMessage(offsetPy, sizePy)
 
-						if selectResult != nil {
+						if selectResult != nil && isMessageExpired(selectResult.MappedByteBuffer.Bytes(), ttlMillis, now) {
+							// 过期消息直接跳过，消费进度随之前进，不会投递给消费者，也就不会进入重试队列和死信队列
+							selectResult.Release()
+							expiredCount++
+						} else if selectResult != nil {
 							atomic.AddInt64(&self.StoreStatsService.getMessageTransferedMsgCount, 1)
+							self.StoreStatsService.recordGetMessage(isInDisk)
 							getResult.addMessage(selectResult)
 							status = FOUND
 							nextPhyFileStartOffset = int64(LongMinValue)
@@ -580,9 +745,12 @@ func (self *DefaultMessageStore) GetMessage(group string, topic string, queueId
 
 				nextBeginOffset = offset + (int64(i) / CQStoreUnitSize)
 
-				diff := self.CommitLog.MapedFileQueue.getMaxOffset() - maxPhyOffsetPulling
-				memory := int64(TotalPhysicalMemorySize * (self.MessageStoreConfig.AccessMessageInMemoryMaxRatio / 100.0))
-				getResult.SuggestPullingFromSlave = diff > memory
+				if expiredCount > 0 && self.BrokerStatsManager != nil {
+					self.BrokerStatsManager.IncGroupGetExpired(group, topic, expiredCount)
+				}
+
+				// 拉取的消息已不在内存中，建议从slave拉取
+				getResult.SuggestPullingFromSlave = self.checkInDiskByCommitOffset(maxPhyOffsetPulling, self.CommitLog.MapedFileQueue.getMaxOffset())
 			} else {
 				status = OFFSET_FOUND_NULL
 				nextBeginOffset = consumeQueue.rollNextFile(offset)
@@ -618,7 +786,7 @@ func (self *DefaultMessageStore) GetMessage(group string, topic string, queueId
 }
 
 func (self *DefaultMessageStore) checkInDiskByCommitOffset(offsetPy, maxOffsetPy int64) bool {
-	memory := TotalPhysicalMemorySize * (float64(self.MessageStoreConfig.AccessMessageInMemoryMaxRatio) / 100.0)
+	memory := TotalPhysicalMemorySize * (float64(self.MessageStoreConfig.GetAccessMessageInMemoryMaxRatio()) / 100.0)
 	return (maxOffsetPy - offsetPy) > int64(memory)
 }
 
@@ -632,19 +800,19 @@ func (self *DefaultMessageStore) isTheBatchFull(sizePy, maxMsgNums, bufferTotal,
 	}
 
 	if isInDisk {
-		if (bufferTotal + sizePy) > self.MessageStoreConfig.MaxTransferBytesOnMessageInDisk {
+		if (bufferTotal + sizePy) > self.MessageStoreConfig.GetMaxTransferBytesOnMessageInDisk() {
 			return true
 		}
 
-		if (messageTotal + 1) > self.MessageStoreConfig.MaxTransferCountOnMessageInDisk {
+		if (messageTotal + 1) > self.MessageStoreConfig.GetMaxTransferCountOnMessageInDisk() {
 			return true
 		}
 	} else {
-		if (bufferTotal + sizePy) > self.MessageStoreConfig.MaxTransferBytesOnMessageInMemory {
+		if (bufferTotal + sizePy) > self.MessageStoreConfig.GetMaxTransferBytesOnMessageInMemory() {
 			return true
 		}
 
-		if (messageTotal + 1) > self.MessageStoreConfig.MaxTransferCountOnMessageInMemory {
+		if (messageTotal + 1) > self.MessageStoreConfig.GetMaxTransferCountOnMessageInMemory() {
 			return true
 		}
 	}
@@ -679,14 +847,72 @@ func (self *DefaultMessageStore) findConsumeQueue(topic string, queueId int32) *
 	return logic
 }
 
-func (self *DefaultMessageStore) putMessagePostionInfo(topic string, queueId int32, offset int64, size int64,
-	tagsCode, storeTimestamp, logicOffset int64) {
-	cq := self.findConsumeQueue(topic, queueId)
+func (self *DefaultMessageStore) putMessagePostionInfo(dispatchRequest *DispatchRequest) {
+	cq := self.findConsumeQueue(dispatchRequest.topic, dispatchRequest.queueId)
 	if cq != nil {
-		cq.putMessagePostionInfoWrapper(offset, size, tagsCode, storeTimestamp, logicOffset)
+		var extUnit *CqExtUnit
+		if cq.consumeQueueExt != nil {
+			tags := dispatchRequest.properties[message.PROPERTY_TAGS]
+			extUnit = NewCqExtUnit(dispatchRequest.tagsCode, dispatchRequest.storeTimestamp,
+				self.buildFilterBitMap(dispatchRequest.topic, tags), tags)
+		}
+
+		cq.putMessagePostionInfoWrapper(dispatchRequest.commitLogOffset, dispatchRequest.msgSize, dispatchRequest.tagsCode,
+			dispatchRequest.storeTimestamp, dispatchRequest.consumeQueueOffset, extUnit)
 	}
 }
 
+// buildFilterBitMap 计算消息匹配的订阅组，生成过滤位图；Topic没有订阅组时返回nil
+// Since 2018/1/17
+func (self *DefaultMessageStore) buildFilterBitMap(topic, tags string) []byte {
+	if self.ConsumerFilterFinder == nil {
+		return nil
+	}
+
+	filters := self.ConsumerFilterFinder.FindConsumerFilters(topic)
+	if len(filters) == 0 {
+		return nil
+	}
+
+	bitMap := self.BloomFilter.newBitMap()
+	for _, filterData := range filters {
+		if filterData.isTagsMatched(tags) {
+			self.BloomFilter.setBits(bitMap, self.BloomFilter.bitPositions(filterData.ConsumerGroup))
+		}
+	}
+
+	return bitMap
+}
+
+// getConsumerFilter 查询订阅组过滤条件，逻辑队列未启用扩展文件时不需要
+// Since 2018/1/17
+func (self *DefaultMessageStore) getConsumerFilter(group, topic string, consumeQueue *ConsumeQueue) *ConsumerFilterData {
+	if self.ConsumerFilterFinder == nil || consumeQueue.consumeQueueExt == nil {
+		return nil
+	}
+
+	return self.ConsumerFilterFinder.FindConsumerFilter(group, topic)
+}
+
+// isMessageMatched tagsCode槽位为扩展单元地址时，使用扩展单元过滤，不读取CommitLog
+// Since 2018/1/17
+func (self *DefaultMessageStore) isMessageMatched(consumeQueue *ConsumeQueue, subscriptionData *heartbeat.SubscriptionData,
+	filterData *ConsumerFilterData, tagsCode int64) bool {
+	if !isExtAddr(tagsCode) {
+		return self.MessageFilter.IsMessageMatched(subscriptionData, tagsCode)
+	}
+
+	extUnit := consumeQueue.getExt(tagsCode)
+	if extUnit == nil {
+		// 扩展单元已被删除或未启用扩展文件，无法在服务端过滤，由客户端过滤
+		logger.Warnf("consume queue extend unit not found, topic: %s queueId: %d address: %d",
+			consumeQueue.topic, consumeQueue.queueId, tagsCode)
+		return true
+	}
+
+	return self.MessageFilter.IsMessageMatchedByExt(subscriptionData, filterData, self.BloomFilter, extUnit)
+}
+
 // LookMessageByOffset 通过物理队列Offset，查询消息。 如果发生错误，则返回null
 // Author: zhoufei
 // Since: 2017/9/20
@@ -856,12 +1082,83 @@ func (self *DefaultMessageStore) GetRuntimeInfo() map[string]string {
 		self.ScheduleMessageService.buildRunningStats(result)
 	}
 
+	// 预分配文件耗时
+	if self.AllocateMapedFileService != nil {
+		self.AllocateMapedFileService.buildRunningStats(result)
+	}
+
+	// 逻辑队列重建进度
+	self.ConsumeQueueRebuildService.buildRunningStats(result)
+
 	result[stgcommon.COMMIT_LOG_MIN_OFFSET.String()] = fmt.Sprintf("%d", self.CommitLog.getMinOffset())
 	result[stgcommon.COMMIT_LOG_MAX_OFFSET.String()] = fmt.Sprintf("%d", self.CommitLog.getMaxOffset())
 
+	// 存储模式
+	result[stgcommon.STORE_MODE.String()] = self.RunningFlags.getMode().String()
+	result[stgcommon.STORE_MODE_FORCED.String()] = fmt.Sprintf("%t", self.RunningFlags.isForced())
+	result[stgcommon.STORE_RUNNING_FLAGS.String()] = fmt.Sprintf("%d", self.RunningFlags.getFlagBits())
+
 	return result
 }
 
+// GetStoreMode 获取当前存储模式
+// Since 2018/1/18
+func (self *DefaultMessageStore) GetStoreMode() StoreMode {
+	return self.RunningFlags.getMode()
+}
+
+// UpdateStoreMode 故障处理时强制指定或清除存储模式，返回变更后的模式
+// force 为true时强制进入mode，为false时清除强制的mode及导致该模式的错误标志位
+// Since 2018/1/18
+func (self *DefaultMessageStore) UpdateStoreMode(mode StoreMode, force bool) StoreMode {
+	var current StoreMode
+	if force {
+		current = self.RunningFlags.forceMode(mode)
+	} else {
+		current = self.RunningFlags.clearMode(mode)
+	}
+
+	logger.Infof("update store mode %s, force: %t, current mode: %s", mode, force, current)
+	return current
+}
+
+// RebuildConsumeQueue 根据CommitLog异步重建逻辑队列，进度通过GetRuntimeInfo查询
+// topic为空表示全部Topic，queueId小于0表示Topic的全部队列；
+// 索引文件由所有Topic共享，rebuildIndex只能在重建全部Topic时使用；
+// dryRun为true时不修改文件，只统计逻辑队列与CommitLog的差异
+// Since 2018/1/19
+func (self *DefaultMessageStore) RebuildConsumeQueue(topic string, queueId int32, rebuildIndex, dryRun bool) error {
+	if rebuildIndex && topic != "" {
+		return fmt.Errorf("index files are shared by all topics, rebuild index requires all topics")
+	}
+
+	if rebuildIndex && !self.MessageStoreConfig.MessageIndexEnable {
+		return fmt.Errorf("message index is disabled")
+	}
+
+	return self.ConsumeQueueRebuildService.start(&rebuildRequest{
+		topic:        topic,
+		queueId:      queueId,
+		rebuildIndex: rebuildIndex && !dryRun,
+		dryRun:       dryRun,
+	})
+}
+
+// GetCommitLogOffsetInQueue 获取队列中消息的物理offset，如果找不到对应消息，则返回-1
+// Since: 2018/2/1
+func (self *DefaultMessageStore) GetCommitLogOffsetInQueue(topic string, queueId int32, cqOffset int64) int64 {
+	logicQueue := self.findConsumeQueue(topic, queueId)
+	if logicQueue != nil {
+		result := logicQueue.getIndexBuffer(cqOffset)
+		if result != nil {
+			defer result.Release()
+			return result.MappedByteBuffer.ReadInt64()
+		}
+	}
+
+	return -1
+}
+
 // GetMessageStoreTimeStamp 获取队列中存储时间，如果找不到对应时间，则返回-1
 // Author: zhoufei
 // Since: 2017/9/21
@@ -887,7 +1184,8 @@ func (self *DefaultMessageStore) GetMessageStoreTimeStamp(topic string, queueId
 func (self *DefaultMessageStore) CleanExpiredConsumerQueue() {
 	minCommitLogOffset := self.CommitLog.getMinOffset()
 	for topic, queueTable := range self.consumeTopicTable {
-		if topic != SCHEDULE_TOPIC {
+		// 压缩Topic的逻辑队列需要保留offset，不能随物理文件一起清除
+		if topic != SCHEDULE_TOPIC && !self.isCompactedTopic(topic) {
 			for queueId, consumeQueue := range queueTable.consumeQueues {
 				maxCLOffsetInConsumeQueue := consumeQueue.getLastOffset()
 
@@ -903,6 +1201,7 @@ func (self *DefaultMessageStore) CleanExpiredConsumerQueue() {
 
 					consumeQueue.destroy()
 					delete(queueTable.consumeQueues, queueId)
+					self.PageCacheService.removeConsumeQueue(consumeQueue)
 				}
 			}
 
@@ -1039,6 +1338,7 @@ func (self *DefaultMessageStore) addScheduleTask() {
 	self.storeTicker = timeutil.NewTicker(true, 1000*60*time.Millisecond,
 		time.Duration(self.MessageStoreConfig.CleanResourceInterval)*time.Millisecond, func() {
 			self.cleanFilesPeriodically()
+			self.PageCacheService.lockLatestCommitLogFiles()
 		})
 
 	self.storeTicker.Start()
@@ -1062,8 +1362,52 @@ func (self *DefaultMessageStore) recoverTopicQueueTable() {
 			key := fmt.Sprintf("%s-%d", logic.topic, logic.queueId) // 恢复写入消息时，记录的队列offset
 			table[key] = logic.getMaxOffsetInQueue()
 			logic.correctMinOffset(minPhyOffset) // 恢复每个队列的最小offset
+
+			// Topic保留策略推进的最小offset没有持久化，重启后重新计算
+			if topicConfig := self.getTopicConfig(logic.topic); topicConfig.HasRetention() {
+				logic.deleteExpiredFileByRetention(topicConfig.RetentionHours, topicConfig.RetentionBytes)
+			}
 		}
 	}
 
 	self.CommitLog.TopicQueueTable = table
-}
\ No newline at end of file
+}
+
+// IsOSPageCacheBusy 写CommitLog持有锁的时间超过OsPageCacheBusyTimeOutMills，说明PageCache繁忙
+// Since 2018/1/25
+func (self *DefaultMessageStore) IsOSPageCacheBusy() bool {
+	busyTimeOutMills := self.MessageStoreConfig.GetOsPageCacheBusyTimeOutMills()
+	return busyTimeOutMills > 0 && self.CommitLog.lockTimeMills() > busyTimeOutMills
+}
+
+// getTopicConfig 查询Topic配置，未注入TopicConfigFinder时返回nil
+// Since 2018/1/8
+func (self *DefaultMessageStore) getTopicConfig(topic string) *stgcommon.TopicConfig {
+	if self.TopicConfigFinder == nil {
+		return nil
+	}
+
+	return self.TopicConfigFinder.SelectTopicConfig(topic)
+}
+
+// getMaxTopicRetentionHours 获取存储中所有Topic配置的最大保留时间（单位小时）
+// Since 2018/1/10
+func (self *DefaultMessageStore) getMaxTopicRetentionHours() int64 {
+	var maxRetentionHours int64 = 0
+	self.consumeQueueTableMu.RLock()
+	defer self.consumeQueueTableMu.RUnlock()
+
+	for topic := range self.consumeTopicTable {
+		if topicConfig := self.getTopicConfig(topic); topicConfig != nil && int64(topicConfig.RetentionHours) > maxRetentionHours {
+			maxRetentionHours = int64(topicConfig.RetentionHours)
+		}
+	}
+
+	return maxRetentionHours
+}
+
+// isCompactedTopic 是否为压缩Topic
+// Since 2018/1/8
+func (self *DefaultMessageStore) isCompactedTopic(topic string) bool {
+	return self.getTopicConfig(topic).IsCompacted()
+}
@@ -79,9 +79,7 @@ func (self *DispatchMessageService) doDispatch(dispatchRequest *DispatchRequest)
 	case sysflag.TransactionNotType:
 		fallthrough
 	case sysflag.TransactionCommitType:
-		self.defaultMessageStore.putMessagePostionInfo(dispatchRequest.topic, dispatchRequest.queueId,
-			dispatchRequest.commitLogOffset, dispatchRequest.msgSize, dispatchRequest.tagsCode,
-			dispatchRequest.storeTimestamp, dispatchRequest.consumeQueueOffset)
+		self.defaultMessageStore.ConsumeQueueRebuildService.putMessagePostionInfo(dispatchRequest)
 		break
 	case sysflag.TransactionPreparedType:
 		fallthrough
@@ -112,8 +110,8 @@ func (self *DispatchMessageService) doDispatch(dispatchRequest *DispatchRequest)
 		}
 	}
 
-	if self.defaultMessageStore.MessageStoreConfig.MessageIndexEnable {
-		self.defaultMessageStore.IndexService.putRequest(dispatchRequest)
+	if self.defaultMessageStore.MessageStoreConfig.MessageIndexEnable && self.defaultMessageStore.RunningFlags.isIndexWriteable() {
+		self.defaultMessageStore.ConsumeQueueRebuildService.putIndexRequest(dispatchRequest)
 	}
 }
 
@@ -13,4 +13,5 @@ type DispatchRequest struct {
 	preparedTransactionOffset int64
 	producerGroup             string
 	tranStateTableOffset      int64
+	properties                map[string]string // 消息属性，用于建立属性索引
 }
@@ -21,13 +21,13 @@ func NewFlushConsumeQueueService(defaultMessageStore *DefaultMessageStore) *Flus
 }
 
 func (self *FlushConsumeQueueService) doFlush(retryTimes int32) {
-	flushConsumeQueueLeastPages := self.defaultMessageStore.MessageStoreConfig.FlushConsumeQueueLeastPages
+	flushConsumeQueueLeastPages := self.defaultMessageStore.MessageStoreConfig.GetFlushConsumeQueueLeastPages()
 
 	if retryTimes == RetryTimesOver {
 		flushConsumeQueueLeastPages = 0
 	}
 
-	flushConsumeQueueThoroughInterval := self.defaultMessageStore.MessageStoreConfig.FlushConsumeQueueThoroughInterval
+	flushConsumeQueueThoroughInterval := self.defaultMessageStore.MessageStoreConfig.GetFlushConsumeQueueThoroughInterval()
 	currentTimeMillis := time.Now().UnixNano() / 1000000
 
 	var logicMsgTimestamp int64
@@ -68,7 +68,7 @@ func (self *FlushConsumeQueueService) Start() {
 			break
 		}
 
-		interval := self.defaultMessageStore.MessageStoreConfig.FlushIntervalConsumeQueue
+		interval := self.defaultMessageStore.MessageStoreConfig.GetFlushIntervalConsumeQueue()
 		time.Sleep(time.Millisecond * time.Duration(interval))
 		self.doFlush(1)
 	}
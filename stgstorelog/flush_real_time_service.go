@@ -43,9 +43,9 @@ func (self *FlushRealTimeService) start() {
 
 		var (
 			flushCommitLogTimed              = self.commitLog.DefaultMessageStore.MessageStoreConfig.FlushCommitLogTimed
-			interval                         = self.commitLog.DefaultMessageStore.MessageStoreConfig.FlushIntervalCommitLog
-			flushPhysicQueueLeastPages       = self.commitLog.DefaultMessageStore.MessageStoreConfig.FlushCommitLogLeastPages
-			flushPhysicQueueThoroughInterval = self.commitLog.DefaultMessageStore.MessageStoreConfig.FlushCommitLogThoroughInterval
+			interval                         = self.commitLog.DefaultMessageStore.MessageStoreConfig.GetFlushIntervalCommitLog()
+			flushPhysicQueueLeastPages       = self.commitLog.DefaultMessageStore.MessageStoreConfig.GetFlushCommitLogLeastPages()
+			flushPhysicQueueThoroughInterval = self.commitLog.DefaultMessageStore.MessageStoreConfig.GetFlushCommitLogThoroughInterval()
 			printFlushProgress               = false
 			currentTimeMillis                = time.Now().UnixNano() / 1000000
 		)
@@ -67,7 +67,12 @@ func (self *FlushRealTimeService) start() {
 			self.printFlushProgress()
 		}
 
+		committedWhere := self.commitLog.MapedFileQueue.committedWhere
+		begin := time.Now()
 		self.commitLog.MapedFileQueue.commit(flushPhysicQueueLeastPages)
+		if self.commitLog.MapedFileQueue.committedWhere != committedWhere {
+			self.commitLog.DefaultMessageStore.StoreStatsService.recordFlush(time.Since(begin))
+		}
 		storeTimestamp := self.commitLog.MapedFileQueue.storeTimestamp
 		if storeTimestamp > 0 {
 			self.commitLog.DefaultMessageStore.StoreCheckpoint.physicMsgTimestamp = storeTimestamp
@@ -24,6 +24,8 @@ const (
 	NO_MATCHED_LOGIC_QUEUE
 	// 队列中一条消息都没有
 	NO_MESSAGE_IN_QUEUE
+	// 逻辑队列正在重建，稍后重试
+	CONSUME_QUEUE_REBUILDING
 )
 
 func (self GetMessageStatus) String() string {
@@ -46,6 +48,8 @@ func (self GetMessageStatus) String() string {
 		return "NO_MATCHED_LOGIC_QUEUE"
 	case NO_MESSAGE_IN_QUEUE:
 		return "NO_MESSAGE_IN_QUEUE"
+	case CONSUME_QUEUE_REBUILDING:
+		return "CONSUME_QUEUE_REBUILDING"
 	default:
 		return ""
 	}
@@ -37,7 +37,9 @@ func (self *GroupCommitService) doCommit(request *GroupCommitRequest) {
 	for i := 0; i < 2 && !flushOk; i++ {
 		flushOk = self.commitLog.MapedFileQueue.committedWhere >= request.nextOffset
 		if !flushOk {
+			begin := time.Now()
 			self.commitLog.MapedFileQueue.commit(0)
+			self.commitLog.DefaultMessageStore.StoreStatsService.recordFlush(time.Since(begin))
 		}
 	}
 
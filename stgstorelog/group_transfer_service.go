@@ -1,67 +1,122 @@
 package stgstorelog
 
 import (
-	"sync/atomic"
-	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
-	"git.oschina.net/cloudzone/smartgo/stgcommon/sync"
+	"sync"
 	"time"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
 )
 
 // GroupTransferService 同步进度监听服务，如果达到应用层的写入偏移量，则通知应用层该同步已经完成。
+// 每次Slave应答或定时检查时，确认等待中的请求是否已被足够数量的Slave应答(InSyncReplicas)
 // Author zhoufei
 // Since 2017/10/18
 type GroupTransferService struct {
-	haService            *HAService
-	requestChan          chan *GroupCommitRequest
-	stopChan             chan bool
-	stoped               bool
-	notifyTransferObject *sync.Notify
-	requestsWrite        []*GroupCommitRequest
-	requestsRead         []*GroupCommitRequest
+	haService     *HAService
+	notifyChan    chan bool // Slave应答唤醒，容量为1，唤醒不阻塞Slave读线程
+	stopChan      chan bool
+	stoped        bool
+	requestsWrite []*transferRequest
+	requestsRead  []*transferRequest
+	requestMu     *sync.Mutex
+}
+
+// transferRequest 等待主从复制的请求
+// Since 2018/1/16
+type transferRequest struct {
+	request  *GroupCommitRequest
+	deadline int64 // 超时时间点（单位毫秒）
 }
 
 func NewGroupTransferService(haService *HAService) *GroupTransferService {
 	return &GroupTransferService{
-		requestChan:          make(chan *GroupCommitRequest, 100),
-		notifyTransferObject: sync.NewNotify(),
+		haService:     haService,
+		notifyChan:    make(chan bool, 1),
+		stopChan:      make(chan bool, 1),
+		requestsWrite: make([]*transferRequest, 0),
+		requestsRead:  make([]*transferRequest, 0),
+		requestMu:     new(sync.Mutex),
 	}
 }
 
 func (self *GroupTransferService) putRequest(request *GroupCommitRequest) {
-	self.requestChan <- request
+	timeout := int64(self.haService.defaultMessageStore.MessageStoreConfig.GetSyncFlushTimeout())
+
+	self.requestMu.Lock()
+	self.requestsWrite = append(self.requestsWrite, &transferRequest{
+		request:  request,
+		deadline: time.Now().UnixNano()/1000000 + timeout,
+	})
+	self.requestMu.Unlock()
+
+	self.notifyTransferSome()
+}
+
+func (self *GroupTransferService) swapRequests() {
+	self.requestMu.Lock()
+	self.requestsRead = append(self.requestsRead, self.requestsWrite...)
+	self.requestsWrite = make([]*transferRequest, 0)
+	self.requestMu.Unlock()
 }
 
+// doWaitTransfer 唤醒已被足够Slave应答或已超时的请求，其余请求继续等待
+// Since 2018/1/16
 func (self *GroupTransferService) doWaitTransfer() {
-	select {
-	case request := <-self.requestChan:
-		transferOK := atomic.LoadInt64(&self.haService.push2SlaveMaxOffset) >= request.nextOffset
-		for i := 0; !transferOK && i < 5; i++ {
-			self.notifyTransferObject.WaitTimeout(1000 * time.Millisecond)
-			transferOK = atomic.LoadInt64(&self.haService.push2SlaveMaxOffset) >= request.nextOffset
+	if len(self.requestsRead) == 0 {
+		return
+	}
+
+	needAckNums := self.haService.needAckSlaveNums()
+	now := time.Now().UnixNano() / 1000000
+	waiting := self.requestsRead[:0]
+	for _, tr := range self.requestsRead {
+		ackNums := self.haService.ackedSlaveNums(tr.request.nextOffset)
+		if ackNums >= needAckNums {
+			tr.request.wakeupCustomer(true)
+			continue
 		}
 
-		if !transferOK {
-			logger.Warn("transfer message to slave timeout, ", request.nextOffset)
+		if now >= tr.deadline {
+			logger.Warnf("transfer message to slave timeout, offset: %d, acked slaves: %d, need: %d",
+				tr.request.nextOffset, ackNums, needAckNums)
+			tr.request.wakeupCustomer(false)
+			continue
 		}
 
-		request.wakeupCustomer(transferOK)
-	case <-self.stopChan:
-		self.stoped = true
-		close(self.requestChan)
-		close(self.stopChan)
+		waiting = append(waiting, tr)
 	}
+
+	self.requestsRead = waiting
 }
 
 func (self *GroupTransferService) notifyTransferSome() {
-	self.notifyTransferObject.Signal()
+	select {
+	case self.notifyChan <- true:
+	default:
+	}
 }
 
 func (self *GroupTransferService) start() {
+	logger.Info("group transfer service started")
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
 	for {
-		if self.stoped {
-			break
+		select {
+		case <-self.notifyChan:
+		case <-ticker.C:
+		case <-self.stopChan:
+			self.stoped = true
+			self.swapRequests()
+			for _, tr := range self.requestsRead {
+				tr.request.wakeupCustomer(false)
+			}
+			self.requestsRead = make([]*transferRequest, 0)
+			logger.Info("group transfer service end")
+			return
 		}
-		self.notifyTransferObject.Wait()
+
+		self.swapRequests()
 		self.doWaitTransfer()
 	}
 }
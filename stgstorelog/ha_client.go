@@ -16,7 +16,7 @@ import (
 type HAClient struct {
 	masterAddress         string        // 主节点IP:PORT
 	reportOffset          *bytes.Buffer // 向Master汇报Slave最大Offset
-	connection            *net.TCPConn
+	connection            net.Conn
 	lastWriteTimestamp    int64
 	currentReportedOffset int64
 	dispatchPosition      int32
@@ -86,7 +86,14 @@ func (self *HAClient) connectMaster() bool {
 			return false
 		}
 
-		self.connection = conn
+		tlsConn, err := self.haService.tlsContext.ClientConn(conn, address)
+		if err != nil {
+			logger.Error("ha client connect master tls handshake error:", err.Error())
+			conn.Close()
+			return false
+		}
+
+		self.connection = tlsConn
 		self.currentReportedOffset = self.haService.defaultMessageStore.GetMaxPhyOffset()
 	}
 
@@ -10,7 +10,7 @@ import (
 // Since 2017/10/19
 type HAConnection struct {
 	haService          *HAService
-	connection         *net.TCPConn
+	connection         net.Conn
 	clientAddress      string
 	writeSocketService *WriteSocketService
 	readSocketService  *ReadSocketService
@@ -18,7 +18,7 @@ type HAConnection struct {
 	slaveAckOffset     int64 // Slave收到数据后，应答Offset
 }
 
-func NewHAConnection(haService *HAService, connection *net.TCPConn) *HAConnection {
+func NewHAConnection(haService *HAService, connection net.Conn) *HAConnection {
 	haConn := new(HAConnection)
 	haConn.haService = haService
 	haConn.connection = connection
@@ -2,8 +2,11 @@ package stgstorelog
 
 import (
 	"container/list"
+	"fmt"
 	"sync"
 	"sync/atomic"
+
+	"git.oschina.net/cloudzone/smartgo/stgnet/netm"
 )
 
 // HAService HA高可用服务
@@ -19,21 +22,33 @@ type HAService struct {
 	push2SlaveMaxOffset  int64                           // 写入到Slave的最大Offset
 	groupTransferService *GroupTransferService           // 主从复制通知服务
 	haClient             *HAClient                       // Slave订阅对象
+	slaveAckOffsetTable  map[*HAConnection]int64         // 各Slave已应答的Offset
 	mutex                *sync.Mutex
+	tlsContext           *netm.TlsContext // 主从复制连接的TLS上下文，与broker使用相同的TLS配置
 }
 
-func NewHAService(defaultMessageStore *DefaultMessageStore) *HAService {
+// NewHAService 创建HA服务，TLS配置错误时返回error，由存储层在Load时拒绝启动
+func NewHAService(defaultMessageStore *DefaultMessageStore) (*HAService, error) {
 	service := new(HAService)
 	service.connectionCount = 0
 	service.connectionList = list.New()
 	service.connectionElements = make(map[*HAConnection]*list.Element)
 	service.defaultMessageStore = defaultMessageStore
 	service.push2SlaveMaxOffset = 0
+
+	tlsContext, err := netm.NewTlsContext(defaultMessageStore.MessageStoreConfig.TlsConfig)
+	if err != nil {
+		// 不允许降级为明文连接
+		return nil, fmt.Errorf("ha service create tls context error: %s", err.Error())
+	}
+	service.tlsContext = tlsContext
+
 	service.acceptSocketService = NewAcceptSocketService(defaultMessageStore.MessageStoreConfig.HaListenPort, service)
 	service.groupTransferService = NewGroupTransferService(service)
 	service.haClient = NewHAClient(service)
+	service.slaveAckOffsetTable = make(map[*HAConnection]int64)
 	service.mutex = new(sync.Mutex)
-	return service
+	return service, nil
 }
 
 func (self *HAService) destroyConnections() {
@@ -46,6 +61,8 @@ func (self *HAService) destroyConnections() {
 	}
 
 	self.connectionList = list.New()
+	self.connectionElements = make(map[*HAConnection]*list.Element)
+	self.slaveAckOffsetTable = make(map[*HAConnection]int64)
 }
 
 func (self *HAService) updateMasterAddress(newAddr string) {
@@ -64,15 +81,32 @@ func (self *HAService) addConnection(haConnection *HAConnection) {
 func (self *HAService) removeConnection(haConnection *HAConnection) {
 	self.mutex.Lock()
 	defer self.mutex.Unlock()
-	connElement := self.connectionElements[haConnection]
+	// 读写服务退出时都会移除连接
+	connElement, ok := self.connectionElements[haConnection]
+	if !ok {
+		return
+	}
+
 	self.connectionList.Remove(connElement)
+	delete(self.connectionElements, haConnection)
+	delete(self.slaveAckOffsetTable, haConnection)
 }
 
-func (self *HAService) notifyTransferSome(offset int64) {
+// notifyTransferSome Slave应答后记录该Slave的应答Offset，并唤醒等待复制的请求
+// Since 2018/1/16
+func (self *HAService) notifyTransferSome(haConnection *HAConnection, offset int64) {
+	self.mutex.Lock()
+	if _, ok := self.connectionElements[haConnection]; ok {
+		if offset > self.slaveAckOffsetTable[haConnection] {
+			self.slaveAckOffsetTable[haConnection] = offset
+		}
+	}
+	self.mutex.Unlock()
+	self.groupTransferService.notifyTransferSome()
+
 	for value := atomic.LoadInt64(&self.push2SlaveMaxOffset); offset > value; {
 		ok := atomic.CompareAndSwapInt64(&self.push2SlaveMaxOffset, value, offset)
 		if ok {
-			self.groupTransferService.notifyTransferSome()
 			break
 		} else {
 			value = atomic.LoadInt64(&self.push2SlaveMaxOffset)
@@ -80,13 +114,54 @@ func (self *HAService) notifyTransferSome(offset int64) {
 	}
 }
 
+// ackedSlaveNums 已应答到offset的Slave数量
+// Since 2018/1/16
+func (self *HAService) ackedSlaveNums(offset int64) int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	nums := 0
+	for _, ackOffset := range self.slaveAckOffsetTable {
+		if ackOffset >= offset {
+			nums++
+		}
+	}
+	return nums
+}
+
+// inSyncSlaveNums 与Master保持同步的Slave数量，落后不超过HaSlaveFallbehindMax的Slave视为同步
+// Since 2018/1/16
+func (self *HAService) inSyncSlaveNums(masterPutWhere int64) int {
+	fallbehindMax := int64(self.defaultMessageStore.MessageStoreConfig.GetHaSlaveFallbehindMax())
+	return self.ackedSlaveNums(masterPutWhere - fallbehindMax + 1)
+}
+
+// needAckSlaveNums 同步双写时消息需要被多少个Slave应答，InSyncReplicas包含Master自身
+// Since 2018/1/16
+func (self *HAService) needAckSlaveNums() int {
+	return int(self.defaultMessageStore.MessageStoreConfig.InSyncReplicas) - 1
+}
+
+// isSlaveOK 包含Master在内的同步副本数是否满足MinInSyncReplicas
+// Since 2018/1/16
+func (self *HAService) isSlaveOK(masterPutWhere int64) bool {
+	minInSyncReplicas := int(self.defaultMessageStore.MessageStoreConfig.MinInSyncReplicas)
+	return self.inSyncSlaveNums(masterPutWhere)+1 >= minInSyncReplicas
+}
+
+// putRequest 提交等待主从复制的请求
+// Since 2018/1/16
+func (self *HAService) putRequest(request *GroupCommitRequest) {
+	self.groupTransferService.putRequest(request)
+}
+
 func (self *HAService) Start() {
 	go func() {
 		self.acceptSocketService.start()
 	}()
 
 	go func() {
-		// self.groupTransferService.start()
+		self.groupTransferService.start()
 	}()
 
 	go func() {
@@ -98,5 +173,5 @@ func (self *HAService) Shutdown() {
 	self.haClient.Shutdown()
 	self.acceptSocketService.Shutdown(true)
 	self.destroyConnections()
-	// TODO self.groupTransferService.Shutdown()
+	self.groupTransferService.shutdown()
 }
@@ -0,0 +1,99 @@
+package stgstorelog
+
+import (
+	"container/list"
+	"sync"
+	"testing"
+
+	"git.oschina.net/cloudzone/smartgo/stgnet/netm"
+)
+
+func newQuorumTestHAService(inSyncReplicas, minInSyncReplicas int32) *HAService {
+	config := NewMessageStoreConfig()
+	config.InSyncReplicas = inSyncReplicas
+	config.MinInSyncReplicas = minInSyncReplicas
+	config.SyncFlushTimeout = 1000
+
+	service := &HAService{
+		connectionList:      list.New(),
+		connectionElements:  make(map[*HAConnection]*list.Element),
+		defaultMessageStore: &DefaultMessageStore{MessageStoreConfig: config},
+		slaveAckOffsetTable: make(map[*HAConnection]int64),
+		mutex:               new(sync.Mutex),
+	}
+	service.groupTransferService = NewGroupTransferService(service)
+	return service
+}
+
+func TestHAServiceQuorum(t *testing.T) {
+	service := newQuorumTestHAService(3, 2)
+	slave1, slave2 := new(HAConnection), new(HAConnection)
+	service.addConnection(slave1)
+	service.addConnection(slave2)
+
+	if service.isSlaveOK(100) {
+		t.Errorf("no slave acked, expect slave not available")
+	}
+
+	service.notifyTransferSome(slave1, 100)
+	if !service.isSlaveOK(100) {
+		t.Errorf("one slave in sync, expect slave ok")
+	}
+
+	// 只有一个Slave应答，未满足InSyncReplicas
+	request := NewGroupCommitRequest(100)
+	service.groupTransferService.requestsRead = append(service.groupTransferService.requestsRead,
+		&transferRequest{request: request, deadline: 1 << 62})
+	service.groupTransferService.doWaitTransfer()
+	if len(service.groupTransferService.requestsRead) != 1 {
+		t.Fatalf("request should keep waiting, acked slaves: %d", service.ackedSlaveNums(100))
+	}
+
+	service.notifyTransferSome(slave2, 120)
+	service.groupTransferService.doWaitTransfer()
+	if !request.waitForFlush(1000) {
+		t.Errorf("two slaves acked, expect transfer ok")
+	}
+
+	// 断开的Slave不再计入副本数
+	service.removeConnection(slave2)
+	service.removeConnection(slave2)
+	if nums := service.ackedSlaveNums(100); nums != 1 {
+		t.Errorf("acked slave nums error, expect 1, actual %d", nums)
+	}
+}
+
+func TestGroupTransferServiceTimeout(t *testing.T) {
+	service := newQuorumTestHAService(2, 1)
+	request := NewGroupCommitRequest(100)
+	service.groupTransferService.requestsRead = append(service.groupTransferService.requestsRead,
+		&transferRequest{request: request, deadline: 0})
+	service.groupTransferService.doWaitTransfer()
+
+	if len(service.groupTransferService.requestsRead) != 0 {
+		t.Fatalf("timeout request should be removed")
+	}
+	if request.waitForFlush(1000) {
+		t.Errorf("no slave acked, expect transfer timeout")
+	}
+}
+
+func TestNewHAServiceInvalidTlsConfig(t *testing.T) {
+	config := NewMessageStoreConfig()
+	config.TlsConfig = &netm.TlsConfig{Mode: "enforcing", CertFile: "./not_exist.crt", KeyFile: "./not_exist.key"}
+
+	store := &DefaultMessageStore{MessageStoreConfig: config}
+	service, err := NewHAService(store)
+	if err == nil || service != nil {
+		t.Fatalf("create ha service with invalid tls config should fail")
+	}
+
+	// 存储层拒绝启动，不会panic
+	store.haServiceErr = err
+	if store.Load() {
+		t.Errorf("load message store should fail when ha service is not created")
+	}
+	if err := store.Start(); err == nil {
+		t.Errorf("start message store should fail when ha service is not created")
+	}
+}
@@ -1,6 +1,7 @@
 package stgstorelog
 
 import (
+	"encoding/binary"
 	"time"
 
 	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
@@ -48,6 +49,11 @@ func NewIndexFile(fileName string, hashSlotNum, indexNum int32, endPhyOffset, en
 		indexFile.indexHeader.setEndTimestamp(endTimestamp)
 	}
 
+	// 槽位值0表示无效索引，索引从1开始存放
+	if indexFile.indexHeader.indexCount <= 0 {
+		indexFile.indexHeader.indexCount = 1
+	}
+
 	return indexFile
 }
 
@@ -113,7 +119,7 @@ func (self *IndexFile) putKey(key string, phyOffset int64, storeTimestamp int64)
 
 		// 更新哈希槽
 		currentWritePos := self.mappedByteBuffer.WritePos
-		self.mappedByteBuffer.WritePos = int(absIndexPos)
+		self.mappedByteBuffer.WritePos = int(absSlotPos)
 		self.mappedByteBuffer.WriteInt32(self.indexHeader.indexCount)
 		self.mappedByteBuffer.WritePos = currentWritePos
 
@@ -134,6 +140,69 @@ func (self *IndexFile) putKey(key string, phyOffset int64, storeTimestamp int64)
 	return false
 }
 
+// isTimeMatched 索引文件的时间范围是否与[begin, end]有交集
+// Since 2018/1/12
+func (self *IndexFile) isTimeMatched(begin, end int64) bool {
+	beginTimestamp := self.indexHeader.beginTimestamp
+	endTimestamp := self.indexHeader.endTimestamp
+	if begin < beginTimestamp && end > endTimestamp {
+		return true
+	}
+
+	return (begin >= beginTimestamp && begin <= endTimestamp) || (end >= beginTimestamp && end <= endTimestamp)
+}
+
+// selectPhyOffset 沿哈希槽链表查找key对应的物理offset，直接读取映射内存，不修改共享的读写位置，
+// minTimeRead为命中条目中最早的索引时间，没有命中时不变
+// Since 2018/1/12
+func (self *IndexFile) selectPhyOffset(phyOffsets []int64, key string, maxNum int, begin, end int64, minTimeRead *int64) []int64 {
+	if !self.mapedFile.hold() {
+		return phyOffsets
+	}
+	defer self.mapedFile.release()
+
+	buf := self.mappedByteBuffer.MMapBuf
+	keyHash := self.indexKeyHashMethod(key)
+	slotPos := keyHash % self.hashSlotNum
+	absSlotPos := INDEX_HEADER_SIZE + slotPos*HASH_SLOT_SIZE
+
+	indexCount := self.indexHeader.indexCount
+	slotValue := int32(binary.BigEndian.Uint32(buf[absSlotPos : absSlotPos+HASH_SLOT_SIZE]))
+	if slotValue <= INVALID_INDEX || slotValue > indexCount || indexCount <= 1 {
+		return phyOffsets
+	}
+
+	for nextIndexToRead := slotValue; len(phyOffsets) < maxNum; {
+		absIndexPos := INDEX_HEADER_SIZE + self.hashSlotNum*HASH_SLOT_SIZE + nextIndexToRead*INDEX_SIZE
+		item := buf[absIndexPos : absIndexPos+INDEX_SIZE]
+
+		keyHashRead := int32(binary.BigEndian.Uint32(item[0:4]))
+		phyOffsetRead := int64(binary.BigEndian.Uint64(item[4:12]))
+		timeDiff := int64(int32(binary.BigEndian.Uint32(item[12:16])))
+		prevIndexRead := int32(binary.BigEndian.Uint32(item[16:20]))
+
+		if timeDiff < 0 {
+			break
+		}
+
+		// 时间差存储单位为秒，timeRead向下取整，因此开始时间放宽1秒
+		timeRead := self.indexHeader.beginTimestamp + timeDiff*1000
+		if keyHash == keyHashRead && timeRead+1000 > begin && timeRead <= end {
+			phyOffsets = append(phyOffsets, phyOffsetRead)
+			if *minTimeRead <= 0 || timeRead < *minTimeRead {
+				*minTimeRead = timeRead
+			}
+		}
+
+		if prevIndexRead <= INVALID_INDEX || prevIndexRead > indexCount || prevIndexRead == nextIndexToRead || timeRead+1000 <= begin {
+			break
+		}
+		nextIndexToRead = prevIndexRead
+	}
+
+	return phyOffsets
+}
+
 func (self *IndexFile) indexKeyHashMethod(key string) int32 {
 	keyHash := self.indexKeyHashCode(key)
 	keyHashPositive := math.Abs(float64(keyHash))
@@ -0,0 +1,46 @@
+package stgstorelog
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestIndexFile_PutKeyAndSelectPhyOffset(t *testing.T) {
+	dir, err := ioutil.TempDir("", "index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 只有1个哈希槽，所有Key落在同一个槽位的链表上
+	indexFile := NewIndexFile(dir+GetPathSeparator()+"20180112120000000", 1, 10, 0, 0)
+	defer indexFile.destroy(0)
+
+	now := time.Now().UnixNano() / 1000000
+	keys := []string{"key-a", "key-b", "key-a", "key-c"}
+	for i, key := range keys {
+		if !indexFile.putKey(key, int64(100*(i+1)), now) {
+			t.Fatalf("put key %s failed", key)
+		}
+	}
+
+	phyOffsets := indexFile.selectPhyOffset(make([]int64, 0), "key-a", 10, now-1000, now+1000, new(int64))
+	if len(phyOffsets) != 2 || phyOffsets[0] != 300 || phyOffsets[1] != 100 {
+		t.Fatalf("expect key-a at [300 100], actual %v", phyOffsets)
+	}
+
+	phyOffsets = indexFile.selectPhyOffset(make([]int64, 0), "key-c", 10, now-1000, now+1000, new(int64))
+	if len(phyOffsets) != 1 || phyOffsets[0] != 400 {
+		t.Fatalf("expect key-c at [400], actual %v", phyOffsets)
+	}
+
+	// 索引写满后写入失败
+	for i := len(keys); i < 9; i++ {
+		indexFile.putKey("key-d", int64(100*(i+1)), now)
+	}
+	if indexFile.putKey("key-e", 1000, now) {
+		t.Error("put key into full index file should fail")
+	}
+}
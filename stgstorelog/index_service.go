@@ -31,6 +31,13 @@ func (self Files) Swap(i, j int) {
 	self[i], self[j] = self[j], self[i]
 }
 
+// indexBarrier 索引构建协程按顺序处理到该请求时，此前入队的请求均已处理完毕
+type indexBarrier struct {
+	reset  bool   // 是否清空全部索引文件，否则刷盘最后一个索引文件
+	action func() // 刷盘后在索引构建协程中执行，期间不会写入索引
+	done   chan bool
+}
+
 type IndexService struct {
 	defaultMessageStore *DefaultMessageStore
 	hashSlotNum         int32
@@ -89,7 +96,9 @@ func (self *IndexService) Start() {
 	for {
 		select {
 		case request := <-self.requestQueue:
-			if request != nil {
+			if barrier, ok := request.(*indexBarrier); ok {
+				self.handleBarrier(barrier)
+			} else if request != nil {
 				self.buildIndex(request)
 			}
 		}
@@ -120,14 +129,27 @@ func (self *IndexService) buildIndex(request interface{}) {
 			keySet := strings.Split(msg.keys, message.KEY_SEPARATOR)
 			for _, key := range keySet {
 				if len(key) > 0 {
-					for ok := indexFile.putKey(self.buildKey(msg.topic, key), msg.commitLogOffset, msg.storeTimestamp); !ok; {
-						logger.Warn("index file full, so create another one, ", indexFile.mapedFile.fileName)
-
-						indexFile = self.retryGetAndCreateIndexFile()
-						if indexFile == nil {
-							breakdown = true
-							return
-						}
+					if indexFile = self.putKey(indexFile, self.buildKey(msg.topic, key), msg); indexFile == nil {
+						breakdown = true
+						break
+					}
+				}
+			}
+		}
+
+		// Topic声明需要建立索引的消息属性
+		if indexFile != nil && len(msg.properties) > 0 {
+			topicConfig := self.defaultMessageStore.getTopicConfig(msg.topic)
+			if topicConfig != nil {
+				for _, name := range topicConfig.IndexedProperties {
+					value, ok := msg.properties[name]
+					if !ok || len(value) == 0 {
+						continue
+					}
+
+					if indexFile = self.putKey(indexFile, self.buildPropertyKey(msg.topic, name, value), msg); indexFile == nil {
+						breakdown = true
+						break
 					}
 				}
 			}
@@ -141,10 +163,34 @@ func (self *IndexService) buildIndex(request interface{}) {
 	}
 }
 
+// putKey 写入索引，当前索引文件写满时创建新文件重试
+// Return: 最终写入的索引文件，创建失败时返回nil
+// Since 2018/1/12
+func (self *IndexService) putKey(indexFile *IndexFile, key string, msg *DispatchRequest) *IndexFile {
+	for ok := indexFile.putKey(key, msg.commitLogOffset, msg.storeTimestamp); !ok; {
+		logger.Warn("index file full, so create another one, ", indexFile.mapedFile.fileName)
+
+		indexFile = self.retryGetAndCreateIndexFile()
+		if indexFile == nil {
+			return nil
+		}
+		ok = indexFile.putKey(key, msg.commitLogOffset, msg.storeTimestamp)
+	}
+
+	return indexFile
+}
+
 func (self *IndexService) buildKey(topic, key string) string {
 	return topic + "#" + key
 }
 
+// buildPropertyKey 消息属性索引的key，属性名与值之间使用属性编码的分隔符，
+// 消息Key及属性名、值都不会包含该分隔符，因此不会与buildKey的结果冲突
+// Since 2018/1/12
+func (self *IndexService) buildPropertyKey(topic, propertyName, value string) string {
+	return topic + "#" + propertyName + string(rune(message.NAME_VALUE_SEPARATOR)) + value
+}
+
 func (self *IndexService) retryGetAndCreateIndexFile() *IndexFile {
 	var indexFile *IndexFile
 
@@ -191,7 +237,7 @@ func (self *IndexService) getAndCreateLastIndexFile() *IndexFile {
 	// 如果没找到，使用写锁创建文件
 	if indexFile == nil {
 		fileName := self.storePath + GetPathSeparator() + utils.TimeMillisecondToHumanString(time.Now())
-		indexFile := NewIndexFile(fileName, self.hashSlotNum, self.indexNum, lastUpdateEndPhyOffset, lastUpdateIndexTimestamp)
+		indexFile = NewIndexFile(fileName, self.hashSlotNum, self.indexNum, lastUpdateEndPhyOffset, lastUpdateIndexTimestamp)
 
 		self.readWriteLock.Lock()
 		self.indexFileList.PushBack(indexFile)
@@ -208,8 +254,8 @@ func (self *IndexService) getAndCreateLastIndexFile() *IndexFile {
 }
 
 func (self *IndexService) destroy() {
-	self.readWriteLock.RLock()
-	defer self.readWriteLock.RUnlock()
+	self.readWriteLock.Lock()
+	defer self.readWriteLock.Unlock()
 
 	for element := self.indexFileList.Front(); element != nil; element = element.Next() {
 		indexFile := element.Value.(*IndexFile)
@@ -267,9 +313,52 @@ func (self *IndexService) deleteExpiredFiles(files *list.List) {
 	}
 }
 
-func (self *IndexService) queryOffset(topic, key string, maxNum int32, begin, end int64) *QueryMessageResult {
-	// TODO
-	return nil
+// queryOffset 按key查询消息物理offset，从最新的索引文件开始往前查找
+// Since 2018/1/12
+func (self *IndexService) queryOffset(topic, key string, maxNum int32, begin, end int64) *QueryOffsetResult {
+	return self.queryOffsetByIndexKey(self.buildKey(topic, key), maxNum, begin, end)
+}
+
+// queryOffsetByProperty 按消息属性查询消息物理offset
+// Since 2018/1/12
+func (self *IndexService) queryOffsetByProperty(topic, propertyName, value string, maxNum int32, begin, end int64) *QueryOffsetResult {
+	return self.queryOffsetByIndexKey(self.buildPropertyKey(topic, propertyName, value), maxNum, begin, end)
+}
+
+func (self *IndexService) queryOffsetByIndexKey(indexKey string, maxNum int32, begin, end int64) *QueryOffsetResult {
+	phyOffsets := make([]int64, 0)
+	var (
+		minIndexTimestamp        int64
+		indexLastUpdateTimestamp int64
+		indexLastUpdatePhyoffset int64
+	)
+
+	if maxNum > self.defaultMessageStore.MessageStoreConfig.MaxMsgsNumBatch {
+		maxNum = self.defaultMessageStore.MessageStoreConfig.MaxMsgsNumBatch
+	}
+
+	self.readWriteLock.RLock()
+	defer self.readWriteLock.RUnlock()
+
+	for element := self.indexFileList.Back(); element != nil; element = element.Prev() {
+		indexFile := element.Value.(*IndexFile)
+		if element == self.indexFileList.Back() {
+			indexLastUpdateTimestamp = indexFile.getEndTimestamp()
+			indexLastUpdatePhyoffset = indexFile.getEndPhyOffset()
+		}
+
+		if indexFile.isTimeMatched(begin, end) {
+			phyOffsets = indexFile.selectPhyOffset(phyOffsets, indexKey, int(maxNum), begin, end, &minIndexTimestamp)
+		}
+
+		if indexFile.indexHeader.beginTimestamp < begin || len(phyOffsets) >= int(maxNum) {
+			break
+		}
+	}
+
+	queryOffsetResult := NewQueryOffsetResult(phyOffsets, indexLastUpdateTimestamp, indexLastUpdatePhyoffset)
+	queryOffsetResult.minIndexTimestamp = minIndexTimestamp
+	return queryOffsetResult
 }
 
 func (self *IndexService) putRequest(request interface{}) {
@@ -296,6 +385,45 @@ func (self *IndexService) flush(indexFile *IndexFile) {
 	}
 }
 
+// waitBarrier 等待此前入队的索引请求处理完毕，reset为true时随后清空全部索引文件，否则刷盘最后一个索引文件
+// Since 2018/1/19
+func (self *IndexService) waitBarrier(reset bool) {
+	barrier := &indexBarrier{reset: reset, done: make(chan bool)}
+	self.putRequest(barrier)
+	<-barrier.done
+}
+
+// waitBarrierAction 等待此前入队的索引请求处理完毕，刷盘最后一个索引文件后执行action
+// Since 2018/1/22
+func (self *IndexService) waitBarrierAction(action func()) {
+	barrier := &indexBarrier{action: action, done: make(chan bool)}
+	self.putRequest(barrier)
+	<-barrier.done
+}
+
+func (self *IndexService) handleBarrier(barrier *indexBarrier) {
+	defer close(barrier.done)
+
+	if barrier.reset {
+		self.destroy()
+		logger.Info("index service destroy all index files")
+		return
+	}
+
+	self.readWriteLock.RLock()
+	var lastIndexFile *IndexFile
+	if self.indexFileList.Len() > 0 {
+		lastIndexFile = self.indexFileList.Back().Value.(*IndexFile)
+	}
+	self.readWriteLock.RUnlock()
+
+	self.flush(lastIndexFile)
+
+	if barrier.action != nil {
+		barrier.action()
+	}
+}
+
 func (self *IndexService) Shutdown() {
 	// TODO
 }
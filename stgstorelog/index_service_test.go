@@ -0,0 +1,121 @@
+package stgstorelog
+
+import (
+	"testing"
+	"time"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/message"
+)
+
+type indexedTopicConfigFinder struct{}
+
+func (finder *indexedTopicConfigFinder) SelectTopicConfig(topic string) *stgcommon.TopicConfig {
+	topicConfig := stgcommon.NewTopicConfig(topic)
+	topicConfig.IndexedProperties = []string{"orderId"}
+	return topicConfig
+}
+
+func putPropertyMessage(messageStore *DefaultMessageStore, keys, orderId string) *PutMessageResult {
+	queueId := int32(-1)
+	msg := buildMessage([]byte("order message"), &queueId)
+	msg.PutProperty(message.PROPERTY_KEYS, keys)
+	if orderId != "" {
+		msg.PutProperty("orderId", orderId)
+	}
+	msg.PropertiesString = message.MessageProperties2String(msg.Properties)
+	return messageStore.PutMessage(msg)
+}
+
+func TestIndexService_BuildPropertyKey(t *testing.T) {
+	indexService := new(IndexService)
+	if indexService.buildPropertyKey("test", "orderId", "o-1") == indexService.buildKey("test", "orderId#o-1") {
+		t.Error("property index key should not collide with message key")
+	}
+}
+
+func TestDefaultMessageStore_QueryMessageByProperty(t *testing.T) {
+	QUEUE_TOTAL = 1
+	master := buildMessageStore()
+	defer master.Destroy()
+	defer master.Shutdown()
+	master.TopicConfigFinder = &indexedTopicConfigFinder{}
+
+	begin := time.Now().UnixNano()/1000000 - 1000
+	putPropertyMessage(master, "k1", "o-1")
+	putPropertyMessage(master, "k2", "o-2")
+	putPropertyMessage(master, "k3", "o-1")
+	putPropertyMessage(master, "orderId#o-1", "")
+	time.Sleep(time.Second)
+	end := time.Now().UnixNano()/1000000 + 1000
+
+	result := master.QueryMessageByProperty("test", "orderId", "o-1", 32, begin, end)
+	if len(result.MessageMapedList) != 2 {
+		t.Fatalf("expect 2 messages with orderId o-1, actual %d", len(result.MessageMapedList))
+	}
+	for _, selectResult := range result.MessageMapedList {
+		msgExt, err := message.DecodeMessageExt(selectResult.MappedByteBuffer.Bytes(), false, false)
+		if err != nil || msgExt.Properties["orderId"] != "o-1" {
+			t.Errorf("unexpected message %v", msgExt)
+		}
+		selectResult.Release()
+	}
+
+	result = master.QueryMessageByProperty("test", "orderId", "o-3", 32, begin, end)
+	if len(result.MessageMapedList) != 0 {
+		t.Errorf("expect no message with orderId o-3, actual %d", len(result.MessageMapedList))
+	}
+}
+
+// TestDefaultMessageStore_QueryMessageByIndexSkipCollisions 哈希冲突占满查询数量且索引时间相同时，重试仍能向前查找
+func TestDefaultMessageStore_QueryMessageByIndexSkipCollisions(t *testing.T) {
+	QUEUE_TOTAL = 1
+	master := buildMessageStore()
+	defer master.Destroy()
+	defer master.Shutdown()
+
+	// 按写入顺序，最早的一条是要查找的消息，之后的3条为哈希冲突
+	type indexEntry struct {
+		phyOffset int64
+		timeRead  int64
+	}
+	var entries []indexEntry
+	for i, keys := range []string{"k-target", "k-1", "k-2", "k-3"} {
+		result := putPropertyMessage(master, keys, "")
+		if result == nil || !result.isOk() {
+			t.Fatalf("put message %s failed", keys)
+		}
+		// 索引时间按秒截断，每两条在同一秒
+		entries = append([]indexEntry{{result.AppendMessageResult.WroteOffset, int64(9000 + i/2*1000)}}, entries...)
+	}
+
+	var queryEnds []int64
+	query := func(lastQueryMsgTime int64) *QueryOffsetResult {
+		queryEnds = append(queryEnds, lastQueryMsgTime)
+		result := NewQueryOffsetResult(nil, 0, 0)
+		for _, entry := range entries {
+			if entry.timeRead > lastQueryMsgTime || len(result.phyOffsets) >= 2 {
+				continue
+			}
+			result.phyOffsets = append(result.phyOffsets, entry.phyOffset)
+			if result.minIndexTimestamp <= 0 || entry.timeRead < result.minIndexTimestamp {
+				result.minIndexTimestamp = entry.timeRead
+			}
+		}
+		return result
+	}
+	matched := func(msgExt *message.MessageExt) bool {
+		return msgExt.GetKeys() == "k-target"
+	}
+
+	result := master.queryMessageByIndex(query, matched, 0, 20000)
+	if len(result.MessageMapedList) != 1 {
+		t.Fatalf("expect 1 message after skipping collisions, actual %d, query ends %v", len(result.MessageMapedList), queryEnds)
+	}
+	for _, selectResult := range result.MessageMapedList {
+		selectResult.Release()
+	}
+	if len(queryEnds) != 2 || queryEnds[1] != 9999 {
+		t.Errorf("expect retry with end 9999, actual query ends %v", queryEnds)
+	}
+}
@@ -0,0 +1,62 @@
+package stgstorelog
+
+import (
+	"sync/atomic"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon/metrics"
+)
+
+// windowHistogram 累计直方图及最近一分钟的分布，写入无锁，滚动只由统计协程执行
+// Since 2018/1/23
+type windowHistogram struct {
+	histogram metrics.LatencyHistogram
+	last      *metrics.HistogramSnapshot // 上次滚动时的累计快照，只由统计协程访问
+	window    atomic.Value               // *metrics.HistogramSnapshot，最近一分钟的分布
+}
+
+func newWindowHistogram() *windowHistogram {
+	histogram := new(windowHistogram)
+	histogram.window.Store(new(metrics.HistogramSnapshot))
+	return histogram
+}
+
+func (self *windowHistogram) roll() {
+	current := self.histogram.Snapshot(true)
+	self.window.Store(current.Sub(self.last))
+	self.last = current
+}
+
+func (self *windowHistogram) lastMinute() *metrics.HistogramSnapshot {
+	return self.window.Load().(*metrics.HistogramSnapshot)
+}
+
+// windowCounter 累计计数及最近一分钟的增量
+// Since 2018/1/23
+type windowCounter struct {
+	total        int64
+	last         int64 // 上次滚动时的累计值，只由统计协程访问
+	windowCount  int64
+	windowMillis int64
+}
+
+func (self *windowCounter) add(value int64) {
+	atomic.AddInt64(&self.total, value)
+}
+
+func (self *windowCounter) roll(elapsedMillis int64) {
+	current := atomic.LoadInt64(&self.total)
+	atomic.StoreInt64(&self.windowCount, current-self.last)
+	atomic.StoreInt64(&self.windowMillis, elapsedMillis)
+	self.last = current
+}
+
+// lastMinute 最近一分钟的计数及每秒速率
+// Since 2018/1/23
+func (self *windowCounter) lastMinute() (int64, float64) {
+	count := atomic.LoadInt64(&self.windowCount)
+	millis := atomic.LoadInt64(&self.windowMillis)
+	if millis <= 0 {
+		return count, 0
+	}
+	return count, float64(count) * 1000 / float64(millis)
+}
@@ -0,0 +1,54 @@
+package stgstorelog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogramPercentile(t *testing.T) {
+	histogram := newWindowHistogram()
+	for i := int64(1); i <= 1000; i++ {
+		histogram.histogram.Record(i)
+	}
+	histogram.roll()
+
+	snapshot := histogram.lastMinute()
+	if snapshot.Total() != 1000 || snapshot.Max() != 1000 {
+		t.Fatalf("expect 1000 records and max 1000, actual %s", snapshot)
+	}
+	if p50 := snapshot.Percentile(0.5); p50 < 500 || p50 > 625 {
+		t.Errorf("p50 expect about 500, actual %d", p50)
+	}
+	if p999 := snapshot.Percentile(0.999); p999 < 999 || p999 > 1000 {
+		t.Errorf("p999 expect about 999, actual %d", p999)
+	}
+
+	// 滚动后只统计新记录的数据
+	histogram.histogram.Record(10)
+	histogram.roll()
+	if snapshot = histogram.lastMinute(); snapshot.Total() != 1 || snapshot.Max() != 10 {
+		t.Errorf("expect 1 record and max 10 after roll, actual %s", snapshot)
+	}
+}
+
+func TestStoreStatsService_GetStatsItem(t *testing.T) {
+	service := NewStoreStatsService()
+	service.recordPutMessage("TopicA", 1, 2*time.Millisecond)
+	service.recordGetMessage(false)
+	service.recordGetMessage(true)
+	service.lastRollTimestamp -= RollStatsInterval
+	service.rollStats()
+
+	if item := service.GetStatsItem(STORE_PUT_LATENCY, "TopicA"); item == nil || item.Sum != 1 || item.Max != 2000 {
+		t.Errorf("put latency stats error: %#v", item)
+	}
+	if item := service.GetStatsItem(STORE_QUEUE_PUT_NUMS, "TopicA@1"); item == nil || item.Sum != 1 {
+		t.Errorf("queue put nums stats error: %#v", item)
+	}
+	if item := service.GetStatsItem(STORE_PAGE_CACHE_HIT, ""); item == nil || item.Avgpt != 0.5 {
+		t.Errorf("page cache hit stats error: %#v", item)
+	}
+	if service.GetStatsItem(STORE_PUT_LATENCY, "TopicB") != nil {
+		t.Error("stats of unknown topic should be nil")
+	}
+}
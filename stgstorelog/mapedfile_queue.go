@@ -237,16 +237,18 @@ func (self *MapedFileQueue) getLastMapedFile(startOffset int64) (*MapedFile, err
 
 	if createOffset != -1 {
 		nextPath := self.storePath + string(filepath.Separator) + fileutil.Offset2FileName(createOffset)
-		nextNextPath := self.storePath + string(filepath.Separator) +
-			fileutil.Offset2FileName(createOffset+self.mapedFileSize)
 		if self.allocateMapedFileService != nil {
 			var err error
-			mapedFile, err = self.allocateMapedFileService.putRequestAndReturnMapedFile(nextPath, nextNextPath, self.mapedFileSize)
+			mapedFile, err = self.allocateMapedFileService.putRequestAndReturnMapedFile(self.storePath, createOffset, self.mapedFileSize)
 			if err != nil {
-				logger.Errorf("put request and return maped file, error:%s ", err.Error())
-				return nil, err
+				// 预分配失败，回退到同步创建
+				logger.Warnf("put request and return maped file error: %s, create it synchronously", err.Error())
+				mapedFile = nil
 			}
-		} else {
+		}
+
+		// 同步创建位于写入路径上，不做预热，预热只在预分配协程中进行
+		if mapedFile == nil {
 			var err error
 			mapedFile, err = NewMapedFile(nextPath, self.mapedFileSize)
 			if err != nil {
@@ -304,11 +306,12 @@ func (self *MapedFileQueue) deleteLastMapedFile() {
 }
 
 // deleteExpiredFileByTime 根据文件过期时间来删除物理队列文件
+// Params: maxDeleteOffset 只删除结束位置不超过该offset的文件，小于0表示不限制
 // Return: 删除过期文件的数量
 // Author: tantexian, <tantexian@qq.com>
 // Since: 17/8/9
 func (self *MapedFileQueue) deleteExpiredFileByTime(expiredTime int64, deleteFilesInterval int,
-	intervalForcibly int64, cleanImmediately bool) int {
+	intervalForcibly int64, cleanImmediately bool, maxDeleteOffset int64) int {
 	// 获取当前MapedFiles列表中所有元素副本的切片
 	files := self.copyMapedFiles(0)
 	if len(files) == 0 {
@@ -321,6 +324,11 @@ func (self *MapedFileQueue) deleteExpiredFileByTime(expiredTime int64, deleteFil
 	for i := 0; i < mfsLength; i++ {
 		mf := files[i]
 		if mf != nil {
+			// 文件中还有不能删除的数据，之后的文件也不能删除
+			if maxDeleteOffset >= 0 && mf.fileFromOffset+mf.fileSize > maxDeleteOffset {
+				break
+			}
+
 			liveMaxTimestamp := mf.storeTimestamp + expiredTime
 			if timeutil.CurrentTimeMillis() > liveMaxTimestamp || cleanImmediately {
 				if mf.destroy(intervalForcibly) {
@@ -395,6 +403,41 @@ func (self *MapedFileQueue) deleteExpiredFileByOffset(offset int64, unitsize int
 	return deleteCount
 }
 
+// deleteExpiredFileByLogicOffset 删除逻辑队列中全部位于offset之前的文件
+// Params: offset 逻辑队列最小offset（字节）
+// Return: 删除文件的数量
+// Since: 2018/1/10
+func (self *MapedFileQueue) deleteExpiredFileByLogicOffset(offset int64) int {
+	toBeDeleteFileList := list.New()
+	deleteCount := 0
+	mfs := self.copyMapedFiles(0)
+
+	if mfs != nil && len(mfs) > 0 {
+		// 最后一个文件处于写状态，不能删除
+		mfsLength := len(mfs) - 1
+
+		for i := 0; i < mfsLength; i++ {
+			mf := mfs[i]
+			if mf == nil {
+				continue
+			}
+
+			if mf.fileFromOffset+mf.fileSize > offset {
+				break
+			}
+
+			if mf.destroy(1000 * 60) {
+				logger.Infof("logic min offset %d, delete expired logic file %s", offset, mf.fileName)
+				toBeDeleteFileList.PushBack(mf)
+				deleteCount++
+			}
+		}
+	}
+
+	self.deleteExpiredFile(toBeDeleteFileList)
+	return deleteCount
+}
+
 func (self *MapedFileQueue) commit(flushLeastPages int32) bool {
 	result := true
 
@@ -0,0 +1,77 @@
+package stgstorelog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon/message"
+)
+
+const (
+	messageBodyLengthPostion = 84 // 消息体长度在存储消息中的位置，位于Prepared Transaction Offset之后
+)
+
+var expireAtPropertyPrefix = append([]byte(message.PROPERTY_EXPIRE_AT), byte(message.NAME_VALUE_SEPARATOR))
+
+// getMessageTtlMillis 获取Topic配置的消息默认存活时间（单位毫秒），0表示永不过期
+// Since 2018/1/24
+func (self *DefaultMessageStore) getMessageTtlMillis(topic string) int64 {
+	topicConfig := self.getTopicConfig(topic)
+	if topicConfig == nil || topicConfig.MessageTtlSeconds <= 0 {
+		return 0
+	}
+
+	return topicConfig.MessageTtlSeconds * 1000
+}
+
+// isMessageExpired 存储的消息是否已过期，消息属性PROPERTY_EXPIRE_AT优先于Topic的默认存活时间
+// Since 2018/1/24
+func isMessageExpired(data []byte, ttlMillis, now int64) bool {
+	expireAt := parseMessageExpireAt(data, ttlMillis)
+	return expireAt > 0 && expireAt <= now
+}
+
+// parseMessageExpireAt 直接从存储的消息中解析过期时间点，不解码消息体，未设置过期时间时返回0
+// Since 2018/1/24
+func parseMessageExpireAt(data []byte, ttlMillis int64) int64 {
+	if len(data) < messageBodyLengthPostion+4 {
+		return 0
+	}
+
+	// 15 BODY
+	pos := messageBodyLengthPostion
+	bodyLen := int(int32(binary.BigEndian.Uint32(data[pos:])))
+	pos += 4
+	if bodyLen > 0 {
+		pos += bodyLen
+	}
+
+	// 16 TOPIC
+	if pos+1 > len(data) {
+		return 0
+	}
+	pos += 1 + int(int8(data[pos]))
+
+	// 17 properties，不包含过期时间属性时无需解析全部属性
+	if pos+2 <= len(data) {
+		propertiesLength := int(int16(binary.BigEndian.Uint16(data[pos:])))
+		pos += 2
+		if propertiesLength > 0 && pos+propertiesLength <= len(data) {
+			properties := data[pos : pos+propertiesLength]
+			if bytes.Contains(properties, expireAtPropertyPrefix) {
+				value := message.Bytes2messageProperties(properties)[message.PROPERTY_EXPIRE_AT]
+				if expireAt, err := strconv.ParseInt(value, 10, 64); err == nil && expireAt > 0 {
+					return expireAt
+				}
+			}
+		}
+	}
+
+	if ttlMillis <= 0 {
+		return 0
+	}
+
+	storeTimestamp := int64(binary.BigEndian.Uint64(data[message.MessageStoreTimestampPostion:]))
+	return storeTimestamp + ttlMillis
+}
@@ -0,0 +1,98 @@
+package stgstorelog
+
+import (
+	"testing"
+	"time"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/message"
+)
+
+type ttlTopicConfigFinder struct {
+	ttlSeconds int64
+}
+
+func (finder *ttlTopicConfigFinder) SelectTopicConfig(topic string) *stgcommon.TopicConfig {
+	topicConfig := stgcommon.NewTopicConfig(topic)
+	topicConfig.MessageTtlSeconds = finder.ttlSeconds
+	return topicConfig
+}
+
+func putExpireMessage(messageStore *DefaultMessageStore, expireAt int64) {
+	queueId := int32(-1)
+	msg := buildMessage([]byte("expire message"), &queueId)
+	if expireAt > 0 {
+		msg.SetExpireAt(expireAt)
+	}
+	msg.PropertiesString = message.MessageProperties2String(msg.Properties)
+	messageStore.PutMessage(msg)
+}
+
+func TestDefaultMessageStore_GetMessageSkipExpired(t *testing.T) {
+	QUEUE_TOTAL = 1
+	master := buildMessageStore()
+	defer master.Destroy()
+	defer master.Shutdown()
+
+	now := time.Now().UnixNano() / 1000000
+	putExpireMessage(master, now-1000)
+	putExpireMessage(master, now-1000)
+	putExpireMessage(master, now+60*1000)
+	putExpireMessage(master, 0)
+	time.Sleep(time.Second)
+
+	result := master.GetMessage("group", "test", 0, 0, 32, nil)
+	defer result.Release()
+	if result.GetMessageCount() != 2 || result.NextBeginOffset != 4 {
+		t.Fatalf("expect 2 messages and next offset 4, actual %d %d", result.GetMessageCount(), result.NextBeginOffset)
+	}
+
+	// Topic默认存活时间对未设置过期时间点的消息生效
+	master.TopicConfigFinder = &ttlTopicConfigFinder{ttlSeconds: 1}
+	time.Sleep(1100 * time.Millisecond)
+	result = master.GetMessage("group", "test", 0, 2, 32, nil)
+	defer result.Release()
+	if result.GetMessageCount() != 1 || result.NextBeginOffset != 4 {
+		t.Fatalf("expect 1 message and next offset 4, actual %d %d", result.GetMessageCount(), result.NextBeginOffset)
+	}
+}
+
+func TestParseMessageExpireAt(t *testing.T) {
+	msg := buildMessage([]byte("expire message"), new(int32))
+	msg.StoreTimestamp = 1000
+	msg.SetExpireAt(5000)
+	data := encodeExpireMessage(msg)
+
+	if expireAt := parseMessageExpireAt(data, 0); expireAt != 5000 {
+		t.Errorf("expect expire at 5000, actual %d", expireAt)
+	}
+	if !isMessageExpired(data, 0, 5000) || isMessageExpired(data, 0, 4999) {
+		t.Error("message should expire at 5000")
+	}
+
+	msg.ClearProperty(message.PROPERTY_EXPIRE_AT)
+	data = encodeExpireMessage(msg)
+	if expireAt := parseMessageExpireAt(data, 0); expireAt != 0 {
+		t.Errorf("expect no expire time, actual %d", expireAt)
+	}
+	if expireAt := parseMessageExpireAt(data, 2000); expireAt != 3000 {
+		t.Errorf("expect expire at store timestamp + ttl, actual %d", expireAt)
+	}
+}
+
+// encodeExpireMessage 按存储格式编码消息，只填充解析过期时间需要的字段
+func encodeExpireMessage(msg *MessageExtBrokerInner) []byte {
+	properties := []byte(message.MessageProperties2String(msg.Properties))
+	buffer := NewMappedByteBuffer(make([]byte, 1024))
+	buffer.WriteInt32(0)
+	buffer.Write(make([]byte, message.MessageStoreTimestampPostion-4))
+	buffer.WriteInt64(msg.StoreTimestamp)
+	buffer.Write(make([]byte, messageBodyLengthPostion-message.MessageStoreTimestampPostion-8))
+	buffer.WriteInt32(int32(len(msg.Body)))
+	buffer.Write(msg.Body)
+	buffer.Write([]byte{byte(len(msg.Topic))})
+	buffer.Write([]byte(msg.Topic))
+	buffer.Write([]byte{byte(len(properties) >> 8), byte(len(properties))})
+	buffer.Write(properties)
+	return buffer.Bytes()
+}
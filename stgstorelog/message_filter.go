@@ -2,6 +2,7 @@ package stgstorelog
 
 import (
 	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/heartbeat"
+	set "github.com/deckarep/golang-set"
 )
 
 const (
@@ -13,6 +14,28 @@ const (
 // Since 2017/9/6
 type MessageFilter interface {
 	IsMessageMatched(subscriptionData *heartbeat.SubscriptionData, tagsCode int64) bool
+	IsMessageMatchedByExt(subscriptionData *heartbeat.SubscriptionData, filterData *ConsumerFilterData, bloomFilter *BloomFilter, unit *CqExtUnit) bool
+}
+
+// ConsumerFilterData 订阅组在某个Topic上的过滤条件
+// Since 2018/1/17
+type ConsumerFilterData struct {
+	ConsumerGroup   string
+	Topic           string
+	SubString       string
+	TagsSet         set.Set // 订阅的tag
+	ClassFilterMode bool
+	BornTime        int64 // 过滤条件生效时间，之前存储的消息位图中没有该订阅组的结果
+}
+
+// isTagsMatched 消息的tag是否匹配订阅组过滤条件
+// Since 2018/1/17
+func (self *ConsumerFilterData) isTagsMatched(tags string) bool {
+	if self.ClassFilterMode || self.SubString == SUBSCRIPTION_ALL || self.SubString == "" {
+		return true
+	}
+
+	return self.TagsSet != nil && self.TagsSet.Contains(tags)
 }
 
 // DefaultMessageFilter 消息过滤规则实现
@@ -36,3 +59,27 @@ func (df *DefaultMessageFilter) IsMessageMatched(subscriptionData *heartbeat.Sub
 
 	return subscriptionData.CodeSet.Contains(tagsCode)
 }
+
+// IsMessageMatchedByExt 根据消费队列扩展单元过滤消息，无需读取CommitLog：
+// 先检查订阅组过滤位图，再用完整tag比较，避免tag哈希冲突
+// Since 2018/1/17
+func (df *DefaultMessageFilter) IsMessageMatchedByExt(subscriptionData *heartbeat.SubscriptionData,
+	filterData *ConsumerFilterData, bloomFilter *BloomFilter, unit *CqExtUnit) bool {
+	if nil == subscriptionData || subscriptionData.ClassFilterMode || subscriptionData.SubString == SUBSCRIPTION_ALL {
+		return true
+	}
+
+	// 位图只在过滤条件与本次拉取一致，且消息存储时过滤条件已生效时可信
+	if filterData != nil && bloomFilter != nil && len(unit.filterBitMap) > 0 &&
+		filterData.SubString == subscriptionData.SubString && unit.msgStoreTime >= filterData.BornTime {
+		if !bloomFilter.isHit(unit.filterBitMap, bloomFilter.bitPositions(filterData.ConsumerGroup)) {
+			return false
+		}
+	}
+
+	if len(unit.tags) > 0 && subscriptionData.TagsSet != nil {
+		return subscriptionData.TagsSet.Contains(unit.tags)
+	}
+
+	return df.IsMessageMatched(subscriptionData, unit.tagsCode)
+}
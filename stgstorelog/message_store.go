@@ -1,6 +1,7 @@
 package stgstorelog
 
 import (
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/message"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/protocol/heartbeat"
 )
@@ -33,6 +34,7 @@ type MessageStore interface {
 	AppendToCommitLog(startOffset int64, data []byte) bool  // 数据复制使用：向CommitLog追加数据，并分发至各个Consume Queue
 	ExcuteDeleteFilesManualy()
 	QueryMessage(topic string, key string, maxNum int32, begin int64, end int64) *QueryMessageResult
+	QueryMessageByProperty(topic, propertyName, value string, maxNum int32, begin, end int64) *QueryMessageResult // 按Topic声明的索引属性查询消息
 	UpdateHaMasterAddress(newAddr string)
 	SlaveFallBehindMuch() int64 // Slave落后Master多少，单位字节
 	Now() int64
@@ -40,4 +42,22 @@ type MessageStore interface {
 	CleanExpiredConsumerQueue()                                                                               // 清除失效的消费队列
 	GetMessageIds(topic string, queueId int32, minOffset, maxOffset int64, storeHost string) map[string]int64 // 批量获取 messageId
 	CheckInDiskByConsumeOffset(topic string, queueId int32, consumeOffset int64) bool                         //判断消息是否在磁盘
+	GetStoreMode() StoreMode                                                                                  // 获取当前存储模式
+	UpdateStoreMode(mode StoreMode, force bool) StoreMode                                                     // 强制指定或清除存储模式
+	RebuildConsumeQueue(topic string, queueId int32, rebuildIndex, dryRun bool) error                         // 根据CommitLog重建逻辑队列及索引
+	CreateSnapshot(snapshotDir string, configFiles ...string) (*SnapshotManifest, error)                      // 在线生成存储快照
+	IsOSPageCacheBusy() bool                                                                                  // 写CommitLog持有锁时间过长，PageCache繁忙
+}
+
+// ConsumerFilterFinder 存储层查询订阅组过滤条件，由broker注入，用于构建消费队列扩展单元的过滤位图
+// Since 2018/1/17
+type ConsumerFilterFinder interface {
+	FindConsumerFilters(topic string) []*ConsumerFilterData
+	FindConsumerFilter(consumerGroup, topic string) *ConsumerFilterData
+}
+
+// TopicConfigFinder 存储层查询Topic配置，由broker注入
+// Since 2018/1/8
+type TopicConfigFinder interface {
+	SelectTopicConfig(topic string) *stgcommon.TopicConfig
 }
@@ -1,8 +1,10 @@
 package stgstorelog
 
 import (
+	"git.oschina.net/cloudzone/smartgo/stgnet/netm"
 	"git.oschina.net/cloudzone/smartgo/stgstorelog/config"
 	"math"
+	"sync"
 )
 
 // MessageStoreConfig 存储层配置文件类
@@ -58,13 +60,29 @@ type MessageStoreConfig struct {
 	HaTransferBatchSize                    int32                      `json:"HaTransferBatchSize"`
 	HaMasterAddress                        string                     `json:"HaMasterAddress"`      // 如果不设置，则从NameServer获取Master HA服务地址
 	HaSlaveFallbehindMax                   int32                      `json:"HaSlaveFallbehindMax"` // Slave落后Master超过此值，则认为存在异常
+	InSyncReplicas                         int32                      `json:"InSyncReplicas"`       // 同步双写时消息需要写入的副本数（包含Master），未在SyncFlushTimeout内达到则返回FLUSH_SLAVE_TIMEOUT
+	MinInSyncReplicas                      int32                      `json:"MinInSyncReplicas"`    // 同步双写时最少的同步副本数（包含Master），不足时直接返回SLAVE_NOT_AVAILABLE
 	BrokerRole                             config.BrokerRole          `json:"BrokerRole"`
 	FlushDiskType                          config.FlushDiskType       `json:"FlushDiskType"`
 	SyncFlushTimeout                       int32                      `json:"SyncFlushTimeout"`  // 同步刷盘超时时间
 	MessageDelayLevel                      string                     `json:"MessageDelayLevel"` // 定时消息相关
 	FlushDelayOffsetInterval               int64                      `json:"FlushDelayOffsetInterval"`
-	CleanFileForciblyEnable                bool                       `json:"CleanFileForciblyEnable"` // 磁盘空间超过90%警戒水位，自动开始删除文件
-	SynchronizationType                    config.SynchronizationType `json:"SynchronizationType"`     // 主从同步数据类型
+	CleanFileForciblyEnable                bool                       `json:"CleanFileForciblyEnable"`      // 磁盘空间超过90%警戒水位，自动开始删除文件
+	SynchronizationType                    config.SynchronizationType `json:"SynchronizationType"`          // 主从同步数据类型
+	CompactionInterval                     int32                      `json:"CompactionInterval"`           // 压缩Topic后台压缩间隔时间（单位毫秒）
+	WarmMapedFileEnable                    bool                       `json:"WarmMapedFileEnable"`          // 新建CommitLog文件时是否预热，提前分配物理内存
+	ReadAheadEnable                        bool                       `json:"ReadAheadEnable"`              // 消费落后读取磁盘时，是否顺序预读后续消息
+	ReadAheadCommitLogSize                 int32                      `json:"ReadAheadCommitLogSize"`       // 每次预读CommitLog的大小（单位字节）
+	ReadAheadConsumeQueueSize              int32                      `json:"ReadAheadConsumeQueueSize"`    // 每次预读ConsumeQueue的大小（单位字节）
+	MlockCommitLogFileNums                 int32                      `json:"MlockCommitLogFileNums"`       // 锁定在内存中的最新CommitLog文件个数，0表示不锁定
+	AllocateMapedFilePreNums               int32                      `json:"AllocateMapedFilePreNums"`     // 后台预分配CommitLog文件个数，0表示不预分配
+	EnableConsumeQueueExt                  bool                       `json:"EnableConsumeQueueExt"`        // 是否启用消费队列扩展文件，存储完整tag与订阅组过滤位图
+	MapedFileSizeConsumeQueueExt           int32                      `json:"MapedFileSizeConsumeQueueExt"` // 消费队列扩展文件大小
+	BitMapLengthConsumeQueueExt            int32                      `json:"BitMapLengthConsumeQueueExt"`  // 订阅组过滤位图长度（单位bit）
+	OsPageCacheBusyTimeOutMills            int64                      `json:"OsPageCacheBusyTimeOutMills"`  // 写CommitLog持有锁的时间超过此值时认为PageCache繁忙，发送消息快速失败
+	TlsConfig                              *netm.TlsConfig            `json:"TlsConfig"`                    // HA连接的TLS配置，由broker设置为与remoting相同的配置
+
+	lock sync.RWMutex // 保护可热更新的配置项
 }
 
 func NewMessageStoreConfig() *MessageStoreConfig {
@@ -122,6 +140,8 @@ func NewMessageStoreConfig() *MessageStoreConfig {
 	conf.HaHousekeepingInterval = 1000 * 20
 	conf.HaTransferBatchSize = 1024 * 32
 	conf.HaSlaveFallbehindMax = 1024 * 1024 * 256
+	conf.InSyncReplicas = 2
+	conf.MinInSyncReplicas = 2
 	conf.BrokerRole = config.ASYNC_MASTER
 	conf.FlushDiskType = config.ASYNC_FLUSH
 	conf.SyncFlushTimeout = 1000 * 5
@@ -129,6 +149,17 @@ func NewMessageStoreConfig() *MessageStoreConfig {
 	conf.FlushDelayOffsetInterval = 1000 * 10
 	conf.CleanFileForciblyEnable = true
 	conf.SynchronizationType = config.SYNCHRONIZATION_LAST
+	conf.CompactionInterval = 1000 * 60 * 5
+	conf.WarmMapedFileEnable = false
+	conf.ReadAheadEnable = true
+	conf.ReadAheadCommitLogSize = 1024 * 1024 * 4
+	conf.ReadAheadConsumeQueueSize = 1024 * 16 * CQStoreUnitSize
+	conf.MlockCommitLogFileNums = 0
+	conf.AllocateMapedFilePreNums = 2
+	conf.EnableConsumeQueueExt = false
+	conf.MapedFileSizeConsumeQueueExt = 1024 * 1024 * 48
+	conf.BitMapLengthConsumeQueueExt = 256
+	conf.OsPageCacheBusyTimeOutMills = 1000
 	return conf
 }
 
@@ -138,13 +169,142 @@ func (self *MessageStoreConfig) getMapedFileSizeConsumeQueue() int32 {
 }
 
 func (self *MessageStoreConfig) getDiskMaxUsedSpaceRatio() int32 {
-	if self.DiskMaxUsedSpaceRatio < 10 {
-		self.DiskMaxUsedSpaceRatio = 10
+	ratio := self.GetDiskMaxUsedSpaceRatio()
+	if ratio < 10 {
+		return 10
 	}
 
-	if self.DiskMaxUsedSpaceRatio > 95 {
-		self.DiskMaxUsedSpaceRatio = 95
+	if ratio > 95 {
+		return 95
 	}
 
+	return ratio
+}
+
+// Lock、Unlock 热更新配置时由配置注册表持有写锁，运行中读取可热更新的配置项需通过下面的GetXxx方法
+// Since 2018/2/5
+func (self *MessageStoreConfig) Lock() {
+	self.lock.Lock()
+}
+
+func (self *MessageStoreConfig) Unlock() {
+	self.lock.Unlock()
+}
+
+// RLock、RUnlock 读取完整配置(如编码为json)时持有读锁
+// Since 2018/2/5
+func (self *MessageStoreConfig) RLock() {
+	self.lock.RLock()
+}
+
+func (self *MessageStoreConfig) RUnlock() {
+	self.lock.RUnlock()
+}
+
+func (self *MessageStoreConfig) GetAccessMessageInMemoryMaxRatio() int64 {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.AccessMessageInMemoryMaxRatio
+}
+
+func (self *MessageStoreConfig) GetCleanFileForciblyEnable() bool {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.CleanFileForciblyEnable
+}
+
+func (self *MessageStoreConfig) GetDiskMaxUsedSpaceRatio() int32 {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
 	return self.DiskMaxUsedSpaceRatio
 }
+
+func (self *MessageStoreConfig) GetFileReservedTime() int64 {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.FileReservedTime
+}
+
+func (self *MessageStoreConfig) GetFlushCommitLogLeastPages() int32 {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.FlushCommitLogLeastPages
+}
+
+func (self *MessageStoreConfig) GetFlushCommitLogThoroughInterval() int32 {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.FlushCommitLogThoroughInterval
+}
+
+func (self *MessageStoreConfig) GetFlushConsumeQueueLeastPages() int32 {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.FlushConsumeQueueLeastPages
+}
+
+func (self *MessageStoreConfig) GetFlushConsumeQueueThoroughInterval() int32 {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.FlushConsumeQueueThoroughInterval
+}
+
+func (self *MessageStoreConfig) GetFlushIntervalCommitLog() int32 {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.FlushIntervalCommitLog
+}
+
+func (self *MessageStoreConfig) GetFlushIntervalConsumeQueue() int32 {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.FlushIntervalConsumeQueue
+}
+
+func (self *MessageStoreConfig) GetHaSlaveFallbehindMax() int32 {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.HaSlaveFallbehindMax
+}
+
+func (self *MessageStoreConfig) GetMaxTransferBytesOnMessageInDisk() int32 {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.MaxTransferBytesOnMessageInDisk
+}
+
+func (self *MessageStoreConfig) GetMaxTransferBytesOnMessageInMemory() int32 {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.MaxTransferBytesOnMessageInMemory
+}
+
+func (self *MessageStoreConfig) GetMaxTransferCountOnMessageInDisk() int32 {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.MaxTransferCountOnMessageInDisk
+}
+
+func (self *MessageStoreConfig) GetMaxTransferCountOnMessageInMemory() int32 {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.MaxTransferCountOnMessageInMemory
+}
+
+func (self *MessageStoreConfig) GetOsPageCacheBusyTimeOutMills() int64 {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.OsPageCacheBusyTimeOutMills
+}
+
+func (self *MessageStoreConfig) GetSyncFlushTimeout() int32 {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.SyncFlushTimeout
+}
+
+func (self *MessageStoreConfig) GetDeleteWhen() string {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.DeleteWhen
+}
@@ -0,0 +1,15 @@
+// +build linux,amd64 linux,arm64
+
+package mmap
+
+import (
+	"syscall"
+)
+
+func fadvise(fd uintptr, offset, length int64, advice int) error {
+	_, _, errno := syscall.Syscall6(syscall.SYS_FADVISE64, fd, uintptr(offset), uintptr(length), uintptr(advice), 0, 0)
+	if errno != 0 {
+		return syscall.Errno(errno)
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+// +build !linux linux,!amd64,!arm64
+
+package mmap
+
+// fadvise is only implemented on 64-bit linux, the advice is ignored elsewhere.
+func fadvise(fd uintptr, offset, length int64, advice int) error {
+	return nil
+}
@@ -30,6 +30,21 @@ const (
 	ANON = 1 << iota
 )
 
+// Advice values for Advise and Fadvise. The values are the same on all
+// supported unix platforms.
+const (
+	// MADV_NORMAL indicates no special treatment.
+	MADV_NORMAL = 0
+	// MADV_RANDOM expects page references in random order, read-ahead is disabled.
+	MADV_RANDOM = 1
+	// MADV_SEQUENTIAL expects page references in sequential order, pages are read ahead aggressively.
+	MADV_SEQUENTIAL = 2
+	// MADV_WILLNEED expects access in the near future, pages are read into the page cache.
+	MADV_WILLNEED = 3
+	// MADV_DONTNEED does not expect access in the near future.
+	MADV_DONTNEED = 4
+)
+
 // MMap represents a file mapped into memory.
 type MMap []byte
 
@@ -86,6 +101,38 @@ func (m MMap) Unlock() error {
 	return unlock(dh.Data, uintptr(dh.Len))
 }
 
+// Advise gives the kernel advice about the use of the whole mapped region.
+func (m MMap) Advise(advice int) error {
+	return m.AdviseRegion(0, len(m), advice)
+}
+
+// AdviseRegion gives the kernel advice about the use of part of the mapped region.
+// The offset is rounded down to a multiple of the system's page size and the
+// region is truncated to the end of the mapping.
+func (m MMap) AdviseRegion(offset, length int, advice int) error {
+	if offset < 0 || length <= 0 || offset >= len(m) {
+		return nil
+	}
+
+	pageSize := os.Getpagesize()
+	aligned := offset - offset%pageSize
+	length += offset - aligned
+	if aligned+length > len(m) {
+		length = len(m) - aligned
+	}
+
+	dh := m.header()
+	return advise(dh.Data+uintptr(aligned), uintptr(length), advice)
+}
+
+// Fadvise announces an intention to access file data in a specific pattern,
+// it works on the file descriptor and does not require the file to be mapped.
+// A length of 0 means until the end of the file.
+// Platforms without posix_fadvise silently ignore the advice.
+func Fadvise(f *os.File, offset, length int64, advice int) error {
+	return fadvise(f.Fd(), offset, length, advice)
+}
+
 // Flush synchronizes the mapping's contents to the file's contents on disk.
 func (m MMap) Flush() error {
 	dh := m.header()
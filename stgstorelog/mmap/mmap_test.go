@@ -47,6 +47,29 @@ func TestUnmap(t *testing.T) {
 	}
 }
 
+func TestAdvise(t *testing.T) {
+	f := openFile(os.O_RDWR)
+	defer f.Close()
+	mmap, err := Map(f, RDWR, 0)
+	if err != nil {
+		t.Errorf("error mapping: %s", err)
+	}
+	defer mmap.Unmap()
+
+	if err := mmap.Advise(MADV_WILLNEED); err != nil {
+		t.Errorf("error advise: %s", err)
+	}
+	if err := mmap.AdviseRegion(3, len(testData), MADV_SEQUENTIAL); err != nil {
+		t.Errorf("error advise region: %s", err)
+	}
+	if err := Fadvise(f, 0, 0, MADV_WILLNEED); err != nil {
+		t.Errorf("error fadvise: %s", err)
+	}
+	if !bytes.Equal(testData, mmap) {
+		t.Errorf("mmap != testData: %q, %q", mmap, testData)
+	}
+}
+
 func TestReadWrite(t *testing.T) {
 	f := openFile(os.O_RDWR)
 	defer f.Close()
@@ -50,6 +50,14 @@ func lock(addr, len uintptr) error {
 	return nil
 }
 
+func advise(addr, len uintptr, advice int) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_MADVISE, addr, len, uintptr(advice))
+	if errno != 0 {
+		return syscall.Errno(errno)
+	}
+	return nil
+}
+
 func unlock(addr, len uintptr) error {
 	_, _, errno := syscall.Syscall(syscall.SYS_MUNLOCK, addr, len, 0)
 	if errno != 0 {
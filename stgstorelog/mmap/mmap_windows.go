@@ -95,6 +95,11 @@ func unlock(addr, len uintptr) error {
 	return os.NewSyscallError("VirtualUnlock", errno)
 }
 
+// advise is not supported on Windows, the advice is ignored.
+func advise(addr, len uintptr, advice int) error {
+	return nil
+}
+
 func unmap(addr, len uintptr) error {
 	flush(addr, len)
 	// Lock the UnmapViewOfFile along with the handleMap deletion.
@@ -0,0 +1,155 @@
+package stgstorelog
+
+import (
+	"sync"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
+)
+
+// PageCacheService 主动管理page cache：消费落后时顺序预读ConsumeQueue与CommitLog，
+// 并将最新的N个CommitLog文件锁定在内存中，平滑落后消费者追赶时的延时毛刺
+// Since 2018/1/15
+type PageCacheService struct {
+	defaultMessageStore *DefaultMessageStore
+	readAheadTable      map[*ConsumeQueue]*readAheadPosition // 各逻辑队列已预读到的位置
+	readAheadMu         *sync.Mutex
+	lockedMapedFiles    []*MapedFile // 当前已mlock的CommitLog文件
+	lockMu              *sync.Mutex
+}
+
+// readAheadPosition 逻辑队列已预读到的位置
+// Since 2018/1/15
+type readAheadPosition struct {
+	consumeQueueOffset int64 // ConsumeQueue已预读到的字节位置
+	commitLogOffset    int64 // CommitLog已预读到的物理offset
+}
+
+func NewPageCacheService(defaultMessageStore *DefaultMessageStore) *PageCacheService {
+	return &PageCacheService{
+		defaultMessageStore: defaultMessageStore,
+		readAheadTable:      make(map[*ConsumeQueue]*readAheadPosition),
+		readAheadMu:         new(sync.Mutex),
+		lockedMapedFiles:    make([]*MapedFile, 0),
+		lockMu:              new(sync.Mutex),
+	}
+}
+
+// readAhead 消费落后读取磁盘消息时调用，预读后续的ConsumeQueue与CommitLog数据，
+// 已预读区域过半之前不会重复预读
+// Params: startIndex 本次拉取的逻辑队列offset
+// Params: offsetPy 本次拉取的第一条消息物理offset
+// Since 2018/1/15
+func (self *PageCacheService) readAhead(consumeQueue *ConsumeQueue, startIndex, offsetPy int64) {
+	storeConfig := self.defaultMessageStore.MessageStoreConfig
+	if !storeConfig.ReadAheadEnable {
+		return
+	}
+
+	cqSize := int64(storeConfig.ReadAheadConsumeQueueSize)
+	clSize := int64(storeConfig.ReadAheadCommitLogSize)
+	cqOffset := startIndex * CQStoreUnitSize
+
+	self.readAheadMu.Lock()
+	position, ok := self.readAheadTable[consumeQueue]
+	if !ok {
+		position = &readAheadPosition{}
+		self.readAheadTable[consumeQueue] = position
+	}
+
+	cqNeeded := cqSize > 0 && (cqOffset < position.consumeQueueOffset-cqSize || cqOffset+cqSize/2 > position.consumeQueueOffset)
+	clNeeded := clSize > 0 && (offsetPy < position.commitLogOffset-clSize || offsetPy+clSize/2 > position.commitLogOffset)
+	if cqNeeded {
+		position.consumeQueueOffset = cqOffset + cqSize
+	}
+	if clNeeded {
+		position.commitLogOffset = offsetPy + clSize
+	}
+	self.readAheadMu.Unlock()
+
+	if cqNeeded {
+		if mapedFile := consumeQueue.mapedFileQueue.findMapedFileByOffset(cqOffset, false); mapedFile != nil {
+			mapedFile.adviseSequential(cqOffset%consumeQueue.mapedFileSize, cqSize)
+		}
+	}
+
+	if clNeeded {
+		commitLog := self.defaultMessageStore.CommitLog
+		if mapedFile := commitLog.MapedFileQueue.findMapedFileByOffset(offsetPy, false); mapedFile != nil {
+			mapedFile.readAhead(offsetPy%int64(storeConfig.MapedFileSizeCommitLog), clSize)
+		}
+	}
+}
+
+// removeConsumeQueue 逻辑队列被删除时清除预读记录
+// Since 2018/1/15
+func (self *PageCacheService) removeConsumeQueue(consumeQueue *ConsumeQueue) {
+	self.readAheadMu.Lock()
+	delete(self.readAheadTable, consumeQueue)
+	self.readAheadMu.Unlock()
+}
+
+// lockLatestCommitLogFiles 锁定最新的MlockCommitLogFileNums个CommitLog文件，
+// 不再属于最新N个的文件解除锁定
+// Since 2018/1/15
+func (self *PageCacheService) lockLatestCommitLogFiles() {
+	self.lockMu.Lock()
+	defer self.lockMu.Unlock()
+
+	lockNums := int(self.defaultMessageStore.MessageStoreConfig.MlockCommitLogFileNums)
+	mapedFiles := make([]*MapedFile, 0)
+	for _, mapedFile := range self.defaultMessageStore.CommitLog.MapedFileQueue.copyMapedFiles(0) {
+		if mapedFile != nil {
+			mapedFiles = append(mapedFiles, mapedFile)
+		}
+	}
+
+	latest := make(map[*MapedFile]bool)
+	for i := len(mapedFiles) - 1; i >= 0 && len(latest) < lockNums; i-- {
+		latest[mapedFiles[i]] = true
+	}
+
+	lockedMapedFiles := make([]*MapedFile, 0, len(latest))
+	for _, mapedFile := range self.lockedMapedFiles {
+		if latest[mapedFile] {
+			lockedMapedFiles = append(lockedMapedFiles, mapedFile)
+			delete(latest, mapedFile)
+			continue
+		}
+
+		// 文件已被删除时映射区域随munmap释放，无需解锁
+		if mapedFile.hold() {
+			mapedFile.munlock()
+			mapedFile.release()
+		}
+	}
+
+	for mapedFile := range latest {
+		if !mapedFile.hold() {
+			continue
+		}
+
+		if mapedFile.mlock() {
+			lockedMapedFiles = append(lockedMapedFiles, mapedFile)
+		}
+		mapedFile.release()
+	}
+
+	self.lockedMapedFiles = lockedMapedFiles
+}
+
+// Shutdown 解除所有文件的内存锁定
+// Since 2018/1/15
+func (self *PageCacheService) Shutdown() {
+	self.lockMu.Lock()
+	defer self.lockMu.Unlock()
+
+	for _, mapedFile := range self.lockedMapedFiles {
+		if mapedFile.hold() {
+			mapedFile.munlock()
+			mapedFile.release()
+		}
+	}
+
+	self.lockedMapedFiles = make([]*MapedFile, 0)
+	logger.Info("page cache service end")
+}
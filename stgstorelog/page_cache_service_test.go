@@ -0,0 +1,78 @@
+package stgstorelog
+
+import (
+	"testing"
+)
+
+func TestPageCacheService_ReadAhead(t *testing.T) {
+	master := buildMessageStore()
+	defer master.Destroy()
+	defer master.Shutdown()
+
+	putMessage(master, 10)
+	consumeQueue := master.findConsumeQueue("test", 0)
+	storeConfig := master.MessageStoreConfig
+	storeConfig.ReadAheadConsumeQueueSize = 100 * CQStoreUnitSize
+	storeConfig.ReadAheadCommitLogSize = 1024
+
+	service := NewPageCacheService(master)
+	service.readAhead(consumeQueue, 0, 0)
+	position := service.readAheadTable[consumeQueue]
+	if position == nil || position.consumeQueueOffset != 100*CQStoreUnitSize || position.commitLogOffset != 1024 {
+		t.Fatalf("expect read ahead to cq %d and commit log 1024, actual %v", 100*CQStoreUnitSize, position)
+	}
+
+	// 已预读区域过半之前不重复预读
+	service.readAhead(consumeQueue, 40, 400)
+	if position.consumeQueueOffset != 100*CQStoreUnitSize || position.commitLogOffset != 1024 {
+		t.Errorf("read ahead should be skipped before half of the window, actual %v", position)
+	}
+
+	service.readAhead(consumeQueue, 60, 600)
+	if position.consumeQueueOffset != 160*CQStoreUnitSize || position.commitLogOffset != 1624 {
+		t.Errorf("read ahead should move forward after half of the window, actual %v", position)
+	}
+
+	storeConfig.ReadAheadEnable = false
+	service.readAhead(consumeQueue, 200, 5000)
+	if position.consumeQueueOffset != 160*CQStoreUnitSize {
+		t.Errorf("read ahead disabled, but position changed: %v", position)
+	}
+
+	service.removeConsumeQueue(consumeQueue)
+	if _, ok := service.readAheadTable[consumeQueue]; ok {
+		t.Error("read ahead position should be removed with consume queue")
+	}
+}
+
+func TestPageCacheService_LockLatestCommitLogFiles(t *testing.T) {
+	master := buildMessageStore()
+	defer master.Destroy()
+	defer master.Shutdown()
+
+	// 每个CommitLog文件8K，写入后至少有2个文件
+	putMessage(master, 200)
+	master.MessageStoreConfig.MlockCommitLogFileNums = 1
+
+	service := NewPageCacheService(master)
+	service.lockLatestCommitLogFiles()
+	if len(service.lockedMapedFiles) != 1 {
+		t.Fatalf("expect 1 locked file, actual %d", len(service.lockedMapedFiles))
+	}
+	oldLocked := service.lockedMapedFiles[0]
+	if !oldLocked.mlocked || oldLocked != master.CommitLog.MapedFileQueue.getLastMapedFile2() {
+		t.Fatal("the latest commit log file should be locked")
+	}
+
+	// 滚动到新文件后旧文件解除锁定
+	putMessage(master, 200)
+	service.lockLatestCommitLogFiles()
+	if len(service.lockedMapedFiles) != 1 || service.lockedMapedFiles[0] == oldLocked || oldLocked.mlocked {
+		t.Fatal("lock should move to the latest commit log file")
+	}
+
+	service.Shutdown()
+	if len(service.lockedMapedFiles) != 0 {
+		t.Error("all files should be unlocked after shutdown")
+	}
+}
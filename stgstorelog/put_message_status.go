@@ -14,6 +14,7 @@ const (
 	CREATE_MAPEDFILE_FAILED
 	MESSAGE_ILLEGAL
 	PUTMESSAGE_UNKNOWN_ERROR
+	OS_PAGECACHE_BUSY
 )
 
 func (status PutMessageStatus) PutMessageString() string {
@@ -34,6 +35,8 @@ func (status PutMessageStatus) PutMessageString() string {
 		return "MESSAGE_ILLEGAL"
 	case PUTMESSAGE_UNKNOWN_ERROR:
 		return "UNKNOWN_ERROR"
+	case OS_PAGECACHE_BUSY:
+		return "OS_PAGECACHE_BUSY"
 	default:
 		return "Unknow"
 	}
@@ -17,4 +17,14 @@ func NewQueryMessageResult() *QueryMessageResult {
 
 func (qmr *QueryMessageResult) AddMessage(mapedBuffer *SelectMapedBufferResult) {
 	qmr.MessageMapedList = append(qmr.MessageMapedList, mapedBuffer)
+	qmr.MessageBufferList = append(qmr.MessageBufferList, mapedBuffer.MappedByteBuffer)
+	qmr.BufferTotalSize += mapedBuffer.Size
+}
+
+// Release 释放查询结果持有的文件引用
+// Since 2018/1/12
+func (qmr *QueryMessageResult) Release() {
+	for _, mapedBuffer := range qmr.MessageMapedList {
+		mapedBuffer.Release()
+	}
 }
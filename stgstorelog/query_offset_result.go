@@ -0,0 +1,18 @@
+package stgstorelog
+
+// QueryOffsetResult 通过索引查询消息物理offset的结果
+// Since 2018/1/12
+type QueryOffsetResult struct {
+	phyOffsets               []int64
+	minIndexTimestamp        int64 // 命中条目中最早的索引时间(按秒截断)，重试时以此缩小结束时间
+	indexLastUpdateTimestamp int64
+	indexLastUpdatePhyoffset int64
+}
+
+func NewQueryOffsetResult(phyOffsets []int64, indexLastUpdateTimestamp, indexLastUpdatePhyoffset int64) *QueryOffsetResult {
+	return &QueryOffsetResult{
+		phyOffsets:               phyOffsets,
+		indexLastUpdateTimestamp: indexLastUpdateTimestamp,
+		indexLastUpdatePhyoffset: indexLastUpdatePhyoffset,
+	}
+}
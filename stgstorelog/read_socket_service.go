@@ -18,7 +18,7 @@ const (
 // Author zhoufei
 // Since 2017/10/19
 type ReadSocketService struct {
-	connection        *net.TCPConn
+	connection        net.Conn
 	haConnection      *HAConnection
 	byteBufferRead    *bytes.Buffer
 	processPosition   int32
@@ -27,7 +27,7 @@ type ReadSocketService struct {
 	mutex             *sync.Mutex
 }
 
-func NewReadSocketService(connection *net.TCPConn, haConnection *HAConnection) *ReadSocketService {
+func NewReadSocketService(connection net.Conn, haConnection *HAConnection) *ReadSocketService {
 	return &ReadSocketService{
 		connection:        connection,
 		haConnection:      haConnection,
@@ -123,7 +123,7 @@ func (self *ReadSocketService) processReadEvent() bool {
 					logger.Infof("slave[%s] request offset %d", self.haConnection.clientAddress, readOffset)
 				}
 
-				self.haConnection.haService.notifyTransferSome(self.haConnection.slaveAckOffset)
+				self.haConnection.haService.notifyTransferSome(self.haConnection, self.haConnection.slaveAckOffset)
 			}
 
 		} else if readSize == 0 {
@@ -1,5 +1,11 @@
 package stgstorelog
 
+import (
+	"sync"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
+)
+
 const (
 	NotReadableBit           = 1      // 禁止读权限
 	NotWriteableBit          = 1 << 1 // 禁止写权限
@@ -8,11 +14,24 @@ const (
 	DiskFullBit              = 1 << 4 // 磁盘空间不足
 )
 
+// RunningFlags 存储运行过程标志位，标志位的组合决定存储模式(StoreMode)；
+// 故障处理期间可由管理命令强制指定模式，强制模式优先于标志位
 type RunningFlags struct {
-	flagBits int
+	flagBits   int
+	forced     bool      // 是否强制指定了模式
+	forcedMode StoreMode // 强制指定的模式
+	lastMode   StoreMode // 上一次计算出的模式，用于记录模式切换
+	mu         sync.RWMutex
+}
+
+func NewRunningFlags() *RunningFlags {
+	return &RunningFlags{lastMode: STORE_MODE_NORMAL}
 }
 
 func (self *RunningFlags) isReadable() bool {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
 	if (self.flagBits & NotReadableBit) == 0 {
 		return true
 	}
@@ -21,29 +40,143 @@ func (self *RunningFlags) isReadable() bool {
 }
 
 func (self *RunningFlags) isWriteable() bool {
-	if (self.flagBits & (NotWriteableBit | WriteLogicsQueueErrorBit | DiskFullBit | WriteIndexFileErrorBit)) == 0 {
-		return true
+	mode := self.getMode()
+	return mode == STORE_MODE_NORMAL || mode == STORE_MODE_INDEX_DEGRADED
+}
+
+// isIndexWriteable 索引降级时不再构建索引
+func (self *RunningFlags) isIndexWriteable() bool {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	if self.forced {
+		return self.forcedMode != STORE_MODE_INDEX_DEGRADED
 	}
 
-	return false
+	return (self.flagBits & WriteIndexFileErrorBit) == 0
 }
 
 func (self *RunningFlags) makeLogicsQueueError() {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
 	self.flagBits |= WriteLogicsQueueErrorBit
+	self.checkModeChanged()
 }
 
 func (self *RunningFlags) makeIndexFileError() {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
 	self.flagBits |= WriteIndexFileErrorBit
+	self.checkModeChanged()
 }
 
 func (self *RunningFlags) getAndMakeDiskFull() bool {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
 	result := !((self.flagBits & DiskFullBit) == DiskFullBit)
 	self.flagBits |= DiskFullBit
+	self.checkModeChanged()
 	return result
 }
 
 func (self *RunningFlags) getAndMakeDiskOK() bool {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
 	result := !((self.flagBits & DiskFullBit) == DiskFullBit)
 	self.flagBits &= 0xFFFFFFFF ^ DiskFullBit
+	self.checkModeChanged()
 	return result
 }
+
+func (self *RunningFlags) getFlagBits() int {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	return self.flagBits
+}
+
+// getMode 获取当前存储模式
+func (self *RunningFlags) getMode() StoreMode {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	return self.computeMode()
+}
+
+// isForced 是否强制指定了模式
+func (self *RunningFlags) isForced() bool {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	return self.forced
+}
+
+// forceMode 强制指定存储模式，直到被clearMode清除
+func (self *RunningFlags) forceMode(mode StoreMode) StoreMode {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.forced = true
+	self.forcedMode = mode
+	self.checkModeChanged()
+	return self.lastMode
+}
+
+// clearMode 清除强制模式，并清除导致该模式的错误标志位，返回清除后的模式。
+// 磁盘满标志会在下一次磁盘空间检测时根据实际使用率重新设置
+func (self *RunningFlags) clearMode(mode StoreMode) StoreMode {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.forced && (self.forcedMode == mode || mode == STORE_MODE_NORMAL) {
+		self.forced = false
+	}
+
+	switch mode {
+	case STORE_MODE_READ_ONLY:
+		self.flagBits &= 0xFFFFFFFF ^ (NotWriteableBit | WriteLogicsQueueErrorBit)
+	case STORE_MODE_INDEX_DEGRADED:
+		self.flagBits &= 0xFFFFFFFF ^ WriteIndexFileErrorBit
+	case STORE_MODE_DISK_FULL:
+		self.flagBits &= 0xFFFFFFFF ^ DiskFullBit
+	}
+
+	self.checkModeChanged()
+	return self.lastMode
+}
+
+// computeMode 由强制模式及标志位计算模式，调用方需持有锁
+func (self *RunningFlags) computeMode() StoreMode {
+	if self.forced {
+		return self.forcedMode
+	}
+
+	if (self.flagBits & (NotWriteableBit | WriteLogicsQueueErrorBit)) != 0 {
+		return STORE_MODE_READ_ONLY
+	}
+
+	if (self.flagBits & DiskFullBit) != 0 {
+		return STORE_MODE_DISK_FULL
+	}
+
+	if (self.flagBits & WriteIndexFileErrorBit) != 0 {
+		return STORE_MODE_INDEX_DEGRADED
+	}
+
+	return STORE_MODE_NORMAL
+}
+
+// checkModeChanged 记录模式切换，调用方需持有写锁
+func (self *RunningFlags) checkModeChanged() {
+	mode := self.computeMode()
+	if mode == self.lastMode {
+		return
+	}
+
+	logger.Warnf("store mode changed from %s to %s, forced: %t flagBits: %d", self.lastMode, mode, self.forced, self.flagBits)
+	self.lastMode = mode
+}
@@ -0,0 +1,49 @@
+package stgstorelog
+
+import "testing"
+
+func TestRunningFlagsStoreMode(t *testing.T) {
+	flags := NewRunningFlags()
+	if mode := flags.getMode(); mode != STORE_MODE_NORMAL || !flags.isWriteable() {
+		t.Fatalf("expect NORMAL and writeable, got %s", mode)
+	}
+
+	flags.makeIndexFileError()
+	if mode := flags.getMode(); mode != STORE_MODE_INDEX_DEGRADED || !flags.isWriteable() || flags.isIndexWriteable() {
+		t.Fatalf("expect INDEX_DEGRADED, writeable and index not writeable, got %s", mode)
+	}
+
+	flags.getAndMakeDiskFull()
+	if mode := flags.getMode(); mode != STORE_MODE_DISK_FULL || flags.isWriteable() {
+		t.Fatalf("expect DISK_FULL and not writeable, got %s", mode)
+	}
+
+	flags.makeLogicsQueueError()
+	if mode := flags.getMode(); mode != STORE_MODE_READ_ONLY || !flags.isReadable() {
+		t.Fatalf("expect READ_ONLY and readable, got %s", mode)
+	}
+
+	if mode := flags.forceMode(STORE_MODE_NORMAL); mode != STORE_MODE_NORMAL || !flags.isWriteable() {
+		t.Fatalf("expect forced NORMAL, got %s", mode)
+	}
+
+	if mode := flags.clearMode(STORE_MODE_NORMAL); mode != STORE_MODE_READ_ONLY || flags.isForced() {
+		t.Fatalf("expect READ_ONLY after clear forced mode, got %s", mode)
+	}
+
+	if mode := flags.clearMode(STORE_MODE_READ_ONLY); mode != STORE_MODE_DISK_FULL {
+		t.Fatalf("expect DISK_FULL, got %s", mode)
+	}
+
+	flags.getAndMakeDiskOK()
+	if mode := flags.clearMode(STORE_MODE_INDEX_DEGRADED); mode != STORE_MODE_NORMAL || !flags.isIndexWriteable() {
+		t.Fatalf("expect NORMAL, got %s", mode)
+	}
+
+	if _, err := ParseStoreMode("read_only"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseStoreMode("unknown"); err == nil {
+		t.Fatal("expect parse error")
+	}
+}
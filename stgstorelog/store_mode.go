@@ -0,0 +1,49 @@
+package stgstorelog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StoreMode 存储层运行模式，由RunningFlags标志位推导，也可由管理命令强制指定
+// Since 2018/1/18
+type StoreMode int
+
+const (
+	STORE_MODE_NORMAL         StoreMode = iota // 正常读写
+	STORE_MODE_READ_ONLY                       // 只读：禁止写入，或逻辑队列写入失败
+	STORE_MODE_INDEX_DEGRADED                  // 索引降级：索引文件无法创建，消息仍可写入，但不再构建索引
+	STORE_MODE_DISK_FULL                       // 磁盘满：磁盘使用率超过警戒水位，禁止写入
+)
+
+func (mode StoreMode) String() string {
+	switch mode {
+	case STORE_MODE_NORMAL:
+		return "NORMAL"
+	case STORE_MODE_READ_ONLY:
+		return "READ_ONLY"
+	case STORE_MODE_INDEX_DEGRADED:
+		return "INDEX_DEGRADED"
+	case STORE_MODE_DISK_FULL:
+		return "DISK_FULL"
+	default:
+		return "Unknow"
+	}
+}
+
+// ParseStoreMode 按名称解析存储模式，忽略大小写
+// Since 2018/1/18
+func ParseStoreMode(name string) (StoreMode, error) {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "NORMAL":
+		return STORE_MODE_NORMAL, nil
+	case "READ_ONLY":
+		return STORE_MODE_READ_ONLY, nil
+	case "INDEX_DEGRADED":
+		return STORE_MODE_INDEX_DEGRADED, nil
+	case "DISK_FULL":
+		return STORE_MODE_DISK_FULL, nil
+	default:
+		return STORE_MODE_NORMAL, fmt.Errorf("unknown store mode %s", name)
+	}
+}
@@ -0,0 +1,532 @@
+package stgstorelog
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/static"
+	"git.oschina.net/cloudzone/smartgo/stgstorelog/config"
+	"github.com/toolkits/file"
+)
+
+const (
+	SNAPSHOT_MANIFEST_FILE = "snapshot.json" // 快照清单文件名
+	snapshotConfigDir      = "config"
+)
+
+// SnapshotFile 快照中的单个文件，Path为相对快照目录的路径
+// Since 2018/1/22
+type SnapshotFile struct {
+	Path   string `json:"Path"`
+	Size   int64  `json:"Size"`
+	Crc32  uint32 `json:"Crc32"`
+	Linked bool   `json:"Linked"` // 是否为已写满文件的硬链接
+}
+
+// SnapshotManifest 快照清单，记录快照时刻的CommitLog边界及全部文件的校验信息
+// Since 2018/1/22
+type SnapshotManifest struct {
+	CreateTimestamp        int64           `json:"CreateTimestamp"`
+	MinPhyOffset           int64           `json:"MinPhyOffset"` // 快照中第一个CommitLog文件的起始偏移量
+	FencedOffset           int64           `json:"FencedOffset"` // 快照时刻CommitLog的最大偏移量，此后写入的消息不在快照中
+	MapedFileSizeCommitLog int32           `json:"MapedFileSizeCommitLog"`
+	Files                  []*SnapshotFile `json:"Files"`
+}
+
+// TotalSize 快照文件总大小
+// Since 2018/1/22
+func (self *SnapshotManifest) TotalSize() int64 {
+	var total int64
+	for _, snapshotFile := range self.Files {
+		total += snapshotFile.Size
+	}
+	return total
+}
+
+// CreateSnapshot 在线生成存储快照，configFiles为broker层需要一并备份的配置文件(topics.json等)
+// 快照顺序：StoreCheckpoint -> 逻辑队列 -> 索引 -> CommitLog，已写满的文件使用硬链接，正在写的文件复制已写入部分；
+// CommitLog在putMessage锁内确定截止偏移量，逻辑队列及索引均不会引用截止偏移量之后的消息；
+// 快照中包含abort文件，加载时按异常退出恢复，根据StoreCheckpoint从CommitLog补齐逻辑队列及索引
+// Since 2018/1/22
+func (self *DefaultMessageStore) CreateSnapshot(snapshotDir string, configFiles ...string) (*SnapshotManifest, error) {
+	if self.ShutdownFlag {
+		return nil, fmt.Errorf("message store has shutdown")
+	}
+
+	if !atomic.CompareAndSwapInt32(&self.snapshotRunning, 0, 1) {
+		return nil, fmt.Errorf("snapshot is running")
+	}
+	defer atomic.StoreInt32(&self.snapshotRunning, 0)
+
+	if atomic.LoadInt32(&self.ConsumeQueueRebuildService.running) == 1 {
+		return nil, fmt.Errorf("consume queue rebuild is running")
+	}
+
+	if err := ensureEmptyDir(snapshotDir); err != nil {
+		return nil, err
+	}
+
+	beginTime := time.Now()
+	builder := &snapshotBuilder{snapshotDir: snapshotDir}
+	rootDir := self.MessageStoreConfig.StorePathRootDir
+
+	// StoreCheckpoint必须最先备份，保证其中的时间点不晚于快照中的逻辑队列及索引
+	self.StoreCheckpoint.flush()
+	builder.copyFile(config.GetStoreCheckpoint(rootDir), "checkpoint")
+
+	for _, consumeQueue := range self.snapshotConsumeQueues() {
+		builder.addMapedFileQueue(rootDir, consumeQueue.mapedFileQueue)
+		if consumeQueue.consumeQueueExt != nil {
+			builder.addMapedFileQueue(rootDir, consumeQueue.consumeQueueExt.mapedFileQueue)
+		}
+	}
+
+	// 在索引构建协程中备份，此时没有正在写入的索引
+	self.IndexService.waitBarrierAction(func() {
+		self.IndexService.readWriteLock.RLock()
+		defer self.IndexService.readWriteLock.RUnlock()
+
+		for element := self.IndexService.indexFileList.Front(); element != nil; element = element.Next() {
+			indexFile := element.Value.(*IndexFile)
+			mapedFile := indexFile.mapedFile
+			if indexFile.isWriteFull() {
+				builder.linkFile(mapedFile.fileName, builder.relativePath(rootDir, mapedFile.fileName))
+			} else {
+				builder.copyMapedFile(mapedFile, mapedFile.fileSize, builder.relativePath(rootDir, mapedFile.fileName))
+			}
+		}
+	})
+
+	minPhyOffset, fencedOffset := self.snapshotCommitLog(builder)
+
+	if path := config.GetDelayOffsetStorePath(rootDir); file.IsExist(path) {
+		builder.copyFile(path, filepath.Join(snapshotConfigDir, filepath.Base(path)))
+	}
+	for _, path := range configFiles {
+		if !file.IsExist(path) {
+			logger.Warnf("snapshot config file %s not exist, skip it", path)
+			continue
+		}
+		builder.copyFile(path, filepath.Join(snapshotConfigDir, filepath.Base(path)))
+	}
+
+	// 按异常退出恢复，补齐逻辑队列及索引
+	builder.writeFile(filepath.Base(config.GetAbortFile(rootDir)), nil, 0)
+
+	if builder.err != nil {
+		return nil, builder.err
+	}
+
+	manifest := &SnapshotManifest{
+		CreateTimestamp:        beginTime.UnixNano() / 1000000,
+		MinPhyOffset:           minPhyOffset,
+		FencedOffset:           fencedOffset,
+		MapedFileSizeCommitLog: self.MessageStoreConfig.MapedFileSizeCommitLog,
+		Files:                  builder.files,
+	}
+	if err := writeSnapshotManifest(snapshotDir, manifest); err != nil {
+		return nil, err
+	}
+
+	logger.Infof("create snapshot %s OK, fencedOffset: %d files: %d totalSize: %d elapsed: %v", snapshotDir,
+		fencedOffset, len(manifest.Files), manifest.TotalSize(), time.Since(beginTime))
+	return manifest, nil
+}
+
+// snapshotConsumeQueues 快照时刻的全部逻辑队列
+// Since 2018/1/22
+func (self *DefaultMessageStore) snapshotConsumeQueues() []*ConsumeQueue {
+	self.consumeQueueTableMu.RLock()
+	defer self.consumeQueueTableMu.RUnlock()
+
+	consumeQueues := make([]*ConsumeQueue, 0)
+	for _, queueTable := range self.consumeTopicTable {
+		queueTable.consumeQueuesMu.RLock()
+		for _, consumeQueue := range queueTable.consumeQueues {
+			consumeQueues = append(consumeQueues, consumeQueue)
+		}
+		queueTable.consumeQueuesMu.RUnlock()
+	}
+
+	return consumeQueues
+}
+
+// snapshotCommitLog 在putMessage锁内确定截止偏移量，锁外备份截止偏移量之前的数据，该部分数据不会再被修改
+// Return: 快照中CommitLog的起始偏移量及截止偏移量
+// Since 2018/1/22
+func (self *DefaultMessageStore) snapshotCommitLog(builder *snapshotBuilder) (int64, int64) {
+	self.CommitLog.mutex.Lock()
+	fencedOffset := self.CommitLog.getMaxOffset()
+	mapedFiles := listMapedFiles(self.CommitLog.MapedFileQueue)
+	self.CommitLog.mutex.Unlock()
+
+	minPhyOffset := int64(-1)
+	for _, mapedFile := range mapedFiles {
+		if mapedFile.fileFromOffset >= fencedOffset {
+			break
+		}
+
+		relativePath := filepath.Join(static.STORE_COMMIT_LOG_ROOT_DIR, filepath.Base(mapedFile.fileName))
+		if mapedFile.fileFromOffset+mapedFile.fileSize <= fencedOffset {
+			// 快照过程中最早的文件可能被过期清理，忽略即可
+			if !file.IsExist(mapedFile.fileName) {
+				logger.Warnf("snapshot commitlog file %s has been deleted, skip it", mapedFile.fileName)
+				continue
+			}
+			builder.linkFile(mapedFile.fileName, relativePath)
+		} else {
+			builder.copyMapedFile(mapedFile, fencedOffset-mapedFile.fileFromOffset, relativePath)
+		}
+
+		if minPhyOffset < 0 {
+			minPhyOffset = mapedFile.fileFromOffset
+		}
+	}
+
+	if minPhyOffset < 0 {
+		minPhyOffset = 0
+	}
+
+	return minPhyOffset, fencedOffset
+}
+
+// listMapedFiles 复制MapedFileQueue当前的文件列表
+// Since 2018/1/22
+func listMapedFiles(mapedFileQueue *MapedFileQueue) []*MapedFile {
+	mapedFileQueue.rwLock.RLock()
+	defer mapedFileQueue.rwLock.RUnlock()
+
+	mapedFiles := make([]*MapedFile, 0, mapedFileQueue.mapedFiles.Len())
+	for element := mapedFileQueue.mapedFiles.Front(); element != nil; element = element.Next() {
+		if mapedFile, ok := element.Value.(*MapedFile); ok && mapedFile != nil {
+			mapedFiles = append(mapedFiles, mapedFile)
+		}
+	}
+
+	return mapedFiles
+}
+
+// snapshotBuilder 生成快照文件并记录校验信息，出错后后续操作均忽略
+// Since 2018/1/22
+type snapshotBuilder struct {
+	snapshotDir string
+	files       []*SnapshotFile
+	err         error
+}
+
+func (self *snapshotBuilder) relativePath(rootDir, fileName string) string {
+	relativePath, err := filepath.Rel(rootDir, fileName)
+	if err != nil || strings.HasPrefix(relativePath, "..") {
+		self.fail(fmt.Errorf("file %s is not under store root dir %s", fileName, rootDir))
+		return filepath.Base(fileName)
+	}
+	return relativePath
+}
+
+// addMapedFileQueue 已写满的文件使用硬链接，最后一个文件复制已写入部分
+// Since 2018/1/22
+func (self *snapshotBuilder) addMapedFileQueue(rootDir string, mapedFileQueue *MapedFileQueue) {
+	for _, mapedFile := range listMapedFiles(mapedFileQueue) {
+		relativePath := self.relativePath(rootDir, mapedFile.fileName)
+		if mapedFile.isFull() {
+			self.linkFile(mapedFile.fileName, relativePath)
+		} else {
+			self.copyMapedFile(mapedFile, atomic.LoadInt64(&mapedFile.wrotePostion), relativePath)
+		}
+	}
+}
+
+// linkFile 硬链接不可用时(如跨文件系统)退化为复制
+// Since 2018/1/22
+func (self *snapshotBuilder) linkFile(srcPath, relativePath string) {
+	if self.err != nil {
+		return
+	}
+
+	destPath := filepath.Join(self.snapshotDir, relativePath)
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		self.fail(err)
+		return
+	}
+
+	if err := os.Link(srcPath, destPath); err != nil {
+		logger.Warnf("snapshot link %s err: %s, copy it instead", srcPath, err.Error())
+		self.copyFile(srcPath, relativePath)
+		return
+	}
+
+	self.addFile(relativePath, true)
+}
+
+// copyMapedFile 复制映射内存中[0, size)的数据，并补齐到文件定长，未刷盘的数据同样会被复制
+// Since 2018/1/22
+func (self *snapshotBuilder) copyMapedFile(mapedFile *MapedFile, size int64, relativePath string) {
+	if self.err != nil {
+		return
+	}
+
+	if !mapedFile.hold() {
+		self.fail(fmt.Errorf("hold maped file %s failed", mapedFile.fileName))
+		return
+	}
+	defer mapedFile.release()
+
+	if size > int64(len(mapedFile.mappedByteBuffer.MMapBuf)) {
+		size = int64(len(mapedFile.mappedByteBuffer.MMapBuf))
+	}
+
+	self.writeFile(relativePath, mapedFile.mappedByteBuffer.MMapBuf[:size], mapedFile.fileSize)
+}
+
+func (self *snapshotBuilder) copyFile(srcPath, relativePath string) {
+	if self.err != nil {
+		return
+	}
+
+	if _, err := copySnapshotFile(srcPath, filepath.Join(self.snapshotDir, relativePath)); err != nil {
+		self.fail(err)
+		return
+	}
+
+	self.addFile(relativePath, false)
+}
+
+// writeFile 写入数据后补齐到fileSize
+// Since 2018/1/22
+func (self *snapshotBuilder) writeFile(relativePath string, data []byte, fileSize int64) {
+	if self.err != nil {
+		return
+	}
+
+	destPath := filepath.Join(self.snapshotDir, relativePath)
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		self.fail(err)
+		return
+	}
+
+	if err := ioutil.WriteFile(destPath, data, 0644); err != nil {
+		self.fail(err)
+		return
+	}
+
+	if fileSize > int64(len(data)) {
+		if err := os.Truncate(destPath, fileSize); err != nil {
+			self.fail(err)
+			return
+		}
+	}
+
+	self.addFile(relativePath, false)
+}
+
+// addFile 记录文件大小及校验值，同一文件只记录一次
+// Since 2018/1/22
+func (self *snapshotBuilder) addFile(relativePath string, linked bool) {
+	for _, snapshotFile := range self.files {
+		if snapshotFile.Path == filepath.ToSlash(relativePath) {
+			return
+		}
+	}
+
+	size, checksum, err := checksumFile(filepath.Join(self.snapshotDir, relativePath))
+	if err != nil {
+		self.fail(err)
+		return
+	}
+
+	self.files = append(self.files, &SnapshotFile{
+		Path:   filepath.ToSlash(relativePath),
+		Size:   size,
+		Crc32:  checksum,
+		Linked: linked,
+	})
+}
+
+func (self *snapshotBuilder) fail(err error) {
+	if self.err == nil {
+		logger.Errorf("create snapshot %s err: %s", self.snapshotDir, err.Error())
+		self.err = err
+	}
+}
+
+// LoadSnapshotManifest 读取快照清单
+// Since 2018/1/22
+func LoadSnapshotManifest(snapshotDir string) (*SnapshotManifest, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(snapshotDir, SNAPSHOT_MANIFEST_FILE))
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := new(SnapshotManifest)
+	if err := json.Unmarshal(buf, manifest); err != nil {
+		return nil, fmt.Errorf("decode snapshot manifest err: %s", err.Error())
+	}
+
+	return manifest, nil
+}
+
+func writeSnapshotManifest(snapshotDir string, manifest *SnapshotManifest) error {
+	buf, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// 清单最后写入，存在清单即表示快照完整
+	tmpPath := filepath.Join(snapshotDir, SNAPSHOT_MANIFEST_FILE+".tmp")
+	if err := ioutil.WriteFile(tmpPath, buf, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filepath.Join(snapshotDir, SNAPSHOT_MANIFEST_FILE))
+}
+
+// VerifySnapshot 校验快照中全部文件的大小及校验值
+// Since 2018/1/22
+func VerifySnapshot(snapshotDir string, manifest *SnapshotManifest) error {
+	for _, snapshotFile := range manifest.Files {
+		size, checksum, err := checksumFile(filepath.Join(snapshotDir, filepath.FromSlash(snapshotFile.Path)))
+		if err != nil {
+			return err
+		}
+
+		if size != snapshotFile.Size || checksum != snapshotFile.Crc32 {
+			return fmt.Errorf("snapshot file %s corrupted, expect size: %d crc32: %d, actual size: %d crc32: %d",
+				snapshotFile.Path, snapshotFile.Size, snapshotFile.Crc32, size, checksum)
+		}
+	}
+
+	return nil
+}
+
+// RestoreSnapshot 校验快照后恢复到新的存储目录，恢复后可由DefaultMessageStore.Load加载；
+// storePathCommitLog为空时使用storePathRootDir下的commitlog目录，目标目录中已有存储数据时拒绝恢复
+// Since 2018/1/22
+func RestoreSnapshot(snapshotDir, storePathRootDir, storePathCommitLog string) (*SnapshotManifest, error) {
+	manifest, err := LoadSnapshotManifest(snapshotDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := VerifySnapshot(snapshotDir, manifest); err != nil {
+		return nil, err
+	}
+
+	if storePathCommitLog == "" {
+		storePathCommitLog = filepath.Join(storePathRootDir, static.STORE_COMMIT_LOG_ROOT_DIR)
+	}
+
+	for _, path := range []string{config.GetStoreCheckpoint(storePathRootDir), config.GetStorePathConsumeQueue(storePathRootDir),
+		config.GetStorePathIndex(storePathRootDir), storePathCommitLog} {
+		if isStoreDataExist(path) {
+			return nil, fmt.Errorf("store data %s already exists, restore to an empty store", path)
+		}
+	}
+
+	commitLogPrefix := static.STORE_COMMIT_LOG_ROOT_DIR + "/"
+	for _, snapshotFile := range manifest.Files {
+		destPath := filepath.Join(storePathRootDir, filepath.FromSlash(snapshotFile.Path))
+		if strings.HasPrefix(snapshotFile.Path, commitLogPrefix) {
+			destPath = filepath.Join(storePathCommitLog, strings.TrimPrefix(snapshotFile.Path, commitLogPrefix))
+		}
+
+		checksum, err := copySnapshotFile(filepath.Join(snapshotDir, filepath.FromSlash(snapshotFile.Path)), destPath)
+		if err != nil {
+			return nil, err
+		}
+		if checksum != snapshotFile.Crc32 {
+			return nil, fmt.Errorf("restore file %s checksum mismatch", destPath)
+		}
+	}
+
+	logger.Infof("restore snapshot %s to %s OK, fencedOffset: %d files: %d", snapshotDir, storePathRootDir,
+		manifest.FencedOffset, len(manifest.Files))
+	return manifest, nil
+}
+
+// copySnapshotFile 复制文件并返回校验值
+// Since 2018/1/22
+func copySnapshotFile(srcPath, destPath string) (uint32, error) {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return 0, err
+	}
+
+	dest, err := os.OpenFile(destPath, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer dest.Close()
+
+	hash := crc32.NewIEEE()
+	if _, err := io.Copy(io.MultiWriter(dest, hash), src); err != nil {
+		return 0, err
+	}
+
+	return hash.Sum32(), dest.Sync()
+}
+
+func checksumFile(path string) (int64, uint32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	hash := crc32.NewIEEE()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return size, hash.Sum32(), nil
+}
+
+// ensureEmptyDir 快照目录不存在时创建，已存在时必须为空目录
+// Since 2018/1/22
+func ensureEmptyDir(dir string) error {
+	if dir == "" {
+		return fmt.Errorf("snapshot dir is empty")
+	}
+
+	if file.IsExist(dir) {
+		names, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		if len(names) > 0 {
+			return fmt.Errorf("snapshot dir %s is not empty", dir)
+		}
+		return nil
+	}
+
+	return os.MkdirAll(dir, 0755)
+}
+
+// isStoreDataExist 文件存在，或目录存在且不为空
+// Since 2018/1/22
+func isStoreDataExist(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	if !info.IsDir() {
+		return true
+	}
+
+	names, _ := ioutil.ReadDir(path)
+	return len(names) > 0
+}
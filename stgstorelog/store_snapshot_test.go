@@ -0,0 +1,90 @@
+package stgstorelog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDefaultMessageStore_CreateAndRestoreSnapshot(t *testing.T) {
+	master := buildMessageStore()
+	defer master.Destroy()
+	defer master.Shutdown()
+
+	putMessage(master, 100)
+	maxOffset := master.GetMaxOffsetInQueue("test", 0)
+
+	snapshotDir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(snapshotDir)
+
+	manifest, err := master.CreateSnapshot(snapshotDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.FencedOffset != master.CommitLog.getMaxOffset() {
+		t.Errorf("fenced offset expect %d, actual %d", master.CommitLog.getMaxOffset(), manifest.FencedOffset)
+	}
+	if _, err := master.CreateSnapshot(snapshotDir); err == nil {
+		t.Error("snapshot to a non-empty dir should be refused")
+	}
+
+	rootDir, err := ioutil.TempDir("", "restore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootDir)
+
+	if _, err := RestoreSnapshot(snapshotDir, rootDir, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RestoreSnapshot(snapshotDir, rootDir, ""); err == nil {
+		t.Error("restore to a non-empty store should be refused")
+	}
+
+	messageStoreConfig := buildMessageStoreConfig()
+	messageStoreConfig.StorePathRootDir = rootDir
+	messageStoreConfig.StorePathCommitLog = filepath.Join(rootDir, "commitlog")
+	restored := NewDefaultMessageStore(messageStoreConfig, nil)
+	if !restored.Load() {
+		t.Fatal("load restored store failed")
+	}
+	defer restored.Destroy()
+
+	if actual := restored.GetMaxOffsetInQueue("test", 0); actual != maxOffset {
+		t.Errorf("restored max offset expect %d, actual %d", maxOffset, actual)
+	}
+	if actual := restored.CommitLog.getMaxOffset(); actual != manifest.FencedOffset {
+		t.Errorf("restored commitlog max offset expect %d, actual %d", manifest.FencedOffset, actual)
+	}
+}
+
+func TestVerifySnapshot(t *testing.T) {
+	snapshotDir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(snapshotDir)
+
+	builder := &snapshotBuilder{snapshotDir: snapshotDir}
+	builder.writeFile("checkpoint", []byte("checkpoint"), 24)
+	if builder.err != nil {
+		t.Fatal(builder.err)
+	}
+	manifest := &SnapshotManifest{Files: builder.files}
+	if manifest.TotalSize() != 24 {
+		t.Errorf("total size expect 24, actual %d", manifest.TotalSize())
+	}
+
+	if err := VerifySnapshot(snapshotDir, manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	ioutil.WriteFile(filepath.Join(snapshotDir, "checkpoint"), []byte("corrupted"), 0644)
+	if err := VerifySnapshot(snapshotDir, manifest); err == nil {
+		t.Error("corrupted snapshot should fail to verify")
+	}
+}
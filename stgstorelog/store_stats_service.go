@@ -4,11 +4,14 @@ import (
 	"bytes"
 	"container/list"
 	"fmt"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"git.oschina.net/cloudzone/smartgo/stgcommon/logger"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/metrics"
+	stgsync "git.oschina.net/cloudzone/smartgo/stgcommon/sync"
 	"git.oschina.net/cloudzone/smartgo/stgcommon/utils/timeutil"
 )
 
@@ -16,6 +19,15 @@ const (
 	FrequencyOfSampling  = 1000
 	MaxRecordsOfSampling = 60 * 10
 	PrintTPSInterval     = 60 * 1
+	RollStatsInterval    = 60 * 1000 // 直方图及计数按分钟滚动
+)
+
+// 存储层统计项，通过VIEW_BROKER_STATS_DATA查询最近一分钟的数据
+const (
+	STORE_PUT_LATENCY    = "STORE_PUT_LATENCY"    // statsKey: topic
+	STORE_QUEUE_PUT_NUMS = "STORE_QUEUE_PUT_NUMS" // statsKey: topic@queueId
+	STORE_FLUSH_LATENCY  = "STORE_FLUSH_LATENCY"  // statsKey忽略
+	STORE_PAGE_CACHE_HIT = "STORE_PAGE_CACHE_HIT" // statsKey忽略
 )
 
 type StoreStatsService struct {
@@ -42,6 +54,24 @@ type StoreStatsService struct {
 	notify                       *WaitNotifyObject
 	timesMapMutex                *sync.RWMutex
 	sizeMapMutex                 *sync.RWMutex
+	putLatencyTable              *stgsync.Map     // topic -> *windowHistogram，写入耗时
+	queuePutNumsTable            *stgsync.Map     // topic@queueId -> *windowCounter，写入条数
+	flushLatency                 *windowHistogram // CommitLog刷盘耗时
+	getInPageCache               windowCounter    // 拉取消息时命中page cache的条数
+	getInDisk                    windowCounter    // 拉取消息时需要读磁盘的条数
+	lastRollTimestamp            int64
+}
+
+// StoreStatsItem 存储层统计项最近一分钟的数据，耗时单位为微秒
+// Since 2018/1/23
+type StoreStatsItem struct {
+	Sum   int64
+	Tps   float64
+	Avgpt float64
+	P50   int64
+	P99   int64
+	P999  int64
+	Max   int64
 }
 
 func NewStoreStatsService() *StoreStatsService {
@@ -68,6 +98,10 @@ func NewStoreStatsService() *StoreStatsService {
 	service.notify = NewWaitNotifyObject()
 	service.timesMapMutex = new(sync.RWMutex)
 	service.sizeMapMutex = new(sync.RWMutex)
+	service.putLatencyTable = stgsync.NewMap()
+	service.queuePutNumsTable = stgsync.NewMap()
+	service.flushLatency = newWindowHistogram()
+	service.lastRollTimestamp = time.Now().UnixNano() / 1000000
 
 	for i := 0; i < len(service.putMessageDistributeTime); i++ {
 		service.putMessageDistributeTime[i] = 0
@@ -87,6 +121,7 @@ func (self *StoreStatsService) Start() {
 		self.notify.waitForRunning(1000)
 		self.sampling()
 		self.printTps()
+		self.rollStats()
 	}
 
 	logger.Info("store stats service end")
@@ -445,10 +480,172 @@ func (self *StoreStatsService) GetRuntimeInfo() map[string]string {
 	result["getMissTps"] = self.getGetMissTps()
 	result["getTotalTps"] = self.getGetTotalTps()
 	result["getTransferedTps"] = self.getGetTransferedTps()
+	self.buildLatencyStats(result)
 
 	return result
 }
 
+// buildLatencyStats 最近一分钟各Topic写入耗时分布、各队列写入速率、刷盘耗时及page cache命中率，耗时单位为微秒
+// Since 2018/1/23
+func (self *StoreStatsService) buildLatencyStats(result map[string]string) {
+	for iterator := self.putLatencyTable.Iterator(); iterator.HasNext(); {
+		topic, value, ok := iterator.Next()
+		if !ok {
+			continue
+		}
+		if histogram := value.(*windowHistogram).lastMinute(); histogram.Total() > 0 {
+			result["putLatency@"+topic.(string)] = histogram.String()
+		}
+	}
+
+	for iterator := self.queuePutNumsTable.Iterator(); iterator.HasNext(); {
+		statsKey, value, ok := iterator.Next()
+		if !ok {
+			continue
+		}
+		if count, tps := value.(*windowCounter).lastMinute(); count > 0 {
+			result["putTps@"+statsKey.(string)] = fmt.Sprintf("%0.2f", tps)
+		}
+	}
+
+	result["flushLatency"] = self.flushLatency.lastMinute().String()
+	result["pageCacheHitRatio"] = fmt.Sprintf("%0.4f", self.getPageCacheHitRatio())
+}
+
+func (self *StoreStatsService) getPageCacheHitRatio() float64 {
+	hit, _ := self.getInPageCache.lastMinute()
+	miss, _ := self.getInDisk.lastMinute()
+	if hit+miss == 0 {
+		return 1
+	}
+	return float64(hit) / float64(hit+miss)
+}
+
+// recordPutMessage 记录Topic写入耗时及队列写入条数
+// Since 2018/1/23
+func (self *StoreStatsService) recordPutMessage(topic string, queueId int32, latency time.Duration) {
+	histogram, _ := self.putLatencyTable.Get(topic)
+	if histogram == nil {
+		histogram = newWindowHistogram()
+		if prev, _ := self.putLatencyTable.PutIfAbsent(topic, histogram); prev != nil {
+			histogram = prev
+		}
+	}
+	histogram.(*windowHistogram).histogram.Record(int64(latency / time.Microsecond))
+
+	statsKey := fmt.Sprintf("%s@%d", topic, queueId)
+	counter, _ := self.queuePutNumsTable.Get(statsKey)
+	if counter == nil {
+		counter = new(windowCounter)
+		if prev, _ := self.queuePutNumsTable.PutIfAbsent(statsKey, counter); prev != nil {
+			counter = prev
+		}
+	}
+	counter.(*windowCounter).add(1)
+}
+
+// recordFlush 记录CommitLog一次实际刷盘的耗时
+// Since 2018/1/23
+func (self *StoreStatsService) recordFlush(latency time.Duration) {
+	self.flushLatency.histogram.Record(int64(latency / time.Microsecond))
+}
+
+// recordGetMessage 记录拉取的消息是否命中page cache
+// Since 2018/1/23
+func (self *StoreStatsService) recordGetMessage(isInDisk bool) {
+	if isInDisk {
+		self.getInDisk.add(1)
+	} else {
+		self.getInPageCache.add(1)
+	}
+}
+
+// rollStats 每分钟滚动一次，计算最近一分钟的分布及速率；计数只增不减，滚动与写入互不影响
+// Since 2018/1/23
+func (self *StoreStatsService) rollStats() {
+	now := timeutil.CurrentTimeMillis()
+	elapsed := now - self.lastRollTimestamp
+	if elapsed < RollStatsInterval {
+		return
+	}
+	self.lastRollTimestamp = now
+
+	for iterator := self.putLatencyTable.Iterator(); iterator.HasNext(); {
+		if _, value, ok := iterator.Next(); ok {
+			value.(*windowHistogram).roll()
+		}
+	}
+	for iterator := self.queuePutNumsTable.Iterator(); iterator.HasNext(); {
+		if _, value, ok := iterator.Next(); ok {
+			value.(*windowCounter).roll(elapsed)
+		}
+	}
+
+	self.flushLatency.roll()
+	self.getInPageCache.roll(elapsed)
+	self.getInDisk.roll(elapsed)
+}
+
+// GetStatsItem 查询存储层统计项最近一分钟的数据，统计项不存在时返回nil
+// STORE_PAGE_CACHE_HIT的Sum为命中条数，Avgpt为命中率
+// Since 2018/1/23
+func (self *StoreStatsService) GetStatsItem(statsName, statsKey string) *StoreStatsItem {
+	switch statsName {
+	case STORE_PUT_LATENCY:
+		histogram, _ := self.putLatencyTable.Get(statsKey)
+		if histogram == nil {
+			return nil
+		}
+		return newStoreStatsItem(histogram.(*windowHistogram).lastMinute())
+	case STORE_FLUSH_LATENCY:
+		return newStoreStatsItem(self.flushLatency.lastMinute())
+	case STORE_QUEUE_PUT_NUMS:
+		counter, _ := self.queuePutNumsTable.Get(statsKey)
+		if counter == nil {
+			return nil
+		}
+		count, tps := counter.(*windowCounter).lastMinute()
+		return &StoreStatsItem{Sum: count, Tps: tps}
+	case STORE_PAGE_CACHE_HIT:
+		count, tps := self.getInPageCache.lastMinute()
+		return &StoreStatsItem{Sum: count, Tps: tps, Avgpt: self.getPageCacheHitRatio()}
+	default:
+		return nil
+	}
+}
+
+// ForeachPutLatency 按Topic升序遍历写入耗时的累计分布，用于输出/metrics
+// Since 2018/1/30
+func (self *StoreStatsService) ForeachPutLatency(fn func(topic string, snapshot *metrics.HistogramSnapshot)) {
+	histograms := make(map[string]*windowHistogram)
+	var topics []string
+	for iterator := self.putLatencyTable.Iterator(); iterator.HasNext(); {
+		topic, value, ok := iterator.Next()
+		if !ok {
+			continue
+		}
+		histograms[topic.(string)] = value.(*windowHistogram)
+		topics = append(topics, topic.(string))
+	}
+
+	sort.Strings(topics)
+	for _, topic := range topics {
+		fn(topic, histograms[topic].histogram.Snapshot(false))
+	}
+}
+
+func newStoreStatsItem(histogram *metrics.HistogramSnapshot) *StoreStatsItem {
+	return &StoreStatsItem{
+		Sum:   histogram.Total(),
+		Tps:   float64(histogram.Total()) * 1000 / RollStatsInterval,
+		Avgpt: histogram.Avg(),
+		P50:   histogram.Percentile(0.5),
+		P99:   histogram.Percentile(0.99),
+		P999:  histogram.Percentile(0.999),
+		Max:   histogram.Max(),
+	}
+}
+
 func (self *StoreStatsService) setSinglePutMessageTopicSizeTotal(topic string, value int64) {
 	self.sizeMapMutex.Lock()
 	defer self.sizeMapMutex.Unlock()
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon"
+	"git.oschina.net/cloudzone/smartgo/stgcommon/static"
+	"git.oschina.net/cloudzone/smartgo/stgstorelog"
+	"git.oschina.net/cloudzone/smartgo/stgstorelog/config"
+	"github.com/toolkits/file"
+)
+
+// 离线重建逻辑队列及索引，broker必须已停止
+// eg: rebuild -r /home/smartgo/store -t TopicA -q 0 -d
+func main() {
+	r := flag.String("r", "", "store root dir of the stopped broker")
+	t := flag.String("t", "", "topic to rebuild, empty means all topics")
+	q := flag.Int("q", -1, "queue id to rebuild, less than 0 means all queues of the topic")
+	i := flag.Bool("i", false, "rebuild index files too, only used when rebuild all topics")
+	d := flag.Bool("d", false, "dry run, only report differences")
+	f := flag.Bool("f", false, "force to run even if the abort file exists")
+	h := flag.Bool("h", false, "help")
+
+	flag.Parse()
+
+	if *h || *r == "" {
+		flag.Usage()
+		os.Exit(0)
+	}
+
+	if !file.IsExist(*r) {
+		fmt.Printf("store root dir %s not exist\n", *r)
+		os.Exit(1)
+	}
+
+	// abort文件存在说明broker正在运行或异常退出
+	if file.IsExist(config.GetAbortFile(*r)) && !*f {
+		fmt.Printf("abort file %s exists, the broker may be running, stop it first or use -f after it crashed\n", config.GetAbortFile(*r))
+		os.Exit(1)
+	}
+
+	messageStoreConfig := stgstorelog.NewMessageStoreConfig()
+	messageStoreConfig.StorePathRootDir = *r
+	messageStoreConfig.StorePathCommitLog = filepath.Join(*r, static.STORE_COMMIT_LOG_ROOT_DIR)
+
+	messageStore := stgstorelog.NewDefaultMessageStore(messageStoreConfig, nil)
+	if !messageStore.Load() {
+		fmt.Println("load message store failed")
+		os.Exit(1)
+	}
+
+	if err := messageStore.RebuildConsumeQueue(*t, int32(*q), *i, *d); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	status := stgcommon.CONSUME_QUEUE_REBUILD_STATUS.String()
+	for {
+		time.Sleep(time.Second)
+
+		stats := messageStore.GetRuntimeInfo()
+		fmt.Printf("%s progress: %s\n", stats[status], stats[stgcommon.CONSUME_QUEUE_REBUILD_PROGRESS.String()])
+		if stats[status] == stgstorelog.RebuildStatusRunning {
+			continue
+		}
+
+		for _, key := range []stgcommon.RunningStats{stgcommon.CONSUME_QUEUE_REBUILD_TARGET,
+			stgcommon.CONSUME_QUEUE_REBUILD_DISPATCH_NUMS, stgcommon.CONSUME_QUEUE_REBUILD_CORRUPT_NUMS,
+			stgcommon.CONSUME_QUEUE_REBUILD_DIFF_NUMS, stgcommon.CONSUME_QUEUE_REBUILD_DIFF_SAMPLES,
+			stgcommon.CONSUME_QUEUE_REBUILD_ELAPSED_TIME, stgcommon.CONSUME_QUEUE_REBUILD_ERROR} {
+			fmt.Printf("%s: %s\n", key.String(), stats[key.String()])
+		}
+
+		if stats[status] != stgstorelog.RebuildStatusDone {
+			os.Exit(1)
+		}
+		return
+	}
+}
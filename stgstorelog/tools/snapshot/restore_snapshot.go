@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"git.oschina.net/cloudzone/smartgo/stgcommon/static"
+	"git.oschina.net/cloudzone/smartgo/stgstorelog"
+	"github.com/toolkits/file"
+)
+
+// 校验存储快照并恢复到新broker的存储目录，恢复后启动broker即可加载
+// eg: snapshot -s /data/snapshot/20180122 -r /home/smartgo/store
+func main() {
+	s := flag.String("s", "", "snapshot dir created by the broker")
+	r := flag.String("r", "", "store root dir of the target broker")
+	c := flag.String("c", "", "commitlog dir of the target broker, default is commitlog under the store root dir")
+	v := flag.Bool("v", false, "only verify the checksums of the snapshot")
+	h := flag.Bool("h", false, "help")
+
+	flag.Parse()
+
+	if *h || *s == "" || (*r == "" && !*v) {
+		flag.Usage()
+		os.Exit(0)
+	}
+
+	if !file.IsExist(*s) {
+		fmt.Printf("snapshot dir %s not exist\n", *s)
+		os.Exit(1)
+	}
+
+	manifest, err := stgstorelog.LoadSnapshotManifest(*s)
+	if err != nil {
+		fmt.Printf("load snapshot manifest err: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if *v {
+		if err := stgstorelog.VerifySnapshot(*s, manifest); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		fmt.Printf("verify snapshot OK, files: %d totalSize: %d\n", len(manifest.Files), manifest.TotalSize())
+		return
+	}
+
+	commitLogDir := *c
+	if commitLogDir == "" {
+		commitLogDir = filepath.Join(*r, static.STORE_COMMIT_LOG_ROOT_DIR)
+	}
+
+	if _, err := stgstorelog.RestoreSnapshot(*s, *r, commitLogDir); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Printf("restore snapshot OK, minPhyOffset: %d fencedOffset: %d files: %d totalSize: %d\n",
+		manifest.MinPhyOffset, manifest.FencedOffset, len(manifest.Files), manifest.TotalSize())
+}
@@ -14,7 +14,7 @@ import (
 // Author zhoufei
 // Since 2017/10/19
 type WriteSocketService struct {
-	connection              *net.TCPConn
+	connection              net.Conn
 	haConnection            *HAConnection
 	byteBufferHeader        *bytes.Buffer
 	nextTransferFromWhere   int64
@@ -26,7 +26,7 @@ type WriteSocketService struct {
 	responseChan            chan []byte
 }
 
-func NewWriteSocketService(connection *net.TCPConn, haConnection *HAConnection) *WriteSocketService {
+func NewWriteSocketService(connection net.Conn, haConnection *HAConnection) *WriteSocketService {
 	service := new(WriteSocketService)
 	service.connection = connection
 	service.haConnection = haConnection
@@ -31,6 +31,8 @@ func (createTopic *CreateTopic) customizeValidationErr(err error) error {
 			return fmt.Errorf("集群名称'%s'字段无效", e.Name)
 		case "topic":
 			return fmt.Errorf("topic名称'%s'字段无效", e.Name)
+		case "retentionHours", "retentionBytes", "messageTtlSeconds":
+			return fmt.Errorf("'%s'字段无效、最小值为0", e.Name)
 		}
 	}
 
@@ -100,6 +102,8 @@ func (updateTopic *UpdateTopic) customizeValidationErr(err error) error {
 			return fmt.Errorf("'%s'字段无效、最小值为8", e.Name)
 		case "readQueueNums":
 			return fmt.Errorf("'%s'字段无效、最小值为8", e.Name)
+		case "retentionHours", "retentionBytes", "messageTtlSeconds":
+			return fmt.Errorf("'%s'字段无效、最小值为0", e.Name)
 		}
 	}
 
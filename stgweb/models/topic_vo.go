@@ -59,21 +59,29 @@ type DeleteTopic struct {
 // Author: tianyuliang
 // Since: 2017/11/7
 type UpdateTopic struct {
-	ClusterName    string `json:"clusterName" valid:"required"` // 集群名称
-	Topic          string `json:"topic" valid:"required"`       // topic名称
-	BrokerAddr     string `json:"brokerAddr" valid:"required"`  // broker地址
-	WriteQueueNums int    `json:"writeQueueNums" valid:"min=8"` // 写队列数
-	ReadQueueNums  int    `json:"readQueueNums" valid:"min=8"`  // 读队列数
-	Unit           bool   `json:"unit"`                         // 是否为单元topic
-	Order          bool   `json:"order"`                        // 是否为顺序topic
+	ClusterName       string   `json:"clusterName" valid:"required"`    // 集群名称
+	Topic             string   `json:"topic" valid:"required"`          // topic名称
+	BrokerAddr        string   `json:"brokerAddr" valid:"required"`     // broker地址
+	WriteQueueNums    int      `json:"writeQueueNums" valid:"min=8"`    // 写队列数
+	ReadQueueNums     int      `json:"readQueueNums" valid:"min=8"`     // 读队列数
+	Unit              bool     `json:"unit"`                            // 是否为单元topic
+	Order             bool     `json:"order"`                           // 是否为顺序topic
+	RetentionHours    int32    `json:"retentionHours" valid:"min=0"`    // 消息保留时间（单位小时），0表示使用broker全局配置
+	RetentionBytes    int64    `json:"retentionBytes" valid:"min=0"`    // 每个队列消息保留大小（单位字节），0表示不限制
+	IndexedProperties []string `json:"indexedProperties"`               // 需要建立索引的消息属性名称
+	MessageTtlSeconds int64    `json:"messageTtlSeconds" valid:"min=0"` // 消息默认存活时间（单位秒），0表示永不过期
 }
 
 // CreateTopic 创建Topic
 // Author: tianyuliang
 // Since: 2017/11/7
 type CreateTopic struct {
-	ClusterName string `json:"clusterName" valid:"required"` // 集群名称
-	Topic       string `json:"topic" valid:"required"`       // topic名称
+	ClusterName       string   `json:"clusterName" valid:"required"`    // 集群名称
+	Topic             string   `json:"topic" valid:"required"`          // topic名称
+	RetentionHours    int32    `json:"retentionHours" valid:"min=0"`    // 消息保留时间（单位小时），0表示使用broker全局配置
+	RetentionBytes    int64    `json:"retentionBytes" valid:"min=0"`    // 每个队列消息保留大小（单位字节），0表示不限制
+	IndexedProperties []string `json:"indexedProperties"`               // 需要建立索引的消息属性名称
+	MessageTtlSeconds int64    `json:"messageTtlSeconds" valid:"min=0"` // 消息默认存活时间（单位秒），0表示永不过期
 }
 
 // TopicVo 查询Topic列表
@@ -165,6 +173,10 @@ func (t *CreateTopic) ToTopicConfig() *stgcommon.TopicConfig {
 	perm := constant.PERM_READ | constant.PERM_WRITE
 	queueNum := int32(8)
 	topicConfig := stgcommon.NewDefaultTopicConfig(t.Topic, queueNum, queueNum, perm, stgcommon.SINGLE_TAG)
+	topicConfig.RetentionHours = t.RetentionHours
+	topicConfig.RetentionBytes = t.RetentionBytes
+	topicConfig.IndexedProperties = t.IndexedProperties
+	topicConfig.MessageTtlSeconds = t.MessageTtlSeconds
 	return topicConfig
 }
 
@@ -174,6 +186,10 @@ func (t *CreateTopic) ToTopicConfig() *stgcommon.TopicConfig {
 func (t *UpdateTopic) ToTopicConfig() *stgcommon.TopicConfig {
 	perm := constant.PERM_READ | constant.PERM_WRITE
 	topicConfig := stgcommon.NewDefaultTopicConfig(t.Topic, int32(t.ReadQueueNums), int32(t.WriteQueueNums), perm, stgcommon.SINGLE_TAG)
+	topicConfig.RetentionHours = t.RetentionHours
+	topicConfig.RetentionBytes = t.RetentionBytes
+	topicConfig.IndexedProperties = t.IndexedProperties
+	topicConfig.MessageTtlSeconds = t.MessageTtlSeconds
 	return topicConfig
 }
 
@@ -230,3 +230,23 @@ func (service *MessageService) getMsgBodyPath(msgId string) string {
 	msgBodyPath := stgcommon.MSG_BODY_DIR + msgId
 	return msgBodyPath
 }
+
+// QueryMsgByProperty 按Topic声明的索引属性查询消息
+// Since: 2018/1/12
+func (service *MessageService) QueryMsgByProperty(topic, propertyName, value string, maxNum int, begin, end int64) ([]*models.MessageExtVo, error) {
+	defer utils.RecoveredFn()
+	defaultMQAdminExt := service.GetDefaultMQAdminExtImpl()
+	defaultMQAdminExt.Start()
+	defer defaultMQAdminExt.Shutdown()
+
+	queryResult, err := defaultMQAdminExt.QueryMessage(topic, propertyName, value, maxNum, begin, end)
+	if err != nil {
+		return nil, err
+	}
+
+	messageExtVos := make([]*models.MessageExtVo, 0, len(queryResult.MessageList))
+	for _, messageExt := range queryResult.MessageList {
+		messageExtVos = append(messageExtVos, models.ToMessageExtVo(messageExt))
+	}
+	return messageExtVos, nil
+}
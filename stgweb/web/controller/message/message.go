@@ -6,10 +6,12 @@ import (
 	"git.oschina.net/cloudzone/smartgo/stgweb/modules/messageService"
 	"github.com/kataras/iris/context"
 	"strings"
+	"time"
 )
 
 const (
-	message_id_length = 32
+	message_id_length     = 32
+	default_query_max_num = 64 // 按属性查询消息的默认最大条数
 )
 
 // MessageBody 查询消息内容
@@ -77,3 +79,39 @@ func MessageQuery(ctx context.Context) {
 
 	ctx.JSON(resp.NewSuccessResponse(data))
 }
+
+// MessageQueryByProperty 按Topic声明的索引属性查询消息
+// Since: 2018/1/12
+func MessageQueryByProperty(ctx context.Context) {
+	topic := strings.TrimSpace(ctx.URLParam("topic"))
+	propertyName := strings.TrimSpace(ctx.URLParam("propertyName"))
+	value := strings.TrimSpace(ctx.URLParam("value"))
+	if topic == "" || propertyName == "" || value == "" {
+		errMsg := "topic、propertyName、value字段值不能为空"
+		logger.Errorf("%s %s %s", errMsg, ctx.Method(), ctx.Path())
+		ctx.JSON(resp.NewFailedResponse(resp.ResponseCodes.ServerError, errMsg))
+		return
+	}
+
+	maxNum, err := ctx.URLParamInt("maxNum")
+	if err != nil || maxNum <= 0 {
+		maxNum = default_query_max_num
+	}
+	end, err := ctx.URLParamInt64("end")
+	if err != nil || end <= 0 {
+		end = time.Now().UnixNano() / int64(time.Millisecond)
+	}
+	begin, err := ctx.URLParamInt64("begin")
+	if err != nil || begin < 0 {
+		begin = 0
+	}
+
+	data, err := messageService.Default().QueryMsgByProperty(topic, propertyName, value, maxNum, begin, end)
+	if err != nil {
+		logger.Errorf("%s %s %s", err.Error(), ctx.Method(), ctx.Path())
+		ctx.JSON(resp.NewFailedResponse(resp.ResponseCodes.ServerError, err.Error()))
+		return
+	}
+
+	ctx.JSON(resp.NewSuccessResponse(data))
+}
@@ -57,6 +57,7 @@ func Route(ctx *web.Context) error {
 		api.Get("/msg/body", message.MessageBody)
 		api.Get("/msg/track", message.MessageTrack)
 		api.Get("/msg/query", message.MessageQuery)
+		api.Get("/msg/property", message.MessageQueryByProperty)
 	}
 
 	// 运维